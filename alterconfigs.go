@@ -20,6 +20,22 @@ type AlterConfigsRequest struct {
 	// When set to true, topics are not created but the configuration is
 	// validated as if they were.
 	ValidateOnly bool
+
+	// When set to true, the current configuration of the resources is read
+	// with DescribeConfigs first, and the keys that were explicitly set on the
+	// resources but are not part of the request are sent again with their
+	// current values. Otherwise, AlterConfigs replaces the whole configuration
+	// of the resources, resetting the keys missing from the request to their
+	// default values.
+	//
+	// The read and the write are two separate requests, changes made by other
+	// programs in between are lost. IncrementalAlterConfigs should be used
+	// instead when the brokers support it (Kafka 2.3+).
+	//
+	// Brokers do not return the values of sensitive configuration keys, the
+	// request fails if one of them is set on a resource and is not part of the
+	// request.
+	Merge bool
 }
 
 type AlterConfigRequestResource struct {
@@ -63,9 +79,18 @@ type AlterConfigsResponseResource struct {
 // AlterConfigs sends a config altering request to a kafka broker and returns the
 // response.
 func (c *Client) AlterConfigs(ctx context.Context, req *AlterConfigsRequest) (*AlterConfigsResponse, error) {
-	resources := make([]alterconfigs.RequestResources, len(req.Resources))
+	requestResources := req.Resources
+
+	if req.Merge {
+		var err error
+		if requestResources, err = c.mergeConfigs(ctx, req); err != nil {
+			return nil, fmt.Errorf("kafka.(*Client).AlterConfigs: %w", err)
+		}
+	}
 
-	for i, t := range req.Resources {
+	resources := make([]alterconfigs.RequestResources, len(requestResources))
+
+	for i, t := range requestResources {
 		configs := make([]alterconfigs.RequestConfig, len(t.Configs))
 		for j, v := range t.Configs {
 			configs[j] = alterconfigs.RequestConfig{
@@ -104,3 +129,217 @@ func (c *Client) AlterConfigs(ctx context.Context, req *AlterConfigsRequest) (*A
 
 	return ret, nil
 }
+
+// mergeConfigs returns the resources of req with the configuration keys that
+// are currently set on them added to the keys of the request.
+func (c *Client) mergeConfigs(ctx context.Context, req *AlterConfigsRequest) ([]AlterConfigRequestResource, error) {
+	describe := &DescribeConfigsRequest{
+		Addr:      req.Addr,
+		Resources: make([]DescribeConfigRequestResource, len(req.Resources)),
+	}
+
+	for i, r := range req.Resources {
+		describe.Resources[i] = DescribeConfigRequestResource{
+			ResourceType: r.ResourceType,
+			ResourceName: r.ResourceName,
+		}
+	}
+
+	res, err := c.DescribeConfigs(ctx, describe)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]AlterConfigRequestResource, len(req.Resources))
+
+	for i, r := range req.Resources {
+		current, ok := findDescribedResource(res.Resources, r)
+		if !ok {
+			return nil, fmt.Errorf("configuration of resource %s was not described by the broker", r.ResourceName)
+		}
+		if current.Error != nil {
+			return nil, fmt.Errorf("failed to describe the configuration of resource %s: %w", r.ResourceName, current.Error)
+		}
+
+		requested := make(map[string]struct{}, len(r.Configs))
+		for _, config := range r.Configs {
+			requested[config.Name] = struct{}{}
+		}
+
+		configs := make([]AlterConfigRequestConfig, len(r.Configs), len(r.Configs)+len(current.ConfigEntries))
+		copy(configs, r.Configs)
+
+		for _, entry := range current.ConfigEntries {
+			if _, ok := requested[entry.ConfigName]; ok || !isResourceConfig(r, entry) {
+				continue
+			}
+			if entry.IsSensitive {
+				return nil, fmt.Errorf("sensitive configuration %s of resource %s cannot be preserved, it must be part of the request", entry.ConfigName, r.ResourceName)
+			}
+			configs = append(configs, AlterConfigRequestConfig{
+				Name:  entry.ConfigName,
+				Value: entry.ConfigValue,
+			})
+		}
+
+		resources[i] = AlterConfigRequestResource{
+			ResourceType: r.ResourceType,
+			ResourceName: r.ResourceName,
+			Configs:      configs,
+		}
+	}
+
+	return resources, nil
+}
+
+func findDescribedResource(resources []DescribeConfigResponseResource, r AlterConfigRequestResource) (DescribeConfigResponseResource, bool) {
+	for _, resource := range resources {
+		if resource.ResourceType == int8(r.ResourceType) && resource.ResourceName == r.ResourceName {
+			return resource, true
+		}
+	}
+	return DescribeConfigResponseResource{}, false
+}
+
+// isResourceConfig returns true if the configuration entry was set on the
+// resource itself, which are the entries that AlterConfigs replaces.
+func isResourceConfig(r AlterConfigRequestResource, entry DescribeConfigResponseConfigEntry) bool {
+	if entry.ReadOnly {
+		return false
+	}
+	switch ConfigSource(entry.ConfigSource) {
+	case ConfigSourceUnknown:
+		// DescribeConfigs v0 does not report the source of entries.
+		return !entry.IsDefault
+	case ConfigSourceDynamicTopic:
+		return r.ResourceType == ResourceTypeTopic
+	case ConfigSourceDynamicBroker:
+		return r.ResourceType == ResourceTypeBroker && r.ResourceName != ""
+	case ConfigSourceDynamicDefaultBroker:
+		return r.ResourceType == ResourceTypeBroker && r.ResourceName == ""
+	default:
+		return false
+	}
+}
+
+// AlterConfigs sets the configuration entries of topic.
+//
+// Like the AlterConfigs API, the method replaces the whole configuration of
+// the topic: the entries that were set on the topic but are not passed to the
+// method are reset to their default values. Use Client.AlterConfigs with Merge,
+// or Client.IncrementalAlterConfigs, to preserve them.
+func (c *Conn) AlterConfigs(topic string, configs ...ConfigEntry) error {
+	entries := make([]alterConfigsRequestConfigV0, len(configs))
+	for i, config := range configs {
+		entries[i] = alterConfigsRequestConfigV0{
+			ConfigName:  config.ConfigName,
+			ConfigValue: config.ConfigValue,
+		}
+	}
+
+	var res alterConfigsResponseV0
+
+	err := c.writeOperation(
+		func(deadline time.Time, id int32) error {
+			return c.writeRequest(alterConfigs, v0, id, alterConfigsRequestV0{
+				Resources: []alterConfigsRequestResourceV0{{
+					ResourceType:  int8(ResourceTypeTopic),
+					ResourceName:  topic,
+					ConfigEntries: entries,
+				}},
+			})
+		},
+		func(deadline time.Time, size int) error {
+			return c.readResponse(size, &res)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range res.Resources {
+		if r.ErrorCode != 0 {
+			return Error(r.ErrorCode)
+		}
+	}
+
+	return nil
+}
+
+type alterConfigsRequestV0 struct {
+	Resources    []alterConfigsRequestResourceV0
+	ValidateOnly bool
+}
+
+func (r alterConfigsRequestV0) size() int32 {
+	return sizeofArray(len(r.Resources), func(i int) int32 { return r.Resources[i].size() }) +
+		sizeofBool(r.ValidateOnly)
+}
+
+func (r alterConfigsRequestV0) writeTo(wb *writeBuffer) {
+	wb.writeArray(len(r.Resources), func(i int) { r.Resources[i].writeTo(wb) })
+	wb.writeBool(r.ValidateOnly)
+}
+
+type alterConfigsRequestResourceV0 struct {
+	ResourceType  int8
+	ResourceName  string
+	ConfigEntries []alterConfigsRequestConfigV0
+}
+
+func (r alterConfigsRequestResourceV0) size() int32 {
+	return 1 + sizeofString(r.ResourceName) +
+		sizeofArray(len(r.ConfigEntries), func(i int) int32 { return r.ConfigEntries[i].size() })
+}
+
+func (r alterConfigsRequestResourceV0) writeTo(wb *writeBuffer) {
+	wb.writeInt8(r.ResourceType)
+	wb.writeString(r.ResourceName)
+	wb.writeArray(len(r.ConfigEntries), func(i int) { r.ConfigEntries[i].writeTo(wb) })
+}
+
+type alterConfigsRequestConfigV0 struct {
+	ConfigName  string
+	ConfigValue string
+}
+
+func (c alterConfigsRequestConfigV0) size() int32 {
+	return sizeofString(c.ConfigName) + sizeofString(c.ConfigValue)
+}
+
+func (c alterConfigsRequestConfigV0) writeTo(wb *writeBuffer) {
+	wb.writeString(c.ConfigName)
+	wb.writeString(c.ConfigValue)
+}
+
+type alterConfigsResponseV0 struct {
+	ThrottleTimeMS int32
+	Resources      []alterConfigsResponseResourceV0
+}
+
+func (r alterConfigsResponseV0) size() int32 {
+	return 4 + sizeofArray(len(r.Resources), func(i int) int32 { return r.Resources[i].size() })
+}
+
+func (r alterConfigsResponseV0) writeTo(wb *writeBuffer) {
+	wb.writeInt32(r.ThrottleTimeMS)
+	wb.writeArray(len(r.Resources), func(i int) { r.Resources[i].writeTo(wb) })
+}
+
+type alterConfigsResponseResourceV0 struct {
+	ErrorCode    int16
+	ErrorMessage string
+	ResourceType int8
+	ResourceName string
+}
+
+func (r alterConfigsResponseResourceV0) size() int32 {
+	return 2 + sizeofString(r.ErrorMessage) + 1 + sizeofString(r.ResourceName)
+}
+
+func (r alterConfigsResponseResourceV0) writeTo(wb *writeBuffer) {
+	wb.writeInt16(r.ErrorCode)
+	wb.writeString(r.ErrorMessage)
+	wb.writeInt8(r.ResourceType)
+	wb.writeString(r.ResourceName)
+}
@@ -2,8 +2,14 @@ package kafka
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
 	"testing"
 
+	"github.com/segmentio/kafka-go/protocol/alterconfigs"
+	"github.com/segmentio/kafka-go/protocol/describeconfigs"
 	ktesting "github.com/segmentio/kafka-go/testing"
 	"github.com/stretchr/testify/assert"
 )
@@ -61,3 +67,141 @@ func TestClientAlterConfigs(t *testing.T) {
 	}
 	assert.Equal(t, maxMessageBytesValue, MaxMessageBytesValue)
 }
+
+func TestClientAlterConfigsMerge(t *testing.T) {
+	transport := &alterConfigsTestTransport{
+		entries: []describeconfigs.ResponseConfigEntry{
+			{ConfigName: "retention.ms", ConfigValue: "3600000", ConfigSource: int8(ConfigSourceDynamicTopic)},
+			{ConfigName: "cleanup.policy", ConfigValue: "compact", ConfigSource: int8(ConfigSourceDynamicTopic)},
+			{ConfigName: "segment.bytes", ConfigValue: "1073741824", ConfigSource: int8(ConfigSourceDefault)},
+			{ConfigName: "min.insync.replicas", ConfigValue: "2", ConfigSource: int8(ConfigSourceStaticBroker)},
+		},
+	}
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: transport,
+	}
+
+	_, err := client.AlterConfigs(context.Background(), &AlterConfigsRequest{
+		Merge: true,
+		Resources: []AlterConfigRequestResource{{
+			ResourceType: ResourceTypeTopic,
+			ResourceName: "topic-A",
+			Configs: []AlterConfigRequestConfig{
+				{Name: "retention.ms", Value: "7200000"},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the keys that were set on the topic are preserved, the requested
+	// value takes precedence.
+	want := []alterconfigs.RequestConfig{
+		{Name: "cleanup.policy", Value: "compact"},
+		{Name: "retention.ms", Value: "7200000"},
+	}
+	if !reflect.DeepEqual(transport.altered, want) {
+		t.Errorf("unexpected configs altered:\nwant: %+v\ngot:  %+v", want, transport.altered)
+	}
+
+	transport.entries = append(transport.entries, describeconfigs.ResponseConfigEntry{
+		ConfigName:   "sasl.jaas.config",
+		IsSensitive:  true,
+		ConfigSource: int8(ConfigSourceDynamicTopic),
+	})
+	transport.altered = nil
+
+	_, err = client.AlterConfigs(context.Background(), &AlterConfigsRequest{
+		Merge: true,
+		Resources: []AlterConfigRequestResource{{
+			ResourceType: ResourceTypeTopic,
+			ResourceName: "topic-A",
+			Configs: []AlterConfigRequestConfig{
+				{Name: "retention.ms", Value: "7200000"},
+			},
+		}},
+	})
+	if err == nil {
+		t.Error("expected an error when a sensitive config cannot be preserved")
+	}
+	if transport.altered != nil {
+		t.Errorf("configs were altered despite the error: %+v", transport.altered)
+	}
+}
+
+func TestClientAlterConfigsMergeDefaultBroker(t *testing.T) {
+	transport := &alterConfigsTestTransport{
+		entries: []describeconfigs.ResponseConfigEntry{
+			{ConfigName: "log.retention.ms", ConfigValue: "3600000", ConfigSource: int8(ConfigSourceDynamicDefaultBroker)},
+			{ConfigName: "log.cleaner.threads", ConfigValue: "2", ConfigSource: int8(ConfigSourceDynamicBroker)},
+			{ConfigName: "num.io.threads", ConfigValue: "8", ConfigSource: int8(ConfigSourceStaticBroker)},
+			{ConfigName: "log.segment.bytes", ConfigValue: "1073741824", ConfigSource: int8(ConfigSourceDefault)},
+		},
+	}
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: transport,
+	}
+
+	_, err := client.AlterConfigs(context.Background(), &AlterConfigsRequest{
+		Merge: true,
+		Resources: []AlterConfigRequestResource{{
+			ResourceType: ResourceTypeBroker,
+			Configs: []AlterConfigRequestConfig{
+				{Name: "log.flush.interval.ms", Value: "1000"},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the dynamic defaults of the cluster are preserved, the static
+	// configs of the broker and the configs of a specific broker are not.
+	want := []alterconfigs.RequestConfig{
+		{Name: "log.flush.interval.ms", Value: "1000"},
+		{Name: "log.retention.ms", Value: "3600000"},
+	}
+	if !reflect.DeepEqual(transport.altered, want) {
+		t.Errorf("unexpected configs altered:\nwant: %+v\ngot:  %+v", want, transport.altered)
+	}
+}
+
+type alterConfigsTestTransport struct {
+	entries []describeconfigs.ResponseConfigEntry
+	altered []alterconfigs.RequestConfig
+}
+
+func (t *alterConfigsTestTransport) RoundTrip(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+	switch r := req.(type) {
+	case *describeconfigs.Request:
+		res := &describeconfigs.Response{}
+		for _, resource := range r.Resources {
+			res.Resources = append(res.Resources, describeconfigs.ResponseResource{
+				ResourceType:  resource.ResourceType,
+				ResourceName:  resource.ResourceName,
+				ConfigEntries: t.entries,
+			})
+		}
+		return res, nil
+
+	case *alterconfigs.Request:
+		res := &alterconfigs.Response{}
+		for _, resource := range r.Resources {
+			t.altered = append(t.altered, resource.Configs...)
+			res.Responses = append(res.Responses, alterconfigs.ResponseResponses{
+				ResourceType: resource.ResourceType,
+				ResourceName: resource.ResourceName,
+			})
+		}
+		sort.Slice(t.altered, func(i, j int) bool { return t.altered[i].Name < t.altered[j].Name })
+		return res, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported request: %T", req)
+	}
+}
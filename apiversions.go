@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 	"net"
 
 	"github.com/segmentio/kafka-go/protocol"
@@ -70,3 +71,69 @@ func (c *Client) ApiVersions(
 
 	return resp, err
 }
+
+// FeatureLevels describes the versions of a feature of the kafka cluster, for
+// example the "metadata.version" of KRaft clusters.
+type FeatureLevels struct {
+	// Range of versions of the feature supported by the broker.
+	MinVersion int
+	MaxVersion int
+
+	// Version level of the feature finalized in the cluster, which all brokers
+	// have agreed to use. Zero if the feature is not finalized.
+	FinalizedLevel int
+}
+
+// Features returns the features supported by the broker at the address of the
+// client and their finalized version levels in the cluster, indexed by name.
+//
+// The features are only reported by brokers supporting version 3 of the
+// ApiVersions API, the method returns an empty map with older brokers.
+func (c *Client) Features(ctx context.Context) (map[string]FeatureLevels, error) {
+	m, err := c.roundTrip(ctx, nil, &apiversions.Request{})
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).Features: %w", err)
+	}
+
+	res := m.(*apiversions.Response)
+	if err := makeError(res.ErrorCode, ""); err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).Features: %w", err)
+	}
+
+	features := make(map[string]FeatureLevels, len(res.SupportedFeatures))
+
+	for _, f := range res.SupportedFeatures {
+		levels := features[f.Name]
+		levels.MinVersion = int(f.MinVersion)
+		levels.MaxVersion = int(f.MaxVersion)
+		features[f.Name] = levels
+	}
+
+	for _, f := range res.FinalizedFeatures {
+		levels := features[f.Name]
+		levels.FinalizedLevel = int(f.MaxVersionLevel)
+		features[f.Name] = levels
+	}
+
+	return features, nil
+}
+
+// supportsApiVersion returns true if the kafka broker at addr supports the
+// given version of an API.
+func (c *Client) supportsApiVersion(ctx context.Context, addr net.Addr, apiKey protocol.ApiKey, version int) (bool, error) {
+	res, err := c.ApiVersions(ctx, &ApiVersionsRequest{Addr: addr})
+	if err != nil {
+		return false, err
+	}
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	for _, k := range res.ApiKeys {
+		if k.ApiKey == int(apiKey) {
+			return k.MinVersion <= version && version <= k.MaxVersion, nil
+		}
+	}
+
+	return false, nil
+}
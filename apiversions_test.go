@@ -2,7 +2,12 @@ package kafka
 
 import (
 	"context"
+	"net"
+	"reflect"
 	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
 func TestClientApiVersions(t *testing.T) {
@@ -31,3 +36,52 @@ func TestClientApiVersions(t *testing.T) {
 		)
 	}
 }
+
+func TestClientFeatures(t *testing.T) {
+	client := &Client{
+		Addr: TCP("localhost:9092"),
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			return &apiversions.Response{
+				SupportedFeatures: []apiversions.SupportedFeature{
+					{Name: "metadata.version", MinVersion: 1, MaxVersion: 19},
+					{Name: "kraft.version", MinVersion: 0, MaxVersion: 1},
+				},
+				FinalizedFeaturesEpoch: 10,
+				FinalizedFeatures: []apiversions.FinalizedFeature{
+					{Name: "metadata.version", MinVersionLevel: 14, MaxVersionLevel: 14},
+				},
+			}, nil
+		}),
+	}
+
+	features, err := client.Features(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]FeatureLevels{
+		"metadata.version": {MinVersion: 1, MaxVersion: 19, FinalizedLevel: 14},
+		"kraft.version":    {MinVersion: 0, MaxVersion: 1},
+	}
+	if !reflect.DeepEqual(features, want) {
+		t.Errorf("unexpected features:\nwant: %+v\ngot:  %+v", want, features)
+	}
+}
+
+func TestClientFeaturesWithoutFeatures(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: &Transport{Dial: broker.Dial},
+	}
+
+	features, err := client.Features(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 0 {
+		t.Errorf("unexpected features: %+v", features)
+	}
+}
@@ -35,6 +35,83 @@ func (f BalancerFunc) Balance(msg Message, partitions ...int) int {
 	return f(msg, partitions...)
 }
 
+// ErrorBalancer is implemented by balancers which may fail to route a message,
+// for example because the key that the partition is derived from cannot be
+// parsed.
+//
+// Writers call BalanceErr instead of Balance when their balancer implements
+// this interface, and return the error to the program instead of writing the
+// message. The ErrorBalancerFunc type adapts functions to the interface.
+type ErrorBalancer interface {
+	Balancer
+
+	// BalanceErr receives a message and a set of available partitions and
+	// returns the partition number that the message should be routed to, or
+	// an error if the message cannot be routed.
+	BalanceErr(msg Message, partitions ...int) (partition int, err error)
+}
+
+// ErrorBalancerFunc is an implementation of the ErrorBalancer interface that
+// makes it possible to use regular functions which may fail to distribute
+// messages across partitions.
+type ErrorBalancerFunc func(Message, ...int) (int, error)
+
+// Balance satisfies the Balancer interface, it returns -1 when f returns an
+// error, which is not a valid partition.
+func (f ErrorBalancerFunc) Balance(msg Message, partitions ...int) int {
+	partition, err := f(msg, partitions...)
+	if err != nil {
+		return -1
+	}
+	return partition
+}
+
+// BalanceErr calls f, satisfies the ErrorBalancer interface.
+func (f ErrorBalancerFunc) BalanceErr(msg Message, partitions ...int) (int, error) {
+	return f(msg, partitions...)
+}
+
+// MetadataAwareBalancer is implemented by balancers which need the metadata of
+// the partitions to route messages, for example to avoid the partitions that
+// have no leader, or whose leader is on a degraded broker or in another rack.
+//
+// Writers call BalancePartitions instead of Balance when their balancer
+// implements this interface. The MetadataBalancerFunc type adapts functions to
+// the interface.
+type MetadataAwareBalancer interface {
+	Balancer
+
+	// BalancePartitions receives a message and the metadata of the partitions
+	// available, and returns the ID of the partition that the message should
+	// be routed to.
+	//
+	// The metadata comes from the cached cluster layout of the writer, it
+	// carries the leader of each partition, its replicas, and the errors
+	// reported by kafka for partitions which are offline or have no leader.
+	// The slice must not be retained after the method returned.
+	BalancePartitions(msg Message, partitions ...Partition) (partition int)
+}
+
+// MetadataBalancerFunc is an implementation of the MetadataAwareBalancer
+// interface that makes it possible to use regular functions to distribute
+// messages across partitions based on their metadata.
+type MetadataBalancerFunc func(Message, ...Partition) int
+
+// Balance satisfies the Balancer interface, the function receives partitions
+// which only have their ID set.
+func (f MetadataBalancerFunc) Balance(msg Message, partitions ...int) int {
+	metadata := make([]Partition, len(partitions))
+	for i, p := range partitions {
+		metadata[i] = Partition{ID: p, Leader: Broker{ID: -1}}
+	}
+	return f(msg, metadata...)
+}
+
+// BalancePartitions calls f, satisfies the MetadataAwareBalancer interface.
+func (f MetadataBalancerFunc) BalancePartitions(msg Message, partitions ...Partition) int {
+	return f(msg, partitions...)
+}
+
 // RoundRobin is an Balancer implementation that equally distributes messages
 // across all available partitions.
 type RoundRobin struct {
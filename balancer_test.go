@@ -352,3 +352,51 @@ func TestLeastBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataBalancerFunc(t *testing.T) {
+	var seen []Partition
+
+	balancer := MetadataBalancerFunc(func(msg Message, partitions ...Partition) int {
+		seen = partitions
+		return partitions[len(partitions)-1].ID
+	})
+
+	if partition := balancer.Balance(Message{}, 4, 5, 6); partition != 6 {
+		t.Errorf("expected partition 6 but got %d", partition)
+	}
+	for i, p := range seen {
+		if p.ID != 4+i || p.Leader.ID != -1 {
+			t.Errorf("partition #%d: expected partition %d without a leader but got %+v", i, 4+i, p)
+		}
+	}
+
+	partitions := []Partition{{ID: 1, Leader: Broker{ID: 2, Rack: "rack-a"}}}
+	if partition := balancer.BalancePartitions(Message{}, partitions...); partition != 1 {
+		t.Errorf("expected partition 1 but got %d", partition)
+	}
+}
+
+func TestErrorBalancerFunc(t *testing.T) {
+	errNoKey := fmt.Errorf("message has no key")
+
+	balancer := ErrorBalancerFunc(func(msg Message, partitions ...int) (int, error) {
+		if msg.Key == nil {
+			return 0, errNoKey
+		}
+		return partitions[len(msg.Key)%len(partitions)], nil
+	})
+
+	if partition, err := balancer.BalanceErr(Message{Key: []byte("A")}, 4, 5, 6); err != nil || partition != 5 {
+		t.Errorf("expected partition 5 but got %d (error: %v)", partition, err)
+	}
+	if _, err := balancer.BalanceErr(Message{}, 4, 5, 6); err != errNoKey {
+		t.Errorf("expected %v but got %v", errNoKey, err)
+	}
+
+	if partition := balancer.Balance(Message{Key: []byte("A")}, 4, 5, 6); partition != 5 {
+		t.Errorf("expected partition 5 but got %d", partition)
+	}
+	if partition := balancer.Balance(Message{}, 4, 5, 6); partition != -1 {
+		t.Errorf("expected partition -1 when the balancer fails but got %d", partition)
+	}
+}
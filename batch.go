@@ -38,6 +38,14 @@ type Batch struct {
 	// we get an EOF we do not get the lastOffset. So there is a mismatch
 	// between when we receive it and need to use it.
 	lastOffset int64
+	// Set when the response was truncated by the kafka server in the middle
+	// of a message, see readMessage.
+	truncated bool
+	// The leader epoch of the record batch that the last message was read
+	// from, -1 for message sets which predate leader epochs.
+	leaderEpoch int32
+	// Whether control records are returned, see ReadBatchConfig.
+	controlRecords bool
 }
 
 // Throttle gives the throttling duration applied by the kafka server on the
@@ -56,6 +64,17 @@ func (batch *Batch) Partition() int {
 	return batch.partition
 }
 
+// PartitionLeaderEpoch returns the partition leader epoch stored in the header
+// of the record batch that the last message was read from, or -1 if no message
+// was read yet or the messages were stored in a format which predates leader
+// epochs.
+func (batch *Batch) PartitionLeaderEpoch() int32 {
+	batch.mutex.Lock()
+	leaderEpoch := batch.leaderEpoch
+	batch.mutex.Unlock()
+	return leaderEpoch
+}
+
 // Offset returns the offset of the next message in the batch.
 func (batch *Batch) Offset() int64 {
 	batch.mutex.Lock()
@@ -168,7 +187,9 @@ func (batch *Batch) Read(b []byte) (int, error) {
 		},
 	)
 
-	if err == nil && n > len(b) {
+	if err != nil {
+		n = 0 // the value may have been read from a skipped control record
+	} else if n > len(b) {
 		n, err = len(b), io.ErrShortBuffer
 		batch.err = io.ErrShortBuffer
 		batch.offset = offset // rollback
@@ -193,11 +214,11 @@ func (batch *Batch) ReadMessage() (Message, error) {
 
 	offset, timestamp, headers, err = batch.readMessage(
 		func(r *bufio.Reader, size int, nbytes int) (remain int, err error) {
-			msg.Key, remain, err = readNewBytes(r, size, nbytes)
+			msg.Key, remain, err = readNewNullableBytes(r, size, nbytes)
 			return
 		},
 		func(r *bufio.Reader, size int, nbytes int) (remain int, err error) {
-			msg.Value, remain, err = readNewBytes(r, size, nbytes)
+			msg.Value, remain, err = readNewNullableBytes(r, size, nbytes)
 			return
 		},
 	)
@@ -209,16 +230,20 @@ func (batch *Batch) ReadMessage() (Message, error) {
 		}
 		offset, timestamp, headers, err = batch.readMessage(
 			func(r *bufio.Reader, size int, nbytes int) (remain int, err error) {
-				msg.Key, remain, err = readNewBytes(r, size, nbytes)
+				msg.Key, remain, err = readNewNullableBytes(r, size, nbytes)
 				return
 			},
 			func(r *bufio.Reader, size int, nbytes int) (remain int, err error) {
-				msg.Value, remain, err = readNewBytes(r, size, nbytes)
+				msg.Value, remain, err = readNewNullableBytes(r, size, nbytes)
 				return
 			},
 		)
 	}
 
+	if err == nil && batch.msgs.control() {
+		msg.Control = batch.msgs.controlRecord(msg.Key, msg.Value)
+	}
+
 	batch.mutex.Unlock()
 	msg.Topic = batch.topic
 	msg.Partition = batch.partition
@@ -230,6 +255,57 @@ func (batch *Batch) ReadMessage() (Message, error) {
 	return msg, err
 }
 
+// readRaw reads the next message from the batch into rb. The key and value of
+// the message are appended to the buffer of rb, the record references them
+// once rb is complete.
+func (batch *Batch) readRaw(rb *RawBatch) error {
+	batch.mutex.Lock()
+	defer batch.mutex.Unlock()
+
+	for {
+		start := len(rb.buffer)
+		span := rawRecordSpan{keyStart: -1, valueStart: -1}
+
+		offset, timestamp, headers, err := batch.readMessage(
+			func(r *bufio.Reader, size int, nbytes int) (remain int, err error) {
+				if nbytes >= 0 {
+					span.keyStart = len(rb.buffer)
+				}
+				rb.buffer, remain, err = appendBytes(r, rb.buffer, size, nbytes)
+				span.keyEnd = len(rb.buffer)
+				return
+			},
+			func(r *bufio.Reader, size int, nbytes int) (remain int, err error) {
+				if nbytes >= 0 {
+					span.valueStart = len(rb.buffer)
+				}
+				rb.buffer, remain, err = appendBytes(r, rb.buffer, size, nbytes)
+				span.valueEnd = len(rb.buffer)
+				return
+			},
+		)
+		if err != nil {
+			rb.buffer = rb.buffer[:start]
+			return err
+		}
+
+		// A batch may start before the requested offset so skip messages
+		// until the requested offset is reached.
+		if batch.conn != nil && offset < batch.conn.offset {
+			rb.buffer = rb.buffer[:start]
+			continue
+		}
+
+		rb.Records = append(rb.Records, RawRecord{
+			Offset:  offset,
+			Time:    makeTime(timestamp),
+			Headers: headers,
+		})
+		rb.spans = append(rb.spans, span)
+		return nil
+	}
+}
+
 func (batch *Batch) readMessage(
 	key func(*bufio.Reader, int, int) (int, error),
 	val func(*bufio.Reader, int, int) (int, error),
@@ -239,15 +315,26 @@ func (batch *Batch) readMessage(
 	}
 
 	var lastOffset int64
-	offset, lastOffset, timestamp, headers, err = batch.msgs.readMessage(batch.offset, key, val)
+	for {
+		offset, lastOffset, timestamp, headers, err = batch.msgs.readMessage(batch.offset, key, val)
+		if err != nil || batch.controlRecords || !batch.msgs.control() {
+			break
+		}
+		// Control records mark the end of transactions, they are skipped
+		// unless the program asked to see them.
+		batch.offset = offset + 1
+		batch.lastOffset = lastOffset
+	}
 	switch {
 	case err == nil:
 		batch.offset = offset + 1
 		batch.lastOffset = lastOffset
+		batch.leaderEpoch = batch.msgs.leaderEpoch()
 	case errors.Is(err, errShortRead):
 		// As an "optimization" kafka truncates the returned response after
 		// producing MaxBytes, which could then cause the code to return
 		// errShortRead.
+		batch.truncated = true
 		err = batch.msgs.discard()
 		switch {
 		case err != nil:
@@ -286,6 +373,13 @@ func (batch *Batch) readMessage(
 			}
 		}
 	default:
+		// The message set reader does not know which partition the messages
+		// belong to, fill it on codec errors to help diagnose them.
+		var codecErr UnsupportedCodecError
+		if errors.As(err, &codecErr) {
+			codecErr.Topic, codecErr.Partition = batch.topic, batch.partition
+			err = codecErr
+		}
 		// Since io.EOF is used by the batch to indicate that there is are
 		// no more messages to consume, it is crucial that any io.EOF errors
 		// on the underlying connection are repackaged.  Otherwise, the
@@ -1,12 +1,18 @@
 package kafka
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"io"
 	"net"
+	"reflect"
 	"strconv"
 	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
 )
 
 func TestBatchDontExpectEOF(t *testing.T) {
@@ -39,3 +45,235 @@ func TestBatchDontExpectEOF(t *testing.T) {
 		t.Error("bad error when closing the batch:", err)
 	}
 }
+
+// BenchmarkBatchRead measures the allocations of decoding the messages of a
+// fetch response one at a time, compared to reading them into a RawBatch.
+func BenchmarkBatchRead(b *testing.B) {
+	msgs := make([]Message, 1000)
+	for i := range msgs {
+		msgs[i] = Message{
+			Offset: int64(i),
+			Key:    []byte(strconv.Itoa(i)),
+			Value:  make([]byte, 256),
+			Time:   time.Now(),
+		}
+	}
+
+	builder := fetchResponseBuilder{
+		header: fetchResponseHeader{
+			highWatermarkOffset: int64(len(msgs)),
+			lastStableOffset:    int64(len(msgs)),
+			topic:               "topic-A",
+		},
+		msgSets: []messageSetBuilder{
+			v2MessageSetBuilder{msgs: msgs},
+		},
+	}
+	bs := builder.bytes()
+
+	newBatch := func(b *testing.B) *Batch {
+		r := bufio.NewReaderSize(bytes.NewReader(bs), 64*1024)
+		_, _, remain, err := readFetchResponseHeaderV10(r, len(bs))
+		if err != nil {
+			b.Fatal(err)
+		}
+		msgSet, err := newMessageSetReader(r, remain)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return &Batch{topic: "topic-A", msgs: msgSet}
+	}
+
+	b.Run("ReadMessage", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(bs)))
+
+		for i := 0; i < b.N; i++ {
+			batch := newBatch(b)
+			for {
+				if _, err := batch.ReadMessage(); err != nil {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("RawBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(bs)))
+		pool := newRawBatchPool(1)
+
+		for i := 0; i < b.N; i++ {
+			batch := newBatch(b)
+			rb := <-pool
+			for batch.readRaw(rb) == nil {
+			}
+			rb.complete(batch.topic, batch.partition, batch.highWaterMark)
+			if len(rb.Records) != len(msgs) {
+				b.Fatalf("expected %d records but got %d", len(msgs), len(rb.Records))
+			}
+			rb.release()
+		}
+	})
+}
+
+// rawMessageSet is a messageSetBuilder of message sets which were encoded
+// beforehand.
+type rawMessageSet []byte
+
+func (s rawMessageSet) bytes() []byte { return s }
+
+func (s rawMessageSet) messages() []Message { return nil }
+
+func TestBatchControlRecords(t *testing.T) {
+	now := time.Now()
+
+	// A commit marker written by coordinator epoch 5: the key holds the
+	// version and type of the marker, the value its version and the epoch.
+	marker := &protocol.RecordBatchBuilder{Attributes: protocol.Transactional | protocol.Control}
+	marker.Add(protocol.Record{
+		Offset: 1,
+		Time:   now,
+		Key:    protocol.NewBytes([]byte{0, 0, 0, 1}),
+		Value:  protocol.NewBytes([]byte{0, 0, 0, 0, 0, 5}),
+	})
+	markerBytes, err := marker.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := fetchResponseBuilder{
+		header: fetchResponseHeader{
+			highWatermarkOffset: 3,
+			lastStableOffset:    3,
+			topic:               "topic-A",
+		},
+		msgSets: []messageSetBuilder{
+			v2MessageSetBuilder{msgs: []Message{{Offset: 0, Value: []byte("0"), Time: now}}},
+			rawMessageSet(markerBytes),
+			v2MessageSetBuilder{msgs: []Message{{Offset: 2, Value: []byte("2"), Time: now}}},
+		},
+	}
+	bs := builder.bytes()
+
+	for _, controlRecords := range []bool{false, true} {
+		r := bufio.NewReader(bytes.NewReader(bs))
+		_, _, remain, err := readFetchResponseHeaderV10(r, len(bs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgSet, err := newMessageSetReader(r, remain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch := &Batch{topic: "topic-A", msgs: msgSet, controlRecords: controlRecords}
+
+		var msgs []Message
+		for {
+			m, err := batch.ReadMessage()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Fatal(err)
+				}
+				break
+			}
+			msgs = append(msgs, m)
+		}
+
+		offsets := []int64{}
+		for _, m := range msgs {
+			offsets = append(offsets, m.Offset)
+			if (m.Control != nil) != (m.Offset == 1) {
+				t.Errorf("controlRecords=%t: unexpected control record at offset %d: %+v", controlRecords, m.Offset, m.Control)
+			}
+		}
+
+		if !controlRecords {
+			if !reflect.DeepEqual(offsets, []int64{0, 2}) {
+				t.Errorf("expected the control record to be skipped, got offsets %v", offsets)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(offsets, []int64{0, 1, 2}) {
+			t.Fatalf("expected the control record to be returned, got offsets %v", offsets)
+		}
+		want := ControlRecord{Type: ControlRecordCommit, ProducerID: -1, ProducerEpoch: -1, CoordinatorEpoch: 5}
+		if c := msgs[1].Control; *c != want {
+			t.Errorf("expected control record %+v but got %+v", want, *c)
+		}
+	}
+}
+
+func TestBatchPartitionLeaderEpoch(t *testing.T) {
+	now := time.Now()
+
+	build := func(epoch int32, offset int64, value string) []byte {
+		t.Helper()
+		b := &protocol.RecordBatchBuilder{}
+		b.SetPartitionLeaderEpoch(epoch)
+		b.Add(protocol.Record{Offset: offset, Time: now, Value: protocol.NewBytes([]byte(value))})
+		bs, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bs
+	}
+
+	newBatch := func(msgSets ...messageSetBuilder) *Batch {
+		t.Helper()
+		builder := fetchResponseBuilder{
+			header: fetchResponseHeader{
+				highWatermarkOffset: int64(len(msgSets)),
+				lastStableOffset:    int64(len(msgSets)),
+				topic:               "topic-A",
+			},
+			msgSets: msgSets,
+		}
+		bs := builder.bytes()
+		r := bufio.NewReader(bytes.NewReader(bs))
+		_, _, remain, err := readFetchResponseHeaderV10(r, len(bs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgSet, err := newMessageSetReader(r, remain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Batch{topic: "topic-A", msgs: msgSet, leaderEpoch: -1}
+	}
+
+	readEpochs := func(batch *Batch) []int32 {
+		t.Helper()
+		epochs := []int32{batch.PartitionLeaderEpoch()}
+		for {
+			if _, err := batch.ReadMessage(); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Fatal(err)
+				}
+				return epochs
+			}
+			epochs = append(epochs, batch.PartitionLeaderEpoch())
+		}
+	}
+
+	batch := newBatch(
+		rawMessageSet(build(3, 0, "0")),
+		rawMessageSet(build(5, 1, "1")),
+		v1MessageSetBuilder{msgs: []Message{{Offset: 2, Value: []byte("2"), Time: now}}},
+	)
+	if epochs := readEpochs(batch); !reflect.DeepEqual(epochs, []int32{-1, 3, 5, -1}) {
+		t.Errorf("unexpected partition leader epochs: %v", epochs)
+	}
+
+	// Re-producing a message with the epoch of its batch preserves it.
+	batch = newBatch(rawMessageSet(build(7, 0, "0")))
+	msg, err := batch.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrored := build(batch.PartitionLeaderEpoch(), msg.Offset, string(msg.Value))
+	if epochs := readEpochs(newBatch(rawMessageSet(mirrored))); !reflect.DeepEqual(epochs, []int32{-1, 7}) {
+		t.Errorf("unexpected partition leader epochs of the mirrored batch: %v", epochs)
+	}
+}
@@ -14,6 +14,7 @@ const (
 	defaultCreateTopicsTimeout     = 2 * time.Second
 	defaultDeleteTopicsTimeout     = 2 * time.Second
 	defaultCreatePartitionsTimeout = 2 * time.Second
+	defaultUpdateFeaturesTimeout   = 2 * time.Second
 	defaultProduceTimeout          = 500 * time.Millisecond
 	defaultMaxWait                 = 500 * time.Millisecond
 )
@@ -38,6 +39,17 @@ type Client struct {
 	// If zero, no timeout is applied.
 	Timeout time.Duration
 
+	// Time limits for requests of specific APIs, overriding Timeout. For
+	// example, a program may set a long timeout for Fetch requests, which wait
+	// for new records to be produced, and a short timeout for DeleteTopics.
+	//
+	// The timeouts of Produce, Fetch, CreateTopics, CreatePartitions, and
+	// DeleteTopics requests are also communicated to the brokers, like Timeout.
+	//
+	// APIs missing from the map, or associated with a zero duration, use
+	// Timeout.
+	RequestTimeouts map[protocol.ApiKey]time.Duration
+
 	// A transport used to communicate with the kafka brokers.
 	//
 	// If nil, DefaultTransport is used.
@@ -100,9 +112,9 @@ func (c *Client) ConsumerOffsets(ctx context.Context, tg TopicAndGroup) (map[int
 }
 
 func (c *Client) roundTrip(ctx context.Context, addr net.Addr, msg protocol.Message) (protocol.Message, error) {
-	if c.Timeout > 0 {
+	if timeout := c.requestTimeout(msg.ApiKey()); timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
 
@@ -122,8 +134,16 @@ func (c *Client) transport() RoundTripper {
 	return DefaultTransport
 }
 
-func (c *Client) timeout(ctx context.Context, defaultTimeout time.Duration) time.Duration {
-	timeout := c.Timeout
+// requestTimeout returns the time limit of requests to the given API.
+func (c *Client) requestTimeout(apiKey protocol.ApiKey) time.Duration {
+	if timeout := c.RequestTimeouts[apiKey]; timeout > 0 {
+		return timeout
+	}
+	return c.Timeout
+}
+
+func (c *Client) timeout(ctx context.Context, apiKey protocol.ApiKey, defaultTimeout time.Duration) time.Duration {
+	timeout := c.requestTimeout(apiKey)
 
 	if deadline, ok := ctx.Deadline(); ok {
 		if remain := time.Until(deadline); remain < timeout {
@@ -141,6 +161,6 @@ func (c *Client) timeout(ctx context.Context, defaultTimeout time.Duration) time
 	return defaultTimeout
 }
 
-func (c *Client) timeoutMs(ctx context.Context, defaultTimeout time.Duration) int32 {
-	return milliseconds(c.timeout(ctx, defaultTimeout))
+func (c *Client) timeoutMs(ctx context.Context, apiKey protocol.ApiKey, defaultTimeout time.Duration) int32 {
+	return milliseconds(c.timeout(ctx, apiKey, defaultTimeout))
 }
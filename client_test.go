@@ -3,6 +3,7 @@ package kafka
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"math/rand"
 	"net"
@@ -10,6 +11,9 @@ import (
 	"time"
 
 	"github.com/segmentio/kafka-go/compress"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/deletetopics"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
 	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
@@ -301,3 +305,64 @@ func TestClientProduceAndConsume(t *testing.T) {
 
 	t.Logf("%d records were read in %d fetches", numRecords, numFetches)
 }
+
+// timeoutTestTransport records the deadlines of the requests it receives and
+// responds with empty responses.
+type timeoutTestTransport struct {
+	deadlines map[protocol.ApiKey]time.Duration
+	requests  map[protocol.ApiKey]Request
+}
+
+func (t *timeoutTestTransport) RoundTrip(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		t.deadlines[req.ApiKey()] = time.Until(deadline)
+	}
+	t.requests[req.ApiKey()] = req
+
+	switch req.(type) {
+	case *metadataAPI.Request:
+		return &metadataAPI.Response{}, nil
+	case *deletetopics.Request:
+		return &deletetopics.Response{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported request: %T", req)
+	}
+}
+
+func TestClientRequestTimeouts(t *testing.T) {
+	transport := &timeoutTestTransport{
+		deadlines: make(map[protocol.ApiKey]time.Duration),
+		requests:  make(map[protocol.ApiKey]Request),
+	}
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Timeout:   time.Minute,
+		Transport: transport,
+		RequestTimeouts: map[protocol.ApiKey]time.Duration{
+			protocol.DeleteTopics: time.Second,
+		},
+	}
+
+	ctx := context.Background()
+	if _, err := client.Metadata(ctx, &MetadataRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeleteTopics(ctx, &DeleteTopicsRequest{Topics: []string{"topic-A"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := transport.deadlines[protocol.Metadata]; d <= time.Second || d > time.Minute {
+		t.Errorf("expected the metadata request to use the client timeout, got %s", d)
+	}
+	if d := transport.deadlines[protocol.DeleteTopics]; d <= 0 || d > time.Second {
+		t.Errorf("expected the delete topics request to use its own timeout, got %s", d)
+	}
+
+	// The timeout communicated to the broker is derived from the request
+	// timeout.
+	req := transport.requests[protocol.DeleteTopics].(*deletetopics.Request)
+	if req.TimeoutMs <= 0 || req.TimeoutMs > 1000 {
+		t.Errorf("unexpected timeout sent to the broker: %dms", req.TimeoutMs)
+	}
+}
@@ -36,4 +36,27 @@ func makeCommits(msgs ...Message) []commit {
 type commitRequest struct {
 	commits []commit
 	errch   chan<- error
+	// When not nil, the offsets committed for the partitions of the request
+	// are written to this map before the result is sent to errch.
+	committed offsetStash
+}
+
+// complete reports the result of committing offsets to the sender of the
+// request.
+func (req commitRequest) complete(offsets offsetStash, err error) {
+	if err == nil && req.committed != nil {
+		for _, c := range req.commits {
+			offset, ok := offsets[c.topic][c.partition]
+			if !ok {
+				continue
+			}
+			partitions := req.committed[c.topic]
+			if partitions == nil {
+				partitions = map[int]int64{}
+				req.committed[c.topic] = partitions
+			}
+			partitions[c.partition] = offset
+		}
+	}
+	req.errch <- err
 }
@@ -0,0 +1,124 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReadCompacted reads all partitions of a compacted topic up to their high
+// water marks, and returns the latest value of each key.
+//
+// Records are applied in offset order within each partition, a record with a
+// nil value is a tombstone which removes its key from the returned map, while
+// a record with an empty value sets the key to an empty value. Records with a
+// nil key are ignored since they cannot be compacted.
+//
+// The high water marks are captured when the method is called, records written
+// to the topic afterwards are not returned. The method returns once all the
+// partitions have been read up to these offsets.
+func (c *Client) ReadCompacted(ctx context.Context, topic string) (map[string][]byte, error) {
+	metadata, err := c.Metadata(ctx, &MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).ReadCompacted: %w", err)
+	}
+	if len(metadata.Topics) == 0 {
+		return nil, fmt.Errorf("kafka.(*Client).ReadCompacted: %w", UnknownTopicOrPartition)
+	}
+	if err := metadata.Topics[0].Error; err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).ReadCompacted: %w", err)
+	}
+
+	partitions := metadata.Topics[0].Partitions
+	offsetRequests := make([]OffsetRequest, 0, 2*len(partitions))
+	for _, p := range partitions {
+		offsetRequests = append(offsetRequests, FirstOffsetOf(p.ID), LastOffsetOf(p.ID))
+	}
+
+	offsets, err := c.ListOffsets(ctx, &ListOffsetsRequest{
+		Topics: map[string][]OffsetRequest{topic: offsetRequests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).ReadCompacted: %w", err)
+	}
+
+	table := make(map[string][]byte)
+
+	for _, p := range offsets.Topics[topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("kafka.(*Client).ReadCompacted: partition %d: %w", p.Partition, p.Error)
+		}
+		if err := c.readCompactedPartition(ctx, topic, p.Partition, p.FirstOffset, p.LastOffset, table); err != nil {
+			return nil, fmt.Errorf("kafka.(*Client).ReadCompacted: partition %d: %w", p.Partition, err)
+		}
+	}
+
+	return table, nil
+}
+
+// readCompactedPartition applies the records of the partition between offset
+// and end to table.
+func (c *Client) readCompactedPartition(ctx context.Context, topic string, partition int, offset, end int64, table map[string][]byte) error {
+	for offset < end {
+		res, err := c.Fetch(ctx, &FetchRequest{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    offset,
+			MaxBytes:  1e6,
+		})
+		if err != nil {
+			return err
+		}
+		if res.Error != nil {
+			return res.Error
+		}
+
+		progress := false
+
+		for {
+			r, err := res.Records.ReadRecord()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return err
+			}
+
+			// Record batches may start before the requested offset, and
+			// the last fetch may return records written after the end
+			// offset.
+			if r.Offset < offset || r.Offset >= end {
+				continue
+			}
+			offset, progress = r.Offset+1, true
+
+			if r.Key == nil {
+				continue
+			}
+
+			key, err := ReadAll(r.Key)
+			if err != nil {
+				return err
+			}
+
+			if r.Value == nil {
+				delete(table, string(key))
+				continue
+			}
+
+			value, err := ReadAll(r.Value)
+			if err != nil {
+				return err
+			}
+			table[string(key)] = value
+		}
+
+		// The remaining offsets up to the end may only hold control records,
+		// or records which were removed by the compaction.
+		if !progress {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	ktesting "github.com/segmentio/kafka-go/testing"
+)
+
+func TestClientReadCompacted(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	transport := &Transport{Dial: broker.Dial}
+
+	w := &Writer{
+		Addr:      TCP("localhost:9092"),
+		Topic:     "topic-A",
+		Balancer:  &Hash{},
+		BatchSize: 1,
+		Transport: transport,
+	}
+	defer w.Close()
+
+	for _, msg := range []Message{
+		{Key: []byte("A"), Value: []byte("1")},
+		{Key: []byte("B"), Value: []byte("1")},
+		{Key: []byte("C"), Value: []byte("1")},
+		{Key: []byte("D"), Value: []byte("1")},
+		{Key: []byte("A"), Value: []byte("2")},
+		{Key: []byte("B"), Value: nil},
+		{Key: []byte("C"), Value: []byte{}},
+		{Key: nil, Value: []byte("ignored")},
+	} {
+		if err := w.WriteMessages(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := &Client{Addr: TCP("localhost:9092"), Transport: transport}
+
+	table, err := client.ReadCompacted(ctx, "topic-A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]byte{
+		"A": []byte("2"),
+		"C": {},
+		"D": []byte("1"),
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("unexpected table:\nwant: %q\ngot:  %q", want, table)
+	}
+
+	if _, err := client.ReadCompacted(ctx, "topic-B"); err == nil {
+		t.Error("expected an error reading a topic which does not exist")
+	}
+}
@@ -54,6 +54,48 @@ func TestCompression(t *testing.T) {
 	}
 }
 
+func TestZstdWindowSize(t *testing.T) {
+	// The second copy of the chunk is further than the default window of the
+	// encoder, it can only be deduplicated with a larger window.
+	prng := rand.New(rand.NewSource(0))
+	chunk := make([]byte, 1<<20)
+	prng.Read(chunk)
+	filler := make([]byte, 9<<20)
+	prng.Read(filler)
+	data := append(append(append([]byte{}, chunk...), filler...), chunk...)
+
+	small, err := compress(new(zstd.Codec), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec := &zstd.Codec{WindowSize: 16 << 20}
+	large, err := compress(codec, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(large) >= len(small)-len(chunk)/2 {
+		t.Errorf("larger window did not improve compression: default=%d large=%d", len(small), len(large))
+	}
+
+	b, err := decompress(codec, large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Error("data mismatch after decompression with a large window")
+	}
+
+	if _, err := decompress(&zstd.Codec{MaxWindowSize: 8 << 20}, large); err == nil {
+		t.Error("expected decompression to fail when the window exceeds the maximum")
+	}
+
+	if _, err := compress(&zstd.Codec{WindowSize: 1000}, data); err == nil {
+		t.Error("expected compression to fail when the window is not a power of two")
+	}
+}
+
 func compress(codec pkg.Codec, src []byte) ([]byte, error) {
 	b := new(bytes.Buffer)
 	r := bytes.NewReader(src)
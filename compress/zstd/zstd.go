@@ -16,7 +16,37 @@ type Codec struct {
 	// Default to 3.
 	Level int
 
+	// The size of the window used by writers created by the codec, which is
+	// the maximum distance at which the encoder looks for matches in the data
+	// it already compressed. The value must be a power of two between 1KB and
+	// 512MB.
+	//
+	// Larger windows improve the compression ratio of batches holding repeated
+	// content far apart, similarly to the long-distance matching mode of the
+	// reference zstd implementation, which the Go encoder does not provide.
+	// The trade off is memory: each writer allocates buffers proportional to
+	// the window size, and so do the readers decompressing the data, which may
+	// be in other programs that need to accept the larger window.
+	//
+	// Default to the window size of the compression level, which is 8MB or
+	// less.
+	WindowSize int
+
+	// The maximum window size accepted by readers created by the codec, frames
+	// declaring a larger window are rejected instead of being decompressed.
+	// Producers using long-distance matching, like the Java client when
+	// configured with a large window log, may require raising this limit.
+	//
+	// The readers only allocate memory for the window of the frames that they
+	// decompress, the limit protects the program from frames requiring more
+	// memory than it is willing to use. When WindowSize is larger, it is used
+	// as the limit so the codec can always read the data that it writes.
+	//
+	// Default to the limit of the zstd package, which is 512MB.
+	MaxWindowSize int
+
 	encoderPool sync.Pool // *encoder
+	decoderPool sync.Pool // *zstd.Decoder
 }
 
 // Code implements the compress.Codec interface.
@@ -28,21 +58,46 @@ func (c *Codec) Name() string { return "zstd" }
 // NewReader implements the compress.Codec interface.
 func (c *Codec) NewReader(r io.Reader) io.ReadCloser {
 	p := new(reader)
-	if p.dec, _ = decoderPool.Get().(*zstd.Decoder); p.dec != nil {
+	if p.dec, _ = c.decoderPool.Get().(*zstd.Decoder); p.dec != nil {
 		p.dec.Reset(r)
 	} else {
-		z, err := zstd.NewReader(r,
-			zstd.WithDecoderConcurrency(1),
-		)
+		z, err := zstd.NewReader(r, c.decoderOptions()...)
 		if err != nil {
 			p.err = err
 		} else {
 			p.dec = z
 		}
 	}
+	p.c = c
 	return p
 }
 
+func (c *Codec) decoderOptions() []zstd.DOption {
+	options := []zstd.DOption{
+		zstd.WithDecoderConcurrency(1),
+	}
+	maxWindowSize := c.MaxWindowSize
+	if c.WindowSize > maxWindowSize {
+		maxWindowSize = c.WindowSize
+	}
+	if maxWindowSize != 0 {
+		options = append(options, zstd.WithDecoderMaxWindow(uint64(maxWindowSize)))
+	}
+	return options
+}
+
+func (c *Codec) encoderOptions() []zstd.EOption {
+	options := []zstd.EOption{
+		zstd.WithEncoderLevel(c.zstdLevel()),
+		zstd.WithEncoderConcurrency(1),
+		zstd.WithZeroFrames(true),
+	}
+	if c.WindowSize != 0 {
+		options = append(options, zstd.WithWindowSize(c.WindowSize))
+	}
+	return options
+}
+
 func (c *Codec) level() int {
 	if c.Level != 0 {
 		return c.Level
@@ -54,9 +109,8 @@ func (c *Codec) zstdLevel() zstd.EncoderLevel {
 	return zstd.EncoderLevelFromZstd(c.level())
 }
 
-var decoderPool sync.Pool // *zstd.Decoder
-
 type reader struct {
+	c   *Codec
 	dec *zstd.Decoder
 	err error
 }
@@ -65,7 +119,7 @@ type reader struct {
 func (r *reader) Close() error {
 	if r.dec != nil {
 		r.dec.Reset(devNull{}) // don't retain the underlying reader
-		decoderPool.Put(r.dec)
+		r.c.decoderPool.Put(r.dec)
 		r.dec = nil
 		r.err = io.ErrClosedPipe
 	}
@@ -98,11 +152,7 @@ func (r *reader) WriteTo(w io.Writer) (int64, error) {
 func (c *Codec) NewWriter(w io.Writer) io.WriteCloser {
 	p := new(writer)
 	if enc, _ := c.encoderPool.Get().(*zstd.Encoder); enc == nil {
-		z, err := zstd.NewWriter(w,
-			zstd.WithEncoderLevel(c.zstdLevel()),
-			zstd.WithEncoderConcurrency(1),
-			zstd.WithZeroFrames(true),
-		)
+		z, err := zstd.NewWriter(w, c.encoderOptions()...)
 		if err != nil {
 			p.err = err
 		} else {
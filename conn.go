@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -39,9 +40,10 @@ type Conn struct {
 	rbuf  bufio.Reader
 
 	// write buffer (synchronized on wlock)
-	wlock sync.Mutex
-	wbuf  bufio.Writer
-	wb    writeBuffer
+	wlock  sync.Mutex
+	wbuf   bufio.Writer
+	wb     writeBuffer
+	wcount countWriter
 
 	// deadline management
 	wdeadline connDeadline
@@ -59,12 +61,21 @@ type Conn struct {
 	// correlation ID generator (synchronized on wlock)
 	correlationID int32
 
+	// slots of the pipelined requests, nil when the depth is not limited
+	pipeline chan struct{}
+
+	// bytes of the pipelined requests, nil when the size is not limited
+	window *connWindow
+
 	// number of replica acks required when publishing to a partition
 	requiredAcks int32
 
 	// lazily loaded API versions used by this connection
 	apiVersions atomic.Value // apiVersionMap
 
+	// lazily loaded limits of the broker
+	limits atomic.Value // BrokerLimits
+
 	transactionalID *string
 }
 
@@ -97,6 +108,34 @@ type ConnConfig struct {
 	// For more details look at transactional.id description here: http://kafka.apache.org/documentation.html#producerconfigs
 	// Empty string means that this connection can't be transactional.
 	TransactionalID string
+
+	// PipelineDepth limits the number of requests that may be sent on the
+	// connection before their responses are read.
+	//
+	// The methods of Conn may be called concurrently, the requests of each
+	// call are then pipelined on the connection, and the responses matched
+	// to the calls by correlation id; kafka processes the requests of a
+	// connection in order. A goroutine calling methods sequentially always
+	// waits for each response before sending the next request.
+	//
+	// Zero means that the number of pipelined requests is not limited. When
+	// the limit is reached, calls wait for the responses of previous requests
+	// before sending theirs.
+	PipelineDepth int
+
+	// PipelineBytes limits the total size of the requests that may be sent on
+	// the connection before their responses are read, in bytes.
+	//
+	// The limit acts as a flow control window bounding the memory used by the
+	// requests in flight on connections with a high latency, while letting
+	// concurrent calls keep the connection busy. Calls wait for the responses
+	// of previous requests while the size of the requests in flight reaches
+	// the limit; a request larger than the limit is sent once no other
+	// requests are in flight.
+	//
+	// Zero means that the size of pipelined requests is not limited. The
+	// limit applies in addition to PipelineDepth.
+	PipelineBytes int
 }
 
 // ReadBatchConfig is a configuration object used for reading batches of messages.
@@ -124,6 +163,11 @@ type ReadBatchConfig struct {
 	// For backward compatibility, when this field is left zero, kafka-go will
 	// infer the max wait from the connection's read deadline.
 	MaxWait time.Duration
+
+	// ControlRecords makes the batch return the control records marking the
+	// end of transactions, which are skipped otherwise. The Control field of
+	// the messages read from control records describes the marker.
+	ControlRecords bool
 }
 
 type IsolationLevel int8
@@ -187,6 +231,16 @@ func NewConnWith(conn net.Conn, config ConnConfig) *Conn {
 
 	c.wb.w = &c.wbuf
 
+	if config.PipelineDepth > 0 {
+		c.pipeline = make(chan struct{}, config.PipelineDepth)
+	}
+
+	if config.PipelineBytes > 0 {
+		c.window = newConnWindow(config.PipelineBytes)
+		c.wcount.w = conn
+		c.wbuf.Reset(&c.wcount)
+	}
+
 	// The fetch request needs to ask for a MaxBytes value that is at least
 	// enough to load the control data of the response. To avoid having to
 	// recompute it on every read, it is cached here in the Conn value.
@@ -729,6 +783,14 @@ func (c *Conn) ReadMessage(maxBytes int) (Message, error) {
 	return msg, coalesceErrors(silentEOF(err), batch.Close())
 }
 
+// ReadMessageContext is like ReadMessage but the program may pass a context to
+// asynchronously cancel the read, see ReadBatchWithContext for details.
+func (c *Conn) ReadMessageContext(ctx context.Context, maxBytes int) (Message, error) {
+	batch := c.ReadBatchContext(ctx, 1, maxBytes)
+	msg, err := batch.ReadMessage()
+	return msg, coalesceErrors(silentEOF(err), batch.Close())
+}
+
 // ReadBatch reads a batch of messages from the kafka server. The method always
 // returns a non-nil Batch value. If an error occurred, either sending the fetch
 // request or reading the response, the error will be made available by the
@@ -870,15 +932,17 @@ func (c *Conn) ReadBatchWith(cfg ReadBatchConfig) *Batch {
 	}
 
 	return &Batch{
-		conn:          c,
-		msgs:          msgs,
-		deadline:      adjustedDeadline,
-		throttle:      makeDuration(throttle),
-		lock:          lock,
-		topic:         c.topic,          // topic is copied to Batch to prevent race with Batch.close
-		partition:     int(c.partition), // partition is copied to Batch to prevent race with Batch.close
-		offset:        offset,
-		highWaterMark: highWaterMark,
+		conn:           c,
+		msgs:           msgs,
+		deadline:       adjustedDeadline,
+		throttle:       makeDuration(throttle),
+		lock:           lock,
+		topic:          c.topic,          // topic is copied to Batch to prevent race with Batch.close
+		partition:      int(c.partition), // partition is copied to Batch to prevent race with Batch.close
+		offset:         offset,
+		highWaterMark:  highWaterMark,
+		leaderEpoch:    -1,
+		controlRecords: cfg.ControlRecords,
 		// there shouldn't be a short read on initially setting up the batch.
 		// as such, any io.EOF is re-mapped to an io.ErrUnexpectedEOF so that we
 		// don't accidentally signal that we successfully reached the end of the
@@ -887,6 +951,65 @@ func (c *Conn) ReadBatchWith(cfg ReadBatchConfig) *Batch {
 	}
 }
 
+// ReadBatchContext is like ReadBatch but the program may pass a context to
+// asynchronously cancel the read, see ReadBatchWithContext for details.
+func (c *Conn) ReadBatchContext(ctx context.Context, minBytes, maxBytes int) *Batch {
+	return c.ReadBatchWithContext(ctx, ReadBatchConfig{
+		MinBytes: minBytes,
+		MaxBytes: maxBytes,
+	})
+}
+
+// ReadBatchWithContext is like ReadBatchWith but the program may pass a context
+// to asynchronously cancel the read while waiting for the kafka server to
+// respond, which may take up to MaxWait, the read deadline of the connection
+// still applies.
+//
+// When the context is canceled before the response is received the connection
+// is closed, since the response is still in flight, and the error of the
+// returned batch is the context error.
+func (c *Conn) ReadBatchWithContext(ctx context.Context, cfg ReadBatchConfig) *Batch {
+	if err := ctx.Err(); err != nil {
+		return &Batch{err: err}
+	}
+
+	closed := c.closeOnCancel(ctx)
+	batch := c.ReadBatchWith(cfg)
+
+	if closed() && batch.err != nil {
+		batch.err = ctx.Err()
+	}
+	return batch
+}
+
+// closeOnCancel closes the connection if ctx is canceled before the returned
+// function is called, the function reports whether the connection was closed.
+func (c *Conn) closeOnCancel(ctx context.Context) func() bool {
+	const (
+		waiting = iota
+		stopped
+		closed
+	)
+
+	var state int32
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			if atomic.CompareAndSwapInt32(&state, waiting, closed) {
+				c.conn.Close()
+			}
+		case <-done:
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		return !atomic.CompareAndSwapInt32(&state, waiting, stopped)
+	}
+}
+
 // ReadOffset returns the offset of the first message with a timestamp equal or
 // greater to t.
 func (c *Conn) ReadOffset(t time.Time) (int64, error) {
@@ -953,6 +1076,155 @@ func (c *Conn) readOffset(t int64) (offset int64, err error) {
 	return
 }
 
+// EpochOffset is an offset paired with the leader epoch that it belongs to.
+//
+// Programs tailing a partition can record the leader epoch of the offsets
+// they consumed, and after a leader change, use OffsetForLeaderEpoch to check
+// whether the log was truncated past those offsets.
+type EpochOffset struct {
+	Offset int64
+
+	// LeaderEpoch is -1 when the broker does not support reporting leader
+	// epochs, or when the epoch of the offset is unknown.
+	LeaderEpoch int
+}
+
+// ReadFirstEpochOffset returns the first offset available on the connection,
+// and the leader epoch it belongs to.
+//
+// The leader epoch is only reported by kafka brokers supporting the
+// ListOffsets API in version 4 or above, it is set to -1 otherwise.
+func (c *Conn) ReadFirstEpochOffset() (EpochOffset, error) {
+	return c.readEpochOffset(FirstOffset)
+}
+
+// ReadLastEpochOffset returns the last offset available on the connection,
+// and the leader epoch it belongs to.
+//
+// The leader epoch is only reported by kafka brokers supporting the
+// ListOffsets API in version 4 or above, it is set to -1 otherwise.
+func (c *Conn) ReadLastEpochOffset() (EpochOffset, error) {
+	return c.readEpochOffset(LastOffset)
+}
+
+// ReadEpochOffsets returns the absolute first and last offsets of the topic
+// used by the connection, and the leader epochs they belong to.
+func (c *Conn) ReadEpochOffsets() (first, last EpochOffset, err error) {
+	if first, err = c.ReadFirstEpochOffset(); err != nil {
+		return
+	}
+	if last, err = c.ReadLastEpochOffset(); err != nil {
+		first = EpochOffset{} // don't leak the value on error
+		return
+	}
+	return
+}
+
+func (c *Conn) readEpochOffset(t int64) (EpochOffset, error) {
+	version, err := c.negotiateVersion(listOffsets, v1, v4)
+	if err != nil {
+		return EpochOffset{}, err
+	}
+
+	if version < v4 {
+		offset, err := c.readOffset(t)
+		if err != nil {
+			return EpochOffset{}, err
+		}
+		return EpochOffset{Offset: offset, LeaderEpoch: -1}, nil
+	}
+
+	var res listOffsetResponseV4
+
+	err = c.readOperation(
+		func(deadline time.Time, id int32) error {
+			return c.writeRequest(listOffsets, v4, id, listOffsetRequestV4{
+				ReplicaID: -1,
+				Topics: []listOffsetRequestTopicV4{{
+					TopicName: c.topic,
+					Partitions: []listOffsetRequestPartitionV4{{
+						Partition:          c.partition,
+						CurrentLeaderEpoch: -1,
+						Time:               t,
+					}},
+				}},
+			})
+		},
+		func(deadline time.Time, size int) error {
+			return c.readResponse(size, &res)
+		},
+	)
+	if err != nil {
+		return EpochOffset{}, err
+	}
+
+	for _, topic := range res.Topics {
+		for _, p := range topic.PartitionOffsets {
+			if p.ErrorCode != 0 {
+				return EpochOffset{}, Error(p.ErrorCode)
+			}
+			return EpochOffset{Offset: p.Offset, LeaderEpoch: int(p.LeaderEpoch)}, nil
+		}
+	}
+
+	return EpochOffset{}, UnknownTopicOrPartition
+}
+
+// OffsetForLeaderEpoch returns the end offset of the given leader epoch for
+// the topic and partition of the connection, which is the offset of the first
+// message written by the next leader.
+//
+// If the broker does not know about the epoch, it returns the end offset of
+// the largest epoch lower than the one requested, the returned LeaderEpoch is
+// set to the epoch that the offset belongs to. Both fields are set to -1 when
+// no such epoch exists.
+//
+// Comparing the end offset of an epoch with the offset that a program consumed
+// up to in this epoch is how log truncation is detected after a leader change:
+// if the end offset is lower, the messages past it were discarded.
+//
+// This method requires the kafka broker to support the OffsetForLeaderEpoch
+// API in version 2 or above.
+func (c *Conn) OffsetForLeaderEpoch(leaderEpoch int) (EpochOffset, error) {
+	if _, err := c.negotiateVersion(offsetForLeaderEpoch, v2); err != nil {
+		return EpochOffset{}, err
+	}
+
+	var res offsetForLeaderEpochResponseV2
+
+	err := c.readOperation(
+		func(deadline time.Time, id int32) error {
+			return c.writeRequest(offsetForLeaderEpoch, v2, id, offsetForLeaderEpochRequestV2{
+				Topics: []offsetForLeaderEpochRequestTopicV2{{
+					TopicName: c.topic,
+					Partitions: []offsetForLeaderEpochRequestPartitionV2{{
+						Partition:          c.partition,
+						CurrentLeaderEpoch: -1,
+						LeaderEpoch:        int32(leaderEpoch),
+					}},
+				}},
+			})
+		},
+		func(deadline time.Time, size int) error {
+			return c.readResponse(size, &res)
+		},
+	)
+	if err != nil {
+		return EpochOffset{}, err
+	}
+
+	for _, topic := range res.Topics {
+		for _, p := range topic.Partitions {
+			if p.ErrorCode != 0 {
+				return EpochOffset{}, Error(p.ErrorCode)
+			}
+			return EpochOffset{Offset: p.EndOffset, LeaderEpoch: int(p.LeaderEpoch)}, nil
+		}
+	}
+
+	return EpochOffset{}, UnknownTopicOrPartition
+}
+
 // ReadPartitions returns the list of available partitions for the given list of
 // topics.
 //
@@ -1045,13 +1317,31 @@ func (c *Conn) WriteMessages(msgs ...Message) (int, error) {
 	return c.WriteCompressedMessages(nil, msgs...)
 }
 
+// WriteMessagesWith is like WriteMessages but requests the given number of
+// acknowledges from replicas for this write only, instead of the value set on
+// the connection by SetRequiredAcks.
+//
+// Only RequireOne and RequireAll are supported, the method returns
+// InvalidRequiredAcks without writing any messages for other values.
+func (c *Conn) WriteMessagesWith(acks RequiredAcks, msgs ...Message) (int, error) {
+	switch acks {
+	case RequireOne, RequireAll:
+	default:
+		return 0, InvalidRequiredAcks
+	}
+	nbytes, _, _, _, err := c.writeCompressedMessages(nil, int16(acks), msgs...)
+	return nbytes, err
+}
+
 // WriteCompressedMessages writes a batch of messages to the connection's topic
 // and partition, returning the number of bytes written. The write is an atomic
 // operation, it either fully succeeds or fails.
 //
-// If the compression codec is not nil, the messages will be compressed.
+// If the compression codec is not nil, the messages will be compressed. The
+// codec must use one of the compression codes known to the compress package,
+// otherwise the method returns an error without writing any messages.
 func (c *Conn) WriteCompressedMessages(codec CompressionCodec, msgs ...Message) (nbytes int, err error) {
-	nbytes, _, _, _, err = c.writeCompressedMessages(codec, msgs...)
+	nbytes, _, _, _, err = c.writeCompressedMessages(codec, c.loadRequiredAcks(), msgs...)
 	return
 }
 
@@ -1060,12 +1350,14 @@ func (c *Conn) WriteCompressedMessages(codec CompressionCodec, msgs ...Message)
 // and timestamp assigned by the kafka broker to the message set. The write is an atomic
 // operation, it either fully succeeds or fails.
 //
-// If the compression codec is not nil, the messages will be compressed.
+// If the compression codec is not nil, the messages will be compressed. The
+// codec must use one of the compression codes known to the compress package,
+// otherwise the method returns an error without writing any messages.
 func (c *Conn) WriteCompressedMessagesAt(codec CompressionCodec, msgs ...Message) (nbytes int, partition int32, offset int64, appendTime time.Time, err error) {
-	return c.writeCompressedMessages(codec, msgs...)
+	return c.writeCompressedMessages(codec, c.loadRequiredAcks(), msgs...)
 }
 
-func (c *Conn) writeCompressedMessages(codec CompressionCodec, msgs ...Message) (nbytes int, partition int32, offset int64, appendTime time.Time, err error) {
+func (c *Conn) writeCompressedMessages(codec CompressionCodec, acks int16, msgs ...Message) (nbytes int, partition int32, offset int64, appendTime time.Time, err error) {
 	if len(msgs) == 0 {
 		return
 	}
@@ -1090,6 +1382,15 @@ func (c *Conn) writeCompressedMessages(codec CompressionCodec, msgs ...Message)
 		nbytes += len(msg.Key) + len(msg.Value)
 	}
 
+	if codec != nil {
+		// The broker and consumers identify the codec by its code only, so
+		// batches compressed with an unknown code would not be readable.
+		if _, err = resolveCodec(codec.Code()); err != nil {
+			nbytes = 0
+			return
+		}
+	}
+
 	var produceVersion apiVersion
 	if produceVersion, err = c.negotiateVersion(produce, v2, v3, v7); err != nil {
 		return
@@ -1115,7 +1416,7 @@ func (c *Conn) writeCompressedMessages(codec CompressionCodec, msgs ...Message)
 					c.topic,
 					c.partition,
 					deadlineToTimeout(deadline, now),
-					int16(atomic.LoadInt32(&c.requiredAcks)),
+					acks,
 					c.transactionalID,
 					recordBatch,
 				)
@@ -1134,7 +1435,7 @@ func (c *Conn) writeCompressedMessages(codec CompressionCodec, msgs ...Message)
 					c.topic,
 					c.partition,
 					deadlineToTimeout(deadline, now),
-					int16(atomic.LoadInt32(&c.requiredAcks)),
+					acks,
 					c.transactionalID,
 					recordBatch,
 				)
@@ -1146,7 +1447,7 @@ func (c *Conn) writeCompressedMessages(codec CompressionCodec, msgs ...Message)
 					c.topic,
 					c.partition,
 					deadlineToTimeout(deadline, now),
-					int16(atomic.LoadInt32(&c.requiredAcks)),
+					acks,
 					msgs...,
 				)
 			}
@@ -1221,6 +1522,10 @@ func (c *Conn) SetRequiredAcks(n int) error {
 	}
 }
 
+func (c *Conn) loadRequiredAcks() int16 {
+	return int16(atomic.LoadInt32(&c.requiredAcks))
+}
+
 func (c *Conn) writeRequestHeader(apiKey apiKey, apiVersion apiVersion, correlationID int32, size int32) {
 	hdr := c.requestHeader(apiKey, apiVersion, correlationID)
 	hdr.Size = (hdr.size() + size) - 4
@@ -1276,12 +1581,38 @@ func (c *Conn) writeOperation(write func(time.Time, int32) error, read func(time
 	return c.do(&c.wdeadline, write, read)
 }
 
-func (c *Conn) enter() {
+// enter waits for a slot in the pipeline of requests, it fails with
+// os.ErrDeadlineExceeded if the deadline is reached first.
+func (c *Conn) enter(deadline time.Time) error {
+	if c.pipeline != nil {
+		if deadline.IsZero() {
+			c.pipeline <- struct{}{}
+		} else {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+
+			select {
+			case c.pipeline <- struct{}{}:
+			case <-timer.C:
+				return os.ErrDeadlineExceeded
+			}
+		}
+	}
 	atomic.AddInt32(&c.inflight, +1)
+	return nil
 }
 
-func (c *Conn) leave() {
+func (c *Conn) leave(id int32) {
+	c.window.release(id)
+	c.exit()
+}
+
+// exit releases the slot acquired by enter.
+func (c *Conn) exit() {
 	atomic.AddInt32(&c.inflight, -1)
+	if c.pipeline != nil {
+		<-c.pipeline
+	}
 }
 
 func (c *Conn) concurrency() int {
@@ -1313,19 +1644,31 @@ func (c *Conn) do(d *connDeadline, write func(time.Time, int32) error, read func
 }
 
 func (c *Conn) doRequest(d *connDeadline, write func(time.Time, int32) error) (id int32, err error) {
-	c.enter()
+	deadline := d.deadline()
+	if err = c.enter(deadline); err != nil {
+		return
+	}
 	c.wlock.Lock()
+	// Waiting while holding the write lock preserves the order in which the
+	// requests are sent, the window is released by the readers.
+	if err = c.window.acquire(deadline); err != nil {
+		c.wlock.Unlock()
+		c.exit()
+		return
+	}
 	c.correlationID++
 	id = c.correlationID
+	n := c.wcount.n
 	err = write(d.setConnWriteDeadline(c.conn), id)
 	d.unsetConnWriteDeadline()
+	c.window.add(id, c.wcount.n-n)
 
 	if err != nil {
 		// When an error occurs there's no way to know if the connection is in a
 		// recoverable state so we're better off just giving up at this point to
 		// avoid any risk of corrupting the following operations.
 		c.conn.Close()
-		c.leave()
+		c.leave(id)
 	}
 
 	c.wlock.Unlock()
@@ -1371,7 +1714,7 @@ func (c *Conn) waitResponse(d *connDeadline, id int32) (deadline time.Time, size
 		runtime.Gosched()
 	}
 
-	c.leave()
+	c.leave(id)
 	return
 }
 
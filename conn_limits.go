@@ -0,0 +1,160 @@
+package kafka
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+// BrokerLimits holds the limits configured on the kafka broker that a
+// connection was established to, which programs writing or reading batches
+// of messages with a Conn must respect.
+type BrokerLimits struct {
+	// MaxMessageBytes is the largest size of a batch of messages that may be
+	// written to the partition of the connection. It is the value of the
+	// max.message.bytes configuration of the topic when the connection was
+	// established to a partition, or of message.max.bytes on the broker
+	// otherwise.
+	MaxMessageBytes int
+
+	// MaxRequestBytes is the largest size of a request accepted by the broker,
+	// as configured by socket.request.max.bytes.
+	MaxRequestBytes int
+
+	// FetchMaxBytes is the largest size of the responses returned by the
+	// broker to fetch requests, as configured by fetch.max.bytes. The value is
+	// zero when the broker does not support the configuration (before Kafka
+	// 2.5).
+	FetchMaxBytes int
+}
+
+const (
+	maxMessageBytesConfig      = "message.max.bytes"
+	maxRequestBytesConfig      = "socket.request.max.bytes"
+	fetchMaxBytesConfig        = "fetch.max.bytes"
+	topicMaxMessageBytesConfig = "max.message.bytes"
+)
+
+// Limits returns the limits configured on the kafka broker that the connection
+// was established to. The limits are described with a DescribeConfigs request
+// the first time the method is called, and cached on the connection.
+//
+// The broker is identified by the ID that the connection was created with, like
+// the connections returned by DialLeader, or by matching the remote address of
+// the connection against the addresses of the brokers in the cluster metadata.
+func (c *Conn) Limits() (BrokerLimits, error) {
+	if limits, ok := c.limits.Load().(BrokerLimits); ok {
+		return limits, nil
+	}
+
+	if _, err := c.negotiateVersion(describeConfigs, v1); err != nil {
+		return BrokerLimits{}, err
+	}
+
+	brokerID, err := c.brokerID()
+	if err != nil {
+		return BrokerLimits{}, err
+	}
+
+	request := describeConfigsRequestV1{
+		Resources: []describeConfigsRequestResourceV1{{
+			ResourceType: int8(ResourceTypeBroker),
+			ResourceName: strconv.Itoa(int(brokerID)),
+			ConfigNames:  []string{maxMessageBytesConfig, maxRequestBytesConfig, fetchMaxBytesConfig},
+		}},
+	}
+	if c.topic != "" {
+		request.Resources = append(request.Resources, describeConfigsRequestResourceV1{
+			ResourceType: int8(ResourceTypeTopic),
+			ResourceName: c.topic,
+			ConfigNames:  []string{topicMaxMessageBytesConfig},
+		})
+	}
+
+	var res describeConfigsResponseV1
+
+	err = c.readOperation(
+		func(deadline time.Time, id int32) error {
+			return c.writeRequest(describeConfigs, v1, id, request)
+		},
+		func(deadline time.Time, size int) error {
+			return c.readResponse(size, &res)
+		},
+	)
+	if err != nil {
+		return BrokerLimits{}, err
+	}
+
+	limits := BrokerLimits{}
+
+	for _, resource := range res.Resources {
+		if resource.ErrorCode != 0 {
+			return BrokerLimits{}, makeError(resource.ErrorCode, resource.ErrorMessage)
+		}
+		for _, entry := range resource.ConfigEntries {
+			value, err := strconv.Atoi(entry.ConfigValue)
+			if err != nil {
+				continue
+			}
+			switch entry.ConfigName {
+			case maxMessageBytesConfig:
+				if limits.MaxMessageBytes == 0 {
+					limits.MaxMessageBytes = value
+				}
+			case topicMaxMessageBytesConfig:
+				// The topic configuration takes precedence over the one
+				// of the broker.
+				limits.MaxMessageBytes = value
+			case maxRequestBytesConfig:
+				limits.MaxRequestBytes = value
+			case fetchMaxBytesConfig:
+				limits.FetchMaxBytes = value
+			}
+		}
+	}
+
+	c.limits.Store(limits)
+	return limits, nil
+}
+
+// brokerID returns the ID of the broker that the connection was established
+// to.
+func (c *Conn) brokerID() (int32, error) {
+	if c.broker != 0 {
+		return c.broker, nil
+	}
+
+	// The ID is zero when the connection was not created for a known broker,
+	// which is also a valid ID, look for the broker in the cluster metadata.
+	brokers, err := c.Brokers()
+	if err != nil {
+		return 0, err
+	}
+
+	self := c.Broker()
+	for _, b := range brokers {
+		if b.Port == self.Port && sameHost(b.Host, self.Host) {
+			return int32(b.ID), nil
+		}
+	}
+
+	return c.broker, nil
+}
+
+// sameHost returns true if a and b designate the same host, either by name
+// or by address.
+func sameHost(a, b string) bool {
+	if a == b {
+		return true
+	}
+	addrs, err := net.LookupHost(a)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if addr == b {
+			return true
+		}
+	}
+	return false
+}
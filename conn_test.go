@@ -6,13 +6,22 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net"
 	"os"
+	"reflect"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/alterconfigs"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/describeconfigs"
+	meta "github.com/segmentio/kafka-go/protocol/metadata"
 	ktesting "github.com/segmentio/kafka-go/testing"
 	"golang.org/x/net/nettest"
 )
@@ -131,6 +140,11 @@ func TestConn(t *testing.T) {
 			function: testConnWrite,
 		},
 
+		{
+			scenario: "write messages with per-call required acks should succeed",
+			function: testConnWriteMessagesWith,
+		},
+
 		{
 			scenario: "writing a message to a closed kafka connection should fail",
 			function: testConnCloseAndWrite,
@@ -272,6 +286,12 @@ func TestConn(t *testing.T) {
 			scenario: "the connection advertises the broker that it is connected to",
 			function: testConnBroker,
 		},
+
+		{
+			scenario:   "read the first and last offsets with their leader epochs",
+			function:   testConnReadEpochOffsets,
+			minVersion: "2.1.0",
+		},
 	}
 
 	const (
@@ -386,6 +406,23 @@ func testConnWrite(t *testing.T, conn *Conn) {
 	}
 }
 
+func testConnWriteMessagesWith(t *testing.T, conn *Conn) {
+	for _, acks := range []RequiredAcks{RequireOne, RequireAll} {
+		msg := Message{Value: []byte("Hello World!")}
+		n, err := conn.WriteMessagesWith(acks, msg)
+		if err != nil {
+			t.Errorf("acks=%s: %v", acks, err)
+		}
+		if n != len(msg.Value) {
+			t.Errorf("acks=%s: bad length returned by (*Conn).WriteMessagesWith: %d", acks, n)
+		}
+	}
+
+	if _, err := conn.WriteMessagesWith(RequireNone, Message{Value: []byte("Hello World!")}); !errors.Is(err, InvalidRequiredAcks) {
+		t.Errorf("expected InvalidRequiredAcks, got %v", err)
+	}
+}
+
 func testConnCloseAndWrite(t *testing.T, conn *Conn) {
 	conn.Close()
 
@@ -413,6 +450,41 @@ func testConnSeekFirstOffset(t *testing.T, conn *Conn) {
 	}
 }
 
+func testConnReadEpochOffsets(t *testing.T, conn *Conn) {
+	for i := 0; i != 10; i++ {
+		if _, err := conn.Write([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, last, err := conn.ReadEpochOffsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Offset != 0 {
+		t.Error("bad first offset:", first.Offset)
+	}
+	if last.Offset != 10 {
+		t.Error("bad last offset:", last.Offset)
+	}
+	if last.LeaderEpoch < 0 {
+		t.Error("bad leader epoch:", last.LeaderEpoch)
+	}
+
+	end, err := conn.OffsetForLeaderEpoch(last.LeaderEpoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if end.Offset != last.Offset {
+		t.Error("bad end offset:", end.Offset, "!=", last.Offset)
+	}
+	if end.LeaderEpoch != last.LeaderEpoch {
+		t.Error("bad end offset leader epoch:", end.LeaderEpoch, "!=", last.LeaderEpoch)
+	}
+}
+
 func testConnSeekLastOffset(t *testing.T, conn *Conn) {
 	for i := 0; i != 10; i++ {
 		if _, err := conn.Write([]byte(strconv.Itoa(i))); err != nil {
@@ -1313,6 +1385,25 @@ func benchmarkConnWrite(b *testing.B, conn *Conn, _ []byte) {
 	b.SetBytes(int64(n / i))
 }
 
+type unknownCodec struct{}
+
+func (unknownCodec) Code() int8                           { return 7 }
+func (unknownCodec) Name() string                         { return "unknown" }
+func (unknownCodec) NewReader(r io.Reader) io.ReadCloser  { return nil }
+func (unknownCodec) NewWriter(w io.Writer) io.WriteCloser { return nil }
+
+func TestConnWriteCompressedMessagesUnknownCodec(t *testing.T) {
+	conn := &Conn{}
+
+	n, err := conn.WriteCompressedMessages(unknownCodec{}, Message{Value: []byte("hello")})
+	if !errors.Is(err, errUnknownCodec) {
+		t.Errorf("expected %v but got %v", errUnknownCodec, err)
+	}
+	if n != 0 {
+		t.Errorf("expected no bytes to be written but got %d", n)
+	}
+}
+
 func TestEmptyToNullableReturnsNil(t *testing.T) {
 	if emptyToNullable("") != nil {
 		t.Error("Empty string is not converted to nil")
@@ -1360,3 +1451,465 @@ func TestMakeBrokersOneMissing(t *testing.T) {
 		t.Errorf("Expected broker 3 at index 1, got %d", b[1].ID)
 	}
 }
+
+func TestConnPipelineDepth(t *testing.T) {
+	const depth = 2
+
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConnWith(client, ConnConfig{PipelineDepth: depth})
+	defer conn.Close()
+
+	// The server reads requests as soon as they are sent, and delays the
+	// responses to let the requests accumulate on the connection.
+	var outstanding, maxOutstanding int32
+	pending := make(chan int32, 100)
+
+	go func() {
+		defer close(pending)
+		for {
+			_, id, _, _, err := protocol.ReadRequest(server)
+			if err != nil {
+				return
+			}
+			n := atomic.AddInt32(&outstanding, 1)
+			for {
+				max := atomic.LoadInt32(&maxOutstanding)
+				if n <= max || atomic.CompareAndSwapInt32(&maxOutstanding, max, n) {
+					break
+				}
+			}
+			pending <- id
+		}
+	}()
+
+	go func() {
+		for id := range pending {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&outstanding, -1)
+			protocol.WriteResponse(server, 1, id, &meta.Response{
+				Topics: []meta.ResponseTopic{{
+					Name:       "topic-A",
+					Partitions: []meta.ResponsePartition{{PartitionIndex: 0}},
+				}},
+			})
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			partitions, err := conn.ReadPartitions("topic-A")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(partitions) != 1 || partitions[0].Topic != "topic-A" {
+				t.Errorf("unexpected partitions: %+v", partitions)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if max := atomic.LoadInt32(&maxOutstanding); max != depth {
+		t.Errorf("expected up to %d pipelined requests but got %d", depth, max)
+	}
+}
+
+func TestConnPipelineDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConnWith(client, ConnConfig{PipelineDepth: 1})
+	defer conn.Close()
+
+	// The server never responds, so the first request holds the only slot
+	// of the pipeline until the connection is closed.
+	received := make(chan struct{}, 1)
+	go func() {
+		for {
+			if _, _, _, _, err := protocol.ReadRequest(server); err != nil {
+				return
+			}
+			received <- struct{}{}
+		}
+	}()
+
+	go conn.ReadPartitions("topic-A")
+	<-received
+
+	if err := conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	errch := make(chan error, 1)
+	go func() {
+		_, err := conn.heartbeat(heartbeatRequestV0{GroupID: "group-A"})
+		errch <- err
+	}()
+
+	select {
+	case err := <-errch:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected a deadline exceeded error but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a slot in the pipeline")
+	}
+}
+
+func TestConnPipelineBytesDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConnWith(client, ConnConfig{PipelineBytes: 1})
+	defer conn.Close()
+
+	// The server never responds, so the first request fills the window until
+	// the connection is closed.
+	received := make(chan struct{}, 1)
+	go func() {
+		for {
+			if _, _, _, _, err := protocol.ReadRequest(server); err != nil {
+				return
+			}
+			received <- struct{}{}
+		}
+	}()
+
+	go conn.ReadPartitions("topic-A")
+	<-received
+
+	if err := conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	errch := make(chan error, 1)
+	go func() {
+		_, err := conn.heartbeat(heartbeatRequestV0{GroupID: "group-A"})
+		errch <- err
+	}()
+
+	select {
+	case err := <-errch:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Errorf("expected a deadline exceeded error but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the window to be released")
+	}
+
+	if n := atomic.LoadInt32(&conn.inflight); n != 1 {
+		t.Errorf("expected 1 request in flight but got %d", n)
+	}
+}
+
+func TestConnPipelineBytes(t *testing.T) {
+	// maxOutstanding sends concurrent requests on a connection limited by the
+	// window, and returns the size of a request and the maximum number of
+	// requests that were in flight at once.
+	maxOutstanding := func(t *testing.T, window func(requestSize int64) int) (int64, int32) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		var outstanding, maxOutstanding int32
+		pending := make(chan int32, 100)
+
+		go func() {
+			defer close(pending)
+			for {
+				_, id, _, _, err := protocol.ReadRequest(server)
+				if err != nil {
+					return
+				}
+				n := atomic.AddInt32(&outstanding, 1)
+				for {
+					max := atomic.LoadInt32(&maxOutstanding)
+					if n <= max || atomic.CompareAndSwapInt32(&maxOutstanding, max, n) {
+						break
+					}
+				}
+				pending <- id
+			}
+		}()
+
+		go func() {
+			for id := range pending {
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&outstanding, -1)
+				protocol.WriteResponse(server, 1, id, &meta.Response{
+					Topics: []meta.ResponseTopic{{
+						Name:       "topic-A",
+						Partitions: []meta.ResponsePartition{{PartitionIndex: 0}},
+					}},
+				})
+			}
+		}()
+
+		// Measure the size of a request on a connection without limits.
+		probe := NewConnWith(client, ConnConfig{PipelineBytes: math.MaxInt32})
+		if _, err := probe.ReadPartitions("topic-A"); err != nil {
+			t.Fatal(err)
+		}
+		requestSize := probe.wcount.n
+		atomic.StoreInt32(&maxOutstanding, 0)
+
+		conn := NewConnWith(client, ConnConfig{PipelineBytes: window(requestSize)})
+		defer conn.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := conn.ReadPartitions("topic-A"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		return requestSize, atomic.LoadInt32(&maxOutstanding)
+	}
+
+	t.Run("requests are sent while the window is not full", func(t *testing.T) {
+		size, max := maxOutstanding(t, func(requestSize int64) int { return int(2*requestSize - 1) })
+		if max != 2 {
+			t.Errorf("expected up to 2 pipelined requests of %d bytes but got %d", size, max)
+		}
+	})
+
+	t.Run("requests larger than the window are sent one at a time", func(t *testing.T) {
+		size, max := maxOutstanding(t, func(requestSize int64) int { return 1 })
+		if max != 1 {
+			t.Errorf("expected up to 1 pipelined request of %d bytes but got %d", size, max)
+		}
+	})
+}
+
+func TestConnReadBatchWithContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConnWith(client, ConnConfig{Topic: "topic-A"})
+	defer conn.Close()
+
+	// The server answers the version negotiation but never responds to the
+	// fetch request, like a broker waiting for MaxWait.
+	go func() {
+		for {
+			apiVersion, id, _, msg, err := protocol.ReadRequest(server)
+			if err != nil {
+				return
+			}
+			if _, ok := msg.(*apiversions.Request); ok {
+				protocol.WriteResponse(server, apiVersion, id, &apiversions.Response{
+					ApiKeys: []apiversions.ApiKeyResponse{
+						{ApiKey: int16(protocol.Fetch), MinVersion: 0, MaxVersion: 10},
+					},
+				})
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	batch := conn.ReadBatchWithContext(ctx, ReadBatchConfig{MinBytes: 1, MaxBytes: 1e6, MaxWait: time.Minute})
+	if err := batch.Close(); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the read to be canceled but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the read was not interrupted by the cancellation of the context (%s)", elapsed)
+	}
+
+	if _, err := conn.ReadMessageContext(ctx, 1e6); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected reads with a canceled context to fail but got %v", err)
+	}
+}
+
+func TestConnTopicConfigs(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConnWith(client, ConnConfig{})
+	defer conn.Close()
+
+	configs := map[string]string{"retention.ms": "3600000"}
+
+	go func() {
+		for {
+			apiVersion, id, _, msg, err := protocol.ReadRequest(server)
+			if err != nil {
+				return
+			}
+
+			var res protocol.Message
+			switch req := msg.(type) {
+			case *apiversions.Request:
+				res = &apiversions.Response{
+					ApiKeys: []apiversions.ApiKeyResponse{
+						{ApiKey: int16(protocol.DescribeConfigs), MinVersion: 0, MaxVersion: 1},
+						{ApiKey: int16(protocol.AlterConfigs), MinVersion: 0, MaxVersion: 0},
+					},
+				}
+
+			case *describeconfigs.Request:
+				r := req.Resources[0]
+				entries := []describeconfigs.ResponseConfigEntry{}
+				for _, name := range r.ConfigNames {
+					source := ConfigSourceDefault
+					if _, ok := configs[name]; ok {
+						source = ConfigSourceDynamicTopic
+					}
+					entries = append(entries, describeconfigs.ResponseConfigEntry{
+						ConfigName:   name,
+						ConfigValue:  configs[name],
+						ReadOnly:     name == "segment.index.bytes",
+						ConfigSource: int8(source),
+					})
+				}
+				res = &describeconfigs.Response{
+					Resources: []describeconfigs.ResponseResource{{
+						ResourceType:  r.ResourceType,
+						ResourceName:  r.ResourceName,
+						ConfigEntries: entries,
+					}},
+				}
+
+			case *alterconfigs.Request:
+				r := req.Resources[0]
+				resource := alterconfigs.ResponseResponses{
+					ResourceType: r.ResourceType,
+					ResourceName: r.ResourceName,
+				}
+				if r.ResourceName != "topic-A" {
+					resource.ErrorCode = int16(UnknownTopicOrPartition)
+				} else {
+					configs = make(map[string]string)
+					for _, c := range r.Configs {
+						configs[c.Name] = c.Value
+					}
+				}
+				res = &alterconfigs.Response{Responses: []alterconfigs.ResponseResponses{resource}}
+
+			default:
+				return
+			}
+
+			if err := protocol.WriteResponse(server, apiVersion, id, res); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := conn.AlterConfigs("topic-A", ConfigEntry{ConfigName: "cleanup.policy", ConfigValue: "compact"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.AlterConfigs("topic-B"); !errors.Is(err, UnknownTopicOrPartition) {
+		t.Errorf("expected an unknown topic error but got %v", err)
+	}
+
+	entries, err := conn.DescribeConfigs("topic-A", "cleanup.policy", "retention.ms", "segment.index.bytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []DescribeConfigResponseConfigEntry{
+		{ConfigName: "cleanup.policy", ConfigValue: "compact", ConfigSource: int8(ConfigSourceDynamicTopic)},
+		{ConfigName: "retention.ms", ConfigSource: int8(ConfigSourceDefault)},
+		{ConfigName: "segment.index.bytes", ReadOnly: true, ConfigSource: int8(ConfigSourceDefault)},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("unexpected config entries:\nwant: %+v\ngot:  %+v", want, entries)
+	}
+}
+
+func TestConnLimits(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConnWith(client, ConnConfig{Topic: "topic-A", Broker: 2})
+	defer conn.Close()
+
+	configs := map[string]map[string]string{
+		"2": {
+			"message.max.bytes":        "1048588",
+			"socket.request.max.bytes": "104857600",
+			"fetch.max.bytes":          "57671680",
+		},
+		"topic-A": {
+			"max.message.bytes": "2097152",
+		},
+	}
+
+	var requests int32
+	go func() {
+		for {
+			apiVersion, id, _, msg, err := protocol.ReadRequest(server)
+			if err != nil {
+				return
+			}
+
+			var res protocol.Message
+			switch req := msg.(type) {
+			case *apiversions.Request:
+				res = &apiversions.Response{
+					ApiKeys: []apiversions.ApiKeyResponse{
+						{ApiKey: int16(protocol.DescribeConfigs), MinVersion: 0, MaxVersion: 1},
+					},
+				}
+
+			case *describeconfigs.Request:
+				atomic.AddInt32(&requests, 1)
+				r := &describeconfigs.Response{}
+				for _, resource := range req.Resources {
+					entries := []describeconfigs.ResponseConfigEntry{}
+					for _, name := range resource.ConfigNames {
+						entries = append(entries, describeconfigs.ResponseConfigEntry{
+							ConfigName:  name,
+							ConfigValue: configs[resource.ResourceName][name],
+						})
+					}
+					r.Resources = append(r.Resources, describeconfigs.ResponseResource{
+						ResourceType:  resource.ResourceType,
+						ResourceName:  resource.ResourceName,
+						ConfigEntries: entries,
+					})
+				}
+				res = r
+
+			default:
+				return
+			}
+
+			if err := protocol.WriteResponse(server, apiVersion, id, res); err != nil {
+				return
+			}
+		}
+	}()
+
+	want := BrokerLimits{
+		MaxMessageBytes: 2097152,
+		MaxRequestBytes: 104857600,
+		FetchMaxBytes:   57671680,
+	}
+
+	for i := 0; i < 2; i++ {
+		limits, err := conn.Limits()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limits != want {
+			t.Errorf("unexpected limits:\nwant: %+v\ngot:  %+v", want, limits)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected the limits to be cached after the first request but %d were sent", n)
+	}
+}
@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// connWindow bounds the total size of the requests in flight on a connection.
+// A nil window is valid and never limits the requests.
+type connWindow struct {
+	size int64
+
+	mutex    sync.Mutex
+	cond     sync.Cond
+	inflight int64           // bytes of the requests in flight
+	requests map[int32]int64 // bytes of each request by correlation id
+}
+
+func newConnWindow(size int) *connWindow {
+	w := &connWindow{
+		size:     int64(size),
+		requests: make(map[int32]int64),
+	}
+	w.cond.L = &w.mutex
+	return w
+}
+
+// acquire blocks until the size of the requests in flight is below the size
+// of the window, or no requests are in flight. It fails with
+// os.ErrDeadlineExceeded if the deadline is reached first.
+func (w *connWindow) acquire(deadline time.Time) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !deadline.IsZero() {
+		// The condition cannot be waited on with a timeout, the waiters are
+		// woken up when the deadline is reached instead.
+		timer := time.AfterFunc(time.Until(deadline), func() {
+			w.mutex.Lock()
+			w.cond.Broadcast()
+			w.mutex.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	for w.inflight > 0 && w.inflight >= w.size {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return os.ErrDeadlineExceeded
+		}
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// add records that the request with the correlation id was sent.
+func (w *connWindow) add(id int32, n int64) {
+	if w == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	w.requests[id] += n
+	w.inflight += n
+	w.mutex.Unlock()
+}
+
+// release returns the bytes of the request with the correlation id to the
+// window, after its response was received or it failed to be sent.
+func (w *connWindow) release(id int32) {
+	if w == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	if n, ok := w.requests[id]; ok {
+		delete(w.requests, id)
+		w.inflight -= n
+		w.cond.Broadcast()
+	}
+	w.mutex.Unlock()
+}
+
+// countWriter counts the bytes written to w, connections use it to measure the
+// size of their requests.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
@@ -89,10 +89,35 @@ type ConsumerGroupConfig struct {
 	// Default: [Range, RoundRobin]
 	GroupBalancers []GroupBalancer
 
+	// GroupProtocolUserData optionally provides the user data embedded in the
+	// subscription metadata that the member sends for each of the
+	// GroupBalancers when joining the group, in place of the value returned
+	// by the balancer's UserData method.  It lets programs carry custom member
+	// state, like capacity hints, to the group leader where the balancer sees
+	// it in the UserData field of the GroupMember values passed to
+	// AssignGroups.
+	//
+	// The function is called on every JoinGroup request, so the user data may
+	// change across rebalances.  Functions which only add to the user data of
+	// some balancers should return the result of balancer.UserData() for the
+	// others.  The metadata of all members is sent to the leader in a single
+	// JoinGroup response, the total size must remain well below the brokers'
+	// message.max.bytes and socket.request.max.bytes limits.
+	GroupProtocolUserData func(balancer GroupBalancer) ([]byte, error)
+
+	// GroupProtocol selects the protocol used to coordinate with the other
+	// members of the group.  With GroupProtocolConsumer, the brokers compute
+	// the partition assignments and GroupBalancers are not used, the group
+	// falls back to the classic protocol if the brokers do not support it.
+	//
+	// Default: GroupProtocolClassic
+	GroupProtocol GroupProtocol
+
 	// HeartbeatInterval sets the optional frequency at which the reader sends the consumer
-	// group heartbeat update.
+	// group heartbeat update. It must not be greater than SessionTimeout, and
+	// should be no greater than a third of it.
 	//
-	// Default: 3s
+	// Default: 3s, or a third of SessionTimeout if it is shorter
 	HeartbeatInterval time.Duration
 
 	// PartitionWatchInterval indicates how often a reader checks for partition changes.
@@ -104,10 +129,15 @@ type ConsumerGroupConfig struct {
 
 	// WatchForPartitionChanges is used to inform kafka-go that a consumer group should be
 	// polling the brokers and rebalancing if any partition changes happen to the topic.
+	//
+	// With GroupProtocolConsumer, the group coordinator assigns the partitions
+	// added to the topics itself, and this option has no effect.
 	WatchPartitionChanges bool
 
 	// SessionTimeout optionally sets the length of time that may pass without a heartbeat
 	// before the coordinator considers the consumer dead and initiates a rebalance.
+	// It must be within the bounds configured on the brokers with
+	// group.min.session.timeout.ms and group.max.session.timeout.ms.
 	//
 	// Default: 30s
 	SessionTimeout time.Duration
@@ -116,7 +146,13 @@ type ConsumerGroupConfig struct {
 	// for members to join as part of a rebalance.  For kafka servers under higher
 	// load, it may be useful to set this value higher.
 	//
-	// Default: 30s
+	// Members which do not rejoin within this time, for example because they
+	// are still processing messages of the previous generation, are removed
+	// from the group. Unlike SessionTimeout it does not depend on heartbeats,
+	// similarly to the max.poll.interval.ms setting of the java client. It
+	// must be greater than or equal to SessionTimeout when both are set.
+	//
+	// Default: 30s, or SessionTimeout if it is longer
 	RebalanceTimeout time.Duration
 
 	// JoinGroupBackoff optionally sets the length of time to wait before re-joining
@@ -149,6 +185,11 @@ type ConsumerGroupConfig struct {
 	// back to using Logger instead.
 	ErrorLogger Logger
 
+	// If not nil, specifies a logger which receives both the internal changes
+	// and the errors of the consumer group, with their group, member, and
+	// generation as attributes. It can be combined with Logger and ErrorLogger.
+	StructuredLogger StructuredLogger
+
 	// Timeout is the network timeout used when communicating with the consumer
 	// group coordinator.  This value should not be too small since errors
 	// communicating with the broker will generally cause a consumer group
@@ -192,20 +233,31 @@ func (config *ConsumerGroupConfig) Validate() error {
 		}
 	}
 
-	if config.HeartbeatInterval == 0 {
-		config.HeartbeatInterval = defaultHeartbeatInterval
+	if config.GroupProtocol != GroupProtocolClassic && config.GroupProtocol != GroupProtocolConsumer {
+		return errors.New(fmt.Sprintf("GroupProtocol is not valid %d", config.GroupProtocol))
 	}
 
+	// the rebalance timeout is only checked against session timeouts that were
+	// configured, to keep accepting shorter rebalance timeouts combined with
+	// the default session timeout.
+	sessionTimeout := config.SessionTimeout
 	if config.SessionTimeout == 0 {
 		config.SessionTimeout = defaultSessionTimeout
 	}
 
+	if config.HeartbeatInterval == 0 {
+		config.HeartbeatInterval = sessionHeartbeatInterval(config.SessionTimeout)
+	}
+
 	if config.PartitionWatchInterval == 0 {
 		config.PartitionWatchInterval = defaultPartitionWatchTime
 	}
 
 	if config.RebalanceTimeout == 0 {
 		config.RebalanceTimeout = defaultRebalanceTimeout
+		if config.RebalanceTimeout < config.SessionTimeout {
+			config.RebalanceTimeout = config.SessionTimeout
+		}
 	}
 
 	if config.JoinGroupBackoff == 0 {
@@ -240,6 +292,16 @@ func (config *ConsumerGroupConfig) Validate() error {
 		return errors.New(fmt.Sprintf("PartitionWachInterval out of bounds %d", config.PartitionWatchInterval))
 	}
 
+	if err := validateSessionTimeout(config.HeartbeatInterval, config.SessionTimeout); err != nil {
+		return err
+	}
+
+	if sessionTimeout != 0 {
+		if err := validateRebalanceTimeout(sessionTimeout, config.RebalanceTimeout); err != nil {
+			return err
+		}
+	}
+
 	if config.StartOffset == 0 {
 		config.StartOffset = FirstOffset
 	}
@@ -259,6 +321,38 @@ func (config *ConsumerGroupConfig) Validate() error {
 	return nil
 }
 
+// validateSessionTimeout checks the relationship between the heartbeat
+// interval and the session timeout of a consumer group member. The coordinator
+// evicts members which did not send a heartbeat within the session timeout, so
+// members heartbeating less often would never stay in the group.
+func validateSessionTimeout(heartbeatInterval, sessionTimeout time.Duration) error {
+	if heartbeatInterval > sessionTimeout {
+		return errors.New(fmt.Sprintf("HeartbeatInterval of %s must not be greater than the SessionTimeout of %s", heartbeatInterval, sessionTimeout))
+	}
+
+	return nil
+}
+
+// sessionHeartbeatInterval returns the heartbeat interval used when none is
+// configured, it is shortened for session timeouts below 9s so a couple of
+// heartbeats may be lost before the session expires.
+func sessionHeartbeatInterval(sessionTimeout time.Duration) time.Duration {
+	if interval := sessionTimeout / 3; interval > 0 && interval < defaultHeartbeatInterval {
+		return interval
+	}
+	return defaultHeartbeatInterval
+}
+
+// validateRebalanceTimeout checks that the rebalance timeout of a consumer group
+// member is not shorter than its session timeout, the coordinator would
+// otherwise evict members which are still alive during rebalances.
+func validateRebalanceTimeout(sessionTimeout, rebalanceTimeout time.Duration) error {
+	if rebalanceTimeout < sessionTimeout {
+		return errors.New(fmt.Sprintf("RebalanceTimeout of %s must be greater than or equal to the SessionTimeout of %s", rebalanceTimeout, sessionTimeout))
+	}
+	return nil
+}
+
 // PartitionAssignment represents the starting state of a partition that has
 // been assigned to a consumer.
 type PartitionAssignment struct {
@@ -316,6 +410,11 @@ type Generation struct {
 	// coordinator.
 	MemberID string
 
+	// IsLeader is true if this consumer was elected leader of the consumer
+	// group for this generation, in which case it computed the partition
+	// assignments of all members.
+	IsLeader bool
+
 	// Assignments is the initial state of this Generation.  The partition
 	// assignments are grouped by topic.
 	Assignments map[string][]PartitionAssignment
@@ -335,8 +434,7 @@ type Generation struct {
 	joined   chan struct{}
 
 	retentionMillis int64
-	log             func(func(Logger))
-	logError        func(func(Logger))
+	log             logger
 }
 
 // close stops the generation and waits for all functions launched via Start to
@@ -416,6 +514,13 @@ func (g *Generation) Start(fn func(ctx context.Context)) {
 // consumer group coordinator.  This can be used to reset the consumer to
 // explicit offsets.
 func (g *Generation) CommitOffsets(offsets map[string]map[int]int64) error {
+	return g.CommitOffsetsWithMetadata(offsets, "")
+}
+
+// CommitOffsetsWithMetadata is like CommitOffsets but attaches the metadata
+// string to each of the committed offsets. The metadata is returned with the
+// offsets by OffsetFetch requests.
+func (g *Generation) CommitOffsetsWithMetadata(offsets map[string]map[int]int64, metadata string) error {
 	if len(offsets) == 0 {
 		return nil
 	}
@@ -427,6 +532,7 @@ func (g *Generation) CommitOffsets(offsets map[string]map[int]int64) error {
 			t.Partitions = append(t.Partitions, offsetCommitRequestV2Partition{
 				Partition: int32(partition),
 				Offset:    offset,
+				Metadata:  metadata,
 			})
 		}
 		topics = append(topics, t)
@@ -443,16 +549,18 @@ func (g *Generation) CommitOffsets(offsets map[string]map[int]int64) error {
 	_, err := g.conn.offsetCommit(request)
 	if err == nil {
 		// if logging is enabled, print out the partitions that were committed.
-		g.log(func(l Logger) {
-			var report []string
+		var report []string
+		if g.log.logger != nil {
 			for _, t := range request.Topics {
 				report = append(report, fmt.Sprintf("\ttopic: %s", t.Topic))
 				for _, p := range t.Partitions {
 					report = append(report, fmt.Sprintf("\t\tpartition %d: %d", p.Partition, p.Offset))
 				}
 			}
-			l.Printf("committed offsets for group %s: \n%s", g.GroupID, strings.Join(report, "\n"))
-		})
+		}
+		g.log.debug(context.Background(), "committed offsets",
+			logAttrs{"group", g.GroupID, "generation", g.ID, "offsets", offsets},
+			"committed offsets for group %s: \n%s", g.GroupID, strings.Join(report, "\n"))
 	}
 
 	return err
@@ -463,12 +571,10 @@ func (g *Generation) CommitOffsets(offsets map[string]map[int]int64) error {
 // end of the generation.
 func (g *Generation) heartbeatLoop(interval time.Duration) {
 	g.Start(func(ctx context.Context) {
-		g.log(func(l Logger) {
-			l.Printf("started heartbeat for group, %v [%v]", g.GroupID, interval)
-		})
-		defer g.log(func(l Logger) {
-			l.Printf("stopped heartbeat for group %s\n", g.GroupID)
-		})
+		g.log.debug(ctx, "started heartbeat", logAttrs{"group", g.GroupID, "generation", g.ID, "interval", interval},
+			"started heartbeat for group, %v [%v]", g.GroupID, interval)
+		defer g.log.debug(ctx, "stopped heartbeat", logAttrs{"group", g.GroupID, "generation", g.ID},
+			"stopped heartbeat for group %s\n", g.GroupID)
 
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -499,21 +605,19 @@ func (g *Generation) heartbeatLoop(interval time.Duration) {
 // establish a new connection to the coordinator.
 func (g *Generation) partitionWatcher(interval time.Duration, topic string) {
 	g.Start(func(ctx context.Context) {
-		g.log(func(l Logger) {
-			l.Printf("started partition watcher for group, %v, topic %v [%v]", g.GroupID, topic, interval)
-		})
-		defer g.log(func(l Logger) {
-			l.Printf("stopped partition watcher for group, %v, topic %v", g.GroupID, topic)
-		})
+		g.log.debug(ctx, "started partition watcher", logAttrs{"group", g.GroupID, "generation", g.ID, "topic", topic, "interval", interval},
+			"started partition watcher for group, %v, topic %v [%v]", g.GroupID, topic, interval)
+		defer g.log.debug(ctx, "stopped partition watcher", logAttrs{"group", g.GroupID, "generation", g.ID, "topic", topic},
+			"stopped partition watcher for group, %v, topic %v", g.GroupID, topic)
 
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		ops, err := g.conn.readPartitions(topic)
 		if err != nil {
-			g.logError(func(l Logger) {
-				l.Printf("Problem getting partitions during startup, %v\n, Returning and setting up nextGeneration", err)
-			})
+			g.log.error(ctx, "problem getting partitions during startup, setting up the next generation",
+				logAttrs{"group", g.GroupID, "generation", g.ID, "topic", topic, "error", err},
+				"Problem getting partitions during startup, %v\n, Returning and setting up nextGeneration", err)
 			return
 		}
 		oParts := len(ops)
@@ -526,15 +630,15 @@ func (g *Generation) partitionWatcher(interval time.Duration, topic string) {
 				switch err {
 				case nil, UnknownTopicOrPartition:
 					if len(ops) != oParts {
-						g.log(func(l Logger) {
-							l.Printf("Partition changes found, reblancing group: %v.", g.GroupID)
-						})
+						g.log.debug(ctx, "partition changes found, rebalancing",
+							logAttrs{"group", g.GroupID, "generation", g.ID, "topic", topic},
+							"Partition changes found, reblancing group: %v.", g.GroupID)
 						return
 					}
 				default:
-					g.logError(func(l Logger) {
-						l.Printf("Problem getting partitions while checking for changes, %v", err)
-					})
+					g.log.error(ctx, "problem getting partitions while checking for changes",
+						logAttrs{"group", g.GroupID, "generation", g.ID, "topic", topic, "error", err},
+						"Problem getting partitions while checking for changes, %v", err)
 					if _, ok := err.(Error); ok {
 						continue
 					}
@@ -710,6 +814,12 @@ func (cg *ConsumerGroup) Next(ctx context.Context) (*Generation, error) {
 }
 
 func (cg *ConsumerGroup) run() {
+	if cg.config.GroupProtocol == GroupProtocolConsumer {
+		if !cg.runConsumerProtocol() {
+			return
+		}
+	}
+
 	// the memberID is the only piece of information that is maintained across
 	// generations.  it starts empty and will be assigned on the first nextGeneration
 	// when the joinGroup request is processed.  it may change again later if
@@ -776,36 +886,36 @@ func (cg *ConsumerGroup) nextGeneration(memberID string) (string, error) {
 	// conditions.
 	conn, err := cg.coordinator()
 	if err != nil {
-		cg.withErrorLogger(func(log Logger) {
-			log.Printf("Unable to establish connection to consumer group coordinator for group %s: %v", cg.config.ID, err)
-		})
+		cg.log().error(context.Background(), "unable to establish connection to consumer group coordinator",
+			logAttrs{"group", cg.config.ID, "error", err},
+			"Unable to establish connection to consumer group coordinator for group %s: %v", cg.config.ID, err)
 		return memberID, err // a prior memberID may still be valid, so don't return ""
 	}
 	defer conn.Close()
 
 	var generationID int32
+	var isLeader bool
+	var balancer GroupBalancer
 	var groupAssignments GroupMemberAssignments
 	var assignments map[string][]int32
 
 	// join group.  this will join the group and prepare assignments if our
 	// consumer is elected leader.  it may also change or assign the member ID.
-	memberID, generationID, groupAssignments, err = cg.joinGroup(conn, memberID)
+	memberID, generationID, isLeader, balancer, groupAssignments, err = cg.joinGroup(conn, memberID)
 	if err != nil {
-		cg.withErrorLogger(func(log Logger) {
-			log.Printf("Failed to join group %s: %v", cg.config.ID, err)
-		})
+		cg.log().error(context.Background(), "failed to join group", logAttrs{"group", cg.config.ID, "error", err},
+			"Failed to join group %s: %v", cg.config.ID, err)
 		return memberID, err
 	}
-	cg.withLogger(func(log Logger) {
-		log.Printf("Joined group %s as member %s in generation %d", cg.config.ID, memberID, generationID)
-	})
+	cg.log().debug(context.Background(), "joined group", logAttrs{"group", cg.config.ID, "member", memberID, "generation", generationID},
+		"Joined group %s as member %s in generation %d", cg.config.ID, memberID, generationID)
 
 	// sync group
-	assignments, err = cg.syncGroup(conn, memberID, generationID, groupAssignments)
+	assignments, err = cg.syncGroup(conn, memberID, generationID, balancer, groupAssignments)
 	if err != nil {
-		cg.withErrorLogger(func(log Logger) {
-			log.Printf("Failed to sync group %s: %v", cg.config.ID, err)
-		})
+		cg.log().error(context.Background(), "failed to sync group",
+			logAttrs{"group", cg.config.ID, "member", memberID, "generation", generationID, "error", err},
+			"Failed to sync group %s: %v", cg.config.ID, err)
 		return memberID, err
 	}
 
@@ -813,9 +923,9 @@ func (cg *ConsumerGroup) nextGeneration(memberID string) (string, error) {
 	var offsets map[string]map[int]int64
 	offsets, err = cg.fetchOffsets(conn, assignments)
 	if err != nil {
-		cg.withErrorLogger(func(log Logger) {
-			log.Printf("Failed to fetch offsets for group %s: %v", cg.config.ID, err)
-		})
+		cg.log().error(context.Background(), "failed to fetch offsets",
+			logAttrs{"group", cg.config.ID, "member", memberID, "generation", generationID, "error", err},
+			"Failed to fetch offsets for group %s: %v", cg.config.ID, err)
 		return memberID, err
 	}
 
@@ -824,13 +934,13 @@ func (cg *ConsumerGroup) nextGeneration(memberID string) (string, error) {
 		ID:              generationID,
 		GroupID:         cg.config.ID,
 		MemberID:        memberID,
+		IsLeader:        isLeader,
 		Assignments:     cg.makeAssignments(assignments, offsets),
 		conn:            conn,
 		done:            make(chan struct{}),
 		joined:          make(chan struct{}),
 		retentionMillis: int64(cg.config.RetentionTime / time.Millisecond),
-		log:             cg.withLogger,
-		logError:        cg.withErrorLogger,
+		log:             cg.log(),
 	}
 
 	// spawn all of the go routines required to facilitate this generation.  if
@@ -915,8 +1025,10 @@ func (cg *ConsumerGroup) coordinator() (coordinator, error) {
 }
 
 // joinGroup attempts to join the reader to the consumer group.
-// Returns GroupMemberAssignments is this Reader was selected as
-// the leader.  Otherwise, GroupMemberAssignments will be nil.
+// Returns true and the GroupMemberAssignments if this Reader was
+// selected as the leader.  Otherwise, GroupMemberAssignments will be nil.
+// The returned GroupBalancer is the one selected by the coordinator
+// for this generation, or nil if none of the configured balancers match.
 //
 // Possible kafka error codes returned:
 //  * GroupLoadInProgress:
@@ -925,49 +1037,54 @@ func (cg *ConsumerGroup) coordinator() (coordinator, error) {
 //  * InconsistentGroupProtocol:
 //  * InvalidSessionTimeout:
 //  * GroupAuthorizationFailed:
-func (cg *ConsumerGroup) joinGroup(conn coordinator, memberID string) (string, int32, GroupMemberAssignments, error) {
+func (cg *ConsumerGroup) joinGroup(conn coordinator, memberID string) (string, int32, bool, GroupBalancer, GroupMemberAssignments, error) {
 	request, err := cg.makeJoinGroupRequestV1(memberID)
 	if err != nil {
-		return "", 0, nil, err
+		return "", 0, false, nil, nil, err
 	}
 
 	response, err := conn.joinGroup(request)
 	if err == nil && response.ErrorCode != 0 {
 		err = Error(response.ErrorCode)
 	}
+	if err == InvalidSessionTimeout {
+		err = fmt.Errorf("%w (SessionTimeout is %s, the range is set by group.min.session.timeout.ms and group.max.session.timeout.ms in the broker configuration, 6s and 30m by default)", err, cg.config.SessionTimeout)
+	}
 	if err != nil {
-		return "", 0, nil, err
+		return "", 0, false, nil, nil, err
 	}
 
 	memberID = response.MemberID
 	generationID := response.GenerationID
 
-	cg.withLogger(func(l Logger) {
-		l.Printf("joined group %s as member %s in generation %d", cg.config.ID, memberID, generationID)
-	})
+	cg.log().debug(context.Background(), "join group request succeeded",
+		logAttrs{"group", cg.config.ID, "member", memberID, "generation", generationID},
+		"joined group %s as member %s in generation %d", cg.config.ID, memberID, generationID)
 
 	var assignments GroupMemberAssignments
-	if iAmLeader := response.MemberID == response.LeaderID; iAmLeader {
+	iAmLeader := response.MemberID == response.LeaderID
+	if iAmLeader {
 		v, err := cg.assignTopicPartitions(conn, response)
 		if err != nil {
-			return memberID, 0, nil, err
+			return memberID, 0, false, nil, nil, err
 		}
 		assignments = v
 
-		cg.withLogger(func(l Logger) {
-			for memberID, assignment := range assignments {
-				for topic, partitions := range assignment {
-					l.Printf("assigned member/topic/partitions %v/%v/%v", memberID, topic, partitions)
-				}
+		for memberID, assignment := range assignments {
+			for topic, partitions := range assignment {
+				cg.log().debug(context.Background(), "assigned partitions",
+					logAttrs{"group", cg.config.ID, "generation", generationID, "member", memberID, "topic", topic, "partitions", partitions},
+					"assigned member/topic/partitions %v/%v/%v", memberID, topic, partitions)
 			}
-		})
+		}
 	}
 
-	cg.withLogger(func(l Logger) {
-		l.Printf("joinGroup succeeded for response, %v.  generationID=%v, memberID=%v", cg.config.ID, response.GenerationID, response.MemberID)
-	})
+	cg.log().debug(context.Background(), "joined group",
+		logAttrs{"group", cg.config.ID, "member", response.MemberID, "generation", response.GenerationID, "leader", iAmLeader},
+		"joinGroup succeeded for response, %v.  generationID=%v, memberID=%v", cg.config.ID, response.GenerationID, response.MemberID)
 
-	return memberID, generationID, assignments, nil
+	balancer, _ := findGroupBalancer(response.GroupProtocol, cg.config.GroupBalancers)
+	return memberID, generationID, iAmLeader, balancer, assignments, nil
 }
 
 // makeJoinGroupRequestV1 handles the logic of constructing a joinGroup
@@ -982,7 +1099,7 @@ func (cg *ConsumerGroup) makeJoinGroupRequestV1(memberID string) (joinGroupReque
 	}
 
 	for _, balancer := range cg.config.GroupBalancers {
-		userData, err := balancer.UserData()
+		userData, err := cg.userData(balancer)
 		if err != nil {
 			return joinGroupRequestV1{}, fmt.Errorf("unable to construct protocol metadata for member, %v: %v", balancer.ProtocolName(), err)
 		}
@@ -999,12 +1116,20 @@ func (cg *ConsumerGroup) makeJoinGroupRequestV1(memberID string) (joinGroupReque
 	return request, nil
 }
 
+// userData returns the user data of the subscription metadata sent for the
+// balancer in JoinGroup requests.
+func (cg *ConsumerGroup) userData(balancer GroupBalancer) ([]byte, error) {
+	if cg.config.GroupProtocolUserData != nil {
+		return cg.config.GroupProtocolUserData(balancer)
+	}
+	return balancer.UserData()
+}
+
 // assignTopicPartitions uses the selected GroupBalancer to assign members to
 // their various partitions
 func (cg *ConsumerGroup) assignTopicPartitions(conn coordinator, group joinGroupResponseV1) (GroupMemberAssignments, error) {
-	cg.withLogger(func(l Logger) {
-		l.Printf("selected as leader for group, %s\n", cg.config.ID)
-	})
+	cg.log().debug(context.Background(), "selected as leader", logAttrs{"group", cg.config.ID, "generation", group.GenerationID},
+		"selected as leader for group, %s\n", cg.config.ID)
 
 	balancer, ok := findGroupBalancer(group.GroupProtocol, cg.config.GroupBalancers)
 	if !ok {
@@ -1030,15 +1155,20 @@ func (cg *ConsumerGroup) assignTopicPartitions(conn coordinator, group joinGroup
 		return nil, err
 	}
 
-	cg.withLogger(func(l Logger) {
-		l.Printf("using '%v' balancer to assign group, %v", group.GroupProtocol, cg.config.ID)
-		for _, member := range members {
-			l.Printf("found member: %v/%#v", member.ID, member.UserData)
-		}
-		for _, partition := range partitions {
-			l.Printf("found topic/partition: %v/%v", partition.Topic, partition.ID)
-		}
-	})
+	log := cg.log()
+	log.debug(context.Background(), "assigning partitions",
+		logAttrs{"group", cg.config.ID, "generation", group.GenerationID, "balancer", group.GroupProtocol},
+		"using '%v' balancer to assign group, %v", group.GroupProtocol, cg.config.ID)
+	for _, member := range members {
+		log.debug(context.Background(), "found member",
+			logAttrs{"group", cg.config.ID, "generation", group.GenerationID, "member", member.ID, "user_data", member.UserData},
+			"found member: %v/%#v", member.ID, member.UserData)
+	}
+	for _, partition := range partitions {
+		log.debug(context.Background(), "found partition",
+			logAttrs{"group", cg.config.ID, "generation", group.GenerationID, "topic", partition.Topic, "partition", partition.ID},
+			"found topic/partition: %v/%v", partition.Topic, partition.ID)
+	}
 
 	return balancer.AssignGroups(members, partitions), nil
 }
@@ -1072,8 +1202,19 @@ func (cg *ConsumerGroup) makeMemberProtocolMetadata(in []joinGroupResponseMember
 //  * IllegalGeneration:
 //  * RebalanceInProgress:
 //  * GroupAuthorizationFailed:
-func (cg *ConsumerGroup) syncGroup(conn coordinator, memberID string, generationID int32, memberAssignments GroupMemberAssignments) (map[string][]int32, error) {
-	request := cg.makeSyncGroupRequestV0(memberID, generationID, memberAssignments)
+func (cg *ConsumerGroup) syncGroup(conn coordinator, memberID string, generationID int32, balancer GroupBalancer, memberAssignments GroupMemberAssignments) (map[string][]int32, error) {
+	userDataBalancer, _ := balancer.(AssignmentUserDataBalancer)
+
+	var memberUserData map[string][]byte
+	if userDataBalancer != nil && memberAssignments != nil {
+		userData, err := userDataBalancer.AssignmentUserData(memberAssignments)
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct assignment user data, %v: %v", balancer.ProtocolName(), err)
+		}
+		memberUserData = userData
+	}
+
+	request := cg.makeSyncGroupRequestV0(memberID, generationID, memberAssignments, memberUserData)
 	response, err := conn.syncGroup(request)
 	if err == nil && response.ErrorCode != 0 {
 		err = Error(response.ErrorCode)
@@ -1089,19 +1230,30 @@ func (cg *ConsumerGroup) syncGroup(conn coordinator, memberID string, generation
 	}
 
 	if len(assignments.Topics) == 0 {
-		cg.withLogger(func(l Logger) {
-			l.Printf("received empty assignments for group, %v as member %s for generation %d", cg.config.ID, memberID, generationID)
-		})
+		cg.log().debug(context.Background(), "received empty assignments",
+			logAttrs{"group", cg.config.ID, "member", memberID, "generation", generationID},
+			"received empty assignments for group, %v as member %s for generation %d", cg.config.ID, memberID, generationID)
 	}
 
-	cg.withLogger(func(l Logger) {
-		l.Printf("sync group finished for group, %v", cg.config.ID)
-	})
+	cg.log().debug(context.Background(), "sync group finished",
+		logAttrs{"group", cg.config.ID, "member", memberID, "generation", generationID},
+		"sync group finished for group, %v", cg.config.ID)
+
+	if userDataBalancer != nil {
+		assignment := make(map[string][]int, len(assignments.Topics))
+		for topic, partitions := range assignments.Topics {
+			assignment[topic] = make([]int, len(partitions))
+			for i, partition := range partitions {
+				assignment[topic][i] = int(partition)
+			}
+		}
+		userDataBalancer.OnAssignment(memberID, generationID, assignment, assignments.UserData)
+	}
 
 	return assignments.Topics, nil
 }
 
-func (cg *ConsumerGroup) makeSyncGroupRequestV0(memberID string, generationID int32, memberAssignments GroupMemberAssignments) syncGroupRequestV0 {
+func (cg *ConsumerGroup) makeSyncGroupRequestV0(memberID string, generationID int32, memberAssignments GroupMemberAssignments, memberUserData map[string][]byte) syncGroupRequestV0 {
 	request := syncGroupRequestV0{
 		GroupID:      cg.config.ID,
 		GenerationID: generationID,
@@ -1123,15 +1275,16 @@ func (cg *ConsumerGroup) makeSyncGroupRequestV0(memberID string, generationID in
 			request.GroupAssignments = append(request.GroupAssignments, syncGroupRequestGroupAssignmentV0{
 				MemberID: memberID,
 				MemberAssignments: groupAssignment{
-					Version: 1,
-					Topics:  topics32,
+					Version:  1,
+					Topics:   topics32,
+					UserData: memberUserData[memberID],
 				}.bytes(),
 			})
 		}
 
-		cg.withLogger(func(logger Logger) {
-			logger.Printf("Syncing %d assignments for generation %d as member %s", len(request.GroupAssignments), generationID, memberID)
-		})
+		cg.log().debug(context.Background(), "syncing assignments",
+			logAttrs{"group", cg.config.ID, "member", memberID, "generation", generationID, "assignments", len(request.GroupAssignments)},
+			"Syncing %d assignments for generation %d as member %s", len(request.GroupAssignments), generationID, memberID)
 	}
 
 	return request
@@ -1202,9 +1355,8 @@ func (cg *ConsumerGroup) leaveGroup(memberID string) error {
 		return nil
 	}
 
-	cg.withLogger(func(log Logger) {
-		log.Printf("Leaving group %s, member %s", cg.config.ID, memberID)
-	})
+	cg.log().debug(context.Background(), "leaving group", logAttrs{"group", cg.config.ID, "member", memberID},
+		"Leaving group %s, member %s", cg.config.ID, memberID)
 
 	// IMPORTANT : leaveGroup establishes its own connection to the coordinator
 	//             because it is often called after some other operation failed.
@@ -1221,9 +1373,8 @@ func (cg *ConsumerGroup) leaveGroup(memberID string) error {
 		MemberID: memberID,
 	})
 	if err != nil {
-		cg.withErrorLogger(func(log Logger) {
-			log.Printf("leave group failed for group, %v, and member, %v: %v", cg.config.ID, memberID, err)
-		})
+		cg.log().error(context.Background(), "leave group failed", logAttrs{"group", cg.config.ID, "member", memberID, "error", err},
+			"leave group failed for group, %v, and member, %v: %v", cg.config.ID, memberID, err)
 	}
 
 	_ = coordinator.Close()
@@ -1231,16 +1382,10 @@ func (cg *ConsumerGroup) leaveGroup(memberID string) error {
 	return err
 }
 
-func (cg *ConsumerGroup) withLogger(do func(Logger)) {
-	if cg.config.Logger != nil {
-		do(cg.config.Logger)
-	}
-}
-
-func (cg *ConsumerGroup) withErrorLogger(do func(Logger)) {
-	if cg.config.ErrorLogger != nil {
-		do(cg.config.ErrorLogger)
-	} else {
-		cg.withLogger(do)
+func (cg *ConsumerGroup) log() logger {
+	return logger{
+		logger:      cg.config.Logger,
+		errorLogger: cg.config.ErrorLogger,
+		structured:  cg.config.StructuredLogger,
 	}
 }
@@ -3,11 +3,15 @@ package kafka
 import (
 	"context"
 	"errors"
+	"net"
 	"reflect"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
+
+	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
 var _ coordinator = mockCoordinator{}
@@ -104,6 +108,13 @@ func TestValidateConsumerGroupConfig(t *testing.T) {
 		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", HeartbeatInterval: 2, SessionTimeout: 2, RebalanceTimeout: 2, RetentionTime: 1, PartitionWatchInterval: -1}, errorOccured: true},
 		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", HeartbeatInterval: 2, SessionTimeout: 2, RebalanceTimeout: 2, RetentionTime: 1, PartitionWatchInterval: 1, JoinGroupBackoff: -1}, errorOccured: true},
 		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", HeartbeatInterval: 2, SessionTimeout: 2, RebalanceTimeout: 2, RetentionTime: 1, PartitionWatchInterval: 1, JoinGroupBackoff: 1}, errorOccured: false},
+		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", HeartbeatInterval: 2 * time.Second, SessionTimeout: 10 * time.Second, RebalanceTimeout: 2 * time.Second}, errorOccured: true},
+		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", HeartbeatInterval: 2 * time.Second, RebalanceTimeout: 2 * time.Second}, errorOccured: false},
+		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", SessionTimeout: 45 * time.Second}, errorOccured: false},
+		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1"}, errorOccured: false},
+		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", SessionTimeout: 6 * time.Second}, errorOccured: false},
+		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", HeartbeatInterval: 10 * time.Second}, errorOccured: false},
+		{config: ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", HeartbeatInterval: 10 * time.Second, SessionTimeout: 6 * time.Second}, errorOccured: true},
 	}
 	for _, test := range tests {
 		err := test.config.Validate()
@@ -116,6 +127,26 @@ func TestValidateConsumerGroupConfig(t *testing.T) {
 	}
 }
 
+func TestConsumerGroupConfigDefaultHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		sessionTimeout    time.Duration
+		heartbeatInterval time.Duration
+	}{
+		{sessionTimeout: 0, heartbeatInterval: 3 * time.Second},
+		{sessionTimeout: 45 * time.Second, heartbeatInterval: 3 * time.Second},
+		{sessionTimeout: 6 * time.Second, heartbeatInterval: 2 * time.Second},
+	}
+	for _, test := range tests {
+		config := ConsumerGroupConfig{Brokers: []string{"broker1"}, Topics: []string{"t1"}, ID: "group1", SessionTimeout: test.sessionTimeout}
+		if err := config.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if config.HeartbeatInterval != test.heartbeatInterval {
+			t.Errorf("expected a heartbeat interval of %s for a session timeout of %s, got %s", test.heartbeatInterval, test.sessionTimeout, config.HeartbeatInterval)
+		}
+	}
+}
+
 func TestReaderAssignTopicPartitions(t *testing.T) {
 	conn := &mockCoordinator{
 		readPartitionsFunc: func(...string) ([]Partition, error) {
@@ -234,6 +265,119 @@ func TestReaderAssignTopicPartitions(t *testing.T) {
 	}
 }
 
+type userDataTestBalancer struct {
+	RangeGroupBalancer
+	memberID     string
+	generationID int32
+	assignment   map[string][]int
+	userData     []byte
+}
+
+func (b *userDataTestBalancer) AssignmentUserData(assignments GroupMemberAssignments) (map[string][]byte, error) {
+	userData := make(map[string][]byte, len(assignments))
+	for memberID := range assignments {
+		userData[memberID] = []byte("state-of-" + memberID)
+	}
+	return userData, nil
+}
+
+func (b *userDataTestBalancer) OnAssignment(memberID string, generationID int32, assignment map[string][]int, userData []byte) {
+	b.memberID, b.generationID, b.assignment, b.userData = memberID, generationID, assignment, userData
+}
+
+func TestConsumerGroupAssignmentUserData(t *testing.T) {
+	conn := mockCoordinator{
+		syncGroupFunc: func(req syncGroupRequestV0) (syncGroupResponseV0, error) {
+			// act as the coordinator and return the assignment that the leader
+			// computed for itself.
+			for _, assignment := range req.GroupAssignments {
+				if assignment.MemberID == req.MemberID {
+					return syncGroupResponseV0{MemberAssignments: assignment.MemberAssignments}, nil
+				}
+			}
+			return syncGroupResponseV0{}, nil
+		},
+	}
+
+	balancer := &userDataTestBalancer{}
+	cg := ConsumerGroup{}
+	cg.config.ID = "group-1"
+	cg.config.GroupBalancers = []GroupBalancer{balancer}
+	cg.config.Logger = newTestKafkaLogger(t, "")
+
+	assignments := GroupMemberAssignments{
+		"member-1": {"topic-1": {0, 1}},
+		"member-2": {"topic-1": {2}},
+	}
+
+	topics, err := cg.syncGroup(conn, "member-1", 42, balancer, assignments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(topics, map[string][]int32{"topic-1": {0, 1}}) {
+		t.Errorf("unexpected assignment: %v", topics)
+	}
+
+	if balancer.memberID != "member-1" || balancer.generationID != 42 {
+		t.Errorf("unexpected member or generation: %s/%d", balancer.memberID, balancer.generationID)
+	}
+
+	if !reflect.DeepEqual(balancer.assignment, assignments["member-1"]) {
+		t.Errorf("unexpected assignment passed to OnAssignment: %v", balancer.assignment)
+	}
+
+	if string(balancer.userData) != "state-of-member-1" {
+		t.Errorf("unexpected user data: %q", balancer.userData)
+	}
+}
+
+func TestConsumerGroupProtocolUserData(t *testing.T) {
+	cg := ConsumerGroup{}
+	cg.config.ID = "group-1"
+	cg.config.Topics = []string{"topic-1"}
+	cg.config.GroupBalancers = []GroupBalancer{RangeGroupBalancer{}, RackAffinityGroupBalancer{Rack: "rack-1"}}
+	cg.config.GroupProtocolUserData = func(balancer GroupBalancer) ([]byte, error) {
+		if _, ok := balancer.(RangeGroupBalancer); ok {
+			return []byte("capacity=4"), nil
+		}
+		return balancer.UserData()
+	}
+
+	request, err := cg.makeJoinGroupRequestV1("member-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		RangeGroupBalancer{}.ProtocolName():        "capacity=4",
+		RackAffinityGroupBalancer{}.ProtocolName(): "rack-1",
+	}
+
+	for _, protocol := range request.GroupProtocols {
+		members, err := cg.makeMemberProtocolMetadata([]joinGroupResponseMemberV1{
+			{MemberID: "member-1", MemberMetadata: protocol.ProtocolMetadata},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(members[0].Topics, cg.config.Topics) {
+			t.Errorf("unexpected topics for %s: %v", protocol.ProtocolName, members[0].Topics)
+		}
+		if userData := string(members[0].UserData); userData != want[protocol.ProtocolName] {
+			t.Errorf("unexpected user data for %s: %q", protocol.ProtocolName, userData)
+		}
+	}
+
+	cg.config.GroupProtocolUserData = func(GroupBalancer) ([]byte, error) {
+		return nil, errors.New("no capacity")
+	}
+
+	if _, err := cg.makeJoinGroupRequestV1("member-1"); err == nil {
+		t.Error("expected an error when the user data could not be provided")
+	}
+}
+
 func TestConsumerGroup(t *testing.T) {
 	tests := []struct {
 		scenario string
@@ -469,6 +613,40 @@ func TestConsumerGroupErrors(t *testing.T) {
 			},
 		},
 
+		{
+			scenario: "fails to join group (invalid session timeout)",
+			prepare: func(mc *mockCoordinator) {
+				mc.findCoordinatorFunc = func(findCoordinatorRequestV0) (findCoordinatorResponseV0, error) {
+					return findCoordinatorResponseV0{
+						Coordinator: findCoordinatorResponseCoordinatorV0{
+							NodeID: 1,
+							Host:   "foo.bar.com",
+							Port:   12345,
+						},
+					}, nil
+				}
+				mc.joinGroupFunc = func(joinGroupRequestV1) (joinGroupResponseV1, error) {
+					return joinGroupResponseV1{
+						ErrorCode: int16(InvalidSessionTimeout),
+					}, nil
+				}
+				// NOTE : no stub for leaving the group b/c the member never joined.
+			},
+			function: func(t *testing.T, ctx context.Context, group *ConsumerGroup) {
+				gen, err := group.Next(ctx)
+				if err == nil {
+					t.Errorf("expected an error")
+				} else if !errors.Is(err, InvalidSessionTimeout) {
+					t.Errorf("got wrong error: %+v", err)
+				} else if !strings.Contains(err.Error(), "group.min.session.timeout.ms") {
+					t.Errorf("expected the error to explain the broker bounds: %v", err)
+				}
+				if gen != nil {
+					t.Error("expected a nil consumer group generation")
+				}
+			},
+		},
+
 		{
 			scenario: "fails to join group (leader, unsupported protocol)",
 			prepare: func(mc *mockCoordinator) {
@@ -628,11 +806,9 @@ func TestGenerationExitsOnPartitionChange(t *testing.T) {
 	watchTime := 500 * time.Millisecond
 
 	gen := Generation{
-		conn:     conn,
-		done:     make(chan struct{}),
-		joined:   make(chan struct{}),
-		log:      func(func(Logger)) {},
-		logError: func(func(Logger)) {},
+		conn:   conn,
+		done:   make(chan struct{}),
+		joined: make(chan struct{}),
 	}
 
 	done := make(chan struct{})
@@ -653,11 +829,9 @@ func TestGenerationExitsOnPartitionChange(t *testing.T) {
 
 func TestGenerationStartsFunctionAfterClosed(t *testing.T) {
 	gen := Generation{
-		conn:     &mockCoordinator{},
-		done:     make(chan struct{}),
-		joined:   make(chan struct{}),
-		log:      func(func(Logger)) {},
-		logError: func(func(Logger)) {},
+		conn:   &mockCoordinator{},
+		done:   make(chan struct{}),
+		joined: make(chan struct{}),
 	}
 
 	gen.close()
@@ -677,3 +851,207 @@ func TestGenerationStartsFunctionAfterClosed(t *testing.T) {
 		}
 	}
 }
+
+func TestConsumerGroupProtocolConsumer(t *testing.T) {
+	broker := &ktesting.Broker{ConsumerGroupHeartbeatInterval: 50 * time.Millisecond}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 4); err != nil {
+		t.Fatal(err)
+	}
+
+	newGroup := func() *ConsumerGroup {
+		cg, err := NewConsumerGroup(ConsumerGroupConfig{
+			ID:            "group-A",
+			Brokers:       []string{"localhost:9092"},
+			Topics:        []string{"topic-A"},
+			Dialer:        &Dialer{DialFunc: broker.Dial},
+			GroupProtocol: GroupProtocolConsumer,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cg
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// next waits for a generation of the group which was assigned the given
+	// number of partitions.
+	next := func(cg *ConsumerGroup, numPartitions int) (*Generation, []int) {
+		for {
+			gen, err := cg.Next(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var partitions []int
+			for _, p := range gen.Assignments["topic-A"] {
+				partitions = append(partitions, p.ID)
+			}
+			if len(partitions) == numPartitions {
+				return gen, partitions
+			}
+		}
+	}
+
+	cg1 := newGroup()
+	defer cg1.Close()
+
+	gen, partitions := next(cg1, 4)
+	if !reflect.DeepEqual(partitions, []int{0, 1, 2, 3}) {
+		t.Errorf("unexpected partitions assigned to the only member of the group: %v", partitions)
+	}
+	if err := gen.CommitOffsets(map[string]map[int]int64{"topic-A": {0: 10, 3: 20}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cg2 := newGroup()
+	defer cg2.Close()
+
+	// The first member releases half of its partitions, which are then
+	// assigned to the second member.
+	gen1, partitions1 := next(cg1, 2)
+	gen2, partitions2 := next(cg2, 2)
+
+	if !reflect.DeepEqual(partitions1, []int{0, 1}) || !reflect.DeepEqual(partitions2, []int{2, 3}) {
+		t.Errorf("unexpected partitions assigned to the members of the group: %v and %v", partitions1, partitions2)
+	}
+	if gen1.MemberID == gen2.MemberID {
+		t.Errorf("members of the group have the same ID: %s", gen1.MemberID)
+	}
+	if offset := gen1.Assignments["topic-A"][0].Offset; offset != 10 {
+		t.Errorf("unexpected offset of partition 0: %d", offset)
+	}
+	if offset := gen2.Assignments["topic-A"][1].Offset; offset != 20 {
+		t.Errorf("unexpected offset of partition 3: %d", offset)
+	}
+
+	if err := gen2.CommitOffsets(map[string]map[int]int64{"topic-A": {2: 30}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumerGroupProtocolHeartbeatError(t *testing.T) {
+	broker := &ktesting.Broker{ConsumerGroupHeartbeatInterval: 50 * time.Millisecond}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mutex   sync.Mutex
+		failing bool
+		conns   []net.Conn
+	)
+
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failing {
+			return nil, syscall.ECONNREFUSED
+		}
+		conn, err := broker.Dial(ctx, network, address)
+		if err == nil {
+			conns = append(conns, conn)
+		}
+		return conn, err
+	}
+
+	cg, err := NewConsumerGroup(ConsumerGroupConfig{
+		ID:               "group-A",
+		Brokers:          []string{"localhost:9092"},
+		Topics:           []string{"topic-A"},
+		Dialer:           &Dialer{DialFunc: dial},
+		GroupProtocol:    GroupProtocolConsumer,
+		JoinGroupBackoff: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cg.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gen, err := cg.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Break the connections to the group coordinator so the heartbeats fail.
+	mutex.Lock()
+	failing = true
+	for _, conn := range conns {
+		conn.Close()
+	}
+	conns = nil
+	mutex.Unlock()
+
+	if _, err := cg.Next(ctx); err == nil {
+		t.Fatal("expected the heartbeat error to be reported")
+	}
+
+	mutex.Lock()
+	failing = false
+	mutex.Unlock()
+
+	// Drain the errors reported before the connections were restored, the
+	// member must not be assigned a new generation.
+	for {
+		ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		next, err := cg.Next(ctx)
+		cancel()
+		if next != nil {
+			t.Fatalf("unexpected generation %d after a transient heartbeat error", next.ID)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+	}
+
+	select {
+	case <-gen.done:
+		t.Fatal("the generation was ended by a transient heartbeat error")
+	default:
+	}
+
+	if err := gen.CommitOffsets(map[string]map[int]int64{"topic-A": {0: 10}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumerGroupProtocolFallback(t *testing.T) {
+	broker := &ktesting.Broker{DisableConsumerGroupProtocol: true}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	cg, err := NewConsumerGroup(ConsumerGroupConfig{
+		ID:            "group-A",
+		Brokers:       []string{"localhost:9092"},
+		Topics:        []string{"topic-A"},
+		Dialer:        &Dialer{DialFunc: broker.Dial},
+		GroupProtocol: GroupProtocolConsumer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cg.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	gen, err := cg.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the classic protocol elects a group leader.
+	if !gen.IsLeader || len(gen.Assignments["topic-A"]) != 2 {
+		t.Errorf("unexpected generation after falling back to the classic protocol: %+v", gen)
+	}
+}
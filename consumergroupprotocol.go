@@ -0,0 +1,534 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/consumergroupheartbeat"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+)
+
+// GroupProtocol represents the protocol used by the members of a consumer
+// group to coordinate the assignment of partitions.
+type GroupProtocol int
+
+const (
+	// GroupProtocolClassic is the protocol where members join the group, the
+	// group leader computes the partition assignments with one of the
+	// configured GroupBalancers, and distributes them to the other members.
+	// Every change of membership causes all members to stop consuming until
+	// the group has rebalanced.
+	GroupProtocolClassic GroupProtocol = iota
+
+	// GroupProtocolConsumer is the consumer group protocol introduced by
+	// KIP-848, where the broker computes the partition assignments and members
+	// acknowledge them with periodic ConsumerGroupHeartbeat requests. Changes
+	// of membership are applied incrementally, only the members that are
+	// losing or gaining partitions are affected.
+	//
+	// The protocol requires Kafka 4.0+, the consumer group falls back to the
+	// classic protocol when the brokers do not support it.
+	GroupProtocolConsumer
+)
+
+func (p GroupProtocol) String() string {
+	switch p {
+	case GroupProtocolClassic:
+		return "classic"
+	case GroupProtocolConsumer:
+		return "consumer"
+	default:
+		return fmt.Sprintf("GroupProtocol(%d)", int(p))
+	}
+}
+
+// errConsumerProtocolUnsupportedOp is returned by the coordinator of
+// generations of groups using the consumer protocol for operations that only
+// exist in the classic protocol.
+var errConsumerProtocolUnsupportedOp = errors.New("operation not supported by consumer groups using the consumer protocol")
+
+// consumerGroupMember holds the state of a member of a group using the
+// consumer protocol, which is carried across generations.
+type consumerGroupMember struct {
+	cg     *ConsumerGroup
+	client *Client
+
+	memberID string
+	// epoch is read by the coordinator of the generations when committing
+	// offsets, which happens concurrently with heartbeats, so it must be
+	// accessed atomically.
+	epoch int32
+
+	// assignment is the set of partitions owned by the member, it is nil until
+	// the broker assigned partitions to the member.
+	assignment map[string][]int32
+
+	topicIDs   map[string]protocol.UUID
+	topicNames map[protocol.UUID]string
+}
+
+// runConsumerProtocol runs the consumer group with the consumer protocol. It
+// returns true if the brokers do not support the protocol and the group must
+// fall back to the classic protocol, or false when the group is closed.
+func (cg *ConsumerGroup) runConsumerProtocol() bool {
+	transport := cg.config.Dialer.transport(0, 0, func(time.Duration) {})
+	defer transport.CloseIdleConnections()
+
+	m := &consumerGroupMember{
+		cg: cg,
+		client: &Client{
+			Addr:      TCP(cg.config.Brokers...),
+			Timeout:   cg.config.Timeout,
+			Transport: transport,
+		},
+		topicIDs:   make(map[string]protocol.UUID),
+		topicNames: make(map[protocol.UUID]string),
+	}
+
+	for {
+		supported, err := m.supported()
+		if err == nil {
+			if !supported {
+				cg.log().debug(context.Background(), "brokers do not support the consumer group protocol, falling back to the classic protocol",
+					logAttrs{"group", cg.config.ID},
+					"Brokers do not support the consumer group protocol, group %s falls back to the classic protocol", cg.config.ID)
+				return true
+			}
+			break
+		}
+		if !cg.reportError(err, cg.config.JoinGroupBackoff) {
+			return false
+		}
+	}
+
+	var gen *Generation
+	interval := cg.config.HeartbeatInterval
+
+	for {
+		res, err := m.heartbeat()
+
+		switch {
+		case err == nil:
+			m.memberID = res.MemberID
+			atomic.StoreInt32(&m.epoch, res.MemberEpoch)
+			if res.HeartbeatIntervalMs > 0 {
+				interval = time.Duration(res.HeartbeatIntervalMs) * time.Millisecond
+			}
+
+		case errors.Is(err, UnsupportedVersion) && m.assignment == nil:
+			// Brokers advertise the API but the protocol was not enabled on
+			// the group coordinator.
+			cg.log().debug(context.Background(), "group coordinator does not support the consumer group protocol, falling back to the classic protocol",
+				logAttrs{"group", cg.config.ID},
+				"Group coordinator does not support the consumer group protocol, group %s falls back to the classic protocol", cg.config.ID)
+			return true
+
+		case errors.Is(err, FencedMemberEpoch), errors.Is(err, UnknownMemberId):
+			// The member lost its partitions, it must abandon them and rejoin
+			// the group with the same member ID.
+			cg.log().error(context.Background(), "member was fenced, rejoining",
+				logAttrs{"group", cg.config.ID, "member", m.memberID, "error", err},
+				"Member %s of group %s was fenced, rejoining: %v", m.memberID, cg.config.ID, err)
+			gen = m.reset(gen)
+			continue
+
+		default:
+			// The member keeps its epoch and partitions, the coordinator only
+			// fences it if the heartbeats stop for longer than the session
+			// timeout, in which case the next heartbeat fails with one of the
+			// errors above.
+			cg.log().error(context.Background(), "failed to send heartbeat to the group coordinator",
+				logAttrs{"group", cg.config.ID, "member", m.memberID, "error", err},
+				"Failed to send heartbeat to the coordinator of group %s: %v", cg.config.ID, err)
+			backoff := cg.config.JoinGroupBackoff
+			if isTemporary(err) || isTimeout(err) || isTransientNetworkError(err) {
+				backoff = interval
+			}
+			if !cg.reportError(err, backoff) {
+				if gen != nil {
+					gen.close()
+				}
+				m.leave()
+				return false
+			}
+			continue
+		}
+
+		changed := false
+
+		if res.Assignment != nil {
+			assignment, err := m.resolve(res.Assignment.TopicPartitions)
+			if err != nil {
+				cg.log().error(context.Background(), "failed to resolve the assigned topic IDs",
+					logAttrs{"group", cg.config.ID, "member", m.memberID, "error", err},
+					"Failed to resolve the topic IDs assigned to member %s of group %s: %v", m.memberID, cg.config.ID, err)
+			} else if m.assignment == nil || !reflect.DeepEqual(assignment, m.assignment) {
+				m.assignment, changed = assignment, true
+			}
+		}
+
+		if m.assignment != nil && (changed || gen == nil) {
+			// Partitions that are revoked must be released before the next
+			// heartbeat acknowledges the new assignment, so the generation
+			// owning them must end first.
+			if gen != nil {
+				gen.close()
+				gen = nil
+			}
+
+			offsets, err := m.fetchOffsets()
+			if err != nil {
+				cg.log().error(context.Background(), "failed to fetch offsets",
+					logAttrs{"group", cg.config.ID, "member", m.memberID, "error", err},
+					"Failed to fetch offsets for group %s: %v", cg.config.ID, err)
+				if !cg.reportError(err, cg.config.JoinGroupBackoff) {
+					m.leave()
+					return false
+				}
+				continue
+			}
+
+			gen = m.generation(offsets)
+			cg.log().debug(context.Background(), "assigned partitions",
+				logAttrs{"group", cg.config.ID, "member", m.memberID, "generation", gen.ID, "partitions", m.assignment},
+				"Member %s of group %s was assigned partitions %v in epoch %d", m.memberID, cg.config.ID, m.assignment, gen.ID)
+
+			select {
+			case <-cg.done:
+				gen.close()
+				m.leave()
+				return false
+			case cg.next <- gen:
+			}
+
+			// Acknowledge the assignment without waiting for the next
+			// heartbeat interval.
+			continue
+		}
+
+		var genDone <-chan struct{}
+		if gen != nil {
+			genDone = gen.done
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-cg.done:
+			timer.Stop()
+			if gen != nil {
+				gen.close()
+			}
+			m.leave()
+			return false
+		case <-genDone:
+			// The generation was ended by the program, the next loop iteration
+			// starts a new one with the same assignment.
+			timer.Stop()
+			gen.close()
+			gen = nil
+		case <-timer.C:
+		}
+	}
+}
+
+// reportError sends err to the caller of Next and waits for backoff. It
+// returns false if the group was closed in the meantime.
+func (cg *ConsumerGroup) reportError(err error, backoff time.Duration) bool {
+	select {
+	case <-cg.done:
+		return false
+	case cg.errs <- err:
+	}
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-cg.done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (m *consumerGroupMember) supported() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cg.config.Timeout)
+	defer cancel()
+	return m.client.supportsApiVersion(ctx, m.client.Addr, protocol.ConsumerGroupHeartbeat, 0)
+}
+
+// heartbeat sends the full state of the member to the group coordinator.
+func (m *consumerGroupMember) heartbeat() (*consumergroupheartbeat.Response, error) {
+	return m.sendHeartbeat(atomic.LoadInt32(&m.epoch))
+}
+
+func (m *consumerGroupMember) sendHeartbeat(epoch int32) (*consumergroupheartbeat.Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cg.config.Timeout)
+	defer cancel()
+
+	r, err := m.client.roundTrip(ctx, nil, &consumergroupheartbeat.Request{
+		GroupID:              m.cg.config.ID,
+		MemberID:             m.memberID,
+		MemberEpoch:          epoch,
+		RebalanceTimeoutMs:   int32(m.cg.config.RebalanceTimeout / time.Millisecond),
+		SubscribedTopicNames: m.cg.config.Topics,
+		TopicPartitions:      m.owned(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := r.(*consumergroupheartbeat.Response)
+	if res.ErrorCode != 0 {
+		return nil, makeError(res.ErrorCode, res.ErrorMessage)
+	}
+	return res, nil
+}
+
+// leave removes the member from the group.
+func (m *consumerGroupMember) leave() {
+	if m.memberID == "" {
+		return
+	}
+
+	m.cg.log().debug(context.Background(), "leaving group", logAttrs{"group", m.cg.config.ID, "member", m.memberID},
+		"Leaving group %s, member %s", m.cg.config.ID, m.memberID)
+
+	if _, err := m.sendHeartbeat(-1); err != nil {
+		m.cg.log().error(context.Background(), "leave group failed", logAttrs{"group", m.cg.config.ID, "member", m.memberID, "error", err},
+			"leave group failed for group, %v, and member, %v: %v", m.cg.config.ID, m.memberID, err)
+	}
+}
+
+// reset ends gen and abandons the partitions of the member, so it rejoins the
+// group on the next heartbeat.
+func (m *consumerGroupMember) reset(gen *Generation) *Generation {
+	if gen != nil {
+		gen.close()
+	}
+	m.assignment = nil
+	atomic.StoreInt32(&m.epoch, 0)
+	return nil
+}
+
+// owned returns the partitions owned by the member, which is never nil since
+// the protocol expects an empty list when the member joins.
+func (m *consumerGroupMember) owned() []consumergroupheartbeat.RequestTopicPartition {
+	owned := make([]consumergroupheartbeat.RequestTopicPartition, 0, len(m.assignment))
+
+	for topic, partitions := range m.assignment {
+		owned = append(owned, consumergroupheartbeat.RequestTopicPartition{
+			TopicID:    m.topicIDs[topic],
+			Partitions: partitions,
+		})
+	}
+
+	return owned
+}
+
+// resolve converts an assignment received from the group coordinator to
+// partitions grouped by topic names.
+func (m *consumerGroupMember) resolve(topicPartitions []consumergroupheartbeat.ResponseTopicPartition) (map[string][]int32, error) {
+	for _, tp := range topicPartitions {
+		if _, ok := m.topicNames[tp.TopicID]; !ok {
+			if err := m.refreshTopicIDs(); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	assignment := make(map[string][]int32, len(topicPartitions))
+
+	for _, tp := range topicPartitions {
+		topic, ok := m.topicNames[tp.TopicID]
+		if !ok {
+			return nil, fmt.Errorf("topic %s: %w", tp.TopicID, UnknownTopicOrPartition)
+		}
+		partitions := make([]int32, len(tp.Partitions))
+		copy(partitions, tp.Partitions)
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		assignment[topic] = partitions
+	}
+
+	return assignment, nil
+}
+
+func (m *consumerGroupMember) refreshTopicIDs() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.cg.config.Timeout)
+	defer cancel()
+
+	r, err := m.client.roundTrip(ctx, nil, &metadataAPI.Request{
+		TopicNames: m.cg.config.Topics,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range r.(*metadataAPI.Response).Topics {
+		if t.ErrorCode == 0 && !t.TopicID.IsZero() {
+			m.topicIDs[t.Name] = t.TopicID
+			m.topicNames[t.TopicID] = t.Name
+		}
+	}
+
+	return nil
+}
+
+func (m *consumerGroupMember) coordinator() *consumerProtocolCoordinator {
+	return &consumerProtocolCoordinator{
+		client:   m.client,
+		timeout:  m.cg.config.Timeout,
+		memberID: m.memberID,
+		epoch:    &m.epoch,
+	}
+}
+
+func (m *consumerGroupMember) fetchOffsets() (map[string]map[int]int64, error) {
+	return m.cg.fetchOffsets(m.coordinator(), m.assignment)
+}
+
+// generation creates a generation for the current assignment of the member.
+// Its ID is the member epoch at the time the assignment was received.
+func (m *consumerGroupMember) generation(offsets map[string]map[int]int64) *Generation {
+	return &Generation{
+		ID:              atomic.LoadInt32(&m.epoch),
+		GroupID:         m.cg.config.ID,
+		MemberID:        m.memberID,
+		Assignments:     m.cg.makeAssignments(m.assignment, offsets),
+		conn:            m.coordinator(),
+		done:            make(chan struct{}),
+		joined:          make(chan struct{}),
+		retentionMillis: int64(m.cg.config.RetentionTime / time.Millisecond),
+		log:             m.cg.log(),
+	}
+}
+
+var _ coordinator = (*consumerProtocolCoordinator)(nil)
+
+// consumerProtocolCoordinator implements the coordinator interface for the
+// generations of groups using the consumer protocol. Offsets are committed
+// with the current member epoch, which may change during a generation, the
+// membership operations are handled by the heartbeats of the group.
+type consumerProtocolCoordinator struct {
+	client   *Client
+	timeout  time.Duration
+	memberID string
+	epoch    *int32
+}
+
+func (c *consumerProtocolCoordinator) Close() error {
+	return nil
+}
+
+func (c *consumerProtocolCoordinator) findCoordinator(findCoordinatorRequestV0) (findCoordinatorResponseV0, error) {
+	return findCoordinatorResponseV0{}, errConsumerProtocolUnsupportedOp
+}
+
+func (c *consumerProtocolCoordinator) joinGroup(joinGroupRequestV1) (joinGroupResponseV1, error) {
+	return joinGroupResponseV1{}, errConsumerProtocolUnsupportedOp
+}
+
+func (c *consumerProtocolCoordinator) syncGroup(syncGroupRequestV0) (syncGroupResponseV0, error) {
+	return syncGroupResponseV0{}, errConsumerProtocolUnsupportedOp
+}
+
+func (c *consumerProtocolCoordinator) leaveGroup(leaveGroupRequestV0) (leaveGroupResponseV0, error) {
+	return leaveGroupResponseV0{}, errConsumerProtocolUnsupportedOp
+}
+
+func (c *consumerProtocolCoordinator) heartbeat(heartbeatRequestV0) (heartbeatResponseV0, error) {
+	return heartbeatResponseV0{}, errConsumerProtocolUnsupportedOp
+}
+
+func (c *consumerProtocolCoordinator) offsetFetch(req offsetFetchRequestV1) (offsetFetchResponseV1, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	topics := make(map[string][]int, len(req.Topics))
+	for _, t := range req.Topics {
+		partitions := make([]int, len(t.Partitions))
+		for i, p := range t.Partitions {
+			partitions[i] = int(p)
+		}
+		topics[t.Topic] = partitions
+	}
+
+	res, err := c.client.OffsetFetch(ctx, &OffsetFetchRequest{
+		GroupID: req.GroupID,
+		Topics:  topics,
+	})
+	if err != nil {
+		return offsetFetchResponseV1{}, err
+	}
+	if res.Error != nil {
+		return offsetFetchResponseV1{}, res.Error
+	}
+
+	response := offsetFetchResponseV1{
+		Responses: make([]offsetFetchResponseV1Response, 0, len(res.Topics)),
+	}
+
+	for topic, partitions := range res.Topics {
+		r := offsetFetchResponseV1Response{Topic: topic}
+		for _, p := range partitions {
+			if p.Error != nil {
+				return offsetFetchResponseV1{}, p.Error
+			}
+			r.PartitionResponses = append(r.PartitionResponses, offsetFetchResponseV1PartitionResponse{
+				Partition: int32(p.Partition),
+				Offset:    p.CommittedOffset,
+				Metadata:  p.Metadata,
+			})
+		}
+		response.Responses = append(response.Responses, r)
+	}
+
+	return response, nil
+}
+
+func (c *consumerProtocolCoordinator) offsetCommit(req offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	topics := make(map[string][]OffsetCommit, len(req.Topics))
+	for _, t := range req.Topics {
+		for _, p := range t.Partitions {
+			topics[t.Topic] = append(topics[t.Topic], OffsetCommit{
+				Partition: int(p.Partition),
+				Offset:    p.Offset,
+				Metadata:  p.Metadata,
+			})
+		}
+	}
+
+	res, err := c.client.OffsetCommit(ctx, &OffsetCommitRequest{
+		GroupID:      req.GroupID,
+		GenerationID: int(atomic.LoadInt32(c.epoch)),
+		MemberID:     c.memberID,
+		Topics:       topics,
+	})
+	if err != nil {
+		return offsetCommitResponseV2{}, err
+	}
+
+	for _, partitions := range res.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return offsetCommitResponseV2{}, p.Error
+			}
+		}
+	}
+
+	return offsetCommitResponseV2{}, nil
+}
+
+func (c *consumerProtocolCoordinator) readPartitions(...string) ([]Partition, error) {
+	return nil, errConsumerProtocolUnsupportedOp
+}
@@ -0,0 +1,342 @@
+// Package consumeroffsets is an experimental package that provides tooling to
+// decode the messages of the internal __consumer_offsets topic, where kafka
+// stores the committed offsets and the metadata of consumer groups. This
+// package does not make any promises around backwards compatibility.
+//
+// The formats of these messages are an implementation detail of the kafka
+// brokers, the package supports all the versions known at the time of writing
+// and returns errors for the versions it does not know about.
+package consumeroffsets
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Topic is the name of the internal topic where kafka stores the offsets
+// committed by consumer groups.
+const Topic = "__consumer_offsets"
+
+// OffsetKey is the key of messages carrying committed offsets, for key
+// versions 0 and 1.
+type OffsetKey struct {
+	Group     string
+	Topic     string
+	Partition int32
+}
+
+// OffsetValue is the value of messages carrying committed offsets.
+type OffsetValue struct {
+	// Version of the value format.
+	Version int16
+
+	Offset int64
+
+	// LeaderEpoch is -1 for versions prior to 3.
+	LeaderEpoch int32
+
+	Metadata        string
+	CommitTimestamp time.Time
+
+	// ExpireTimestamp is only present in version 1, it is the zero value for
+	// other versions.
+	ExpireTimestamp time.Time
+}
+
+// GroupMetadataKey is the key of messages carrying group metadata, for key
+// version 2.
+type GroupMetadataKey struct {
+	Group string
+}
+
+// GroupMetadataValue is the value of messages carrying group metadata.
+type GroupMetadataValue struct {
+	// Version of the value format.
+	Version int16
+
+	ProtocolType string
+	Generation   int32
+	Protocol     string
+	Leader       string
+
+	// CurrentStateTimestamp is only present starting with version 2, it is
+	// the zero value for prior versions.
+	CurrentStateTimestamp time.Time
+
+	Members []MemberMetadata
+}
+
+// MemberMetadata represents a member of a group in GroupMetadataValue.
+type MemberMetadata struct {
+	MemberID string
+
+	// GroupInstanceID is only present starting with version 3.
+	GroupInstanceID string
+
+	ClientID   string
+	ClientHost string
+
+	// RebalanceTimeout is only present starting with version 1.
+	RebalanceTimeout time.Duration
+	SessionTimeout   time.Duration
+
+	Subscription []byte
+	Assignment   []byte
+}
+
+// Message is a decoded message of the __consumer_offsets topic.
+//
+// Exactly one of OffsetKey or GroupMetadataKey is set. The value matching the
+// key is nil when the message is a tombstone, which kafka writes to delete
+// expired offsets and groups.
+type Message struct {
+	OffsetKey   *OffsetKey
+	OffsetValue *OffsetValue
+
+	GroupMetadataKey   *GroupMetadataKey
+	GroupMetadataValue *GroupMetadataValue
+}
+
+// Tombstone returns true if m is a tombstone.
+func (m *Message) Tombstone() bool {
+	return m.OffsetValue == nil && m.GroupMetadataValue == nil
+}
+
+// Decode decodes a message read from the __consumer_offsets topic.
+func Decode(msg kafka.Message) (Message, error) {
+	return DecodeKeyValue(msg.Key, msg.Value)
+}
+
+// DecodeKeyValue decodes the key and value of a message read from the
+// __consumer_offsets topic. A nil value is decoded as a tombstone.
+func DecodeKeyValue(key, value []byte) (Message, error) {
+	var m Message
+
+	d := &decoder{b: key}
+	version := d.readInt16()
+
+	switch version {
+	case 0, 1:
+		m.OffsetKey = &OffsetKey{
+			Group:     d.readString(),
+			Topic:     d.readString(),
+			Partition: d.readInt32(),
+		}
+	case 2:
+		m.GroupMetadataKey = &GroupMetadataKey{
+			Group: d.readString(),
+		}
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unsupported key version: %d", version)
+		}
+	}
+
+	if d.err != nil {
+		return Message{}, fmt.Errorf("decoding %s key: %w", Topic, d.err)
+	}
+
+	if value == nil {
+		return m, nil
+	}
+
+	var err error
+	if m.OffsetKey != nil {
+		m.OffsetValue, err = decodeOffsetValue(value)
+	} else {
+		m.GroupMetadataValue, err = decodeGroupMetadataValue(value)
+	}
+	if err != nil {
+		return Message{}, fmt.Errorf("decoding %s value: %w", Topic, err)
+	}
+
+	return m, nil
+}
+
+func decodeOffsetValue(b []byte) (*OffsetValue, error) {
+	d := &decoder{b: b}
+	v := &OffsetValue{
+		Version:     d.readInt16(),
+		LeaderEpoch: -1,
+	}
+
+	if v.Version > 4 {
+		return nil, fmt.Errorf("unsupported offset value version: %d", v.Version)
+	}
+	d.flexible = v.Version >= 4
+
+	v.Offset = d.readInt64()
+	if v.Version >= 3 {
+		v.LeaderEpoch = d.readInt32()
+	}
+	v.Metadata = d.readString()
+	v.CommitTimestamp = makeTime(d.readInt64())
+	if v.Version == 1 {
+		v.ExpireTimestamp = makeTime(d.readInt64())
+	}
+	d.skipTaggedFields()
+
+	return v, d.err
+}
+
+func decodeGroupMetadataValue(b []byte) (*GroupMetadataValue, error) {
+	d := &decoder{b: b}
+	v := &GroupMetadataValue{
+		Version: d.readInt16(),
+	}
+
+	if v.Version > 4 {
+		return nil, fmt.Errorf("unsupported group metadata value version: %d", v.Version)
+	}
+	d.flexible = v.Version >= 4
+
+	v.ProtocolType = d.readString()
+	v.Generation = d.readInt32()
+	v.Protocol = d.readString()
+	v.Leader = d.readString()
+	if v.Version >= 2 {
+		v.CurrentStateTimestamp = makeTime(d.readInt64())
+	}
+
+	n := d.readArrayLength()
+	if n > 0 {
+		v.Members = make([]MemberMetadata, n)
+	}
+
+	for i := 0; i < n && d.err == nil; i++ {
+		m := &v.Members[i]
+		m.MemberID = d.readString()
+		if v.Version >= 3 {
+			m.GroupInstanceID = d.readString()
+		}
+		m.ClientID = d.readString()
+		m.ClientHost = d.readString()
+		if v.Version >= 1 {
+			m.RebalanceTimeout = makeDuration(d.readInt32())
+		}
+		m.SessionTimeout = makeDuration(d.readInt32())
+		m.Subscription = d.readBytes()
+		m.Assignment = d.readBytes()
+		d.skipTaggedFields()
+	}
+
+	d.skipTaggedFields()
+	return v, d.err
+}
+
+func makeTime(t int64) time.Time {
+	if t <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(t/1000, (t%1000)*int64(time.Millisecond)).UTC()
+}
+
+func makeDuration(ms int32) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+var errShortBuffer = errors.New("not enough bytes to decode the message")
+
+// decoder reads big-endian values from a byte slice, the first error is
+// retained and subsequent reads return zero values.
+type decoder struct {
+	b        []byte
+	err      error
+	flexible bool
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = errShortBuffer
+		return nil
+	}
+	b := d.b[:n:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) readInt16() int16 {
+	if b := d.read(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) readInt32() int32 {
+	if b := d.read(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) readInt64() int64 {
+	if b := d.read(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) readUnsignedVarInt() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	u, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.b = d.b[n:]
+	return u
+}
+
+// readLength reads the length of a string, byte array, or array, returning
+// -1 for null values.
+func (d *decoder) readLength(nonCompact func() int) int {
+	if d.flexible {
+		return int(d.readUnsignedVarInt()) - 1
+	}
+	return nonCompact()
+}
+
+func (d *decoder) readString() string {
+	n := d.readLength(func() int { return int(d.readInt16()) })
+	if n <= 0 {
+		return ""
+	}
+	return string(d.read(n))
+}
+
+func (d *decoder) readBytes() []byte {
+	n := d.readLength(func() int { return int(d.readInt32()) })
+	if n < 0 {
+		return nil
+	}
+	b := d.read(n)
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (d *decoder) readArrayLength() int {
+	return d.readLength(func() int { return int(d.readInt32()) })
+}
+
+// skipTaggedFields discards the tagged fields ending structures in flexible
+// versions, none of them are known to the package.
+func (d *decoder) skipTaggedFields() {
+	if !d.flexible {
+		return
+	}
+	for n := d.readUnsignedVarInt(); n > 0 && d.err == nil; n-- {
+		d.readUnsignedVarInt() // tag
+		d.read(int(d.readUnsignedVarInt()))
+	}
+}
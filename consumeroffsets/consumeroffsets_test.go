@@ -0,0 +1,238 @@
+package consumeroffsets
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// encoder produces test messages in the formats written by kafka brokers.
+type encoder struct {
+	b        []byte
+	flexible bool
+}
+
+func (e *encoder) int16(i int16) *encoder {
+	e.b = append(e.b, byte(i>>8), byte(i))
+	return e
+}
+
+func (e *encoder) int32(i int32) *encoder {
+	e.b = append(e.b, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.b[len(e.b)-4:], uint32(i))
+	return e
+}
+
+func (e *encoder) int64(i int64) *encoder {
+	e.b = append(e.b, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.b[len(e.b)-8:], uint64(i))
+	return e
+}
+
+func (e *encoder) uvarint(u uint64) *encoder {
+	var b [binary.MaxVarintLen64]byte
+	e.b = append(e.b, b[:binary.PutUvarint(b[:], u)]...)
+	return e
+}
+
+func (e *encoder) string(s string) *encoder {
+	if e.flexible {
+		e.uvarint(uint64(len(s) + 1))
+	} else {
+		e.int16(int16(len(s)))
+	}
+	e.b = append(e.b, s...)
+	return e
+}
+
+func (e *encoder) bytes(b []byte) *encoder {
+	if e.flexible {
+		e.uvarint(uint64(len(b) + 1))
+	} else {
+		e.int32(int32(len(b)))
+	}
+	e.b = append(e.b, b...)
+	return e
+}
+
+func (e *encoder) arrayLength(n int) *encoder {
+	if e.flexible {
+		return e.uvarint(uint64(n + 1))
+	}
+	return e.int32(int32(n))
+}
+
+func (e *encoder) taggedFields() *encoder {
+	if e.flexible {
+		// A single unknown tagged field that the decoder must skip.
+		e.uvarint(1).uvarint(42).uvarint(3)
+		e.b = append(e.b, "abc"...)
+	}
+	return e
+}
+
+func TestDecodeOffset(t *testing.T) {
+	commitTime := time.Date(2020, 1, 2, 3, 4, 5, 6e6, time.UTC)
+	expireTime := commitTime.Add(24 * time.Hour)
+
+	for version := int16(0); version <= 4; version++ {
+		key := (&encoder{}).int16(1).string("group-A").string("topic-A").int32(2).b
+
+		e := &encoder{flexible: version >= 4}
+		e.int16(version).int64(42)
+		if version >= 3 {
+			e.int32(7)
+		}
+		e.string("meta").int64(commitTime.UnixNano() / 1e6)
+		if version == 1 {
+			e.int64(expireTime.UnixNano() / 1e6)
+		}
+		e.taggedFields()
+
+		m, err := Decode(kafka.Message{Topic: Topic, Key: key, Value: e.b})
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+
+		want := &OffsetValue{
+			Version:         version,
+			Offset:          42,
+			LeaderEpoch:     -1,
+			Metadata:        "meta",
+			CommitTimestamp: commitTime,
+		}
+		if version >= 3 {
+			want.LeaderEpoch = 7
+		}
+		if version == 1 {
+			want.ExpireTimestamp = expireTime
+		}
+
+		if !reflect.DeepEqual(m.OffsetKey, &OffsetKey{Group: "group-A", Topic: "topic-A", Partition: 2}) {
+			t.Errorf("v%d: unexpected key: %+v", version, m.OffsetKey)
+		}
+		if !reflect.DeepEqual(m.OffsetValue, want) {
+			t.Errorf("v%d: unexpected value:\nwant: %+v\ngot:  %+v", version, want, m.OffsetValue)
+		}
+		if m.GroupMetadataKey != nil || m.GroupMetadataValue != nil {
+			t.Errorf("v%d: unexpected group metadata: %+v", version, m)
+		}
+	}
+}
+
+func TestDecodeGroupMetadata(t *testing.T) {
+	stateTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for version := int16(0); version <= 4; version++ {
+		key := (&encoder{}).int16(2).string("group-A").b
+
+		e := &encoder{flexible: version >= 4}
+		e.int16(version).string("consumer").int32(3).string("range").string("member-1")
+		if version >= 2 {
+			e.int64(stateTime.UnixNano() / 1e6)
+		}
+		e.arrayLength(1).string("member-1")
+		if version >= 3 {
+			e.string("instance-1")
+		}
+		e.string("client-1").string("/127.0.0.1")
+		if version >= 1 {
+			e.int32(60000)
+		}
+		e.int32(10000).bytes([]byte("subscription")).bytes([]byte("assignment"))
+		e.taggedFields()
+		e.taggedFields()
+
+		m, err := DecodeKeyValue(key, e.b)
+		if err != nil {
+			t.Fatalf("v%d: %v", version, err)
+		}
+
+		member := MemberMetadata{
+			MemberID:       "member-1",
+			ClientID:       "client-1",
+			ClientHost:     "/127.0.0.1",
+			SessionTimeout: 10 * time.Second,
+			Subscription:   []byte("subscription"),
+			Assignment:     []byte("assignment"),
+		}
+		if version >= 1 {
+			member.RebalanceTimeout = time.Minute
+		}
+		if version >= 3 {
+			member.GroupInstanceID = "instance-1"
+		}
+
+		want := &GroupMetadataValue{
+			Version:      version,
+			ProtocolType: "consumer",
+			Generation:   3,
+			Protocol:     "range",
+			Leader:       "member-1",
+			Members:      []MemberMetadata{member},
+		}
+		if version >= 2 {
+			want.CurrentStateTimestamp = stateTime
+		}
+
+		if !reflect.DeepEqual(m.GroupMetadataKey, &GroupMetadataKey{Group: "group-A"}) {
+			t.Errorf("v%d: unexpected key: %+v", version, m.GroupMetadataKey)
+		}
+		if !reflect.DeepEqual(m.GroupMetadataValue, want) {
+			t.Errorf("v%d: unexpected value:\nwant: %+v\ngot:  %+v", version, want, m.GroupMetadataValue)
+		}
+	}
+}
+
+func TestDecodeTombstone(t *testing.T) {
+	key := (&encoder{}).int16(2).string("group-A").b
+
+	m, err := DecodeKeyValue(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Tombstone() {
+		t.Errorf("expected a tombstone: %+v", m)
+	}
+	if m.GroupMetadataKey == nil || m.GroupMetadataKey.Group != "group-A" {
+		t.Errorf("unexpected key: %+v", m.GroupMetadataKey)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		scenario string
+		key      []byte
+		value    []byte
+	}{
+		{
+			scenario: "unknown key version",
+			key:      (&encoder{}).int16(3).string("group-A").b,
+		},
+		{
+			scenario: "truncated key",
+			key:      (&encoder{}).int16(1).string("group-A").b,
+		},
+		{
+			scenario: "unknown value version",
+			key:      (&encoder{}).int16(1).string("group-A").string("topic-A").int32(0).b,
+			value:    (&encoder{}).int16(5).int64(42).b,
+		},
+		{
+			scenario: "truncated value",
+			key:      (&encoder{}).int16(2).string("group-A").b,
+			value:    (&encoder{}).int16(0).string("consumer").b,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if _, err := DecodeKeyValue(test.key, test.value); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
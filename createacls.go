@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"fmt"
+	"math"
 	"net"
 	"time"
 
@@ -60,6 +61,36 @@ const (
 	ACLOperationTypeIdempotentWrite ACLOperationType = 12
 )
 
+// ACLOperations is a set of ACL operations, kafka uses it to report the
+// operations that the principal of a client is authorized to perform on a
+// resource, see MetadataRequest.IncludeTopicAuthorizedOperations.
+type ACLOperations uint32
+
+// makeACLOperations converts the bit field of authorized operations returned
+// by kafka, which is math.MinInt32 when they were not requested.
+func makeACLOperations(bits int32) ACLOperations {
+	if bits == math.MinInt32 {
+		return 0
+	}
+	return ACLOperations(bits)
+}
+
+// Contains returns true if op is in the set.
+func (ops ACLOperations) Contains(op ACLOperationType) bool {
+	return op >= 0 && op < 32 && ops&(1<<uint(op)) != 0
+}
+
+// Operations returns the list of operations in the set, in ascending order.
+func (ops ACLOperations) Operations() []ACLOperationType {
+	var list []ACLOperationType
+	for op := ACLOperationType(0); op < 32; op++ {
+		if ops.Contains(op) {
+			list = append(list, op)
+		}
+	}
+	return list
+}
+
 type ACLEntry struct {
 	ResourceType        ResourceType
 	ResourceName        string
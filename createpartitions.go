@@ -6,6 +6,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
 	"github.com/segmentio/kafka-go/protocol/createpartitions"
 )
 
@@ -52,7 +53,7 @@ func (c *Client) CreatePartitions(ctx context.Context, req *CreatePartitionsRequ
 
 	m, err := c.roundTrip(ctx, req.Addr, &createpartitions.Request{
 		Topics:       topics,
-		TimeoutMs:    c.timeoutMs(ctx, defaultCreatePartitionsTimeout),
+		TimeoutMs:    c.timeoutMs(ctx, protocol.CreatePartitions, defaultCreatePartitionsTimeout),
 		ValidateOnly: req.ValidateOnly,
 	})
 
@@ -5,9 +5,13 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
 	"github.com/segmentio/kafka-go/protocol/createtopics"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
 )
 
 // CreateTopicRequests represents a request sent to a kafka broker to create
@@ -25,6 +29,17 @@ type CreateTopicsRequest struct {
 	// This field will be ignored if the kafka broker did no support the
 	// CreateTopics API in version 1 or above.
 	ValidateOnly bool
+
+	// When set to true, CreateTopics does not return until all partitions of
+	// the topics that were created have a leader, so messages can be produced
+	// to them right away. The wait is bounded by the context passed to
+	// CreateTopics, an error listing the partitions still without leaders is
+	// returned if it expires first.
+	//
+	// When the client uses a Transport, the metadata are served from its
+	// cache, which is refreshed every MetadataTTL; waiting may take up to this
+	// duration if the partitions had no leaders when the topics were cached.
+	WaitForLeaders bool
 }
 
 // CreateTopicResponse represents a response from a kafka broker to a topic
@@ -61,7 +76,7 @@ func (c *Client) CreateTopics(ctx context.Context, req *CreateTopicsRequest) (*C
 
 	m, err := c.roundTrip(ctx, req.Addr, &createtopics.Request{
 		Topics:       topics,
-		TimeoutMs:    c.timeoutMs(ctx, defaultCreateTopicsTimeout),
+		TimeoutMs:    c.timeoutMs(ctx, protocol.CreateTopics, defaultCreateTopicsTimeout),
 		ValidateOnly: req.ValidateOnly,
 	})
 
@@ -75,13 +90,81 @@ func (c *Client) CreateTopics(ctx context.Context, req *CreateTopicsRequest) (*C
 		Errors:   make(map[string]error, len(res.Topics)),
 	}
 
+	created := make([]string, 0, len(res.Topics))
+
 	for _, t := range res.Topics {
 		ret.Errors[t.Name] = makeError(t.ErrorCode, t.ErrorMessage)
+		if t.ErrorCode == 0 {
+			created = append(created, t.Name)
+		}
+	}
+
+	if req.WaitForLeaders && !req.ValidateOnly && len(created) != 0 {
+		if err := c.waitForLeaders(ctx, req.Addr, created); err != nil {
+			return ret, fmt.Errorf("kafka.(*Client).CreateTopics: %w", err)
+		}
 	}
 
 	return ret, nil
 }
 
+// waitForLeaders polls the metadata of topics until all their partitions have
+// a leader, or the context expires.
+func (c *Client) waitForLeaders(ctx context.Context, addr net.Addr, topics []string) error {
+	missing := topics
+
+	for attempt := 0; len(missing) != 0; attempt++ {
+		if attempt != 0 {
+			if !sleep(ctx, backoff(attempt, 100*time.Millisecond, time.Second)) {
+				return fmt.Errorf("waiting for partition leaders: %w (partitions without leaders: %s)", ctx.Err(), strings.Join(missing, ", "))
+			}
+		}
+
+		m, err := c.roundTrip(ctx, addr, &metadataAPI.Request{TopicNames: topics})
+		if err != nil {
+			if ctx.Err() == nil {
+				return err
+			}
+			continue // report the partitions observed by the last request
+		}
+
+		missing = partitionsWithoutLeaders(topics, m.(*metadataAPI.Response))
+	}
+
+	return nil
+}
+
+// partitionsWithoutLeaders returns the partitions of topics which have no
+// leader in res, formatted as topic/partition, or the name of topics which
+// have no partitions yet.
+func partitionsWithoutLeaders(topics []string, res *metadataAPI.Response) []string {
+	var missing []string
+
+	for _, name := range topics {
+		var topic *metadataAPI.ResponseTopic
+		for i := range res.Topics {
+			if res.Topics[i].Name == name {
+				topic = &res.Topics[i]
+				break
+			}
+		}
+
+		if topic == nil || topic.ErrorCode != 0 || len(topic.Partitions) == 0 {
+			missing = append(missing, name)
+			continue
+		}
+
+		for _, p := range topic.Partitions {
+			if p.ErrorCode != 0 || p.LeaderID < 0 {
+				missing = append(missing, fmt.Sprintf("%s/%d", name, p.PartitionIndex))
+			}
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
+
 type ConfigEntry struct {
 	ConfigName  string
 	ConfigValue string
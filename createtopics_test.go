@@ -4,8 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol/createtopics"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
 )
 
 func TestClientCreateTopics(t *testing.T) {
@@ -85,6 +92,72 @@ func TestClientCreateTopics(t *testing.T) {
 	}
 }
 
+func TestClientCreateTopicsWaitForLeaders(t *testing.T) {
+	// newClient returns a client to a fake cluster where partition 1 of the
+	// topic gets a leader after the given number of metadata requests, or
+	// never if it is negative.
+	newClient := func(electAfter int) *Client {
+		requests := 0
+		return &Client{
+			Addr: TCP("localhost:9092"),
+			Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+				switch r := req.(type) {
+				case *createtopics.Request:
+					return &createtopics.Response{
+						Topics: []createtopics.ResponseTopic{{Name: r.Topics[0].Name}},
+					}, nil
+				case *metadataAPI.Request:
+					requests++
+					leader := int32(-1)
+					if electAfter >= 0 && requests > electAfter {
+						leader = 1
+					}
+					return &metadataAPI.Response{
+						Topics: []metadataAPI.ResponseTopic{{
+							Name: r.TopicNames[0],
+							Partitions: []metadataAPI.ResponsePartition{
+								{PartitionIndex: 0, LeaderID: 1},
+								{PartitionIndex: 1, LeaderID: leader},
+							},
+						}},
+					}, nil
+				}
+				return nil, errors.New("unexpected request")
+			}),
+		}
+	}
+
+	req := &CreateTopicsRequest{
+		Topics:         []TopicConfig{{Topic: "topic-A", NumPartitions: 2, ReplicationFactor: 1}},
+		WaitForLeaders: true,
+	}
+
+	t.Run("elected", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := newClient(2).CreateTopics(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		res, err := newClient(-1).CreateTopics(ctx, req)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a deadline exceeded error but got %v", err)
+		}
+		if msg := err.Error(); !strings.Contains(msg, "topic-A/1") || strings.Contains(msg, "topic-A/0") {
+			t.Errorf("the error must list the partitions without leaders: %s", msg)
+		}
+		if res == nil || res.Errors["topic-A"] != nil {
+			t.Errorf("expected the topic creation to be reported as successful: %+v", res)
+		}
+	})
+}
+
 func TestCreateTopicsResponseV0(t *testing.T) {
 	item := createTopicsResponseV0{
 		TopicErrors: []createTopicsResponseV0TopicError{
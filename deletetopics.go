@@ -7,6 +7,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
 	"github.com/segmentio/kafka-go/protocol/deletetopics"
 )
 
@@ -42,7 +43,7 @@ type DeleteTopicsResponse struct {
 func (c *Client) DeleteTopics(ctx context.Context, req *DeleteTopicsRequest) (*DeleteTopicsResponse, error) {
 	m, err := c.roundTrip(ctx, req.Addr, &deletetopics.Request{
 		TopicNames: req.Topics,
-		TimeoutMs:  c.timeoutMs(ctx, defaultDeleteTopicsTimeout),
+		TimeoutMs:  c.timeoutMs(ctx, protocol.DeleteTopics, defaultDeleteTopicsTimeout),
 	})
 
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/segmentio/kafka-go/protocol/describeconfigs"
@@ -44,6 +45,17 @@ type DescribeConfigsResponse struct {
 	Resources []DescribeConfigResponseResource
 }
 
+// Resource returns the resource of the response with the given type and name,
+// and whether it was found.
+func (r *DescribeConfigsResponse) Resource(resourceType ResourceType, resourceName string) (DescribeConfigResponseResource, bool) {
+	for _, resource := range r.Resources {
+		if resource.ResourceType == int8(resourceType) && resource.ResourceName == resourceName {
+			return resource, true
+		}
+	}
+	return DescribeConfigResponseResource{}, false
+}
+
 // DescribeConfigResponseResource
 type DescribeConfigResponseResource struct {
 	// Resource Type
@@ -68,7 +80,8 @@ type DescribeConfigResponseConfigEntry struct {
 	// Ignored if API version is greater than v0
 	IsDefault bool
 
-	// Ignored if API version is less than v1
+	// Ignored if API version is less than v1, see ConfigSource for the
+	// possible values.
 	ConfigSource int8
 
 	IsSensitive bool
@@ -76,7 +89,8 @@ type DescribeConfigResponseConfigEntry struct {
 	// Ignored if API version is less than v1
 	ConfigSynonyms []DescribeConfigResponseConfigSynonym
 
-	// Ignored if API version is less than v3
+	// Ignored if API version is less than v3, see ConfigType for the possible
+	// values.
 	ConfigType int8
 
 	// Ignored if API version is less than v3
@@ -91,12 +105,20 @@ type DescribeConfigResponseConfigSynonym struct {
 	// Ignored if API version is less than v1
 	ConfigValue string
 
-	// Ignored if API version is less than v1
+	// Ignored if API version is less than v1, see ConfigSource for the
+	// possible values.
 	ConfigSource int8
 }
 
-// DescribeConfigs sends a config altering request to a kafka broker and returns the
-// response.
+// DescribeConfigs sends a config describing request to a kafka cluster and
+// returns the response.
+//
+// The resources may be any mix of topics, brokers and broker loggers. The
+// resources of brokers and broker loggers are described by the broker they
+// designate, with one request per broker, while all other resources are
+// described by a single request. The results of all requests are aggregated
+// in the response, use the Resource method to look up the configuration of a
+// specific resource.
 func (c *Client) DescribeConfigs(ctx context.Context, req *DescribeConfigsRequest) (*DescribeConfigsResponse, error) {
 	resources := make([]describeconfigs.RequestResource, len(req.Resources))
 
@@ -160,3 +182,269 @@ func (c *Client) DescribeConfigs(ctx context.Context, req *DescribeConfigsReques
 
 	return ret, nil
 }
+
+// ConfigSource represents the source of a configuration entry returned by
+// DescribeConfigs, which tells at which level the value was set.
+// https://github.com/apache/kafka/blob/trunk/clients/src/main/java/org/apache/kafka/clients/admin/ConfigEntry.java
+type ConfigSource int8
+
+const (
+	// ConfigSourceUnknown is reported by DescribeConfigs v0, which does not
+	// return the source of configuration entries.
+	ConfigSourceUnknown              ConfigSource = 0
+	ConfigSourceDynamicTopic         ConfigSource = 1
+	ConfigSourceDynamicBroker        ConfigSource = 2
+	ConfigSourceDynamicDefaultBroker ConfigSource = 3
+	ConfigSourceStaticBroker         ConfigSource = 4
+	ConfigSourceDefault              ConfigSource = 5
+	ConfigSourceDynamicBrokerLogger  ConfigSource = 6
+)
+
+func (s ConfigSource) String() string {
+	switch s {
+	case ConfigSourceUnknown:
+		return "unknown"
+	case ConfigSourceDynamicTopic:
+		return "dynamic-topic"
+	case ConfigSourceDynamicBroker:
+		return "dynamic-broker"
+	case ConfigSourceDynamicDefaultBroker:
+		return "dynamic-default-broker"
+	case ConfigSourceStaticBroker:
+		return "static-broker"
+	case ConfigSourceDefault:
+		return "default"
+	case ConfigSourceDynamicBrokerLogger:
+		return "dynamic-broker-logger"
+	default:
+		return "ConfigSource(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// Source returns the source of the configuration entry. Brokers responding
+// with DescribeConfigs v0 only report whether the entry has its default value,
+// which is translated to ConfigSourceDefault.
+func (e *DescribeConfigResponseConfigEntry) Source() ConfigSource {
+	if e.ConfigSource == int8(ConfigSourceUnknown) && e.IsDefault {
+		return ConfigSourceDefault
+	}
+	return ConfigSource(e.ConfigSource)
+}
+
+// Type returns the type of the configuration entry, ConfigTypeUnknown if the
+// broker did not report it.
+func (e *DescribeConfigResponseConfigEntry) Type() ConfigType {
+	return ConfigType(e.ConfigType)
+}
+
+// Source returns the source of the configuration synonym.
+func (s *DescribeConfigResponseConfigSynonym) Source() ConfigSource {
+	return ConfigSource(s.ConfigSource)
+}
+
+// ConfigType represents the type of the value of a configuration entry
+// returned by DescribeConfigs v3 and above.
+type ConfigType int8
+
+const (
+	ConfigTypeUnknown  ConfigType = 0
+	ConfigTypeBoolean  ConfigType = 1
+	ConfigTypeString   ConfigType = 2
+	ConfigTypeInt      ConfigType = 3
+	ConfigTypeShort    ConfigType = 4
+	ConfigTypeLong     ConfigType = 5
+	ConfigTypeDouble   ConfigType = 6
+	ConfigTypeList     ConfigType = 7
+	ConfigTypeClass    ConfigType = 8
+	ConfigTypePassword ConfigType = 9
+)
+
+func (t ConfigType) String() string {
+	switch t {
+	case ConfigTypeUnknown:
+		return "unknown"
+	case ConfigTypeBoolean:
+		return "boolean"
+	case ConfigTypeString:
+		return "string"
+	case ConfigTypeInt:
+		return "int"
+	case ConfigTypeShort:
+		return "short"
+	case ConfigTypeLong:
+		return "long"
+	case ConfigTypeDouble:
+		return "double"
+	case ConfigTypeList:
+		return "list"
+	case ConfigTypeClass:
+		return "class"
+	case ConfigTypePassword:
+		return "password"
+	default:
+		return "ConfigType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// DescribeConfigs returns the configuration entries of topic, including the
+// source and read-only flag of each entry. When config names are given, only
+// these entries are returned.
+//
+// This method requires the kafka broker to support the DescribeConfigs API in
+// version 1 or above, use Client.DescribeConfigs to describe other resources
+// or to request synonyms and documentation.
+func (c *Conn) DescribeConfigs(topic string, configNames ...string) ([]DescribeConfigResponseConfigEntry, error) {
+	if _, err := c.negotiateVersion(describeConfigs, v1); err != nil {
+		return nil, err
+	}
+
+	var res describeConfigsResponseV1
+
+	err := c.readOperation(
+		func(deadline time.Time, id int32) error {
+			return c.writeRequest(describeConfigs, v1, id, describeConfigsRequestV1{
+				Resources: []describeConfigsRequestResourceV1{{
+					ResourceType: int8(ResourceTypeTopic),
+					ResourceName: topic,
+					ConfigNames:  configNames,
+				}},
+			})
+		},
+		func(deadline time.Time, size int) error {
+			return c.readResponse(size, &res)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range res.Resources {
+		if r.ErrorCode != 0 {
+			return nil, Error(r.ErrorCode)
+		}
+
+		entries := make([]DescribeConfigResponseConfigEntry, len(r.ConfigEntries))
+		for i, e := range r.ConfigEntries {
+			entries[i] = DescribeConfigResponseConfigEntry{
+				ConfigName:   e.ConfigName,
+				ConfigValue:  e.ConfigValue,
+				ReadOnly:     e.ReadOnly,
+				ConfigSource: e.ConfigSource,
+				IsSensitive:  e.IsSensitive,
+			}
+		}
+		return entries, nil
+	}
+
+	return nil, UnknownTopicOrPartition
+}
+
+type describeConfigsRequestV1 struct {
+	Resources       []describeConfigsRequestResourceV1
+	IncludeSynonyms bool
+}
+
+func (r describeConfigsRequestV1) size() int32 {
+	return sizeofArray(len(r.Resources), func(i int) int32 { return r.Resources[i].size() }) +
+		sizeofBool(r.IncludeSynonyms)
+}
+
+func (r describeConfigsRequestV1) writeTo(wb *writeBuffer) {
+	wb.writeArray(len(r.Resources), func(i int) { r.Resources[i].writeTo(wb) })
+	wb.writeBool(r.IncludeSynonyms)
+}
+
+type describeConfigsRequestResourceV1 struct {
+	ResourceType int8
+	ResourceName string
+	// A nil list requests all the configuration entries of the resource.
+	ConfigNames []string
+}
+
+func (r describeConfigsRequestResourceV1) size() int32 {
+	return 1 + sizeofString(r.ResourceName) + sizeofStringArray(r.ConfigNames)
+}
+
+func (r describeConfigsRequestResourceV1) writeTo(wb *writeBuffer) {
+	wb.writeInt8(r.ResourceType)
+	wb.writeString(r.ResourceName)
+	if r.ConfigNames == nil {
+		wb.writeArrayLen(-1)
+	} else {
+		wb.writeStringArray(r.ConfigNames)
+	}
+}
+
+type describeConfigsResponseV1 struct {
+	ThrottleTimeMS int32
+	Resources      []describeConfigsResponseResourceV1
+}
+
+func (r describeConfigsResponseV1) size() int32 {
+	return 4 + sizeofArray(len(r.Resources), func(i int) int32 { return r.Resources[i].size() })
+}
+
+func (r describeConfigsResponseV1) writeTo(wb *writeBuffer) {
+	wb.writeInt32(r.ThrottleTimeMS)
+	wb.writeArray(len(r.Resources), func(i int) { r.Resources[i].writeTo(wb) })
+}
+
+type describeConfigsResponseResourceV1 struct {
+	ErrorCode     int16
+	ErrorMessage  string
+	ResourceType  int8
+	ResourceName  string
+	ConfigEntries []describeConfigsResponseConfigEntryV1
+}
+
+func (r describeConfigsResponseResourceV1) size() int32 {
+	return 2 + sizeofString(r.ErrorMessage) + 1 + sizeofString(r.ResourceName) +
+		sizeofArray(len(r.ConfigEntries), func(i int) int32 { return r.ConfigEntries[i].size() })
+}
+
+func (r describeConfigsResponseResourceV1) writeTo(wb *writeBuffer) {
+	wb.writeInt16(r.ErrorCode)
+	wb.writeString(r.ErrorMessage)
+	wb.writeInt8(r.ResourceType)
+	wb.writeString(r.ResourceName)
+	wb.writeArray(len(r.ConfigEntries), func(i int) { r.ConfigEntries[i].writeTo(wb) })
+}
+
+type describeConfigsResponseConfigEntryV1 struct {
+	ConfigName     string
+	ConfigValue    string
+	ReadOnly       bool
+	ConfigSource   int8
+	IsSensitive    bool
+	ConfigSynonyms []describeConfigsResponseConfigSynonymV1
+}
+
+func (e describeConfigsResponseConfigEntryV1) size() int32 {
+	return sizeofString(e.ConfigName) + sizeofString(e.ConfigValue) + 1 + 1 + 1 +
+		sizeofArray(len(e.ConfigSynonyms), func(i int) int32 { return e.ConfigSynonyms[i].size() })
+}
+
+func (e describeConfigsResponseConfigEntryV1) writeTo(wb *writeBuffer) {
+	wb.writeString(e.ConfigName)
+	wb.writeString(e.ConfigValue)
+	wb.writeBool(e.ReadOnly)
+	wb.writeInt8(e.ConfigSource)
+	wb.writeBool(e.IsSensitive)
+	wb.writeArray(len(e.ConfigSynonyms), func(i int) { e.ConfigSynonyms[i].writeTo(wb) })
+}
+
+type describeConfigsResponseConfigSynonymV1 struct {
+	ConfigName   string
+	ConfigValue  string
+	ConfigSource int8
+}
+
+func (s describeConfigsResponseConfigSynonymV1) size() int32 {
+	return sizeofString(s.ConfigName) + sizeofString(s.ConfigValue) + 1
+}
+
+func (s describeConfigsResponseConfigSynonymV1) writeTo(wb *writeBuffer) {
+	wb.writeString(s.ConfigName)
+	wb.writeString(s.ConfigValue)
+	wb.writeInt8(s.ConfigSource)
+}
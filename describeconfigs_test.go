@@ -2,8 +2,12 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"net"
+	"reflect"
 	"testing"
 
+	"github.com/segmentio/kafka-go/protocol/describeconfigs"
 	ktesting "github.com/segmentio/kafka-go/testing"
 	"github.com/stretchr/testify/assert"
 )
@@ -61,3 +65,96 @@ func TestClientDescribeConfigs(t *testing.T) {
 	}
 	assert.Equal(t, maxMessageBytesValue, MaxMessageBytesValue)
 }
+
+func TestClientDescribeConfigsEntries(t *testing.T) {
+	client := &Client{
+		Addr: TCP("localhost:9092"),
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			r, ok := req.(*describeconfigs.Request)
+			if !ok {
+				return nil, errors.New("unexpected request")
+			}
+			if !r.IncludeSynonyms || !r.IncludeDocumentation {
+				return nil, errors.New("synonyms and documentation were not requested")
+			}
+			return &describeconfigs.Response{
+				Resources: []describeconfigs.ResponseResource{{
+					ResourceType: int8(ResourceTypeTopic),
+					ResourceName: "topic-A",
+					ConfigEntries: []describeconfigs.ResponseConfigEntry{
+						{
+							ConfigName:   "retention.ms",
+							ConfigValue:  "3600000",
+							ConfigSource: int8(ConfigSourceDynamicTopic),
+							ConfigSynonyms: []describeconfigs.ResponseConfigSynonym{
+								{ConfigName: "retention.ms", ConfigValue: "3600000", ConfigSource: int8(ConfigSourceDynamicTopic)},
+								{ConfigName: "log.retention.hours", ConfigValue: "168", ConfigSource: int8(ConfigSourceDefault)},
+							},
+							ConfigType:          int8(ConfigTypeLong),
+							ConfigDocumentation: "retention time",
+						},
+						{
+							ConfigName:  "leader.replication.throttled.replicas",
+							ReadOnly:    true,
+							IsDefault:   true,
+							IsSensitive: true,
+						},
+					},
+				}},
+			}, nil
+		}),
+	}
+
+	res, err := client.DescribeConfigs(context.Background(), &DescribeConfigsRequest{
+		Resources: []DescribeConfigRequestResource{{
+			ResourceType: ResourceTypeTopic,
+			ResourceName: "topic-A",
+		}},
+		IncludeSynonyms:      true,
+		IncludeDocumentation: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := res.Resource(ResourceTypeTopic, "topic-B"); ok {
+		t.Error("found a resource which was not described")
+	}
+
+	resource, ok := res.Resource(ResourceTypeTopic, "topic-A")
+	if !ok {
+		t.Fatal("the described resource was not found")
+	}
+
+	entries := resource.ConfigEntries
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 config entries but got %d", len(entries))
+	}
+
+	retention := entries[0]
+	if source := retention.Source(); source != ConfigSourceDynamicTopic {
+		t.Errorf("expected the retention source to be %s but got %s", ConfigSourceDynamicTopic, source)
+	}
+	if typ := retention.Type(); typ != ConfigTypeLong {
+		t.Errorf("expected the retention type to be %s but got %s", ConfigTypeLong, typ)
+	}
+	if retention.ConfigDocumentation != "retention time" {
+		t.Errorf("unexpected retention documentation: %q", retention.ConfigDocumentation)
+	}
+
+	synonyms := make([]ConfigSource, len(retention.ConfigSynonyms))
+	for i := range retention.ConfigSynonyms {
+		synonyms[i] = retention.ConfigSynonyms[i].Source()
+	}
+	if want := []ConfigSource{ConfigSourceDynamicTopic, ConfigSourceDefault}; !reflect.DeepEqual(synonyms, want) {
+		t.Errorf("expected synonym sources %v but got %v", want, synonyms)
+	}
+
+	throttled := entries[1]
+	if !throttled.ReadOnly || !throttled.IsSensitive {
+		t.Errorf("expected the entry to be read-only and sensitive: %+v", throttled)
+	}
+	if source := throttled.Source(); source != ConfigSourceDefault {
+		t.Errorf("expected the default entry source to be %s but got %s", ConfigSourceDefault, source)
+	}
+}
@@ -156,6 +156,83 @@ func (c *Client) DescribeGroups(
 	return resp, nil
 }
 
+// GroupAssignments describes how the partitions consumed by a group are
+// distributed among its members.
+type GroupAssignments struct {
+	// GroupID is the ID of the group.
+	GroupID string
+
+	// GroupState is a description of the group state, for example "Stable",
+	// "PreparingRebalance" or "Empty".
+	GroupState string
+
+	// Rebalancing is true while the group rebalances, the assignments of the
+	// members are incomplete (usually empty) until the rebalance completes.
+	Rebalancing bool
+
+	// Members contains the partitions assigned to each member of the group,
+	// keyed by member ID. The map is empty if the group has no members.
+	Members map[string][]GroupMemberTopic
+
+	// Skew is the difference between the largest and the smallest numbers of
+	// partitions assigned to a member of the group. It is zero when all the
+	// members are assigned the same number of partitions, and one when the
+	// partitions cannot be divided evenly but are balanced nonetheless.
+	Skew int
+}
+
+// GroupAssignments returns the partitions assigned to the members of a
+// consumer group, decoded from the response of the DescribeGroups API, and how
+// balanced the assignments are.
+func (c *Client) GroupAssignments(ctx context.Context, groupID string) (*GroupAssignments, error) {
+	res, err := c.DescribeGroups(ctx, &DescribeGroupsRequest{GroupIDs: []string{groupID}})
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).GroupAssignments: %w", err)
+	}
+
+	for _, group := range res.Groups {
+		if group.GroupID != groupID {
+			continue
+		}
+		if group.Error != nil {
+			return nil, fmt.Errorf("kafka.(*Client).GroupAssignments: %w", group.Error)
+		}
+		return makeGroupAssignments(group), nil
+	}
+
+	return nil, fmt.Errorf("kafka.(*Client).GroupAssignments: group %q missing from the response", groupID)
+}
+
+func makeGroupAssignments(group DescribeGroupsResponseGroup) *GroupAssignments {
+	assignments := &GroupAssignments{
+		GroupID:     group.GroupID,
+		GroupState:  group.GroupState,
+		Rebalancing: group.GroupState == "PreparingRebalance" || group.GroupState == "CompletingRebalance",
+		Members:     make(map[string][]GroupMemberTopic, len(group.Members)),
+	}
+
+	min, max := -1, 0
+	for _, member := range group.Members {
+		assignments.Members[member.MemberID] = member.MemberAssignments.Topics
+
+		n := 0
+		for _, topic := range member.MemberAssignments.Topics {
+			n += len(topic.Partitions)
+		}
+		if min < 0 || n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+
+	if min >= 0 {
+		assignments.Skew = max - min
+	}
+	return assignments
+}
+
 // readFrom decodes an owned partition item from the member metadata.
 func (t *DescribeGroupsResponseMemberMetadataOwnedPartition) readFrom(r *bufio.Reader, size int) (remain int, err error) {
 	if remain, err = readString(r, size, &t.Topic); err != nil {
@@ -1,13 +1,17 @@
 package kafka
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"sort"
 	"testing"
 	"time"
+
+	"github.com/segmentio/kafka-go/protocol/describegroups"
 )
 
 func TestClientDescribeGroups(t *testing.T) {
@@ -128,3 +132,89 @@ func TestClientDescribeGroups(t *testing.T) {
 		)
 	}
 }
+
+func TestClientGroupAssignments(t *testing.T) {
+	encodeAssignment := func(partitions ...int32) []byte {
+		b := &bytes.Buffer{}
+		groupAssignment{Topics: map[string][]int32{"topic-A": partitions}}.writeTo(&writeBuffer{w: b})
+		return b.Bytes()
+	}
+
+	tests := []struct {
+		scenario string
+		group    describegroups.ResponseGroup
+		want     *GroupAssignments
+	}{
+		{
+			scenario: "stable group",
+			group: describegroups.ResponseGroup{
+				GroupID:    "group-A",
+				GroupState: "Stable",
+				Members: []describegroups.ResponseGroupMember{
+					{MemberID: "member-1", MemberAssignment: encodeAssignment(0, 1, 2)},
+					{MemberID: "member-2", MemberAssignment: encodeAssignment(3)},
+				},
+			},
+			want: &GroupAssignments{
+				GroupID:    "group-A",
+				GroupState: "Stable",
+				Members: map[string][]GroupMemberTopic{
+					"member-1": {{Topic: "topic-A", Partitions: []int{0, 1, 2}}},
+					"member-2": {{Topic: "topic-A", Partitions: []int{3}}},
+				},
+				Skew: 2,
+			},
+		},
+		{
+			scenario: "rebalancing group",
+			group: describegroups.ResponseGroup{
+				GroupID:    "group-A",
+				GroupState: "PreparingRebalance",
+				Members: []describegroups.ResponseGroupMember{
+					{MemberID: "member-1"},
+					{MemberID: "member-2"},
+				},
+			},
+			want: &GroupAssignments{
+				GroupID:     "group-A",
+				GroupState:  "PreparingRebalance",
+				Rebalancing: true,
+				Members: map[string][]GroupMemberTopic{
+					"member-1": nil,
+					"member-2": nil,
+				},
+			},
+		},
+		{
+			scenario: "empty group",
+			group: describegroups.ResponseGroup{
+				GroupID:    "group-A",
+				GroupState: "Empty",
+			},
+			want: &GroupAssignments{
+				GroupID:    "group-A",
+				GroupState: "Empty",
+				Members:    map[string][]GroupMemberTopic{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			client := &Client{
+				Addr: TCP("localhost:9092"),
+				Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+					return &describegroups.Response{Groups: []describegroups.ResponseGroup{test.group}}, nil
+				}),
+			}
+
+			assignments, err := client.GroupAssignments(context.Background(), "group-A")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(assignments, test.want) {
+				t.Errorf("unexpected group assignments:\nwant: %+v\ngot:  %+v", test.want, assignments)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -62,11 +63,26 @@ type Dialer struct {
 	FallbackDelay time.Duration
 
 	// KeepAlive specifies the keep-alive period for an active network
-	// connection.
-	// If zero, keep-alives are not enabled. Network protocols that do not
-	// support keep-alives ignore this field.
+	// connection, lowering it allows long-lived connections to detect dead
+	// peers faster.
+	// If zero, keep-alives are enabled with the default period of the net
+	// package (15 seconds). If negative, keep-alives are disabled. Network
+	// protocols that do not support keep-alives ignore this field.
 	KeepAlive time.Duration
 
+	// DisableNoDelay enables Nagle's algorithm on TCP connections, which
+	// delays small writes to combine them into larger packets.
+	//
+	// Go disables Nagle's algorithm by default (the TCP_NODELAY socket option
+	// is set), so requests are sent as soon as they are written, which is what
+	// latency-sensitive programs need. Disabling TCP_NODELAY may reduce the
+	// number of packets sent by programs writing many small requests, at the
+	// cost of latency.
+	//
+	// The option is applied after the connection is established, including on
+	// TCP connections returned by DialFunc.
+	DisableNoDelay bool
+
 	// Resolver optionally gives a hook to convert the broker address into an
 	// alternate host or IP address which is useful for custom service discovery.
 	// If a custom resolver returns any possible hosts, the first one will be
@@ -76,12 +92,58 @@ type Dialer struct {
 	// used.
 	Resolver Resolver
 
+	// Proxy optionally sets the URL of a proxy that connections are tunneled
+	// through, the TLS and SASL handshakes then happen on the tunneled
+	// connection. SOCKS5 proxies are supported with the socks5 scheme, which
+	// resolves the host names of brokers locally, and the socks5h scheme, which
+	// lets the proxy resolve them. HTTP proxies use the http scheme, and must
+	// support the CONNECT method. Credentials may be passed as the user
+	// information of the URL.
+	//
+	// When DialFunc is set, it is used to connect to the proxy.
+	Proxy *url.URL
+
 	// TLS enables Dialer to open secure connections.  If nil, standard net.Conn
 	// will be used.
+	//
+	// The GetClientCertificate and VerifyConnection functions of the
+	// configuration are called on each handshake, they may be used to rotate
+	// client certificates held in memory, or to run additional verifications
+	// of the connections like checking the OCSP response stapled by the
+	// broker.
 	TLS *tls.Config
 
+	// TLSConfigFunc optionally returns the TLS configuration used to open each
+	// new connection, taking precedence over TLS. It allows programs to rotate
+	// certificates without recreating the Dialer: connections opened after the
+	// configuration changed use the new certificates, while connections that
+	// already exist are kept until they are closed. Returning a nil
+	// configuration opens a connection without TLS.
+	//
+	// The function is called by all goroutines opening connections and must
+	// be safe for concurrent use. The configurations it returns must not be
+	// modified afterwards.
+	//
+	// Rotating only the client certificate may also be achieved by setting
+	// GetClientCertificate on the TLS configuration, which is called on each
+	// handshake.
+	TLSConfigFunc func() (*tls.Config, error)
+
+	// TLSServerName optionally returns the server name used to verify the
+	// certificate of the broker at addr, when the TLS configuration has no
+	// ServerName. It allows verifying brokers which present certificates for
+	// names that differ from their advertised addresses, for example behind a
+	// load balancer, without disabling verification. Returning an empty
+	// string falls back to the host that is dialed.
+	TLSServerName func(addr string) string
+
 	// SASLMechanism configures the Dialer to use SASL authentication.  If nil,
 	// no authentication will be performed.
+	//
+	// The SASL flow is selected from the API versions advertised by the
+	// broker: brokers which only support v0 of the SaslHandshake API (Kafka
+	// 0.10) receive the authentication bytes as an opaque blob, newer brokers
+	// receive them in SaslAuthenticate requests.
 	SASLMechanism sasl.Mechanism
 
 	// The transactional id to use for transactional delivery. Idempotent
@@ -89,6 +151,21 @@ type Dialer struct {
 	// For more details look at transactional.id description here: http://kafka.apache.org/documentation.html#producerconfigs
 	// Empty string means that the connection will be non-transactional.
 	TransactionalID string
+
+	// PipelineDepth limits the number of requests pipelined on the connections
+	// opened by the dialer, see ConnConfig.PipelineDepth.
+	PipelineDepth int
+
+	// PipelineBytes limits the size of the requests pipelined on the
+	// connections opened by the dialer, see ConnConfig.PipelineBytes.
+	PipelineBytes int
+
+	// If not nil, specifies a logger which receives both the connections and
+	// the failures to connect, with the address of the broker as attribute.
+	//
+	// The logger is also used by the transports that readers and writers
+	// create from the dialer.
+	StructuredLogger StructuredLogger
 }
 
 // Dial connects to the address on the named network.
@@ -117,6 +194,8 @@ func (d *Dialer) DialContext(ctx context.Context, network string, address string
 		ConnConfig{
 			ClientID:        d.ClientID,
 			TransactionalID: d.TransactionalID,
+			PipelineDepth:   d.PipelineDepth,
+			PipelineBytes:   d.PipelineBytes,
 		},
 	)
 }
@@ -148,6 +227,8 @@ func (d *Dialer) DialPartition(ctx context.Context, network string, address stri
 		Broker:          partition.Leader.ID,
 		Rack:            partition.Leader.Rack,
 		TransactionalID: d.TransactionalID,
+		PipelineDepth:   d.PipelineDepth,
+		PipelineBytes:   d.PipelineBytes,
 	})
 }
 
@@ -277,6 +358,9 @@ func (d *Dialer) connect(ctx context.Context, network, address string, connCfg C
 
 	c, err := d.dialContext(ctx, network, address)
 	if err != nil {
+		if d.StructuredLogger != nil {
+			d.StructuredLogger.ErrorContext(ctx, "failed to connect to kafka broker", "broker", address, "error", err)
+		}
 		return nil, fmt.Errorf("failed to dial: %w", err)
 	}
 
@@ -293,10 +377,16 @@ func (d *Dialer) connect(ctx context.Context, network, address string, connCfg C
 		}
 		if err := d.authenticateSASL(sasl.WithMetadata(ctx, metadata), conn); err != nil {
 			_ = conn.Close()
+			if d.StructuredLogger != nil {
+				d.StructuredLogger.ErrorContext(ctx, "failed to authenticate to kafka broker", "broker", address, "error", err)
+			}
 			return nil, fmt.Errorf("could not successfully authenticate to %s:%d with SASL: %w", host, port, err)
 		}
 	}
 
+	if d.StructuredLogger != nil {
+		d.StructuredLogger.DebugContext(ctx, "connected to kafka broker", "broker", address)
+	}
 	return conn, nil
 }
 
@@ -353,24 +443,38 @@ func (d *Dialer) dialContext(ctx context.Context, network string, addr string) (
 			KeepAlive:     d.KeepAlive,
 		}).DialContext
 	}
+	dial = d.withSocketOptions(dial)
+
+	if d.Proxy != nil {
+		dial = proxyDialFunc(d.Proxy, dial)
+	}
 
 	conn, err := dial(ctx, network, address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open connection to %s: %w", address, err)
 	}
 
-	if d.TLS != nil {
-		c := d.TLS
+	config, err := loadTLSConfig(d.TLS, d.TLSConfigFunc)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to load TLS configuration: %w", err)
+	}
+
+	if config != nil {
+		c := config
 		// If no ServerName is set, infer the ServerName
 		// from the hostname we're connecting to.
 		if c.ServerName == "" {
-			c = d.TLS.Clone()
-			// Copied from tls.go in the standard library.
-			colonPos := strings.LastIndex(address, ":")
-			if colonPos == -1 {
-				colonPos = len(address)
+			c = config.Clone()
+			hostname := tlsServerName(d.TLSServerName, address)
+			if hostname == "" {
+				// Copied from tls.go in the standard library.
+				colonPos := strings.LastIndex(address, ":")
+				if colonPos == -1 {
+					colonPos = len(address)
+				}
+				hostname = address[:colonPos]
 			}
-			hostname := address[:colonPos]
 			c.ServerName = hostname
 		}
 		return d.connectTLS(ctx, conn, c)
@@ -455,6 +559,28 @@ func splitHostPort(s string) (host string, port string) {
 	return
 }
 
+// withSocketOptions wraps dial to apply the socket options of the dialer to
+// the connections it opens. When a proxy is used, the options apply to the
+// connection to the proxy.
+func (d *Dialer) withSocketOptions(dial dialFunc) dialFunc {
+	if !d.DisableNoDelay {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if c, ok := conn.(interface{ SetNoDelay(bool) error }); ok {
+			if err := c.SetNoDelay(false); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("failed to disable TCP_NODELAY: %w", err)
+			}
+		}
+		return conn, nil
+	}
+}
+
 func splitHostPortNumber(s string) (host string, portNumber int, err error) {
 	host, port := splitHostPort(s)
 	portNumber, err = strconv.Atoi(port)
@@ -464,6 +590,82 @@ func splitHostPortNumber(s string) (host string, portNumber int, err error) {
 	return host, portNumber, nil
 }
 
+// transport converts the pre-0.4 Dialer API into a Transport. The observe
+// function is called after each dial with the time it took to establish the
+// connection.
+func (d *Dialer) transport(idleTimeout, metadataTTL time.Duration, observe func(time.Duration)) *Transport {
+	dialer := (&net.Dialer{
+		Timeout:       d.Timeout,
+		Deadline:      d.Deadline,
+		LocalAddr:     d.LocalAddr,
+		DualStack:     d.DualStack,
+		FallbackDelay: d.FallbackDelay,
+		KeepAlive:     d.KeepAlive,
+	})
+
+	var resolver Resolver
+	if r, ok := d.Resolver.(*net.Resolver); ok {
+		dialer.Resolver = r
+	} else {
+		resolver = d.Resolver
+	}
+
+	connect := dialer.DialContext
+	if d.DialFunc != nil {
+		connect = d.DialFunc
+	}
+	connect = d.withSocketOptions(connect)
+	if d.Proxy != nil {
+		connect = proxyDialFunc(d.Proxy, connect)
+	}
+
+	// For backward compatibility with the pre-0.4 APIs, support custom
+	// resolvers by wrapping the dial function.
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		defer func() {
+			observe(time.Since(start))
+		}()
+		address, err := lookupHost(ctx, addr, resolver)
+		if err != nil {
+			return nil, err
+		}
+		return connect(ctx, network, address)
+	}
+
+	return &Transport{
+		Dial:          dial,
+		SASL:          d.SASLMechanism,
+		TLS:           d.TLS,
+		TLSConfigFunc: d.TLSConfigFunc,
+		TLSServerName: d.TLSServerName,
+
+		ClientID:    d.ClientID,
+		IdleTimeout: idleTimeout,
+		MetadataTTL: metadataTTL,
+
+		StructuredLogger: d.StructuredLogger,
+	}
+}
+
+// loadTLSConfig returns the TLS configuration of a new connection, calling
+// configFunc if it is set.
+func loadTLSConfig(config *tls.Config, configFunc func() (*tls.Config, error)) (*tls.Config, error) {
+	if configFunc != nil {
+		return configFunc()
+	}
+	return config, nil
+}
+
+// tlsServerName returns the TLS server name of the broker at address, or an
+// empty string if serverName is nil.
+func tlsServerName(serverName func(string) string, address string) string {
+	if serverName == nil {
+		return ""
+	}
+	return serverName(address)
+}
+
 func lookupHost(ctx context.Context, address string, resolver Resolver) (string, error) {
 	host, port := splitHostPort(address)
 
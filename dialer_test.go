@@ -1,16 +1,30 @@
 package kafka
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"net/url"
 	"reflect"
 	"sort"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/saslauthenticate"
+	"github.com/segmentio/kafka-go/protocol/saslhandshake"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
 func TestDialer(t *testing.T) {
@@ -300,6 +314,201 @@ func TestDialerConnectTLSHonorsContext(t *testing.T) {
 	}
 }
 
+func TestDialerTLSConfigFunc(t *testing.T) {
+	serverConfig := tlsConfig(t)
+	serverConfig.ClientAuth = tls.RequestClientCert
+
+	l, err := tls.Listen("tcp", "127.0.0.1:", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The server reports the number of certificates presented by each client.
+	certs := make(chan int, 3)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if err := tlsConn.Handshake(); err != nil {
+				certs <- -1
+			} else {
+				certs <- len(tlsConn.ConnectionState().PeerCertificates)
+			}
+			conn.Close()
+		}
+	}()
+
+	var mutex sync.Mutex
+	config := tlsConfig(t)
+	d := &Dialer{
+		TLSConfigFunc: func() (*tls.Config, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return config, nil
+		},
+	}
+
+	dial := func() int {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		conn, err := d.dialContext(ctx, "tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return <-certs
+	}
+
+	if n := dial(); n != 1 {
+		t.Errorf("expected the client to present a certificate, got %d", n)
+	}
+
+	// Connections opened after the configuration was rotated use it.
+	mutex.Lock()
+	config = &tls.Config{InsecureSkipVerify: true}
+	mutex.Unlock()
+
+	if n := dial(); n != 0 {
+		t.Errorf("expected the client to present no certificates, got %d", n)
+	}
+
+	d.TLSConfigFunc = func() (*tls.Config, error) {
+		return nil, errors.New("no configuration")
+	}
+	if _, err := d.dialContext(context.Background(), "tcp", l.Addr().String()); err == nil {
+		t.Error("expected an error when the configuration cannot be loaded")
+	}
+}
+
+func TestDialerTLSServerName(t *testing.T) {
+	// The server reports the name indicated by each client.
+	names := make(chan string, 1)
+	serverConfig := tlsConfig(t)
+	serverConfig.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		names <- hello.ServerName
+		return nil, nil
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	var addrs []string
+	d := &Dialer{
+		TLS: &tls.Config{InsecureSkipVerify: true},
+		TLSServerName: func(addr string) string {
+			addrs = append(addrs, addr)
+			return "broker-1.example.com"
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := d.dialContext(ctx, "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if name := <-names; name != "broker-1.example.com" {
+		t.Errorf("expected the client to indicate the mapped server name, got %q", name)
+	}
+	if len(addrs) != 1 || addrs[0] != l.Addr().String() {
+		t.Errorf("expected the server name to be mapped from the broker address, got %q", addrs)
+	}
+}
+
+func TestDialerTLSConfigHooks(t *testing.T) {
+	serverConfig := tlsConfig(t)
+	serverConfig.Certificates[0].OCSPStaple = []byte("ocsp-staple")
+	serverConfig.ClientAuth = tls.RequireAnyClientCert
+
+	l, err := tls.Listen("tcp", "127.0.0.1:", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// The server reports the number of certificates presented by each client.
+	peerCerts := make(chan int, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if tlsConn.Handshake() == nil {
+				peerCerts <- len(tlsConn.ConnectionState().PeerCertificates)
+			}
+			conn.Close()
+		}
+	}()
+
+	clientCert := serverConfig.Certificates[0]
+	errRejected := errors.New("rejected")
+
+	// The configuration has no ServerName, the dialer must keep the functions
+	// when it clones it to set the name of the broker.
+	var staple []byte
+	var reject bool
+	d := &Dialer{
+		TLS: &tls.Config{
+			InsecureSkipVerify: true,
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &clientCert, nil
+			},
+			VerifyConnection: func(state tls.ConnectionState) error {
+				staple = state.OCSPResponse
+				if reject {
+					return errRejected
+				}
+				return nil
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := d.dialContext(ctx, "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if n := <-peerCerts; n != 1 {
+		t.Errorf("expected the client to present its certificate, got %d certificates", n)
+	}
+	if string(staple) != "ocsp-staple" {
+		t.Errorf("expected the verification to see the stapled OCSP response, got %q", staple)
+	}
+
+	reject = true
+	if _, err := d.dialContext(ctx, "tcp", l.Addr().String()); !errors.Is(err, errRejected) {
+		t.Errorf("expected the connection to be rejected by the verification, got %v", err)
+	}
+}
+
 func TestDialerResolver(t *testing.T) {
 	ctx := context.TODO()
 
@@ -401,3 +610,352 @@ func (mr *mockResolver) LookupHost(ctx context.Context, host string) ([]string,
 		return addrs, nil
 	}
 }
+
+func TestDialerProxy(t *testing.T) {
+	tests := []struct {
+		scenario string
+		scheme   string
+		serve    func(net.Conn) (string, error)
+		address  string
+		target   string
+	}{
+		{
+			scenario: "http connect",
+			scheme:   "http",
+			serve:    serveHTTPConnect,
+			address:  "broker.example.com:9092",
+			target:   "broker.example.com:9092",
+		},
+		{
+			scenario: "socks5 resolves host names locally",
+			scheme:   "socks5",
+			serve:    serveSOCKS5,
+			address:  "localhost:9092",
+		},
+		{
+			scenario: "socks5h lets the proxy resolve host names",
+			scheme:   "socks5h",
+			serve:    serveSOCKS5,
+			address:  "broker.example.com:9092",
+			target:   "broker.example.com:9092",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			targets := make(chan string, 1)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+
+				target, err := test.serve(conn)
+				targets <- target
+				if err != nil {
+					return
+				}
+
+				upstream, err := broker.Dial(context.Background(), "tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+
+			d := &Dialer{
+				Timeout: 5 * time.Second,
+				Proxy:   &url.URL{Scheme: test.scheme, Host: l.Addr().String()},
+			}
+
+			conn, err := d.DialContext(context.Background(), "tcp", test.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			target := <-targets
+			switch {
+			case test.target != "":
+				if target != test.target {
+					t.Errorf("expected the proxy to connect to %s but got %s", test.target, target)
+				}
+			default:
+				host, _, _ := net.SplitHostPort(target)
+				if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+					t.Errorf("expected the proxy to connect to the resolved address of %s but got %s", test.address, target)
+				}
+			}
+
+			if _, err := conn.ApiVersions(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDialerProxyUnsupportedScheme(t *testing.T) {
+	d := &Dialer{Proxy: &url.URL{Scheme: "ftp", Host: "localhost:21"}}
+
+	if _, err := d.Dial("tcp", "localhost:9092"); err == nil {
+		t.Error("expected an error when dialing through a proxy with an unsupported scheme")
+	}
+}
+
+type noDelayConn struct {
+	net.Conn
+	noDelay []bool
+}
+
+func (c *noDelayConn) SetNoDelay(noDelay bool) error {
+	c.noDelay = append(c.noDelay, noDelay)
+	return nil
+}
+
+func TestDialerDisableNoDelay(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("DisableNoDelay=%t", disable), func(t *testing.T) {
+			var conns []*noDelayConn
+			d := &Dialer{
+				DisableNoDelay: disable,
+				DialFunc: func(context.Context, string, string) (net.Conn, error) {
+					client, server := net.Pipe()
+					server.Close()
+					c := &noDelayConn{Conn: client}
+					conns = append(conns, c)
+					return c, nil
+				},
+			}
+
+			ctx := context.Background()
+			if c, err := d.dialContext(ctx, "tcp", "localhost:9092"); err != nil {
+				t.Fatal(err)
+			} else {
+				c.Close()
+			}
+			if c, err := d.transport(0, 0, func(time.Duration) {}).Dial(ctx, "tcp", "localhost:9092"); err != nil {
+				t.Fatal(err)
+			} else {
+				c.Close()
+			}
+
+			for _, c := range conns {
+				want := []bool(nil)
+				if disable {
+					want = []bool{false}
+				}
+				if !reflect.DeepEqual(c.noDelay, want) {
+					t.Errorf("unexpected calls to SetNoDelay: want %v, got %v", want, c.noDelay)
+				}
+			}
+		})
+	}
+
+	// The option is applied to the TCP connections opened by the dialer.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	d := &Dialer{DisableNoDelay: true, KeepAlive: time.Second}
+	c, err := d.dialContext(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestDialerSASLHandshakeVersions(t *testing.T) {
+	mechanism := plain.Mechanism{Username: "user", Password: "pass"}
+
+	for _, version := range []int16{0, 1} {
+		version := version
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			errs := make(chan error, 1)
+			go func() { errs <- serveSASL(server, version, []byte("\x00user\x00pass")) }()
+
+			d := &Dialer{
+				SASLMechanism: mechanism,
+				DialFunc: func(context.Context, string, string) (net.Conn, error) {
+					return client, nil
+				},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			conn, err := d.DialContext(ctx, "tcp", "127.0.0.1:9092")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// serveSASL implements the broker side of a SASL exchange with a single
+// authentication round, advertising the given version of the SaslHandshake
+// API. Brokers negotiating v0 (Kafka 0.10) expect the authentication bytes as
+// an opaque size-prefixed blob, newer brokers expect them to be wrapped in a
+// SaslAuthenticate request.
+func serveSASL(conn net.Conn, handshakeVersion int16, expected []byte) error {
+	apiVersion, id, _, msg, err := protocol.ReadRequest(conn)
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(*apiversions.Request); !ok {
+		return fmt.Errorf("expected an ApiVersions request but got %T", msg)
+	}
+
+	apiKeys := []apiversions.ApiKeyResponse{
+		{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 1},
+		{ApiKey: int16(protocol.ApiVersions), MinVersion: 0, MaxVersion: 0},
+		{ApiKey: int16(protocol.SaslHandshake), MinVersion: 0, MaxVersion: handshakeVersion},
+	}
+	if handshakeVersion > 0 {
+		apiKeys = append(apiKeys, apiversions.ApiKeyResponse{
+			ApiKey: int16(protocol.SaslAuthenticate), MinVersion: 0, MaxVersion: 0,
+		})
+	}
+
+	if err := protocol.WriteResponse(conn, apiVersion, id, &apiversions.Response{ApiKeys: apiKeys}); err != nil {
+		return err
+	}
+
+	apiVersion, id, _, msg, err = protocol.ReadRequest(conn)
+	if err != nil {
+		return err
+	}
+	if _, ok := msg.(*saslhandshake.Request); !ok {
+		return fmt.Errorf("expected a SaslHandshake request but got %T", msg)
+	}
+	if apiVersion != handshakeVersion {
+		return fmt.Errorf("expected SaslHandshake v%d but got v%d", handshakeVersion, apiVersion)
+	}
+
+	res := &saslhandshake.Response{Mechanisms: []string{"PLAIN"}}
+	if err := protocol.WriteResponse(conn, apiVersion, id, res); err != nil {
+		return err
+	}
+
+	var authBytes []byte
+
+	if handshakeVersion == 0 {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return err
+		}
+		authBytes = make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, authBytes); err != nil {
+			return err
+		}
+		// An empty response completes the exchange.
+		if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+			return err
+		}
+	} else {
+		apiVersion, id, _, msg, err = protocol.ReadRequest(conn)
+		if err != nil {
+			return err
+		}
+		req, ok := msg.(*saslauthenticate.Request)
+		if !ok {
+			return fmt.Errorf("expected a SaslAuthenticate request but got %T", msg)
+		}
+		authBytes = req.AuthBytes
+		if err := protocol.WriteResponse(conn, apiVersion, id, &saslauthenticate.Response{}); err != nil {
+			return err
+		}
+	}
+
+	if string(authBytes) != string(expected) {
+		return fmt.Errorf("unexpected authentication bytes: %q", authBytes)
+	}
+	return nil
+}
+
+// serveHTTPConnect reads a CONNECT request and accepts it, returning the
+// address the client asked to connect to.
+func serveHTTPConnect(conn net.Conn) (string, error) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return "", err
+	}
+	if req.Method != http.MethodConnect {
+		return "", fmt.Errorf("unexpected method: %s", req.Method)
+	}
+	_, err = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host, err
+}
+
+// serveSOCKS5 implements the server side of a SOCKS5 handshake without
+// authentication, returning the address the client asked to connect to.
+func serveSOCKS5(conn net.Conn) (string, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return "", err
+	}
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return "", err
+	}
+
+	var request [4]byte
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch request[3] {
+	case 1: // IPv4
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case 3: // domain name
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", fmt.Errorf("unsupported address type: %d", request[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+
+	_, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), err
+}
@@ -101,6 +101,10 @@ const (
 	GroupSubscribedToTopic             Error = 86
 	InvalidRecord                      Error = 87
 	UnstableOffsetCommit               Error = 88
+	FencedMemberEpoch                  Error = 110
+	UnreleasedInstanceID               Error = 111
+	UnsupportedAssignor                Error = 112
+	StaleMemberEpoch                   Error = 113
 )
 
 // Error satisfies the error interface.
@@ -317,6 +321,14 @@ func (e Error) Title() string {
 		return "Invalid Record"
 	case UnstableOffsetCommit:
 		return "Unstable Offset Commit"
+	case FencedMemberEpoch:
+		return "Fenced Member Epoch"
+	case UnreleasedInstanceID:
+		return "Unreleased Instance ID"
+	case UnsupportedAssignor:
+		return "Unsupported Assignor"
+	case StaleMemberEpoch:
+		return "Stale Member Epoch"
 	}
 	return ""
 }
@@ -488,6 +500,14 @@ func (e Error) Description() string {
 		return "this record has failed the validation on broker and hence be rejected"
 	case UnstableOffsetCommit:
 		return "there are unstable offsets that need to be cleared"
+	case FencedMemberEpoch:
+		return "the member epoch is fenced by the group coordinator, the member must abandon all its partitions and rejoin"
+	case UnreleasedInstanceID:
+		return "the instance ID is still used by another member in the consumer group, that member must leave first"
+	case UnsupportedAssignor:
+		return "the assignor or its version range is not supported by the consumer group"
+	case StaleMemberEpoch:
+		return "the member epoch is stale, the member must retry after receiving its updated member epoch via the consumer group heartbeat API"
 	}
 	return ""
 }
@@ -557,6 +577,114 @@ func (e MessageTooLargeError) Error() string {
 	return MessageSizeTooLarge.Error()
 }
 
+// RecordTooLargeError is reported by readers when the next record of a
+// partition does not fit in the maximum size of a fetch, and the fetch size
+// cannot be increased further, see ReaderConfig.MaxRecordBytes.
+//
+// The reader keeps retrying the fetch, the program may skip the record by
+// setting the offset of the reader past it.
+type RecordTooLargeError struct {
+	Topic     string
+	Partition int
+	Offset    int64
+
+	// The size of the last fetch.
+	MaxBytes int
+}
+
+func (e RecordTooLargeError) Error() string {
+	return fmt.Sprintf("the record at offset %d of partition %d of %s does not fit in a fetch of %d bytes: %s",
+		e.Offset, e.Partition, e.Topic, e.MaxBytes, MessageSizeTooLarge)
+}
+
+func (e RecordTooLargeError) Unwrap() error { return MessageSizeTooLarge }
+
+// UnsupportedCodecError is returned when reading a batch of messages which was
+// compressed with a codec that is unknown, or whose package has not been
+// imported by the program.
+//
+// The error wraps an error that the reader recognizes as fatal, the reader
+// returns it to the program and cannot read past the batch by itself.
+type UnsupportedCodecError struct {
+	// The compression code found in the attributes of the batch.
+	Codec int8
+
+	Topic     string
+	Partition int
+
+	// The first offset of the batch.
+	Offset int64
+}
+
+func (e UnsupportedCodecError) Error() string {
+	return fmt.Sprintf("unsupported compression codec %d in batch at offset %d of partition %d of %s: %s",
+		e.Codec, e.Offset, e.Partition, e.Topic, errUnknownCodec)
+}
+
+func (e UnsupportedCodecError) Unwrap() error { return errUnknownCodec }
+
+// NotEnoughReplicasError is returned by writers when messages could not be
+// written because the partition had fewer in-sync replicas than required by
+// the min.insync.replicas configuration of the topic.
+//
+// The error is temporary, the writes may succeed once the replicas caught up
+// with the partition leader. When Err is NotEnoughReplicasAfterAppend, the
+// messages were written to the leader but not replicated, writing them again
+// may produce duplicates.
+type NotEnoughReplicasError struct {
+	// Either NotEnoughReplicas or NotEnoughReplicasAfterAppend.
+	Err Error
+
+	Topic     string
+	Partition int
+
+	// The number of attempts made to write the messages.
+	Attempts int
+}
+
+func (e NotEnoughReplicasError) Error() string {
+	return fmt.Sprintf("%s (topic %s, partition %d, %d attempts)", e.Err.Error(), e.Topic, e.Partition, e.Attempts)
+}
+
+func (e NotEnoughReplicasError) Unwrap() error { return e.Err }
+
+func (e NotEnoughReplicasError) Temporary() bool { return true }
+
+func isNotEnoughReplicas(err error) bool {
+	return errors.Is(err, NotEnoughReplicas) || errors.Is(err, NotEnoughReplicasAfterAppend)
+}
+
+// DeliveryTimeoutError is returned by writers when messages could not be
+// delivered before the DeliveryTimeout of the writer expired.
+type DeliveryTimeoutError struct {
+	// The error of the last attempt to write the messages, nil if the timeout
+	// expired before the first attempt.
+	Err error
+
+	Topic     string
+	Partition int
+
+	// The number of attempts made to write the messages.
+	Attempts int
+}
+
+func (e DeliveryTimeoutError) Error() string {
+	s := fmt.Sprintf("delivery timeout expired writing messages to %s (partition %d, %d attempts)", e.Topic, e.Partition, e.Attempts)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e DeliveryTimeoutError) Unwrap() error { return e.Err }
+
+func (e DeliveryTimeoutError) Timeout() bool { return true }
+
+func isDeliveryTimeout(err error) bool {
+	var e DeliveryTimeoutError
+	return errors.As(err, &e)
+}
+
 func makeError(code int16, message string) error {
 	if code == 0 {
 		return nil
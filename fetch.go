@@ -86,7 +86,26 @@ type FetchResponse struct {
 // If the broker returned an invalid response with no partitions, an error
 // wrapping ErrNoPartitions is returned.
 func (c *Client) Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse, error) {
-	timeout := c.timeout(ctx, math.MaxInt64)
+	return c.fetch(ctx, req, nil)
+}
+
+// FetchReplica sends a fetch request to the broker with the given id, which may
+// host a follower replica of the partition, and returns the records that this
+// replica has, bypassing the routing of the request to the partition leader.
+//
+// This method is meant to be used by debugging and verification tools, for
+// example to compare the contents of the replicas of a partition. Programs
+// consuming messages must use Fetch. The request uses the replica id that kafka
+// reserves for debugging consumers, followers may return records which were
+// not committed yet. The FirstOffset and LastOffset constants are resolved by
+// the partition leader.
+func (c *Client) FetchReplica(ctx context.Context, req *FetchRequest, brokerID int) (*FetchResponse, error) {
+	id := int32(brokerID)
+	return c.fetch(ctx, req, &id)
+}
+
+func (c *Client) fetch(ctx context.Context, req *FetchRequest, brokerID *int32) (*FetchResponse, error) {
+	timeout := c.timeout(ctx, protocol.Fetch, math.MaxInt64)
 	maxWait := req.maxWait()
 
 	if maxWait < timeout {
@@ -127,8 +146,13 @@ func (c *Client) Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse,
 		}
 	}
 
+	replicaID := int32(-1)
+	if brokerID != nil {
+		replicaID = fetchAPI.DebuggingReplicaID
+	}
+
 	m, err := c.roundTrip(ctx, req.Addr, &fetchAPI.Request{
-		ReplicaID:      -1,
+		ReplicaID:      replicaID,
 		MaxWaitTime:    milliseconds(timeout),
 		MinBytes:       int32(req.MinBytes),
 		MaxBytes:       int32(req.MaxBytes),
@@ -145,6 +169,7 @@ func (c *Client) Fetch(ctx context.Context, req *FetchRequest) (*FetchResponse,
 				PartitionMaxBytes:  int32(req.MaxBytes),
 			}},
 		}},
+		BrokerID: brokerID,
 	})
 
 	if err != nil {
@@ -30,6 +30,14 @@ type GroupBalancer interface {
 	//
 	// Will be used by JoinGroup to begin the consumer group handshake.
 	//
+	// The user data is opaque to kafka, it is received by the group leader in
+	// the UserData field of each GroupMember passed to AssignGroups. Balancers
+	// should prefix it with a version of their own encoding since members
+	// running different versions of a program may be part of the same group.
+	// The metadata of all members is sent to the leader in a single JoinGroup
+	// response, so the total size must remain well below the broker's
+	// message.max.bytes and socket.request.max.bytes limits.
+	//
 	// See https://cwiki.apache.org/confluence/display/KAFKA/A+Guide+To+The+Kafka+Protocol#AGuideToTheKafkaProtocol-JoinGroupRequest
 	UserData() ([]byte, error)
 
@@ -38,6 +46,31 @@ type GroupBalancer interface {
 	AssignGroups(members []GroupMember, partitions []Partition) GroupMemberAssignments
 }
 
+// AssignmentUserDataBalancer is an optional interface which may be implemented
+// by a GroupBalancer to read and write the user data embedded in the member
+// assignments distributed by the group leader in SyncGroup.
+//
+// Combined with UserData, it lets stateful balancers remember previous
+// assignments across rebalances: the leader attaches state to each assignment,
+// members receive it in OnAssignment, and send it back in the UserData of the
+// next JoinGroup request, which the leader then sees in GroupMember.UserData.
+//
+// The same encoding and size expectations as GroupBalancer.UserData apply to
+// the user data of assignments.
+type AssignmentUserDataBalancer interface {
+	GroupBalancer
+
+	// AssignmentUserData is called on the group leader after AssignGroups,
+	// it returns the user data to send to each member along with their
+	// assignment, keyed by member ID. Members which are absent from the
+	// returned map receive no user data.
+	AssignmentUserData(assignments GroupMemberAssignments) (map[string][]byte, error)
+
+	// OnAssignment is called on every member of the group once it received
+	// its assignment from the group leader, with the user data attached to it.
+	OnAssignment(memberID string, generationID int32, assignment map[string][]int, userData []byte)
+}
+
 // RangeGroupBalancer groups consumers by partition
 //
 // Example: 5 partitions, 2 consumers
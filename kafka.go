@@ -21,6 +21,12 @@ type Topic struct {
 	// The list of partition currently available on this topic.
 	Partitions []Partition
 
+	// The operations that the client is authorized to perform on the topic.
+	//
+	// This field is only set by Client.Metadata when the request has
+	// IncludeTopicAuthorizedOperations set, and requires kafka 2.3 or above.
+	AuthorizedOperations ACLOperations
+
 	// An error that may have occurred while attempting to read the topic
 	// metadata.
 	//
@@ -38,10 +44,27 @@ type Partition struct {
 	ID    int
 
 	// Leader, replicas, and ISR for the partition.
+	//
+	// When the partition has no leader, or a replica is on a broker which is
+	// not part of the cluster metadata, only the ID of the broker is set, and
+	// is -1 for a missing leader.
 	Leader   Broker
 	Replicas []Broker
 	Isr      []Broker
 
+	// Replicas of the partition on brokers which are offline.
+	//
+	// This field is only set by Client.Metadata, and requires kafka 1.0 or
+	// above.
+	OfflineReplicas []Broker
+
+	// The epoch of the partition leader, which is incremented each time a new
+	// leader is elected.
+	//
+	// This field is only set by Client.Metadata, and requires kafka 2.1 or
+	// above, it is zero otherwise.
+	LeaderEpoch int
+
 	// An error that may have occurred while attempting to read the partition
 	// metadata.
 	//
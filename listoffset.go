@@ -3,10 +3,12 @@ package kafka
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
 	"github.com/segmentio/kafka-go/protocol/listoffsets"
 )
 
@@ -28,12 +30,52 @@ func LastOffsetOf(partition int) OffsetRequest {
 	return OffsetRequest{Partition: partition, Timestamp: LastOffset}
 }
 
+// MaxTimestamp is the special timestamp of offset requests asking for the
+// offset of the message with the largest timestamp of a partition, which may
+// not be the last message when producers set the message times.
+//
+// Requesting this offset requires the kafka broker to support the ListOffsets
+// API in version 7 or above (kafka 3.0).
+const MaxTimestamp = listoffsets.MaxTimestamp
+
+// MaxTimestampOffsetOf constructs an OffsetRequest which asks for the offset
+// of the message with the largest timestamp of the partition given as argument.
+func MaxTimestampOffsetOf(partition int) OffsetRequest {
+	return OffsetRequest{Partition: partition, Timestamp: MaxTimestamp}
+}
+
 // TimeOffsetOf constructs an OffsetRequest which asks for a partition offset
 // at a given time.
 func TimeOffsetOf(partition int, at time.Time) OffsetRequest {
 	return OffsetRequest{Partition: partition, Timestamp: timestamp(at)}
 }
 
+// ListOffsetRequestPartition is a request to retrieve the offset of a partition
+// at a timestamp, requests for multiple timestamps of the same partition can be
+// sent in a single ListOffsetsRequest.
+type ListOffsetRequestPartition struct {
+	Topic     string
+	Partition int
+
+	// The time in milliseconds since the unix epoch to look up the offset at,
+	// or one of the FirstOffset, LastOffset, or MaxTimestamp special values.
+	Timestamp int64
+}
+
+// ListOffsetResponsePartition is the result of a ListOffsetRequestPartition.
+type ListOffsetResponsePartition struct {
+	Topic     string
+	Partition int
+	Timestamp int64
+
+	// The offset of the first message written at or after the timestamp, or
+	// -1 if there are none.
+	Offset int64
+
+	// An error that may have occurred while looking up the offset.
+	Error error
+}
+
 // PartitionOffsets carries information about offsets available in a topic
 // partition.
 type PartitionOffsets struct {
@@ -42,6 +84,12 @@ type PartitionOffsets struct {
 	LastOffset  int64
 	Offsets     map[int64]time.Time
 	Error       error
+
+	// Offset and timestamp of the message with the largest timestamp of the
+	// partition, when it was requested with MaxTimestampOffsetOf. The offset
+	// is -1 when the partition is empty, or the offset was not requested.
+	MaxTimestampOffset int64
+	MaxTimestamp       time.Time
 }
 
 // ListOffsetsRequest represents a request sent to a kafka broker to list of the
@@ -54,6 +102,16 @@ type ListOffsetsRequest struct {
 	// get the offsets for.
 	Topics map[string][]OffsetRequest
 
+	// A list of partitions and timestamps to get the offsets of, the results
+	// are returned in the Partitions field of the response. Unlike Topics,
+	// the offsets of a partition can be requested at multiple timestamps.
+	//
+	// All the offsets of partitions led by the same broker are requested in
+	// a single round trip, unless multiple timestamps are requested for the
+	// same partition, since kafka brokers only answer one for each partition
+	// of a request.
+	Partitions []ListOffsetRequestPartition
+
 	// The isolation level for the request.
 	//
 	// Defaults to ReadUncommitted.
@@ -72,17 +130,32 @@ type ListOffsetsResponse struct {
 	// Mappings of topics names to partition offsets, there will be one entry
 	// for each topic in the request.
 	Topics map[string][]PartitionOffsets
+
+	// The offsets requested by the Partitions field of the request, in the
+	// same order.
+	Partitions []ListOffsetResponsePartition
 }
 
 // ListOffsets sends an offset request to a kafka broker and returns the
 // response.
+//
+// The method returns an error if MaxTimestamp offsets are requested from a
+// broker which does not support them.
 func (c *Client) ListOffsets(ctx context.Context, req *ListOffsetsRequest) (*ListOffsetsResponse, error) {
 	type topicPartition struct {
 		topic     string
 		partition int
 	}
 
+	// Offsets requested multiple times, by the Topics and Partitions fields
+	// of the request, are only sent once.
+	type offsetRequest struct {
+		topicPartition
+		timestamp int64
+	}
+
 	partitionOffsets := make(map[topicPartition]PartitionOffsets)
+	requested := make(map[offsetRequest]struct{})
 
 	for topicName, requests := range req.Topics {
 		for _, r := range requests {
@@ -94,10 +167,11 @@ func (c *Client) ListOffsets(ctx context.Context, req *ListOffsetsRequest) (*Lis
 			partition, ok := partitionOffsets[key]
 			if !ok {
 				partition = PartitionOffsets{
-					Partition:   r.Partition,
-					FirstOffset: -1,
-					LastOffset:  -1,
-					Offsets:     make(map[int64]time.Time),
+					Partition:          r.Partition,
+					FirstOffset:        -1,
+					LastOffset:         -1,
+					Offsets:            make(map[int64]time.Time),
+					MaxTimestampOffset: -1,
 				}
 			}
 
@@ -106,73 +180,167 @@ func (c *Client) ListOffsets(ctx context.Context, req *ListOffsetsRequest) (*Lis
 				partition.FirstOffset = 0
 			case LastOffset:
 				partition.LastOffset = 0
+			case MaxTimestamp:
+				partition.MaxTimestampOffset = 0
 			}
 
-			partitionOffsets[topicPartition{
-				topic:     topicName,
-				partition: r.Partition,
-			}] = partition
+			partitionOffsets[key] = partition
+			requested[offsetRequest{topicPartition: key, timestamp: r.Timestamp}] = struct{}{}
 		}
 	}
 
-	topics := make([]listoffsets.RequestTopic, 0, len(req.Topics))
+	var results []ListOffsetResponsePartition
+	resultsOf := make(map[offsetRequest][]int, len(req.Partitions))
 
-	for topicName, requests := range req.Topics {
-		partitions := make([]listoffsets.RequestPartition, len(requests))
+	if len(req.Partitions) != 0 {
+		results = make([]ListOffsetResponsePartition, len(req.Partitions))
+	}
 
-		for i, r := range requests {
-			partitions[i] = listoffsets.RequestPartition{
-				Partition:          int32(r.Partition),
-				CurrentLeaderEpoch: -1,
-				Timestamp:          r.Timestamp,
-			}
+	for i, p := range req.Partitions {
+		results[i] = ListOffsetResponsePartition{
+			Topic:     p.Topic,
+			Partition: p.Partition,
+			Timestamp: p.Timestamp,
+			Offset:    -1,
+		}
+		key := offsetRequest{
+			topicPartition: topicPartition{topic: p.Topic, partition: p.Partition},
+			timestamp:      p.Timestamp,
 		}
+		resultsOf[key] = append(resultsOf[key], i)
+	}
 
-		topics = append(topics, listoffsets.RequestTopic{
-			Topic:      topicName,
-			Partitions: partitions,
+	// The responses to MaxTimestamp requests carry the timestamp of the
+	// message instead of the requested timestamp, they are sent separately so
+	// they can be told apart from the other responses.
+	partitions := make(map[string][]listoffsets.RequestPartition)
+	maxTimestampPartitions := make(map[string][]listoffsets.RequestPartition)
+	sent := make(map[offsetRequest]struct{}, len(requested)+len(resultsOf))
+
+	addPartition := func(key offsetRequest) {
+		if _, ok := sent[key]; ok {
+			return
+		}
+		sent[key] = struct{}{}
+
+		p := listoffsets.RequestPartition{
+			Partition:          int32(key.partition),
+			CurrentLeaderEpoch: -1,
+			Timestamp:          key.timestamp,
+		}
+		if key.timestamp == MaxTimestamp {
+			maxTimestampPartitions[key.topic] = append(maxTimestampPartitions[key.topic], p)
+		} else {
+			partitions[key.topic] = append(partitions[key.topic], p)
+		}
+	}
+
+	for topicName, requests := range req.Topics {
+		for _, r := range requests {
+			addPartition(offsetRequest{
+				topicPartition: topicPartition{topic: topicName, partition: r.Partition},
+				timestamp:      r.Timestamp,
+			})
+		}
+	}
+
+	for _, p := range req.Partitions {
+		addPartition(offsetRequest{
+			topicPartition: topicPartition{topic: p.Topic, partition: p.Partition},
+			timestamp:      p.Timestamp,
 		})
 	}
 
-	m, err := c.roundTrip(ctx, req.Addr, &listoffsets.Request{
-		ReplicaID:      -1,
-		IsolationLevel: int8(req.IsolationLevel),
-		Topics:         topics,
-	})
+	topics := makeListOffsetsRequestTopics(partitions)
+	maxTimestampTopics := makeListOffsetsRequestTopics(maxTimestampPartitions)
 
-	if err != nil {
-		return nil, fmt.Errorf("kafka.(*Client).ListOffsets: %w", err)
+	if len(maxTimestampTopics) != 0 {
+		supported, err := c.supportsApiVersion(ctx, req.Addr, protocol.ListOffsets, 7)
+		if err != nil {
+			return nil, fmt.Errorf("kafka.(*Client).ListOffsets: %w", err)
+		}
+		if !supported {
+			return nil, errors.New("kafka.(*Client).ListOffsets: the broker does not support requesting the offset of the max timestamp, it requires kafka 3.0 or above")
+		}
 	}
 
-	res := m.(*listoffsets.Response)
 	ret := &ListOffsetsResponse{
-		Throttle: makeDuration(res.ThrottleTimeMs),
-		Topics:   make(map[string][]PartitionOffsets, len(res.Topics)),
+		Topics:     make(map[string][]PartitionOffsets, len(req.Topics)),
+		Partitions: results,
 	}
 
-	for _, t := range res.Topics {
-		for _, p := range t.Partitions {
-			key := topicPartition{
-				topic:     t.Topic,
-				partition: int(p.Partition),
-			}
+	for _, r := range []struct {
+		topics       []listoffsets.RequestTopic
+		maxTimestamp bool
+	}{
+		{topics: topics},
+		{topics: maxTimestampTopics, maxTimestamp: true},
+	} {
+		if len(r.topics) == 0 {
+			continue
+		}
 
-			partition := partitionOffsets[key]
+		m, err := c.roundTrip(ctx, req.Addr, &listoffsets.Request{
+			ReplicaID:      -1,
+			IsolationLevel: int8(req.IsolationLevel),
+			Topics:         r.topics,
+		})
 
-			switch p.Timestamp {
-			case FirstOffset:
-				partition.FirstOffset = p.Offset
-			case LastOffset:
-				partition.LastOffset = p.Offset
-			default:
-				partition.Offsets[p.Offset] = makeTime(p.Timestamp)
-			}
+		if err != nil {
+			return nil, fmt.Errorf("kafka.(*Client).ListOffsets: %w", err)
+		}
 
-			if p.ErrorCode != 0 {
-				partition.Error = Error(p.ErrorCode)
-			}
+		res := m.(*listoffsets.Response)
+		if throttle := makeDuration(res.ThrottleTimeMs); throttle > ret.Throttle {
+			ret.Throttle = throttle
+		}
 
-			partitionOffsets[key] = partition
+		for _, t := range res.Topics {
+			for _, p := range t.Partitions {
+				key := offsetRequest{
+					topicPartition: topicPartition{
+						topic:     t.Topic,
+						partition: int(p.Partition),
+					},
+					timestamp: p.Timestamp,
+				}
+				if r.maxTimestamp {
+					key.timestamp = MaxTimestamp
+				}
+
+				for _, i := range resultsOf[key] {
+					results[i].Offset = p.Offset
+					if p.ErrorCode != 0 {
+						results[i].Error = Error(p.ErrorCode)
+					}
+				}
+
+				if _, ok := requested[key]; !ok {
+					continue
+				}
+
+				partition := partitionOffsets[key.topicPartition]
+
+				switch {
+				case r.maxTimestamp:
+					partition.MaxTimestampOffset = p.Offset
+					if p.Offset >= 0 {
+						partition.MaxTimestamp = makeTime(p.Timestamp)
+					}
+				case p.Timestamp == FirstOffset:
+					partition.FirstOffset = p.Offset
+				case p.Timestamp == LastOffset:
+					partition.LastOffset = p.Offset
+				default:
+					partition.Offsets[p.Offset] = makeTime(p.Timestamp)
+				}
+
+				if p.ErrorCode != 0 {
+					partition.Error = Error(p.ErrorCode)
+				}
+
+				partitionOffsets[key.topicPartition] = partition
+			}
 		}
 	}
 
@@ -183,6 +351,17 @@ func (c *Client) ListOffsets(ctx context.Context, req *ListOffsetsRequest) (*Lis
 	return ret, nil
 }
 
+func makeListOffsetsRequestTopics(partitions map[string][]listoffsets.RequestPartition) []listoffsets.RequestTopic {
+	topics := make([]listoffsets.RequestTopic, 0, len(partitions))
+	for topicName, p := range partitions {
+		topics = append(topics, listoffsets.RequestTopic{
+			Topic:      topicName,
+			Partitions: p,
+		})
+	}
+	return topics
+}
+
 type listOffsetRequestV1 struct {
 	ReplicaID int32
 	Topics    []listOffsetRequestTopicV1
@@ -284,3 +463,99 @@ func (p *partitionOffsetV1) readFrom(r *bufio.Reader, sz int) (remain int, err e
 	}
 	return
 }
+
+type listOffsetRequestV4 struct {
+	ReplicaID      int32
+	IsolationLevel int8
+	Topics         []listOffsetRequestTopicV4
+}
+
+func (r listOffsetRequestV4) size() int32 {
+	return 4 + 1 + sizeofArray(len(r.Topics), func(i int) int32 { return r.Topics[i].size() })
+}
+
+func (r listOffsetRequestV4) writeTo(wb *writeBuffer) {
+	wb.writeInt32(r.ReplicaID)
+	wb.writeInt8(r.IsolationLevel)
+	wb.writeArray(len(r.Topics), func(i int) { r.Topics[i].writeTo(wb) })
+}
+
+type listOffsetRequestTopicV4 struct {
+	TopicName  string
+	Partitions []listOffsetRequestPartitionV4
+}
+
+func (t listOffsetRequestTopicV4) size() int32 {
+	return sizeofString(t.TopicName) +
+		sizeofArray(len(t.Partitions), func(i int) int32 { return t.Partitions[i].size() })
+}
+
+func (t listOffsetRequestTopicV4) writeTo(wb *writeBuffer) {
+	wb.writeString(t.TopicName)
+	wb.writeArray(len(t.Partitions), func(i int) { t.Partitions[i].writeTo(wb) })
+}
+
+type listOffsetRequestPartitionV4 struct {
+	Partition          int32
+	CurrentLeaderEpoch int32
+	Time               int64
+}
+
+func (p listOffsetRequestPartitionV4) size() int32 {
+	return 4 + 4 + 8
+}
+
+func (p listOffsetRequestPartitionV4) writeTo(wb *writeBuffer) {
+	wb.writeInt32(p.Partition)
+	wb.writeInt32(p.CurrentLeaderEpoch)
+	wb.writeInt64(p.Time)
+}
+
+type listOffsetResponseV4 struct {
+	ThrottleTimeMS int32
+	Topics         []listOffsetResponseTopicV4
+}
+
+func (r listOffsetResponseV4) size() int32 {
+	return 4 + sizeofArray(len(r.Topics), func(i int) int32 { return r.Topics[i].size() })
+}
+
+func (r listOffsetResponseV4) writeTo(wb *writeBuffer) {
+	wb.writeInt32(r.ThrottleTimeMS)
+	wb.writeArray(len(r.Topics), func(i int) { r.Topics[i].writeTo(wb) })
+}
+
+type listOffsetResponseTopicV4 struct {
+	TopicName        string
+	PartitionOffsets []partitionOffsetV4
+}
+
+func (t listOffsetResponseTopicV4) size() int32 {
+	return sizeofString(t.TopicName) +
+		sizeofArray(len(t.PartitionOffsets), func(i int) int32 { return t.PartitionOffsets[i].size() })
+}
+
+func (t listOffsetResponseTopicV4) writeTo(wb *writeBuffer) {
+	wb.writeString(t.TopicName)
+	wb.writeArray(len(t.PartitionOffsets), func(i int) { t.PartitionOffsets[i].writeTo(wb) })
+}
+
+type partitionOffsetV4 struct {
+	Partition   int32
+	ErrorCode   int16
+	Timestamp   int64
+	Offset      int64
+	LeaderEpoch int32
+}
+
+func (p partitionOffsetV4) size() int32 {
+	return 4 + 2 + 8 + 8 + 4
+}
+
+func (p partitionOffsetV4) writeTo(wb *writeBuffer) {
+	wb.writeInt32(p.Partition)
+	wb.writeInt16(p.ErrorCode)
+	wb.writeInt64(p.Timestamp)
+	wb.writeInt64(p.Offset)
+	wb.writeInt32(p.LeaderEpoch)
+}
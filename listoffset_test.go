@@ -2,8 +2,15 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"net"
 	"testing"
 	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/listoffsets"
+	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
 func TestClientListOffsets(t *testing.T) {
@@ -74,3 +81,146 @@ func TestClientListOffsets(t *testing.T) {
 		t.Error("unexpected error in list offsets response:", partition.Error)
 	}
 }
+
+func TestClientListOffsetsMaxTimestamp(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+
+	newClient := func(maxVersion int16) *Client {
+		return &Client{
+			Addr: TCP("localhost:9092"),
+			Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+				switch r := req.(type) {
+				case *apiversions.Request:
+					return &apiversions.Response{
+						ApiKeys: []apiversions.ApiKeyResponse{
+							{ApiKey: int16(protocol.ListOffsets), MinVersion: 1, MaxVersion: maxVersion},
+						},
+					}, nil
+				case *listoffsets.Request:
+					res := &listoffsets.Response{}
+					for _, t := range r.Topics {
+						topic := listoffsets.ResponseTopic{Topic: t.Topic}
+						for _, p := range t.Partitions {
+							switch p.Timestamp {
+							case listoffsets.MaxTimestamp:
+								topic.Partitions = append(topic.Partitions, listoffsets.ResponsePartition{
+									Partition: p.Partition,
+									Timestamp: now.UnixNano() / int64(time.Millisecond),
+									Offset:    42,
+								})
+							default:
+								topic.Partitions = append(topic.Partitions, listoffsets.ResponsePartition{
+									Partition: p.Partition,
+									Timestamp: p.Timestamp,
+									Offset:    100,
+								})
+							}
+						}
+						res.Topics = append(res.Topics, topic)
+					}
+					return res, nil
+				}
+				return nil, errors.New("unexpected request")
+			}),
+		}
+	}
+
+	req := &ListOffsetsRequest{
+		Topics: map[string][]OffsetRequest{
+			"topic-A": {LastOffsetOf(0), MaxTimestampOffsetOf(0)},
+		},
+	}
+
+	res, err := newClient(7).ListOffsets(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	partitions := res.Topics["topic-A"]
+	if len(partitions) != 1 {
+		t.Fatalf("expected offsets of 1 partition but got %d", len(partitions))
+	}
+	p := partitions[0]
+	if p.LastOffset != 100 {
+		t.Errorf("expected the last offset to be 100 but got %d", p.LastOffset)
+	}
+	if p.MaxTimestampOffset != 42 {
+		t.Errorf("expected the offset of the max timestamp to be 42 but got %d", p.MaxTimestampOffset)
+	}
+	if !p.MaxTimestamp.Equal(now) {
+		t.Errorf("expected the max timestamp to be %s but got %s", now, p.MaxTimestamp)
+	}
+
+	if _, err := newClient(5).ListOffsets(context.Background(), req); err == nil {
+		t.Error("expected an error requesting the max timestamp from a broker which does not support it")
+	}
+}
+
+func TestClientListOffsetsPartitions(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := &Client{Addr: TCP("localhost:9092"), Transport: &Transport{Dial: broker.Dial}}
+	t0 := time.Now().Truncate(time.Millisecond).Add(-time.Hour)
+
+	_, err := client.Produce(ctx, &ProduceRequest{
+		Topic:        "topic-A",
+		Partition:    0,
+		RequiredAcks: -1,
+		Records: NewRecordReader(
+			Record{Time: t0, Value: NewBytes([]byte(`hello-1`))},
+			Record{Time: t0.Add(time.Minute), Value: NewBytes([]byte(`hello-2`))},
+			Record{Time: t0.Add(2 * time.Minute), Value: NewBytes([]byte(`hello-3`))},
+		),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(d time.Duration) int64 { return timestamp(t0.Add(d)) }
+
+	res, err := client.ListOffsets(ctx, &ListOffsetsRequest{
+		Topics: map[string][]OffsetRequest{
+			"topic-A": {LastOffsetOf(0)},
+		},
+		Partitions: []ListOffsetRequestPartition{
+			{Topic: "topic-A", Partition: 0, Timestamp: at(30 * time.Second)},
+			{Topic: "topic-A", Partition: 0, Timestamp: at(90 * time.Second)},
+			{Topic: "topic-A", Partition: 0, Timestamp: at(time.Hour)},
+			{Topic: "topic-A", Partition: 0, Timestamp: LastOffset},
+			{Topic: "topic-A", Partition: 1, Timestamp: FirstOffset},
+			{Topic: "topic-A", Partition: 0, Timestamp: at(30 * time.Second)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int64{1, 2, -1, 3, 0, 1}
+	if len(res.Partitions) != len(expected) {
+		t.Fatalf("expected %d results but got %d", len(expected), len(res.Partitions))
+	}
+	for i, p := range res.Partitions {
+		if p.Error != nil {
+			t.Errorf("unexpected error for partition %d at %d: %v", p.Partition, p.Timestamp, p.Error)
+		}
+		if p.Offset != expected[i] {
+			t.Errorf("expected offset %d for partition %d at %d but got %d", expected[i], p.Partition, p.Timestamp, p.Offset)
+		}
+	}
+
+	partitions := res.Topics["topic-A"]
+	if len(partitions) != 1 {
+		t.Fatalf("expected one partition in the topics of the response but got %d", len(partitions))
+	}
+	if p := partitions[0]; p.LastOffset != 3 || len(p.Offsets) != 0 {
+		t.Errorf("the offsets requested by partitions were merged with the topics: %+v", p)
+	}
+}
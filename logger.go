@@ -1,5 +1,7 @@
 package kafka
 
+import "context"
+
 // Logger interface API for log.Logger
 type Logger interface {
 	Printf(string, ...interface{})
@@ -15,3 +17,146 @@ type Logger interface {
 type LoggerFunc func(string, ...interface{})
 
 func (f LoggerFunc) Printf(msg string, args ...interface{}) { f(msg, args...) }
+
+// ContextLogger is an extension of the Logger interface implemented by loggers
+// which receive the context of the operations that log messages, allowing
+// programs to extract values like request or trace ids from it.
+//
+// Writers pass the context of the WriteMessages call that added the messages
+// being logged about, which may be canceled by the time it is passed to the
+// logger since it is only meant to carry values. When the messages of several
+// calls are written together, the message is logged once with the context of
+// each call. Readers log from background goroutines that are not tied to
+// calls made by the program, they use the Printf method.
+type ContextLogger interface {
+	Logger
+	PrintfContext(context.Context, string, ...interface{})
+}
+
+// ContextLoggerFunc is a bridge between ContextLogger and any third party
+// logger which accepts contexts.
+// Usage:
+//
+//	l := NewLogger() // some logger
+//	w := &kafka.Writer{
+//	  Logger:      kafka.ContextLoggerFunc(l.InfoContext),
+//	  ErrorLogger: kafka.ContextLoggerFunc(l.ErrorContext),
+//	}
+type ContextLoggerFunc func(context.Context, string, ...interface{})
+
+func (f ContextLoggerFunc) Printf(msg string, args ...interface{}) {
+	f(context.Background(), msg, args...)
+}
+
+func (f ContextLoggerFunc) PrintfContext(ctx context.Context, msg string, args ...interface{}) {
+	f(ctx, msg, args...)
+}
+
+// loggerWithContext returns a Logger which passes ctx to l if it is a
+// ContextLogger, otherwise l is returned unchanged.
+func loggerWithContext(ctx context.Context, l Logger) Logger {
+	if cl, ok := l.(ContextLogger); ok {
+		return &contextLogger{ctx: ctx, logger: cl}
+	}
+	return l
+}
+
+type contextLogger struct {
+	ctx    context.Context
+	logger ContextLogger
+}
+
+func (l *contextLogger) Printf(msg string, args ...interface{}) {
+	l.logger.PrintfContext(l.ctx, msg, args...)
+}
+
+// StructuredLogger is the interface of loggers which receive the attributes of
+// the messages they log, like the broker, topic, partition, offset, or
+// generation, as alternating keys and values instead of formatted into the
+// messages. It is implemented by *slog.Logger.
+//
+// Informational messages are logged at the debug level, and errors at the
+// error level.
+type StructuredLogger interface {
+	DebugContext(ctx context.Context, msg string, args ...interface{})
+	ErrorContext(ctx context.Context, msg string, args ...interface{})
+}
+
+// logAttrs are the attributes of a message passed to structured loggers, as
+// alternating keys and values.
+type logAttrs []interface{}
+
+// logger writes messages to the loggers configured on a reader, writer,
+// consumer group, transport, or dialer. The zero value discards all messages.
+type logger struct {
+	logger      Logger
+	errorLogger Logger
+	structured  StructuredLogger
+}
+
+// debug logs an informational message. The structured logger receives msg
+// with attrs, while Logger receives the message formatted with format and
+// args.
+func (l logger) debug(ctx context.Context, msg string, attrs logAttrs, format string, args ...interface{}) {
+	if l.structured != nil {
+		l.structured.DebugContext(ctx, msg, attrs...)
+	}
+	if l.logger != nil {
+		loggerWithContext(ctx, l.logger).Printf(format, args...)
+	}
+}
+
+// error logs an error message like debug, falling back to Logger if no
+// ErrorLogger was configured.
+func (l logger) error(ctx context.Context, msg string, attrs logAttrs, format string, args ...interface{}) {
+	if l.structured != nil {
+		l.structured.ErrorContext(ctx, msg, attrs...)
+	}
+	switch {
+	case l.errorLogger != nil:
+		loggerWithContext(ctx, l.errorLogger).Printf(format, args...)
+	case l.logger != nil:
+		loggerWithContext(ctx, l.logger).Printf(format, args...)
+	}
+}
+
+// debugContexts is like debug for messages about the operations of several
+// contexts. Loggers which receive contexts log the message once with each of
+// them, the others log it once.
+func (l logger) debugContexts(ctxs []context.Context, msg string, attrs logAttrs, format string, args ...interface{}) {
+	if l.structured != nil {
+		for _, ctx := range ctxs {
+			l.structured.DebugContext(ctx, msg, attrs...)
+		}
+	}
+	if l.logger != nil {
+		printfContexts(ctxs, l.logger, format, args...)
+	}
+}
+
+// errorContexts is like error for messages about the operations of several
+// contexts, see debugContexts.
+func (l logger) errorContexts(ctxs []context.Context, msg string, attrs logAttrs, format string, args ...interface{}) {
+	if l.structured != nil {
+		for _, ctx := range ctxs {
+			l.structured.ErrorContext(ctx, msg, attrs...)
+		}
+	}
+	switch {
+	case l.errorLogger != nil:
+		printfContexts(ctxs, l.errorLogger, format, args...)
+	case l.logger != nil:
+		printfContexts(ctxs, l.logger, format, args...)
+	}
+}
+
+func printfContexts(ctxs []context.Context, l Logger, format string, args ...interface{}) {
+	cl, ok := l.(ContextLogger)
+	if !ok {
+		l.Printf(format, args...)
+		return
+	}
+	for _, ctx := range ctxs {
+		cl.PrintfContext(ctx, format, args...)
+	}
+}
@@ -0,0 +1,115 @@
+//go:build go1.21
+// +build go1.21
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	ktesting "github.com/segmentio/kafka-go/testing"
+)
+
+func TestStructuredLogger(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &recordHandler{}
+	l := slog.New(h)
+
+	transport := &Transport{Dial: broker.Dial, StructuredLogger: l}
+	defer transport.CloseIdleConnections()
+
+	var printed []string
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchTimeout: time.Millisecond,
+		Transport:    transport,
+		Logger: LoggerFunc(func(msg string, args ...interface{}) {
+			printed = append(printed, fmt.Sprintf(msg, args...))
+		}),
+		StructuredLogger: l,
+	}
+	defer w.Close()
+
+	if err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	connected := h.find("connected to kafka broker")
+	if connected == nil {
+		t.Fatal("the connection to the broker was not logged")
+	}
+	if connected.attrs["broker"] == "" {
+		t.Errorf("the connection was logged without the address of the broker: %v", connected.attrs)
+	}
+
+	writing := h.find("writing messages")
+	if writing == nil {
+		t.Fatal("the write was not logged")
+	}
+	if writing.level != slog.LevelDebug {
+		t.Errorf("expected the write to be logged at the debug level but got %s", writing.level)
+	}
+	for key, value := range map[string]string{"topic": "topic-A", "partition": "0", "messages": "1"} {
+		if writing.attrs[key] != value {
+			t.Errorf("%s: expected %q but got %q", key, value, writing.attrs[key])
+		}
+	}
+
+	// Loggers which are not structured keep receiving formatted messages.
+	if !reflect.DeepEqual(printed, []string{"writing 1 messages to topic-A (partition: 0)"}) {
+		t.Errorf("unexpected messages written to the logger: %q", printed)
+	}
+}
+
+type loggedRecord struct {
+	level slog.Level
+	msg   string
+	attrs map[string]string
+}
+
+// recordHandler is a slog.Handler capturing the records it receives.
+type recordHandler struct {
+	mutex   sync.Mutex
+	records []loggedRecord
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordHandler) Handle(ctx context.Context, r slog.Record) error {
+	rec := loggedRecord{level: r.Level, msg: r.Message, attrs: make(map[string]string)}
+	r.Attrs(func(a slog.Attr) bool {
+		rec.attrs[a.Key] = a.Value.String()
+		return true
+	})
+	h.mutex.Lock()
+	h.records = append(h.records, rec)
+	h.mutex.Unlock()
+	return nil
+}
+
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordHandler) WithGroup(string) slog.Handler { return h }
+
+func (h *recordHandler) find(msg string) *loggedRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i := range h.records {
+		if h.records[i].msg == msg {
+			return &h.records[i]
+		}
+	}
+	return nil
+}
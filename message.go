@@ -16,13 +16,65 @@ type Message struct {
 	Partition     int
 	Offset        int64
 	HighWaterMark int64
-	Key           []byte
-	Value         []byte
-	Headers       []Header
+
+	// Key and Value are encoded as null when they are nil, and as empty byte
+	// sequences when they are empty but not nil. A message with a nil Value
+	// is a tombstone, which deletes its key from compacted topics, while an
+	// empty Value is retained by the compaction. Messages read from kafka
+	// follow the same convention.
+	Key     []byte
+	Value   []byte
+	Headers []Header
 
 	// If not set at the creation, Time will be automatically set when
 	// writing the message.
 	Time time.Time
+
+	// Control is set on messages read from the control records which mark
+	// the end of transactions, Key and Value then hold the raw content of
+	// the record. Control records are only returned by readers and batches
+	// configured with ControlRecords.
+	Control *ControlRecord
+
+	// generation of the consumer group in which the message was returned by a
+	// reader configured with AckMessages.
+	generation int32
+}
+
+// ControlRecordType is the type of a control record.
+type ControlRecordType int16
+
+const (
+	// ControlRecordAbort marks the abort of a transaction.
+	ControlRecordAbort ControlRecordType = 0
+	// ControlRecordCommit marks the commit of a transaction.
+	ControlRecordCommit ControlRecordType = 1
+)
+
+func (t ControlRecordType) String() string {
+	switch t {
+	case ControlRecordAbort:
+		return "abort"
+	case ControlRecordCommit:
+		return "commit"
+	default:
+		return "unknown"
+	}
+}
+
+// ControlRecord describes a marker written to a partition by the transaction
+// coordinator when a transaction of a producer is committed or aborted.
+type ControlRecord struct {
+	// Type of the marker, -1 if the record could not be decoded.
+	Type ControlRecordType
+
+	// Producer id and epoch of the transaction that the marker ends.
+	ProducerID    int64
+	ProducerEpoch int16
+
+	// Epoch of the transaction coordinator which wrote the marker, -1 if the
+	// record could not be decoded.
+	CoordinatorEpoch int32
 }
 
 func (msg Message) message(cw *crc32Writer) message {
@@ -44,6 +96,17 @@ func (msg *Message) size() int32 {
 	return 4 + 1 + 1 + sizeofBytes(msg.Key) + sizeofBytes(msg.Value) + timestampSize
 }
 
+// recordSize returns an upper bound of the size of msg encoded in a record
+// batch (message format v2), assuming that varints take their maximum size:
+// length, attributes, timestamp delta, offset delta, key, value, and headers.
+func (msg *Message) recordSize() int64 {
+	size := 5 + 1 + 10 + 5 + 5 + len(msg.Key) + 5 + len(msg.Value) + 5
+	for _, h := range msg.Headers {
+		size += 5 + len(h.Key) + 5 + len(h.Value)
+	}
+	return int64(size)
+}
+
 type message struct {
 	CRC        int32
 	MagicByte  int8
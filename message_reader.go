@@ -11,6 +11,10 @@ import (
 
 type readBytesFunc func(*bufio.Reader, int, int) (int, error)
 
+// controlAttribute is the bit of the attributes of v2 record batches set on
+// control batches.
+const controlAttribute = 1 << 5
+
 // messageSetReader processes the messages encoded into a fetch response.
 // The response may contain a mix of Record Batches (newer format) and Messages
 // (older format).
@@ -71,7 +75,9 @@ func (h messagesHeader) compression() (codec CompressionCodec, err error) {
 		return
 	}
 	if code != 0 {
-		codec, err = resolveCodec(code)
+		if codec, err = resolveCodec(code); err != nil {
+			err = UnsupportedCodecError{Codec: code, Offset: h.firstOffset}
+		}
 	}
 	return
 }
@@ -91,6 +97,40 @@ func newMessageSetReader(reader *bufio.Reader, remain int) (*messageSetReader, e
 	return res, err
 }
 
+// leaderEpoch returns the leader epoch of the current message set, or -1 if its
+// format does not carry one.
+func (r *messageSetReader) leaderEpoch() int32 {
+	if r.empty || r.readerStack == nil || r.header.magic != 2 {
+		return -1
+	}
+	return r.header.v2.leaderEpoch
+}
+
+// control returns whether the current message set is a control batch.
+func (r *messageSetReader) control() bool {
+	return !r.empty && r.readerStack != nil && r.header.magic == 2 && r.header.v2.attributes&controlAttribute != 0
+}
+
+// controlRecord decodes the key and value of a record read from the current
+// control batch.
+func (r *messageSetReader) controlRecord(key, value []byte) *ControlRecord {
+	c := &ControlRecord{
+		Type:             -1,
+		ProducerID:       r.header.v2.producerID,
+		ProducerEpoch:    r.header.v2.producerEpoch,
+		CoordinatorEpoch: -1,
+	}
+	// key: version (int16), type (int16)
+	if len(key) >= 4 {
+		c.Type = ControlRecordType(makeInt16(key[2:4]))
+	}
+	// value: version (int16), coordinator epoch (int32)
+	if len(value) >= 6 {
+		c.CoordinatorEpoch = makeInt32(value[2:6])
+	}
+	return c
+}
+
 func (r *messageSetReader) remaining() (remain int) {
 	if r.empty {
 		return 0
@@ -376,7 +416,7 @@ func (r *messageSetReader) readMessageHeader(header *Header) (err error) {
 	if err = r.readVarInt(&valLen); err != nil {
 		return
 	}
-	if header.Value, err = r.readNewBytes(int(valLen)); err != nil {
+	if header.Value, err = r.readNewNullableBytes(int(valLen)); err != nil {
 		return
 	}
 	return nil
@@ -476,8 +516,8 @@ func (r *messageSetReader) readHeader() (err error) {
 	return
 }
 
-func (r *messageSetReader) readNewBytes(len int) (res []byte, err error) {
-	res, r.remain, err = readNewBytes(r.reader, r.remain, len)
+func (r *messageSetReader) readNewNullableBytes(len int) (res []byte, err error) {
+	res, r.remain, err = readNewNullableBytes(r.reader, r.remain, len)
 	return
 }
 
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"testing"
@@ -534,6 +536,117 @@ func TestMessageSetReader(t *testing.T) {
 
 }
 
+// uncompressedCodec is a codec which does not transform the data, it is used
+// to produce batches with unknown compression codes.
+type uncompressedCodec struct{ code int8 }
+
+func (c uncompressedCodec) Code() int8                          { return c.code }
+func (c uncompressedCodec) Name() string                        { return "uncompressed" }
+func (c uncompressedCodec) NewReader(r io.Reader) io.ReadCloser { return ioutil.NopCloser(r) }
+func (c uncompressedCodec) NewWriter(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestBatchUnsupportedCodec(t *testing.T) {
+	builder := fetchResponseBuilder{
+		header: fetchResponseHeader{
+			highWatermarkOffset: 10,
+			lastStableOffset:    10,
+			topic:               "topic-A",
+		},
+		msgSets: []messageSetBuilder{
+			v2MessageSetBuilder{
+				codec: uncompressedCodec{code: 7},
+				msgs: []Message{
+					{Offset: 4, Value: []byte("hello"), Time: time.Now()},
+					{Offset: 5, Value: []byte("world"), Time: time.Now()},
+				},
+			},
+		},
+	}
+
+	bs := builder.bytes()
+	r := bufio.NewReader(bytes.NewReader(bs))
+	_, _, remain, err := readFetchResponseHeaderV10(r, len(bs))
+	require.NoError(t, err)
+	msgs, err := newMessageSetReader(r, remain)
+	require.NoError(t, err)
+
+	batch := &Batch{
+		topic:     "topic-A",
+		partition: 2,
+		offset:    4,
+		msgs:      msgs,
+	}
+
+	_, err = batch.ReadMessage()
+
+	var codecErr UnsupportedCodecError
+	if !errors.As(err, &codecErr) {
+		t.Fatalf("expected an UnsupportedCodecError but got %v", err)
+	}
+
+	want := UnsupportedCodecError{Codec: 7, Topic: "topic-A", Partition: 2, Offset: 4}
+	if codecErr != want {
+		t.Errorf("unexpected error:\nwant: %+v\ngot:  %+v", want, codecErr)
+	}
+	if !errors.Is(err, errUnknownCodec) {
+		t.Errorf("expected the error to wrap %v", errUnknownCodec)
+	}
+	if batch.Err() != err {
+		t.Errorf("expected the batch to retain the error but got %v", batch.Err())
+	}
+}
+
+func TestBatchNullableBytes(t *testing.T) {
+	msgs := []Message{
+		{Offset: 0, Key: nil, Value: nil},
+		{Offset: 1, Key: nil, Value: []byte{}},
+		{Offset: 2, Key: []byte{}, Value: nil},
+		{Offset: 3, Key: []byte{}, Value: []byte{}},
+	}
+	for i := range msgs {
+		msgs[i].Time = time.Now()
+	}
+
+	for _, builder := range []messageSetBuilder{
+		v0MessageSetBuilder{msgs: msgs},
+		v1MessageSetBuilder{msgs: msgs},
+		v2MessageSetBuilder{msgs: msgs},
+	} {
+		t.Run(fmt.Sprintf("%T", builder), func(t *testing.T) {
+			fetch := fetchResponseBuilder{
+				header:  fetchResponseHeader{highWatermarkOffset: 4, lastStableOffset: 4, topic: "topic-A"},
+				msgSets: []messageSetBuilder{builder},
+			}
+			bs := fetch.bytes()
+			r := bufio.NewReader(bytes.NewReader(bs))
+			_, _, remain, err := readFetchResponseHeaderV10(r, len(bs))
+			require.NoError(t, err)
+			msgSet, err := newMessageSetReader(r, remain)
+			require.NoError(t, err)
+
+			batch := &Batch{topic: "topic-A", msgs: msgSet}
+
+			for _, want := range msgs {
+				got, err := batch.ReadMessage()
+				require.NoError(t, err)
+				if (got.Key == nil) != (want.Key == nil) || (got.Value == nil) != (want.Value == nil) {
+					t.Errorf("offset %d: key and value must be nil=%t,%t but got nil=%t,%t", want.Offset,
+						want.Key == nil, want.Value == nil, got.Key == nil, got.Value == nil)
+				}
+				if len(got.Key) != 0 || len(got.Value) != 0 {
+					t.Errorf("offset %d: unexpected key and value: %q, %q", want.Offset, got.Key, got.Value)
+				}
+			}
+		})
+	}
+}
+
 func TestMessageSetReaderEmpty(t *testing.T) {
 	m := messageSetReader{empty: true}
 
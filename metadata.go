@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
 	"time"
 
 	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
@@ -17,6 +18,21 @@ type MetadataRequest struct {
 
 	// The list of topics to retrieve metadata for.
 	Topics []string
+
+	// IncludeClusterAuthorizedOperations requests the operations that the
+	// client is authorized to perform on the cluster, returned in the
+	// ClusterAuthorizedOperations field of the response.
+	//
+	// This requires kafka 2.3 to 2.7, newer versions of kafka do not return
+	// the operations authorized on the cluster in metadata responses.
+	IncludeClusterAuthorizedOperations bool
+
+	// IncludeTopicAuthorizedOperations requests the operations that the client
+	// is authorized to perform on each topic, returned in the
+	// AuthorizedOperations field of the topics.
+	//
+	// This requires kafka 2.3 or above.
+	IncludeTopicAuthorizedOperations bool
 }
 
 // MetadatResponse represents a response from a kafka broker to a metadata
@@ -36,12 +52,18 @@ type MetadataResponse struct {
 
 	// The list of topics available on the cluster.
 	Topics []Topic
+
+	// The operations that the client is authorized to perform on the cluster,
+	// empty unless IncludeClusterAuthorizedOperations was set.
+	ClusterAuthorizedOperations ACLOperations
 }
 
 // Metadata sends a metadata request to a kafka broker and returns the response.
 func (c *Client) Metadata(ctx context.Context, req *MetadataRequest) (*MetadataResponse, error) {
 	m, err := c.roundTrip(ctx, req.Addr, &metadataAPI.Request{
-		TopicNames: req.Topics,
+		TopicNames:                         req.Topics,
+		IncludeClusterAuthorizedOperations: req.IncludeClusterAuthorizedOperations,
+		IncludeTopicAuthorizedOperations:   req.IncludeTopicAuthorizedOperations,
 	})
 
 	if err != nil {
@@ -54,6 +76,8 @@ func (c *Client) Metadata(ctx context.Context, req *MetadataRequest) (*MetadataR
 		Brokers:   make([]Broker, len(res.Brokers)),
 		Topics:    make([]Topic, len(res.Topics)),
 		ClusterID: res.ClusterID,
+
+		ClusterAuthorizedOperations: makeACLOperations(res.ClusterAuthorizedOperations),
 	}
 
 	brokers := make(map[int32]Broker, len(res.Brokers))
@@ -80,33 +104,83 @@ func (c *Client) Metadata(ctx context.Context, req *MetadataRequest) (*MetadataR
 			Internal:   t.IsInternal,
 			Partitions: make([]Partition, len(t.Partitions)),
 			Error:      makeError(t.ErrorCode, ""),
+
+			AuthorizedOperations: makeACLOperations(t.TopicAuthorizedOperations),
 		}
 
 		for j, p := range t.Partitions {
-			partition := Partition{
-				Topic:    t.Name,
-				ID:       int(p.PartitionIndex),
-				Leader:   brokers[p.LeaderID],
-				Replicas: make([]Broker, len(p.ReplicaNodes)),
-				Isr:      make([]Broker, len(p.IsrNodes)),
-				Error:    makeError(p.ErrorCode, ""),
-			}
-
-			for i, id := range p.ReplicaNodes {
-				partition.Replicas[i] = brokers[id]
-			}
-
-			for i, id := range p.IsrNodes {
-				partition.Isr[i] = brokers[id]
-			}
-
-			ret.Topics[i].Partitions[j] = partition
+			ret.Topics[i].Partitions[j] = makeMetadataPartition(brokers, t.Name, p)
 		}
 	}
 
 	return ret, nil
 }
 
+// makeMetadataPartition converts the metadata of a partition of topic, the
+// brokers are indexed by id.
+func makeMetadataPartition(brokers map[int32]Broker, topic string, p metadataAPI.ResponsePartition) Partition {
+	partition := Partition{
+		Topic:           topic,
+		ID:              int(p.PartitionIndex),
+		Leader:          lookupBroker(brokers, p.LeaderID),
+		Replicas:        make([]Broker, len(p.ReplicaNodes)),
+		Isr:             make([]Broker, len(p.IsrNodes)),
+		OfflineReplicas: make([]Broker, len(p.OfflineReplicas)),
+		LeaderEpoch:     int(p.LeaderEpoch),
+		Error:           makeError(p.ErrorCode, ""),
+	}
+
+	for i, id := range p.ReplicaNodes {
+		partition.Replicas[i] = lookupBroker(brokers, id)
+	}
+
+	for i, id := range p.IsrNodes {
+		partition.Isr[i] = lookupBroker(brokers, id)
+	}
+
+	for i, id := range p.OfflineReplicas {
+		partition.OfflineReplicas[i] = lookupBroker(brokers, id)
+	}
+
+	return partition
+}
+
+// lookupBroker returns the broker with the given id, offline brokers are not
+// part of the metadata so only their id is known.
+func lookupBroker(brokers map[int32]Broker, id int32) Broker {
+	if b, ok := brokers[id]; ok {
+		return b
+	}
+	return Broker{ID: int(id)}
+}
+
+// Partitions returns the partitions of the given topics, indexed by topic name
+// and ordered by partition ID, or the partitions of all topics of the cluster
+// when no topics are given.
+//
+// The method returns an error if the metadata of one of the topics could not
+// be retrieved, for example because it does not exist.
+func (c *Client) Partitions(ctx context.Context, topics ...string) (map[string][]Partition, error) {
+	metadata, err := c.Metadata(ctx, &MetadataRequest{Topics: topics})
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).Partitions: %w", err)
+	}
+
+	partitions := make(map[string][]Partition, len(metadata.Topics))
+
+	for _, t := range metadata.Topics {
+		if t.Error != nil {
+			return nil, fmt.Errorf("kafka.(*Client).Partitions: topic %q: %w", t.Name, t.Error)
+		}
+		sort.Slice(t.Partitions, func(i, j int) bool {
+			return t.Partitions[i].ID < t.Partitions[j].ID
+		})
+		partitions[t.Name] = t.Partitions
+	}
+
+	return partitions, nil
+}
+
 type topicMetadataRequestV1 []string
 
 func (r topicMetadataRequestV1) size() int32 {
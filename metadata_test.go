@@ -2,7 +2,14 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"math"
+	"net"
+	"reflect"
 	"testing"
+
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
 func TestClientMetadata(t *testing.T) {
@@ -73,3 +80,157 @@ func TestClientMetadata(t *testing.T) {
 		}
 	}
 }
+
+func TestClientPartitions(t *testing.T) {
+	client := &Client{
+		Addr: TCP("localhost:9092"),
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			res := &metadataAPI.Response{
+				Brokers: []metadataAPI.ResponseBroker{
+					{NodeID: 1, Host: "broker-1", Port: 9092},
+					{NodeID: 2, Host: "broker-2", Port: 9092},
+				},
+			}
+			for _, name := range req.(*metadataAPI.Request).TopicNames {
+				if name != "topic-A" {
+					res.Topics = append(res.Topics, metadataAPI.ResponseTopic{Name: name, ErrorCode: int16(UnknownTopicOrPartition)})
+					continue
+				}
+				res.Topics = append(res.Topics, metadataAPI.ResponseTopic{
+					Name: name,
+					Partitions: []metadataAPI.ResponsePartition{
+						{PartitionIndex: 1, LeaderID: -1, LeaderEpoch: 7, ReplicaNodes: []int32{3}, OfflineReplicas: []int32{3}, ErrorCode: int16(LeaderNotAvailable)},
+						{PartitionIndex: 0, LeaderID: 1, LeaderEpoch: 4, ReplicaNodes: []int32{1, 2, 3}, IsrNodes: []int32{1, 2}, OfflineReplicas: []int32{3}},
+					},
+				})
+			}
+			return res, nil
+		}),
+	}
+
+	ctx := context.Background()
+
+	partitions, err := client.Partitions(ctx, "topic-A")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker1 := Broker{Host: "broker-1", Port: 9092, ID: 1}
+	broker2 := Broker{Host: "broker-2", Port: 9092, ID: 2}
+	broker3 := Broker{ID: 3}
+
+	want := []Partition{
+		{
+			Topic:           "topic-A",
+			ID:              0,
+			Leader:          broker1,
+			Replicas:        []Broker{broker1, broker2, broker3},
+			Isr:             []Broker{broker1, broker2},
+			OfflineReplicas: []Broker{broker3},
+			LeaderEpoch:     4,
+		},
+		{
+			Topic:           "topic-A",
+			ID:              1,
+			Leader:          Broker{ID: -1},
+			Replicas:        []Broker{broker3},
+			Isr:             []Broker{},
+			OfflineReplicas: []Broker{broker3},
+			LeaderEpoch:     7,
+			Error:           LeaderNotAvailable,
+		},
+	}
+
+	if got := partitions["topic-A"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("partitions mismatch:\nwant: %+v\ngot:  %+v", want, got)
+	}
+
+	if _, err := client.Partitions(ctx, "topic-A", "topic-B"); !errors.Is(err, UnknownTopicOrPartition) {
+		t.Errorf("expected an unknown topic error but got %v", err)
+	}
+}
+
+func TestClientMetadataAuthorizedOperations(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: &Transport{Dial: broker.Dial},
+	}
+
+	ctx := context.Background()
+
+	// The first request populates the metadata cache of the transport, which
+	// does not hold the authorized operations.
+	res, err := client.Metadata(ctx, &MetadataRequest{Topics: []string{"topic-A"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := res.Topics[0].AuthorizedOperations; ops != 0 {
+		t.Errorf("expected no authorized operations when they are not requested but got %v", ops.Operations())
+	}
+
+	res, err = client.Metadata(ctx, &MetadataRequest{
+		Topics:                           []string{"topic-A"},
+		IncludeTopicAuthorizedOperations: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := res.Topics[0].AuthorizedOperations
+	want := []ACLOperationType{
+		ACLOperationTypeRead,
+		ACLOperationTypeWrite,
+		ACLOperationTypeCreate,
+		ACLOperationTypeDelete,
+		ACLOperationTypeAlter,
+		ACLOperationTypeDescribe,
+		ACLOperationTypeDescribeConfigs,
+		ACLOperationTypeAlterConfigs,
+	}
+	if !reflect.DeepEqual(ops.Operations(), want) {
+		t.Errorf("expected the authorized operations on the topic to be %v but got %v", want, ops.Operations())
+	}
+	if !ops.Contains(ACLOperationTypeWrite) || ops.Contains(ACLOperationTypeClusterAction) {
+		t.Errorf("unexpected set of authorized operations: %v", ops.Operations())
+	}
+}
+
+func TestClientMetadataClusterAuthorizedOperations(t *testing.T) {
+	var req *metadataAPI.Request
+
+	client := &Client{
+		Addr: TCP("localhost:9092"),
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, r Request) (Response, error) {
+			req = r.(*metadataAPI.Request)
+			return &metadataAPI.Response{
+				Topics:                      []metadataAPI.ResponseTopic{{Name: "topic-A", TopicAuthorizedOperations: math.MinInt32}},
+				ClusterAuthorizedOperations: 1<<int(ACLOperationTypeDescribe) | 1<<int(ACLOperationTypeIdempotentWrite),
+			}, nil
+		}),
+	}
+
+	res, err := client.Metadata(context.Background(), &MetadataRequest{
+		Topics:                             []string{"topic-A"},
+		IncludeClusterAuthorizedOperations: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !req.IncludeClusterAuthorizedOperations || req.IncludeTopicAuthorizedOperations {
+		t.Errorf("unexpected metadata request: %+v", req)
+	}
+	if want := []ACLOperationType{ACLOperationTypeDescribe, ACLOperationTypeIdempotentWrite}; !reflect.DeepEqual(res.ClusterAuthorizedOperations.Operations(), want) {
+		t.Errorf("expected the authorized operations on the cluster to be %v but got %v", want, res.ClusterAuthorizedOperations.Operations())
+	}
+	if ops := res.Topics[0].AuthorizedOperations; ops != 0 {
+		t.Errorf("expected no authorized operations on the topic but got %v", ops.Operations())
+	}
+}
@@ -0,0 +1,59 @@
+package kafka
+
+import "time"
+
+// MetricsHook is an interface implemented by types receiving the metrics of
+// readers, writers, and transports as they are observed, which allows programs to feed
+// counters and histograms of metrics systems like Prometheus without polling
+// the Stats methods. Hooks complement the stats, which keep being collected
+// when a hook is configured.
+//
+// The metric names are the ones declared in the struct tags of ReaderStats and
+// WriterStats, for example "kafka.writer.message.count". Readers also report
+// successful offset commits of consumer groups as "kafka.reader.commit.count".
+// Transports report the metrics of their connections, see
+// Transport.MetricsHook.
+//
+// The methods are called synchronously from the readers and writers internal
+// goroutines, often in the hot path of reading or writing messages, they must
+// not block and should be safe to use concurrently.
+type MetricsHook interface {
+	// Count is called when the counter identified by name is incremented.
+	Count(name string, value int64, labels MetricLabels)
+
+	// Observe is called when a value is observed for the summary identified
+	// by name. Durations are expressed in seconds.
+	Observe(name string, value float64, labels MetricLabels)
+}
+
+// MetricLabels carries the dimensions of metrics reported to a MetricsHook.
+type MetricLabels struct {
+	Topic string
+
+	// Partition is -1 when the metric does not relate to a single partition.
+	Partition int
+
+	// Broker is the address of the broker, and API the name of the kafka API
+	// of the request, that transport metrics relate to. They are empty for
+	// the metrics of readers and writers.
+	Broker string
+	API    string
+}
+
+func countMetric(hook MetricsHook, name string, value int64, labels MetricLabels) {
+	if hook != nil {
+		hook.Count(name, value, labels)
+	}
+}
+
+func observeMetric(hook MetricsHook, name string, value int64, labels MetricLabels) {
+	if hook != nil {
+		hook.Observe(name, float64(value), labels)
+	}
+}
+
+func observeDurationMetric(hook MetricsHook, name string, value time.Duration, labels MetricLabels) {
+	if hook != nil {
+		hook.Observe(name, value.Seconds(), labels)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"net"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/findcoordinator"
 	"github.com/segmentio/kafka-go/protocol/offsetfetch"
 )
 
@@ -66,24 +68,9 @@ type OffsetFetchPartition struct {
 // OffsetFetch sends an offset fetch request to a kafka broker and returns the
 // response.
 func (c *Client) OffsetFetch(ctx context.Context, req *OffsetFetchRequest) (*OffsetFetchResponse, error) {
-	topics := make([]offsetfetch.RequestTopic, 0, len(req.Topics))
-
-	for topicName, partitions := range req.Topics {
-		indexes := make([]int32, len(partitions))
-
-		for i, p := range partitions {
-			indexes[i] = int32(p)
-		}
-
-		topics = append(topics, offsetfetch.RequestTopic{
-			Name:             topicName,
-			PartitionIndexes: indexes,
-		})
-	}
-
 	m, err := c.roundTrip(ctx, req.Addr, &offsetfetch.Request{
 		GroupID: req.GroupID,
-		Topics:  topics,
+		Topics:  makeOffsetFetchRequestTopics(req.Topics),
 	})
 
 	if err != nil {
@@ -91,13 +78,25 @@ func (c *Client) OffsetFetch(ctx context.Context, req *OffsetFetchRequest) (*Off
 	}
 
 	res := m.(*offsetfetch.Response)
+	topics, errorCode := res.Topics, res.ErrorCode
+
+	// Starting with v8, the response carries the results in a list of groups,
+	// even when only one was requested.
+	if len(res.Groups) != 0 {
+		topics, errorCode = res.Groups[0].Topics, res.Groups[0].ErrorCode
+	}
+
+	return makeOffsetFetchResponse(res.ThrottleTimeMs, topics, errorCode), nil
+}
+
+func makeOffsetFetchResponse(throttleTimeMs int32, topics []offsetfetch.ResponseTopic, errorCode int16) *OffsetFetchResponse {
 	ret := &OffsetFetchResponse{
-		Throttle: makeDuration(res.ThrottleTimeMs),
-		Topics:   make(map[string][]OffsetFetchPartition, len(res.Topics)),
-		Error:    makeError(res.ErrorCode, ""),
+		Throttle: makeDuration(throttleTimeMs),
+		Topics:   make(map[string][]OffsetFetchPartition, len(topics)),
+		Error:    makeError(errorCode, ""),
 	}
 
-	for _, t := range res.Topics {
+	for _, t := range topics {
 		partitions := make([]OffsetFetchPartition, len(t.Partitions))
 
 		for i, p := range t.Partitions {
@@ -112,9 +111,185 @@ func (c *Client) OffsetFetch(ctx context.Context, req *OffsetFetchRequest) (*Off
 		ret.Topics[t.Name] = partitions
 	}
 
+	return ret
+}
+
+func makeOffsetFetchRequestTopics(topics map[string][]int) []offsetfetch.RequestTopic {
+	requestTopics := make([]offsetfetch.RequestTopic, 0, len(topics))
+
+	for topicName, partitions := range topics {
+		indexes := make([]int32, len(partitions))
+
+		for i, p := range partitions {
+			indexes[i] = int32(p)
+		}
+
+		requestTopics = append(requestTopics, offsetfetch.RequestTopic{
+			Name:             topicName,
+			PartitionIndexes: indexes,
+		})
+	}
+
+	return requestTopics
+}
+
+// OffsetFetchGroupsRequest represents a request sent to kafka brokers to read
+// the currently committed offsets of topic partitions for multiple consumer
+// groups.
+type OffsetFetchGroupsRequest struct {
+	// Address of the kafka broker to send the request to.
+	Addr net.Addr
+
+	// Set of topic partitions to retrieve the offsets for, keyed by the ID of
+	// the consumer group.
+	Groups map[string]map[string][]int
+}
+
+// OffsetFetchGroupsResponse represents a response from kafka brokers to an
+// offset fetch request for multiple consumer groups.
+type OffsetFetchGroupsResponse struct {
+	// The offsets retrieved for each consumer group, keyed by group ID.
+	//
+	// Errors that occurred while locating the group coordinator or fetching
+	// the offsets of a single group are reported on the Error field of the
+	// group's response.
+	Groups map[string]*OffsetFetchResponse
+}
+
+// OffsetFetchGroups sends offset fetch requests to the coordinators of the
+// consumer groups in req and returns the merged response.
+//
+// Groups that share a coordinator are fetched in a single request when the
+// kafka brokers support it (OffsetFetch v8, kafka 3.0+), the coordinators of
+// all the groups are then looked up with a single FindCoordinator request
+// (v4). On older brokers, the method falls back to sending one request per
+// group.
+func (c *Client) OffsetFetchGroups(ctx context.Context, req *OffsetFetchGroupsRequest) (*OffsetFetchGroupsResponse, error) {
+	ret := &OffsetFetchGroupsResponse{
+		Groups: make(map[string]*OffsetFetchResponse, len(req.Groups)),
+	}
+
+	batch, err := c.supportsApiVersion(ctx, req.Addr, protocol.OffsetFetch, 8)
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).OffsetFetchGroups: %w", err)
+	}
+
+	if !batch {
+		for groupID, topics := range req.Groups {
+			res, err := c.OffsetFetch(ctx, &OffsetFetchRequest{
+				Addr:    req.Addr,
+				GroupID: groupID,
+				Topics:  topics,
+			})
+			if err != nil {
+				res = &OffsetFetchResponse{Error: err}
+			}
+			ret.Groups[groupID] = res
+		}
+		return ret, nil
+	}
+
+	coordinators, errs, err := c.lookupGroupCoordinators(ctx, req.Addr, req.Groups)
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).OffsetFetchGroups: %w", err)
+	}
+	for groupID, err := range errs {
+		ret.Groups[groupID] = &OffsetFetchResponse{Error: err}
+	}
+
+	for _, groupIDs := range coordinators {
+		groups := make([]offsetfetch.RequestGroup, len(groupIDs))
+
+		for i, groupID := range groupIDs {
+			groups[i] = offsetfetch.RequestGroup{
+				GroupID: groupID,
+				Topics:  makeOffsetFetchRequestTopics(req.Groups[groupID]),
+			}
+		}
+
+		// All groups in the request share the same coordinator, the transport
+		// routes the request using the first one.
+		m, err := c.roundTrip(ctx, req.Addr, &offsetfetch.Request{
+			Groups: groups,
+		})
+		if err != nil {
+			for _, groupID := range groupIDs {
+				ret.Groups[groupID] = &OffsetFetchResponse{Error: err}
+			}
+			continue
+		}
+
+		res := m.(*offsetfetch.Response)
+
+		for _, g := range res.Groups {
+			ret.Groups[g.GroupID] = makeOffsetFetchResponse(res.ThrottleTimeMs, g.Topics, g.ErrorCode)
+		}
+	}
+
 	return ret, nil
 }
 
+// lookupGroupCoordinators returns the IDs of groups indexed by the node ID of
+// their coordinator, and the errors of the groups whose coordinator could not
+// be found. The coordinators are looked up with a single request when the
+// brokers support FindCoordinator v4, or one request per group otherwise.
+func (c *Client) lookupGroupCoordinators(ctx context.Context, addr net.Addr, groups map[string]map[string][]int) (map[int][]string, map[string]error, error) {
+	coordinators := make(map[int][]string)
+	errs := make(map[string]error)
+
+	batch, err := c.supportsApiVersion(ctx, addr, protocol.FindCoordinator, 4)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !batch {
+		for groupID := range groups {
+			res, err := c.FindCoordinator(ctx, &FindCoordinatorRequest{
+				Addr:    addr,
+				Key:     groupID,
+				KeyType: CoordinatorKeyTypeConsumer,
+			})
+			if err == nil {
+				err = res.Error
+			}
+			if err != nil {
+				errs[groupID] = err
+				continue
+			}
+			nodeID := res.Coordinator.NodeID
+			coordinators[nodeID] = append(coordinators[nodeID], groupID)
+		}
+		return coordinators, errs, nil
+	}
+
+	keys := make([]string, 0, len(groups))
+	for groupID := range groups {
+		keys = append(keys, groupID)
+	}
+
+	m, err := c.roundTrip(ctx, addr, &findcoordinator.Request{
+		KeyType:         int8(CoordinatorKeyTypeConsumer),
+		CoordinatorKeys: keys,
+	})
+	if err != nil {
+		for _, groupID := range keys {
+			errs[groupID] = err
+		}
+		return coordinators, errs, nil
+	}
+
+	for _, co := range m.(*findcoordinator.Response).Coordinators {
+		if err := makeError(co.ErrorCode, co.ErrorMessage); err != nil {
+			errs[co.Key] = err
+			continue
+		}
+		nodeID := int(co.NodeID)
+		coordinators[nodeID] = append(coordinators[nodeID], co.Key)
+	}
+
+	return coordinators, errs, nil
+}
+
 type offsetFetchRequestV1Topic struct {
 	// Topic name
 	Topic string
@@ -3,8 +3,15 @@ package kafka
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"net"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol/findcoordinator"
+	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
 func TestOffsetFetchResponseV1(t *testing.T) {
@@ -43,3 +50,137 @@ func TestOffsetFetchResponseV1(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestClientOffsetFetchGroups(t *testing.T) {
+	topic := makeTopic()
+	client, shutdown := newLocalClientWithTopic(topic, 2)
+	defer shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	groups := []string{makeGroupID(), makeGroupID(), makeGroupID()}
+	req := &OffsetFetchGroupsRequest{
+		Groups: make(map[string]map[string][]int, len(groups)),
+	}
+
+	for i, groupID := range groups {
+		res, err := client.OffsetCommit(ctx, &OffsetCommitRequest{
+			GroupID:      groupID,
+			GenerationID: -1,
+			Topics: map[string][]OffsetCommit{
+				topic: {
+					{Partition: 0, Offset: int64(i + 1)},
+					{Partition: 1, Offset: int64(i + 10)},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range res.Topics[topic] {
+			if p.Error != nil {
+				t.Fatal(p.Error)
+			}
+		}
+		req.Groups[groupID] = map[string][]int{topic: {0, 1}}
+	}
+
+	res, err := client.OffsetFetchGroups(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Groups) != len(groups) {
+		t.Fatalf("expected offsets for %d groups but got %d", len(groups), len(res.Groups))
+	}
+
+	for i, groupID := range groups {
+		g := res.Groups[groupID]
+		if g == nil {
+			t.Fatalf("missing offsets for group %q", groupID)
+		}
+		if g.Error != nil {
+			t.Fatal(g.Error)
+		}
+
+		offsets := make(map[int]int64)
+		for _, p := range g.Topics[topic] {
+			if p.Error != nil {
+				t.Fatal(p.Error)
+			}
+			offsets[p.Partition] = p.CommittedOffset
+		}
+
+		if offsets[0] != int64(i+1) || offsets[1] != int64(i+10) {
+			t.Errorf("wrong committed offsets for group %q: %v", groupID, offsets)
+		}
+	}
+}
+
+func TestClientOffsetFetchGroupsBatchedCoordinatorLookup(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &Transport{Dial: broker.Dial}
+	defer transport.CloseIdleConnections()
+
+	var mutex sync.Mutex
+	var lookups [][]string
+	client := &Client{
+		Addr: TCP("localhost:9092"),
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			if r, ok := req.(*findcoordinator.Request); ok {
+				mutex.Lock()
+				lookups = append(lookups, r.CoordinatorKeys)
+				mutex.Unlock()
+			}
+			return transport.RoundTrip(ctx, addr, req)
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	groups := []string{"group-A", "group-B", "group-C"}
+	req := &OffsetFetchGroupsRequest{
+		Groups: make(map[string]map[string][]int, len(groups)),
+	}
+
+	for i, groupID := range groups {
+		_, err := client.OffsetCommit(ctx, &OffsetCommitRequest{
+			GroupID:      groupID,
+			GenerationID: -1,
+			Topics: map[string][]OffsetCommit{
+				"topic-A": {{Partition: 0, Offset: int64(i + 1)}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Groups[groupID] = map[string][]int{"topic-A": {0}}
+	}
+
+	res, err := client.OffsetFetchGroups(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lookups) != 1 || len(lookups[0]) != len(groups) {
+		t.Errorf("expected the coordinators of the groups to be looked up with a single request but got %v", lookups)
+	}
+
+	for i, groupID := range groups {
+		g := res.Groups[groupID]
+		if g == nil || g.Error != nil {
+			t.Fatalf("unexpected response for group %q: %+v", groupID, g)
+		}
+		if p := g.Topics["topic-A"]; len(p) != 1 || p[0].CommittedOffset != int64(i+1) {
+			t.Errorf("wrong committed offsets for group %q: %+v", groupID, p)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package kafka
+
+type offsetForLeaderEpochRequestV2 struct {
+	Topics []offsetForLeaderEpochRequestTopicV2
+}
+
+func (r offsetForLeaderEpochRequestV2) size() int32 {
+	return sizeofArray(len(r.Topics), func(i int) int32 { return r.Topics[i].size() })
+}
+
+func (r offsetForLeaderEpochRequestV2) writeTo(wb *writeBuffer) {
+	wb.writeArray(len(r.Topics), func(i int) { r.Topics[i].writeTo(wb) })
+}
+
+type offsetForLeaderEpochRequestTopicV2 struct {
+	TopicName  string
+	Partitions []offsetForLeaderEpochRequestPartitionV2
+}
+
+func (t offsetForLeaderEpochRequestTopicV2) size() int32 {
+	return sizeofString(t.TopicName) +
+		sizeofArray(len(t.Partitions), func(i int) int32 { return t.Partitions[i].size() })
+}
+
+func (t offsetForLeaderEpochRequestTopicV2) writeTo(wb *writeBuffer) {
+	wb.writeString(t.TopicName)
+	wb.writeArray(len(t.Partitions), func(i int) { t.Partitions[i].writeTo(wb) })
+}
+
+type offsetForLeaderEpochRequestPartitionV2 struct {
+	Partition int32
+	// CurrentLeaderEpoch lets the broker fence requests from clients with
+	// stale metadata, -1 disables the check.
+	CurrentLeaderEpoch int32
+	LeaderEpoch        int32
+}
+
+func (p offsetForLeaderEpochRequestPartitionV2) size() int32 {
+	return 4 + 4 + 4
+}
+
+func (p offsetForLeaderEpochRequestPartitionV2) writeTo(wb *writeBuffer) {
+	wb.writeInt32(p.Partition)
+	wb.writeInt32(p.CurrentLeaderEpoch)
+	wb.writeInt32(p.LeaderEpoch)
+}
+
+type offsetForLeaderEpochResponseV2 struct {
+	ThrottleTimeMS int32
+	Topics         []offsetForLeaderEpochResponseTopicV2
+}
+
+func (r offsetForLeaderEpochResponseV2) size() int32 {
+	return 4 + sizeofArray(len(r.Topics), func(i int) int32 { return r.Topics[i].size() })
+}
+
+func (r offsetForLeaderEpochResponseV2) writeTo(wb *writeBuffer) {
+	wb.writeInt32(r.ThrottleTimeMS)
+	wb.writeArray(len(r.Topics), func(i int) { r.Topics[i].writeTo(wb) })
+}
+
+type offsetForLeaderEpochResponseTopicV2 struct {
+	TopicName  string
+	Partitions []offsetForLeaderEpochResponsePartitionV2
+}
+
+func (t offsetForLeaderEpochResponseTopicV2) size() int32 {
+	return sizeofString(t.TopicName) +
+		sizeofArray(len(t.Partitions), func(i int) int32 { return t.Partitions[i].size() })
+}
+
+func (t offsetForLeaderEpochResponseTopicV2) writeTo(wb *writeBuffer) {
+	wb.writeString(t.TopicName)
+	wb.writeArray(len(t.Partitions), func(i int) { t.Partitions[i].writeTo(wb) })
+}
+
+type offsetForLeaderEpochResponsePartitionV2 struct {
+	ErrorCode   int16
+	Partition   int32
+	LeaderEpoch int32
+	EndOffset   int64
+}
+
+func (p offsetForLeaderEpochResponsePartitionV2) size() int32 {
+	return 2 + 4 + 4 + 8
+}
+
+func (p offsetForLeaderEpochResponsePartitionV2) writeTo(wb *writeBuffer) {
+	wb.writeInt16(p.ErrorCode)
+	wb.writeInt32(p.Partition)
+	wb.writeInt32(p.LeaderEpoch)
+	wb.writeInt64(p.EndOffset)
+}
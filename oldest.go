@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// OldestMessageAge returns the age of the oldest message retained in the
+// partition of topic, computed from the message timestamp, which programs may
+// use to monitor the retention of topics.
+//
+// The offset of the oldest message is looked up with a ListOffsets request,
+// and the message is read with a single Fetch request. Offsets which are absent
+// because the messages were removed by compaction, or which hold transaction
+// markers, are skipped. The method
+// retries when the retention of the partition removed the message before it
+// could be read.
+//
+// The returned boolean is false, and the age zero, when the partition retains
+// no messages.
+func (c *Client) OldestMessageAge(ctx context.Context, topic string, partition int) (time.Duration, bool, error) {
+	for {
+		offsets, err := c.ListOffsets(ctx, &ListOffsetsRequest{
+			Topics: map[string][]OffsetRequest{
+				topic: {FirstOffsetOf(partition), LastOffsetOf(partition)},
+			},
+		})
+		if err != nil {
+			return 0, false, fmt.Errorf("kafka.(*Client).OldestMessageAge: %w", err)
+		}
+
+		var first, last int64 = -1, -1
+		for _, p := range offsets.Topics[topic] {
+			if p.Partition != partition {
+				continue
+			}
+			if p.Error != nil {
+				return 0, false, fmt.Errorf("kafka.(*Client).OldestMessageAge: %w", p.Error)
+			}
+			first, last = p.FirstOffset, p.LastOffset
+		}
+		if first < 0 {
+			return 0, false, fmt.Errorf("kafka.(*Client).OldestMessageAge: %w", UnknownTopicOrPartition)
+		}
+
+		t, found, err := c.readOldestMessageTime(ctx, topic, partition, first, last)
+		if err != nil {
+			if errors.Is(err, OffsetOutOfRange) {
+				// The retention of the partition removed the messages
+				// while they were being read, look up the new first
+				// offset.
+				continue
+			}
+			return 0, false, fmt.Errorf("kafka.(*Client).OldestMessageAge: %w", err)
+		}
+		if !found {
+			return 0, false, nil
+		}
+		return time.Since(t), true, nil
+	}
+}
+
+// readOldestMessageTime returns the timestamp of the first message of the
+// partition between offset and end.
+func (c *Client) readOldestMessageTime(ctx context.Context, topic string, partition int, offset, end int64) (time.Time, bool, error) {
+	if offset >= end {
+		return time.Time{}, false, nil
+	}
+
+	// Kafka returns the record batch holding the first record at or after
+	// the offset even if it exceeds the maximum size of the response, which
+	// skips the offsets removed by compaction. The size leaves room for the
+	// batches following transaction markers, which are not exposed to the
+	// program.
+	res, err := c.Fetch(ctx, &FetchRequest{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    offset,
+		MaxBytes:  64 * 1024,
+	})
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if res.Error != nil {
+		return time.Time{}, false, res.Error
+	}
+
+	for {
+		r, err := res.Records.ReadRecord()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// The offsets up to the end only hold transaction
+				// markers.
+				return time.Time{}, false, nil
+			}
+			return time.Time{}, false, err
+		}
+
+		// Record batches may start before the requested offset.
+		if r.Offset < offset {
+			continue
+		}
+		if r.Offset >= end {
+			return time.Time{}, false, nil
+		}
+		return r.Time, true, nil
+	}
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ktesting "github.com/segmentio/kafka-go/testing"
+)
+
+func TestClientOldestMessageAge(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	transport := &Transport{Dial: broker.Dial}
+	client := &Client{Addr: TCP("localhost:9092"), Transport: transport}
+
+	if age, found, err := client.OldestMessageAge(ctx, "topic-A", 0); err != nil {
+		t.Fatal(err)
+	} else if found || age != 0 {
+		t.Errorf("expected no message in an empty partition but got an age of %s", age)
+	}
+
+	w := &Writer{
+		Addr:      TCP("localhost:9092"),
+		Topic:     "topic-A",
+		Balancer:  BalancerFunc(func(Message, ...int) int { return 0 }),
+		BatchSize: 1,
+		Transport: transport,
+	}
+	defer w.Close()
+
+	now := time.Now()
+	for _, msg := range []Message{
+		{Value: []byte("1"), Time: now.Add(-time.Hour)},
+		{Value: []byte("2"), Time: now.Add(-time.Minute)},
+	} {
+		if err := w.WriteMessages(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	age, found, err := client.OldestMessageAge(ctx, "topic-A", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("the oldest message was not found")
+	}
+	if age < time.Hour || age > time.Hour+time.Minute {
+		t.Errorf("expected the oldest message to be an hour old but got %s", age)
+	}
+
+	if _, _, err := client.OldestMessageAge(ctx, "topic-A", 5); err == nil {
+		t.Error("expected an error for a partition which does not exist")
+	}
+}
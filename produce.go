@@ -50,7 +50,7 @@ func (acks *RequiredAcks) UnmarshalText(b []byte) error {
 	default:
 		x, err := strconv.ParseInt(string(b), 10, 64)
 		parsed := RequiredAcks(x)
-		if err != nil || (parsed != RequireNone && parsed != RequireOne && parsed != RequireAll) {
+		if err != nil || !validRequiredAcks(parsed) {
 			return fmt.Errorf("required acks must be one of none, one, or all, not %q", b)
 		}
 		*acks = parsed
@@ -58,6 +58,10 @@ func (acks *RequiredAcks) UnmarshalText(b []byte) error {
 	return nil
 }
 
+func validRequiredAcks(acks RequiredAcks) bool {
+	return acks == RequireNone || acks == RequireOne || acks == RequireAll
+}
+
 var (
 	_ encoding.TextMarshaler   = RequiredAcks(0)
 	_ encoding.TextUnmarshaler = (*RequiredAcks)(nil)
@@ -82,6 +86,9 @@ type ProduceRequest struct {
 	//
 	// By default, the client automatically determine which version should be
 	// used based on the version of the Produce API supported by the server.
+	// Forcing version 1, or version 0 with MessageVersion0, limits the version
+	// of the Produce API to 2 or 1 respectively, since newer versions of the
+	// API do not accept messages in these formats.
 	MessageVersion int
 
 	// An optional transaction id when producing to the kafka broker is part of
@@ -94,6 +101,52 @@ type ProduceRequest struct {
 	// An optional compression algorithm to apply to the batch of records sent
 	// to the kafka broker.
 	Compression Compression
+
+	// The type of timestamps set in the attributes of the batch of records,
+	// see TimestampType.
+	//
+	// Default: CreateTime
+	TimestampType TimestampType
+}
+
+// MessageVersion0 is the value of the MessageVersion fields of produce requests
+// and writers which forces version 0 of the message format, since their zero
+// value selects the version automatically.
+const MessageVersion0 = -1
+
+// TimestampType is an enumeration of the types of timestamps carried by kafka
+// records.
+type TimestampType int8
+
+const (
+	// CreateTime indicates that the timestamps of the records are set by the
+	// producers, usually to the time at which the records were created.
+	CreateTime TimestampType = 0
+
+	// LogAppendTime indicates that the timestamps of the records are the times
+	// at which the brokers appended them to the log. It matches the timestamps
+	// of topics configured with message.timestamp.type=LogAppendTime, for
+	// which the brokers override the timestamps set by the producers.
+	LogAppendTime TimestampType = 1
+)
+
+// String satisfies the fmt.Stringer interface.
+func (t TimestampType) String() string {
+	switch t {
+	case CreateTime:
+		return "CreateTime"
+	case LogAppendTime:
+		return "LogAppendTime"
+	default:
+		return "TimestampType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+func (t TimestampType) attributes() protocol.Attributes {
+	if t == LogAppendTime {
+		return protocol.LogAppendTime
+	}
+	return 0
 }
 
 // ProduceResponse represents a response from a kafka broker to a produce
@@ -143,20 +196,27 @@ type ProduceResponse struct {
 // When the request is configured with RequiredAcks=none, both the response and
 // the error will be nil on success.
 func (c *Client) Produce(ctx context.Context, req *ProduceRequest) (*ProduceResponse, error) {
-	attributes := protocol.Attributes(req.Compression) & 0x7
+	attributes := protocol.Attributes(req.Compression)&0x7 | req.TimestampType.attributes()
+
+	recordSet := protocol.RecordSet{
+		Attributes: attributes,
+		Records:    req.Records,
+	}
+	if req.MessageVersion == MessageVersion0 {
+		recordSet.Version0 = true
+	} else {
+		recordSet.Version = int8(req.MessageVersion)
+	}
 
 	m, err := c.roundTrip(ctx, req.Addr, &produceAPI.Request{
 		TransactionalID: req.TransactionalID,
 		Acks:            int16(req.RequiredAcks),
-		Timeout:         c.timeoutMs(ctx, defaultProduceTimeout),
+		Timeout:         c.timeoutMs(ctx, protocol.Produce, defaultProduceTimeout),
 		Topics: []produceAPI.RequestTopic{{
 			Topic: req.Topic,
 			Partitions: []produceAPI.RequestPartition{{
 				Partition: int32(req.Partition),
-				RecordSet: protocol.RecordSet{
-					Attributes: attributes,
-					Records:    req.Records,
-				},
+				RecordSet: recordSet,
 			}},
 		}},
 	})
@@ -15,7 +15,7 @@ type Request struct {
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.AlterConfigs }
 
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 type RequestResources struct {
@@ -36,6 +36,18 @@ type Response struct {
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.AlterConfigs }
 
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller, in which case all results carry the
+// error.
+func (r *Response) NotController() bool {
+	for _, result := range r.Responses {
+		if result.ErrorCode != protocol.NotControllerCode {
+			return false
+		}
+	}
+	return len(r.Responses) != 0
+}
+
 type ResponseResponses struct {
 	ErrorCode    int16  `kafka:"min=v0,max=v1"`
 	ErrorMessage string `kafka:"min=v0,max=v1,nullable"`
@@ -31,7 +31,7 @@ func (r *Request) ApiKey() protocol.ApiKey {
 }
 
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 type Response struct {
@@ -59,3 +59,9 @@ type ResponsePartition struct {
 func (r *Response) ApiKey() protocol.ApiKey {
 	return protocol.AlterPartitionReassignments
 }
+
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller.
+func (r *Response) NotController() bool {
+	return r.ErrorCode == protocol.NotControllerCode
+}
@@ -7,21 +7,61 @@ func init() {
 }
 
 type Request struct {
-	_ struct{} `kafka:"min=v0,max=v2"`
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v2|min=v3,max=v3,tag"`
+
+	ClientSoftwareName    string `kafka:"min=v3,max=v3,compact"`
+	ClientSoftwareVersion string `kafka:"min=v3,max=v3,compact"`
 }
 
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.ApiVersions }
 
+func (r *Request) Prepare(apiVersion int16) {
+	// Starting with version 3 the brokers reject requests without a client
+	// software name and version, fill them when the program did not.
+	if apiVersion >= 3 {
+		if r.ClientSoftwareName == "" {
+			r.ClientSoftwareName = "kafka-go"
+		}
+		if r.ClientSoftwareVersion == "" {
+			r.ClientSoftwareVersion = "unknown"
+		}
+	}
+}
+
 type Response struct {
-	ErrorCode      int16            `kafka:"min=v0,max=v2"`
-	ApiKeys        []ApiKeyResponse `kafka:"min=v0,max=v2"`
-	ThrottleTimeMs int32            `kafka:"min=v1,max=v2"`
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v3,max=v3,tag"`
+
+	ErrorCode      int16            `kafka:"min=v0,max=v3"`
+	ApiKeys        []ApiKeyResponse `kafka:"min=v0,max=v3"`
+	ThrottleTimeMs int32            `kafka:"min=v1,max=v3"`
+
+	// Features supported by the broker and finalized in the cluster, only
+	// sent by brokers supporting feature versioning (KIP-584).
+	SupportedFeatures      []SupportedFeature `kafka:"min=v3,max=v3,tag=0"`
+	FinalizedFeaturesEpoch int64              `kafka:"min=v3,max=v3,tag=1"`
+	FinalizedFeatures      []FinalizedFeature `kafka:"min=v3,max=v3,tag=2"`
 }
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.ApiVersions }
 
 type ApiKeyResponse struct {
-	ApiKey     int16 `kafka:"min=v0,max=v2"`
-	MinVersion int16 `kafka:"min=v0,max=v2"`
-	MaxVersion int16 `kafka:"min=v0,max=v2"`
+	ApiKey     int16 `kafka:"min=v0,max=v3"`
+	MinVersion int16 `kafka:"min=v0,max=v3"`
+	MaxVersion int16 `kafka:"min=v0,max=v3"`
+}
+
+type SupportedFeature struct {
+	Name       string `kafka:"min=v3,max=v3,compact"`
+	MinVersion int16  `kafka:"min=v3,max=v3"`
+	MaxVersion int16  `kafka:"min=v3,max=v3"`
+}
+
+type FinalizedFeature struct {
+	Name            string `kafka:"min=v3,max=v3,compact"`
+	MaxVersionLevel int16  `kafka:"min=v3,max=v3"`
+	MinVersionLevel int16  `kafka:"min=v3,max=v3"`
 }
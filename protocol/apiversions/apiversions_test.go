@@ -1,8 +1,10 @@
 package apiversions_test
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/segmentio/kafka-go/protocol"
 	"github.com/segmentio/kafka-go/protocol/apiversions"
 	"github.com/segmentio/kafka-go/protocol/prototest"
 )
@@ -11,6 +13,7 @@ const (
 	v0 = 0
 	v1 = 1
 	v2 = 2
+	v3 = 3
 )
 
 func TestApiversionsRequest(t *testing.T) {
@@ -19,6 +22,11 @@ func TestApiversionsRequest(t *testing.T) {
 	prototest.TestRequest(t, v1, &apiversions.Request{})
 
 	prototest.TestRequest(t, v2, &apiversions.Request{})
+
+	prototest.TestRequest(t, v3, &apiversions.Request{
+		ClientSoftwareName:    "kafka-go",
+		ClientSoftwareVersion: "v0.4.0",
+	})
 }
 
 func TestApiversionsResponse(t *testing.T) {
@@ -57,3 +65,57 @@ func TestApiversionsResponse(t *testing.T) {
 		ThrottleTimeMs: 50,
 	})
 }
+
+func TestApiversionsResponseV3(t *testing.T) {
+	prototest.TestResponse(t, v3, &apiversions.Response{
+		ErrorCode: 0,
+		ApiKeys: []apiversions.ApiKeyResponse{
+			{
+				ApiKey:     0,
+				MinVersion: 0,
+				MaxVersion: 9,
+			},
+		},
+		ThrottleTimeMs: 50,
+		SupportedFeatures: []apiversions.SupportedFeature{
+			{
+				Name:       "metadata.version",
+				MinVersion: 1,
+				MaxVersion: 19,
+			},
+		},
+		FinalizedFeaturesEpoch: 42,
+		FinalizedFeatures: []apiversions.FinalizedFeature{
+			{
+				Name:            "metadata.version",
+				MaxVersionLevel: 14,
+				MinVersionLevel: 14,
+			},
+		},
+	})
+}
+
+func TestApiversionsResponseHeader(t *testing.T) {
+	// ApiVersions responses never have a tag buffer in their header, even in
+	// flexible versions, the error code immediately follows the correlation id.
+	b := &bytes.Buffer{}
+	res := &apiversions.Response{ErrorCode: 35}
+	if err := protocol.WriteResponse(b, v3, 1, res); err != nil {
+		t.Fatal(err)
+	}
+	if errorCode := b.Bytes()[8:10]; !bytes.Equal(errorCode, []byte{0, 35}) {
+		t.Errorf("unexpected bytes after the correlation id: %v", errorCode)
+	}
+}
+
+func TestApiversionsRequestPrepare(t *testing.T) {
+	req := &apiversions.Request{}
+	req.Prepare(v2)
+	if req.ClientSoftwareName != "" || req.ClientSoftwareVersion != "" {
+		t.Errorf("unexpected client software with v2: %+v", req)
+	}
+	req.Prepare(v3)
+	if req.ClientSoftwareName == "" || req.ClientSoftwareVersion == "" {
+		t.Errorf("missing client software with v3: %+v", req)
+	}
+}
@@ -14,6 +14,20 @@ type Cluster struct {
 	Topics     map[string]Topic
 }
 
+// ControllerBroker returns the broker that requests which must be handled by
+// the controller of the cluster should be routed to.
+//
+// KRaft controllers are not reachable by clients, brokers of those clusters
+// report a random broker as the controller, which forwards the requests it
+// receives to the active controller. When no controller was reported, the
+// returned broker has an ID of -1 so the request is sent to any broker.
+func (c Cluster) ControllerBroker() Broker {
+	if c.Controller < 0 {
+		return Broker{ID: -1}
+	}
+	return c.Brokers[c.Controller]
+}
+
 func (c Cluster) BrokerIDs() []int32 {
 	brokerIDs := make([]int32, 0, len(c.Brokers))
 	for id := range c.Brokers {
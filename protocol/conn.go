@@ -83,6 +83,12 @@ func (c *Conn) RoundTrip(msg Message) (Message, error) {
 	versions, _ := c.versions.Load().(map[ApiKey]int16)
 	apiVersion := versions[msg.ApiKey()]
 
+	if l, _ := msg.(LimitedMessage); l != nil {
+		if max := l.MaxApiVersion(); apiVersion > max {
+			apiVersion = max
+		}
+	}
+
 	if p, _ := msg.(PreparedMessage); p != nil {
 		p.Prepare(apiVersion)
 	}
@@ -0,0 +1,79 @@
+package consumergroupheartbeat
+
+import "github.com/segmentio/kafka-go/protocol"
+
+func init() {
+	protocol.Register(&Request{}, &Response{})
+}
+
+type Request struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v0,tag"`
+
+	GroupID     string `kafka:"min=v0,max=v0"`
+	MemberID    string `kafka:"min=v0,max=v0"`
+	MemberEpoch int32  `kafka:"min=v0,max=v0"`
+	InstanceID  string `kafka:"min=v0,max=v0,nullable"`
+	RackID      string `kafka:"min=v0,max=v0,nullable"`
+
+	// The fields below are sent as null when they did not change since the
+	// last heartbeat, which is represented by -1 for RebalanceTimeoutMs, and
+	// nil slices or empty strings for the others.
+	RebalanceTimeoutMs   int32                   `kafka:"min=v0,max=v0"`
+	SubscribedTopicNames []string                `kafka:"min=v0,max=v0,nullable"`
+	ServerAssignor       string                  `kafka:"min=v0,max=v0,nullable"`
+	TopicPartitions      []RequestTopicPartition `kafka:"min=v0,max=v0,nullable"`
+}
+
+type RequestTopicPartition struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v0,tag"`
+
+	TopicID    protocol.UUID `kafka:"min=v0,max=v0"`
+	Partitions []int32       `kafka:"min=v0,max=v0"`
+}
+
+func (r *Request) ApiKey() protocol.ApiKey { return protocol.ConsumerGroupHeartbeat }
+
+func (r *Request) Group() string { return r.GroupID }
+
+type Response struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v0,tag"`
+
+	ThrottleTimeMs      int32  `kafka:"min=v0,max=v0"`
+	ErrorCode           int16  `kafka:"min=v0,max=v0"`
+	ErrorMessage        string `kafka:"min=v0,max=v0,nullable"`
+	MemberID            string `kafka:"min=v0,max=v0,nullable"`
+	MemberEpoch         int32  `kafka:"min=v0,max=v0"`
+	HeartbeatIntervalMs int32  `kafka:"min=v0,max=v0"`
+
+	// Assignment is nil when the assignment of the member did not change.
+	Assignment *ResponseAssignment `kafka:"min=v0,max=v0"`
+}
+
+type ResponseAssignment struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v0,tag"`
+
+	TopicPartitions []ResponseTopicPartition `kafka:"min=v0,max=v0"`
+}
+
+type ResponseTopicPartition struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v0,tag"`
+
+	TopicID    protocol.UUID `kafka:"min=v0,max=v0"`
+	Partitions []int32       `kafka:"min=v0,max=v0"`
+}
+
+func (r *Response) ApiKey() protocol.ApiKey { return protocol.ConsumerGroupHeartbeat }
+
+var (
+	_ protocol.GroupMessage = (*Request)(nil)
+)
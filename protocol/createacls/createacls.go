@@ -17,7 +17,7 @@ type Request struct {
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.CreateAcls }
 
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 type RequestACLs struct {
@@ -41,6 +41,18 @@ type Response struct {
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.CreateAcls }
 
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller, in which case all results carry the
+// error.
+func (r *Response) NotController() bool {
+	for _, result := range r.Results {
+		if result.ErrorCode != protocol.NotControllerCode {
+			return false
+		}
+	}
+	return len(r.Results) != 0
+}
+
 type ResponseACLs struct {
 	ErrorCode    int16  `kafka:"min=v0,max=v2"`
 	ErrorMessage string `kafka:"min=v0,max=v2,nullable"`
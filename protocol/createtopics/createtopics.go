@@ -19,7 +19,7 @@ type Request struct {
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.CreateTopics }
 
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 type RequestTopic struct {
@@ -51,6 +51,18 @@ type Response struct {
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.CreateTopics }
 
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller, in which case all results carry the
+// error.
+func (r *Response) NotController() bool {
+	for _, result := range r.Topics {
+		if result.ErrorCode != protocol.NotControllerCode {
+			return false
+		}
+	}
+	return len(r.Topics) != 0
+}
+
 type ResponseTopic struct {
 	Name              string `kafka:"min=v0,max=v5"`
 	ErrorCode         int16  `kafka:"min=v0,max=v5"`
@@ -138,11 +138,37 @@ func (d *decoder) discard(n int) {
 		n, err = r.Discard(n)
 		d.remain -= n
 	} else {
-		_, err = io.Copy(ioutil.Discard, d)
+		_, err = io.CopyN(ioutil.Discard, d, int64(n))
 	}
 	d.setError(err)
 }
 
+// discardTaggedFields skips over a tag buffer of a flexible message, for
+// example the one at the end of request and response headers.
+func (d *decoder) discardTaggedFields() {
+	n := int(d.readUnsignedVarInt())
+	for i := 0; i < n && d.err == nil; i++ {
+		d.readUnsignedVarInt() // tagID
+		d.discard(int(d.readUnsignedVarInt()))
+	}
+}
+
+// decodeTaggedField decodes the value of a tagged field of the given size.
+// The decoder is limited to the size of the field, and any bytes left after
+// decoding the value are discarded, so the fields which follow can still be
+// decoded if the value was encoded with a layout that the program does not
+// know about.
+func (d *decoder) decodeTaggedField(v value, size int, decode decodeFunc) {
+	limit := d.remain
+	if size > limit {
+		size = limit
+	}
+	d.remain = size
+	decode(d, v)
+	d.discard(d.remain)
+	d.remain += limit - size
+}
+
 func (d *decoder) read(n int) []byte {
 	b := make([]byte, n)
 	n, err := io.ReadFull(d, b)
@@ -373,6 +399,11 @@ func decodeFuncOf(typ reflect.Type, version int16, flexible bool, tag structTag)
 		return stringDecodeFuncOf(flexible, tag)
 	case reflect.Struct:
 		return structDecodeFuncOf(typ, version, flexible)
+	case reflect.Ptr:
+		if typ.Elem().Kind() == reflect.Struct { // nullable struct
+			return nullStructDecodeFuncOf(typ.Elem(), version, flexible)
+		}
+		panic("unsupported type: " + typ.String())
 	case reflect.Slice:
 		if typ.Elem().Kind() == reflect.Uint8 { // []byte
 			return bytesDecodeFuncOf(flexible, tag)
@@ -440,23 +471,37 @@ func structDecodeFuncOf(typ reflect.Type, version int16, flexible bool) decodeFu
 		if flexible {
 			// See https://cwiki.apache.org/confluence/display/KAFKA/KIP-482%3A+The+Kafka+Protocol+should+Support+Optional+Tagged+Fields
 			// for details of tag buffers in "flexible" messages.
+			//
+			// Tagged fields that the program does not know about are skipped,
+			// brokers may send them to clients supporting the same version.
 			n := int(d.readUnsignedVarInt())
 
-			for i := 0; i < n; i++ {
+			for i := 0; i < n && d.err == nil; i++ {
 				tagID := int(d.readUnsignedVarInt())
 				size := int(d.readUnsignedVarInt())
 
-				f, ok := taggedFields[tagID]
-				if ok {
-					f.decode(d, v.fieldByIndex(f.index))
+				if f, ok := taggedFields[tagID]; ok {
+					d.decodeTaggedField(v.fieldByIndex(f.index), size, f.decode)
 				} else {
-					d.read(size)
+					d.discard(size)
 				}
 			}
 		}
 	}
 }
 
+// nullStructDecodeFuncOf returns a decoder for structures declared as pointers,
+// which kafka prefixes with an int8 set to -1 when the structure is null.
+func nullStructDecodeFuncOf(typ reflect.Type, version int16, flexible bool) decodeFunc {
+	decode := structDecodeFuncOf(typ, version, flexible)
+	return func(d *decoder, v value) {
+		if d.readInt8() < 0 {
+			return
+		}
+		decode(d, v.setPointer(typ))
+	}
+}
+
 func arrayDecodeFuncOf(typ reflect.Type, version int16, flexible bool, tag structTag) decodeFunc {
 	elemType := typ.Elem()
 	elemFunc := decodeFuncOf(elemType, version, flexible, tag)
@@ -14,7 +14,7 @@ type Request struct {
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.DeleteTopics }
 
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 type Response struct {
@@ -24,6 +24,18 @@ type Response struct {
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.DeleteTopics }
 
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller, in which case all results carry the
+// error.
+func (r *Response) NotController() bool {
+	for _, result := range r.Responses {
+		if result.ErrorCode != protocol.NotControllerCode {
+			return false
+		}
+	}
+	return len(r.Responses) != 0
+}
+
 type ResponseTopic struct {
 	Name      string `kafka:"min=v0,max=v3"`
 	ErrorCode int16  `kafka:"min=v0,max=v3"`
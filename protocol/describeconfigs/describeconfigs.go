@@ -7,7 +7,8 @@ import (
 )
 
 const (
-	resourceTypeBroker int8 = 4
+	resourceTypeBroker       int8 = 4
+	resourceTypeBrokerLogger int8 = 8
 )
 
 func init() {
@@ -26,7 +27,7 @@ func (r *Request) ApiKey() protocol.ApiKey { return protocol.DescribeConfigs }
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
 	// Broker metadata requests must be sent to the associated broker
 	for _, resource := range r.Resources {
-		if resource.ResourceType == resourceTypeBroker {
+		if resource.brokerSpecific() {
 			brokerID, err := strconv.Atoi(resource.ResourceName)
 			if err != nil {
 				return protocol.Broker{}, err
@@ -36,7 +37,7 @@ func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
 		}
 	}
 
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 func (r *Request) Split(cluster protocol.Cluster) (
@@ -44,35 +45,69 @@ func (r *Request) Split(cluster protocol.Cluster) (
 	protocol.Merger,
 	error,
 ) {
-	messages := []protocol.Message{}
-	topicsMessage := Request{}
+	// Resources of brokers and broker loggers must be described by the broker
+	// that they are associated with, they are grouped into one message per
+	// broker. Any broker can describe the other resources (e.g. topics), they
+	// are all sent in a single message.
+	brokers := make(map[string]*Request)
+	order := make([]string, 0, 8)
+	topicsMessage := r.subset()
 
 	for _, resource := range r.Resources {
-		// Split out broker requests to separate brokers
-		if resource.ResourceType == resourceTypeBroker {
-			messages = append(messages, &Request{
-				Resources: []RequestResource{resource},
-			})
-		} else {
-			topicsMessage.Resources = append(
-				topicsMessage.Resources, resource,
-			)
+		if !resource.brokerSpecific() {
+			topicsMessage.Resources = append(topicsMessage.Resources, resource)
+			continue
 		}
+
+		req := brokers[resource.ResourceName]
+		if req == nil {
+			req = r.subset()
+			brokers[resource.ResourceName] = req
+			order = append(order, resource.ResourceName)
+		}
+
+		req.Resources = append(req.Resources, resource)
+	}
+
+	messages := make([]protocol.Message, 0, len(order)+1)
+
+	for _, broker := range order {
+		messages = append(messages, brokers[broker])
 	}
 
 	if len(topicsMessage.Resources) > 0 {
-		messages = append(messages, &topicsMessage)
+		messages = append(messages, topicsMessage)
 	}
 
 	return messages, new(Response), nil
 }
 
+// subset returns a request with the same options as r and no resources.
+func (r *Request) subset() *Request {
+	return &Request{
+		IncludeSynonyms:      r.IncludeSynonyms,
+		IncludeDocumentation: r.IncludeDocumentation,
+	}
+}
+
 type RequestResource struct {
 	ResourceType int8     `kafka:"min=v0,max=v3"`
 	ResourceName string   `kafka:"min=v0,max=v3"`
 	ConfigNames  []string `kafka:"min=v0,max=v3,nullable"`
 }
 
+// brokerSpecific returns true if the resource must be described by the broker
+// that it is associated with. The default configuration of brokers has an
+// empty name and may be described by any broker.
+func (r *RequestResource) brokerSpecific() bool {
+	switch r.ResourceType {
+	case resourceTypeBroker, resourceTypeBrokerLogger:
+		return r.ResourceName != ""
+	default:
+		return false
+	}
+}
+
 type Response struct {
 	ThrottleTimeMs int32              `kafka:"min=v0,max=v3"`
 	Resources      []ResponseResource `kafka:"min=v0,max=v3"`
@@ -85,15 +120,40 @@ func (r *Response) Merge(requests []protocol.Message, results []interface{}) (
 	error,
 ) {
 	response := &Response{}
+	errors := 0
+
+	for i, result := range results {
+		m, err := protocol.Result(result)
+		if err != nil {
+			// Report the error on each resource of the failed request so the
+			// results of the other requests are still returned.
+			for _, resource := range requests[i].(*Request).Resources {
+				response.Resources = append(response.Resources, ResponseResource{
+					ErrorCode:    -1, // UNKNOWN
+					ErrorMessage: err.Error(),
+					ResourceType: resource.ResourceType,
+					ResourceName: resource.ResourceName,
+				})
+			}
+			errors++
+			continue
+		}
 
-	for _, result := range results {
-		brokerResp := result.(*Response)
+		brokerResp := m.(*Response)
+		if brokerResp.ThrottleTimeMs > response.ThrottleTimeMs {
+			response.ThrottleTimeMs = brokerResp.ThrottleTimeMs
+		}
 		response.Resources = append(
 			response.Resources,
 			brokerResp.Resources...,
 		)
 	}
 
+	if errors > 0 && errors == len(results) {
+		_, err := protocol.Result(results[0])
+		return nil, err
+	}
+
 	return response, nil
 }
 
@@ -0,0 +1,110 @@
+package describeconfigs_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/describeconfigs"
+)
+
+func TestDescribeConfigsSplitAndMerge(t *testing.T) {
+	cluster := protocol.Cluster{
+		Controller: 1,
+		Brokers: map[int32]protocol.Broker{
+			1: {ID: 1},
+			2: {ID: 2},
+		},
+	}
+
+	req := &describeconfigs.Request{
+		Resources: []describeconfigs.RequestResource{
+			{ResourceType: 2, ResourceName: "topic-1"},
+			{ResourceType: 4, ResourceName: "2"},
+			{ResourceType: 2, ResourceName: "topic-2"},
+			{ResourceType: 8, ResourceName: "2"},
+			{ResourceType: 4, ResourceName: "1"},
+			{ResourceType: 4, ResourceName: ""},
+		},
+		IncludeSynonyms:      true,
+		IncludeDocumentation: true,
+	}
+
+	messages, merger, err := req.Split(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("expected one request per broker and one for the other resources, got %d", len(messages))
+	}
+
+	want := []struct {
+		broker    int32
+		resources []string
+	}{
+		{broker: 2, resources: []string{"2", "2"}},
+		{broker: 1, resources: []string{"1"}},
+		{broker: 1, resources: []string{"topic-1", "topic-2", ""}},
+	}
+
+	for i, m := range messages {
+		r := m.(*describeconfigs.Request)
+		broker, err := r.Broker(cluster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if broker.ID != want[i].broker {
+			t.Errorf("request #%d: expected to be routed to broker %d but got %d", i, want[i].broker, broker.ID)
+		}
+		if len(r.Resources) != len(want[i].resources) {
+			t.Fatalf("request #%d: unexpected resources: %+v", i, r.Resources)
+		}
+		for j, resource := range r.Resources {
+			if resource.ResourceName != want[i].resources[j] {
+				t.Errorf("request #%d: unexpected resource #%d: %+v", i, j, resource)
+			}
+		}
+		if !r.IncludeSynonyms || !r.IncludeDocumentation {
+			t.Errorf("request #%d: the options of the request were not preserved", i)
+		}
+	}
+
+	res, err := merger.Merge(messages, []interface{}{
+		errors.New("broker unavailable"),
+		&describeconfigs.Response{
+			ThrottleTimeMs: 10,
+			Resources:      []describeconfigs.ResponseResource{{ResourceType: 4, ResourceName: "1"}},
+		},
+		&describeconfigs.Response{
+			Resources: []describeconfigs.ResponseResource{
+				{ResourceType: 2, ResourceName: "topic-1"},
+				{ResourceType: 2, ResourceName: "topic-2"},
+				{ResourceType: 4, ResourceName: ""},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := res.(*describeconfigs.Response)
+	if r.ThrottleTimeMs != 10 {
+		t.Errorf("unexpected throttle time: %d", r.ThrottleTimeMs)
+	}
+	if len(r.Resources) != 6 {
+		t.Fatalf("expected the results of all resources, got %+v", r.Resources)
+	}
+	for _, resource := range r.Resources[:2] {
+		if resource.ResourceName != "2" || resource.ErrorCode == 0 || resource.ErrorMessage != "broker unavailable" {
+			t.Errorf("expected the error to be reported on the resources of the failed request: %+v", resource)
+		}
+	}
+
+	if _, err := merger.Merge(messages, []interface{}{
+		errors.New("broker unavailable"),
+		errors.New("broker unavailable"),
+		errors.New("broker unavailable"),
+	}); err == nil {
+		t.Error("expected an error when all requests failed")
+	}
+}
@@ -21,7 +21,7 @@ type RequestTopicPartitions struct {
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.ElectLeaders }
 
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 type Response struct {
@@ -42,3 +42,9 @@ type ResponsePartitionResult struct {
 }
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.ElectLeaders }
+
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller.
+func (r *Response) NotController() bool {
+	return r.ErrorCode == protocol.NotControllerCode
+}
@@ -419,6 +419,9 @@ var (
 )
 
 func encodeFuncOf(typ reflect.Type, version int16, flexible bool, tag structTag) encodeFunc {
+	if typ == recordSetType && tag.Nullable {
+		return (*encoder).encodeNullableRecordSet
+	}
 	if reflect.PtrTo(typ).Implements(writerTo) {
 		return writerEncodeFuncOf(typ)
 	}
@@ -437,6 +440,11 @@ func encodeFuncOf(typ reflect.Type, version int16, flexible bool, tag structTag)
 		return stringEncodeFuncOf(flexible, tag)
 	case reflect.Struct:
 		return structEncodeFuncOf(typ, version, flexible)
+	case reflect.Ptr:
+		if typ.Elem().Kind() == reflect.Struct { // nullable struct
+			return nullStructEncodeFuncOf(typ.Elem(), version, flexible)
+		}
+		panic("unsupported type: " + typ.String())
 	case reflect.Slice:
 		if typ.Elem().Kind() == reflect.Uint8 { // []byte
 			return bytesEncodeFuncOf(flexible, tag)
@@ -536,6 +544,20 @@ func structEncodeFuncOf(typ reflect.Type, version int16, flexible bool) encodeFu
 	}
 }
 
+// nullStructEncodeFuncOf returns an encoder for structures declared as
+// pointers, nil pointers are encoded as null structures.
+func nullStructEncodeFuncOf(typ reflect.Type, version int16, flexible bool) encodeFunc {
+	encode := structEncodeFuncOf(typ, version, flexible)
+	return func(e *encoder, v value) {
+		if v.isNil() {
+			e.writeInt8(-1)
+			return
+		}
+		e.writeInt8(1)
+		encode(e, v.elem())
+	}
+}
+
 func arrayEncodeFuncOf(typ reflect.Type, version int16, flexible bool, tag structTag) encodeFunc {
 	elemType := typ.Elem()
 	elemFunc := encodeFuncOf(elemType, version, flexible, tag)
@@ -569,6 +591,24 @@ func writerEncodeFuncOf(typ reflect.Type) encodeFunc {
 	}
 }
 
+var (
+	recordSetType    = reflect.TypeOf(RecordSet{})
+	recordSetPtrType = reflect.PtrTo(recordSetType)
+	recordSetEncode  = writerEncodeFuncOf(recordSetType)
+)
+
+// encodeNullableRecordSet encodes record sets which are allowed to contain no
+// records, which is the case of partitions in fetch responses. Instead of
+// failing with ErrNoRecord, a record set with no records is encoded as an
+// empty sequence of bytes.
+func (e *encoder) encodeNullableRecordSet(v value) {
+	if rs := v.iface(recordSetPtrType).(*RecordSet); rs.Records == nil {
+		e.writeInt32(0)
+		return
+	}
+	recordSetEncode(e, v)
+}
+
 func writeInt8(b []byte, i int8) {
 	b[0] = byte(i)
 }
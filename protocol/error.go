@@ -39,6 +39,11 @@ const (
 	ErrNoReset Error = "record sequence does not support reset"
 )
 
+// NotControllerCode is the error code returned by brokers receiving requests
+// which must be handled by the controller of the cluster while they are not
+// the controller, or could not forward the request to it.
+const NotControllerCode int16 = 41
+
 type TopicError struct {
 	Topic string
 	Err   error
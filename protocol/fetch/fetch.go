@@ -21,11 +21,28 @@ type Request struct {
 	Topics          []RequestTopic          `kafka:"min=v0,max=v11"`
 	ForgottenTopics []RequestForgottenTopic `kafka:"min=v7,max=v11"`
 	RackID          string                  `kafka:"min=v11,max=v11"`
+
+	// When not nil, the request is sent to the broker with this id instead of
+	// the leader of the partitions. Followers only serve fetch requests with
+	// the ReplicaID set to DebuggingReplicaID.
+	BrokerID *int32 `kafka:"-"`
 }
 
+// DebuggingReplicaID is the replica id reserved for debugging consumers, which
+// are allowed to fetch records from follower replicas.
+const DebuggingReplicaID = -2
+
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.Fetch }
 
 func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
+	if r.BrokerID != nil {
+		broker, ok := cluster.Brokers[*r.BrokerID]
+		if !ok {
+			return broker, NewError(fmt.Errorf("broker %d not found in the cluster", *r.BrokerID))
+		}
+		return broker, nil
+	}
+
 	broker := protocol.Broker{ID: -1}
 
 	for i := range r.Topics {
@@ -97,7 +114,7 @@ type ResponsePartition struct {
 	LogStartOffset       int64                 `kafka:"min=v5,max=v11"`
 	AbortedTransactions  []ResponseTransaction `kafka:"min=v4,max=v11"`
 	PreferredReadReplica int32                 `kafka:"min=v11,max=v11"`
-	RecordSet            protocol.RecordSet    `kafka:"min=v0,max=v11"`
+	RecordSet            protocol.RecordSet    `kafka:"min=v0,max=v11,nullable"`
 }
 
 type ResponseTransaction struct {
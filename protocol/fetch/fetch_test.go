@@ -88,6 +88,24 @@ func TestFetchResponse(t *testing.T) {
 			},
 		},
 	})
+
+	// Partitions with no records to return are encoded with an empty record
+	// set.
+	for _, version := range []int16{v0, v11} {
+		prototest.TestResponse(t, version, &fetch.Response{
+			Topics: []fetch.ResponseTopic{
+				{
+					Topic: "topic-1",
+					Partitions: []fetch.ResponsePartition{
+						{
+							Partition:     1,
+							HighWatermark: 1000,
+						},
+					},
+				},
+			},
+		})
+	}
 }
 
 func BenchmarkFetchResponse(b *testing.B) {
@@ -145,3 +163,55 @@ func BenchmarkFetchResponse(b *testing.B) {
 		},
 	})
 }
+
+func TestFetchRequestBroker(t *testing.T) {
+	cluster := protocol.Cluster{
+		Brokers: map[int32]protocol.Broker{
+			0: {ID: 0},
+			1: {ID: 1},
+		},
+		Topics: map[string]protocol.Topic{
+			"topic-1": {
+				Name: "topic-1",
+				Partitions: map[int32]protocol.Partition{
+					0: {ID: 0, Leader: 0, Replicas: []int32{0, 1}},
+				},
+			},
+		},
+	}
+
+	req := &fetch.Request{
+		ReplicaID: -1,
+		Topics: []fetch.RequestTopic{{
+			Topic:      "topic-1",
+			Partitions: []fetch.RequestPartition{{Partition: 0}},
+		}},
+	}
+
+	b, err := req.Broker(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != 0 {
+		t.Errorf("expected the request to be sent to the leader 0 but got %d", b.ID)
+	}
+
+	follower := int32(1)
+	req.ReplicaID = fetch.DebuggingReplicaID
+	req.BrokerID = &follower
+
+	b, err = req.Broker(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.ID != 1 {
+		t.Errorf("expected the request to be sent to the follower 1 but got %d", b.ID)
+	}
+
+	unknown := int32(2)
+	req.BrokerID = &unknown
+
+	if _, err := req.Broker(cluster); err == nil {
+		t.Error("expected an error sending the request to an unknown broker")
+	}
+}
@@ -7,19 +7,51 @@ func init() {
 }
 
 type Request struct {
-	Key     string `kafka:"min=v0,max=v2"`
-	KeyType int8   `kafka:"min=v1,max=v2"`
+	// We need at least one tagged field to indicate that v3+ uses "flexible"
+	// messages.
+	_ struct{} `kafka:"min=v3,max=v4,tag"`
+
+	Key             string   `kafka:"min=v0,max=v3"`
+	KeyType         int8     `kafka:"min=v1,max=v4"`
+	CoordinatorKeys []string `kafka:"min=v4,max=v4"`
 }
 
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.FindCoordinator }
 
+// MaxApiVersion satisfies the protocol.LimitedMessage interface. Starting with
+// v4 the keys are carried in the CoordinatorKeys array, requests looking up a
+// single key are sent with v3 at most so their responses keep carrying the
+// coordinator in the top-level fields.
+func (r *Request) MaxApiVersion() int16 {
+	if len(r.CoordinatorKeys) == 0 {
+		return 3
+	}
+	return 4
+}
+
+var _ protocol.LimitedMessage = (*Request)(nil)
+
 type Response struct {
-	ThrottleTimeMs int32  `kafka:"min=v1,max=v2"`
-	ErrorCode      int16  `kafka:"min=v0,max=v2"`
-	ErrorMessage   string `kafka:"min=v1,max=v2,nullable"`
-	NodeID         int32  `kafka:"min=v0,max=v2"`
-	Host           string `kafka:"min=v0,max=v2"`
-	Port           int32  `kafka:"min=v0,max=v2"`
+	// We need at least one tagged field to indicate that v3+ uses "flexible"
+	// messages.
+	_ struct{} `kafka:"min=v3,max=v4,tag"`
+
+	ThrottleTimeMs int32                 `kafka:"min=v1,max=v4"`
+	ErrorCode      int16                 `kafka:"min=v0,max=v3"`
+	ErrorMessage   string                `kafka:"min=v1,max=v3,nullable"`
+	NodeID         int32                 `kafka:"min=v0,max=v3"`
+	Host           string                `kafka:"min=v0,max=v3"`
+	Port           int32                 `kafka:"min=v0,max=v3"`
+	Coordinators   []ResponseCoordinator `kafka:"min=v4,max=v4"`
 }
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.FindCoordinator }
+
+type ResponseCoordinator struct {
+	Key          string `kafka:"min=v4,max=v4"`
+	NodeID       int32  `kafka:"min=v4,max=v4"`
+	Host         string `kafka:"min=v4,max=v4"`
+	Port         int32  `kafka:"min=v4,max=v4"`
+	ErrorCode    int16  `kafka:"min=v4,max=v4"`
+	ErrorMessage string `kafka:"min=v4,max=v4,nullable"`
+}
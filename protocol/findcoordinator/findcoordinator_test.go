@@ -0,0 +1,62 @@
+package findcoordinator_test
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/findcoordinator"
+	"github.com/segmentio/kafka-go/protocol/prototest"
+)
+
+const (
+	v0 = 0
+	v1 = 1
+	v3 = 3
+	v4 = 4
+)
+
+func TestFindCoordinatorRequest(t *testing.T) {
+	prototest.TestRequest(t, v0, &findcoordinator.Request{
+		Key: "group-1",
+	})
+
+	for _, version := range []int16{v1, v3} {
+		prototest.TestRequest(t, version, &findcoordinator.Request{
+			Key:     "group-1",
+			KeyType: 1,
+		})
+	}
+
+	prototest.TestRequest(t, v4, &findcoordinator.Request{
+		KeyType:         0,
+		CoordinatorKeys: []string{"group-1", "group-2"},
+	})
+}
+
+func TestFindCoordinatorResponse(t *testing.T) {
+	for _, version := range []int16{v1, v3} {
+		prototest.TestResponse(t, version, &findcoordinator.Response{
+			ThrottleTimeMs: 10,
+			ErrorMessage:   "",
+			NodeID:         1,
+			Host:           "localhost",
+			Port:           9092,
+		})
+	}
+
+	prototest.TestResponse(t, v4, &findcoordinator.Response{
+		ThrottleTimeMs: 10,
+		Coordinators: []findcoordinator.ResponseCoordinator{
+			{Key: "group-1", NodeID: 1, Host: "localhost", Port: 9092},
+			{Key: "group-2", ErrorCode: 15, ErrorMessage: "coordinator not available"},
+		},
+	})
+}
+
+func TestFindCoordinatorRequestMaxApiVersion(t *testing.T) {
+	if v := (&findcoordinator.Request{Key: "group-1"}).MaxApiVersion(); v != v3 {
+		t.Errorf("expected requests for a single key to be limited to v3 but got v%d", v)
+	}
+	if v := (&findcoordinator.Request{CoordinatorKeys: []string{"group-1"}}).MaxApiVersion(); v != v4 {
+		t.Errorf("expected batched requests to use v4 but got v%d", v)
+	}
+}
@@ -61,7 +61,7 @@ func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
 		}
 	}
 
-	return cluster.Brokers[cluster.Controller], nil
+	return cluster.ControllerBroker(), nil
 }
 
 type Response struct {
@@ -77,3 +77,15 @@ type ResponseAlterResponse struct {
 }
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.IncrementalAlterConfigs }
+
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller, in which case all results carry the
+// error.
+func (r *Response) NotController() bool {
+	for _, result := range r.Responses {
+		if result.ErrorCode != protocol.NotControllerCode {
+			return false
+		}
+	}
+	return len(r.Responses) != 0
+}
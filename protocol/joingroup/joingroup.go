@@ -0,0 +1,56 @@
+package joingroup
+
+import "github.com/segmentio/kafka-go/protocol"
+
+func init() {
+	protocol.Register(&Request{}, &Response{})
+}
+
+// Detailed API definition: https://kafka.apache.org/protocol#The_Messages_JoinGroup
+type Request struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v6,max=v7,tag"`
+
+	GroupID            string            `kafka:"min=v0,max=v7"`
+	SessionTimeoutMs   int32             `kafka:"min=v0,max=v7"`
+	RebalanceTimeoutMs int32             `kafka:"min=v1,max=v7"`
+	MemberID           string            `kafka:"min=v0,max=v7"`
+	GroupInstanceID    string            `kafka:"min=v5,max=v7,nullable"`
+	ProtocolType       string            `kafka:"min=v0,max=v7"`
+	Protocols          []RequestProtocol `kafka:"min=v0,max=v7"`
+}
+
+type RequestProtocol struct {
+	Name     string `kafka:"min=v0,max=v7"`
+	Metadata []byte `kafka:"min=v0,max=v7"`
+}
+
+func (r *Request) ApiKey() protocol.ApiKey { return protocol.JoinGroup }
+
+func (r *Request) Group() string { return r.GroupID }
+
+var _ protocol.GroupMessage = (*Request)(nil)
+
+type Response struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v6,max=v7,tag"`
+
+	ThrottleTimeMs int32            `kafka:"min=v2,max=v7"`
+	ErrorCode      int16            `kafka:"min=v0,max=v7"`
+	GenerationID   int32            `kafka:"min=v0,max=v7"`
+	ProtocolType   string           `kafka:"min=v7,max=v7,nullable"`
+	ProtocolName   string           `kafka:"min=v0,max=v6|min=v7,max=v7,nullable"`
+	LeaderID       string           `kafka:"min=v0,max=v7"`
+	MemberID       string           `kafka:"min=v0,max=v7"`
+	Members        []ResponseMember `kafka:"min=v0,max=v7"`
+}
+
+type ResponseMember struct {
+	MemberID        string `kafka:"min=v0,max=v7"`
+	GroupInstanceID string `kafka:"min=v5,max=v7,nullable"`
+	Metadata        []byte `kafka:"min=v0,max=v7"`
+}
+
+func (r *Response) ApiKey() protocol.ApiKey { return protocol.JoinGroup }
@@ -0,0 +1,102 @@
+package joingroup_test
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/prototest"
+)
+
+func TestJoinGroupRequest(t *testing.T) {
+	prototest.TestRequest(t, 0, &joingroup.Request{
+		GroupID:          "group-1",
+		SessionTimeoutMs: 10000,
+		MemberID:         "member-1",
+		ProtocolType:     "consumer",
+		Protocols: []joingroup.RequestProtocol{
+			{Name: "range", Metadata: []byte("metadata")},
+		},
+	})
+
+	// Versions 1-4 have all the same fields.
+	for _, version := range []int16{1, 2, 3, 4} {
+		prototest.TestRequest(t, version, &joingroup.Request{
+			GroupID:            "group-1",
+			SessionTimeoutMs:   10000,
+			RebalanceTimeoutMs: 60000,
+			MemberID:           "member-1",
+			ProtocolType:       "consumer",
+			Protocols: []joingroup.RequestProtocol{
+				{Name: "range", Metadata: []byte("metadata-1")},
+				{Name: "roundrobin", Metadata: []byte("metadata-2")},
+			},
+		})
+	}
+
+	for _, version := range []int16{5, 6, 7} {
+		prototest.TestRequest(t, version, &joingroup.Request{
+			GroupID:            "group-2",
+			SessionTimeoutMs:   10000,
+			RebalanceTimeoutMs: 60000,
+			MemberID:           "member-2",
+			GroupInstanceID:    "instance-1",
+			ProtocolType:       "consumer",
+			Protocols: []joingroup.RequestProtocol{
+				{Name: "range", Metadata: []byte("metadata-1")},
+			},
+		})
+	}
+}
+
+func TestJoinGroupResponse(t *testing.T) {
+	// Versions 0-1 have all the same fields.
+	for _, version := range []int16{0, 1} {
+		prototest.TestResponse(t, version, &joingroup.Response{
+			ErrorCode:    0,
+			GenerationID: 1,
+			ProtocolName: "range",
+			LeaderID:     "member-1",
+			MemberID:     "member-1",
+			Members: []joingroup.ResponseMember{
+				{MemberID: "member-1", Metadata: []byte("metadata-1")},
+				{MemberID: "member-2", Metadata: []byte("metadata-2")},
+			},
+		})
+	}
+
+	// Versions 2-4 have all the same fields.
+	for _, version := range []int16{2, 3, 4} {
+		prototest.TestResponse(t, version, &joingroup.Response{
+			ThrottleTimeMs: 10,
+			GenerationID:   2,
+			ProtocolName:   "range",
+			LeaderID:       "member-1",
+			MemberID:       "member-2",
+		})
+	}
+
+	for _, version := range []int16{5, 6} {
+		prototest.TestResponse(t, version, &joingroup.Response{
+			ThrottleTimeMs: 10,
+			GenerationID:   3,
+			ProtocolName:   "range",
+			LeaderID:       "member-1",
+			MemberID:       "member-1",
+			Members: []joingroup.ResponseMember{
+				{MemberID: "member-1", GroupInstanceID: "instance-1", Metadata: []byte("metadata-1")},
+			},
+		})
+	}
+
+	prototest.TestResponse(t, 7, &joingroup.Response{
+		ThrottleTimeMs: 10,
+		GenerationID:   4,
+		ProtocolType:   "consumer",
+		ProtocolName:   "range",
+		LeaderID:       "member-1",
+		MemberID:       "member-1",
+		Members: []joingroup.ResponseMember{
+			{MemberID: "member-1", GroupInstanceID: "instance-1", Metadata: []byte("metadata-1")},
+		},
+	})
+}
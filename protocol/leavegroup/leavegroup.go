@@ -0,0 +1,60 @@
+package leavegroup
+
+import "github.com/segmentio/kafka-go/protocol"
+
+func init() {
+	protocol.Register(&Request{}, &Response{})
+}
+
+// Detailed API definition: https://kafka.apache.org/protocol#The_Messages_LeaveGroup
+type Request struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v4,max=v4,tag"`
+
+	GroupID  string          `kafka:"min=v0,max=v4"`
+	MemberID string          `kafka:"min=v0,max=v2"`
+	Members  []RequestMember `kafka:"min=v3,max=v4"`
+}
+
+type RequestMember struct {
+	MemberID        string `kafka:"min=v3,max=v4"`
+	GroupInstanceID string `kafka:"min=v3,max=v4,nullable"`
+}
+
+func (r *Request) ApiKey() protocol.ApiKey { return protocol.LeaveGroup }
+
+func (r *Request) Group() string { return r.GroupID }
+
+func (r *Request) Prepare(apiVersion int16) {
+	// Starting with v3, the members leaving the group are carried in the
+	// Members array instead of the top-level MemberID field. Programs that
+	// remove a single member don't need to be aware of it, the field is moved
+	// into the array when the negotiated version requires it.
+	if apiVersion >= 3 && len(r.Members) == 0 && r.MemberID != "" {
+		r.Members = []RequestMember{{MemberID: r.MemberID}}
+	}
+}
+
+var (
+	_ protocol.GroupMessage    = (*Request)(nil)
+	_ protocol.PreparedMessage = (*Request)(nil)
+)
+
+type Response struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v4,max=v4,tag"`
+
+	ThrottleTimeMs int32            `kafka:"min=v1,max=v4"`
+	ErrorCode      int16            `kafka:"min=v0,max=v4"`
+	Members        []ResponseMember `kafka:"min=v3,max=v4"`
+}
+
+type ResponseMember struct {
+	MemberID        string `kafka:"min=v3,max=v4"`
+	GroupInstanceID string `kafka:"min=v3,max=v4,nullable"`
+	ErrorCode       int16  `kafka:"min=v3,max=v4"`
+}
+
+func (r *Response) ApiKey() protocol.ApiKey { return protocol.LeaveGroup }
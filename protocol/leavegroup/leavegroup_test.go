@@ -0,0 +1,53 @@
+package leavegroup_test
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/prototest"
+)
+
+func TestLeaveGroupRequest(t *testing.T) {
+	// Versions 0-2 have all the same fields.
+	for _, version := range []int16{0, 1, 2} {
+		prototest.TestRequest(t, version, &leavegroup.Request{
+			GroupID:  "group-1",
+			MemberID: "member-1",
+		})
+	}
+
+	// Versions 3-4 have all the same fields.
+	for _, version := range []int16{3, 4} {
+		prototest.TestRequest(t, version, &leavegroup.Request{
+			GroupID: "group-2",
+			Members: []leavegroup.RequestMember{
+				{MemberID: "member-1"},
+				{MemberID: "member-2", GroupInstanceID: "instance-2"},
+			},
+		})
+	}
+}
+
+func TestLeaveGroupResponse(t *testing.T) {
+	prototest.TestResponse(t, 0, &leavegroup.Response{
+		ErrorCode: 25,
+	})
+
+	// Versions 1-2 have all the same fields.
+	for _, version := range []int16{1, 2} {
+		prototest.TestResponse(t, version, &leavegroup.Response{
+			ThrottleTimeMs: 10,
+		})
+	}
+
+	// Versions 3-4 have all the same fields.
+	for _, version := range []int16{3, 4} {
+		prototest.TestResponse(t, version, &leavegroup.Response{
+			ThrottleTimeMs: 10,
+			Members: []leavegroup.ResponseMember{
+				{MemberID: "member-1", ErrorCode: 0},
+				{MemberID: "member-2", GroupInstanceID: "instance-2", ErrorCode: 25},
+			},
+		})
+	}
+}
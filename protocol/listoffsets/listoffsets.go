@@ -10,21 +10,29 @@ func init() {
 	protocol.Register(&Request{}, &Response{})
 }
 
+// MaxTimestamp is the timestamp requesting the offset of the record with the
+// largest timestamp of a partition, it requires v7 or above.
+const MaxTimestamp = -3
+
 type Request struct {
-	ReplicaID      int32          `kafka:"min=v1,max=v5"`
-	IsolationLevel int8           `kafka:"min=v2,max=v5"`
-	Topics         []RequestTopic `kafka:"min=v1,max=v5"`
+	// We need at least one tagged field to indicate that v6+ uses "flexible"
+	// messages.
+	_ struct{} `kafka:"min=v6,max=v7,tag"`
+
+	ReplicaID      int32          `kafka:"min=v1,max=v7"`
+	IsolationLevel int8           `kafka:"min=v2,max=v7"`
+	Topics         []RequestTopic `kafka:"min=v1,max=v7"`
 }
 
 type RequestTopic struct {
-	Topic      string             `kafka:"min=v1,max=v5"`
-	Partitions []RequestPartition `kafka:"min=v1,max=v5"`
+	Topic      string             `kafka:"min=v1,max=v7"`
+	Partitions []RequestPartition `kafka:"min=v1,max=v7"`
 }
 
 type RequestPartition struct {
-	Partition          int32 `kafka:"min=v1,max=v5"`
-	CurrentLeaderEpoch int32 `kafka:"min=v4,max=v5"`
-	Timestamp          int64 `kafka:"min=v1,max=v5"`
+	Partition          int32 `kafka:"min=v1,max=v7"`
+	CurrentLeaderEpoch int32 `kafka:"min=v4,max=v7"`
+	Timestamp          int64 `kafka:"min=v1,max=v7"`
 	// v0 of the API predates kafka 0.10, and doesn't make much sense to
 	// use so we chose not to support it. It had this extra field to limit
 	// the number of offsets returned, which has been removed in v1.
@@ -54,59 +62,102 @@ func (r *Request) Split(cluster protocol.Cluster) ([]protocol.Message, protocol.
 	// entries of unique topic/partition pairs, we submit multiple requests on
 	// the wire and merge their results back.
 	//
-	// ListOffsets requests also need to be sent to partition leaders, to keep
-	// the logic simple we simply split each offset request into a single
-	// message. This may cause a bit more requests to be sent on the wire but
-	// it keeps the code sane, we can still optimize the aggregation mechanism
-	// later if it becomes a problem.
+	// ListOffsets requests also need to be sent to partition leaders, the
+	// partitions are grouped by leader and a single request is sent to each
+	// broker, unless offsets at multiple timestamps are requested for the same
+	// partition, in which case the entries are spread over as many requests
+	// as needed.
 	//
 	// Really the idea here is to shield applications from having to deal with
 	// the limitation of the kafka server, so they can request any combinations
 	// of topic/partition/offsets.
-	requests := make([]Request, 0, 2*len(r.Topics))
+	type topicPartition struct {
+		topic     string
+		partition int32
+	}
+
+	type leaderRequests struct {
+		requests []Request
+		entries  map[topicPartition]int
+	}
+
+	leaders := make(map[int32]*leaderRequests)
+	order := make([]int32, 0)
 
 	for _, t := range r.Topics {
 		for _, p := range t.Partitions {
-			requests = append(requests, Request{
-				ReplicaID:      r.ReplicaID,
-				IsolationLevel: r.IsolationLevel,
-				Topics: []RequestTopic{{
-					Topic: t.Topic,
-					Partitions: []RequestPartition{{
-						Partition:          p.Partition,
-						CurrentLeaderEpoch: p.CurrentLeaderEpoch,
-						Timestamp:          p.Timestamp,
-					}},
-				}},
-			})
+			leader := int32(-1)
+			if partition, ok := cluster.Topics[t.Topic].Partitions[p.Partition]; ok {
+				leader = partition.Leader
+			}
+
+			l := leaders[leader]
+			if l == nil {
+				l = &leaderRequests{entries: make(map[topicPartition]int)}
+				leaders[leader] = l
+				order = append(order, leader)
+			}
+
+			key := topicPartition{topic: t.Topic, partition: p.Partition}
+			n := l.entries[key]
+			l.entries[key] = n + 1
+
+			if n == len(l.requests) {
+				l.requests = append(l.requests, Request{
+					ReplicaID:      r.ReplicaID,
+					IsolationLevel: r.IsolationLevel,
+				})
+			}
+
+			l.requests[n].add(t.Topic, p)
 		}
 	}
 
-	messages := make([]protocol.Message, len(requests))
+	messages := make([]protocol.Message, 0, len(leaders))
 
-	for i := range requests {
-		messages[i] = &requests[i]
+	for _, leader := range order {
+		requests := leaders[leader].requests
+		for i := range requests {
+			messages = append(messages, &requests[i])
+		}
 	}
 
 	return messages, new(Response), nil
 }
 
+func (r *Request) add(topic string, p RequestPartition) {
+	for i := range r.Topics {
+		if t := &r.Topics[i]; t.Topic == topic {
+			t.Partitions = append(t.Partitions, p)
+			return
+		}
+	}
+	r.Topics = append(r.Topics, RequestTopic{
+		Topic:      topic,
+		Partitions: []RequestPartition{p},
+	})
+}
+
 type Response struct {
-	ThrottleTimeMs int32           `kafka:"min=v2,max=v5"`
-	Topics         []ResponseTopic `kafka:"min=v1,max=v5"`
+	// We need at least one tagged field to indicate that v6+ uses "flexible"
+	// messages.
+	_ struct{} `kafka:"min=v6,max=v7,tag"`
+
+	ThrottleTimeMs int32           `kafka:"min=v2,max=v7"`
+	Topics         []ResponseTopic `kafka:"min=v1,max=v7"`
 }
 
 type ResponseTopic struct {
-	Topic      string              `kafka:"min=v1,max=v5"`
-	Partitions []ResponsePartition `kafka:"min=v1,max=v5"`
+	Topic      string              `kafka:"min=v1,max=v7"`
+	Partitions []ResponsePartition `kafka:"min=v1,max=v7"`
 }
 
 type ResponsePartition struct {
-	Partition   int32 `kafka:"min=v1,max=v5"`
-	ErrorCode   int16 `kafka:"min=v1,max=v5"`
-	Timestamp   int64 `kafka:"min=v1,max=v5"`
-	Offset      int64 `kafka:"min=v1,max=v5"`
-	LeaderEpoch int32 `kafka:"min=v4,max=v5"`
+	Partition   int32 `kafka:"min=v1,max=v7"`
+	ErrorCode   int16 `kafka:"min=v1,max=v7"`
+	Timestamp   int64 `kafka:"min=v1,max=v7"`
+	Offset      int64 `kafka:"min=v1,max=v7"`
+	LeaderEpoch int32 `kafka:"min=v4,max=v7"`
 }
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.ListOffsets }
@@ -157,7 +208,7 @@ func (r *Response) Merge(requests []protocol.Message, results []interface{}) (pr
 					partitions = append(partitions, ResponsePartition{
 						Partition:   p.Partition,
 						ErrorCode:   -1, // UNKNOWN, can we do better?
-						Timestamp:   -1,
+						Timestamp:   p.Timestamp,
 						Offset:      -1,
 						LeaderEpoch: -1,
 					})
@@ -177,10 +228,13 @@ func (r *Response) Merge(requests []protocol.Message, results []interface{}) (pr
 
 		for _, t := range response.Topics {
 			for _, p := range t.Partitions {
+				// The timestamp of the record is kept in responses to
+				// MaxTimestamp requests, since it is the value that was
+				// asked for.
 				if timestamp, ok := timestamps[i][topicPartition{
 					topic:     t.Topic,
 					partition: p.Partition,
-				}]; ok {
+				}]; ok && timestamp != MaxTimestamp {
 					p.Timestamp = timestamp
 				}
 				topics[t.Topic] = append(topics[t.Topic], p)
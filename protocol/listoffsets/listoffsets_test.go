@@ -1,8 +1,13 @@
 package listoffsets_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
 	"testing"
 
+	"github.com/segmentio/kafka-go/protocol"
 	"github.com/segmentio/kafka-go/protocol/listoffsets"
 	"github.com/segmentio/kafka-go/protocol/prototest"
 )
@@ -10,6 +15,7 @@ import (
 const (
 	v1 = 1
 	v4 = 4
+	v7 = 7
 )
 
 func TestListOffsetsRequest(t *testing.T) {
@@ -51,6 +57,21 @@ func TestListOffsetsRequest(t *testing.T) {
 	})
 }
 
+func TestListOffsetsRequestMaxTimestamp(t *testing.T) {
+	prototest.TestRequest(t, v7, &listoffsets.Request{
+		ReplicaID:      -1,
+		IsolationLevel: 1,
+		Topics: []listoffsets.RequestTopic{
+			{
+				Topic: "topic-1",
+				Partitions: []listoffsets.RequestPartition{
+					{Partition: 0, CurrentLeaderEpoch: -1, Timestamp: listoffsets.MaxTimestamp},
+				},
+			},
+		},
+	})
+}
+
 func TestListOffsetsResponse(t *testing.T) {
 	prototest.TestResponse(t, v1, &listoffsets.Response{
 		Topics: []listoffsets.ResponseTopic{
@@ -101,4 +122,167 @@ func TestListOffsetsResponse(t *testing.T) {
 			},
 		},
 	})
+	prototest.TestResponse(t, v7, &listoffsets.Response{
+		ThrottleTimeMs: 1234,
+		Topics: []listoffsets.ResponseTopic{
+			{
+				Topic: "topic-1",
+				Partitions: []listoffsets.ResponsePartition{
+					{
+						Partition:   0,
+						Timestamp:   1e9,
+						Offset:      1234567890,
+						LeaderEpoch: 10,
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestListOffsetsResponseUnknownTaggedFields(t *testing.T) {
+	res := &listoffsets.Response{
+		ThrottleTimeMs: 1,
+		Topics: []listoffsets.ResponseTopic{
+			{
+				Topic: "topic-1",
+				Partitions: []listoffsets.ResponsePartition{
+					{Partition: 0, Timestamp: 1e9, Offset: 42, LeaderEpoch: 2},
+				},
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := protocol.WriteResponse(buf, v7, 1, res); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+
+	// Replace the empty tag buffers of the response header (after the size and
+	// correlation id) and of the response body (last byte) with buffers holding
+	// tagged fields unknown to the program.
+	var msg []byte
+	msg = append(msg, b[4:8]...)
+	msg = append(msg, 1, 7, 2, 0xAB, 0xCD)
+	msg = append(msg, b[9:len(b)-1]...)
+	msg = append(msg, 2, 3, 1, 0xFF, 9, 0)
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(msg)))
+	r := bytes.NewReader(append(size[:], msg...))
+
+	correlationID, found, err := protocol.ReadResponse(r, protocol.ListOffsets, v7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if correlationID != 1 {
+		t.Errorf("unexpected correlation id: %d", correlationID)
+	}
+	if !reflect.DeepEqual(res, found) {
+		t.Errorf("response mismatch:\nexpected: %+v\nfound:    %+v", res, found)
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes left unread", r.Len())
+	}
+}
+
+func TestListOffsetsSplitAndMerge(t *testing.T) {
+	cluster := protocol.Cluster{
+		Brokers: map[int32]protocol.Broker{
+			1: {ID: 1},
+			2: {ID: 2},
+		},
+		Topics: map[string]protocol.Topic{
+			"topic-1": {
+				Name: "topic-1",
+				Partitions: map[int32]protocol.Partition{
+					0: {ID: 0, Leader: 1},
+					1: {ID: 1, Leader: 1},
+					2: {ID: 2, Leader: 2},
+				},
+			},
+		},
+	}
+
+	req := &listoffsets.Request{
+		ReplicaID: -1,
+		Topics: []listoffsets.RequestTopic{{
+			Topic: "topic-1",
+			Partitions: []listoffsets.RequestPartition{
+				{Partition: 0, Timestamp: 1000},
+				{Partition: 1, Timestamp: 1000},
+				{Partition: 0, Timestamp: 2000},
+				{Partition: 2, Timestamp: 1000},
+			},
+		}},
+	}
+
+	msgs, merger, err := req.Split(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The entries of the same partition cannot be sent in the same request.
+	expected := []struct {
+		broker     int32
+		partitions []int32
+	}{
+		{broker: 1, partitions: []int32{0, 1}},
+		{broker: 1, partitions: []int32{0}},
+		{broker: 2, partitions: []int32{2}},
+	}
+
+	if len(msgs) != len(expected) {
+		t.Fatalf("expected %d requests but got %d", len(expected), len(msgs))
+	}
+
+	results := make([]interface{}, len(msgs))
+
+	for i, m := range msgs {
+		r := m.(*listoffsets.Request)
+		b, err := r.Broker(cluster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.ID != expected[i].broker {
+			t.Errorf("request %d: expected broker %d but got %d", i, expected[i].broker, b.ID)
+		}
+
+		var partitions []int32
+		var res listoffsets.ResponseTopic
+		res.Topic = "topic-1"
+		for _, p := range r.Topics[0].Partitions {
+			partitions = append(partitions, p.Partition)
+			res.Partitions = append(res.Partitions, listoffsets.ResponsePartition{
+				Partition: p.Partition,
+				Timestamp: -1,
+				Offset:    p.Timestamp / 1000,
+			})
+		}
+		if !reflect.DeepEqual(partitions, expected[i].partitions) {
+			t.Errorf("request %d: expected partitions %v but got %v", i, expected[i].partitions, partitions)
+		}
+
+		results[i] = &listoffsets.Response{Topics: []listoffsets.ResponseTopic{res}}
+	}
+
+	// The request sent to the second broker fails.
+	results[2] = errors.New("connection refused")
+
+	m, err := merger.Merge(msgs, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := m.(*listoffsets.Response).Topics[0].Partitions
+	want := []listoffsets.ResponsePartition{
+		{Partition: 0, Timestamp: 1000, Offset: 1},
+		{Partition: 0, Timestamp: 2000, Offset: 2},
+		{Partition: 1, Timestamp: 1000, Offset: 1},
+		{Partition: 2, ErrorCode: -1, Timestamp: 1000, Offset: -1, LeaderEpoch: -1},
+	}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("response mismatch:\nexpected: %+v\nfound:    %+v", want, found)
+	}
 }
@@ -1,17 +1,22 @@
 package metadata_test
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/segmentio/kafka-go/protocol"
 	"github.com/segmentio/kafka-go/protocol/metadata"
 	"github.com/segmentio/kafka-go/protocol/prototest"
 )
 
 const (
-	v0 = 0
-	v1 = 1
-	v4 = 4
-	v8 = 8
+	v0  = 0
+	v1  = 1
+	v4  = 4
+	v8  = 8
+	v9  = 9
+	v10 = 10
+	v12 = 12
 )
 
 func TestMetadataRequest(t *testing.T) {
@@ -30,6 +35,43 @@ func TestMetadataRequest(t *testing.T) {
 		IncludeClusterAuthorizedOperations: true,
 		IncludeTopicAuthorizedOperations:   true,
 	})
+
+	prototest.TestRequest(t, v9, &metadata.Request{
+		Topics: []metadata.RequestTopic{
+			{Name: "hello"},
+			{Name: "world"},
+		},
+		AllowAutoTopicCreation:             true,
+		IncludeClusterAuthorizedOperations: true,
+	})
+
+	prototest.TestRequest(t, v12, &metadata.Request{
+		Topics: []metadata.RequestTopic{
+			{TopicID: protocol.UUID{0: 1}},
+			{Name: "world"},
+		},
+		IncludeTopicAuthorizedOperations: true,
+	})
+}
+
+func TestMetadataRequestPrepare(t *testing.T) {
+	req := &metadata.Request{TopicNames: []string{"hello", "world"}}
+
+	req.Prepare(v8)
+	if req.Topics != nil {
+		t.Errorf("unexpected topics for version 8: %+v", req.Topics)
+	}
+
+	req.Prepare(v12)
+	if !reflect.DeepEqual(req.Names(), []string{"hello", "world"}) {
+		t.Errorf("unexpected topics for version 12: %+v", req.Topics)
+	}
+
+	req = &metadata.Request{}
+	req.Prepare(v12)
+	if req.Topics != nil {
+		t.Errorf("a null list of topic names must be sent as null topics: %+v", req.Topics)
+	}
 }
 
 func TestMetadataResponse(t *testing.T) {
@@ -141,6 +183,42 @@ func TestMetadataResponse(t *testing.T) {
 			},
 		},
 	})
+
+	for _, version := range []int16{v9, v10, v12} {
+		res := &metadata.Response{
+			ThrottleTimeMs: 123,
+			ClusterID:      "test",
+			ControllerID:   1,
+			Brokers: []metadata.ResponseBroker{
+				{
+					NodeID: 0,
+					Host:   "127.0.0.1",
+					Port:   9092,
+					Rack:   "rack-1",
+				},
+			},
+			Topics: []metadata.ResponseTopic{
+				{
+					Name: "topic-1",
+					Partitions: []metadata.ResponsePartition{
+						{
+							PartitionIndex:  0,
+							LeaderID:        0,
+							LeaderEpoch:     3,
+							ReplicaNodes:    []int32{0},
+							IsrNodes:        []int32{0},
+							OfflineReplicas: []int32{},
+						},
+					},
+					TopicAuthorizedOperations: 0x01,
+				},
+			},
+		}
+		if version >= v10 {
+			res.Topics[0].TopicID = protocol.UUID{0: 1, 15: 2}
+		}
+		prototest.TestResponse(t, version, res)
+	}
 }
 
 func BenchmarkMetadataRequest(b *testing.B) {
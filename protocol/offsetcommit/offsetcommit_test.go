@@ -127,7 +127,10 @@ func TestOffsetCommitRequest(t *testing.T) {
 
 	// Version 7 added:
 	// GroupInstanceID
-	for _, version := range []int16{7} {
+	// Version 8 is the first flexible version, version 9 uses the generation
+	// ID to carry the member epoch of consumer groups using the consumer
+	// protocol.
+	for _, version := range []int16{7, 8, 9} {
 		prototest.TestRequest(t, version, &offsetcommit.Request{
 			GroupID:         "group-4",
 			GenerationID:    1,
@@ -176,8 +179,8 @@ func TestOffsetCommitResponse(t *testing.T) {
 
 	// Version 3 added:
 	// ThrottleTimeMs
-	// Field are the same through version 7.
-	for _, version := range []int16{3, 4, 5, 6, 7} {
+	// Field are the same through version 9.
+	for _, version := range []int16{3, 4, 5, 6, 7, 8, 9} {
 		prototest.TestResponse(t, version, &offsetcommit.Response{
 			ThrottleTimeMs: 10000,
 			Topics: []offsetcommit.ResponseTopic{
@@ -7,40 +7,81 @@ func init() {
 }
 
 type Request struct {
-	GroupID string         `kafka:"min=v0,max=v5"`
-	Topics  []RequestTopic `kafka:"min=v0,max=v5"`
+	// We need at least one tagged field to indicate that v6+ uses "flexible"
+	// messages.
+	_ struct{} `kafka:"min=v6,max=v8,tag"`
+
+	GroupID       string         `kafka:"min=v0,max=v7"`
+	Topics        []RequestTopic `kafka:"min=v0,max=v7"`
+	Groups        []RequestGroup `kafka:"min=v8,max=v8"`
+	RequireStable bool           `kafka:"min=v7,max=v8"`
 }
 
 func (r *Request) ApiKey() protocol.ApiKey { return protocol.OffsetFetch }
 
-func (r *Request) Group() string { return r.GroupID }
+func (r *Request) Group() string {
+	if r.GroupID == "" && len(r.Groups) != 0 {
+		return r.Groups[0].GroupID
+	}
+	return r.GroupID
+}
+
+func (r *Request) Prepare(apiVersion int16) {
+	// Starting with v8, the group and topics are carried in the Groups array
+	// instead of the top-level fields. Programs that construct single group
+	// requests don't need to be aware of it, the top-level fields are moved
+	// into the array when the negotiated version requires it.
+	if apiVersion >= 8 && len(r.Groups) == 0 {
+		r.Groups = []RequestGroup{{
+			GroupID: r.GroupID,
+			Topics:  r.Topics,
+		}}
+	}
+}
 
 type RequestTopic struct {
-	Name             string  `kafka:"min=v0,max=v5"`
-	PartitionIndexes []int32 `kafka:"min=v0,max=v5"`
+	Name             string  `kafka:"min=v0,max=v8"`
+	PartitionIndexes []int32 `kafka:"min=v0,max=v8"`
+}
+
+type RequestGroup struct {
+	GroupID string         `kafka:"min=v8,max=v8"`
+	Topics  []RequestTopic `kafka:"min=v8,max=v8,nullable"`
 }
 
 var (
-	_ protocol.GroupMessage = (*Request)(nil)
+	_ protocol.GroupMessage    = (*Request)(nil)
+	_ protocol.PreparedMessage = (*Request)(nil)
 )
 
 type Response struct {
-	ThrottleTimeMs int32           `kafka:"min=v3,max=v5"`
-	Topics         []ResponseTopic `kafka:"min=v0,max=v5"`
-	ErrorCode      int16           `kafka:"min=v2,max=v5"`
+	// We need at least one tagged field to indicate that v6+ uses "flexible"
+	// messages.
+	_ struct{} `kafka:"min=v6,max=v8,tag"`
+
+	ThrottleTimeMs int32           `kafka:"min=v3,max=v8"`
+	Topics         []ResponseTopic `kafka:"min=v0,max=v7"`
+	ErrorCode      int16           `kafka:"min=v2,max=v7"`
+	Groups         []ResponseGroup `kafka:"min=v8,max=v8"`
 }
 
 func (r *Response) ApiKey() protocol.ApiKey { return protocol.OffsetFetch }
 
 type ResponseTopic struct {
-	Name       string              `kafka:"min=v0,max=v5"`
-	Partitions []ResponsePartition `kafka:"min=v0,max=v5"`
+	Name       string              `kafka:"min=v0,max=v8"`
+	Partitions []ResponsePartition `kafka:"min=v0,max=v8"`
 }
 
 type ResponsePartition struct {
-	PartitionIndex      int32  `kafka:"min=v0,max=v5"`
-	CommittedOffset     int64  `kafka:"min=v0,max=v5"`
-	ComittedLeaderEpoch int32  `kafka:"min=v5,max=v5"`
-	Metadata            string `kafka:"min=v0,max=v5,nullable"`
-	ErrorCode           int16  `kafka:"min=v0,max=v5"`
+	PartitionIndex      int32  `kafka:"min=v0,max=v8"`
+	CommittedOffset     int64  `kafka:"min=v0,max=v8"`
+	ComittedLeaderEpoch int32  `kafka:"min=v5,max=v8"`
+	Metadata            string `kafka:"min=v0,max=v8,nullable"`
+	ErrorCode           int16  `kafka:"min=v0,max=v8"`
+}
+
+type ResponseGroup struct {
+	GroupID   string          `kafka:"min=v8,max=v8"`
+	Topics    []ResponseTopic `kafka:"min=v8,max=v8"`
+	ErrorCode int16           `kafka:"min=v8,max=v8"`
 }
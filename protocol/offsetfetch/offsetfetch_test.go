@@ -0,0 +1,123 @@
+package offsetfetch_test
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/offsetfetch"
+	"github.com/segmentio/kafka-go/protocol/prototest"
+)
+
+const (
+	v1 = 1
+	v5 = 5
+	v7 = 7
+	v8 = 8
+)
+
+func TestOffsetFetchRequest(t *testing.T) {
+	for _, version := range []int16{v1, v5} {
+		prototest.TestRequest(t, version, &offsetfetch.Request{
+			GroupID: "group-1",
+			Topics: []offsetfetch.RequestTopic{
+				{Name: "topic-1", PartitionIndexes: []int32{0, 1, 2}},
+			},
+		})
+	}
+
+	prototest.TestRequest(t, v7, &offsetfetch.Request{
+		GroupID: "group-1",
+		Topics: []offsetfetch.RequestTopic{
+			{Name: "topic-1", PartitionIndexes: []int32{0, 1, 2}},
+		},
+		RequireStable: true,
+	})
+
+	prototest.TestRequest(t, v8, &offsetfetch.Request{
+		Groups: []offsetfetch.RequestGroup{
+			{
+				GroupID: "group-1",
+				Topics: []offsetfetch.RequestTopic{
+					{Name: "topic-1", PartitionIndexes: []int32{0, 1, 2}},
+				},
+			},
+			{
+				GroupID: "group-2",
+				Topics: []offsetfetch.RequestTopic{
+					{Name: "topic-2", PartitionIndexes: []int32{0}},
+				},
+			},
+		},
+		RequireStable: true,
+	})
+}
+
+func TestOffsetFetchRequestPrepare(t *testing.T) {
+	req := &offsetfetch.Request{
+		GroupID: "group-1",
+		Topics: []offsetfetch.RequestTopic{
+			{Name: "topic-1", PartitionIndexes: []int32{0}},
+		},
+	}
+
+	req.Prepare(v7)
+	if len(req.Groups) != 0 {
+		t.Fatalf("groups must not be set on versions prior to v8: %+v", req.Groups)
+	}
+
+	req.Prepare(v8)
+	if len(req.Groups) != 1 || req.Groups[0].GroupID != "group-1" || len(req.Groups[0].Topics) != 1 {
+		t.Fatalf("group was not moved to the groups array on v8: %+v", req.Groups)
+	}
+	if req.Group() != "group-1" {
+		t.Fatalf("wrong group returned for routing: %q", req.Group())
+	}
+}
+
+func TestOffsetFetchResponse(t *testing.T) {
+	prototest.TestResponse(t, v5, &offsetfetch.Response{
+		ThrottleTimeMs: 10,
+		Topics: []offsetfetch.ResponseTopic{
+			{
+				Name: "topic-1",
+				Partitions: []offsetfetch.ResponsePartition{
+					{PartitionIndex: 0, CommittedOffset: 10, ComittedLeaderEpoch: 1, Metadata: "meta"},
+					{PartitionIndex: 1, CommittedOffset: -1, ErrorCode: 3},
+				},
+			},
+		},
+		ErrorCode: 0,
+	})
+
+	prototest.TestResponse(t, v7, &offsetfetch.Response{
+		ThrottleTimeMs: 10,
+		Topics: []offsetfetch.ResponseTopic{
+			{
+				Name: "topic-1",
+				Partitions: []offsetfetch.ResponsePartition{
+					{PartitionIndex: 0, CommittedOffset: 10, ComittedLeaderEpoch: 1, Metadata: "meta"},
+				},
+			},
+		},
+	})
+
+	prototest.TestResponse(t, v8, &offsetfetch.Response{
+		ThrottleTimeMs: 10,
+		Groups: []offsetfetch.ResponseGroup{
+			{
+				GroupID: "group-1",
+				Topics: []offsetfetch.ResponseTopic{
+					{
+						Name: "topic-1",
+						Partitions: []offsetfetch.ResponsePartition{
+							{PartitionIndex: 0, CommittedOffset: 10, ComittedLeaderEpoch: 1, Metadata: "meta"},
+						},
+					},
+				},
+			},
+			{
+				GroupID:   "group-2",
+				ErrorCode: 16,
+			},
+		},
+	})
+}
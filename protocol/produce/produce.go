@@ -62,11 +62,17 @@ func (r *Request) Prepare(apiVersion int16) {
 	//
 	// In version 2.x, kafka refuses the message claiming that the CRC32
 	// checksum is invalid.
+	//
+	// Versions 0 and 1 of the Produce API predate the timestamps added in
+	// version 1 of the message format.
 	var recordVersion int8
 
-	if apiVersion < 3 {
+	switch {
+	case apiVersion < 2:
+		recordVersion = 0
+	case apiVersion < 3:
 		recordVersion = 1
-	} else {
+	default:
 		recordVersion = 2
 	}
 
@@ -77,11 +83,37 @@ func (r *Request) Prepare(apiVersion int16) {
 			p := &t.Partitions[j]
 
 			// Allow the program to overload the version if really needed.
-			if p.RecordSet.Version == 0 {
+			if p.RecordSet.Version == 0 && !p.RecordSet.Version0 {
 				p.RecordSet.Version = recordVersion
+				p.RecordSet.Version0 = recordVersion == 0
+			}
+		}
+	}
+}
+
+// MaxApiVersion satisfies the protocol.LimitedMessage interface, the version
+// of the Produce API is lowered when the program forced an older version of
+// the message format on a record set, since version 3 and above only accept
+// messages in version 2 and version 2 only accepts messages in version 1.
+func (r *Request) MaxApiVersion() int16 {
+	max := protocol.Produce.MaxVersion()
+
+	for i := range r.Topics {
+		t := &r.Topics[i]
+
+		for j := range t.Partitions {
+			p := &t.Partitions[j]
+
+			switch {
+			case p.RecordSet.Version == 0 && p.RecordSet.Version0:
+				max = 1
+			case p.RecordSet.Version == 1 && max > 2:
+				max = 2
 			}
 		}
 	}
+
+	return max
 }
 
 func (r *Request) HasResponse() bool {
@@ -103,7 +103,27 @@ const (
 	DescribeClientQuotas        ApiKey = 48
 	AlterClientQuotas           ApiKey = 49
 
-	numApis = 50
+	DescribeUserScramCredentials ApiKey = 50
+	AlterUserScramCredentials    ApiKey = 51
+	Vote                         ApiKey = 52
+	BeginQuorumEpoch             ApiKey = 53
+	EndQuorumEpoch               ApiKey = 54
+	DescribeQuorum               ApiKey = 55
+	AlterPartition               ApiKey = 56
+	UpdateFeatures               ApiKey = 57
+	Envelope                     ApiKey = 58
+	FetchSnapshot                ApiKey = 59
+	DescribeCluster              ApiKey = 60
+	DescribeProducers            ApiKey = 61
+	BrokerRegistration           ApiKey = 62
+	BrokerHeartbeat              ApiKey = 63
+	UnregisterBroker             ApiKey = 64
+	DescribeTransactions         ApiKey = 65
+	ListTransactions             ApiKey = 66
+	AllocateProducerIds          ApiKey = 67
+	ConsumerGroupHeartbeat       ApiKey = 68
+
+	numApis = 69
 )
 
 var apiNames = [numApis]string{
@@ -157,6 +177,26 @@ var apiNames = [numApis]string{
 	OffsetDelete:                "OffsetDelete",
 	DescribeClientQuotas:        "DescribeClientQuotas",
 	AlterClientQuotas:           "AlterClientQuotas",
+
+	DescribeUserScramCredentials: "DescribeUserScramCredentials",
+	AlterUserScramCredentials:    "AlterUserScramCredentials",
+	Vote:                         "Vote",
+	BeginQuorumEpoch:             "BeginQuorumEpoch",
+	EndQuorumEpoch:               "EndQuorumEpoch",
+	DescribeQuorum:               "DescribeQuorum",
+	AlterPartition:               "AlterPartition",
+	UpdateFeatures:               "UpdateFeatures",
+	Envelope:                     "Envelope",
+	FetchSnapshot:                "FetchSnapshot",
+	DescribeCluster:              "DescribeCluster",
+	DescribeProducers:            "DescribeProducers",
+	BrokerRegistration:           "BrokerRegistration",
+	BrokerHeartbeat:              "BrokerHeartbeat",
+	UnregisterBroker:             "UnregisterBroker",
+	DescribeTransactions:         "DescribeTransactions",
+	ListTransactions:             "ListTransactions",
+	AllocateProducerIds:          "AllocateProducerIds",
+	ConsumerGroupHeartbeat:       "ConsumerGroupHeartbeat",
 }
 
 type messageType struct {
@@ -462,6 +502,14 @@ type TransactionalMessage interface {
 	Transaction() string
 }
 
+// ControllerResponse is an extension of the Message interface implemented by
+// the responses of requests routed to the controller of the cluster.
+type ControllerResponse interface {
+	// Returns true if the request was rejected because the broker it was sent
+	// to was not the controller.
+	NotController() bool
+}
+
 // PreparedMessage is an extension of the Message interface implemented by some
 // request types which may need to run some pre-processing on their state before
 // being sent.
@@ -471,6 +519,16 @@ type PreparedMessage interface {
 	Prepare(apiVersion int16)
 }
 
+// LimitedMessage is an extension of the Message interface implemented by some
+// request types which cannot be sent with all the versions of their API, for
+// example because of the format of the data they carry.
+type LimitedMessage interface {
+	// Returns the highest version of the API that the message can be sent
+	// with. When the broker supports a higher version, the message is sent
+	// with the version returned by this method.
+	MaxApiVersion() int16
+}
+
 // Splitter is an interface implemented by messages that can be split into
 // multiple requests and have their results merged back by a Merger.
 type Splitter interface {
@@ -149,6 +149,75 @@ func TestEncodeDecodeFlexibleType(t *testing.T) {
 	}
 }
 
+func TestDecodeFlexibleTypeUnknownTaggedFields(t *testing.T) {
+	b := []byte{
+		// size of "value1" + 1
+		7,
+		// "value1"
+		118, 97, 108, 117, 101, 49,
+		// 15 as 16-bit int
+		0, 15,
+		// size of []byte("hello") + 1
+		6,
+		// []byte("hello")
+		104, 101, 108, 108, 111,
+		// size of []SubTypes + 1
+		2,
+		// 2 as 8-bit int
+		2,
+		// tag buffer for the SubType struct with one unknown tagged field
+		1, 7, 2, 0xAB, 0xCD,
+		// number of tagged fields
+		3,
+		// unknown tagged field
+		5, 3, 1, 2, 3,
+		// id of first tagged field
+		0,
+		// size of first tagged field, larger than the 8-bit int
+		2,
+		// 34 as 8-bit int, followed by an unexpected byte
+		34, 0xFF,
+		// id of second tagged field
+		1,
+		// size of second tagged field
+		13,
+		// size of "taggedValue2" + 1
+		13,
+		// "taggedValue2"
+		116, 97, 103, 103, 101, 100, 86, 97, 108, 117, 101, 50,
+	}
+
+	types := makeTypes(reflect.TypeOf(&testType{}).Elem())
+	ft := types[4]
+
+	d := &decoder{reader: bytes.NewBuffer(b), remain: len(b)}
+	f := &testType{}
+	ft.decode(d, valueOf(f))
+	if d.err != nil {
+		t.Fatal("Error during decoding:", d.err)
+	}
+	if d.remain != 0 {
+		t.Error("Unexpected bytes left after decoding:", d.remain)
+	}
+
+	exp := &testType{
+		Field1:       "value1",
+		Field2:       15,
+		Field3:       []byte("hello"),
+		SubTypes:     []testSubType{{SubField1: 2}},
+		TaggedField1: 34,
+		TaggedField2: "taggedValue2",
+	}
+
+	if !reflect.DeepEqual(exp, f) {
+		t.Error(
+			"Decoded value does not equal the expected one",
+			"expected", *exp,
+			"got", *f,
+		)
+	}
+}
+
 func TestVarInts(t *testing.T) {
 	type tc struct {
 		input      int64
@@ -47,6 +47,8 @@ func deepEqualValue(v1, v2 reflect.Value) bool {
 		return v1.Bool() == v2.Bool()
 	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return v1.Int() == v2.Int()
+	case reflect.Uint8:
+		return v1.Uint() == v2.Uint()
 	case reflect.String:
 		return v1.String() == v2.String()
 	case reflect.Struct:
@@ -55,6 +57,8 @@ func deepEqualValue(v1, v2 reflect.Value) bool {
 		return deepEqualPtr(v1, v2)
 	case reflect.Slice:
 		return deepEqualSlice(v1, v2)
+	case reflect.Array:
+		return deepEqualArray(v1, v2)
 	default:
 		panic("comparing values of unsupported type: " + v1.Type().String())
 	}
@@ -116,6 +120,15 @@ func deepEqualSlice(v1, v2 reflect.Value) bool {
 	return true
 }
 
+func deepEqualArray(v1, v2 reflect.Value) bool {
+	for i, n := 0, v1.Len(); i < n; i++ {
+		if !deepEqual(v1.Index(i).Interface(), v2.Index(i).Interface()) {
+			return false
+		}
+	}
+	return true
+}
+
 func deepEqualBytes(s1, s2 protocol.Bytes) bool {
 	if s1 == nil {
 		return s2 == nil
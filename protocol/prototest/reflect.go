@@ -16,7 +16,10 @@ var (
 func closeMessage(m protocol.Message) {
 	forEachField(reflect.ValueOf(m), func(v reflect.Value) {
 		if v.Type().Implements(recordReader) {
-			rr := v.Interface().(protocol.RecordReader)
+			rr, _ := v.Interface().(protocol.RecordReader)
+			if rr == nil {
+				return
+			}
 			for {
 				r, err := rr.ReadRecord()
 				if err != nil {
@@ -18,6 +18,7 @@ const (
 	Snappy        Attributes = Attributes(compress.Snappy) // 2
 	Lz4           Attributes = Attributes(compress.Lz4)    // 3
 	Zstd          Attributes = Attributes(compress.Zstd)   // 4
+	LogAppendTime Attributes = 1 << 3
 	Transactional Attributes = 1 << 4
 	Control       Attributes = 1 << 5
 )
@@ -26,6 +27,12 @@ func (a Attributes) Compression() compress.Compression {
 	return compress.Compression(a & 7)
 }
 
+// LogAppendTime returns true if the timestamps of the records are the times at
+// which the broker appended them to the log, rather than their creation times.
+func (a Attributes) LogAppendTime() bool {
+	return (a & LogAppendTime) != 0
+}
+
 func (a Attributes) Transactional() bool {
 	return (a & Transactional) != 0
 }
@@ -36,6 +43,9 @@ func (a Attributes) Control() bool {
 
 func (a Attributes) String() string {
 	s := a.Compression().String()
+	if a.LogAppendTime() {
+		s += "+logappendtime"
+	}
 	if a.Transactional() {
 		s += "+transactional"
 	}
@@ -85,15 +95,22 @@ type Record struct {
 // responses. All v0, v1, and v2 formats are supported.
 type RecordSet struct {
 	// The message version that this record set will be represented as, valid
-	// values are 1, or 2.
+	// values are 0, 1, or 2.
 	//
 	// When reading, this is the value of the highest version used in the
 	// batches that compose the record set.
 	//
 	// When writing, this value dictates the format that the records will be
-	// encoded in.
+	// encoded in. Zero defaults to version 1, unless Version0 is set.
 	Version int8
 
+	// Version0 must be set to write the records in version 0 of the message
+	// format, the format of kafka 0.9 and below, which has no timestamps. It
+	// is only used when Version is zero.
+	//
+	// When reading, it is set if all the batches were in version 0.
+	Version0 bool
+
 	// Attributes set on the record set.
 	//
 	// When reading, the attributes are the combination of all attributes in
@@ -110,6 +127,25 @@ type RecordSet struct {
 	// that compose the stream, it may use type assertions to access the
 	// underlying types of each batch.
 	Records RecordReader
+
+	// The offset of the first record of the set, which brokers set when they
+	// write records in fetch responses. Producers leave it zero since the
+	// offsets of the records they produce are assigned by the broker.
+	//
+	// This field is only used when writing, the offsets of the records read
+	// are set on each record.
+	BaseOffset int64
+}
+
+// RecordSetSizeObserver is an interface that may be implemented by the
+// RecordReader of a RecordSet to be notified of the size of the record set once
+// it has been encoded.
+//
+// The uncompressed size is the size that the record set would have had if no
+// compression was applied, the compressed size is the number of bytes actually
+// written. Both values are equal when the record set is not compressed.
+type RecordSetSizeObserver interface {
+	ObserveRecordSetSize(uncompressed, compressed int64)
 }
 
 // bufferedReader is an interface implemented by types like bufio.Reader, which
@@ -165,11 +201,12 @@ func (rs *RecordSet) ReadFrom(r io.Reader) (int64, error) {
 	for d.remain > 0 && err == nil {
 		var version byte
 
+		// Kafka truncates the last batch of fetch responses which reach the
+		// MaxBytes limit, the bytes left may not even hold the header of
+		// the batch. The truncated batch is dropped, the program fetches it
+		// again from the offset following the last record that it read.
 		if d.remain < (magicByteOffset + 1) {
-			if len(stream.Records) != 0 {
-				break
-			}
-			return 4, fmt.Errorf("impossible record set shorter than %d bytes", magicByteOffset+1)
+			break
 		}
 
 		switch r := d.reader.(type) {
@@ -211,6 +248,7 @@ func (rs *RecordSet) ReadFrom(r io.Reader) (int64, error) {
 		if tmp.Version > rs.Version {
 			rs.Version = tmp.Version
 		}
+		rs.Version0 = rs.Version == 0 && (tmp.Version0 || rs.Version0)
 
 		rs.Attributes |= tmp.Attributes
 
@@ -237,9 +275,8 @@ func (rs *RecordSet) ReadFrom(r io.Reader) (int64, error) {
 //
 // The error will be ErrNoRecord if rs contained no records.
 //
-// Note: since this package is only compatible with kafka 0.10 and above, the
-// method never produces messages in version 0. If rs.Version is zero, the
-// method defaults to producing messages in version 1.
+// If rs.Version is zero, the method defaults to producing messages in version 1,
+// or in version 0 if rs.Version0 is set.
 func (rs *RecordSet) WriteTo(w io.Writer) (int64, error) {
 	if rs.Records == nil {
 		return 0, ErrNoRecord
@@ -261,12 +298,19 @@ func (rs *RecordSet) WriteTo(w io.Writer) (int64, error) {
 	size := packUint32(0)
 	buffer.Write(size[:]) // size placeholder
 
+	var uncompressed int64
 	var err error
 	switch rs.Version {
-	case 0, 1:
-		err = rs.writeToVersion1(buffer, bufferOffset+4)
+	case 0:
+		magic := int8(1)
+		if rs.Version0 {
+			magic = 0
+		}
+		uncompressed, err = rs.writeToVersion1(buffer, bufferOffset+4, magic)
+	case 1:
+		uncompressed, err = rs.writeToVersion1(buffer, bufferOffset+4, 1)
 	case 2:
-		err = rs.writeToVersion2(buffer, bufferOffset+4)
+		uncompressed, err = rs.writeToVersion2(buffer, bufferOffset+4)
 	default:
 		err = fmt.Errorf("unsupported record set version %d", rs.Version)
 	}
@@ -282,6 +326,10 @@ func (rs *RecordSet) WriteTo(w io.Writer) (int64, error) {
 	}
 	buffer.WriteAt(size[:], bufferOffset)
 
+	if observer, ok := rs.Records.(RecordSetSizeObserver); ok && n != 0 {
+		observer.ObserveRecordSetSize(4+uncompressed, n)
+	}
+
 	// This condition indicates that the output writer received by `WriteTo` was
 	// not a *pageBuffer, in which case we need to flush the buffered records
 	// data into it.
@@ -1,11 +1,15 @@
 package protocol
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"io"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/segmentio/kafka-go/compress"
 )
 
 type memoryRecord struct {
@@ -97,6 +101,147 @@ func TestMultiRecordReader(t *testing.T) {
 	assertRecords(t, r1, r2)
 }
 
+type sizeObserverRecordReader struct {
+	RecordReader
+	uncompressed int64
+	compressed   int64
+}
+
+func (r *sizeObserverRecordReader) ObserveRecordSetSize(uncompressed, compressed int64) {
+	r.uncompressed, r.compressed = uncompressed, compressed
+}
+
+func TestRecordSetSizeObserver(t *testing.T) {
+	value := bytes.Repeat([]byte("0123456789"), 100)
+
+	for _, version := range []int8{1, 2} {
+		for _, compression := range []compress.Compression{0, compress.Gzip} {
+			records := make([]Record, 10)
+			for i := range records {
+				records[i] = Record{Value: NewBytes(value)}
+			}
+
+			r := &sizeObserverRecordReader{RecordReader: NewRecordReader(records...)}
+			rs := &RecordSet{
+				Version:    version,
+				Attributes: Attributes(compression),
+				Records:    r,
+			}
+
+			b := new(bytes.Buffer)
+			n, err := rs.WriteTo(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.compressed != n {
+				t.Errorf("v%d %s: compressed size mismatch: want=%d got=%d", version, compression, n, r.compressed)
+			}
+
+			if compression == 0 {
+				if r.uncompressed != n {
+					t.Errorf("v%d: uncompressed size mismatch: want=%d got=%d", version, n, r.uncompressed)
+				}
+			} else if r.uncompressed <= r.compressed {
+				t.Errorf("v%d %s: uncompressed size should be larger than compressed size: uncompressed=%d compressed=%d", version, compression, r.uncompressed, r.compressed)
+			}
+		}
+	}
+}
+
+func TestRecordSetBaseOffset(t *testing.T) {
+	for _, version := range []int8{1, 2} {
+		for _, compression := range []compress.Compression{0, compress.Gzip} {
+			// The offsets of the records are not written, only the base offset
+			// of the set is, which producers leave zero.
+			for _, baseOffset := range []int64{0, 42} {
+				records := make([]Record, 3)
+				for i := range records {
+					records[i] = Record{Offset: 100 + int64(i), Value: NewBytes([]byte("hello"))}
+				}
+
+				b := new(bytes.Buffer)
+				rs := &RecordSet{
+					Version:    version,
+					Attributes: Attributes(compression),
+					Records:    NewRecordReader(records...),
+					BaseOffset: baseOffset,
+				}
+				if _, err := rs.WriteTo(b); err != nil {
+					t.Fatal(err)
+				}
+
+				found := &RecordSet{}
+				if _, err := found.ReadFrom(b); err != nil {
+					t.Fatal(err)
+				}
+
+				for i := int64(0); ; i++ {
+					r, err := found.Records.ReadRecord()
+					if err != nil {
+						if !errors.Is(err, io.EOF) {
+							t.Fatal(err)
+						}
+						if i != int64(len(records)) {
+							t.Errorf("v%d %s: expected %d records but got %d", version, compression, len(records), i)
+						}
+						break
+					}
+					if r.Offset != baseOffset+i {
+						t.Errorf("v%d %s: record #%d: expected offset %d but got %d", version, compression, i, baseOffset+i, r.Offset)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRecordSetVersion0(t *testing.T) {
+	for _, compression := range []compress.Compression{0, compress.Gzip} {
+		t.Run(compression.String(), func(t *testing.T) {
+			b := new(bytes.Buffer)
+			rs := &RecordSet{
+				Version0:   true,
+				Attributes: Attributes(compression),
+				BaseOffset: 10,
+				Records: NewRecordReader(
+					Record{Time: time.Now(), Value: NewBytes([]byte("hello"))},
+					Record{Time: time.Now(), Value: NewBytes([]byte("world"))},
+				),
+			}
+			if _, err := rs.WriteTo(b); err != nil {
+				t.Fatal(err)
+			}
+
+			// size:4 offset:8 message_size:4 crc:4 magic:1
+			if magic := b.Bytes()[20]; magic != 0 {
+				t.Fatalf("expected the message to be in version 0 but got %d", magic)
+			}
+
+			found := &RecordSet{}
+			if _, err := found.ReadFrom(b); err != nil {
+				t.Fatal(err)
+			}
+			if found.Version != 0 || !found.Version0 {
+				t.Errorf("expected the record set to be read in version 0 but got %d (%t)", found.Version, found.Version0)
+			}
+
+			for i, want := range []string{"hello", "world"} {
+				r, err := found.Records.ReadRecord()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r.Offset != 10+int64(i) || timestamp(r.Time) != 0 {
+					t.Errorf("record #%d: expected offset %d without timestamp but got offset %d at %s", i, 10+i, r.Offset, r.Time)
+				}
+				if v, _ := ReadAll(r.Value); string(v) != want {
+					t.Errorf("record #%d: expected value %q but got %q", i, want, v)
+				}
+			}
+		})
+	}
+}
+
 func TestControlRecord(t *testing.T) {
 	now := time.Now()
 
@@ -198,3 +343,112 @@ func readAll(bytes Bytes) []byte {
 	}
 	return b
 }
+
+func TestRecordSetTruncatedBatch(t *testing.T) {
+	// Kafka truncates the last batch of fetch responses which reach the
+	// MaxBytes limit, encode two batches and cut the last one at every byte to
+	// simulate the responses returned for all the possible values of MaxBytes.
+	encode := func(version int8, attributes Attributes, offset int64) []byte {
+		b := new(bytes.Buffer)
+		rs := &RecordSet{
+			Version:    version,
+			Attributes: attributes,
+			Records: NewRecordReader(
+				Record{Key: NewBytes([]byte("k")), Value: NewBytes([]byte("v"))},
+				Record{Key: NewBytes([]byte("k")), Value: NewBytes([]byte("v"))},
+			),
+			BaseOffset: offset,
+		}
+		if _, err := rs.WriteTo(b); err != nil {
+			t.Fatal(err)
+		}
+		return b.Bytes()[4:] // strip the size of the record set
+	}
+
+	recordSet := func(batches ...[]byte) *bytes.Reader {
+		b := make([]byte, 4)
+		for _, batch := range batches {
+			b = append(b, batch...)
+		}
+		binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+		return bytes.NewReader(b)
+	}
+
+	readOffsets := func(rs *RecordSet) []int64 {
+		var offsets []int64
+		if rs.Records == nil {
+			return offsets
+		}
+		for {
+			r, err := rs.Records.ReadRecord()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Fatal(err)
+				}
+				return offsets
+			}
+			offsets = append(offsets, r.Offset)
+		}
+	}
+
+	// Uncompressed v1 batches are sequences of independent messages, those
+	// which were not truncated are still returned. Other batches are dropped
+	// entirely when they are truncated.
+	var partial bool
+
+	isTruncatedPrefix := func(offsets []int64, base int64, count int) bool {
+		if len(offsets) >= count || (!partial && len(offsets) != count-2) {
+			return false
+		}
+		for i, offset := range offsets {
+			if offset != base+int64(i) {
+				return false
+			}
+		}
+		return true
+	}
+
+	tests := []struct {
+		scenario   string
+		version    int8
+		attributes Attributes
+	}{
+		{scenario: "v1", version: 1},
+		{scenario: "v1 gzip", version: 1, attributes: Attributes(compress.Gzip)},
+		{scenario: "v2", version: 2},
+		{scenario: "v2 gzip", version: 2, attributes: Attributes(compress.Gzip)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			partial = test.version == 1 && test.attributes == 0
+			first := encode(test.version, test.attributes, 0)
+			last := encode(test.version, test.attributes, 2)
+
+			for maxBytes := len(first); maxBytes < len(first)+len(last); maxBytes++ {
+				truncated := last[:maxBytes-len(first)]
+
+				rs := &RecordSet{}
+				if _, err := rs.ReadFrom(recordSet(first, truncated)); err != nil {
+					t.Fatalf("truncated at %d bytes: %v", maxBytes, err)
+				}
+				if offsets := readOffsets(rs); !isTruncatedPrefix(offsets, 0, 4) || len(offsets) < 2 {
+					t.Errorf("truncated at %d bytes: expected the offsets of the first batch but got %v", maxBytes, offsets)
+				}
+
+				// When the first batch is larger than MaxBytes the record set
+				// only holds the truncated batch, no records are returned.
+				if len(truncated) == 0 {
+					continue
+				}
+				rs = &RecordSet{}
+				if _, err := rs.ReadFrom(recordSet(truncated)); err != nil {
+					t.Fatalf("only batch truncated at %d bytes: %v", len(truncated), err)
+				}
+				if offsets := readOffsets(rs); !isTruncatedPrefix(offsets, 2, 2) {
+					t.Errorf("only batch truncated at %d bytes: expected no records of the truncated batch but got %v", len(truncated), offsets)
+				}
+			}
+		})
+	}
+}
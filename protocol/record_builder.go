@@ -0,0 +1,108 @@
+package protocol
+
+import (
+	"encoding/binary"
+
+	"github.com/segmentio/kafka-go/compress"
+)
+
+// RecordBatchBuilder encodes records into a record batch in the v2 format,
+// which is the format used by kafka 0.11 and above to store records and to
+// exchange them in produce and fetch requests.
+//
+// The encoded batches carry the length, CRC, attributes, offset deltas and
+// timestamps that brokers expect, which lets programs construct batches
+// outside of the produce path, for example to convert or replicate records
+// between clusters, or to craft fetch responses in tests.
+//
+// The zero value is a valid builder producing uncompressed batches.
+//
+// RecordBatchBuilder values are not safe to use concurrently from multiple
+// goroutines.
+type RecordBatchBuilder struct {
+	// Compression codec applied to the records of the batch, zero for no
+	// compression.
+	Compression compress.Compression
+
+	// Attributes set on the batch, like Transactional or Control. The
+	// compression bits are ignored, they are set from Compression.
+	Attributes Attributes
+
+	records        []Record
+	leaderEpoch    int32
+	hasLeaderEpoch bool
+}
+
+// Add appends records to the batch being built.
+//
+// The offset of the first record is used as base offset of the batch, the
+// offsets of the following records are encoded as deltas from it. Records with
+// a zero time are assigned the time at which the batch is built.
+func (b *RecordBatchBuilder) Add(records ...Record) {
+	b.records = append(b.records, records...)
+}
+
+// Len returns the number of records added to the batch.
+func (b *RecordBatchBuilder) Len() int {
+	return len(b.records)
+}
+
+// Reset discards the records added to the batch.
+func (b *RecordBatchBuilder) Reset() {
+	for i := range b.records {
+		b.records[i] = Record{}
+	}
+	b.records = b.records[:0]
+}
+
+// SetPartitionLeaderEpoch sets the partition leader epoch written in the
+// header of the batches. Brokers assign the epoch when appending batches to
+// their log, producers leave it to -1, which is the default. Programs mirroring
+// records between clusters may use it to preserve the epoch of the batches that
+// they read.
+//
+// Unlike the records, the epoch is not reset after a batch was built.
+func (b *RecordBatchBuilder) SetPartitionLeaderEpoch(epoch int32) {
+	b.leaderEpoch, b.hasLeaderEpoch = epoch, true
+}
+
+// Build returns the encoded record batch, starting with the base offset of the
+// batch. Unlike the record sets of produce requests, the bytes are not prefixed
+// with the size of the batch.
+//
+// The key and value of each record are consumed and closed by the method, the
+// builder is reset after the batch was built. The method returns ErrNoRecord if
+// no records were added.
+func (b *RecordBatchBuilder) Build() ([]byte, error) {
+	defer b.Reset()
+
+	if len(b.records) == 0 {
+		return nil, ErrNoRecord
+	}
+
+	rs := &RecordSet{
+		Version:    2,
+		Attributes: (b.Attributes &^ 7) | Attributes(b.Compression),
+		Records:    NewRecordReader(b.records...),
+		BaseOffset: b.records[0].Offset,
+	}
+
+	buffer := newPageBuffer()
+	defer buffer.unref()
+
+	if _, err := rs.writeToVersion2(buffer, 0); err != nil {
+		return nil, err
+	}
+
+	batch := make([]byte, buffer.Size())
+	if _, err := buffer.ReadAt(batch, 0); err != nil {
+		return nil, err
+	}
+
+	// The partition leader epoch follows the base offset and the length of the
+	// batch, it is not covered by the CRC.
+	if b.hasLeaderEpoch {
+		binary.BigEndian.PutUint32(batch[12:16], uint32(b.leaderEpoch))
+	}
+	return batch, nil
+}
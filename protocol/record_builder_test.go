@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/compress"
+)
+
+func TestRecordBatchBuilder(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+
+	records := []memoryRecord{
+		{offset: 10, time: now, key: []byte("key-1"), value: []byte("value-1")},
+		{offset: 11, time: now.Add(time.Millisecond), value: []byte("value-2"), headers: []Header{{Key: "h", Value: []byte("v")}}},
+		{offset: 12, time: now.Add(2 * time.Millisecond), key: []byte("key-3")},
+	}
+
+	for _, compression := range []compress.Compression{0, compress.Gzip, compress.Zstd} {
+		b := &RecordBatchBuilder{Compression: compression, Attributes: Transactional}
+		b.Add(makeRecords(records)...)
+
+		if n := b.Len(); n != len(records) {
+			t.Fatalf("%s: expected %d records in the builder but got %d", compression, len(records), n)
+		}
+
+		batch, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := b.Len(); n != 0 {
+			t.Errorf("%s: expected the builder to be reset after building the batch, it has %d records", compression, n)
+		}
+
+		if length := int(binary.BigEndian.Uint32(batch[8:12])); length != len(batch)-12 {
+			t.Errorf("%s: batch length is %d but the batch has %d bytes after the length", compression, length, len(batch)-12)
+		}
+		checksum := crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli))
+		if crc := binary.BigEndian.Uint32(batch[17:21]); crc != checksum {
+			t.Errorf("%s: batch checksum is %08x but the records hash to %08x", compression, crc, checksum)
+		}
+
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(batch)))
+
+		found := &RecordSet{}
+		if _, err := found.ReadFrom(bytes.NewReader(append(size, batch...))); err != nil {
+			t.Fatal(err)
+		}
+		if found.Version != 2 {
+			t.Errorf("%s: expected a v2 record batch but got v%d", compression, found.Version)
+		}
+		if want := Transactional | Attributes(compression); found.Attributes != want {
+			t.Errorf("%s: expected attributes %s but got %s", compression, want, found.Attributes)
+		}
+		assertRecords(t, found.Records, NewRecordReader(makeRecords(records)...))
+	}
+}
+
+func TestRecordBatchBuilderEmpty(t *testing.T) {
+	b := new(RecordBatchBuilder)
+	if _, err := b.Build(); !errors.Is(err, ErrNoRecord) {
+		t.Errorf("expected ErrNoRecord building an empty batch but got %v", err)
+	}
+}
+
+func TestRecordBatchBuilderPartitionLeaderEpoch(t *testing.T) {
+	b := new(RecordBatchBuilder)
+
+	for _, epoch := range []int32{-1, 0, 42} {
+		if epoch >= 0 {
+			b.SetPartitionLeaderEpoch(epoch)
+		}
+		b.Add(Record{Value: NewBytes([]byte("value"))})
+
+		batch, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := int32(binary.BigEndian.Uint32(batch[12:16])); found != epoch {
+			t.Errorf("expected partition leader epoch %d but got %d", epoch, found)
+		}
+		checksum := crc32.Checksum(batch[21:], crc32.MakeTable(crc32.Castagnoli))
+		if crc := binary.BigEndian.Uint32(batch[17:21]); crc != checksum {
+			t.Errorf("batch checksum is %08x but the records hash to %08x", crc, checksum)
+		}
+	}
+}
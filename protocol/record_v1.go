@@ -8,7 +8,11 @@ import (
 	"time"
 )
 
-func readMessage(b *pageBuffer, d *decoder) (attributes int8, baseOffset, timestamp int64, key, value Bytes, err error) {
+// errTruncatedMessage is returned by readMessage when the message extends past
+// the end of the record set.
+var errTruncatedMessage = errors.New("message truncated at the end of the record set")
+
+func readMessage(b *pageBuffer, d *decoder) (magicByte, attributes int8, baseOffset, timestamp int64, key, value Bytes, err error) {
 	md := decoder{
 		reader: d,
 		remain: 12,
@@ -17,9 +21,17 @@ func readMessage(b *pageBuffer, d *decoder) (attributes int8, baseOffset, timest
 	baseOffset = md.readInt64()
 	md.remain = int(md.readInt32())
 
+	// The last message of a fetch response reaching the MaxBytes limit may
+	// be truncated, its checksum cannot be verified.
+	if md.err == nil && md.remain > d.remain {
+		d.discardAll()
+		err = errTruncatedMessage
+		return
+	}
+
 	crc := uint32(md.readInt32())
 	md.setCRC(crc32.IEEETable)
-	magicByte := md.readInt8()
+	magicByte = md.readInt8()
 	attributes = md.readInt8()
 	timestamp = int64(0)
 
@@ -58,8 +70,11 @@ func (rs *RecordSet) readFromVersion1(d *decoder) error {
 	b := newPageBuffer()
 	defer b.unref()
 
-	attributes, baseOffset, timestamp, key, value, err := readMessage(b, d)
+	magicByte, attributes, baseOffset, timestamp, key, value, err := readMessage(b, d)
 	if err != nil {
+		if errors.Is(err, errTruncatedMessage) {
+			return nil
+		}
 		return err
 	}
 
@@ -102,7 +117,7 @@ func (rs *RecordSet) readFromVersion1(d *decoder) error {
 			}
 
 			for !d.done() {
-				_, offset, timestamp, key, value, err := readMessage(b, d)
+				_, _, offset, timestamp, key, value, err := readMessage(b, d)
 				if err != nil {
 					if errors.Is(err, io.ErrUnexpectedEOF) {
 						break
@@ -121,14 +136,15 @@ func (rs *RecordSet) readFromVersion1(d *decoder) error {
 				})
 			}
 
-			if baseOffset != 0 {
+			if magicByte != 0 && baseOffset != 0 {
 				// https://kafka.apache.org/documentation/#messageset
 				//
 				// In version 1, to avoid server side re-compression, only the
 				// wrapper message will be assigned an offset. The inner messages
 				// will have relative offsets. The absolute offset can be computed
 				// using the offset from the outer message, which corresponds to the
-				// offset assigned to the last inner message.
+				// offset assigned to the last inner message. In version 0, the
+				// inner messages have absolute offsets.
 				lastRelativeOffset := int64(len(r.records)) - 1
 
 				for i := range r.records {
@@ -141,7 +157,8 @@ func (rs *RecordSet) readFromVersion1(d *decoder) error {
 	}
 
 	*rs = RecordSet{
-		Version:    1,
+		Version:    magicByte,
+		Version0:   magicByte == 0,
 		Attributes: Attributes(attributes),
 		Records:    records,
 	}
@@ -149,67 +166,105 @@ func (rs *RecordSet) readFromVersion1(d *decoder) error {
 	return nil
 }
 
-func (rs *RecordSet) writeToVersion1(buffer *pageBuffer, bufferOffset int64) error {
+// writeToVersion1 writes the records in version 0 or 1 of the message format,
+// depending on magic, since both versions share the same structure.
+func (rs *RecordSet) writeToVersion1(buffer *pageBuffer, bufferOffset int64, magic int8) (int64, error) {
 	attributes := rs.Attributes
 	records := rs.Records
+	baseOffset := rs.BaseOffset
+	uncompressed := int64(-1)
 
 	if compression := attributes.Compression(); compression != 0 {
 		if codec := compression.Codec(); codec != nil {
 			// In the message format version 1, compression is achieved by
 			// compressing the value of a message which recursively contains
 			// the representation of the compressed message set.
-			subset := *rs
-			subset.Attributes &= ^7 // erase compression
-
-			if err := subset.writeToVersion1(buffer, bufferOffset); err != nil {
-				return err
+			//
+			// In version 1, the inner messages have relative offsets, the
+			// wrapper message carries the offset of the last inner message
+			// and their max timestamp. In version 0, the inner messages
+			// have absolute offsets.
+			innerOffset := int64(0)
+			if magic == 0 {
+				innerOffset = baseOffset
+			}
+			count, maxTimestamp, err := writeMessagesVersion1(buffer, records, attributes&^7, innerOffset, magic)
+			if err != nil {
+				return 0, err
 			}
 
+			uncompressed = buffer.Size() - bufferOffset
+
 			compressed := newPageBuffer()
 			defer compressed.unref()
 
 			compressor := codec.NewWriter(compressed)
 			defer compressor.Close()
 
-			var err error
 			buffer.pages.scan(bufferOffset, buffer.Size(), func(b []byte) bool {
 				_, err = compressor.Write(b)
 				return err == nil
 			})
 			if err != nil {
-				return err
+				return 0, err
 			}
 			if err := compressor.Close(); err != nil {
-				return err
+				return 0, err
 			}
 
 			buffer.Truncate(int(bufferOffset))
 
+			if count > 0 {
+				baseOffset += int64(count) - 1
+			}
+
 			records = &message{
 				Record: Record{
+					Time:  makeTime(maxTimestamp),
 					Value: compressed,
 				},
 			}
 		}
 	}
 
+	if _, _, err := writeMessagesVersion1(buffer, records, attributes, baseOffset, magic); err != nil {
+		return 0, err
+	}
+
+	if uncompressed < 0 {
+		uncompressed = buffer.Size() - bufferOffset
+	}
+	return uncompressed, nil
+}
+
+// writeMessagesVersion1 writes records to buffer as a sequence of messages in
+// version 0 or 1, with offsets starting at baseOffset. It returns the number of
+// messages written and the max timestamp of the messages. Messages in version 0
+// have no timestamps.
+func writeMessagesVersion1(buffer *pageBuffer, records RecordReader, attributes Attributes, baseOffset int64, magic int8) (count int, maxTimestamp int64, err error) {
 	e := encoder{writer: buffer}
 	currentTimestamp := timestamp(time.Now())
 
-	return forEachRecord(records, func(i int, r *Record) error {
+	err = forEachRecord(records, func(i int, r *Record) error {
 		t := timestamp(r.Time)
 		if t == 0 {
 			t = currentTimestamp
 		}
+		if t > maxTimestamp {
+			maxTimestamp = t
+		}
+		count++
 
 		messageOffset := buffer.Size()
-		e.writeInt64(int64(i))
+		e.writeInt64(baseOffset + int64(i))
 		e.writeInt32(0) // message size placeholder
 		e.writeInt32(0) // crc32 placeholder
 		e.setCRC(crc32.IEEETable)
-		e.writeInt8(1) // magic byte: version 1
+		e.writeInt8(magic)
 		e.writeInt8(int8(attributes))
-		e.writeInt64(t)
+		if magic != 0 {
+			e.writeInt64(t)
+		}
 
 		if err := e.writeNullBytesFrom(r.Key); err != nil {
 			return err
@@ -227,6 +282,7 @@ func (rs *RecordSet) writeToVersion1(buffer *pageBuffer, bufferOffset int64) err
 		e.setCRC(nil)
 		return nil
 	})
+	return
 }
 
 type message struct {
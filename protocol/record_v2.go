@@ -188,12 +188,12 @@ func (rs *RecordSet) readFromVersion2(d *decoder) error {
 	return nil
 }
 
-func (rs *RecordSet) writeToVersion2(buffer *pageBuffer, bufferOffset int64) error {
+func (rs *RecordSet) writeToVersion2(buffer *pageBuffer, bufferOffset int64) (int64, error) {
 	records := rs.Records
 	numRecords := int32(0)
 
 	e := &encoder{writer: buffer}
-	e.writeInt64(0)                    // base offset                         |  0 +8
+	e.writeInt64(rs.BaseOffset)        // base offset                         |  0 +8
 	e.writeInt32(0)                    // placeholder for record batch length |  8 +4
 	e.writeInt32(-1)                   // partition leader epoch              | 12 +3
 	e.writeInt8(2)                     // magic byte                          | 16 +1
@@ -207,11 +207,15 @@ func (rs *RecordSet) writeToVersion2(buffer *pageBuffer, bufferOffset int64) err
 	e.writeInt32(-1)                   // base sequence                       | 53 +4
 	e.writeInt32(0)                    // placeholder for numRecords          | 57 +4
 
+	headerSize := buffer.Size() - bufferOffset
+
 	var compressor io.WriteCloser
+	var counter *writeCounter
 	if compression := rs.Attributes.Compression(); compression != 0 {
 		if codec := compression.Codec(); codec != nil {
 			compressor = codec.NewWriter(buffer)
-			e.writer = compressor
+			counter = &writeCounter{writer: compressor}
+			e.writer = counter
 		}
 	}
 
@@ -272,17 +276,17 @@ func (rs *RecordSet) writeToVersion2(buffer *pageBuffer, bufferOffset int64) err
 	})
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if compressor != nil {
 		if err := compressor.Close(); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	if numRecords == 0 {
-		return ErrNoRecord
+		return 0, ErrNoRecord
 	}
 
 	b2 := packUint32(uint32(lastOffsetDelta))
@@ -311,5 +315,23 @@ func (rs *RecordSet) writeToVersion2(buffer *pageBuffer, bufferOffset int64) err
 
 	buffer.WriteAt(b0[:], bufferOffset+8)
 	buffer.WriteAt(b1[:], bufferOffset+17)
-	return nil
+
+	uncompressed := totalLength
+	if counter != nil {
+		uncompressed = headerSize + counter.size
+	}
+	return uncompressed, nil
+}
+
+// writeCounter is an io.Writer which counts the bytes written to an underlying
+// writer, it is used to measure the size of records before compression.
+type writeCounter struct {
+	writer io.Writer
+	size   int64
+}
+
+func (w *writeCounter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.size += int64(n)
+	return n, err
 }
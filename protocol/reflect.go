@@ -83,6 +83,15 @@ func (v value) fieldByIndex(i index) value {
 	return value{val: v.val.FieldByIndex(i)}
 }
 
+func (v value) isNil() bool { return v.val.IsNil() }
+
+func (v value) elem() value { return value{val: v.val.Elem()} }
+
+func (v value) setPointer(t reflect.Type) value {
+	v.val.Set(reflect.New(t))
+	return v.elem()
+}
+
 type array struct {
 	val reflect.Value
 }
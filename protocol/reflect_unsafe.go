@@ -102,6 +102,16 @@ func (v value) fieldByIndex(i index) value {
 	return value{ptr: unsafe.Pointer(uintptr(v.ptr) + uintptr(i))}
 }
 
+func (v value) isNil() bool { return *(*unsafe.Pointer)(v.ptr) == nil }
+
+func (v value) elem() value { return value{ptr: *(*unsafe.Pointer)(v.ptr)} }
+
+func (v value) setPointer(t reflect.Type) value {
+	p := unsafe.Pointer(reflect.New(t).Pointer())
+	*(*unsafe.Pointer)(v.ptr) = p
+	return value{ptr: p}
+}
+
 type array struct {
 	elem unsafe.Pointer
 	size uintptr
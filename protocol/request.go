@@ -47,15 +47,9 @@ func ReadRequest(r io.Reader) (apiVersion int16, correlationID int32, clientID s
 	req := &t.requests[apiVersion-minVersion]
 
 	if req.flexible {
-		// In the flexible case, there's a tag buffer at the end of the request header
-		taggedCount := int(d.readUnsignedVarInt())
-		for i := 0; i < taggedCount; i++ {
-			d.readUnsignedVarInt() // tagID
-			size := d.readUnsignedVarInt()
-
-			// Just throw away the values for now
-			d.read(int(size))
-		}
+		// In the flexible case, there's a tag buffer at the end of the request header,
+		// none of the tagged fields are used so they are all skipped.
+		d.discardTaggedFields()
 	}
 
 	msg = req.new()
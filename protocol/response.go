@@ -60,16 +60,10 @@ func ReadResponse(r io.Reader, apiKey ApiKey, apiVersion int16) (correlationID i
 
 	res := &t.responses[apiVersion-minVersion]
 
-	if res.flexible {
-		// In the flexible case, there's a tag buffer at the end of the response header
-		taggedCount := int(d.readUnsignedVarInt())
-		for i := 0; i < taggedCount; i++ {
-			d.readUnsignedVarInt() // tagID
-			size := d.readUnsignedVarInt()
-
-			// Just throw away the values for now
-			d.read(int(size))
-		}
+	if res.flexible && hasFlexibleResponseHeader(apiKey) {
+		// In the flexible case, there's a tag buffer at the end of the response header,
+		// none of the tagged fields are used so they are all skipped.
+		d.discardTaggedFields()
 	}
 
 	msg = res.new()
@@ -110,7 +104,7 @@ func WriteResponse(w io.Writer, apiVersion int16, correlationID int32, msg Messa
 	e := &encoder{writer: b}
 	e.writeInt32(0) // placeholder for the response size
 	e.writeInt32(correlationID)
-	if r.flexible {
+	if r.flexible && hasFlexibleResponseHeader(apiKey) {
 		// Flexible messages use extra space for a tag buffer,
 		// which begins with a size value. Since we're not writing any fields into the
 		// latter, we can just write zero for now.
@@ -132,6 +126,14 @@ func WriteResponse(w io.Writer, apiVersion int16, correlationID int32, msg Messa
 	return err
 }
 
+// hasFlexibleResponseHeader returns true if the flexible versions of responses
+// to the API have a tag buffer in their header. ApiVersions responses always use
+// the first version of the response header, so clients can parse them before
+// knowing which versions the broker supports (see KIP-511).
+func hasFlexibleResponseHeader(apiKey ApiKey) bool {
+	return apiKey != ApiVersions
+}
+
 const (
 	tlsAlertByte byte = 0x15
 )
@@ -0,0 +1,47 @@
+package syncgroup
+
+import "github.com/segmentio/kafka-go/protocol"
+
+func init() {
+	protocol.Register(&Request{}, &Response{})
+}
+
+// Detailed API definition: https://kafka.apache.org/protocol#The_Messages_SyncGroup
+type Request struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v4,max=v5,tag"`
+
+	GroupID         string              `kafka:"min=v0,max=v5"`
+	GenerationID    int32               `kafka:"min=v0,max=v5"`
+	MemberID        string              `kafka:"min=v0,max=v5"`
+	GroupInstanceID string              `kafka:"min=v3,max=v5,nullable"`
+	ProtocolType    string              `kafka:"min=v5,max=v5,nullable"`
+	ProtocolName    string              `kafka:"min=v5,max=v5,nullable"`
+	Assignments     []RequestAssignment `kafka:"min=v0,max=v5"`
+}
+
+type RequestAssignment struct {
+	MemberID   string `kafka:"min=v0,max=v5"`
+	Assignment []byte `kafka:"min=v0,max=v5"`
+}
+
+func (r *Request) ApiKey() protocol.ApiKey { return protocol.SyncGroup }
+
+func (r *Request) Group() string { return r.GroupID }
+
+var _ protocol.GroupMessage = (*Request)(nil)
+
+type Response struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v4,max=v5,tag"`
+
+	ThrottleTimeMs int32  `kafka:"min=v1,max=v5"`
+	ErrorCode      int16  `kafka:"min=v0,max=v5"`
+	ProtocolType   string `kafka:"min=v5,max=v5,nullable"`
+	ProtocolName   string `kafka:"min=v5,max=v5,nullable"`
+	Assignment     []byte `kafka:"min=v0,max=v5"`
+}
+
+func (r *Response) ApiKey() protocol.ApiKey { return protocol.SyncGroup }
@@ -0,0 +1,67 @@
+package syncgroup_test
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/prototest"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+)
+
+func TestSyncGroupRequest(t *testing.T) {
+	// Versions 0-2 have all the same fields.
+	for _, version := range []int16{0, 1, 2} {
+		prototest.TestRequest(t, version, &syncgroup.Request{
+			GroupID:      "group-1",
+			GenerationID: 1,
+			MemberID:     "member-1",
+			Assignments: []syncgroup.RequestAssignment{
+				{MemberID: "member-1", Assignment: []byte("assignment-1")},
+				{MemberID: "member-2", Assignment: []byte("assignment-2")},
+			},
+		})
+	}
+
+	// Versions 3-4 have all the same fields.
+	for _, version := range []int16{3, 4} {
+		prototest.TestRequest(t, version, &syncgroup.Request{
+			GroupID:         "group-2",
+			GenerationID:    2,
+			MemberID:        "member-1",
+			GroupInstanceID: "instance-1",
+		})
+	}
+
+	prototest.TestRequest(t, 5, &syncgroup.Request{
+		GroupID:         "group-3",
+		GenerationID:    3,
+		MemberID:        "member-1",
+		GroupInstanceID: "instance-1",
+		ProtocolType:    "consumer",
+		ProtocolName:    "range",
+		Assignments: []syncgroup.RequestAssignment{
+			{MemberID: "member-1", Assignment: []byte("assignment-1")},
+		},
+	})
+}
+
+func TestSyncGroupResponse(t *testing.T) {
+	prototest.TestResponse(t, 0, &syncgroup.Response{
+		ErrorCode:  0,
+		Assignment: []byte("assignment-1"),
+	})
+
+	// Versions 1-4 have all the same fields.
+	for _, version := range []int16{1, 2, 3, 4} {
+		prototest.TestResponse(t, version, &syncgroup.Response{
+			ThrottleTimeMs: 10,
+			ErrorCode:      27,
+		})
+	}
+
+	prototest.TestResponse(t, 5, &syncgroup.Response{
+		ThrottleTimeMs: 10,
+		ProtocolType:   "consumer",
+		ProtocolName:   "range",
+		Assignment:     []byte("assignment-1"),
+	})
+}
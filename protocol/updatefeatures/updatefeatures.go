@@ -0,0 +1,63 @@
+package updatefeatures
+
+import "github.com/segmentio/kafka-go/protocol"
+
+func init() {
+	protocol.Register(&Request{}, &Response{})
+}
+
+// Detailed API definition: https://kafka.apache.org/protocol#The_Messages_UpdateFeatures
+type Request struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v1,tag"`
+
+	TimeoutMs      int32                  `kafka:"min=v0,max=v1"`
+	FeatureUpdates []RequestFeatureUpdate `kafka:"min=v0,max=v1"`
+	ValidateOnly   bool                   `kafka:"min=v1,max=v1"`
+}
+
+type RequestFeatureUpdate struct {
+	Feature         string `kafka:"min=v0,max=v1,compact"`
+	MaxVersionLevel int16  `kafka:"min=v0,max=v1"`
+	AllowDowngrade  bool   `kafka:"min=v0,max=v0"`
+	UpgradeType     int8   `kafka:"min=v1,max=v1"`
+}
+
+// Values of the UpgradeType field of feature updates.
+const (
+	Upgrade         int8 = 1
+	SafeDowngrade   int8 = 2
+	UnsafeDowngrade int8 = 3
+)
+
+func (r *Request) ApiKey() protocol.ApiKey { return protocol.UpdateFeatures }
+
+func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
+	return cluster.ControllerBroker(), nil
+}
+
+type Response struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v0,max=v1,tag"`
+
+	ThrottleTimeMs int32                  `kafka:"min=v0,max=v1"`
+	ErrorCode      int16                  `kafka:"min=v0,max=v1"`
+	ErrorMessage   string                 `kafka:"min=v0,max=v1,compact,nullable"`
+	Results        []ResponseUpdateResult `kafka:"min=v0,max=v1"`
+}
+
+type ResponseUpdateResult struct {
+	Feature      string `kafka:"min=v0,max=v1,compact"`
+	ErrorCode    int16  `kafka:"min=v0,max=v1"`
+	ErrorMessage string `kafka:"min=v0,max=v1,compact,nullable"`
+}
+
+func (r *Response) ApiKey() protocol.ApiKey { return protocol.UpdateFeatures }
+
+// NotController returns true if the request was rejected because the broker it
+// was sent to was not the controller.
+func (r *Response) NotController() bool {
+	return r.ErrorCode == protocol.NotControllerCode
+}
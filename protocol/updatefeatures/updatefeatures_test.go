@@ -0,0 +1,45 @@
+package updatefeatures_test
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/prototest"
+	"github.com/segmentio/kafka-go/protocol/updatefeatures"
+)
+
+const (
+	v0 = 0
+	v1 = 1
+)
+
+func TestUpdateFeaturesRequest(t *testing.T) {
+	prototest.TestRequest(t, v0, &updatefeatures.Request{
+		TimeoutMs: 500,
+		FeatureUpdates: []updatefeatures.RequestFeatureUpdate{
+			{Feature: "metadata.version", MaxVersionLevel: 14},
+			{Feature: "kraft.version", MaxVersionLevel: 0, AllowDowngrade: true},
+		},
+	})
+
+	prototest.TestRequest(t, v1, &updatefeatures.Request{
+		TimeoutMs: 500,
+		FeatureUpdates: []updatefeatures.RequestFeatureUpdate{
+			{Feature: "metadata.version", MaxVersionLevel: 14, UpgradeType: updatefeatures.Upgrade},
+			{Feature: "kraft.version", MaxVersionLevel: 0, UpgradeType: updatefeatures.SafeDowngrade},
+		},
+		ValidateOnly: true,
+	})
+}
+
+func TestUpdateFeaturesResponse(t *testing.T) {
+	for _, version := range []int16{v0, v1} {
+		prototest.TestResponse(t, version, &updatefeatures.Response{
+			ThrottleTimeMs: 500,
+			ErrorCode:      0,
+			Results: []updatefeatures.ResponseUpdateResult{
+				{Feature: "metadata.version"},
+				{Feature: "kraft.version", ErrorCode: 42, ErrorMessage: "invalid downgrade"},
+			},
+		})
+	}
+}
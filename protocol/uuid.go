@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"io"
+)
+
+// UUID is the representation of the uuid type of the kafka protocol, which is
+// used for example to identify topics in recent versions of the APIs.
+type UUID [16]byte
+
+// String returns the canonical representation of the UUID, for example
+// "dc1d5a1b-0b57-4a3c-93c4-1f4e7d2f1a0b".
+func (u UUID) String() string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// IsZero returns true if u is the zero UUID, which kafka uses to represent
+// null or unknown identifiers.
+func (u UUID) IsZero() bool { return u == UUID{} }
+
+func (u *UUID) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.ReadFull(r, u[:])
+	return int64(n), err
+}
+
+func (u *UUID) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(u[:])
+	return int64(n), err
+}
+
+var (
+	_ io.ReaderFrom = (*UUID)(nil)
+	_ io.WriterTo   = (*UUID)(nil)
+)
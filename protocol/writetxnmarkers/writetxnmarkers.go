@@ -0,0 +1,241 @@
+package writetxnmarkers
+
+import "github.com/segmentio/kafka-go/protocol"
+
+func init() {
+	protocol.Register(&Request{}, &Response{})
+}
+
+type Request struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v1,max=v1,tag"`
+
+	Markers []RequestMarker `kafka:"min=v0,max=v1"`
+}
+
+type RequestMarker struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v1,max=v1,tag"`
+
+	ProducerID        int64          `kafka:"min=v0,max=v1"`
+	ProducerEpoch     int16          `kafka:"min=v0,max=v1"`
+	TransactionResult bool           `kafka:"min=v0,max=v1"`
+	Topics            []RequestTopic `kafka:"min=v0,max=v1"`
+	CoordinatorEpoch  int32          `kafka:"min=v0,max=v1"`
+}
+
+type RequestTopic struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v1,max=v1,tag"`
+
+	Name             string  `kafka:"min=v0,max=v0|min=v1,max=v1,compact"`
+	PartitionIndexes []int32 `kafka:"min=v0,max=v1"`
+}
+
+func (r *Request) ApiKey() protocol.ApiKey { return protocol.WriteTxnMarkers }
+
+func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
+	// Expects r to be a request that was returned by Split, will likely panic
+	// or produce the wrong result if that's not the case.
+	topic := r.Markers[0].Topics[0].Name
+	partition := r.Markers[0].Topics[0].PartitionIndexes[0]
+
+	if p, ok := cluster.Topics[topic].Partitions[partition]; ok {
+		return cluster.Brokers[p.Leader], nil
+	}
+
+	return protocol.Broker{ID: -1}, nil
+}
+
+func (r *Request) Split(cluster protocol.Cluster) ([]protocol.Message, protocol.Merger, error) {
+	// Markers must be written by the leaders of the partitions, the request is
+	// split into one message per leader, each containing the subset of markers
+	// and partitions that the broker leads.
+	leaders := make(map[int32]*Request)
+	order := make([]int32, 0, 8)
+
+	leaderOf := func(topic string, partition int32) int32 {
+		if p, ok := cluster.Topics[topic].Partitions[partition]; ok {
+			return p.Leader
+		}
+		return -1
+	}
+
+	for _, m := range r.Markers {
+		for _, t := range m.Topics {
+			for _, p := range t.PartitionIndexes {
+				leader := leaderOf(t.Name, p)
+
+				req := leaders[leader]
+				if req == nil {
+					req = &Request{}
+					leaders[leader] = req
+					order = append(order, leader)
+				}
+
+				req.addPartition(&m, t.Name, p)
+			}
+		}
+	}
+
+	messages := make([]protocol.Message, len(order))
+
+	for i, leader := range order {
+		messages[i] = leaders[leader]
+	}
+
+	return messages, new(Response), nil
+}
+
+func (r *Request) addPartition(marker *RequestMarker, topic string, partition int32) {
+	var m *RequestMarker
+
+	for i := range r.Markers {
+		if sameMarker(&r.Markers[i], marker) {
+			m = &r.Markers[i]
+			break
+		}
+	}
+
+	if m == nil {
+		r.Markers = append(r.Markers, RequestMarker{
+			ProducerID:        marker.ProducerID,
+			ProducerEpoch:     marker.ProducerEpoch,
+			TransactionResult: marker.TransactionResult,
+			CoordinatorEpoch:  marker.CoordinatorEpoch,
+		})
+		m = &r.Markers[len(r.Markers)-1]
+	}
+
+	for i := range m.Topics {
+		if m.Topics[i].Name == topic {
+			m.Topics[i].PartitionIndexes = append(m.Topics[i].PartitionIndexes, partition)
+			return
+		}
+	}
+
+	m.Topics = append(m.Topics, RequestTopic{
+		Name:             topic,
+		PartitionIndexes: []int32{partition},
+	})
+}
+
+func sameMarker(a, b *RequestMarker) bool {
+	return a.ProducerID == b.ProducerID &&
+		a.ProducerEpoch == b.ProducerEpoch &&
+		a.TransactionResult == b.TransactionResult &&
+		a.CoordinatorEpoch == b.CoordinatorEpoch
+}
+
+type Response struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v1,max=v1,tag"`
+
+	Markers []ResponseMarker `kafka:"min=v0,max=v1"`
+}
+
+type ResponseMarker struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v1,max=v1,tag"`
+
+	ProducerID int64           `kafka:"min=v0,max=v1"`
+	Topics     []ResponseTopic `kafka:"min=v0,max=v1"`
+}
+
+type ResponseTopic struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v1,max=v1,tag"`
+
+	Name       string              `kafka:"min=v0,max=v0|min=v1,max=v1,compact"`
+	Partitions []ResponsePartition `kafka:"min=v0,max=v1"`
+}
+
+type ResponsePartition struct {
+	// We need at least one tagged field to indicate that this is a "flexible" message
+	// type.
+	_ struct{} `kafka:"min=v1,max=v1,tag"`
+
+	PartitionIndex int32 `kafka:"min=v0,max=v1"`
+	ErrorCode      int16 `kafka:"min=v0,max=v1"`
+}
+
+func (r *Response) ApiKey() protocol.ApiKey { return protocol.WriteTxnMarkers }
+
+func (r *Response) Merge(requests []protocol.Message, results []interface{}) (protocol.Message, error) {
+	errors := 0
+
+	for i, res := range results {
+		m, err := protocol.Result(res)
+		if err != nil {
+			// Report the error on each partition of the failed request so the
+			// results of the other requests are still returned.
+			for _, marker := range requests[i].(*Request).Markers {
+				for _, t := range marker.Topics {
+					for _, p := range t.PartitionIndexes {
+						r.addPartition(marker.ProducerID, t.Name, ResponsePartition{
+							PartitionIndex: p,
+							ErrorCode:      -1, // UNKNOWN, can we do better?
+						})
+					}
+				}
+			}
+			errors++
+			continue
+		}
+
+		for _, marker := range m.(*Response).Markers {
+			for _, t := range marker.Topics {
+				for _, p := range t.Partitions {
+					r.addPartition(marker.ProducerID, t.Name, p)
+				}
+			}
+		}
+	}
+
+	if errors > 0 && errors == len(results) {
+		_, err := protocol.Result(results[0])
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *Response) addPartition(producerID int64, topic string, partition ResponsePartition) {
+	var m *ResponseMarker
+
+	for i := range r.Markers {
+		if r.Markers[i].ProducerID == producerID {
+			m = &r.Markers[i]
+			break
+		}
+	}
+
+	if m == nil {
+		r.Markers = append(r.Markers, ResponseMarker{ProducerID: producerID})
+		m = &r.Markers[len(r.Markers)-1]
+	}
+
+	for i := range m.Topics {
+		if m.Topics[i].Name == topic {
+			m.Topics[i].Partitions = append(m.Topics[i].Partitions, partition)
+			return
+		}
+	}
+
+	m.Topics = append(m.Topics, ResponseTopic{
+		Name:       topic,
+		Partitions: []ResponsePartition{partition},
+	})
+}
+
+var (
+	_ protocol.BrokerMessage = (*Request)(nil)
+	_ protocol.Splitter      = (*Request)(nil)
+	_ protocol.Merger        = (*Response)(nil)
+)
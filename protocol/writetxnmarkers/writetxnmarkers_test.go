@@ -0,0 +1,150 @@
+package writetxnmarkers_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/prototest"
+	"github.com/segmentio/kafka-go/protocol/writetxnmarkers"
+)
+
+func TestWriteTxnMarkersRequest(t *testing.T) {
+	for _, version := range []int16{0, 1} {
+		prototest.TestRequest(t, version, &writetxnmarkers.Request{
+			Markers: []writetxnmarkers.RequestMarker{
+				{
+					ProducerID:        10,
+					ProducerEpoch:     100,
+					TransactionResult: true,
+					Topics: []writetxnmarkers.RequestTopic{
+						{
+							Name:             "topic-1",
+							PartitionIndexes: []int32{0, 1, 2},
+						},
+						{
+							Name:             "topic-2",
+							PartitionIndexes: []int32{0},
+						},
+					},
+					CoordinatorEpoch: 3,
+				},
+			},
+		})
+	}
+}
+
+func TestWriteTxnMarkersResponse(t *testing.T) {
+	for _, version := range []int16{0, 1} {
+		prototest.TestResponse(t, version, &writetxnmarkers.Response{
+			Markers: []writetxnmarkers.ResponseMarker{
+				{
+					ProducerID: 10,
+					Topics: []writetxnmarkers.ResponseTopic{
+						{
+							Name: "topic-1",
+							Partitions: []writetxnmarkers.ResponsePartition{
+								{
+									PartitionIndex: 0,
+									ErrorCode:      0,
+								},
+								{
+									PartitionIndex: 1,
+									ErrorCode:      6,
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+}
+
+func TestWriteTxnMarkersSplitAndMerge(t *testing.T) {
+	cluster := protocol.Cluster{
+		Brokers: map[int32]protocol.Broker{
+			1: {ID: 1},
+			2: {ID: 2},
+		},
+		Topics: map[string]protocol.Topic{
+			"topic-1": {
+				Name: "topic-1",
+				Partitions: map[int32]protocol.Partition{
+					0: {ID: 0, Leader: 1},
+					1: {ID: 1, Leader: 2},
+				},
+			},
+		},
+	}
+
+	req := &writetxnmarkers.Request{
+		Markers: []writetxnmarkers.RequestMarker{{
+			ProducerID:       10,
+			ProducerEpoch:    1,
+			CoordinatorEpoch: 2,
+			Topics: []writetxnmarkers.RequestTopic{{
+				Name:             "topic-1",
+				PartitionIndexes: []int32{0, 1},
+			}},
+		}},
+	}
+
+	messages, merger, err := req.Split(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected one request per leader, got %d", len(messages))
+	}
+
+	for i, m := range messages {
+		r := m.(*writetxnmarkers.Request)
+		broker, err := r.Broker(cluster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if broker.ID != int32(i+1) {
+			t.Errorf("request #%d: expected to be routed to broker %d but got %d", i, i+1, broker.ID)
+		}
+		if p := r.Markers[0].Topics[0].PartitionIndexes; !reflect.DeepEqual(p, []int32{int32(i)}) {
+			t.Errorf("request #%d: unexpected partitions: %v", i, p)
+		}
+		if r.Markers[0].ProducerID != 10 || r.Markers[0].ProducerEpoch != 1 || r.Markers[0].CoordinatorEpoch != 2 {
+			t.Errorf("request #%d: unexpected marker: %+v", i, r.Markers[0])
+		}
+	}
+
+	res, err := merger.Merge(messages, []interface{}{
+		&writetxnmarkers.Response{
+			Markers: []writetxnmarkers.ResponseMarker{{
+				ProducerID: 10,
+				Topics: []writetxnmarkers.ResponseTopic{{
+					Name:       "topic-1",
+					Partitions: []writetxnmarkers.ResponsePartition{{PartitionIndex: 0}},
+				}},
+			}},
+		},
+		errors.New("broker unavailable"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &writetxnmarkers.Response{
+		Markers: []writetxnmarkers.ResponseMarker{{
+			ProducerID: 10,
+			Topics: []writetxnmarkers.ResponseTopic{{
+				Name: "topic-1",
+				Partitions: []writetxnmarkers.ResponsePartition{
+					{PartitionIndex: 0},
+					{PartitionIndex: 1, ErrorCode: -1},
+				},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("unexpected merged response:\nwant: %+v\ngot:  %+v", want, res)
+	}
+}
@@ -102,6 +102,80 @@ func TestProtocol(t *testing.T) {
 				{Partition: 1, Timestamp: 44, Offset: 100},
 			}},
 		},
+
+		listOffsetRequestV4{
+			ReplicaID:      -1,
+			IsolationLevel: 1,
+			Topics: []listOffsetRequestTopicV4{
+				{TopicName: "A", Partitions: []listOffsetRequestPartitionV4{
+					{Partition: 0, CurrentLeaderEpoch: -1, Time: -1},
+					{Partition: 1, CurrentLeaderEpoch: 3, Time: -2},
+				}},
+			},
+		},
+
+		listOffsetResponseV4{
+			ThrottleTimeMS: 10,
+			Topics: []listOffsetResponseTopicV4{
+				{TopicName: "A", PartitionOffsets: []partitionOffsetV4{
+					{Partition: 0, Timestamp: 42, Offset: 1, LeaderEpoch: 2},
+					{Partition: 1, ErrorCode: 3, Timestamp: -1, Offset: -1, LeaderEpoch: -1},
+				}},
+			},
+		},
+
+		offsetForLeaderEpochRequestV2{
+			Topics: []offsetForLeaderEpochRequestTopicV2{
+				{TopicName: "A", Partitions: []offsetForLeaderEpochRequestPartitionV2{
+					{Partition: 0, CurrentLeaderEpoch: -1, LeaderEpoch: 4},
+				}},
+			},
+		},
+
+		offsetForLeaderEpochResponseV2{
+			ThrottleTimeMS: 10,
+			Topics: []offsetForLeaderEpochResponseTopicV2{
+				{TopicName: "A", Partitions: []offsetForLeaderEpochResponsePartitionV2{
+					{Partition: 0, LeaderEpoch: 3, EndOffset: 100},
+					{ErrorCode: 74, Partition: 1, LeaderEpoch: -1, EndOffset: -1},
+				}},
+			},
+		},
+
+		describeConfigsRequestV1{
+			Resources: []describeConfigsRequestResourceV1{
+				{ResourceType: 2, ResourceName: "A", ConfigNames: []string{"retention.ms"}},
+			},
+			IncludeSynonyms: true,
+		},
+
+		describeConfigsResponseV1{
+			ThrottleTimeMS: 10,
+			Resources: []describeConfigsResponseResourceV1{
+				{ResourceType: 2, ResourceName: "A", ConfigEntries: []describeConfigsResponseConfigEntryV1{
+					{ConfigName: "retention.ms", ConfigValue: "3600000", ConfigSource: 1, ConfigSynonyms: []describeConfigsResponseConfigSynonymV1{
+						{ConfigName: "retention.ms", ConfigValue: "3600000", ConfigSource: 1},
+					}},
+				}},
+				{ErrorCode: 3, ErrorMessage: "unknown topic", ResourceType: 2, ResourceName: "B", ConfigEntries: []describeConfigsResponseConfigEntryV1{}},
+			},
+		},
+
+		alterConfigsRequestV0{
+			Resources: []alterConfigsRequestResourceV0{
+				{ResourceType: 2, ResourceName: "A", ConfigEntries: []alterConfigsRequestConfigV0{
+					{ConfigName: "retention.ms", ConfigValue: "3600000"},
+				}},
+			},
+		},
+
+		alterConfigsResponseV0{
+			ThrottleTimeMS: 10,
+			Resources: []alterConfigsResponseResourceV0{
+				{ResourceType: 2, ResourceName: "A"},
+				{ErrorCode: 3, ErrorMessage: "unknown topic", ResourceType: 2, ResourceName: "B"},
+			},
+		},
 	}
 
 	for _, test := range tests {
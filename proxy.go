@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+type dialFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+// proxyDialFunc returns a function that opens connections tunneled through the
+// proxy at u, using dial to connect to the proxy itself.
+func proxyDialFunc(u *url.URL, dial dialFunc) dialFunc {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		switch u.Scheme {
+		case "socks5", "socks5h":
+			return dialSOCKS5(ctx, u, dial, network, address)
+		case "http":
+			return dialHTTPConnect(ctx, u, dial, network, address)
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q, must be one of socks5, socks5h, or http", u.Scheme)
+		}
+	}
+}
+
+func proxyAddress(u *url.URL, defaultPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// proxyForward adapts a dial function to the proxy.Dialer interface, the
+// context is captured because the interface does not support it.
+type proxyForward struct {
+	ctx  context.Context
+	dial dialFunc
+}
+
+func (f proxyForward) Dial(network string, address string) (net.Conn, error) {
+	return f.dial(f.ctx, network, address)
+}
+
+func dialSOCKS5(ctx context.Context, u *url.URL, dial dialFunc, network string, address string) (net.Conn, error) {
+	// With the socks5 scheme, host names are resolved locally and the proxy
+	// receives an IP address, socks5h lets the proxy resolve them.
+	if u.Scheme == "socks5" {
+		resolved, err := resolveProxyTarget(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		address = resolved
+	}
+
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+
+	d, err := proxy.SOCKS5("tcp", proxyAddress(u, "1080"), auth, proxyForward{ctx: ctx, dial: dial})
+	if err != nil {
+		return nil, err
+	}
+
+	// The SOCKS5 dialer of golang.org/x/net supports contexts, even if the
+	// proxy.Dialer interface does not expose it.
+	if cd, ok := d.(interface {
+		DialContext(context.Context, string, string) (net.Conn, error)
+	}); ok {
+		return cd.DialContext(ctx, network, address)
+	}
+	return d.Dial(network, address)
+}
+
+// resolveProxyTarget returns address with its host name replaced by the first
+// IP address that it resolves to.
+func resolveProxyTarget(ctx context.Context, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return address, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s before connecting through the socks5 proxy: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("failed to resolve %s before connecting through the socks5 proxy: no addresses found", host)
+	}
+	return net.JoinHostPort(addrs[0].IP.String(), port), nil
+}
+
+func dialHTTPConnect(ctx context.Context, u *url.URL, dial dialFunc, network string, address string) (net.Conn, error) {
+	conn, err := dial(ctx, network, proxyAddress(u, "80"))
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT request to proxy %s: %w", u.Host, err)
+	}
+
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response from proxy %s: %w", u.Host, err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", u.Host, address, res.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	// Kafka brokers never send data before receiving a request, but the
+	// bytes that were buffered must not be lost in case the proxy did.
+	if r.Buffered() != 0 {
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -169,6 +169,47 @@ func readNewBytes(r *bufio.Reader, sz int, n int) ([]byte, int, error) {
 	return b, sz, err
 }
 
+// readNewNullableBytes is like readNewBytes but follows the semantics of the
+// nullable bytes of the kafka protocol: a negative length decodes to nil, and a
+// zero length decodes to an empty non-nil slice.
+func readNewNullableBytes(r *bufio.Reader, sz int, n int) ([]byte, int, error) {
+	if n == 0 {
+		return []byte{}, sz, nil
+	}
+	return readNewBytes(r, sz, n)
+}
+
+// appendBytes is like readNewBytes but appends the bytes to b instead of
+// allocating a new slice, growing b when its capacity is too small.
+func appendBytes(r *bufio.Reader, b []byte, sz int, n int) ([]byte, int, error) {
+	var err error
+	var shortRead bool
+
+	if n > 0 {
+		if sz < n {
+			n = sz
+			shortRead = true
+		}
+
+		i := len(b)
+		if cap(b)-i < n {
+			c := make([]byte, i, 2*cap(b)+n)
+			copy(c, b)
+			b = c
+		}
+
+		n, err = io.ReadFull(r, b[i:i+n])
+		b = b[:i+n]
+		sz -= n
+
+		if err == nil && shortRead {
+			err = errShortRead
+		}
+	}
+
+	return b, sz, err
+}
+
 func readArrayLen(r *bufio.Reader, sz int, n *int) (int, error) {
 	var err error
 	var len int32
@@ -18,10 +18,62 @@ const (
 	FirstOffset int64 = -2 // The least recent offset available for a partition.
 )
 
+// OffsetResetPolicy represents the policy applied by readers when the offset
+// they are reading from is out of the range of offsets available on the
+// partition, which mirrors the auto.offset.reset configuration of the Java
+// client.
+type OffsetResetPolicy int8
+
+const (
+	// OffsetResetDefault preserves the historical behavior of readers: offsets
+	// before the first offset of the partition skip forward to the first
+	// offset, and offsets past the last offset are retried until enough data
+	// has been produced.
+	OffsetResetDefault OffsetResetPolicy = iota
+
+	// OffsetResetEarliest resets out of range offsets to the first offset
+	// available on the partition.
+	OffsetResetEarliest
+
+	// OffsetResetLatest resets out of range offsets to the last offset of the
+	// partition.
+	OffsetResetLatest
+
+	// OffsetResetError causes readers to report OffsetOutOfRange errors to the
+	// program instead of resetting the offset. The program may then use
+	// SetOffset to choose where to resume from.
+	OffsetResetError
+)
+
+// reset applies the policy to an offset which is outside of the [first, last]
+// range of a partition, returning the offset to resume reading from.
+func (p OffsetResetPolicy) reset(offset, first, last int64) (int64, error) {
+	switch p {
+	case OffsetResetEarliest:
+		return first, nil
+	case OffsetResetLatest:
+		return last, nil
+	case OffsetResetError:
+		return offset, OffsetOutOfRange
+	}
+	if offset < first {
+		return first, nil
+	}
+	return offset, nil
+}
+
 const (
 	// defaultCommitRetries holds the number commit attempts to make
 	// before giving up
 	defaultCommitRetries = 3
+
+	// maxCommitMetadataSize is the default value of the offset.metadata.max.bytes
+	// broker setting
+	maxCommitMetadataSize = 4096
+
+	// defaultRevokeCommitTimeout bounds the final commit of the offsets of the
+	// partitions revoked at the end of a generation
+	defaultRevokeCommitTimeout = 10 * time.Second
 )
 
 const (
@@ -29,6 +81,10 @@ const (
 	// soon as a single byte of data is available or the fetch request times out
 	// waiting for data to arrive.
 	defaultFetchMinBytes = 1
+
+	// defaultMaxRecordBytes is the size that fetches may grow to when reading
+	// records larger than MaxBytes.
+	defaultMaxRecordBytes = 64 << 20
 )
 
 var (
@@ -75,6 +131,9 @@ type Reader struct {
 	lag     int64
 	closed  bool
 
+	// membership of the reader in the current consumer group generation
+	membership GroupMembership
+
 	// Without a group subscription (when Reader.config.GroupID == ""),
 	// when errors occur, the Reader gets a synthetic readerMessage with
 	// a non-nil err set. With group subscriptions however, when an error
@@ -91,11 +150,53 @@ type Reader struct {
 	// reader stats are all made of atomic values, no need for synchronization.
 	// Use a pointer to ensure 64-bit alignment of the values.
 	stats *readerStats
+
+	// client used to fetch messages when config.FetchByBroker is enabled, its
+	// transport maintains a single connection to each broker.
+	client *Client
+
+	// pool of raw batches when config.RawBatches is enabled, shared by the
+	// partition readers so buffers are reused when they are restarted.
+	batches chan *RawBatch
+	// last batch returned by FetchBatch, which is released on the next call.
+	batch *RawBatch
+
+	// tracker of the messages awaiting acknowledgement when
+	// config.AckMessages is enabled.
+	acks *ackTracker
+
+	// dispatcher of the messages to partition consumers while
+	// ConsumePartitions is running.
+	dispatcher *partitionDispatcher
+
+	// positions of the reader in the partitions that it reads, and high water
+	// marks of the partitions reported by the last fetches, see LagByPartition.
+	partitionLags map[topicPartition]partitionLag
+
+	// offsets of the partitions read by the reader when config.Partitions is
+	// set, see SetPartitionOffset.
+	partitionOffsets map[int]int64
+
+	// whether the reader reached the high water mark of all its partitions,
+	// see config.OnCaughtUp.
+	caughtUp bool
+
+	// partitions which reached the end of the range of messages configured by
+	// config.StopAtOffset or config.StopAtTime.
+	stopped map[topicPartition]bool
+}
+
+type partitionLag struct {
+	offset    int64
+	watermark int64 // -1 until a message of the partition was fetched
 }
 
 // useConsumerGroup indicates whether the Reader is part of a consumer group.
 func (r *Reader) useConsumerGroup() bool { return r.config.GroupID != "" }
 
+// usePartitions indicates whether the Reader reads a static set of partitions.
+func (r *Reader) usePartitions() bool { return len(r.config.Partitions) != 0 }
+
 func (r *Reader) getTopics() []string {
 	if len(r.config.GroupTopics) > 0 {
 		return r.config.GroupTopics[:]
@@ -121,9 +222,9 @@ func (r *Reader) unsubscribe() {
 	// another consumer to avoid such a race.
 }
 
-func (r *Reader) subscribe(allAssignments map[string][]PartitionAssignment) {
+func (r *Reader) subscribe(gen *Generation) {
 	offsets := make(map[topicPartition]int64)
-	for topic, assignments := range allAssignments {
+	for topic, assignments := range gen.Assignments {
 		for _, assignment := range assignments {
 			key := topicPartition{
 				topic:     topic,
@@ -135,11 +236,20 @@ func (r *Reader) subscribe(allAssignments map[string][]PartitionAssignment) {
 
 	r.mutex.Lock()
 	r.start(offsets)
+	if r.acks != nil {
+		r.acks.reset(gen.ID)
+	}
 	r.mutex.Unlock()
 
-	r.withLogger(func(l Logger) {
-		l.Printf("subscribed to topics and partitions: %+v", offsets)
-	})
+	r.log().debug(r.stctx, "subscribed to topics and partitions",
+		logAttrs{"group", r.config.GroupID, "generation", gen.ID, "partitions", offsets},
+		"subscribed to topics and partitions: %+v", offsets)
+}
+
+func (r *Reader) setMembership(membership GroupMembership) {
+	r.mutex.Lock()
+	r.membership = membership
+	r.mutex.Unlock()
 }
 
 func (r *Reader) waitThrottleTime(throttleTimeMS int32) {
@@ -158,8 +268,8 @@ func (r *Reader) waitThrottleTime(throttleTimeMS int32) {
 }
 
 // commitOffsetsWithRetry attempts to commit the specified offsets and retries
-// up to the specified number of times
-func (r *Reader) commitOffsetsWithRetry(gen *Generation, offsetStash offsetStash, retries int) (err error) {
+// up to the specified number of times, or until ctx is canceled.
+func (r *Reader) commitOffsetsWithRetry(ctx context.Context, gen *Generation, offsetStash offsetStash, retries int) (err error) {
 	const (
 		backoffDelayMin = 100 * time.Millisecond
 		backoffDelayMax = 5 * time.Second
@@ -167,12 +277,13 @@ func (r *Reader) commitOffsetsWithRetry(gen *Generation, offsetStash offsetStash
 
 	for attempt := 0; attempt < retries; attempt++ {
 		if attempt != 0 {
-			if !sleep(r.stctx, backoff(attempt, backoffDelayMin, backoffDelayMax)) {
+			if !sleep(ctx, backoff(attempt, backoffDelayMin, backoffDelayMax)) {
 				return
 			}
 		}
 
-		if err = gen.CommitOffsets(offsetStash); err == nil {
+		if err = gen.CommitOffsetsWithMetadata(offsetStash, r.config.CommitMetadata); err == nil {
+			countMetric(r.config.MetricsHook, "kafka.reader.commit.count", 1, r.metricLabels())
 			return
 		}
 	}
@@ -216,27 +327,33 @@ func (r *Reader) commitLoopImmediate(ctx context.Context, gen *Generation) {
 			// the commit will combine any outstanding requests and the result
 			// will be sent back to all the callers of CommitMessages so that
 			// they can return.
-			var errchs []chan<- error
+			var reqs []commitRequest
 			for hasCommits := true; hasCommits; {
 				select {
 				case req := <-r.commits:
 					offsets.merge(req.commits)
-					errchs = append(errchs, req.errch)
+					reqs = append(reqs, req)
 				default:
 					hasCommits = false
 				}
 			}
-			err := r.commitOffsetsWithRetry(gen, offsets, defaultCommitRetries)
-			for _, errch := range errchs {
+			err := r.commitRevoked(gen, offsets)
+			for _, req := range reqs {
 				// NOTE : this will be a buffered channel and will not block.
-				errch <- err
+				req.complete(offsets, err)
 			}
 			return
 
 		case req := <-r.commits:
 			offsets.merge(req.commits)
-			req.errch <- r.commitOffsetsWithRetry(gen, offsets, defaultCommitRetries)
-			offsets.reset()
+			err := r.commitOffsetsWithRetry(r.stctx, gen, offsets, defaultCommitRetries)
+			req.complete(offsets, err)
+			// Offsets that could not be committed are kept in the stash, they
+			// are committed with the next request or when the partitions are
+			// revoked.
+			if err == nil {
+				offsets.reset()
+			}
 		}
 	}
 }
@@ -252,8 +369,9 @@ func (r *Reader) commitLoopInterval(ctx context.Context, gen *Generation) {
 	offsets := offsetStash{}
 
 	commit := func() {
-		if err := r.commitOffsetsWithRetry(gen, offsets, defaultCommitRetries); err != nil {
-			r.withErrorLogger(func(l Logger) { l.Printf(err.Error()) })
+		if err := r.commitOffsetsWithRetry(r.stctx, gen, offsets, defaultCommitRetries); err != nil {
+			r.log().error(ctx, "failed to commit offsets",
+				logAttrs{"group", r.config.GroupID, "generation", gen.ID, "error", err}, "%s", err)
 		} else {
 			offsets.reset()
 		}
@@ -271,7 +389,10 @@ func (r *Reader) commitLoopInterval(ctx context.Context, gen *Generation) {
 					hasCommits = false
 				}
 			}
-			commit()
+			if err := r.commitRevoked(gen, offsets); err != nil {
+				r.log().error(ctx, "failed to commit offsets of revoked partitions",
+					logAttrs{"group", r.config.GroupID, "generation", gen.ID, "error", err}, "%s", err)
+			}
 			return
 
 		case <-ticker.C:
@@ -283,14 +404,50 @@ func (r *Reader) commitLoopInterval(ctx context.Context, gen *Generation) {
 	}
 }
 
+// commitRevoked commits the offsets of the partitions revoked at the end of
+// gen, and reports the result to the OnRevoke callback. The commit is bounded
+// by RevokeCommitTimeout so a coordinator which does not respond cannot
+// prevent the reader from rejoining the group. When the timeout expires the
+// commit is not retried anymore, the request in flight is bounded by the
+// timeout of the connection to the coordinator.
+func (r *Reader) commitRevoked(gen *Generation, offsets offsetStash) error {
+	timeout := r.config.RevokeCommitTimeout
+	if timeout == 0 {
+		timeout = defaultRevokeCommitTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(r.stctx, timeout)
+	defer cancel()
+
+	errch := make(chan error, 1)
+	go func() { errch <- r.commitOffsetsWithRetry(ctx, gen, offsets, defaultCommitRetries) }()
+
+	var err error
+	select {
+	case err = <-errch:
+	case <-ctx.Done():
+		err = fmt.Errorf("kafka.(*Reader): commit of the offsets of revoked partitions did not complete within %s: %w", timeout, context.DeadlineExceeded)
+	}
+
+	if r.config.OnRevoke != nil {
+		partitions := make(map[string][]int, len(gen.Assignments))
+		for topic, assignments := range gen.Assignments {
+			for _, a := range assignments {
+				partitions[topic] = append(partitions[topic], a.ID)
+			}
+		}
+		r.config.OnRevoke(partitions, err)
+	}
+
+	return err
+}
+
 // commitLoop processes commits off the commit chan
 func (r *Reader) commitLoop(ctx context.Context, gen *Generation) {
-	r.withLogger(func(l Logger) {
-		l.Printf("started commit for group %s\n", r.config.GroupID)
-	})
-	defer r.withLogger(func(l Logger) {
-		l.Printf("stopped commit for group %s\n", r.config.GroupID)
-	})
+	r.log().debug(ctx, "started commit", logAttrs{"group", r.config.GroupID, "generation", gen.ID},
+		"started commit for group %s\n", r.config.GroupID)
+	defer r.log().debug(ctx, "stopped commit", logAttrs{"group", r.config.GroupID, "generation", gen.ID},
+		"stopped commit for group %s\n", r.config.GroupID)
 
 	if r.config.CommitInterval == 0 {
 		r.commitLoopImmediate(ctx, gen)
@@ -307,9 +464,8 @@ func (r *Reader) run(cg *ConsumerGroup) {
 	defer close(r.done)
 	defer cg.Close()
 
-	r.withLogger(func(l Logger) {
-		l.Printf("entering loop for consumer group, %v\n", r.config.GroupID)
-	})
+	r.log().debug(r.stctx, "entering loop for consumer group", logAttrs{"group", r.config.GroupID},
+		"entering loop for consumer group, %v\n", r.config.GroupID)
 
 	for {
 		// Limit the number of attempts at waiting for the next
@@ -324,10 +480,9 @@ func (r *Reader) run(cg *ConsumerGroup) {
 			if err == r.stctx.Err() {
 				return
 			}
-			r.stats.errors.observe(1)
-			r.withErrorLogger(func(l Logger) {
-				l.Printf(err.Error())
-			})
+			r.stats.count("kafka.reader.error.count", &r.stats.errors, 1, r.metricLabels())
+			r.log().error(r.stctx, "failed to join the consumer group",
+				logAttrs{"group", r.config.GroupID, "attempt", attempt, "error", err}, "%s", err)
 			// Continue with next attempt...
 		}
 		if err != nil {
@@ -342,9 +497,15 @@ func (r *Reader) run(cg *ConsumerGroup) {
 			continue
 		}
 
-		r.stats.rebalances.observe(1)
+		r.stats.count("kafka.reader.rebalance.count", &r.stats.rebalances, 1, r.metricLabels())
 
-		r.subscribe(gen.Assignments)
+		r.setMembership(GroupMembership{
+			GroupID:      gen.GroupID,
+			GenerationID: gen.ID,
+			MemberID:     gen.MemberID,
+			IsLeader:     gen.IsLeader,
+		})
+		r.subscribe(gen)
 
 		gen.Start(func(ctx context.Context) {
 			r.commitLoop(ctx, gen)
@@ -357,6 +518,7 @@ func (r *Reader) run(cg *ConsumerGroup) {
 			case <-r.stctx.Done():
 				// this will be the last loop because the reader is closed.
 			}
+			r.setMembership(GroupMembership{})
 			r.unsubscribe()
 		})
 	}
@@ -384,6 +546,18 @@ type ReaderConfig struct {
 	// be assigned, but not both
 	Partition int
 
+	// Partitions of Topic to read messages from, for readers consuming a
+	// static set of partitions without the coordination of a consumer group.
+	// The messages of all partitions are returned by FetchMessage, and the
+	// position of the reader in each partition is managed with
+	// SetPartitionOffset and PartitionOffsets.
+	//
+	// Partitions cannot be combined with Partition or GroupID. When set,
+	// Offset and Lag report the position of the reader in the partition of the
+	// last message returned, and SetOffset and SetOffsetAt change the offsets
+	// of all partitions.
+	Partitions []int
+
 	// An dialer used to open connections to the kafka server. This field is
 	// optional, if nil, the default dialer is used instead.
 	Dialer *Dialer
@@ -407,6 +581,30 @@ type ReaderConfig struct {
 	// Default: 1MB
 	MaxBytes int
 
+	// PartitionMaxBytes indicates to the broker the maximum amount of data that
+	// it may return for each partition, which prevents partitions with a lot
+	// of data from using all of MaxBytes when a fetch request contains
+	// multiple partitions, see FetchByBroker. When each partition is fetched
+	// independently, the limit is the minimum of MaxBytes and
+	// PartitionMaxBytes.
+	//
+	// Default: MaxBytes
+	PartitionMaxBytes int
+
+	// MaxRecordBytes is the maximum size of the fetches that the reader sends
+	// to read a record which does not fit in MaxBytes. Since version 0.10.1,
+	// kafka returns the first record of a fetch even when it is larger than
+	// the limit; older versions truncate it instead, the reader then doubles
+	// the size of the fetches of the partition until the record fits, and
+	// reports a RecordTooLargeError when MaxRecordBytes is reached, retrying
+	// the fetch with the backoff of ReadBackoffMin and ReadBackoffMax.
+	//
+	// It cannot be combined with FetchByBroker, which requires brokers that
+	// return records larger than the limits of fetches.
+	//
+	// Default: 64MB
+	MaxRecordBytes int
+
 	// Maximum amount of time to wait for new data to come when fetching batches
 	// of messages from kafka.
 	//
@@ -426,10 +624,27 @@ type ReaderConfig struct {
 	// Only used when GroupID is set
 	GroupBalancers []GroupBalancer
 
+	// GroupProtocolUserData optionally provides the user data sent to the
+	// consumer group leader for each of the GroupBalancers, in place of the
+	// value returned by their UserData method, see
+	// ConsumerGroupConfig.GroupProtocolUserData.
+	//
+	// Only used when GroupID is set
+	GroupProtocolUserData func(balancer GroupBalancer) ([]byte, error)
+
+	// GroupProtocol selects the protocol used to coordinate with the other
+	// members of the consumer group, see GroupProtocolConsumer.
+	//
+	// Default: GroupProtocolClassic
+	//
+	// Only used when GroupID is set
+	GroupProtocol GroupProtocol
+
 	// HeartbeatInterval sets the optional frequency at which the reader sends the consumer
-	// group heartbeat update.
+	// group heartbeat update. It must not be greater than SessionTimeout, and
+	// should be no greater than a third of it.
 	//
-	// Default: 3s
+	// Default: 3s, or a third of SessionTimeout if it is shorter
 	//
 	// Only used when GroupID is set
 	HeartbeatInterval time.Duration
@@ -442,6 +657,48 @@ type ReaderConfig struct {
 	// Only used when GroupID is set
 	CommitInterval time.Duration
 
+	// RevokeCommitTimeout bounds the time spent committing the offsets of the
+	// partitions revoked from the reader by a rebalance. The offsets of the
+	// messages passed to CommitMessages or Ack which were not committed yet,
+	// for example because of CommitInterval, are committed before the reader
+	// releases the partitions, so the members that they are reassigned to do
+	// not process the messages again. The revocation completes when the
+	// timeout expires even if the commit did not, and the error is reported
+	// to OnRevoke.
+	//
+	// The timeout should be shorter than RebalanceTimeout, otherwise the
+	// reader may be removed from the group while it commits.
+	//
+	// Default: 10s
+	//
+	// Only used when GroupID is set
+	RevokeCommitTimeout time.Duration
+
+	// OnRevoke is called when a consumer group generation ends and the
+	// partitions assigned to the reader are revoked, after the offsets of the
+	// partitions were committed. Generations end on every rebalance, the
+	// partitions may be assigned to the reader again in the next generation.
+	// The error is the one returned by the commit, or nil if it succeeded or
+	// there were no offsets to commit.
+	//
+	// The function is called from the goroutine managing the consumer group,
+	// it must not block, nor call methods of the reader which wait for the
+	// next generation.
+	//
+	// Only used when GroupID is set
+	OnRevoke func(partitions map[string][]int, err error)
+
+	// CommitMetadata is an optional string attached to the offsets committed
+	// by the reader, it is returned with the offsets by OffsetFetch requests.
+	// The metadata is opaque to kafka, it is intended to hold information like
+	// the host that committed the offsets.
+	//
+	// Brokers reject metadata longer than their offset.metadata.max.bytes
+	// setting, the length is limited to the default of 4096 bytes.
+	//
+	// Only used when GroupID is set
+	CommitMetadata string
+
 	// PartitionWatchInterval indicates how often a reader checks for partition changes.
 	// If a reader sees a partition change (such as a partition add) it will rebalance the group
 	// picking up new partitions.
@@ -453,10 +710,17 @@ type ReaderConfig struct {
 
 	// WatchForPartitionChanges is used to inform kafka-go that a consumer group should be
 	// polling the brokers and rebalancing if any partition changes happen to the topic.
+	//
+	// With GroupProtocolConsumer, the group coordinator assigns the partitions
+	// added to the topics itself, and this option has no effect. Readers which
+	// are not part of a consumer group read a single partition and are never
+	// affected by partition changes.
 	WatchPartitionChanges bool
 
 	// SessionTimeout optionally sets the length of time that may pass without a heartbeat
 	// before the coordinator considers the consumer dead and initiates a rebalance.
+	// It must be within the bounds configured on the brokers with
+	// group.min.session.timeout.ms and group.max.session.timeout.ms.
 	//
 	// Default: 30s
 	//
@@ -467,7 +731,12 @@ type ReaderConfig struct {
 	// for members to join as part of a rebalance.  For kafka servers under higher
 	// load, it may be useful to set this value higher.
 	//
-	// Default: 30s
+	// Members which do not rejoin within this time, for example because the
+	// program is still processing messages of the previous generation, are
+	// removed from the group. It must be greater than or equal to
+	// SessionTimeout when both are set.
+	//
+	// Default: 30s, or SessionTimeout if it is longer
 	//
 	// Only used when GroupID is set
 	RebalanceTimeout time.Duration
@@ -515,6 +784,14 @@ type ReaderConfig struct {
 	// back to using Logger instead.
 	ErrorLogger Logger
 
+	// If not nil, specifies a logger which receives both the internal changes
+	// and the errors of the reader, with their topic, partition, offset, and
+	// generation as attributes. It can be combined with Logger and ErrorLogger.
+	StructuredLogger StructuredLogger
+
+	// If not nil, receives the metrics of the reader as they are observed.
+	MetricsHook MetricsHook
+
 	// IsolationLevel controls the visibility of transactional records.
 	// ReadUncommitted makes all records visible. With ReadCommitted only
 	// non-transactional and committed records are visible.
@@ -522,8 +799,161 @@ type ReaderConfig struct {
 
 	// Limit of how many attempts will be made before delivering the error.
 	//
+	// This also bounds the reconnections to the partition leader when fetches
+	// fail with FencedLeaderEpoch or UnknownLeaderEpoch errors, which happen
+	// transiently while the leadership of a partition changes.
+	//
 	// The default is to try 3 times.
 	MaxAttempts int
+
+	// OffsetOutOfRangeReset sets the policy applied when the offset the reader
+	// is positioned at does not exist on the partition, for example when the
+	// committed offset of a consumer group was deleted by retention. The policy
+	// applies both when the reader is initialized and when the log is
+	// truncated while the reader is consuming it.
+	//
+	// Default: OffsetResetDefault
+	OffsetOutOfRangeReset OffsetResetPolicy
+
+	// WaitForTopic is how long the reader keeps retrying when the topic or a
+	// partition that it reads from does not exist, for example while the
+	// topic is deleted and recreated, before reporting UnknownTopicOrPartition
+	// errors to the program. The reader resumes reading once the topic exists
+	// again, the offset reset policy applies if the offset it was positioned
+	// at does not exist in the new topic.
+	//
+	// Default: 0 (UnknownTopicOrPartition errors are reported after
+	// MaxAttempts like other errors)
+	WaitForTopic time.Duration
+
+	// FetchByBroker configures the reader to group the partitions it consumes
+	// by leader, and send a single fetch request to each broker for all the
+	// partitions it leads, instead of maintaining a connection and issuing
+	// fetch requests for each partition.
+	//
+	// This reduces the number of connections and requests when a reader
+	// consumes many partitions from few brokers, typically with consumer
+	// groups on topics with a large number of partitions. The MinBytes,
+	// MaxBytes, and MaxWait settings then apply to each fetch request sent to
+	// a broker, and PartitionMaxBytes limits the size of each partition.
+	//
+	// Default: false
+	FetchByBroker bool
+
+	// RackID is the rack that the reader is running in, which is sent to the
+	// brokers in fetch requests when FetchByBroker is enabled. It requires
+	// kafka 2.4 or above, it is otherwise ignored.
+	//
+	// Brokers may use the rack to select the replica that consumers should
+	// read from, however the reader always fetches from partition leaders.
+	RackID string
+
+	// RawBatches configures the reader to deliver the messages of each fetch
+	// as a RawBatch returned by FetchBatch, instead of one Message at a time.
+	// The keys and values of the records are slices of a buffer reused across
+	// fetches, which avoids allocating memory for each message, see RawBatch
+	// for the constraints this puts on the program.
+	//
+	// When enabled, messages must be read with FetchBatch, ReadMessage and
+	// FetchMessage return an error. It cannot be combined with FetchByBroker.
+	//
+	// Default: false
+	RawBatches bool
+
+	// AckMessages configures the reader to track the messages returned by
+	// FetchMessage, so they can be acknowledged with Ack in any order. The
+	// reader commits the offset of each partition up to the lowest message
+	// that was not acknowledged yet, which gives at-least-once delivery when
+	// the messages are processed concurrently.
+	//
+	// It requires GroupID to be set, and cannot be combined with RawBatches.
+	//
+	// Default: false
+	AckMessages bool
+
+	// MaxLag is the number of messages that the reader may fall behind the
+	// high water mark of a partition. When a fetch reports a larger lag, the
+	// messages of the fetch are discarded and the reader skips to the high
+	// water mark, resuming with the messages produced afterwards.
+	//
+	// Skipped messages are never returned to the program and their offsets
+	// are not committed, this is only suitable for applications which favor
+	// fresh data over processing every message.
+	//
+	// Default: 0 (never skip messages)
+	MaxLag int64
+
+	// OnMaxLag is called with the topic, partition, and number of messages
+	// skipped each time the reader skips ahead because of MaxLag. It may be
+	// called concurrently for different partitions, and must not block.
+	OnMaxLag func(topic string, partition int, skipped int64)
+
+	// DetectTruncation enables the detection of log truncations, which may
+	// happen after an unclean leader election. The reader tracks the leader
+	// epoch of the messages it consumed, and when it reconnects to the leader
+	// of a partition, uses OffsetForLeaderEpoch to check that the log still
+	// contains the offsets it consumed. If the log diverged, the reader resumes
+	// from the offset where it diverged instead of skipping the messages that
+	// were written there by the new leader.
+	//
+	// Only the offsets consumed by the reader are validated; offsets committed
+	// by previous members of a consumer group are not, since their leader
+	// epoch is unknown. Detection requires kafka 2.1 or above and cannot be
+	// combined with FetchByBroker.
+	//
+	// Default: false
+	DetectTruncation bool
+
+	// OnTruncation is called with the topic, partition, the offset that the
+	// reader consumed up to, and the offset that it resumes from each time a
+	// truncation is detected. It may be called concurrently for different
+	// partitions, and must not block.
+	OnTruncation func(topic string, partition int, offset, divergence int64)
+
+	// ControlRecords makes the reader return the control records which mark
+	// the commit or abort of transactions, for example to audit transactions.
+	// The Control field of the messages read from control records describes
+	// the marker. Control records are skipped when it is disabled.
+	//
+	// It cannot be combined with RawBatches or FetchByBroker.
+	//
+	// Default: false
+	ControlRecords bool
+
+	// OnCaughtUp is called when the position of the reader reaches the high
+	// water mark of all the partitions that it reads, which means that the
+	// program consumed all the messages that the partitions held. It is
+	// called again each time the reader falls behind because new messages
+	// were produced and catches up again, or after a new assignment of
+	// partitions of a consumer group was caught up.
+	//
+	// The function is called by FetchMessage, ReadMessage, or FetchBatch, on
+	// the goroutine of the program, before the method returns the next
+	// message; programs replaying a topic before processing new messages
+	// typically switch modes in the function.
+	OnCaughtUp func()
+
+	// StopAtOffset bounds the range of messages read from each partition,
+	// the reader stops delivering messages of a partition when it reaches
+	// the offset, which is excluded from the range.
+	//
+	// Once all the partitions of the reader are done, FetchMessage,
+	// ReadMessage, and FetchBatch return io.EOF. The end of partitions is
+	// resolved when the reader starts reading them, partitions which have
+	// not received messages up to the offset yet are done when the reader
+	// reaches their high water mark.
+	//
+	// Default: 0 (the range is unbounded, since the offset is excluded a range
+	// ending at offset 0 would not contain any messages)
+	StopAtOffset int64
+
+	// StopAtTime bounds the range of messages read from each partition like
+	// StopAtOffset, the reader stops at the first message written at or
+	// after the time, or at the high water mark if there are none. When both
+	// are set, the reader stops at the first boundary reached.
+	//
+	// Default: zero time (the range is unbounded)
+	StopAtTime time.Time
 }
 
 // Validate method validates ReaderConfig properties.
@@ -544,6 +974,25 @@ func (config *ReaderConfig) Validate() error {
 		return errors.New(fmt.Sprintf("invalid negative maximum batch size (max = %d)", config.MaxBytes))
 	}
 
+	if len(config.Partitions) != 0 {
+		if config.GroupID != "" {
+			return errors.New("either Partitions or GroupID may be specified, but not both")
+		}
+		if config.Partition != 0 {
+			return errors.New("either Partition or Partitions may be specified, but not both")
+		}
+		seen := make(map[int]bool, len(config.Partitions))
+		for _, partition := range config.Partitions {
+			if partition < 0 || partition >= math.MaxInt32 {
+				return errors.New(fmt.Sprintf("partition number out of bounds: %d", partition))
+			}
+			if seen[partition] {
+				return errors.New(fmt.Sprintf("partition %d is listed more than once in Partitions", partition))
+			}
+			seen[partition] = true
+		}
+	}
+
 	if config.GroupID != "" {
 		if config.Partition != 0 {
 			return errors.New("either Partition or GroupID may be specified, but not both")
@@ -552,10 +1001,34 @@ func (config *ReaderConfig) Validate() error {
 		if len(config.Topic) == 0 && len(config.GroupTopics) == 0 {
 			return errors.New("either Topic or GroupTopics must be specified with GroupID")
 		}
+
+		heartbeatInterval, sessionTimeout := config.HeartbeatInterval, config.SessionTimeout
+		if sessionTimeout == 0 {
+			sessionTimeout = defaultSessionTimeout
+		}
+		if heartbeatInterval == 0 {
+			heartbeatInterval = sessionHeartbeatInterval(sessionTimeout)
+		}
+		if err := validateSessionTimeout(heartbeatInterval, sessionTimeout); err != nil {
+			return err
+		}
+		if config.SessionTimeout != 0 && config.RebalanceTimeout != 0 {
+			if err := validateRebalanceTimeout(sessionTimeout, config.RebalanceTimeout); err != nil {
+				return err
+			}
+		}
 	} else if len(config.Topic) == 0 {
 		return errors.New("cannot create a new kafka reader with an empty topic")
 	}
 
+	if config.MaxRecordBytes < 0 {
+		return errors.New(fmt.Sprintf("invalid negative maximum record size (max = %d)", config.MaxRecordBytes))
+	}
+
+	if config.PartitionMaxBytes < 0 {
+		return errors.New(fmt.Sprintf("invalid negative partition maximum batch size (max = %d)", config.PartitionMaxBytes))
+	}
+
 	if config.MinBytes > config.MaxBytes {
 		return errors.New(fmt.Sprintf("minimum batch size greater than the maximum (min = %d, max = %d)", config.MinBytes, config.MaxBytes))
 	}
@@ -568,6 +1041,54 @@ func (config *ReaderConfig) Validate() error {
 		return errors.New(fmt.Sprintf("ReadBackoffMin out of bounds: %d", config.ReadBackoffMin))
 	}
 
+	if config.WaitForTopic < 0 {
+		return errors.New(fmt.Sprintf("WaitForTopic out of bounds: %d", config.WaitForTopic))
+	}
+
+	if config.RevokeCommitTimeout < 0 {
+		return errors.New(fmt.Sprintf("RevokeCommitTimeout out of bounds: %d", config.RevokeCommitTimeout))
+	}
+
+	if config.StopAtOffset < 0 {
+		return errors.New(fmt.Sprintf("StopAtOffset out of bounds: %d", config.StopAtOffset))
+	}
+
+	if config.OffsetOutOfRangeReset < OffsetResetDefault || config.OffsetOutOfRangeReset > OffsetResetError {
+		return errors.New(fmt.Sprintf("invalid offset out of range reset policy: %d", config.OffsetOutOfRangeReset))
+	}
+
+	if config.RawBatches && config.FetchByBroker {
+		return errors.New("RawBatches cannot be used with FetchByBroker")
+	}
+
+	if config.MaxRecordBytes != 0 && config.FetchByBroker {
+		return errors.New("MaxRecordBytes cannot be used with FetchByBroker")
+	}
+
+	if config.MaxLag < 0 {
+		return errors.New(fmt.Sprintf("invalid negative maximum lag (max = %d)", config.MaxLag))
+	}
+
+	if config.DetectTruncation && config.FetchByBroker {
+		return errors.New("DetectTruncation cannot be used with FetchByBroker")
+	}
+
+	if config.ControlRecords && (config.RawBatches || config.FetchByBroker) {
+		return errors.New("ControlRecords cannot be used with RawBatches or FetchByBroker")
+	}
+
+	if config.AckMessages && config.GroupID == "" {
+		return errors.New("AckMessages requires GroupID to be set")
+	}
+
+	if config.AckMessages && config.RawBatches {
+		return errors.New("AckMessages cannot be used with RawBatches")
+	}
+
+	if len(config.CommitMetadata) > maxCommitMetadataSize {
+		return errors.New(fmt.Sprintf("CommitMetadata out of bounds: %d > %d bytes", len(config.CommitMetadata), maxCommitMetadataSize))
+	}
+
 	return nil
 }
 
@@ -588,6 +1109,11 @@ type ReaderStats struct {
 	FetchSize  SummaryStats  `metric:"kafka.reader.fetch.size"`
 	FetchBytes SummaryStats  `metric:"kafka.reader.fetch.bytes"`
 
+	// PartitionBytes is the number of bytes consumed from each partition by
+	// topic and partition since the last snapshot, only partitions that
+	// messages were read from are present.
+	PartitionBytes map[string]map[int]int64
+
 	Offset        int64         `metric:"kafka.reader.offset"          type:"gauge"`
 	Lag           int64         `metric:"kafka.reader.lag"             type:"gauge"`
 	MinBytes      int64         `metric:"kafka.reader.fetch_bytes.min" type:"gauge"`
@@ -624,6 +1150,24 @@ type readerStats struct {
 	offset     gauge
 	lag        gauge
 	partition  string
+	hook       MetricsHook
+
+	partitionBytes partitionCounter
+}
+
+func (s *readerStats) count(name string, c *counter, v int64, labels MetricLabels) {
+	c.observe(v)
+	countMetric(s.hook, name, v, labels)
+}
+
+func (s *readerStats) observe(name string, m *summary, v int64, labels MetricLabels) {
+	m.observe(v)
+	observeMetric(s.hook, name, v, labels)
+}
+
+func (s *readerStats) observeDuration(name string, m *summary, v time.Duration, labels MetricLabels) {
+	m.observeDuration(v)
+	observeDurationMetric(s.hook, name, v, labels)
 }
 
 // NewReader creates and returns a new Reader configured with config.
@@ -650,6 +1194,10 @@ func NewReader(config ReaderConfig) *Reader {
 		config.MaxBytes = 1e6 // 1 MB
 	}
 
+	if config.MaxRecordBytes == 0 {
+		config.MaxRecordBytes = defaultMaxRecordBytes
+	}
+
 	if config.MinBytes == 0 {
 		config.MinBytes = defaultFetchMinBytes
 	}
@@ -682,9 +1230,10 @@ func NewReader(config ReaderConfig) *Reader {
 		config.MaxAttempts = 3
 	}
 
-	// when configured as a consumer group; stats should report a partition of -1
+	// when configured as a consumer group or with multiple partitions; stats
+	// should report a partition of -1
 	readerStatsPartition := config.Partition
-	if config.GroupID != "" {
+	if config.GroupID != "" || len(config.Partitions) != 0 {
 		readerStatsPartition = -1
 	}
 
@@ -713,9 +1262,31 @@ func NewReader(config ReaderConfig) *Reader {
 			// Generate the string representation of the partition number only
 			// once when the reader is created.
 			partition: strconv.Itoa(readerStatsPartition),
+			hook:      config.MetricsHook,
 		},
 		version: version,
 	}
+	if len(r.config.Partitions) != 0 {
+		r.partitionOffsets = make(map[int]int64, len(r.config.Partitions))
+		for _, partition := range r.config.Partitions {
+			r.partitionOffsets[partition] = FirstOffset
+		}
+	}
+	if r.config.RawBatches {
+		r.batches = newRawBatchPool(rawBatchPoolSize)
+	}
+	if r.config.AckMessages {
+		r.acks = newAckTracker()
+	}
+	if r.config.FetchByBroker {
+		r.client = &Client{
+			Addr: TCP(r.config.Brokers...),
+			Transport: r.config.Dialer.transport(0, 0, func(dialTime time.Duration) {
+				r.stats.dials.observe(1)
+				r.stats.dialTime.observeDuration(dialTime)
+			}),
+		}
+	}
 	if r.useConsumerGroup() {
 		r.done = make(chan struct{})
 		r.runError = make(chan error)
@@ -725,6 +1296,8 @@ func NewReader(config ReaderConfig) *Reader {
 			Dialer:                 r.config.Dialer,
 			Topics:                 r.getTopics(),
 			GroupBalancers:         r.config.GroupBalancers,
+			GroupProtocolUserData:  r.config.GroupProtocolUserData,
+			GroupProtocol:          r.config.GroupProtocol,
 			HeartbeatInterval:      r.config.HeartbeatInterval,
 			PartitionWatchInterval: r.config.PartitionWatchInterval,
 			WatchPartitionChanges:  r.config.WatchPartitionChanges,
@@ -735,6 +1308,7 @@ func NewReader(config ReaderConfig) *Reader {
 			StartOffset:            r.config.StartOffset,
 			Logger:                 r.config.Logger,
 			ErrorLogger:            r.config.ErrorLogger,
+			StructuredLogger:       r.config.StructuredLogger,
 		})
 		if err != nil {
 			panic(err)
@@ -772,6 +1346,16 @@ func (r *Reader) Close() error {
 		close(r.msgs)
 	}
 
+	r.mutex.Lock()
+	r.releaseBatch()
+	r.mutex.Unlock()
+
+	if r.client != nil {
+		if t, ok := r.client.Transport.(*Transport); ok {
+			t.CloseIdleConnections()
+		}
+	}
+
 	return nil
 }
 
@@ -793,7 +1377,11 @@ func (r *Reader) ReadMessage(ctx context.Context) (Message, error) {
 		return Message{}, err
 	}
 
-	if r.useConsumerGroup() {
+	if r.acks != nil {
+		if err := r.Ack(ctx, m); err != nil {
+			return Message{}, err
+		}
+	} else if r.useConsumerGroup() {
 		if err := r.CommitMessages(ctx, m); err != nil {
 			return Message{}, err
 		}
@@ -809,8 +1397,13 @@ func (r *Reader) ReadMessage(ctx context.Context) (Message, error) {
 // The method returns io.EOF to indicate that the reader has been closed.
 //
 // FetchMessage does not commit offsets automatically when using consumer groups.
-// Use CommitMessages to commit the offset.
+// Use CommitMessages to commit the offset, or Ack when the reader is configured
+// with AckMessages.
 func (r *Reader) FetchMessage(ctx context.Context) (Message, error) {
+	if r.config.RawBatches {
+		return Message{}, errRawBatches
+	}
+
 	r.activateReadLag()
 
 	for {
@@ -821,8 +1414,13 @@ func (r *Reader) FetchMessage(ctx context.Context) (Message, error) {
 		}
 
 		version := r.version
+		done := r.rangeDone()
 		r.mutex.Unlock()
 
+		if done {
+			return Message{}, io.EOF
+		}
+
 		select {
 		case <-ctx.Done():
 			return Message{}, ctx.Err()
@@ -836,17 +1434,43 @@ func (r *Reader) FetchMessage(ctx context.Context) (Message, error) {
 			}
 
 			if m.version >= version {
+				if m.caughtUp {
+					if r.markCaughtUp(m, version) {
+						r.config.OnCaughtUp()
+					}
+					continue
+				}
+
+				if m.stopped {
+					r.markStopped(m, version)
+					continue
+				}
+
 				r.mutex.Lock()
 
+				notify := false
 				switch {
 				case m.error != nil:
 				case version == r.version:
 					r.offset = m.message.Offset + 1
 					r.lag = m.watermark - r.offset
+					r.trackLag(m.message.Topic, m.message.Partition, r.offset, m.watermark)
+					notify = r.checkCaughtUp(true)
+				}
+
+				// messages fetched before the reader joined the current
+				// generation are not tracked, their acknowledgement would be
+				// ignored.
+				if m.error == nil && m.version == r.version && r.acks != nil {
+					m.message.generation = r.acks.track(m.message)
 				}
 
 				r.mutex.Unlock()
 
+				if notify {
+					r.config.OnCaughtUp()
+				}
+
 				switch m.error {
 				case nil:
 				case io.EOF:
@@ -863,6 +1487,54 @@ func (r *Reader) FetchMessage(ctx context.Context) (Message, error) {
 	}
 }
 
+// Messages returns a channel delivering the messages read from r, as an
+// alternative to calling FetchMessage in a loop. The channel is buffered with
+// the reader's QueueCapacity.
+//
+// Errors other than the reader being closed or the context being canceled
+// are sent to the error channel, the program must receive from it to keep
+// messages flowing. Both channels are closed when the reader is closed or the
+// context is canceled.
+//
+// Like FetchMessage, messages are not committed automatically when using
+// consumer groups. Mixing calls to Messages with calls to ReadMessage or
+// FetchMessage on the same reader is not supported.
+func (r *Reader) Messages(ctx context.Context) (<-chan Message, <-chan error) {
+	msgs := make(chan Message, r.config.QueueCapacity)
+	errs := make(chan error)
+
+	go func() {
+		defer close(msgs)
+		defer close(errs)
+
+		for {
+			m, err := r.FetchMessage(ctx)
+
+			switch {
+			case err == nil:
+				select {
+				case msgs <- m:
+					continue
+				case <-ctx.Done():
+				case <-r.stctx.Done():
+				}
+			case errors.Is(err, io.EOF), errors.Is(err, ctx.Err()):
+			default:
+				select {
+				case errs <- err:
+					continue
+				case <-ctx.Done():
+				case <-r.stctx.Done():
+				}
+			}
+
+			return
+		}
+	}()
+
+	return msgs, errs
+}
+
 // CommitMessages commits the list of messages passed as argument. The program
 // may pass a context to asynchronously cancel the commit operation when it was
 // configured to be blocking.
@@ -876,14 +1548,40 @@ func (r *Reader) FetchMessage(ctx context.Context) (Message, error) {
 // topic/partition it belonged to forward, effectively committing all previous
 // messages in the partition.
 func (r *Reader) CommitMessages(ctx context.Context, msgs ...Message) error {
+	return r.commitMessages(ctx, commitRequest{commits: makeCommits(msgs...)})
+}
+
+// Commit commits the list of messages passed as argument like CommitMessages,
+// and returns the offsets that were committed, indexed by topic and partition.
+//
+// Because commits of the same partition are coalesced to the highest offset,
+// the committed offset of a partition may be greater than the offset of the
+// messages passed to the method (plus one) if other commits were merged with
+// this one.
+//
+// The method is only available when the reader is configured to commit
+// synchronously (CommitInterval is zero), it returns an error otherwise.
+func (r *Reader) Commit(ctx context.Context, msgs ...Message) (map[string]map[int]int64, error) {
+	if !r.useConsumerGroup() {
+		return nil, errOnlyAvailableWithGroup
+	}
+	if !r.useSyncCommits() {
+		return nil, errors.New("kafka.(*Reader).Commit: committed offsets are only available with synchronous commits")
+	}
+
+	committed := offsetStash{}
+	if err := r.commitMessages(ctx, commitRequest{commits: makeCommits(msgs...), committed: committed}); err != nil {
+		return nil, err
+	}
+	return committed, nil
+}
+
+func (r *Reader) commitMessages(ctx context.Context, creq commitRequest) error {
 	if !r.useConsumerGroup() {
 		return errOnlyAvailableWithGroup
 	}
 
 	var errch <-chan error
-	creq := commitRequest{
-		commits: makeCommits(msgs...),
-	}
 
 	if r.useSyncCommits() {
 		ch := make(chan error, 1)
@@ -928,6 +1626,16 @@ func (r *Reader) ReadLag(ctx context.Context) (lag int64, err error) {
 		return 0, errNotAvailableWithGroup
 	}
 
+	if r.usePartitions() {
+		// The lag of a reader consuming multiple partitions is the sum of the
+		// lags of its partitions.
+		lags, err := r.LagByPartition(ctx)
+		for _, partitionLag := range lags {
+			lag += partitionLag
+		}
+		return lag, err
+	}
+
 	type offsets struct {
 		first int64
 		last  int64
@@ -940,23 +1648,7 @@ func (r *Reader) ReadLag(ctx context.Context) (lag int64, err error) {
 		var off offsets
 		var err error
 
-		for _, broker := range r.config.Brokers {
-			var conn *Conn
-
-			if conn, err = r.config.Dialer.DialLeader(ctx, "tcp", broker, r.config.Topic, r.config.Partition); err != nil {
-				continue
-			}
-
-			deadline, _ := ctx.Deadline()
-			conn.SetDeadline(deadline)
-
-			off.first, off.last, err = conn.ReadOffsets()
-			conn.Close()
-
-			if err == nil {
-				break
-			}
-		}
+		off.first, off.last, err = r.readOffsets(ctx, r.config.Topic, r.config.Partition)
 
 		if err != nil {
 			errch <- err
@@ -985,27 +1677,189 @@ func (r *Reader) ReadLag(ctx context.Context) (lag int64, err error) {
 	return
 }
 
-// Offset returns the current absolute offset of the reader, or -1
-// if r is backed by a consumer group.
-func (r *Reader) Offset() int64 {
-	if r.useConsumerGroup() {
-		return -1
+// LagByPartition returns the lag of each partition read by r, keyed by
+// partition number. The lag of a partition is the difference between its high
+// water mark and the offset of the next message that the reader returns.
+//
+// The high water marks reported by the last fetches of each partition are
+// reused, the method only requests the last offsets of partitions from which no
+// messages were fetched yet. When r is backed by a consumer group, the map
+// contains the partitions currently assigned to the reader, and is empty until
+// the reader joined the group.
+//
+// The method returns an error if r reads more than one topic, since the lags
+// could not be keyed by partition number.
+func (r *Reader) LagByPartition(ctx context.Context) (map[int]int64, error) {
+	if len(r.getTopics()) > 1 {
+		return nil, errors.New("kafka.(*Reader).LagByPartition: cannot report the lag of partitions when reading multiple topics")
 	}
 
 	r.mutex.Lock()
-	offset := r.offset
+	positions := make(map[topicPartition]partitionLag, len(r.partitionLags))
+	if r.version == 0 && !r.useConsumerGroup() {
+		// The reader did not start yet, its position is the configured
+		// offset.
+		for key, offset := range r.getTopicPartitionOffset() {
+			positions[key] = partitionLag{offset: offset, watermark: -1}
+		}
+	}
+	for key, lag := range r.partitionLags {
+		positions[key] = lag
+	}
 	r.mutex.Unlock()
-	r.withLogger(func(log Logger) {
-		log.Printf("looking up offset of kafka reader for partition %d of %s: %d", r.config.Partition, r.config.Topic, offset)
-	})
-	return offset
-}
 
-// Lag returns the lag of the last message returned by ReadMessage, or -1
-// if r is backed by a consumer group.
-func (r *Reader) Lag() int64 {
-	if r.useConsumerGroup() {
-		return -1
+	lags := make(map[int]int64, len(positions))
+
+	for key, pos := range positions {
+		if pos.watermark >= 0 && pos.offset >= 0 {
+			lags[int(key.partition)] = pos.watermark - pos.offset
+			continue
+		}
+
+		first, last, err := r.readOffsets(ctx, key.topic, int(key.partition))
+		if err != nil {
+			return nil, fmt.Errorf("kafka.(*Reader).LagByPartition: reading offsets of partition %d of %s: %w", key.partition, key.topic, err)
+		}
+
+		switch pos.offset {
+		case FirstOffset:
+			lags[int(key.partition)] = last - first
+		case LastOffset:
+			lags[int(key.partition)] = 0
+		default:
+			lags[int(key.partition)] = last - pos.offset
+		}
+	}
+
+	return lags, nil
+}
+
+// readOffsets returns the first and last offsets of a partition, trying the
+// brokers of the reader configuration until one succeeds.
+func (r *Reader) readOffsets(ctx context.Context, topic string, partition int) (first, last int64, err error) {
+	for _, broker := range r.config.Brokers {
+		var conn *Conn
+
+		if conn, err = r.config.Dialer.DialLeader(ctx, "tcp", broker, topic, partition); err != nil {
+			continue
+		}
+
+		deadline, _ := ctx.Deadline()
+		conn.SetDeadline(deadline)
+
+		first, last, err = conn.ReadOffsets()
+		conn.Close()
+
+		if err == nil {
+			break
+		}
+	}
+	return
+}
+
+// trackLag records the position of the reader in a partition, and the high
+// water mark of the partition, the mutex must be held.
+func (r *Reader) trackLag(topic string, partition int, offset, watermark int64) {
+	key := topicPartition{topic: topic, partition: int32(partition)}
+	if _, ok := r.partitionLags[key]; ok {
+		r.partitionLags[key] = partitionLag{offset: offset, watermark: watermark}
+	}
+	if _, ok := r.partitionOffsets[partition]; ok {
+		r.partitionOffsets[partition] = offset
+	}
+}
+
+// checkCaughtUp reports whether the reader just reached the high water mark of
+// all its partitions, in which case config.OnCaughtUp must be called. Messages
+// are only received when the reader was behind, so received re-arms the
+// notification. The mutex must be held.
+func (r *Reader) checkCaughtUp(received bool) bool {
+	if r.config.OnCaughtUp == nil {
+		return false
+	}
+	if received {
+		r.caughtUp = false
+	}
+
+	caughtUp := len(r.partitionLags) != 0
+	for _, lag := range r.partitionLags {
+		if lag.watermark < 0 || lag.offset < lag.watermark {
+			caughtUp = false
+			break
+		}
+	}
+
+	notify := caughtUp && !r.caughtUp
+	r.caughtUp = caughtUp
+	return notify
+}
+
+// markCaughtUp records the position of the reader in the partition of a marker
+// sent when a partition reader reached the end of the partition, and reports
+// whether config.OnCaughtUp must be called.
+func (r *Reader) markCaughtUp(m readerMessage, version int64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if version != r.version {
+		return false
+	}
+	r.trackLag(m.message.Topic, m.message.Partition, m.message.Offset, m.watermark)
+	return r.checkCaughtUp(false)
+}
+
+// markStopped records that the partition of a marker sent when a partition
+// reader reached the end of its range of messages is done.
+func (r *Reader) markStopped(m readerMessage, version int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if version != r.version {
+		return
+	}
+	r.trackLag(m.message.Topic, m.message.Partition, m.message.Offset, m.watermark)
+	if r.stopped == nil {
+		r.stopped = make(map[topicPartition]bool)
+	}
+	r.stopped[topicPartition{topic: m.message.Topic, partition: int32(m.message.Partition)}] = true
+}
+
+// rangeDone reports whether all the partitions of the reader reached the end
+// of the range configured by config.StopAtOffset or config.StopAtTime. The
+// mutex must be held.
+func (r *Reader) rangeDone() bool {
+	if len(r.partitionLags) == 0 {
+		return false
+	}
+	for key := range r.partitionLags {
+		if !r.stopped[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// Offset returns the current absolute offset of the reader, or -1
+// if r is backed by a consumer group.
+func (r *Reader) Offset() int64 {
+	if r.useConsumerGroup() {
+		return -1
+	}
+
+	r.mutex.Lock()
+	offset := r.offset
+	r.mutex.Unlock()
+	r.log().debug(r.stctx, "looking up offset of kafka reader",
+		logAttrs{"topic", r.config.Topic, "partition", r.config.Partition, "offset", offset},
+		"looking up offset of kafka reader for partition %d of %s: %d", r.config.Partition, r.config.Topic, offset)
+	return offset
+}
+
+// Lag returns the lag of the last message returned by ReadMessage, or -1
+// if r is backed by a consumer group.
+func (r *Reader) Lag() int64 {
+	if r.useConsumerGroup() {
+		return -1
 	}
 
 	r.mutex.Lock()
@@ -1032,11 +1886,24 @@ func (r *Reader) SetOffset(offset int64) error {
 
 	if r.closed {
 		err = io.ErrClosedPipe
+	} else if r.usePartitions() {
+		r.log().debug(r.stctx, "setting the offset of the kafka reader",
+			logAttrs{"topic", r.config.Topic, "partitions", r.config.Partitions, "offset", offset},
+			"setting the offset of the kafka reader for partitions %v of %s to %d", r.config.Partitions, r.config.Topic, offset)
+		r.offset = offset
+		for partition := range r.partitionOffsets {
+			r.partitionOffsets[partition] = offset
+		}
+
+		if r.version != 0 {
+			r.start(r.getTopicPartitionOffset())
+		}
+
+		r.activateReadLag()
 	} else if offset != r.offset {
-		r.withLogger(func(log Logger) {
-			log.Printf("setting the offset of the kafka reader for partition %d of %s from %d to %d",
-				r.config.Partition, r.config.Topic, r.offset, offset)
-		})
+		r.log().debug(r.stctx, "setting the offset of the kafka reader",
+			logAttrs{"topic", r.config.Topic, "partition", r.config.Partition, "from", r.offset, "offset", offset},
+			"setting the offset of the kafka reader for partition %d of %s from %d to %d", r.config.Partition, r.config.Topic, r.offset, offset)
 		r.offset = offset
 
 		if r.version != 0 {
@@ -1063,8 +1930,30 @@ func (r *Reader) SetOffsetAt(ctx context.Context, t time.Time) error {
 	}
 	r.mutex.Unlock()
 
+	if r.usePartitions() {
+		offsets := make(map[int]int64, len(r.config.Partitions))
+		for _, partition := range r.config.Partitions {
+			offset, err := r.readOffsetAt(ctx, partition, t)
+			if err != nil {
+				return err
+			}
+			offsets[partition] = offset
+		}
+		return r.setPartitionOffsets(offsets)
+	}
+
+	offset, err := r.readOffsetAt(ctx, r.config.Partition, t)
+	if err != nil {
+		return err
+	}
+	return r.SetOffset(offset)
+}
+
+// readOffsetAt returns the offset of the first message of the partition with a
+// timestamp greater or equal to t.
+func (r *Reader) readOffsetAt(ctx context.Context, partition int, t time.Time) (int64, error) {
 	for _, broker := range r.config.Brokers {
-		conn, err := r.config.Dialer.DialLeader(ctx, "tcp", broker, r.config.Topic, r.config.Partition)
+		conn, err := r.config.Dialer.DialLeader(ctx, "tcp", broker, r.config.Topic, partition)
 		if err != nil {
 			continue
 		}
@@ -1073,13 +1962,112 @@ func (r *Reader) SetOffsetAt(ctx context.Context, t time.Time) error {
 		conn.SetDeadline(deadline)
 		offset, err := conn.ReadOffset(t)
 		conn.Close()
-		if err != nil {
-			return err
-		}
+		return offset, err
+	}
+	return 0, fmt.Errorf("error setting offset for timestamp %+v", t)
+}
 
+// SetPartitionOffset changes the offset from which the next batch of messages
+// of a partition will be read, like SetOffset. The partition must be one of the
+// partitions read by the reader.
+//
+// The method fails with io.ErrClosedPipe if the reader has already been closed.
+func (r *Reader) SetPartitionOffset(partition int, offset int64) error {
+	if r.useConsumerGroup() {
+		return errNotAvailableWithGroup
+	}
+	if !r.usePartitions() {
+		if partition != r.config.Partition {
+			return fmt.Errorf("kafka.(*Reader).SetPartitionOffset: partition %d is not read by the reader", partition)
+		}
 		return r.SetOffset(offset)
 	}
-	return fmt.Errorf("error setting offset for timestamp %+v", t)
+	return r.setPartitionOffsets(map[int]int64{partition: offset})
+}
+
+func (r *Reader) setPartitionOffsets(offsets map[int]int64) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return io.ErrClosedPipe
+	}
+
+	for partition := range offsets {
+		if _, ok := r.partitionOffsets[partition]; !ok {
+			return fmt.Errorf("kafka.(*Reader).SetPartitionOffset: partition %d is not read by the reader", partition)
+		}
+	}
+
+	for partition, offset := range offsets {
+		r.log().debug(r.stctx, "setting the offset of the kafka reader",
+			logAttrs{"topic", r.config.Topic, "partition", partition, "from", r.partitionOffsets[partition], "offset", offset},
+			"setting the offset of the kafka reader for partition %d of %s from %d to %d", partition, r.config.Topic, r.partitionOffsets[partition], offset)
+		r.partitionOffsets[partition] = offset
+	}
+
+	if r.version != 0 {
+		r.start(r.getTopicPartitionOffset())
+	}
+
+	r.activateReadLag()
+	return nil
+}
+
+// PartitionOffsets returns the offsets of the next messages that the reader
+// reads from each partition, keyed by partition number. The offsets may be
+// FirstOffset or LastOffset for partitions from which no messages were read.
+//
+// The method returns nil if r is backed by a consumer group.
+func (r *Reader) PartitionOffsets() map[int]int64 {
+	if r.useConsumerGroup() {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.usePartitions() {
+		return map[int]int64{r.config.Partition: r.offset}
+	}
+
+	offsets := make(map[int]int64, len(r.partitionOffsets))
+	for partition, offset := range r.partitionOffsets {
+		offsets[partition] = offset
+	}
+	return offsets
+}
+
+// GroupMembership describes the membership of a reader in its consumer group.
+type GroupMembership struct {
+	// GroupID is the name of the consumer group.
+	GroupID string
+
+	// GenerationID is the generation of the consumer group, it changes on each
+	// rebalance.
+	GenerationID int32
+
+	// MemberID is the ID assigned to the reader by the group coordinator.
+	MemberID string
+
+	// IsLeader is true if the reader was elected leader of the consumer group
+	// for the generation.
+	IsLeader bool
+}
+
+// Membership returns the membership of r in the current generation of its
+// consumer group. The values remain the same until the next rebalance.
+//
+// The method returns a zero GroupMembership while the reader is not part of a
+// generation, before it first joined the group or while the group rebalances.
+// It fails with an error if the reader is not configured with a GroupID.
+func (r *Reader) Membership() (GroupMembership, error) {
+	if !r.useConsumerGroup() {
+		return GroupMembership{}, errOnlyAvailableWithGroup
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.membership, nil
 }
 
 // Stats returns a snapshot of the reader stats since the last time the method
@@ -1114,27 +2102,60 @@ func (r *Reader) Stats() ReaderStats {
 		Topic:         r.config.Topic,
 		Partition:     r.stats.partition,
 	}
+	stats.PartitionBytes = r.stats.partitionBytes.snapshot()
 	// TODO: remove when we get rid of the deprecated field.
 	stats.DeprecatedFetchesWithTypo = stats.Fetches
 	return stats
 }
 
 func (r *Reader) getTopicPartitionOffset() map[topicPartition]int64 {
+	if r.usePartitions() {
+		offsets := make(map[topicPartition]int64, len(r.partitionOffsets))
+		for partition, offset := range r.partitionOffsets {
+			offsets[topicPartition{topic: r.config.Topic, partition: int32(partition)}] = offset
+		}
+		return offsets
+	}
 	key := topicPartition{topic: r.config.Topic, partition: int32(r.config.Partition)}
 	return map[topicPartition]int64{key: r.offset}
 }
 
-func (r *Reader) withLogger(do func(Logger)) {
-	if r.config.Logger != nil {
-		do(r.config.Logger)
+// partitionMaxBytes returns the maximum number of bytes to fetch for each
+// partition, which is never more than MaxBytes when partitions are fetched
+// independently.
+func (r *Reader) partitionMaxBytes() int {
+	if n := r.config.PartitionMaxBytes; n > 0 && (r.config.FetchByBroker || n < r.config.MaxBytes) {
+		return n
 	}
+	return r.config.MaxBytes
 }
 
-func (r *Reader) withErrorLogger(do func(Logger)) {
-	if r.config.ErrorLogger != nil {
-		do(r.config.ErrorLogger)
-	} else {
-		r.withLogger(do)
+// pausedPartition returns a channel which is closed once fetching the
+// partition may resume, or nil if fetching the partition is not paused. The
+// partitions are paused while ConsumePartitions is running and the buffers of
+// their consumers are full.
+func (r *Reader) pausedPartition(key topicPartition) <-chan struct{} {
+	r.mutex.Lock()
+	d := r.dispatcher
+	r.mutex.Unlock()
+
+	if d == nil {
+		return nil
+	}
+	return d.paused(key)
+}
+
+// metricLabels returns the labels of metrics which are not specific to a
+// partition.
+func (r *Reader) metricLabels() MetricLabels {
+	return MetricLabels{Topic: r.config.Topic, Partition: -1}
+}
+
+func (r *Reader) log() logger {
+	return logger{
+		logger:      r.config.Logger,
+		errorLogger: r.config.ErrorLogger,
+		structured:  r.config.StructuredLogger,
 	}
 }
 
@@ -1159,9 +2180,9 @@ func (r *Reader) readLag(ctx context.Context) {
 
 		if err != nil {
 			r.stats.errors.observe(1)
-			r.withErrorLogger(func(log Logger) {
-				log.Printf("kafka reader failed to read lag of partition %d of %s: %s", r.config.Partition, r.config.Topic, err)
-			})
+			r.log().error(ctx, "kafka reader failed to read lag",
+				logAttrs{"topic", r.config.Topic, "partition", r.config.Partition, "error", err},
+				"kafka reader failed to read lag of partition %d of %s: %s", r.config.Partition, r.config.Topic, err)
 		} else {
 			r.stats.lag.observe(lag)
 		}
@@ -1186,6 +2207,50 @@ func (r *Reader) start(offsetsByPartition map[topicPartition]int64) {
 	r.cancel = cancel
 	r.version++
 
+	r.partitionLags = make(map[topicPartition]partitionLag, len(offsetsByPartition))
+	r.caughtUp = false
+	r.stopped = nil
+	for key, offset := range offsetsByPartition {
+		r.partitionLags[key] = partitionLag{offset: offset, watermark: -1}
+	}
+
+	if r.dispatcher != nil {
+		r.dispatcher.assign(offsetsByPartition)
+	}
+
+	if r.config.FetchByBroker {
+		r.join.Add(1)
+		go func(ctx context.Context, offsets map[topicPartition]int64, join *sync.WaitGroup) {
+			defer join.Done()
+
+			(&fetcher{
+				client:            r.client,
+				log:               r.log(),
+				minBytes:          r.config.MinBytes,
+				maxBytes:          r.config.MaxBytes,
+				partitionMaxBytes: r.partitionMaxBytes(),
+				maxWait:           r.config.MaxWait,
+				backoffDelayMin:   r.config.ReadBackoffMin,
+				backoffDelayMax:   r.config.ReadBackoffMax,
+				version:           r.version,
+				msgs:              r.msgs,
+				stats:             r.stats,
+				isolationLevel:    r.config.IsolationLevel,
+				maxAttempts:       r.config.MaxAttempts,
+				waitForTopic:      r.config.WaitForTopic,
+				offsetReset:       r.config.OffsetOutOfRangeReset,
+				rackID:            r.config.RackID,
+				maxLag:            r.config.MaxLag,
+				onMaxLag:          r.config.OnMaxLag,
+				notifyCaughtUp:    r.config.OnCaughtUp != nil,
+				stopAtOffset:      r.config.StopAtOffset,
+				stopAtTime:        r.config.StopAtTime,
+				paused:            r.pausedPartition,
+			}).run(ctx, offsets)
+		}(ctx, offsetsByPartition, &r.join)
+		return
+	}
+
 	r.join.Add(len(offsetsByPartition))
 	for key, offset := range offsetsByPartition {
 		go func(ctx context.Context, key topicPartition, offset int64, join *sync.WaitGroup) {
@@ -1193,13 +2258,13 @@ func (r *Reader) start(offsetsByPartition map[topicPartition]int64) {
 
 			(&reader{
 				dialer:          r.config.Dialer,
-				logger:          r.config.Logger,
-				errorLogger:     r.config.ErrorLogger,
+				log:             r.log(),
 				brokers:         r.config.Brokers,
 				topic:           key.topic,
 				partition:       int(key.partition),
 				minBytes:        r.config.MinBytes,
-				maxBytes:        r.config.MaxBytes,
+				maxBytes:        r.partitionMaxBytes(),
+				maxRecordBytes:  r.config.MaxRecordBytes,
 				maxWait:         r.config.MaxWait,
 				backoffDelayMin: r.config.ReadBackoffMin,
 				backoffDelayMax: r.config.ReadBackoffMax,
@@ -1208,6 +2273,20 @@ func (r *Reader) start(offsetsByPartition map[topicPartition]int64) {
 				stats:           r.stats,
 				isolationLevel:  r.config.IsolationLevel,
 				maxAttempts:     r.config.MaxAttempts,
+				waitForTopic:    r.config.WaitForTopic,
+				offsetReset:     r.config.OffsetOutOfRangeReset,
+				rawBatches:      r.config.RawBatches,
+				batches:         r.batches,
+				maxLag:          r.config.MaxLag,
+				onMaxLag:        r.config.OnMaxLag,
+				detectTrunc:     r.config.DetectTruncation,
+				controlRecords:  r.config.ControlRecords,
+				onTruncation:    r.config.OnTruncation,
+				notifyCaughtUp:  r.config.OnCaughtUp != nil,
+				stopAtOffset:    r.config.StopAtOffset,
+				stopAtTime:      r.config.StopAtTime,
+				paused:          r.pausedPartition,
+				leaderEpoch:     -1,
 			}).run(ctx, offset)
 		}(ctx, key, offset, &r.join)
 	}
@@ -1218,13 +2297,13 @@ func (r *Reader) start(offsetsByPartition map[topicPartition]int64) {
 // them using the high level reader API.
 type reader struct {
 	dialer          *Dialer
-	logger          Logger
-	errorLogger     Logger
+	log             logger
 	brokers         []string
 	topic           string
 	partition       int
 	minBytes        int
 	maxBytes        int
+	maxRecordBytes  int
 	maxWait         time.Duration
 	backoffDelayMin time.Duration
 	backoffDelayMax time.Duration
@@ -1233,13 +2312,90 @@ type reader struct {
 	stats           *readerStats
 	isolationLevel  IsolationLevel
 	maxAttempts     int
+	waitForTopic    time.Duration
+	offsetReset     OffsetResetPolicy
+	rawBatches      bool
+	batches         chan *RawBatch
+	maxLag          int64
+	onMaxLag        func(string, int, int64)
+	detectTrunc     bool
+	controlRecords  bool
+	onTruncation    func(string, int, int64, int64)
+	notifyCaughtUp  bool
+	stopAtOffset    int64
+	stopAtTime      time.Time
+	// returns a channel closed once fetching the partition may resume, or nil
+	// if it is not paused, see Reader.pausedPartition.
+	paused func(topicPartition) <-chan struct{}
+	// end of the range of messages read from the partition, resolved when the
+	// reader is first initialized. The offset is only set when bounded is true,
+	// the range is unbounded otherwise.
+	stopOffset int64
+	bounded    bool
+	// whether a caught up marker was sent since the reader last fell behind
+	// the high water mark, see sendCaughtUp.
+	caughtUp bool
+	// leader epoch of the last message consumed, -1 when unknown.
+	leaderEpoch int32
+	// size of the fetches when it was increased to read a record larger
+	// than maxBytes, zero otherwise.
+	fetchBytes int
+}
+
+// topicWait tracks how long the topic of a reader has been missing, so the
+// reader can keep retrying while the topic is deleted and recreated.
+type topicWait struct {
+	timeout time.Duration
+	since   time.Time // zero while the topic exists
+}
+
+// missing reports whether err indicates that the topic does not exist and the
+// reader should keep waiting for it instead of reporting the error.
+func (w *topicWait) missing(err error) bool {
+	if w.timeout <= 0 || !errors.Is(err, UnknownTopicOrPartition) {
+		return false
+	}
+	if w.since.IsZero() {
+		w.since = time.Now()
+	}
+	return !w.expired()
+}
+
+// expired reports whether the topic has been missing for longer than the
+// timeout.
+func (w *topicWait) expired() bool {
+	return !w.since.IsZero() && time.Since(w.since) >= w.timeout
+}
+
+// context returns a context which is canceled when the reader stops waiting
+// for the topic, assuming that it starts missing now if it was not already.
+func (w *topicWait) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if w.timeout <= 0 {
+		return ctx, func() {}
+	}
+	since := w.since
+	if since.IsZero() {
+		since = time.Now()
+	}
+	return context.WithDeadline(ctx, since.Add(w.timeout))
+}
+
+func (w *topicWait) found() {
+	w.since = time.Time{}
 }
 
 type readerMessage struct {
 	version   int64
 	message   Message
+	batch     *RawBatch
 	watermark int64
 	error     error
+	// set on markers sent when a partition reader reached the high water
+	// mark, the message holds the topic, partition, and offset reached.
+	caughtUp bool
+	// set on markers sent when a partition reader reached the end of its
+	// range of messages, the message is set like on caught up markers.
+	stopped bool
 }
 
 func (r *reader) run(ctx context.Context, offset int64) {
@@ -1252,6 +2408,12 @@ func (r *reader) run(ctx context.Context, offset int64) {
 	// be surfaced to the program.
 	// If the reader wasn't retrying then the program would block indefinitely
 	// on a Read call after reading the first error.
+	wait := topicWait{timeout: r.waitForTopic}
+
+	// Counts the consecutive leader epoch errors, which are retried across
+	// reconnections to the partition leader.
+	epochErrors := 0
+
 	for attempt := 0; true; attempt++ {
 		if attempt != 0 {
 			if !sleep(ctx, backoff(attempt, r.backoffDelayMin, r.backoffDelayMax)) {
@@ -1259,33 +2421,57 @@ func (r *reader) run(ctx context.Context, offset int64) {
 			}
 		}
 
-		r.withLogger(func(log Logger) {
-			log.Printf("initializing kafka reader for partition %d of %s starting at offset %d", r.partition, r.topic, offset)
-		})
+		r.log.debug(ctx, "initializing kafka reader",
+			logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset},
+			"initializing kafka reader for partition %d of %s starting at offset %d", r.partition, r.topic, offset)
+
+		// Looking up the leader of a missing partition is retried until the
+		// context is canceled, stop once the reader is done waiting for it.
+		t0 := time.Now()
+		initCtx, cancelInit := wait.context(ctx)
+		conn, start, err := r.initialize(initCtx, offset)
+		cancelInit()
+		if err != nil && ctx.Err() == nil && initCtx.Err() != nil {
+			if wait.since.IsZero() {
+				wait.since = t0
+			}
+			err = fmt.Errorf("partition %d of %s not available after %s: %w", r.partition, r.topic, r.waitForTopic, UnknownTopicOrPartition)
+		}
 
-		conn, start, err := r.initialize(ctx, offset)
 		switch err {
 		case nil:
 		case OffsetOutOfRange:
+			if r.offsetReset == OffsetResetError {
+				r.sendError(ctx, err)
+				continue
+			}
 			// This would happen if the requested offset is passed the last
 			// offset on the partition leader. In that case we're just going
 			// to retry later hoping that enough data has been produced.
-			r.withErrorLogger(func(log Logger) {
-				log.Printf("error initializing the kafka reader for partition %d of %s: %s", r.partition, r.topic, OffsetOutOfRange)
-			})
+			r.log.error(ctx, "error initializing the kafka reader",
+				logAttrs{"topic", r.topic, "partition", r.partition, "error", OffsetOutOfRange},
+				"error initializing the kafka reader for partition %d of %s: %s", r.partition, r.topic, OffsetOutOfRange)
 			continue
 		default:
+			// The topic may be in the process of being recreated, keep
+			// waiting for it to exist until the timeout expires.
+			if wait.missing(err) {
+				r.log.error(ctx, "waiting for partition to exist",
+					logAttrs{"topic", r.topic, "partition", r.partition, "error", err},
+					"waiting for partition %d of %s to exist: %s", r.partition, r.topic, err)
+				continue
+			}
 			// Perform a configured number of attempts before
 			// reporting first errors, this helps mitigate
 			// situations where the kafka server is temporarily
 			// unavailable.
-			if attempt >= r.maxAttempts {
+			if attempt >= r.maxAttempts || wait.expired() {
 				r.sendError(ctx, err)
 			} else {
-				r.stats.errors.observe(1)
-				r.withErrorLogger(func(log Logger) {
-					log.Printf("error initializing the kafka reader for partition %d of %s: %s", r.partition, r.topic, err)
-				})
+				r.stats.count("kafka.reader.error.count", &r.stats.errors, 1, r.metricLabels())
+				r.log.error(ctx, "error initializing the kafka reader",
+					logAttrs{"topic", r.topic, "partition", r.partition, "error", err},
+					"error initializing the kafka reader for partition %d of %s: %s", r.partition, r.topic, err)
 			}
 			continue
 		}
@@ -1294,6 +2480,7 @@ func (r *reader) run(ctx context.Context, offset int64) {
 		// a successful initialization we don't keep increasing the backoff
 		// timeout.
 		attempt = 0
+		wait.found()
 
 		// Now we're sure to have an absolute offset number, may anything happen
 		// to the connection we know we'll want to restart from this offset.
@@ -1307,76 +2494,122 @@ func (r *reader) run(ctx context.Context, offset int64) {
 				return
 			}
 
+			if !r.waitResume(ctx) {
+				conn.Close()
+				return
+			}
+
+			if r.bounded && offset >= r.stopOffset {
+				r.log.debug(ctx, "the kafka reader reached the end of its range",
+					logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset},
+					"the kafka reader for partition %d of %s reached the end of its range at offset %d", r.partition, r.topic, offset)
+				conn.Close()
+				r.sendStopped(ctx, offset)
+				return
+			}
+
 			switch offset, err = r.read(ctx, offset, conn); err {
 			case nil:
-				errcount = 0
+				errcount, epochErrors = 0, 0
 				continue
 			case io.EOF:
 				// done with this batch of messages...carry on.  note that this
 				// block relies on the batch repackaging real io.EOF errors as
 				// io.UnexpectedEOF.  otherwise, we would end up swallowing real
 				// errors here.
-				errcount = 0
+				errcount, epochErrors = 0, 0
 				continue
 			case UnknownTopicOrPartition:
-				r.withErrorLogger(func(log Logger) {
-					log.Printf("failed to read from current broker for partition %d of %s at offset %d, topic or parition not found on this broker, %v", r.partition, r.topic, offset, r.brokers)
-				})
+				wait.missing(err)
+				r.log.error(ctx, "failed to read from current broker, topic or partition not found on this broker",
+					logAttrs{"brokers", r.brokers, "topic", r.topic, "partition", r.partition, "offset", offset},
+					"failed to read from current broker for partition %d of %s at offset %d, topic or parition not found on this broker, %v", r.partition, r.topic, offset, r.brokers)
 
 				conn.Close()
 
 				// The next call to .initialize will re-establish a connection to the proper
 				// topic/partition broker combo.
-				r.stats.rebalances.observe(1)
+				r.stats.count("kafka.reader.rebalance.count", &r.stats.rebalances, 1, r.metricLabels())
 				break readLoop
 			case NotLeaderForPartition:
-				r.withErrorLogger(func(log Logger) {
-					log.Printf("failed to read from current broker for partition %d of %s at offset %d, not the leader", r.partition, r.topic, offset)
-				})
+				r.log.error(ctx, "failed to read from current broker, not the leader",
+					logAttrs{"broker", conn.RemoteAddr(), "topic", r.topic, "partition", r.partition, "offset", offset},
+					"failed to read from current broker for partition %d of %s at offset %d, not the leader", r.partition, r.topic, offset)
 
 				conn.Close()
 
 				// The next call to .initialize will re-establish a connection to the proper
 				// partition leader.
-				r.stats.rebalances.observe(1)
+				r.stats.count("kafka.reader.rebalance.count", &r.stats.rebalances, 1, r.metricLabels())
+				break readLoop
+
+			case FencedLeaderEpoch, UnknownLeaderEpoch:
+				// The broker does not agree with the leader epoch of the partition,
+				// which happens while the leadership moves to another broker. The
+				// next call to .initialize looks up the leader in fresh metadata,
+				// the error is only reported if it persists after MaxAttempts.
+				epochErrors++
+				if epochErrors >= r.maxAttempts {
+					epochErrors = 0
+					r.sendError(ctx, err)
+				} else {
+					r.log.error(ctx, "failed to read from current broker, the leader epoch changed",
+						logAttrs{"broker", conn.RemoteAddr(), "topic", r.topic, "partition", r.partition, "offset", offset, "error", err},
+						"failed to read from current broker for partition %d of %s at offset %d, the leader epoch changed: %s", r.partition, r.topic, offset, err)
+				}
+
+				conn.Close()
+
+				r.stats.count("kafka.reader.rebalance.count", &r.stats.rebalances, 1, r.metricLabels())
 				break readLoop
 
 			case RequestTimedOut:
 				// Timeout on the kafka side, this can be safely retried.
 				errcount = 0
-				r.withLogger(func(log Logger) {
-					log.Printf("no messages received from kafka within the allocated time for partition %d of %s at offset %d", r.partition, r.topic, offset)
-				})
+				r.log.debug(ctx, "no messages received from kafka within the allocated time",
+					logAttrs{"broker", conn.RemoteAddr(), "topic", r.topic, "partition", r.partition, "offset", offset},
+					"no messages received from kafka within the allocated time for partition %d of %s at offset %d", r.partition, r.topic, offset)
 				r.stats.timeouts.observe(1)
 				continue
 
 			case OffsetOutOfRange:
 				first, last, err := r.readOffsets(conn)
 				if err != nil {
-					r.withErrorLogger(func(log Logger) {
-						log.Printf("the kafka reader got an error while attempting to determine whether it was reading before the first offset or after the last offset of partition %d of %s: %s", r.partition, r.topic, err)
-					})
+					r.log.error(ctx, "the kafka reader got an error while attempting to determine whether it was reading before the first offset or after the last offset",
+						logAttrs{"broker", conn.RemoteAddr(), "topic", r.topic, "partition", r.partition, "offset", offset, "error", err},
+						"the kafka reader got an error while attempting to determine whether it was reading before the first offset or after the last offset of partition %d of %s: %s", r.partition, r.topic, err)
 					conn.Close()
 					break readLoop
 				}
 
-				switch {
-				case offset < first:
-					r.withErrorLogger(func(log Logger) {
-						log.Printf("the kafka reader is reading before the first offset for partition %d of %s, skipping from offset %d to %d (%d messages)", r.partition, r.topic, offset, first, first-offset)
-					})
-					offset, errcount = first, 0
-					continue // retry immediately so we don't keep falling behind due to the backoff
-
-				case offset < last:
+				if offset >= first && offset < last {
 					errcount = 0
 					continue // more messages have already become available, retry immediately
+				}
+
+				reset, err := r.resetOffset(offset, first, last)
+				switch {
+				case err != nil:
+					r.sendError(ctx, err)
+
+				case reset != offset:
+					if offset < first {
+						r.log.error(ctx, "the kafka reader is reading before the first offset, skipping messages",
+							logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset, "reset", reset, "skipped", reset - offset},
+							"the kafka reader is reading before the first offset for partition %d of %s, skipping from offset %d to %d (%d messages)", r.partition, r.topic, offset, reset, reset-offset)
+					} else {
+						r.log.error(ctx, "the kafka reader is reading passed the last offset, resetting",
+							logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset, "reset", reset},
+							"the kafka reader is reading passed the last offset for partition %d of %s, resetting from offset %d to %d", r.partition, r.topic, offset, reset)
+					}
+					offset, errcount = reset, 0
+					continue // retry immediately so we don't keep falling behind due to the backoff
 
 				default:
 					// We may be reading past the last offset, will retry later.
-					r.withErrorLogger(func(log Logger) {
-						log.Printf("the kafka reader is reading passed the last offset for partition %d of %s at offset %d", r.partition, r.topic, offset)
-					})
+					r.log.error(ctx, "the kafka reader is reading passed the last offset",
+						logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset},
+						"the kafka reader is reading passed the last offset for partition %d of %s at offset %d", r.partition, r.topic, offset)
 				}
 
 			case context.Canceled:
@@ -1384,21 +2617,26 @@ func (r *reader) run(ctx context.Context, offset int64) {
 				conn.Close()
 				return
 
-			case errUnknownCodec:
-				// The compression codec is either unsupported or has not been
-				// imported.  This is a fatal error b/c the reader cannot
-				// proceed.
-				r.sendError(ctx, err)
-				break readLoop
-
 			default:
-				if _, ok := err.(Error); ok {
+				if errors.Is(err, errUnknownCodec) {
+					// The compression codec is either unsupported or has not
+					// been imported.  This is a fatal error b/c the reader
+					// cannot proceed.
+					r.sendError(ctx, err)
+					break readLoop
+				}
+				var tooLarge RecordTooLargeError
+				if errors.As(err, &tooLarge) {
+					// The record cannot be read with the largest fetch, the
+					// error is reported and the fetch retried with a backoff.
+					r.sendError(ctx, err)
+				} else if _, ok := err.(Error); ok {
 					r.sendError(ctx, err)
 				} else {
-					r.withErrorLogger(func(log Logger) {
-						log.Printf("the kafka reader got an unknown error reading partition %d of %s at offset %d: %s", r.partition, r.topic, offset, err)
-					})
-					r.stats.errors.observe(1)
+					r.log.error(ctx, "the kafka reader got an unknown error",
+						logAttrs{"broker", conn.RemoteAddr(), "topic", r.topic, "partition", r.partition, "offset", offset, "error", err},
+						"the kafka reader got an unknown error reading partition %d of %s at offset %d: %s", r.partition, r.topic, offset, err)
+					r.stats.count("kafka.reader.error.count", &r.stats.errors, 1, r.metricLabels())
 					conn.Close()
 					break readLoop
 				}
@@ -1430,6 +2668,23 @@ func (r *reader) initialize(ctx context.Context, offset int64) (conn *Conn, star
 			break
 		}
 
+		if !r.bounded {
+			if r.stopOffset, r.bounded, err = r.resolveStop(conn, last); err != nil {
+				conn.Close()
+				conn = nil
+				break
+			}
+		}
+
+		// The log must be validated before the offset is compared to the
+		// range of the partition, a truncation would otherwise be handled
+		// by the offset reset policy.
+		if offset, err = r.validateOffset(conn, offset); err != nil {
+			conn.Close()
+			conn = nil
+			break
+		}
+
 		switch {
 		case offset == FirstOffset:
 			offset = first
@@ -1437,13 +2692,19 @@ func (r *reader) initialize(ctx context.Context, offset int64) (conn *Conn, star
 		case offset == LastOffset:
 			offset = last
 
-		case offset < first:
-			offset = first
+		case offset < first || offset > last:
+			offset, err = r.resetOffset(offset, first, last)
 		}
 
-		r.withLogger(func(log Logger) {
-			log.Printf("the kafka reader for partition %d of %s is seeking to offset %d", r.partition, r.topic, offset)
-		})
+		if err != nil {
+			conn.Close()
+			conn = nil
+			break
+		}
+
+		r.log.debug(ctx, "the kafka reader is seeking to offset",
+			logAttrs{"broker", conn.RemoteAddr(), "topic", r.topic, "partition", r.partition, "offset", offset},
+			"the kafka reader for partition %d of %s is seeking to offset %d", r.partition, r.topic, offset)
 
 		if start, err = conn.Seek(offset, SeekAbsolute); err != nil {
 			conn.Close()
@@ -1457,22 +2718,45 @@ func (r *reader) initialize(ctx context.Context, offset int64) (conn *Conn, star
 	return
 }
 
+// resetOffset applies the reader's offset reset policy to an offset which is
+// outside of the [first, last] range of the partition, returning the offset
+// that the reader should resume from.
+func (r *reader) resetOffset(offset, first, last int64) (int64, error) {
+	return r.offsetReset.reset(offset, first, last)
+}
+
 func (r *reader) read(ctx context.Context, offset int64, conn *Conn) (int64, error) {
-	r.stats.fetches.observe(1)
+	labels := r.metricLabels()
+	r.stats.count("kafka.reader.fetch.count", &r.stats.fetches, 1, labels)
 	r.stats.offset.observe(offset)
 
 	t0 := time.Now()
 	conn.SetReadDeadline(t0.Add(r.maxWait))
 
+	maxBytes := r.maxBytes
+	if r.fetchBytes > maxBytes {
+		maxBytes = r.fetchBytes
+	}
+
 	batch := conn.ReadBatchWith(ReadBatchConfig{
 		MinBytes:       r.minBytes,
-		MaxBytes:       r.maxBytes,
+		MaxBytes:       maxBytes,
 		IsolationLevel: r.isolationLevel,
+		ControlRecords: r.controlRecords,
 	})
 	highWaterMark := batch.HighWaterMark()
 
 	t1 := time.Now()
-	r.stats.waitTime.observeDuration(t1.Sub(t0))
+	r.stats.observeDuration("kafka.reader.wait.seconds", &r.stats.waitTime, t1.Sub(t0), labels)
+
+	if skipped := maxLagSkip(r.maxLag, offset, highWaterMark); skipped != 0 {
+		batch.Close()
+		if _, err := conn.Seek(highWaterMark, SeekAbsolute|SeekDontCheck); err != nil {
+			return offset, err
+		}
+		r.skipLag(offset, skipped)
+		return highWaterMark, nil
+	}
 
 	var msg Message
 	var err error
@@ -1483,43 +2767,256 @@ func (r *reader) read(ctx context.Context, offset int64, conn *Conn) (int64, err
 	deadline := time.Now().Add(safetyTimeout)
 	conn.SetReadDeadline(deadline)
 
-	for {
-		if now := time.Now(); deadline.Sub(now) < (safetyTimeout / 2) {
-			deadline = now.Add(safetyTimeout)
-			conn.SetReadDeadline(deadline)
-		}
+	if r.rawBatches {
+		var rb *RawBatch
 
-		if msg, err = batch.ReadMessage(); err != nil {
+		if rb, err = r.acquireBatch(ctx); err != nil {
 			batch.Close()
-			break
+			return offset, err
 		}
 
-		n := int64(len(msg.Key) + len(msg.Value))
-		r.stats.messages.observe(1)
-		r.stats.bytes.observe(n)
+		for {
+			if now := time.Now(); deadline.Sub(now) < (safetyTimeout / 2) {
+				deadline = now.Add(safetyTimeout)
+				conn.SetReadDeadline(deadline)
+			}
 
-		if err = r.sendMessage(ctx, msg, highWaterMark); err != nil {
-			batch.Close()
-			break
+			if err = batch.readRaw(rb); err != nil {
+				batch.Close()
+				break
+			}
 		}
 
-		offset = msg.Offset + 1
-		r.stats.offset.observe(offset)
-		r.stats.lag.observe(highWaterMark - offset)
+		rb.complete(r.topic, r.partition, highWaterMark)
+		stopped := r.bounded && rb.truncate(r.stopOffset)
 
-		size++
-		bytes += n
+		if len(rb.Records) == 0 {
+			rb.release()
+		} else {
+			n := int64(len(rb.buffer))
+			size = int64(len(rb.Records))
+			r.stats.count("kafka.reader.message.count", &r.stats.messages, size, labels)
+			r.stats.count("kafka.reader.message.bytes", &r.stats.bytes, n, labels)
+
+			if sendErr := r.sendBatch(ctx, rb, highWaterMark); sendErr != nil {
+				rb.release()
+				err = sendErr
+			} else {
+				r.leaderEpoch = batch.leaderEpoch
+				offset = rb.Records[len(rb.Records)-1].Offset + 1
+				r.stats.offset.observe(offset)
+				r.stats.lag.observe(highWaterMark - offset)
+				bytes = n
+			}
+		}
+
+		if stopped && err == io.EOF {
+			offset = r.stopOffset
+		}
+	} else {
+		for {
+			if now := time.Now(); deadline.Sub(now) < (safetyTimeout / 2) {
+				deadline = now.Add(safetyTimeout)
+				conn.SetReadDeadline(deadline)
+			}
+
+			if msg, err = batch.ReadMessage(); err != nil {
+				batch.Close()
+				break
+			}
+
+			if r.bounded && msg.Offset >= r.stopOffset {
+				// The messages of the batch past the end of the range are
+				// discarded, the read loop stops at the next iteration.
+				batch.Close()
+				offset, err = r.stopOffset, io.EOF
+				break
+			}
+
+			n := int64(len(msg.Key) + len(msg.Value))
+			r.stats.count("kafka.reader.message.count", &r.stats.messages, 1, labels)
+			r.stats.count("kafka.reader.message.bytes", &r.stats.bytes, n, labels)
+
+			if err = r.sendMessage(ctx, msg, highWaterMark); err != nil {
+				batch.Close()
+				break
+			}
+
+			r.leaderEpoch = batch.leaderEpoch
+			offset = msg.Offset + 1
+			r.stats.offset.observe(offset)
+			r.stats.lag.observe(highWaterMark - offset)
+
+			size++
+			bytes += n
+		}
 	}
 
 	conn.SetReadDeadline(time.Time{})
 
+	switch {
+	case size != 0:
+		r.fetchBytes = 0
+	case batch.truncated && err == io.EOF:
+		// The first record did not fit in the response, it can only be read
+		// with a larger fetch.
+		err = r.growFetchBytes(ctx, offset, maxBytes)
+	}
+
+	if bytes != 0 {
+		r.stats.partitionBytes.observe(r.topic, r.partition, bytes)
+	}
+
 	t2 := time.Now()
-	r.stats.readTime.observeDuration(t2.Sub(t1))
-	r.stats.fetchSize.observe(size)
-	r.stats.fetchBytes.observe(bytes)
+	r.stats.observeDuration("kafka.reader.read.seconds", &r.stats.readTime, t2.Sub(t1), labels)
+	r.stats.observe("kafka.reader.fetch.size", &r.stats.fetchSize, size, labels)
+	r.stats.observe("kafka.reader.fetch.bytes", &r.stats.fetchBytes, bytes, labels)
+
+	// Fetches of partitions without new messages return RequestTimedOut once
+	// MaxWait expired.
+	if r.notifyCaughtUp && (err == nil || err == io.EOF || err == RequestTimedOut) {
+		atEnd := offset >= highWaterMark
+		if atEnd && !r.caughtUp {
+			if sendErr := r.sendCaughtUp(ctx, offset, highWaterMark); sendErr != nil {
+				return offset, sendErr
+			}
+		}
+		r.caughtUp = atEnd
+	}
+
 	return offset, err
 }
 
+// growFetchBytes doubles the size of the fetches so the record at offset can be
+// read, it returns io.EOF so the fetch is retried immediately. A
+// RecordTooLargeError is returned if the size cannot grow past maxRecordBytes.
+func (r *reader) growFetchBytes(ctx context.Context, offset int64, maxBytes int) error {
+	if maxBytes >= r.maxRecordBytes {
+		return RecordTooLargeError{
+			Topic:     r.topic,
+			Partition: r.partition,
+			Offset:    offset,
+			MaxBytes:  maxBytes,
+		}
+	}
+
+	r.fetchBytes = 2 * maxBytes
+	if r.fetchBytes > r.maxRecordBytes {
+		r.fetchBytes = r.maxRecordBytes
+	}
+
+	r.log.debug(ctx, "the record does not fit in the fetch size, increasing it",
+		logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset, "from", maxBytes, "to", r.fetchBytes},
+		"the record at offset %d of partition %d of %s does not fit in %d bytes, increasing the fetch size to %d bytes", offset, r.partition, r.topic, maxBytes, r.fetchBytes)
+	return io.EOF
+}
+
+// skipLag reports that the reader skipped from offset to the high water mark of
+// the partition because it exceeded the maximum lag.
+func (r *reader) skipLag(offset, skipped int64) {
+	r.log.error(context.Background(), "the kafka reader is lagging behind by more than the maximum lag, skipping messages",
+		logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset, "reset", offset + skipped, "skipped", skipped, "max_lag", r.maxLag},
+		"the kafka reader for partition %d of %s is lagging behind by more than %d messages, skipping from offset %d to %d (%d messages)", r.partition, r.topic, r.maxLag, offset, offset+skipped, skipped)
+	if r.onMaxLag != nil {
+		r.onMaxLag(r.topic, r.partition, skipped)
+	}
+}
+
+// maxLagSkip returns the number of messages to skip when reading from offset
+// on a partition with the given high water mark, which is zero unless the lag
+// exceeds maxLag.
+func maxLagSkip(maxLag, offset, highWaterMark int64) int64 {
+	if lag := highWaterMark - offset; maxLag > 0 && lag > maxLag {
+		return lag
+	}
+	return 0
+}
+
+// validateOffset checks whether the log of the partition was truncated below
+// offset, which the reader consumed up to in its last leader epoch, and returns
+// the offset where the log diverged if it was.
+func (r *reader) validateOffset(conn *Conn, offset int64) (int64, error) {
+	if !r.detectTrunc || r.leaderEpoch < 0 {
+		return offset, nil
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	end, err := conn.OffsetForLeaderEpoch(int(r.leaderEpoch))
+	if err != nil {
+		return offset, fmt.Errorf("validating offset %d of leader epoch %d: %w", offset, r.leaderEpoch, err)
+	}
+
+	// A negative offset means that the broker knows no epoch up to the one
+	// requested, there is nothing to compare the offset with.
+	if end.Offset < 0 || end.Offset >= offset {
+		return offset, nil
+	}
+
+	r.log.error(context.Background(), "the log of the partition was truncated, resuming from the end offset",
+		logAttrs{"topic", r.topic, "partition", r.partition, "offset", offset, "reset", end.Offset, "leader_epoch", end.LeaderEpoch},
+		"the log of partition %d of %s was truncated at offset %d (leader epoch %d), resuming from offset %d instead of %d", r.partition, r.topic, end.Offset, end.LeaderEpoch, end.Offset, offset)
+	if r.onTruncation != nil {
+		r.onTruncation(r.topic, r.partition, offset, end.Offset)
+	}
+
+	r.leaderEpoch = int32(end.LeaderEpoch)
+	return end.Offset, nil
+}
+
+// resolveStop returns the offset where the reader stops reading the partition,
+// which is the high water mark when the configured boundary is beyond it. The
+// returned boolean is false if the range is unbounded.
+func (r *reader) resolveStop(conn *Conn, last int64) (int64, bool, error) {
+	if r.stopAtOffset == 0 && r.stopAtTime.IsZero() {
+		return 0, false, nil
+	}
+
+	timeOffset := int64(-1)
+	if !r.stopAtTime.IsZero() {
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		offset, err := conn.ReadOffset(r.stopAtTime)
+		if err != nil {
+			return 0, false, fmt.Errorf("looking up the offset of partition %d of %s at %s: %w", r.partition, r.topic, r.stopAtTime, err)
+		}
+		timeOffset = offset
+	}
+
+	return rangeEnd(last, r.stopAtOffset, timeOffset), true, nil
+}
+
+// rangeEnd returns the end of the range of messages read from a partition with
+// the given high water mark. The stopAtOffset is zero when it is not configured,
+// and timeOffset is the offset of the first message written at or after the
+// configured StopAtTime, or -1 when there are none.
+func rangeEnd(highWaterMark, stopAtOffset, timeOffset int64) int64 {
+	end := highWaterMark
+	if stopAtOffset != 0 && stopAtOffset < end {
+		end = stopAtOffset
+	}
+	if timeOffset >= 0 && timeOffset < end {
+		end = timeOffset
+	}
+	return end
+}
+
+// waitResume blocks while fetching the partition is paused, it returns false
+// if the context was canceled.
+func (r *reader) waitResume(ctx context.Context) bool {
+	if r.paused == nil {
+		return true
+	}
+	resume := r.paused(topicPartition{topic: r.topic, partition: int32(r.partition)})
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-resume:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 func (r *reader) readOffsets(conn *Conn) (first, last int64, err error) {
 	conn.SetDeadline(time.Now().Add(10 * time.Second))
 	return conn.ReadOffsets()
@@ -1534,29 +3031,63 @@ func (r *reader) sendMessage(ctx context.Context, msg Message, watermark int64)
 	}
 }
 
-func (r *reader) sendError(ctx context.Context, err error) error {
+// sendCaughtUp tells the program that the reader reached the high water mark
+// of the partition, after the messages that it already sent.
+func (r *reader) sendCaughtUp(ctx context.Context, offset, watermark int64) error {
+	msg := Message{Topic: r.topic, Partition: r.partition, Offset: offset}
 	select {
-	case r.msgs <- readerMessage{version: r.version, error: err}:
+	case r.msgs <- readerMessage{version: r.version, message: msg, watermark: watermark, caughtUp: true}:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
 	}
 }
 
-func (r *reader) withLogger(do func(Logger)) {
-	if r.logger != nil {
-		do(r.logger)
+// sendStopped tells the program that the reader reached the end of the range
+// of messages read from the partition.
+func (r *reader) sendStopped(ctx context.Context, offset int64) error {
+	msg := Message{Topic: r.topic, Partition: r.partition, Offset: offset}
+	select {
+	case r.msgs <- readerMessage{version: r.version, message: msg, watermark: offset, stopped: true}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func (r *reader) withErrorLogger(do func(Logger)) {
-	if r.errorLogger != nil {
-		do(r.errorLogger)
-	} else {
-		r.withLogger(do)
+func (r *reader) sendBatch(ctx context.Context, batch *RawBatch, watermark int64) error {
+	select {
+	case r.msgs <- readerMessage{version: r.version, batch: batch, watermark: watermark}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquireBatch returns a raw batch from the pool of the reader, waiting for
+// the program to release one if they are all in use.
+func (r *reader) acquireBatch(ctx context.Context) (*RawBatch, error) {
+	select {
+	case batch := <-r.batches:
+		return batch, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
+func (r *reader) sendError(ctx context.Context, err error) error {
+	select {
+	case r.msgs <- readerMessage{version: r.version, error: err}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *reader) metricLabels() MetricLabels {
+	return MetricLabels{Topic: r.topic, Partition: r.partition}
+}
+
 // extractTopics returns the unique list of topics represented by the set of
 // provided members
 func extractTopics(members []GroupMember) []string {
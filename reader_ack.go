@@ -0,0 +1,211 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var errAckMessages = errors.New("kafka.(*Reader): Ack requires AckMessages to be enabled")
+
+// ErrAckUntracked is returned by Reader.Ack when a message is not awaiting
+// acknowledgement, because it was not returned by FetchMessage or was
+// returned in a previous generation of the consumer group.
+var ErrAckUntracked = errors.New("message is not awaiting acknowledgement")
+
+// ackTracker records the offsets of the messages returned by a reader which
+// were not committed yet, and whether they were acknowledged.
+type ackTracker struct {
+	// serializes the calls to Ack so the offsets are committed in the order
+	// they were computed.
+	commitMutex sync.Mutex
+
+	mutex      sync.Mutex
+	generation int32
+	partitions map[topicPartition]*ackPartition
+	pending    int
+}
+
+// ackPartition holds the offsets of a partition awaiting to be committed, in
+// the order they were fetched.
+type ackPartition struct {
+	// offset following the last committed message, acknowledging messages
+	// before it has no effect.
+	committed int64
+	offsets   []int64
+	acked     []bool
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{partitions: make(map[topicPartition]*ackPartition)}
+}
+
+// reset drops the messages awaiting acknowledgement when the reader joins a
+// new generation of the consumer group. The partitions may have been revoked,
+// and those which are still assigned are consumed again from their committed
+// offset.
+func (t *ackTracker) reset(generation int32) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.generation = generation
+	t.partitions = make(map[topicPartition]*ackPartition)
+	t.pending = 0
+}
+
+// track records msg as awaiting acknowledgement, it returns the generation
+// that the message belongs to.
+func (t *ackTracker) track(msg Message) int32 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := topicPartition{topic: msg.Topic, partition: int32(msg.Partition)}
+	p := t.partitions[key]
+	if p == nil {
+		p = &ackPartition{committed: msg.Offset}
+		t.partitions[key] = p
+	}
+
+	// The partition was rewound, which happens when its offset is reset, the
+	// messages that were not acknowledged will be delivered again.
+	if n := len(p.offsets); n != 0 && msg.Offset <= p.offsets[n-1] {
+		for _, acked := range p.acked {
+			if !acked {
+				t.pending--
+			}
+		}
+		p.offsets, p.acked = p.offsets[:0], p.acked[:0]
+		p.committed = msg.Offset
+	}
+
+	p.offsets = append(p.offsets, msg.Offset)
+	p.acked = append(p.acked, false)
+	t.pending++
+	return t.generation
+}
+
+// ack marks msg as acknowledged, it returns the last message of the
+// contiguous range of acknowledged messages at the start of the partition
+// which were not committed yet, if any. The messages remain tracked until
+// commit is called.
+func (t *ackTracker) ack(msg Message) (Message, bool, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p := t.partitions[topicPartition{topic: msg.Topic, partition: int32(msg.Partition)}]
+	if msg.generation != t.generation || p == nil {
+		return Message{}, false, untrackedAck(msg)
+	}
+
+	if msg.Offset >= p.committed {
+		i := sort.Search(len(p.offsets), func(i int) bool { return p.offsets[i] >= msg.Offset })
+		if i == len(p.offsets) || p.offsets[i] != msg.Offset {
+			return Message{}, false, untrackedAck(msg)
+		}
+		if !p.acked[i] {
+			p.acked[i] = true
+			t.pending--
+		}
+	}
+
+	n := 0
+	for n < len(p.acked) && p.acked[n] {
+		n++
+	}
+	if n == 0 {
+		return Message{}, false, nil
+	}
+
+	commit := Message{Topic: msg.Topic, Partition: msg.Partition, Offset: p.offsets[n-1]}
+	commit.generation = t.generation
+	return commit, true, nil
+}
+
+// commit stops tracking the messages of the partition up to msg, after their
+// offsets were committed.
+func (t *ackTracker) commit(msg Message) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p := t.partitions[topicPartition{topic: msg.Topic, partition: int32(msg.Partition)}]
+	if msg.generation != t.generation || p == nil || msg.Offset < p.committed {
+		return
+	}
+
+	n := sort.Search(len(p.offsets), func(i int) bool { return p.offsets[i] > msg.Offset })
+	p.offsets, p.acked = p.offsets[n:], p.acked[n:]
+	p.committed = msg.Offset + 1
+}
+
+func untrackedAck(msg Message) error {
+	return fmt.Errorf("kafka.(*Reader): cannot acknowledge the message at offset %d of partition %d of topic %q: %w",
+		msg.Offset, msg.Partition, msg.Topic, ErrAckUntracked)
+}
+
+// Ack acknowledges the messages passed as argument, which must have been
+// returned by FetchMessage on a reader configured with AckMessages. Messages
+// may be acknowledged in any order, the offset of each partition is committed
+// up to the first message that was not acknowledged yet.
+//
+// Acknowledging a message twice has no effect. Messages that are not awaiting
+// acknowledgement, because they were not returned by FetchMessage or were
+// delivered in a previous generation of the consumer group, cause Ack to
+// return an error wrapping ErrAckUntracked after the other messages were
+// acknowledged. Messages must be acknowledged with the values returned by
+// FetchMessage, or copies of them. After a rebalance, the messages of the
+// partitions that are still assigned to the reader are delivered again from
+// the last committed offset.
+//
+// The offsets are committed with CommitMessages, so calls to Ack block until
+// the commit completes when CommitInterval is zero; configuring a commit
+// interval is recommended when messages are processed concurrently. When the
+// commit fails the messages remain acknowledged, their offsets are committed
+// again by the next call to Ack for the partition.
+func (r *Reader) Ack(ctx context.Context, msgs ...Message) error {
+	if r.acks == nil {
+		return errAckMessages
+	}
+
+	r.acks.commitMutex.Lock()
+	defer r.acks.commitMutex.Unlock()
+
+	var commits []Message
+	var ackErr error
+	for _, m := range msgs {
+		c, ok, err := r.acks.ack(m)
+		if err != nil {
+			if ackErr == nil {
+				ackErr = err
+			}
+			continue
+		}
+		if ok {
+			commits = append(commits, c)
+		}
+	}
+
+	if len(commits) != 0 {
+		if err := r.CommitMessages(ctx, commits...); err != nil {
+			return err
+		}
+		for _, c := range commits {
+			r.acks.commit(c)
+		}
+	}
+
+	return ackErr
+}
+
+// PendingAcks returns the number of messages returned by FetchMessage which
+// were not acknowledged yet, it is always zero when the reader is not
+// configured with AckMessages.
+func (r *Reader) PendingAcks() int {
+	if r.acks == nil {
+		return 0
+	}
+	r.acks.mutex.Lock()
+	defer r.acks.mutex.Unlock()
+	return r.acks.pending
+}
@@ -0,0 +1,243 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var errRawBatches = errors.New("kafka.(*Reader): messages must be read with FetchBatch when RawBatches is enabled")
+
+// rawBatchPoolSize is the number of raw batches allocated to a reader, one may
+// be held by the program while the other is being filled.
+const rawBatchPoolSize = 2
+
+// RawBatch is a view of the records returned by a single fetch of a partition,
+// it is produced by readers configured with RawBatches.
+//
+// The keys and values of the records are slices of a buffer which is reused
+// by the reader. The batch, its records, and the slices they reference are
+// only valid until the next call to FetchBatch or Close on the reader that
+// returned it; after that the memory is overwritten by the next fetch. The
+// program must copy any part of the records that it needs to retain for
+// longer, and must not modify the slices.
+type RawBatch struct {
+	// Topic and partition that the records were read from.
+	Topic     string
+	Partition int
+
+	// The high water mark of the partition at the time of the fetch.
+	HighWaterMark int64
+
+	// The records of the batch, ordered by offset.
+	Records []RawRecord
+
+	buffer []byte
+	spans  []rawRecordSpan
+	pool   chan *RawBatch
+}
+
+// RawRecord is a record of a RawBatch. The Key and Value fields reference the
+// buffer of the batch and share its lifetime.
+type RawRecord struct {
+	Offset  int64
+	Time    time.Time
+	Key     []byte
+	Value   []byte
+	Headers []Header
+}
+
+// rawRecordSpan records the location of the key and value of a record in the
+// buffer of a batch, the slices can only be created once the buffer is not
+// going to be reallocated anymore. A negative start marks a null key or value.
+type rawRecordSpan struct {
+	keyStart, keyEnd     int
+	valueStart, valueEnd int
+}
+
+// Message returns the record at index i as a Message, which can be passed to
+// CommitMessages. The key and value of the message are not copied and share
+// the lifetime of the batch.
+func (b *RawBatch) Message(i int) Message {
+	r := &b.Records[i]
+	return Message{
+		Topic:         b.Topic,
+		Partition:     b.Partition,
+		Offset:        r.Offset,
+		HighWaterMark: b.HighWaterMark,
+		Key:           r.Key,
+		Value:         r.Value,
+		Headers:       r.Headers,
+		Time:          r.Time,
+	}
+}
+
+func (b *RawBatch) complete(topic string, partition int, highWaterMark int64) {
+	b.Topic = topic
+	b.Partition = partition
+	b.HighWaterMark = highWaterMark
+
+	for i, s := range b.spans {
+		r := &b.Records[i]
+		r.Key = rawSlice(b.buffer, s.keyStart, s.keyEnd)
+		r.Value = rawSlice(b.buffer, s.valueStart, s.valueEnd)
+	}
+}
+
+// truncate removes the records at or past offset from the batch, and reports
+// whether any were removed.
+func (b *RawBatch) truncate(offset int64) bool {
+	i := len(b.Records)
+	for i > 0 && b.Records[i-1].Offset >= offset {
+		i--
+	}
+	if i == len(b.Records) {
+		return false
+	}
+	for j := i; j < len(b.Records); j++ {
+		b.Records[j] = RawRecord{}
+	}
+	b.Records = b.Records[:i]
+	return true
+}
+
+// release resets the batch and returns it to the pool it was allocated from.
+func (b *RawBatch) release() {
+	for i := range b.Records {
+		b.Records[i] = RawRecord{}
+	}
+	b.Records = b.Records[:0]
+	b.spans = b.spans[:0]
+	b.buffer = b.buffer[:0]
+
+	select {
+	case b.pool <- b:
+	default:
+	}
+}
+
+func rawSlice(b []byte, i, j int) []byte {
+	switch {
+	case i < 0:
+		return nil
+	case i == j:
+		return []byte{}
+	}
+	return b[i:j:j]
+}
+
+func newRawBatchPool(size int) chan *RawBatch {
+	pool := make(chan *RawBatch, size)
+	for i := 0; i < size; i++ {
+		pool <- &RawBatch{pool: pool}
+	}
+	return pool
+}
+
+// releaseBatch returns the last batch returned by FetchBatch to its pool, the
+// reader mutex must be held.
+func (r *Reader) releaseBatch() {
+	if r.batch != nil {
+		r.batch.release()
+		r.batch = nil
+	}
+}
+
+// FetchBatch reads and returns the records of the next fetch from the r, the
+// reader must be configured with RawBatches. The method call blocks until a
+// batch becomes available, or an error occurs. The program may also specify a
+// context to asynchronously cancel the blocking operation.
+//
+// Calling FetchBatch invalidates the batch returned by the previous call, see
+// RawBatch for details on the lifetime of the batches.
+//
+// Like FetchMessage, FetchBatch does not commit offsets automatically when
+// using consumer groups, use CommitMessages with the messages returned by the
+// Message method of the batch to commit offsets.
+func (r *Reader) FetchBatch(ctx context.Context) (*RawBatch, error) {
+	if !r.config.RawBatches {
+		return nil, errors.New("kafka.(*Reader): FetchBatch requires RawBatches to be enabled")
+	}
+
+	r.activateReadLag()
+
+	r.mutex.Lock()
+	r.releaseBatch()
+	r.mutex.Unlock()
+
+	for {
+		r.mutex.Lock()
+
+		if !r.closed && r.version == 0 {
+			r.start(r.getTopicPartitionOffset())
+		}
+
+		version := r.version
+		done := r.rangeDone()
+		r.mutex.Unlock()
+
+		if done {
+			return nil, io.EOF
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case err := <-r.runError:
+			return nil, err
+
+		case m, ok := <-r.msgs:
+			if !ok {
+				return nil, io.EOF
+			}
+
+			if m.version < version {
+				if m.batch != nil {
+					m.batch.release()
+				}
+				continue
+			}
+
+			if m.caughtUp {
+				if r.markCaughtUp(m, version) {
+					r.config.OnCaughtUp()
+				}
+				continue
+			}
+
+			if m.stopped {
+				r.markStopped(m, version)
+				continue
+			}
+
+			if m.error != nil {
+				if m.error == io.EOF {
+					// See FetchMessage for why io.EOF is replaced.
+					m.error = io.ErrUnexpectedEOF
+				}
+				return nil, m.error
+			}
+
+			r.mutex.Lock()
+
+			notify := false
+			if version == r.version {
+				last := m.batch.Records[len(m.batch.Records)-1]
+				r.offset = last.Offset + 1
+				r.lag = m.watermark - r.offset
+				r.trackLag(m.batch.Topic, m.batch.Partition, r.offset, m.watermark)
+				notify = r.checkCaughtUp(true)
+			}
+
+			r.batch = m.batch
+			r.mutex.Unlock()
+
+			if notify {
+				r.config.OnCaughtUp()
+			}
+			return m.batch, nil
+		}
+	}
+}
@@ -0,0 +1,785 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	fetchAPI "github.com/segmentio/kafka-go/protocol/fetch"
+)
+
+// A fetcher reads messages from all partitions assigned to a Reader when
+// ReaderConfig.FetchByBroker is enabled. Partitions are grouped by leader and
+// each group is consumed by a single loop sending multi-partition fetch
+// requests to the broker, over the connection maintained by the client's
+// transport.
+//
+// When the leadership of a partition changes, all loops are stopped, the
+// partitions are regrouped according to the new leaders, and consumption
+// resumes from the offsets reached by each partition.
+type fetcher struct {
+	client            *Client
+	log               logger
+	minBytes          int
+	maxBytes          int
+	partitionMaxBytes int
+	maxWait           time.Duration
+	backoffDelayMin   time.Duration
+	backoffDelayMax   time.Duration
+	version           int64
+	msgs              chan<- readerMessage
+	stats             *readerStats
+	isolationLevel    IsolationLevel
+	maxAttempts       int
+	waitForTopic      time.Duration
+	offsetReset       OffsetResetPolicy
+	rackID            string
+	maxLag            int64
+	onMaxLag          func(string, int, int64)
+	notifyCaughtUp    bool
+	stopAtOffset      int64
+	stopAtTime        time.Time
+	// returns a channel closed once fetching the partition may resume, or nil
+	// if it is not paused, see Reader.pausedPartition.
+	paused func(topicPartition) <-chan struct{}
+
+	// partitions for which a caught up marker was sent since they last fell
+	// behind the high water mark, ends of the ranges of messages read from
+	// the partitions, and partitions which reached them, shared by the broker
+	// loops.
+	mutex    sync.Mutex
+	caughtUp map[topicPartition]bool
+	stops    map[topicPartition]int64
+	stopped  map[topicPartition]bool
+}
+
+// fetcherMetricLabels are the labels of the metrics reported by fetchers which
+// do not relate to a single partition since fetch requests span multiple
+// partitions.
+var fetcherMetricLabels = MetricLabels{Partition: -1}
+
+// errLeaderChanged is returned by broker loops to indicate that the partitions
+// need to be regrouped because of a change of leadership.
+var errLeaderChanged = errors.New("the leader of a partition has changed")
+
+func (f *fetcher) run(ctx context.Context, offsets map[topicPartition]int64) {
+	// Copy the offsets since the map is updated as messages are read.
+	offsets = copyOffsets(offsets)
+	wait := topicWait{timeout: f.waitForTopic}
+
+	for attempt := 0; true; attempt++ {
+		if attempt != 0 {
+			if !sleep(ctx, backoff(attempt, f.backoffDelayMin, f.backoffDelayMax)) {
+				return
+			}
+		}
+
+		leaders, err := f.leaders(ctx, offsets)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			err = fmt.Errorf("looking up partition leaders: %w", err)
+			if wait.missing(err) {
+				f.log.error(ctx, "the kafka reader is waiting for its topics to exist", logAttrs{"error", err},
+					"the kafka reader is waiting for its topics to exist: %s", err)
+				continue
+			}
+			if wait.expired() {
+				f.sendError(ctx, err)
+				continue
+			}
+			f.handleError(ctx, attempt, err)
+			continue
+		}
+		wait.found()
+
+		f.log.debug(ctx, "the kafka reader is fetching partitions by broker",
+			logAttrs{"partitions", len(offsets), "brokers", len(leaders)},
+			"the kafka reader is fetching %d partitions from %d brokers", len(offsets), len(leaders))
+
+		groupCtx, stop := context.WithCancel(ctx)
+		results := make(chan fetchResult, len(leaders))
+
+		for _, partitions := range leaders {
+			go func(partitions map[topicPartition]int64) {
+				results <- f.fetchLoop(groupCtx, stop, partitions)
+			}(partitions)
+		}
+
+		err = nil
+		fetched := false
+		for range leaders {
+			res := <-results
+			for key, offset := range res.offsets {
+				offsets[key] = offset
+			}
+			if res.err != nil && !errors.Is(res.err, errLeaderChanged) && err == nil {
+				err = res.err
+			}
+			fetched = fetched || res.fetched
+		}
+		stop()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			f.handleError(ctx, attempt, err)
+			continue
+		}
+
+		// Leadership changed, the cached metadata is refreshed to look up the
+		// new leaders. The attempt counter is only reset if messages were
+		// fetched since the last change, so partitions which keep failing
+		// over are retried with an increasing backoff.
+		f.stats.count("kafka.reader.rebalance.count", &f.stats.rebalances, 1, fetcherMetricLabels)
+		f.refreshMetadata(ctx)
+		if fetched {
+			attempt = 0
+		}
+	}
+}
+
+// refreshMetadata forces an update of the metadata cached by the transport of
+// the client, so the leaders looked up next reflect the change of leadership.
+// Other round trippers are not expected to cache the metadata.
+func (f *fetcher) refreshMetadata(ctx context.Context) {
+	if t, ok := f.client.transport().(*Transport); ok {
+		t.refreshMetadata(ctx, f.client.Addr)
+	}
+}
+
+// handleError reports errors to the program once the maximum number of
+// attempts has been reached, and only logs them otherwise.
+func (f *fetcher) handleError(ctx context.Context, attempt int, err error) {
+	if attempt >= f.maxAttempts {
+		f.sendError(ctx, err)
+	} else {
+		f.stats.count("kafka.reader.error.count", &f.stats.errors, 1, fetcherMetricLabels)
+		f.log.error(ctx, "the kafka reader got an error fetching messages", logAttrs{"attempt", attempt, "error", err},
+			"the kafka reader got an error fetching messages: %s", err)
+	}
+}
+
+// leaders groups the partitions by the ID of their leader.
+func (f *fetcher) leaders(ctx context.Context, offsets map[topicPartition]int64) (map[int]map[topicPartition]int64, error) {
+	topics := make([]string, 0, len(offsets))
+	seen := make(map[string]struct{}, len(offsets))
+	for key := range offsets {
+		if _, ok := seen[key.topic]; !ok {
+			seen[key.topic] = struct{}{}
+			topics = append(topics, key.topic)
+		}
+	}
+
+	res, err := f.client.Metadata(ctx, &MetadataRequest{Topics: topics})
+	if err != nil {
+		return nil, err
+	}
+
+	leaderOf := make(map[topicPartition]int, len(offsets))
+	for _, t := range res.Topics {
+		if t.Error != nil {
+			return nil, fmt.Errorf("topic %s: %w", t.Name, t.Error)
+		}
+		for _, p := range t.Partitions {
+			leaderOf[topicPartition{topic: t.Name, partition: int32(p.ID)}] = p.Leader.ID
+		}
+	}
+
+	leaders := make(map[int]map[topicPartition]int64)
+	for key, offset := range offsets {
+		leader, ok := leaderOf[key]
+		if !ok {
+			return nil, fmt.Errorf("partition %d of %s: %w", key.partition, key.topic, UnknownTopicOrPartition)
+		}
+		partitions := leaders[leader]
+		if partitions == nil {
+			partitions = make(map[topicPartition]int64)
+			leaders[leader] = partitions
+		}
+		partitions[key] = offset
+	}
+
+	return leaders, nil
+}
+
+type fetchResult struct {
+	offsets map[topicPartition]int64
+	err     error
+	// whether any fetch request succeeded before the loop returned.
+	fetched bool
+}
+
+// fetchLoop consumes partitions led by the same broker until the context is
+// canceled or an error occurs, in which case the stop function is called to
+// cancel the loops of the other brokers. The offsets reached by each partition
+// are returned.
+func (f *fetcher) fetchLoop(ctx context.Context, stop context.CancelFunc, offsets map[topicPartition]int64) fetchResult {
+	defer stop()
+
+	if err := f.resolveOffsets(ctx, offsets); err != nil {
+		return fetchResult{offsets: offsets, err: err}
+	}
+	if err := f.resolveStops(ctx, offsets); err != nil {
+		return fetchResult{offsets: offsets, err: err}
+	}
+
+	fetched := false
+
+	for errcount := 0; ; {
+		if !sleep(ctx, backoff(errcount, f.backoffDelayMin, f.backoffDelayMax)) {
+			return fetchResult{offsets: offsets}
+		}
+
+		if err := f.stopPartitions(ctx, offsets); err != nil {
+			return fetchResult{offsets: offsets}
+		}
+		if len(offsets) == 0 {
+			// All the partitions led by the broker reached the end of their
+			// range, returning would stop the loops of the other brokers.
+			<-ctx.Done()
+			return fetchResult{offsets: offsets}
+		}
+		if resume := f.pausedAll(offsets); resume != nil {
+			// Fetching all the partitions is paused, wait for one of them
+			// to resume, checking the others at least every maxWait.
+			if !f.waitResume(ctx, resume) {
+				return fetchResult{offsets: offsets, fetched: fetched}
+			}
+			continue
+		}
+
+		outOfRange, failed, err := f.fetch(ctx, offsets)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = nil
+			}
+			return fetchResult{offsets: offsets, err: err, fetched: fetched}
+		}
+		fetched = true
+
+		if len(outOfRange) != 0 {
+			if err := f.resetOffsets(ctx, offsets, outOfRange); err != nil {
+				return fetchResult{offsets: offsets, err: err, fetched: fetched}
+			}
+		}
+
+		if failed {
+			errcount++
+		} else {
+			errcount = 0
+		}
+	}
+}
+
+// fetch sends a fetch request for all partitions, and delivers the messages
+// received to the reader. It returns the list of partitions which were out of
+// range, and whether errors were reported for some of the partitions.
+func (f *fetcher) fetch(ctx context.Context, offsets map[topicPartition]int64) (outOfRange []topicPartition, failed bool, err error) {
+	f.stats.count("kafka.reader.fetch.count", &f.stats.fetches, 1, fetcherMetricLabels)
+
+	const safetyTimeout = 10 * time.Second
+	fetchCtx, cancel := context.WithTimeout(ctx, f.maxWait+safetyTimeout)
+	defer cancel()
+
+	t0 := time.Now()
+	m, err := f.client.roundTrip(fetchCtx, nil, f.makeFetchRequest(offsets))
+	t1 := time.Now()
+	f.stats.observeDuration("kafka.reader.wait.seconds", &f.stats.waitTime, t1.Sub(t0), fetcherMetricLabels)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	res := m.(*fetchAPI.Response)
+	if res.ErrorCode != 0 {
+		return nil, false, Error(res.ErrorCode)
+	}
+
+	var size int64
+	var bytes int64
+
+	for i := range res.Topics {
+		t := &res.Topics[i]
+
+		for j := range t.Partitions {
+			p := &t.Partitions[j]
+			key := topicPartition{topic: t.Topic, partition: p.Partition}
+
+			if _, ok := offsets[key]; !ok {
+				continue
+			}
+
+			switch err := makeError(p.ErrorCode, ""); {
+			case err == nil:
+				n, b, err := f.readPartition(ctx, key, offsets, p)
+				size, bytes = size+n, bytes+b
+				if b != 0 {
+					f.stats.partitionBytes.observe(key.topic, int(key.partition), b)
+				}
+				if err != nil {
+					return nil, false, err
+				}
+				if err := f.checkCaughtUp(ctx, key, offsets[key], p.HighWatermark); err != nil {
+					return nil, false, err
+				}
+
+			case errors.Is(err, OffsetOutOfRange):
+				outOfRange = append(outOfRange, key)
+
+			case errors.Is(err, NotLeaderForPartition),
+				errors.Is(err, UnknownTopicOrPartition),
+				errors.Is(err, LeaderNotAvailable),
+				errors.Is(err, FencedLeaderEpoch),
+				errors.Is(err, UnknownLeaderEpoch):
+				f.log.error(ctx, "failed to fetch partition from its leader",
+					logAttrs{"topic", key.topic, "partition", key.partition, "offset", offsets[key], "error", err},
+					"failed to fetch partition %d of %s at offset %d from its leader: %s", key.partition, key.topic, offsets[key], err)
+				return nil, false, errLeaderChanged
+
+			case errors.Is(err, RequestTimedOut):
+				// Timeout on the kafka side, this can be safely retried.
+				f.stats.timeouts.observe(1)
+
+			default:
+				f.sendError(ctx, fmt.Errorf("partition %d of %s: %w", key.partition, key.topic, err))
+				failed = true
+			}
+		}
+	}
+
+	f.stats.observeDuration("kafka.reader.read.seconds", &f.stats.readTime, time.Since(t1), fetcherMetricLabels)
+	f.stats.observe("kafka.reader.fetch.size", &f.stats.fetchSize, size, fetcherMetricLabels)
+	f.stats.observe("kafka.reader.fetch.bytes", &f.stats.fetchBytes, bytes, fetcherMetricLabels)
+	return outOfRange, failed, nil
+}
+
+func (f *fetcher) makeFetchRequest(offsets map[topicPartition]int64) *fetchAPI.Request {
+	topics := make(map[string][]fetchAPI.RequestPartition)
+
+	for key, offset := range offsets {
+		if f.isPaused(key) {
+			continue
+		}
+		topics[key.topic] = append(topics[key.topic], fetchAPI.RequestPartition{
+			Partition:          key.partition,
+			CurrentLeaderEpoch: -1,
+			FetchOffset:        offset,
+			LogStartOffset:     -1,
+			PartitionMaxBytes:  int32(f.partitionMaxBytes),
+		})
+	}
+
+	req := &fetchAPI.Request{
+		ReplicaID:      -1,
+		MaxWaitTime:    milliseconds(f.maxWait),
+		MinBytes:       int32(f.minBytes),
+		MaxBytes:       int32(f.maxBytes),
+		IsolationLevel: int8(f.isolationLevel),
+		SessionID:      -1,
+		SessionEpoch:   -1,
+		Topics:         make([]fetchAPI.RequestTopic, 0, len(topics)),
+		RackID:         f.rackID,
+	}
+
+	for topic, partitions := range topics {
+		sort.Slice(partitions, func(i, j int) bool {
+			return partitions[i].Partition < partitions[j].Partition
+		})
+		req.Topics = append(req.Topics, fetchAPI.RequestTopic{
+			Topic:      topic,
+			Partitions: partitions,
+		})
+	}
+
+	sort.Slice(req.Topics, func(i, j int) bool {
+		return req.Topics[i].Topic < req.Topics[j].Topic
+	})
+
+	return req
+}
+
+// isPaused reports whether fetching the partition is paused.
+func (f *fetcher) isPaused(key topicPartition) bool {
+	return f.paused != nil && f.paused(key) != nil
+}
+
+// pausedAll returns a channel which is closed once fetching the first of the
+// partitions may resume when all of them are paused, or nil otherwise.
+func (f *fetcher) pausedAll(offsets map[topicPartition]int64) <-chan struct{} {
+	if f.paused == nil {
+		return nil
+	}
+	var resume <-chan struct{}
+	for key := range offsets {
+		c := f.paused(key)
+		if c == nil {
+			return nil
+		}
+		if resume == nil {
+			resume = c
+		}
+	}
+	return resume
+}
+
+// waitResume blocks until the channel is closed or maxWait elapsed, it returns
+// false if the context was canceled.
+func (f *fetcher) waitResume(ctx context.Context, resume <-chan struct{}) bool {
+	timer := time.NewTimer(f.maxWait)
+	defer timer.Stop()
+	select {
+	case <-resume:
+	case <-timer.C:
+	case <-ctx.Done():
+		return false
+	}
+	return true
+}
+
+// readPartition delivers the records of a partition to the reader, updating
+// its offset. It returns the number of messages and bytes that were read.
+func (f *fetcher) readPartition(ctx context.Context, key topicPartition, offsets map[topicPartition]int64, p *fetchAPI.ResponsePartition) (size, bytes int64, err error) {
+	records := p.RecordSet.Records
+	if records == nil {
+		return 0, 0, nil
+	}
+
+	highWaterMark := p.HighWatermark
+	offset := offsets[key]
+	labels := MetricLabels{Topic: key.topic, Partition: int(key.partition)}
+	stop := f.stopOffset(key)
+
+	if skipped := maxLagSkip(f.maxLag, offset, highWaterMark); skipped != 0 {
+		offsets[key] = highWaterMark
+		f.log.error(ctx, "the kafka reader is lagging behind by more than the maximum lag, skipping messages",
+			logAttrs{"topic", key.topic, "partition", key.partition, "offset", offset, "reset", highWaterMark, "skipped", skipped, "max_lag", f.maxLag},
+			"the kafka reader for partition %d of %s is lagging behind by more than %d messages, skipping from offset %d to %d (%d messages)", key.partition, key.topic, f.maxLag, offset, highWaterMark, skipped)
+		if f.onMaxLag != nil {
+			f.onMaxLag(key.topic, int(key.partition), skipped)
+		}
+		return 0, 0, nil
+	}
+
+	for {
+		r, err := records.ReadRecord()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return size, bytes, err
+		}
+
+		// Compressed batches are returned whole, they may contain records
+		// before the offset that was requested.
+		if r.Offset < offset {
+			continue
+		}
+
+		// The records past the end of the range are discarded, the partition
+		// is removed from the fetches by the broker loop.
+		if stop >= 0 && r.Offset >= stop {
+			offsets[key] = stop
+			return size, bytes, nil
+		}
+
+		msg := Message{
+			Topic:         key.topic,
+			Partition:     int(key.partition),
+			Offset:        r.Offset,
+			HighWaterMark: highWaterMark,
+			Headers:       r.Headers,
+			Time:          r.Time,
+		}
+
+		if msg.Key, err = ReadAll(r.Key); err != nil {
+			return size, bytes, err
+		}
+		if msg.Value, err = ReadAll(r.Value); err != nil {
+			return size, bytes, err
+		}
+
+		n := int64(len(msg.Key) + len(msg.Value))
+		f.stats.count("kafka.reader.message.count", &f.stats.messages, 1, labels)
+		f.stats.count("kafka.reader.message.bytes", &f.stats.bytes, n, labels)
+
+		if err := f.sendMessage(ctx, msg, highWaterMark); err != nil {
+			return size, bytes, err
+		}
+
+		offset = r.Offset + 1
+		offsets[key] = offset
+		f.stats.offset.observe(offset)
+		f.stats.lag.observe(highWaterMark - offset)
+
+		size++
+		bytes += n
+	}
+}
+
+// resolveOffsets replaces the FirstOffset and LastOffset special values with
+// the actual offsets of the partitions.
+func (f *fetcher) resolveOffsets(ctx context.Context, offsets map[topicPartition]int64) error {
+	var partitions []topicPartition
+	for key, offset := range offsets {
+		if offset == FirstOffset || offset == LastOffset {
+			partitions = append(partitions, key)
+		}
+	}
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	bounds, err := f.listOffsets(ctx, partitions)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range partitions {
+		b := bounds[key]
+		switch offsets[key] {
+		case FirstOffset:
+			offsets[key] = b.FirstOffset
+		case LastOffset:
+			offsets[key] = b.LastOffset
+		}
+	}
+
+	return nil
+}
+
+// resolveStops looks up the ends of the ranges of messages read from the
+// partitions when the reader is configured with StopAtOffset or StopAtTime.
+// The ends of partitions are only resolved once, when the fetcher first reads
+// them.
+func (f *fetcher) resolveStops(ctx context.Context, offsets map[topicPartition]int64) error {
+	if f.stopAtOffset == 0 && f.stopAtTime.IsZero() {
+		return nil
+	}
+
+	req := &ListOffsetsRequest{
+		Topics:         make(map[string][]OffsetRequest),
+		IsolationLevel: f.isolationLevel,
+	}
+
+	f.mutex.Lock()
+	for key := range offsets {
+		if _, ok := f.stops[key]; ok {
+			continue
+		}
+		req.Topics[key.topic] = append(req.Topics[key.topic], LastOffsetOf(int(key.partition)))
+		if !f.stopAtTime.IsZero() {
+			req.Topics[key.topic] = append(req.Topics[key.topic], TimeOffsetOf(int(key.partition), f.stopAtTime))
+		}
+	}
+	f.mutex.Unlock()
+
+	if len(req.Topics) == 0 {
+		return nil
+	}
+
+	res, err := f.client.ListOffsets(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.stops == nil {
+		f.stops = make(map[topicPartition]int64)
+	}
+
+	for topic, partitions := range res.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return fmt.Errorf("listing offsets of partition %d of %s: %w", p.Partition, topic, p.Error)
+			}
+			// The offset is -1 when no messages were written after the time.
+			timeOffset := int64(-1)
+			for offset := range p.Offsets {
+				timeOffset = offset
+			}
+			f.stops[topicPartition{topic: topic, partition: int32(p.Partition)}] = rangeEnd(p.LastOffset, f.stopAtOffset, timeOffset)
+		}
+	}
+
+	return nil
+}
+
+// stopOffset returns the end of the range of messages read from a partition,
+// or -1 if the range is unbounded.
+func (f *fetcher) stopOffset(key topicPartition) int64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if stop, ok := f.stops[key]; ok {
+		return stop
+	}
+	return -1
+}
+
+// stopPartitions removes the partitions which reached the end of their range
+// from offsets, and tells the program that they are done.
+func (f *fetcher) stopPartitions(ctx context.Context, offsets map[topicPartition]int64) error {
+	for key, offset := range offsets {
+		stop := f.stopOffset(key)
+		if stop < 0 || offset < stop {
+			continue
+		}
+
+		delete(offsets, key)
+
+		// The partition may have already been reported by the loop of its
+		// previous leader.
+		f.mutex.Lock()
+		notify := !f.stopped[key]
+		if f.stopped == nil {
+			f.stopped = make(map[topicPartition]bool)
+		}
+		f.stopped[key] = true
+		f.mutex.Unlock()
+
+		if notify {
+			msg := Message{Topic: key.topic, Partition: int(key.partition), Offset: offset}
+			select {
+			case f.msgs <- readerMessage{version: f.version, message: msg, watermark: offset, stopped: true}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// resetOffsets applies the offset reset policy to partitions which were out of
+// range.
+func (f *fetcher) resetOffsets(ctx context.Context, offsets map[topicPartition]int64, partitions []topicPartition) error {
+	bounds, err := f.listOffsets(ctx, partitions)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range partitions {
+		b, offset := bounds[key], offsets[key]
+
+		if offset >= b.FirstOffset && offset < b.LastOffset {
+			continue // more messages have already become available
+		}
+
+		reset, err := f.offsetReset.reset(offset, b.FirstOffset, b.LastOffset)
+		switch {
+		case err != nil:
+			f.sendError(ctx, fmt.Errorf("partition %d of %s at offset %d: %w", key.partition, key.topic, offset, err))
+
+		case reset != offset:
+			f.log.error(ctx, "the kafka reader is reading out of range, resetting",
+				logAttrs{"topic", key.topic, "partition", key.partition, "offset", offset, "reset", reset},
+				"the kafka reader is reading out of range for partition %d of %s, resetting from offset %d to %d", key.partition, key.topic, offset, reset)
+			offsets[key] = reset
+
+		default:
+			// We may be reading past the last offset, will retry later.
+			f.log.error(ctx, "the kafka reader is reading passed the last offset",
+				logAttrs{"topic", key.topic, "partition", key.partition, "offset", offset},
+				"the kafka reader is reading passed the last offset for partition %d of %s at offset %d", key.partition, key.topic, offset)
+		}
+	}
+
+	return nil
+}
+
+func (f *fetcher) listOffsets(ctx context.Context, partitions []topicPartition) (map[topicPartition]PartitionOffsets, error) {
+	req := &ListOffsetsRequest{
+		Topics:         make(map[string][]OffsetRequest),
+		IsolationLevel: f.isolationLevel,
+	}
+
+	for _, key := range partitions {
+		req.Topics[key.topic] = append(req.Topics[key.topic],
+			FirstOffsetOf(int(key.partition)),
+			LastOffsetOf(int(key.partition)),
+		)
+	}
+
+	res, err := f.client.ListOffsets(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := make(map[topicPartition]PartitionOffsets, len(partitions))
+	for topic, offsets := range res.Topics {
+		for _, p := range offsets {
+			if p.Error != nil {
+				return nil, fmt.Errorf("listing offsets of partition %d of %s: %w", p.Partition, topic, p.Error)
+			}
+			bounds[topicPartition{topic: topic, partition: int32(p.Partition)}] = p
+		}
+	}
+
+	return bounds, nil
+}
+
+func (f *fetcher) sendMessage(ctx context.Context, msg Message, watermark int64) error {
+	select {
+	case f.msgs <- readerMessage{version: f.version, message: msg, watermark: watermark}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkCaughtUp tells the program when the offset reached in a partition is
+// the high water mark, once each time the partition catches up.
+func (f *fetcher) checkCaughtUp(ctx context.Context, key topicPartition, offset, watermark int64) error {
+	if !f.notifyCaughtUp {
+		return nil
+	}
+
+	atEnd := offset >= watermark
+
+	f.mutex.Lock()
+	notify := atEnd && !f.caughtUp[key]
+	f.mutex.Unlock()
+
+	if notify {
+		msg := Message{Topic: key.topic, Partition: int(key.partition), Offset: offset}
+		select {
+		case f.msgs <- readerMessage{version: f.version, message: msg, watermark: watermark, caughtUp: true}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	f.mutex.Lock()
+	if f.caughtUp == nil {
+		f.caughtUp = make(map[topicPartition]bool)
+	}
+	f.caughtUp[key] = atEnd
+	f.mutex.Unlock()
+	return nil
+}
+
+func (f *fetcher) sendError(ctx context.Context, err error) error {
+	select {
+	case f.msgs <- readerMessage{version: f.version, error: err}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func copyOffsets(offsets map[topicPartition]int64) map[topicPartition]int64 {
+	c := make(map[topicPartition]int64, len(offsets))
+	for key, offset := range offsets {
+		c[key] = offset
+	}
+	return c
+}
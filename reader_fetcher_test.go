@@ -0,0 +1,278 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+	fetchAPI "github.com/segmentio/kafka-go/protocol/fetch"
+	"github.com/segmentio/kafka-go/protocol/listoffsets"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+)
+
+// fetcherTestTransport serves a single topic where partition p is led by
+// broker p % brokers and contains records with offsets in [0, size).
+type fetcherTestTransport struct {
+	topic      string
+	partitions int
+	brokers    int
+	size       int64
+
+	mutex     sync.Mutex
+	fetches   []map[int32]int64
+	maxBytes  map[int32]int32 // last PartitionMaxBytes requested for each partition
+	notLeader map[int32]bool  // partitions which fail once with NotLeaderForPartition
+}
+
+func (t *fetcherTestTransport) leader(partition int32) int32 {
+	return partition % int32(t.brokers)
+}
+
+func (t *fetcherTestTransport) RoundTrip(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+	switch r := req.(type) {
+	case *metadataAPI.Request:
+		res := &metadataAPI.Response{}
+		for i := 0; i < t.brokers; i++ {
+			res.Brokers = append(res.Brokers, metadataAPI.ResponseBroker{
+				NodeID: int32(i),
+				Host:   "localhost",
+				Port:   int32(9092 + i),
+			})
+		}
+		partitions := make([]metadataAPI.ResponsePartition, t.partitions)
+		for i := range partitions {
+			partitions[i].PartitionIndex = int32(i)
+			partitions[i].LeaderID = t.leader(int32(i))
+		}
+		res.Topics = []metadataAPI.ResponseTopic{{
+			Name:       t.topic,
+			Partitions: partitions,
+		}}
+		return res, nil
+
+	case *listoffsets.Request:
+		res := &listoffsets.Response{}
+		for _, topic := range r.Topics {
+			resTopic := listoffsets.ResponseTopic{Topic: topic.Topic}
+			for _, p := range topic.Partitions {
+				offset := int64(0)
+				if p.Timestamp == LastOffset {
+					offset = t.size
+				}
+				resTopic.Partitions = append(resTopic.Partitions, listoffsets.ResponsePartition{
+					Partition: p.Partition,
+					Timestamp: p.Timestamp,
+					Offset:    offset,
+				})
+			}
+			res.Topics = append(res.Topics, resTopic)
+		}
+		return res, nil
+
+	case *fetchAPI.Request:
+		return t.fetch(ctx, r)
+
+	default:
+		return nil, fmt.Errorf("unsupported request: %T", req)
+	}
+}
+
+func (t *fetcherTestTransport) fetch(ctx context.Context, req *fetchAPI.Request) (*fetchAPI.Response, error) {
+	fetched := make(map[int32]int64)
+	res := &fetchAPI.Response{}
+	leader := int32(-1)
+	empty := true
+
+	for _, topic := range req.Topics {
+		resTopic := fetchAPI.ResponseTopic{Topic: topic.Topic}
+
+		for _, p := range topic.Partitions {
+			if leader < 0 {
+				leader = t.leader(p.Partition)
+			} else if leader != t.leader(p.Partition) {
+				return nil, fmt.Errorf("partitions with different leaders in the same fetch request")
+			}
+
+			fetched[p.Partition] = p.FetchOffset
+
+			t.mutex.Lock()
+			if t.maxBytes == nil {
+				t.maxBytes = make(map[int32]int32)
+			}
+			t.maxBytes[p.Partition] = p.PartitionMaxBytes
+			notLeader := t.notLeader[p.Partition]
+			delete(t.notLeader, p.Partition)
+			t.mutex.Unlock()
+
+			if notLeader {
+				resTopic.Partitions = append(resTopic.Partitions, fetchAPI.ResponsePartition{
+					Partition: p.Partition,
+					ErrorCode: int16(NotLeaderForPartition),
+				})
+				continue
+			}
+
+			var records []Record
+			for offset := p.FetchOffset; offset < t.size; offset++ {
+				records = append(records, Record{
+					Offset: offset,
+					Value:  NewBytes([]byte(strconv.FormatInt(offset, 10))),
+				})
+			}
+			if len(records) != 0 {
+				empty = false
+			}
+
+			resTopic.Partitions = append(resTopic.Partitions, fetchAPI.ResponsePartition{
+				Partition:     p.Partition,
+				HighWatermark: t.size,
+				RecordSet: protocol.RecordSet{
+					Version:    2,
+					Records:    NewRecordReader(records...),
+					BaseOffset: p.FetchOffset,
+				},
+			})
+		}
+
+		res.Topics = append(res.Topics, resTopic)
+	}
+
+	t.mutex.Lock()
+	t.fetches = append(t.fetches, fetched)
+	t.mutex.Unlock()
+
+	if empty {
+		// Emulate the broker waiting for MaxWaitTime when there are no new
+		// messages to return.
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return res, nil
+}
+
+func TestFetcherGroupsPartitionsByBroker(t *testing.T) {
+	transport := &fetcherTestTransport{
+		topic:      "topic-A",
+		partitions: 6,
+		brokers:    2,
+		size:       10,
+	}
+
+	f := testFetcherReadAll(t, transport)
+
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+
+	for _, fetched := range transport.fetches {
+		if len(fetched) != transport.partitions/transport.brokers {
+			t.Errorf("expected fetch requests to carry %d partitions but got %d", transport.partitions/transport.brokers, len(fetched))
+		}
+		for _, offset := range fetched {
+			if offset < 0 {
+				t.Errorf("fetch request sent with unresolved offset %d", offset)
+			}
+		}
+	}
+
+	if n := f.stats.rebalances.snapshot(); n != 0 {
+		t.Errorf("expected no rebalances but got %d", n)
+	}
+
+	for partition, maxBytes := range transport.maxBytes {
+		if maxBytes != int32(f.partitionMaxBytes) {
+			t.Errorf("partition %d: expected fetch requests to limit the partition to %d bytes but got %d", partition, f.partitionMaxBytes, maxBytes)
+		}
+	}
+
+	// Each partition holds the values 0 to 9, which are one byte long.
+	partitionBytes := f.stats.partitionBytes.snapshot()
+	for i := 0; i < transport.partitions; i++ {
+		if n := partitionBytes[transport.topic][i]; n != transport.size {
+			t.Errorf("partition %d: expected %d bytes to be consumed but got %d", i, transport.size, n)
+		}
+	}
+	if n := f.stats.partitionBytes.snapshot(); n != nil {
+		t.Errorf("expected the partition bytes to be reset by the snapshot: %v", n)
+	}
+}
+
+func TestFetcherRegroupsPartitionsOnLeaderChange(t *testing.T) {
+	transport := &fetcherTestTransport{
+		topic:      "topic-A",
+		partitions: 4,
+		brokers:    2,
+		size:       10,
+		notLeader:  map[int32]bool{1: true},
+	}
+
+	f := testFetcherReadAll(t, transport)
+
+	if n := f.stats.rebalances.snapshot(); n == 0 {
+		t.Error("expected the leader change to trigger a rebalance")
+	}
+}
+
+// testFetcherReadAll runs a fetcher on all partitions of the transport's topic
+// and verifies that every message is received exactly once and in order.
+func testFetcherReadAll(t *testing.T, transport *fetcherTestTransport) *fetcher {
+	msgs := make(chan readerMessage, 10)
+	f := &fetcher{
+		client:            &Client{Addr: TCP("localhost:9092"), Transport: transport},
+		log:               logger{logger: newTestKafkaLogger(t, "")},
+		minBytes:          1,
+		maxBytes:          1e6,
+		partitionMaxBytes: 1e5,
+		maxWait:           100 * time.Millisecond,
+		backoffDelayMin:   time.Millisecond,
+		backoffDelayMax:   10 * time.Millisecond,
+		msgs:              msgs,
+		stats:             &readerStats{},
+		maxAttempts:       3,
+	}
+
+	offsets := make(map[topicPartition]int64)
+	for i := 0; i < transport.partitions; i++ {
+		offsets[topicPartition{topic: transport.topic, partition: int32(i)}] = FirstOffset
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.run(ctx, offsets)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	next := make(map[int]int64)
+	for i := int64(0); i < int64(transport.partitions)*transport.size; i++ {
+		select {
+		case m := <-msgs:
+			if m.error != nil {
+				t.Fatal(m.error)
+			}
+			if m.message.Offset != next[m.message.Partition] {
+				t.Fatalf("partition %d: expected offset %d but got %d", m.message.Partition, next[m.message.Partition], m.message.Offset)
+			}
+			if string(m.message.Value) != strconv.FormatInt(m.message.Offset, 10) {
+				t.Fatalf("partition %d: unexpected value at offset %d: %q", m.message.Partition, m.message.Offset, m.message.Value)
+			}
+			next[m.message.Partition]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for messages")
+		}
+	}
+
+	return f
+}
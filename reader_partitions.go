@@ -0,0 +1,301 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+var errConsumingPartitions = errors.New("kafka.(*Reader): ConsumePartitions is already running")
+
+// PartitionConsumer delivers the messages of a single partition assigned to a
+// reader, in the order of their offsets, see Reader.ConsumePartitions.
+type PartitionConsumer struct {
+	// Topic and partition that the messages are read from.
+	Topic     string
+	Partition int
+
+	reader *Reader
+	ctx    context.Context
+	cancel context.CancelFunc
+	// signaled when messages are added to the queue.
+	ready chan struct{}
+
+	mutex sync.Mutex
+	queue []Message
+	// closed when the queue falls below the capacity of the reader, nil
+	// while fetching the partition is not paused.
+	resume chan struct{}
+}
+
+// FetchMessage returns the next message of the partition. The method call
+// blocks until a message becomes available, or the context is canceled.
+//
+// The method returns io.EOF once the partition was revoked from the reader, or
+// the reader stopped consuming partitions. Messages that were not returned
+// yet are discarded; since they were not committed, they are delivered again
+// to the member of the consumer group that the partition is assigned to.
+func (p *PartitionConsumer) FetchMessage(ctx context.Context) (Message, error) {
+	select {
+	case <-p.ctx.Done():
+		return Message{}, io.EOF
+	default:
+	}
+
+	for {
+		if m, ok := p.pop(); ok {
+			return m, nil
+		}
+
+		select {
+		case <-p.ready:
+		case <-p.ctx.Done():
+			return Message{}, io.EOF
+		case <-ctx.Done():
+			// The context passed to the worker is canceled when the partition
+			// is revoked, which must still be reported as io.EOF.
+			if p.ctx.Err() != nil {
+				return Message{}, io.EOF
+			}
+			return Message{}, ctx.Err()
+		}
+	}
+}
+
+// push adds a message to the queue of the consumer, fetching the partition is
+// paused once the queue holds QueueCapacity messages.
+func (p *PartitionConsumer) push(m Message) {
+	if p.ctx.Err() != nil {
+		return // the worker returned, the message is discarded
+	}
+
+	p.mutex.Lock()
+	p.queue = append(p.queue, m)
+	if len(p.queue) >= p.reader.config.QueueCapacity && p.resume == nil {
+		p.resume = make(chan struct{})
+	}
+	p.mutex.Unlock()
+	p.signal()
+}
+
+func (p *PartitionConsumer) pop() (Message, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.queue) == 0 {
+		return Message{}, false
+	}
+
+	m := p.queue[0]
+	p.queue[0] = Message{}
+	p.queue = p.queue[1:]
+
+	if p.resume != nil && len(p.queue) < p.reader.config.QueueCapacity {
+		close(p.resume)
+		p.resume = nil
+	}
+	if len(p.queue) != 0 {
+		// Wakes up other goroutines fetching messages of the partition.
+		p.signal()
+	}
+	return m, true
+}
+
+func (p *PartitionConsumer) signal() {
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// paused returns a channel which is closed once fetching the partition may
+// resume, or nil if fetching the partition is not paused.
+func (p *PartitionConsumer) paused() <-chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.resume
+}
+
+// CommitMessages commits the offsets of the messages passed as argument, see
+// Reader.CommitMessages. Offsets are tracked per partition, so each consumer
+// advances the offset of its partition independently of the others.
+func (p *PartitionConsumer) CommitMessages(ctx context.Context, msgs ...Message) error {
+	return p.reader.CommitMessages(ctx, msgs...)
+}
+
+// partitionDispatcher routes the messages fetched by a reader to the consumers
+// of their partitions.
+type partitionDispatcher struct {
+	reader *Reader
+	ctx    context.Context
+	worker func(context.Context, *PartitionConsumer)
+	join   sync.WaitGroup
+
+	mutex     sync.Mutex
+	stopped   bool
+	consumers map[topicPartition]*PartitionConsumer
+	// partitions assigned to the reader, nil until the reader is restarted
+	// after the dispatcher was created.
+	assigned map[topicPartition]bool
+}
+
+// assign is called by the reader when it starts reading a new set of
+// partitions, the consumers of partitions which are not part of the set are
+// stopped and consumers are started for the new partitions.
+func (d *partitionDispatcher) assign(offsets map[topicPartition]int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.stopped {
+		return
+	}
+
+	d.assigned = make(map[topicPartition]bool, len(offsets))
+	for key := range offsets {
+		d.assigned[key] = true
+	}
+
+	for key, p := range d.consumers {
+		if !d.assigned[key] {
+			p.cancel()
+			delete(d.consumers, key)
+		}
+	}
+
+	for key := range offsets {
+		d.consumerLocked(key)
+	}
+}
+
+// paused returns a channel which is closed once fetching the partition may
+// resume, or nil if fetching the partition is not paused.
+func (d *partitionDispatcher) paused(key topicPartition) <-chan struct{} {
+	d.mutex.Lock()
+	p := d.consumers[key]
+	d.mutex.Unlock()
+
+	if p == nil {
+		return nil
+	}
+	return p.paused()
+}
+
+// consumer returns the consumer of the partition, starting it if needed, or
+// nil if the partition is no longer assigned to the reader.
+func (d *partitionDispatcher) consumer(key topicPartition) *PartitionConsumer {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.consumerLocked(key)
+}
+
+func (d *partitionDispatcher) consumerLocked(key topicPartition) *PartitionConsumer {
+	if d.stopped || (d.assigned != nil && !d.assigned[key]) {
+		return nil
+	}
+
+	if p := d.consumers[key]; p != nil {
+		return p
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	p := &PartitionConsumer{
+		Topic:     key.topic,
+		Partition: int(key.partition),
+		reader:    d.reader,
+		ctx:       ctx,
+		cancel:    cancel,
+		ready:     make(chan struct{}, 1),
+	}
+	d.consumers[key] = p
+
+	d.join.Add(1)
+	go func() {
+		defer d.join.Done()
+		defer cancel()
+		d.worker(ctx, p)
+	}()
+
+	return p
+}
+
+func (d *partitionDispatcher) stop() {
+	d.mutex.Lock()
+	d.stopped = true
+	for _, p := range d.consumers {
+		p.cancel()
+	}
+	d.consumers = nil
+	d.mutex.Unlock()
+
+	d.join.Wait()
+}
+
+// ConsumePartitions reads messages from r and dispatches them to a worker per
+// partition, which allows partitions to be processed in parallel while the
+// messages of each partition are processed in order.
+//
+// The worker function is called in its own goroutine for each partition
+// assigned to the reader, with a PartitionConsumer delivering the messages of
+// the partition. When a rebalance revokes the partition from the reader, the
+// context passed to the worker is canceled and the FetchMessage method of the
+// consumer returns io.EOF; workers are started for the partitions newly
+// assigned to the reader. Workers must return once their partition is revoked,
+// the messages of a partition whose worker returned earlier are discarded
+// until the partition is assigned to the reader again.
+//
+// Messages are dispatched to the consumers through buffers of QueueCapacity
+// messages. When the buffer of a worker which does not keep up is full, the
+// reader stops fetching its partition until the worker catches up, without
+// delaying the dispatch of messages to the other workers.
+//
+// Like FetchMessage, messages are not committed automatically, workers may
+// use the CommitMessages method of their consumer. The method call blocks
+// until the context is canceled, the reader is closed, or fetching messages
+// returns an error, and returns after all workers returned. It returns nil
+// when the reader was closed. Calling FetchMessage or ReadMessage on the
+// reader while ConsumePartitions is running is not supported.
+func (r *Reader) ConsumePartitions(ctx context.Context, worker func(context.Context, *PartitionConsumer)) error {
+	if r.config.RawBatches {
+		return errRawBatches
+	}
+
+	d := &partitionDispatcher{
+		reader:    r,
+		ctx:       ctx,
+		worker:    worker,
+		consumers: make(map[topicPartition]*PartitionConsumer),
+	}
+
+	r.mutex.Lock()
+	if r.dispatcher != nil {
+		r.mutex.Unlock()
+		return errConsumingPartitions
+	}
+	r.dispatcher = d
+	r.mutex.Unlock()
+
+	defer func() {
+		r.mutex.Lock()
+		r.dispatcher = nil
+		r.mutex.Unlock()
+		d.stop()
+	}()
+
+	for {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return err
+		}
+
+		p := d.consumer(topicPartition{topic: m.Topic, partition: int32(m.Partition)})
+		if p == nil {
+			continue // the partition was revoked
+		}
+
+		p.push(m)
+	}
+}
@@ -1,20 +1,29 @@
 package kafka
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	fetchAPI "github.com/segmentio/kafka-go/protocol/fetch"
+	ktesting "github.com/segmentio/kafka-go/testing"
 	"github.com/stretchr/testify/require"
 )
 
@@ -62,6 +71,16 @@ func TestReader(t *testing.T) {
 			scenario: "reading from an out-of-range offset waits until the context is cancelled",
 			function: testReaderOutOfRangeGetsCanceled,
 		},
+
+		{
+			scenario: "all messages of the stream are delivered on the channel returned by Messages",
+			function: testReaderMessagesChannel,
+		},
+
+		{
+			scenario: "the channels returned by Messages are closed when the reader is closed",
+			function: testReaderMessagesChannelClose,
+		},
 	}
 
 	for _, test := range tests {
@@ -115,6 +134,41 @@ func testReaderReadMessages(t *testing.T, ctx context.Context, r *Reader) {
 	}
 }
 
+func testReaderMessagesChannel(t *testing.T, ctx context.Context, r *Reader) {
+	const N = 100
+	prepareReader(t, ctx, r, makeTestSequence(N)...)
+
+	msgs, errs := r.Messages(ctx)
+
+	for i := 0; i != N; i++ {
+		select {
+		case m := <-msgs:
+			v, _ := strconv.Atoi(string(m.Value))
+			if v != i {
+				t.Error("message at index", i, "has wrong value:", v)
+				return
+			}
+		case err := <-errs:
+			t.Error("reading message at index", i, "failed:", err)
+			return
+		}
+	}
+}
+
+func testReaderMessagesChannelClose(t *testing.T, ctx context.Context, r *Reader) {
+	msgs, errs := r.Messages(ctx)
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for range msgs {
+	}
+	if err, ok := <-errs; ok {
+		t.Error("unexpected error:", err)
+	}
+}
+
 func testReaderSetSpecialOffsets(t *testing.T, ctx context.Context, r *Reader) {
 	prepareReader(t, ctx, r, Message{Value: []byte("first")})
 	prepareReader(t, ctx, r, makeTestSequence(3)...)
@@ -1171,228 +1225,2343 @@ func testReaderConsumerGroupRebalanceAcrossManyPartitionsAndConsumers(t *testing
 	}
 }
 
-func TestOffsetStash(t *testing.T) {
-	const topic = "topic"
+func TestReaderMembership(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
 
-	newMessage := func(partition int, offset int64) Message {
-		return Message{
-			Topic:     topic,
-			Partition: partition,
-			Offset:    offset,
-		}
+	if err := broker.CreateTopic("topic-A", 2); err != nil {
+		t.Fatal(err)
 	}
 
-	tests := map[string]struct {
-		Given    offsetStash
-		Messages []Message
-		Expected offsetStash
-	}{
-		"nil": {},
-		"empty given, single message": {
-			Given:    offsetStash{},
-			Messages: []Message{newMessage(0, 0)},
-			Expected: offsetStash{
-				topic: {0: 1},
-			},
-		},
-		"ignores earlier offsets": {
-			Given: offsetStash{
-				topic: {0: 2},
-			},
-			Messages: []Message{newMessage(0, 0)},
-			Expected: offsetStash{
-				topic: {0: 2},
-			},
-		},
-		"uses latest offset": {
-			Given: offsetStash{},
-			Messages: []Message{
-				newMessage(0, 2),
-				newMessage(0, 3),
-				newMessage(0, 1),
-			},
-			Expected: offsetStash{
-				topic: {0: 4},
-			},
-		},
-		"uses latest offset, across multiple topics": {
-			Given: offsetStash{},
-			Messages: []Message{
-				newMessage(0, 2),
-				newMessage(0, 3),
-				newMessage(0, 1),
-				newMessage(1, 5),
-				newMessage(1, 6),
-			},
-			Expected: offsetStash{
-				topic: {
-					0: 4,
-					1: 7,
-				},
-			},
-		},
+	newReader := func() *Reader {
+		return NewReader(ReaderConfig{
+			Brokers:           []string{"localhost:9092"},
+			Topic:             "topic-A",
+			GroupID:           "group-A",
+			MaxWait:           100 * time.Millisecond,
+			HeartbeatInterval: 100 * time.Millisecond,
+			Dialer:            &Dialer{DialFunc: broker.Dial},
+		})
 	}
 
-	for label, test := range tests {
-		t.Run(label, func(t *testing.T) {
-			test.Given.merge(makeCommits(test.Messages...))
-			if !reflect.DeepEqual(test.Expected, test.Given) {
-				t.Errorf("expected %v; got %v", test.Expected, test.Given)
+	// waitMembership polls the membership of the readers until they are all
+	// members of the given generation.
+	waitMembership := func(generation int32, readers ...*Reader) []GroupMembership {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			memberships := make([]GroupMembership, len(readers))
+			complete := true
+			for i, r := range readers {
+				m, err := r.Membership()
+				if err != nil {
+					t.Fatal(err)
+				}
+				memberships[i] = m
+				complete = complete && m.GenerationID == generation
 			}
-		})
+			if complete {
+				return memberships
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for generation %d: %+v", generation, memberships)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
 	}
-}
-
-type mockOffsetCommitter struct {
-	invocations int
-	failCount   int
-	err         error
-}
 
-func (m *mockOffsetCommitter) offsetCommit(request offsetCommitRequestV2) (offsetCommitResponseV2, error) {
-	m.invocations++
+	r1 := newReader()
+	defer r1.Close()
 
-	if m.failCount > 0 {
-		m.failCount--
-		return offsetCommitResponseV2{}, io.EOF
+	m1 := waitMembership(1, r1)[0]
+	if m1.GroupID != "group-A" || m1.MemberID == "" || !m1.IsLeader {
+		t.Errorf("unexpected membership of the only member of the group: %+v", m1)
 	}
 
-	return offsetCommitResponseV2{}, nil
-}
+	r2 := newReader()
+	defer r2.Close()
 
-func TestValidateReader(t *testing.T) {
-	tests := []struct {
-		config       ReaderConfig
-		errorOccured bool
-	}{
-		{config: ReaderConfig{}, errorOccured: true},
-		{config: ReaderConfig{Brokers: []string{"broker1"}}, errorOccured: true},
-		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1"}, errorOccured: false},
-		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: -1}, errorOccured: true},
-		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: 1, MinBytes: -1}, errorOccured: true},
-		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: 1, MinBytes: 5, MaxBytes: -1}, errorOccured: true},
-		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: 1, MinBytes: 5, MaxBytes: 6}, errorOccured: false},
+	// The second reader joining the group triggers a rebalance, the first
+	// reader remains the leader.
+	m := waitMembership(2, r1, r2)
+	if m[0].MemberID != m1.MemberID || !m[0].IsLeader {
+		t.Errorf("unexpected membership of the leader: %+v", m[0])
 	}
-	for _, test := range tests {
-		err := test.config.Validate()
-		if test.errorOccured && err == nil {
-			t.Fail()
-		}
-		if !test.errorOccured && err != nil {
-			t.Fail()
-		}
+	if m[1].MemberID == "" || m[1].MemberID == m1.MemberID || m[1].IsLeader {
+		t.Errorf("unexpected membership of the follower: %+v", m[1])
+	}
+
+	if _, err := NewReader(ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "topic-A"}).Membership(); err == nil {
+		t.Error("expected an error for a reader without a consumer group")
 	}
 }
 
-func TestCommitLoopImmediateFlushOnGenerationEnd(t *testing.T) {
-	t.Parallel()
-	var committedOffset int64
-	var commitCount int
-	gen := &Generation{
-		conn: mockCoordinator{
-			offsetCommitFunc: func(r offsetCommitRequestV2) (offsetCommitResponseV2, error) {
-				commitCount++
-				committedOffset = r.Topics[0].Partitions[0].Offset
-				return offsetCommitResponseV2{}, nil
-			},
-		},
-		done:     make(chan struct{}),
-		log:      func(func(Logger)) {},
-		logError: func(func(Logger)) {},
-		joined:   make(chan struct{}),
+func TestReaderPartitions(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 6); err != nil {
+		t.Fatal(err)
 	}
 
-	// initialize commits so that the commitLoopImmediate select statement blocks
-	r := &Reader{stctx: context.Background(), commits: make(chan commitRequest, 100)}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
 
-	for i := 0; i < 100; i++ {
-		cr := commitRequest{
-			commits: []commit{{
-				topic:     "topic",
-				partition: 0,
-				offset:    int64(i) + 1,
-			}},
-			errch: make(chan<- error, 1),
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	for partition := 0; partition < 6; partition++ {
+		conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", partition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = conn.WriteMessages(
+			Message{Value: []byte(fmt.Sprintf("%d-0", partition))},
+			Message{Value: []byte(fmt.Sprintf("%d-1", partition))},
+		)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
 		}
-		r.commits <- cr
 	}
 
-	gen.Start(func(ctx context.Context) {
-		r.commitLoopImmediate(ctx, gen)
+	r := NewReader(ReaderConfig{
+		Brokers:    []string{"localhost:9092"},
+		Topic:      "topic-A",
+		Partitions: []int{2, 5},
+		MaxWait:    100 * time.Millisecond,
+		Dialer:     dialer,
 	})
+	defer r.Close()
 
-	gen.close()
+	readValues := func(n int) map[string]bool {
+		values := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			m, err := r.FetchMessage(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Partition != 2 && m.Partition != 5 {
+				t.Errorf("unexpected message of partition %d", m.Partition)
+			}
+			values[string(m.Value)] = true
+		}
+		return values
+	}
 
-	if committedOffset != 100 {
-		t.Fatalf("expected commited offset to be 100 but got %d", committedOffset)
+	want := map[string]bool{"2-0": true, "2-1": true, "5-0": true, "5-1": true}
+	if values := readValues(4); !reflect.DeepEqual(values, want) {
+		t.Errorf("unexpected messages: %v", values)
 	}
 
-	if commitCount >= 100 {
-		t.Fatalf("expected a single final commit on generation end got %d", commitCount)
+	if offsets := r.PartitionOffsets(); !reflect.DeepEqual(offsets, map[int]int64{2: 2, 5: 2}) {
+		t.Errorf("unexpected partition offsets: %v", offsets)
 	}
-}
 
-func TestCommitOffsetsWithRetry(t *testing.T) {
-	offsets := offsetStash{"topic": {0: 0}}
+	// Rewinding a partition reads its messages again.
+	if err := r.SetPartitionOffset(5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if values := readValues(1); !values["5-1"] {
+		t.Errorf("unexpected messages after rewinding partition 5: %v", values)
+	}
 
-	tests := map[string]struct {
-		Fails       int
-		Invocations int
-		HasError    bool
-	}{
-		"happy path": {
-			Invocations: 1,
-		},
-		"1 retry": {
-			Fails:       1,
-			Invocations: 2,
-		},
-		"out of retries": {
-			Fails:       defaultCommitRetries + 1,
-			Invocations: defaultCommitRetries,
-			HasError:    true,
-		},
+	if err := r.SetPartitionOffset(0, 0); err == nil {
+		t.Error("expected an error setting the offset of a partition not read by the reader")
 	}
+}
 
-	for label, test := range tests {
-		t.Run(label, func(t *testing.T) {
-			count := 0
-			gen := &Generation{
-				conn: mockCoordinator{
-					offsetCommitFunc: func(offsetCommitRequestV2) (offsetCommitResponseV2, error) {
-						count++
-						if count <= test.Fails {
-							return offsetCommitResponseV2{}, io.EOF
-						}
-						return offsetCommitResponseV2{}, nil
-					},
-				},
-				done:     make(chan struct{}),
-				log:      func(func(Logger)) {},
-				logError: func(func(Logger)) {},
+func TestReaderWaitForTopic(t *testing.T) {
+	for _, fetchByBroker := range []bool{false, true} {
+		t.Run(fmt.Sprintf("FetchByBroker=%t", fetchByBroker), func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+
+			dialer := &Dialer{DialFunc: broker.Dial}
+			client := &Client{Transport: &Transport{Dial: broker.Dial}}
+
+			produce := func(values ...string) {
+				t.Helper()
+				conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				msgs := make([]Message, len(values))
+				for i, v := range values {
+					msgs[i] = Message{Value: []byte(v)}
+				}
+				if _, err := conn.WriteMessages(msgs...); err != nil {
+					t.Fatal(err)
+				}
 			}
 
-			r := &Reader{stctx: context.Background()}
-			err := r.commitOffsetsWithRetry(gen, offsets, defaultCommitRetries)
-			switch {
-			case test.HasError && err == nil:
-				t.Error("bad err: expected not nil; got nil")
-			case !test.HasError && err != nil:
-				t.Errorf("bad err: expected nil; got %v", err)
+			if err := broker.CreateTopic("topic-A", 1); err != nil {
+				t.Fatal(err)
+			}
+			produce("0", "1")
+
+			r := NewReader(ReaderConfig{
+				Brokers:        []string{"localhost:9092"},
+				Topic:          "topic-A",
+				Partitions:     []int{0},
+				MaxWait:        100 * time.Millisecond,
+				ReadBackoffMin: 10 * time.Millisecond,
+				ReadBackoffMax: 50 * time.Millisecond,
+				FetchByBroker:  fetchByBroker,
+				WaitForTopic:   10 * time.Second,
+				Dialer:         dialer,
+				// Offsets restart from zero in the recreated topic.
+				OffsetOutOfRangeReset: OffsetResetEarliest,
+			})
+			defer r.Close()
+
+			expect := func(values ...string) {
+				t.Helper()
+				for _, v := range values {
+					m, err := r.ReadMessage(ctx)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if string(m.Value) != v {
+						t.Fatalf("expected message %q, got %q", v, m.Value)
+					}
+				}
+			}
+
+			expect("0", "1")
+
+			res, err := client.DeleteTopics(ctx, &DeleteTopicsRequest{
+				Addr:   TCP("localhost:9092"),
+				Topics: []string{"topic-A"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := res.Errors["topic-A"]; err != nil {
+				t.Fatal(err)
+			}
+
+			// Give the reader time to observe that the topic was deleted.
+			time.Sleep(500 * time.Millisecond)
+
+			if err := broker.CreateTopic("topic-A", 1); err != nil {
+				t.Fatal(err)
 			}
+			produce("2")
+
+			expect("2")
 		})
 	}
 }
 
-// Test that a reader won't continually rebalance when there are more consumers
-// than partitions in a group.
-// https://github.com/segmentio/kafka-go/issues/200
-func TestRebalanceTooManyConsumers(t *testing.T) {
-	ctx := context.Background()
-	conf := ReaderConfig{
-		Brokers: []string{"localhost:9092"},
-		GroupID: makeGroupID(),
-		Topic:   makeTopic(),
+func TestReaderWaitForTopicTimeout(t *testing.T) {
+	for _, fetchByBroker := range []bool{false, true} {
+		t.Run(fmt.Sprintf("FetchByBroker=%t", fetchByBroker), func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+
+			if err := broker.CreateTopic("topic-A", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			r := NewReader(ReaderConfig{
+				Brokers:        []string{"localhost:9092"},
+				Topic:          "topic-A",
+				Partitions:     []int{0},
+				MaxWait:        100 * time.Millisecond,
+				ReadBackoffMin: 10 * time.Millisecond,
+				ReadBackoffMax: 50 * time.Millisecond,
+				FetchByBroker:  fetchByBroker,
+				WaitForTopic:   500 * time.Millisecond,
+				Dialer:         &Dialer{DialFunc: broker.Dial},
+			})
+			defer r.Close()
+
+			client := &Client{Transport: &Transport{Dial: broker.Dial}}
+			if _, err := client.DeleteTopics(ctx, &DeleteTopicsRequest{
+				Addr:   TCP("localhost:9092"),
+				Topics: []string{"topic-A"},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			if _, err := r.ReadMessage(ctx); !errors.Is(err, UnknownTopicOrPartition) {
+				t.Fatalf("expected UnknownTopicOrPartition, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+				t.Errorf("the error was reported after %s, before the topic wait expired", elapsed)
+			}
+		})
+	}
+}
+
+func TestReaderOnCaughtUp(t *testing.T) {
+	for _, fetchByBroker := range []bool{false, true} {
+		t.Run(fmt.Sprintf("FetchByBroker=%t", fetchByBroker), func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			if err := broker.CreateTopic("topic-A", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+
+			dialer := &Dialer{DialFunc: broker.Dial}
+
+			// Messages are only produced to partition 0, partition 1 is empty.
+			produce := func(values ...string) {
+				t.Helper()
+				conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer conn.Close()
+				msgs := make([]Message, len(values))
+				for i, v := range values {
+					msgs[i] = Message{Value: []byte(v)}
+				}
+				if _, err := conn.WriteMessages(msgs...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			produce("0", "1")
+
+			var caughtUp int32
+			r := NewReader(ReaderConfig{
+				Brokers:       []string{"localhost:9092"},
+				Topic:         "topic-A",
+				Partitions:    []int{0, 1},
+				MaxWait:       100 * time.Millisecond,
+				FetchByBroker: fetchByBroker,
+				Dialer:        dialer,
+				OnCaughtUp:    func() { atomic.AddInt32(&caughtUp, 1) },
+			})
+			defer r.Close()
+
+			read := func(value string) {
+				t.Helper()
+				m, err := r.FetchMessage(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(m.Value) != value {
+					t.Fatalf("expected message %q, got %q", value, m.Value)
+				}
+			}
+
+			// wait blocks in FetchMessage until the reader reports that it
+			// caught up for the given number of times.
+			wait := func(n int32) {
+				t.Helper()
+				for atomic.LoadInt32(&caughtUp) < n {
+					waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+					_, err := r.FetchMessage(waitCtx)
+					cancel()
+					if !errors.Is(err, context.DeadlineExceeded) {
+						t.Fatalf("expected no messages, got %v", err)
+					}
+				}
+				if count := atomic.LoadInt32(&caughtUp); count != n {
+					t.Fatalf("expected the reader to catch up %d times, got %d", n, count)
+				}
+			}
+
+			read("0")
+			if count := atomic.LoadInt32(&caughtUp); count != 0 {
+				t.Fatalf("the reader caught up before reading all the messages (%d)", count)
+			}
+			read("1")
+			wait(1)
+
+			// The notification is re-armed when new messages are produced.
+			produce("2")
+			read("2")
+			wait(2)
+		})
+	}
+}
+
+func TestReaderStopAt(t *testing.T) {
+	t0 := time.Now().Truncate(time.Millisecond).Add(-time.Hour)
+
+	tests := []struct {
+		scenario string
+		config   ReaderConfig
+		values   []string
+	}{
+		{
+			scenario: "StopAtOffset",
+			config:   ReaderConfig{StopAtOffset: 3},
+			values:   []string{"0", "1", "2"},
+		},
+		{
+			scenario: "StopAtOffset beyond the high water mark",
+			config:   ReaderConfig{StopAtOffset: 100},
+			values:   []string{"0", "1", "2", "3", "4"},
+		},
+		{
+			scenario: "StopAtTime",
+			config:   ReaderConfig{StopAtTime: t0.Add(2 * time.Second)},
+			values:   []string{"0", "1"},
+		},
+		{
+			scenario: "StopAtTime beyond the last message",
+			config:   ReaderConfig{StopAtTime: t0.Add(time.Hour)},
+			values:   []string{"0", "1", "2", "3", "4"},
+		},
+		{
+			scenario: "StopAtOffset before StopAtTime",
+			config:   ReaderConfig{StopAtOffset: 1, StopAtTime: t0.Add(2 * time.Second)},
+			values:   []string{"0"},
+		},
+	}
+
+	for _, fetchByBroker := range []bool{false, true} {
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s/FetchByBroker=%t", test.scenario, fetchByBroker), func(t *testing.T) {
+				broker := &ktesting.Broker{}
+				defer broker.Close()
+
+				if err := broker.CreateTopic("topic-A", 2); err != nil {
+					t.Fatal(err)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+				defer cancel()
+
+				dialer := &Dialer{DialFunc: broker.Dial}
+
+				// Messages are only produced to partition 0, partition 1 is
+				// empty and done as soon as the reader starts.
+				produce := func(values ...string) {
+					t.Helper()
+					conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer conn.Close()
+					msgs := make([]Message, len(values))
+					for i, v := range values {
+						msgs[i] = Message{Value: []byte(v), Time: t0.Add(time.Duration(i) * time.Second)}
+					}
+					if _, err := conn.WriteMessages(msgs...); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				produce("0", "1", "2", "3", "4")
+
+				config := test.config
+				config.Brokers = []string{"localhost:9092"}
+				config.Topic = "topic-A"
+				config.Partitions = []int{0, 1}
+				config.MaxWait = 100 * time.Millisecond
+				config.FetchByBroker = fetchByBroker
+				config.Dialer = dialer
+
+				r := NewReader(config)
+				defer r.Close()
+
+				for _, value := range test.values {
+					m, err := r.FetchMessage(ctx)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if string(m.Value) != value {
+						t.Fatalf("expected message %q, got %q", value, m.Value)
+					}
+				}
+
+				// Messages produced after the reader started are beyond the
+				// high water mark that the range was bounded to.
+				produce("5")
+
+				for i := 0; i < 2; i++ {
+					if m, err := r.FetchMessage(ctx); !errors.Is(err, io.EOF) {
+						t.Fatalf("expected io.EOF after the end of the range, got %q (%v)", m.Value, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestReaderConfigPartitions(t *testing.T) {
+	tests := []struct {
+		scenario string
+		config   ReaderConfig
+	}{
+		{
+			scenario: "with GroupID",
+			config:   ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "topic-A", GroupID: "group-A", Partitions: []int{1}},
+		},
+		{
+			scenario: "with Partition",
+			config:   ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "topic-A", Partition: 1, Partitions: []int{2}},
+		},
+		{
+			scenario: "negative partition",
+			config:   ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "topic-A", Partitions: []int{-1}},
+		},
+		{
+			scenario: "duplicate partition",
+			config:   ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "topic-A", Partitions: []int{1, 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if err := test.config.Validate(); err == nil {
+				t.Error("expected an error validating the configuration")
+			}
+		})
+	}
+}
+
+func TestReaderWatchPartitionChanges(t *testing.T) {
+	for _, groupProtocol := range []GroupProtocol{GroupProtocolClassic, GroupProtocolConsumer} {
+		t.Run(groupProtocol.String(), func(t *testing.T) {
+			testReaderWatchPartitionChanges(t, groupProtocol)
+		})
+	}
+}
+
+func testReaderWatchPartitionChanges(t *testing.T, groupProtocol GroupProtocol) {
+	broker := &ktesting.Broker{ConsumerGroupHeartbeatInterval: 100 * time.Millisecond}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	produce := func(partition int, value string) {
+		conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", partition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.WriteMessages(Message{Value: []byte(value)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers:                []string{"localhost:9092"},
+		Topic:                  "topic-A",
+		GroupID:                "group-A",
+		GroupProtocol:          groupProtocol,
+		MaxWait:                100 * time.Millisecond,
+		HeartbeatInterval:      100 * time.Millisecond,
+		WatchPartitionChanges:  true,
+		PartitionWatchInterval: 100 * time.Millisecond,
+		Dialer:                 dialer,
+	})
+	defer r.Close()
+
+	produce(0, "hello")
+
+	m, err := r.ReadMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Partition != 0 || string(m.Value) != "hello" {
+		t.Fatalf("unexpected message: partition=%d value=%q", m.Partition, m.Value)
+	}
+
+	// With the classic protocol the reader rebalances the group when it sees
+	// the new partition, with the consumer protocol the broker assigns it on
+	// the next heartbeat.
+	if err := broker.CreatePartitions("topic-A", 2); err != nil {
+		t.Fatal(err)
+	}
+	produce(1, "world")
+
+	m, err = r.ReadMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Partition != 1 || string(m.Value) != "world" {
+		t.Fatalf("unexpected message: partition=%d value=%q", m.Partition, m.Value)
+	}
+}
+
+func TestReaderCommitMetadata(t *testing.T) {
+	for _, groupProtocol := range []GroupProtocol{GroupProtocolClassic, GroupProtocolConsumer} {
+		t.Run(groupProtocol.String(), func(t *testing.T) {
+			testReaderCommitMetadata(t, groupProtocol)
+		})
+	}
+}
+
+func testReaderCommitMetadata(t *testing.T, groupProtocol GroupProtocol) {
+	broker := &ktesting.Broker{ConsumerGroupHeartbeatInterval: 100 * time.Millisecond}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.WriteMessages(Message{Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers:           []string{"localhost:9092"},
+		Topic:             "topic-A",
+		GroupID:           "group-A",
+		GroupProtocol:     groupProtocol,
+		MaxWait:           100 * time.Millisecond,
+		HeartbeatInterval: 100 * time.Millisecond,
+		CommitMetadata:    "host-A",
+		Dialer:            dialer,
+	})
+	defer r.Close()
+
+	m, err := r.FetchMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.CommitMessages(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: &Transport{Dial: broker.Dial},
+	}
+	res, err := client.OffsetFetch(ctx, &OffsetFetchRequest{
+		GroupID: "group-A",
+		Topics:  map[string][]int{"topic-A": {0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := res.Topics["topic-A"][0]
+	if p.CommittedOffset != m.Offset+1 || p.Metadata != "host-A" {
+		t.Errorf("unexpected committed offset: offset=%d metadata=%q", p.CommittedOffset, p.Metadata)
+	}
+}
+
+func TestReaderCommitReturnsOffsets(t *testing.T) {
+	broker := &ktesting.Broker{ConsumerGroupHeartbeatInterval: 100 * time.Millisecond}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.WriteMessages(Message{Value: []byte("hello")}, Message{Value: []byte("world")}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers:           []string{"localhost:9092"},
+		Topic:             "topic-A",
+		GroupID:           "group-A",
+		MaxWait:           100 * time.Millisecond,
+		HeartbeatInterval: 100 * time.Millisecond,
+		Dialer:            dialer,
+	})
+	defer r.Close()
+
+	m1, err := r.FetchMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := r.FetchMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	committed, err := r.Commit(ctx, m2, m1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[int]int64{"topic-A": {0: m2.Offset + 1}}
+	if !reflect.DeepEqual(committed, want) {
+		t.Errorf("unexpected committed offsets: want=%v got=%v", want, committed)
+	}
+}
+
+func TestReaderCommitRequiresSyncCommits(t *testing.T) {
+	r := NewReader(ReaderConfig{
+		Brokers:        []string{"localhost:9092"},
+		Topic:          "topic-A",
+		GroupID:        "group-A",
+		CommitInterval: time.Second,
+	})
+	defer r.Close()
+
+	if _, err := r.Commit(context.Background(), Message{Topic: "topic-A"}); err == nil {
+		t.Error("expected an error committing with asynchronous commits")
+	}
+}
+
+func TestReaderConfigCommitMetadataTooLarge(t *testing.T) {
+	config := ReaderConfig{
+		Brokers:        []string{"localhost:9092"},
+		Topic:          "topic-A",
+		GroupID:        "group-A",
+		CommitMetadata: strings.Repeat("x", maxCommitMetadataSize+1),
+	}
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error when the commit metadata exceeds the maximum size")
+	}
+}
+
+func TestReaderValidateOffset(t *testing.T) {
+	tests := []struct {
+		scenario    string
+		detect      bool
+		leaderEpoch int32
+		endOffset   int64
+		offset      int64
+		expected    int64
+		truncated   bool
+	}{
+		{
+			scenario:    "the offset is kept when the log was not truncated",
+			detect:      true,
+			leaderEpoch: 3,
+			endOffset:   12,
+			offset:      10,
+			expected:    10,
+		},
+		{
+			scenario:    "the reader resumes from the divergence when the log was truncated",
+			detect:      true,
+			leaderEpoch: 3,
+			endOffset:   6,
+			offset:      10,
+			expected:    6,
+			truncated:   true,
+		},
+		{
+			scenario:    "the offset is kept when the broker knows no prior epoch",
+			detect:      true,
+			leaderEpoch: 3,
+			endOffset:   -1,
+			offset:      10,
+			expected:    10,
+		},
+		{
+			scenario:    "the offset is not validated when the leader epoch is unknown",
+			detect:      true,
+			leaderEpoch: -1,
+			offset:      10,
+			expected:    10,
+		},
+		{
+			scenario:    "the offset is not validated when the detection is disabled",
+			leaderEpoch: 3,
+			offset:      10,
+			expected:    10,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			conn := NewConnWith(client, ConnConfig{Topic: "topic-A", Partition: 1})
+			defer conn.Close()
+
+			requests := 0
+			go func() {
+				for {
+					var header [12]byte
+					if _, err := io.ReadFull(server, header[:]); err != nil {
+						return
+					}
+					size := int32(binary.BigEndian.Uint32(header[:4]))
+					apiKey := int16(binary.BigEndian.Uint16(header[4:6]))
+					id := int32(binary.BigEndian.Uint32(header[8:12]))
+					if _, err := io.CopyN(ioutil.Discard, server, int64(size-8)); err != nil {
+						return
+					}
+
+					switch apiKey {
+					case int16(protocol.ApiVersions):
+						protocol.WriteResponse(server, 0, id, &apiversions.Response{
+							ApiKeys: []apiversions.ApiKeyResponse{
+								{ApiKey: int16(protocol.OffsetForLeaderEpoch), MinVersion: 0, MaxVersion: 3},
+							},
+						})
+					case int16(protocol.OffsetForLeaderEpoch):
+						requests++
+						res := offsetForLeaderEpochResponseV2{
+							Topics: []offsetForLeaderEpochResponseTopicV2{{
+								TopicName: "topic-A",
+								Partitions: []offsetForLeaderEpochResponsePartitionV2{{
+									Partition:   1,
+									LeaderEpoch: 2,
+									EndOffset:   test.endOffset,
+								}},
+							}},
+						}
+						b := &bytes.Buffer{}
+						w := &writeBuffer{w: b}
+						w.writeInt32(4 + res.size())
+						w.writeInt32(id)
+						res.writeTo(w)
+						server.Write(b.Bytes())
+					}
+				}
+			}()
+
+			var truncations [][2]int64
+			r := &reader{
+				topic:       "topic-A",
+				partition:   1,
+				detectTrunc: test.detect,
+				leaderEpoch: test.leaderEpoch,
+				onTruncation: func(topic string, partition int, offset, divergence int64) {
+					if topic != "topic-A" || partition != 1 {
+						t.Errorf("truncation reported on partition %d of %s", partition, topic)
+					}
+					truncations = append(truncations, [2]int64{offset, divergence})
+				},
+			}
+
+			offset, err := r.validateOffset(conn, test.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset != test.expected {
+				t.Errorf("expected offset %d but got %d", test.expected, offset)
+			}
+
+			switch {
+			case test.truncated:
+				if len(truncations) != 1 || truncations[0] != [2]int64{test.offset, test.endOffset} {
+					t.Errorf("expected a truncation from %d to %d, got %v", test.offset, test.endOffset, truncations)
+				}
+				if r.leaderEpoch != 2 {
+					t.Errorf("expected the leader epoch to be updated to 2, got %d", r.leaderEpoch)
+				}
+			case len(truncations) != 0:
+				t.Errorf("unexpected truncations: %v", truncations)
+			}
+
+			if validated := test.detect && test.leaderEpoch >= 0; validated != (requests != 0) {
+				t.Errorf("expected validation=%t but %d requests were sent", validated, requests)
+			}
+		})
+	}
+}
+
+func TestReaderLeaderEpochChange(t *testing.T) {
+	tests := []struct {
+		scenario string
+		err      Error
+		failures int32
+		reported bool
+	}{
+		{
+			scenario: "unknown leader epoch errors are retried",
+			err:      UnknownLeaderEpoch,
+			failures: 2,
+		},
+		{
+			scenario: "fenced leader epoch errors are retried",
+			err:      FencedLeaderEpoch,
+			failures: 2,
+		},
+		{
+			scenario: "leader epoch errors are reported after MaxAttempts",
+			err:      UnknownLeaderEpoch,
+			failures: 3,
+			reported: true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.scenario, func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			if err := broker.CreateTopic("topic-A", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			conn, err := (&Dialer{DialFunc: broker.Dial}).DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = conn.WriteMessages(Message{Value: []byte("0")}, Message{Value: []byte("1")})
+			conn.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			proxy := &fetchErrorProxy{broker: broker, code: test.err, failures: test.failures}
+			var dials int32
+			r := NewReader(ReaderConfig{
+				Brokers:        []string{"localhost:9092"},
+				Topic:          "topic-A",
+				MaxWait:        100 * time.Millisecond,
+				MaxAttempts:    3,
+				ReadBackoffMin: 10 * time.Millisecond,
+				ReadBackoffMax: 10 * time.Millisecond,
+				Dialer: &Dialer{DialFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+					atomic.AddInt32(&dials, 1)
+					return proxy.Dial(ctx, network, address)
+				}},
+			})
+			defer r.Close()
+
+			if test.reported {
+				if _, err := r.ReadMessage(ctx); !errors.Is(err, test.err) {
+					t.Fatalf("expected %v but got %v", test.err, err)
+				}
+			}
+
+			for i := 0; i < 2; i++ {
+				m, err := r.ReadMessage(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if m.Offset != int64(i) || string(m.Value) != strconv.Itoa(i) {
+					t.Errorf("unexpected message at offset %d: %q", m.Offset, m.Value)
+				}
+			}
+
+			// The reader reconnects to the leader of the partition after each
+			// leader epoch error.
+			if n := atomic.LoadInt32(&dials); n <= test.failures {
+				t.Errorf("expected more than %d connections but %d were opened", test.failures, n)
+			}
+			if n := r.Stats().Rebalances; n != int64(test.failures) {
+				t.Errorf("expected %d rebalances but got %d", test.failures, n)
+			}
+		})
+	}
+}
+
+func TestReaderFetchByBrokerLeaderChange(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := (&Dialer{DialFunc: broker.Dial}).DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.WriteMessages(Message{Value: []byte("0")}, Message{Value: []byte("1")})
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const failures = 3
+	proxy := &fetchErrorProxy{broker: broker, code: NotLeaderForPartition, failures: failures}
+	r := NewReader(ReaderConfig{
+		Brokers:        []string{"localhost:9092"},
+		Topic:          "topic-A",
+		FetchByBroker:  true,
+		MaxWait:        100 * time.Millisecond,
+		ReadBackoffMin: 10 * time.Millisecond,
+		ReadBackoffMax: 10 * time.Millisecond,
+		Dialer:         &Dialer{DialFunc: proxy.Dial},
+	})
+	defer r.Close()
+
+	for i := 0; i < 2; i++ {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Offset != int64(i) || string(m.Value) != strconv.Itoa(i) {
+			t.Errorf("unexpected message at offset %d: %q", m.Offset, m.Value)
+		}
+	}
+
+	// The metadata cached by the transport is refreshed after each change of
+	// leadership, in addition to the initial lookup.
+	if n := atomic.LoadInt32(&proxy.metadata); n <= failures {
+		t.Errorf("expected more than %d metadata requests but %d were sent", failures, n)
+	}
+	if n := r.Stats().Rebalances; n != failures {
+		t.Errorf("expected %d rebalances but got %d", failures, n)
+	}
+}
+
+// fetchErrorProxy forwards requests to a mock broker, and responds to fetch
+// requests with the error code until failures reaches zero, simulating a change
+// of leadership which the client has not observed yet. The metadata requests
+// which were forwarded are counted.
+type fetchErrorProxy struct {
+	broker   *ktesting.Broker
+	code     Error
+	failures int32
+	metadata int32
+}
+
+func (p *fetchErrorProxy) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	upstream, err := p.broker.Dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		defer upstream.Close()
+
+		r := bufio.NewReader(server)
+		u := bufio.NewReader(upstream)
+
+		for {
+			version, id, clientID, req, err := protocol.ReadRequest(r)
+			if err != nil {
+				return
+			}
+			if req.ApiKey() == protocol.Metadata {
+				atomic.AddInt32(&p.metadata, 1)
+			}
+			if protocol.WriteRequest(upstream, version, id, clientID, req) != nil {
+				return
+			}
+			_, res, err := protocol.ReadResponse(u, req.ApiKey(), version)
+			if err != nil {
+				return
+			}
+			if f, ok := res.(*fetchAPI.Response); ok && atomic.AddInt32(&p.failures, -1) >= 0 {
+				for i := range f.Topics {
+					for j := range f.Topics[i].Partitions {
+						part := &f.Topics[i].Partitions[j]
+						part.ErrorCode = int16(p.code)
+						part.RecordSet = protocol.RecordSet{}
+					}
+				}
+			}
+			if protocol.WriteResponse(server, version, id, res) != nil {
+				return
+			}
+		}
+	}()
+
+	return client, nil
+}
+
+func TestReaderMaxLag(t *testing.T) {
+	for _, fetchByBroker := range []bool{false, true} {
+		t.Run(fmt.Sprintf("FetchByBroker=%t", fetchByBroker), func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			if err := broker.CreateTopic("topic-A", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+
+			dialer := &Dialer{DialFunc: broker.Dial}
+
+			conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := conn.WriteMessages(makeTestSequence(10)...); err != nil {
+				t.Fatal(err)
+			}
+
+			skipped := make(chan int64, 1)
+			r := NewReader(ReaderConfig{
+				Brokers:       []string{"localhost:9092"},
+				Topic:         "topic-A",
+				MaxWait:       100 * time.Millisecond,
+				MaxLag:        5,
+				FetchByBroker: fetchByBroker,
+				Dialer:        dialer,
+				OnMaxLag: func(topic string, partition int, n int64) {
+					if topic != "topic-A" || partition != 0 {
+						t.Errorf("unexpected partition %d of %s", partition, topic)
+					}
+					skipped <- n
+				},
+			})
+			defer r.Close()
+
+			done := make(chan Message, 1)
+			go func() {
+				m, err := r.ReadMessage(ctx)
+				if err != nil {
+					t.Error(err)
+				}
+				done <- m
+			}()
+
+			select {
+			case n := <-skipped:
+				if n != 10 {
+					t.Fatalf("expected 10 skipped messages, got %d", n)
+				}
+			case <-ctx.Done():
+				t.Fatal(ctx.Err())
+			}
+
+			if _, err := conn.WriteMessages(makeTestSequence(2)...); err != nil {
+				t.Fatal(err)
+			}
+
+			if m := <-done; m.Offset != 10 {
+				t.Fatalf("expected the reader to resume at offset 10, got %d", m.Offset)
+			}
+		})
+	}
+}
+
+// truncatedMessageSet is a message set truncated to a maximum size, like the
+// kafka versions older than 0.10.1 do when the first record of a fetch does
+// not fit in the maximum size of the response.
+type truncatedMessageSet struct {
+	messageSetBuilder
+	maxBytes int
+}
+
+func (s truncatedMessageSet) bytes() []byte {
+	b := s.messageSetBuilder.bytes()
+	if len(b) > s.maxBytes {
+		b = b[:s.maxBytes]
+	}
+	return b
+}
+
+func TestReaderGrowFetchBytes(t *testing.T) {
+	tests := []struct {
+		scenario       string
+		maxRecordBytes int
+		fetches        int
+		tooLarge       bool
+	}{
+		{scenario: "the fetch size grows until the record fits", maxRecordBytes: 1e6, fetches: 3},
+		{scenario: "an error is reported when the fetch size cannot grow", maxRecordBytes: 2000, fetches: 2, tooLarge: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			conn := NewConnWith(client, ConnConfig{Topic: "topic-A"})
+			defer conn.Close()
+			conn.Seek(0, SeekAbsolute|SeekDontCheck)
+
+			record := v2MessageSetBuilder{msgs: []Message{{Offset: 0, Value: make([]byte, 3000), Time: time.Now()}}}
+			fetchSizes := make(chan int, 10)
+
+			go func() {
+				for {
+					apiVersion, id, _, msg, err := protocol.ReadRequest(server)
+					if err != nil {
+						return
+					}
+
+					switch req := msg.(type) {
+					case *apiversions.Request:
+						res := &apiversions.Response{
+							ApiKeys: []apiversions.ApiKeyResponse{{ApiKey: int16(protocol.Fetch), MinVersion: 0, MaxVersion: 10}},
+						}
+						if err := protocol.WriteResponse(server, apiVersion, id, res); err != nil {
+							return
+						}
+
+					case *fetchAPI.Request:
+						maxBytes := int(req.Topics[0].Partitions[0].PartitionMaxBytes)
+						fetchSizes <- maxBytes
+
+						fetch := fetchResponseBuilder{
+							header:  fetchResponseHeader{topic: "topic-A", highWatermarkOffset: 1, lastStableOffset: 1},
+							msgSets: []messageSetBuilder{truncatedMessageSet{messageSetBuilder: record, maxBytes: maxBytes}},
+						}
+						body := fetch.bytes()
+						header := make([]byte, 8)
+						binary.BigEndian.PutUint32(header, uint32(4+len(body)))
+						binary.BigEndian.PutUint32(header[4:], uint32(id))
+						if _, err := server.Write(append(header, body...)); err != nil {
+							return
+						}
+
+					default:
+						return
+					}
+				}
+			}()
+
+			msgs := make(chan readerMessage, 10)
+			r := &reader{
+				topic:          "topic-A",
+				minBytes:       1,
+				maxBytes:       1000,
+				maxRecordBytes: test.maxRecordBytes,
+				maxWait:        100 * time.Millisecond,
+				msgs:           msgs,
+				stats:          &readerStats{},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// The fetch which cannot grow returns the error, so the reader
+			// reports it and retries after a backoff.
+			offset := int64(0)
+			var err error
+			for i := 0; i < test.fetches; i++ {
+				if offset, err = r.read(ctx, offset, conn); err != io.EOF && !(test.tooLarge && i == test.fetches-1) {
+					t.Fatalf("fetch #%d: expected io.EOF but got %v", i, err)
+				}
+			}
+
+			var sizes []int
+			for i := 0; i < test.fetches; i++ {
+				sizes = append(sizes, <-fetchSizes-int(conn.fetchMinSize))
+			}
+			if want := []int{1000, 2000, 4000}[:test.fetches]; !reflect.DeepEqual(sizes, want) {
+				t.Errorf("expected fetches of %v bytes but got %v", want, sizes)
+			}
+
+			if test.tooLarge {
+				var tooLarge RecordTooLargeError
+				if !errors.As(err, &tooLarge) || !errors.Is(err, MessageSizeTooLarge) {
+					t.Fatalf("expected a RecordTooLargeError but got %v", err)
+				}
+				if tooLarge.Offset != 0 || tooLarge.MaxBytes != 2000 {
+					t.Errorf("unexpected error: %+v", tooLarge)
+				}
+				return
+			}
+
+			m := <-msgs
+			if m.error != nil || len(m.message.Value) != 3000 {
+				t.Fatalf("expected the large record to be read, got error %v", m.error)
+			}
+			if offset != 1 || r.fetchBytes != 0 {
+				t.Errorf("expected the reader to be at offset 1 with the default fetch size, got offset %d and fetch size %d", offset, r.fetchBytes)
+			}
+		})
+	}
+}
+
+func TestReaderConsumePartitions(t *testing.T) {
+	broker := &ktesting.Broker{ConsumerGroupHeartbeatInterval: 100 * time.Millisecond}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	for partition := 0; partition < 2; partition++ {
+		conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", partition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = conn.WriteMessages(makeTestSequence(10)...)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newReader := func() *Reader {
+		return NewReader(ReaderConfig{
+			Brokers:           []string{"localhost:9092"},
+			Topic:             "topic-A",
+			GroupID:           "group-A",
+			MaxWait:           100 * time.Millisecond,
+			HeartbeatInterval: 100 * time.Millisecond,
+			Dialer:            dialer,
+		})
+	}
+
+	type event struct {
+		partition int
+		offset    int64
+		err       error
+	}
+	events := make(chan event, 100)
+
+	r := newReader()
+	defer r.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.ConsumePartitions(ctx, func(ctx context.Context, p *PartitionConsumer) {
+			for {
+				m, err := p.FetchMessage(ctx)
+				if err != nil {
+					events <- event{partition: p.Partition, err: err}
+					return
+				}
+				if m.Partition != p.Partition {
+					t.Errorf("message of partition %d delivered to the consumer of partition %d", m.Partition, p.Partition)
+				}
+				if err := p.CommitMessages(ctx, m); err != nil {
+					t.Error(err)
+				}
+				events <- event{partition: p.Partition, offset: m.Offset}
+			}
+		})
+	}()
+
+	next := map[int]int64{}
+	for i := 0; i < 20; i++ {
+		select {
+		case e := <-events:
+			if e.err != nil {
+				t.Fatalf("unexpected error on partition %d: %v", e.partition, e.err)
+			}
+			if e.offset != next[e.partition] {
+				t.Fatalf("partition %d: expected offset %d but got %d", e.partition, next[e.partition], e.offset)
+			}
+			next[e.partition]++
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		}
+	}
+
+	// A second member joining the group takes one of the partitions, the
+	// worker of this partition must stop.
+	r2 := newReader()
+	defer r2.Close()
+	go r2.ReadMessage(ctx)
+
+	select {
+	case e := <-events:
+		if !errors.Is(e.err, io.EOF) {
+			t.Fatalf("expected the worker of partition %d to stop, got offset %d and error %v", e.partition, e.offset, e.err)
+		}
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+
+	r.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ConsumePartitions(ctx, nil); err != nil {
+		t.Errorf("expected ConsumePartitions to return nil on a closed reader, got %v", err)
+	}
+}
+
+func TestReaderConsumePartitionsSlowWorker(t *testing.T) {
+	for _, fetchByBroker := range []bool{false, true} {
+		fetchByBroker := fetchByBroker
+		t.Run(fmt.Sprintf("fetch by broker %t", fetchByBroker), func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			if err := broker.CreateTopic("topic-A", 2); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+			defer cancel()
+
+			dialer := &Dialer{DialFunc: broker.Dial}
+
+			for partition := 0; partition < 2; partition++ {
+				conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", partition)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = conn.WriteMessages(makeTestSequence(10)...)
+				conn.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := NewReader(ReaderConfig{
+				Brokers:       []string{"localhost:9092"},
+				Topic:         "topic-A",
+				GroupID:       "group-A",
+				MaxWait:       100 * time.Millisecond,
+				QueueCapacity: 1,
+				FetchByBroker: fetchByBroker,
+				Dialer:        dialer,
+			})
+			defer r.Close()
+
+			// The worker of partition 0 does not read messages until all the
+			// messages of partition 1 were delivered.
+			release := make(chan struct{})
+			offsets := make(chan [2]int64, 20)
+
+			done := make(chan error, 1)
+			go func() {
+				done <- r.ConsumePartitions(ctx, func(ctx context.Context, p *PartitionConsumer) {
+					if p.Partition == 0 {
+						select {
+						case <-release:
+						case <-ctx.Done():
+							return
+						}
+					}
+					for {
+						m, err := p.FetchMessage(ctx)
+						if err != nil {
+							return
+						}
+						offsets <- [2]int64{int64(m.Partition), m.Offset}
+					}
+				})
+			}()
+
+			next := [2]int64{}
+			for i := 0; i < 20; i++ {
+				if i == 10 {
+					close(release)
+				}
+				select {
+				case o := <-offsets:
+					if i < 10 && o[0] != 1 {
+						t.Fatalf("message %d of partition %d delivered before the messages of partition 1", o[1], o[0])
+					}
+					if o[1] != next[o[0]] {
+						t.Fatalf("partition %d: expected offset %d but got %d", o[0], next[o[0]], o[1])
+					}
+					next[o[0]]++
+				case <-ctx.Done():
+					t.Fatalf("only %d messages delivered: %v", i, ctx.Err())
+				}
+			}
+
+			r.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestReaderAck(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.WriteMessages(makeTestSequence(5)...); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers:           []string{"localhost:9092"},
+		Topic:             "topic-A",
+		GroupID:           "group-A",
+		MaxWait:           100 * time.Millisecond,
+		HeartbeatInterval: 100 * time.Millisecond,
+		AckMessages:       true,
+		Dialer:            dialer,
+	})
+	defer r.Close()
+
+	msgs := make([]Message, 5)
+	for i := range msgs {
+		if msgs[i], err = r.FetchMessage(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := r.PendingAcks(); n != 5 {
+		t.Fatalf("expected 5 pending acks, got %d", n)
+	}
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: &Transport{Dial: broker.Dial},
+	}
+	committedOffset := func() int64 {
+		res, err := client.OffsetFetch(ctx, &OffsetFetchRequest{
+			GroupID: "group-A",
+			Topics:  map[string][]int{"topic-A": {0}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Topics["topic-A"][0].CommittedOffset
+	}
+
+	tests := []struct {
+		ack       int
+		pending   int
+		committed int64
+	}{
+		{ack: 1, pending: 4, committed: -1},
+		{ack: 3, pending: 3, committed: -1},
+		{ack: 3, pending: 3, committed: -1},
+		{ack: 0, pending: 2, committed: msgs[1].Offset + 1},
+		{ack: 2, pending: 1, committed: msgs[3].Offset + 1},
+		{ack: 4, pending: 0, committed: msgs[4].Offset + 1},
+	}
+
+	for _, test := range tests {
+		if err := r.Ack(ctx, msgs[test.ack]); err != nil {
+			t.Fatal(err)
+		}
+		if n := r.PendingAcks(); n != test.pending {
+			t.Errorf("after acking message %d: expected %d pending acks, got %d", test.ack, test.pending, n)
+		}
+		if offset := committedOffset(); offset != test.committed {
+			t.Errorf("after acking message %d: expected committed offset %d, got %d", test.ack, test.committed, offset)
+		}
+	}
+}
+
+func TestReaderAckRebalance(t *testing.T) {
+	acks := newAckTracker()
+	acks.reset(1)
+
+	msgs := make([]Message, 4)
+	for i := range msgs {
+		msgs[i] = Message{Topic: "topic-A", Partition: i % 2, Offset: int64(i / 2)}
+		msgs[i].generation = acks.track(msgs[i])
+	}
+
+	if c, ok, err := acks.ack(msgs[0]); err != nil || !ok || c.Offset != 0 {
+		t.Errorf("expected the ack of message 0 to commit offset 0, got %+v (%t, %v)", c, ok, err)
+	}
+
+	// The partition 1 was revoked, and the partition 0 is consumed again from
+	// its committed offset in the new generation.
+	acks.reset(2)
+	if acks.pending != 0 {
+		t.Errorf("expected no pending acks after the rebalance, got %d", acks.pending)
+	}
+
+	redelivered := Message{Topic: "topic-A", Partition: 0, Offset: 1}
+	redelivered.generation = acks.track(redelivered)
+
+	for _, m := range msgs[1:] {
+		if c, ok, err := acks.ack(m); ok || !errors.Is(err, ErrAckUntracked) {
+			t.Errorf("expected the ack of a message of the previous generation to be rejected, got %+v (%t, %v)", c, ok, err)
+		}
+	}
+	if acks.pending != 1 {
+		t.Errorf("expected 1 pending ack, got %d", acks.pending)
+	}
+
+	if c, ok, err := acks.ack(redelivered); err != nil || !ok || c.Offset != 1 {
+		t.Errorf("expected the ack of the redelivered message to commit offset 1, got %+v (%t, %v)", c, ok, err)
+	}
+	if acks.pending != 0 {
+		t.Errorf("expected no pending acks, got %d", acks.pending)
+	}
+}
+
+func TestReaderAckCommitFailure(t *testing.T) {
+	acks := newAckTracker()
+
+	msgs := make([]Message, 3)
+	for i := range msgs {
+		msgs[i] = Message{Topic: "topic-A", Offset: int64(i)}
+		msgs[i].generation = acks.track(msgs[i])
+	}
+
+	// The commit of offset 0 fails, the message remains tracked and its
+	// offset is committed again with the next acknowledgement.
+	if c, ok, err := acks.ack(msgs[0]); err != nil || !ok || c.Offset != 0 {
+		t.Errorf("expected the ack of message 0 to commit offset 0, got %+v (%t, %v)", c, ok, err)
+	}
+	if c, ok, err := acks.ack(msgs[2]); err != nil || !ok || c.Offset != 0 {
+		t.Errorf("expected the ack of message 2 to commit offset 0 again, got %+v (%t, %v)", c, ok, err)
+	}
+
+	c, ok, err := acks.ack(msgs[1])
+	if err != nil || !ok || c.Offset != 2 {
+		t.Fatalf("expected the ack of message 1 to commit offset 2, got %+v (%t, %v)", c, ok, err)
+	}
+	acks.commit(c)
+
+	// Acknowledging committed messages has no effect.
+	if c, ok, err := acks.ack(msgs[1]); err != nil || ok {
+		t.Errorf("expected the ack of a committed message to be ignored, got %+v (%t, %v)", c, ok, err)
+	}
+
+	// Messages that were not returned by the reader are rejected.
+	for _, m := range []Message{{Topic: "topic-A", Offset: 3}, {Topic: "topic-B", Offset: 0}} {
+		if c, ok, err := acks.ack(m); ok || !errors.Is(err, ErrAckUntracked) {
+			t.Errorf("expected the ack of an untracked message to be rejected, got %+v (%t, %v)", c, ok, err)
+		}
+	}
+}
+
+func TestReaderConfigAckMessages(t *testing.T) {
+	configs := []ReaderConfig{
+		{Brokers: []string{"localhost:9092"}, Topic: "topic-A", AckMessages: true},
+		{Brokers: []string{"localhost:9092"}, Topic: "topic-A", GroupID: "group-A", AckMessages: true, RawBatches: true},
+	}
+	for _, config := range configs {
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected an error validating %+v", config)
+		}
+	}
+
+	r := NewReader(ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "topic-A", GroupID: "group-A"})
+	defer r.Close()
+	if err := r.Ack(context.Background(), Message{}); !errors.Is(err, errAckMessages) {
+		t.Errorf("expected an error acknowledging messages without AckMessages, got %v", err)
+	}
+}
+
+func TestReaderFetchBatch(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	msgs := make([]Message, 100)
+	for i := range msgs {
+		msgs[i] = Message{
+			Key:     []byte(fmt.Sprintf("key-%d", i)),
+			Value:   []byte(fmt.Sprintf("value-%d", i)),
+			Headers: []Header{{Key: "index", Value: []byte{byte(i)}}},
+		}
+	}
+	msgs[1].Key = nil
+	msgs[2].Value = nil
+
+	w := &Writer{
+		Addr:      TCP("localhost:9092"),
+		Topic:     "topic-A",
+		Transport: &Transport{Dial: broker.Dial},
+	}
+	defer w.Close()
+
+	if err := w.WriteMessages(ctx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers:    []string{"localhost:9092"},
+		Topic:      "topic-A",
+		MaxWait:    100 * time.Millisecond,
+		Dialer:     &Dialer{DialFunc: broker.Dial},
+		RawBatches: true,
+	})
+	defer r.Close()
+
+	if _, err := r.ReadMessage(ctx); err == nil {
+		t.Error("expected an error reading a message from a reader configured with RawBatches")
+	}
+
+	for i := 0; i < len(msgs); {
+		batch, err := r.FetchBatch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if batch.Topic != "topic-A" || batch.Partition != 0 || batch.HighWaterMark != int64(len(msgs)) {
+			t.Errorf("unexpected batch: topic=%s partition=%d high-water-mark=%d", batch.Topic, batch.Partition, batch.HighWaterMark)
+		}
+
+		for j, rec := range batch.Records {
+			want := msgs[i]
+			if rec.Offset != int64(i) {
+				t.Errorf("record #%d: expected offset %d but got %d", i, i, rec.Offset)
+			}
+			if !bytes.Equal(rec.Key, want.Key) || !bytes.Equal(rec.Value, want.Value) {
+				t.Errorf("record #%d: expected %q=%q but got %q=%q", i, want.Key, want.Value, rec.Key, rec.Value)
+			}
+			if (want.Key == nil) != (rec.Key == nil) || (want.Value == nil) != (rec.Value == nil) {
+				t.Errorf("record #%d: null key or value not preserved", i)
+			}
+			if len(rec.Headers) != 1 || rec.Headers[0].Value[0] != byte(i) {
+				t.Errorf("record #%d: unexpected headers: %+v", i, rec.Headers)
+			}
+			if m := batch.Message(j); m.Offset != rec.Offset || m.Topic != "topic-A" || !bytes.Equal(m.Value, rec.Value) {
+				t.Errorf("record #%d: unexpected message: %+v", i, m)
+			}
+			i++
+		}
+	}
+
+	if offset := r.Offset(); offset != int64(len(msgs)) {
+		t.Errorf("expected reader offset %d but got %d", len(msgs), offset)
+	}
+
+	config := ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "topic-A", RawBatches: true, FetchByBroker: true}
+	if err := config.Validate(); err == nil {
+		t.Error("expected RawBatches to be rejected with FetchByBroker")
+	}
+}
+
+func TestReaderNullableBytes(t *testing.T) {
+	for _, messageVersion := range []int{1, 2} {
+		t.Run(fmt.Sprintf("v%d", messageVersion), func(t *testing.T) {
+			testReaderNullableBytes(t, messageVersion)
+		})
+	}
+}
+
+func testReaderNullableBytes(t *testing.T, messageVersion int) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Zero-length keys and values must not be confused with null ones.
+	msgs := []Message{
+		{Key: nil, Value: nil},
+		{Key: nil, Value: []byte{}},
+		{Key: []byte{}, Value: nil},
+		{Key: []byte{}, Value: []byte{}},
+	}
+
+	w := &Writer{
+		Addr:           TCP("localhost:9092"),
+		Topic:          "topic-A",
+		MessageVersion: messageVersion,
+		BatchSize:      len(msgs),
+		Transport:      &Transport{Dial: broker.Dial},
+	}
+	defer w.Close()
+
+	if err := w.WriteMessages(ctx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(source string, i int, key, value []byte) {
+		want := msgs[i]
+		if (key == nil) != (want.Key == nil) || (value == nil) != (want.Value == nil) || len(key) != 0 || len(value) != 0 {
+			t.Errorf("%s #%d: expected %#v=%#v but got %#v=%#v", source, i, want.Key, want.Value, key, value)
+		}
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "topic-A",
+		MaxWait: 100 * time.Millisecond,
+		Dialer:  &Dialer{DialFunc: broker.Dial},
+	})
+	defer r.Close()
+
+	for i := range msgs {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("message", i, m.Key, m.Value)
+	}
+
+	raw := NewReader(ReaderConfig{
+		Brokers:    []string{"localhost:9092"},
+		Topic:      "topic-A",
+		MaxWait:    100 * time.Millisecond,
+		Dialer:     &Dialer{DialFunc: broker.Dial},
+		RawBatches: true,
+	})
+	defer raw.Close()
+
+	for i := 0; i < len(msgs); {
+		batch, err := raw.FetchBatch(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rec := range batch.Records {
+			check("raw record", i, rec.Key, rec.Value)
+			i++
+		}
+	}
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: &Transport{Dial: broker.Dial},
+	}
+	res, err := client.Fetch(ctx, &FetchRequest{Topic: "topic-A", MaxWait: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range msgs {
+		rec, err := res.Records.ReadRecord()
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, _ := protocol.ReadAll(rec.Key)
+		value, _ := protocol.ReadAll(rec.Value)
+		check("fetched record", i, key, value)
+	}
+}
+
+func TestOffsetStash(t *testing.T) {
+	const topic = "topic"
+
+	newMessage := func(partition int, offset int64) Message {
+		return Message{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    offset,
+		}
+	}
+
+	tests := map[string]struct {
+		Given    offsetStash
+		Messages []Message
+		Expected offsetStash
+	}{
+		"nil": {},
+		"empty given, single message": {
+			Given:    offsetStash{},
+			Messages: []Message{newMessage(0, 0)},
+			Expected: offsetStash{
+				topic: {0: 1},
+			},
+		},
+		"ignores earlier offsets": {
+			Given: offsetStash{
+				topic: {0: 2},
+			},
+			Messages: []Message{newMessage(0, 0)},
+			Expected: offsetStash{
+				topic: {0: 2},
+			},
+		},
+		"uses latest offset": {
+			Given: offsetStash{},
+			Messages: []Message{
+				newMessage(0, 2),
+				newMessage(0, 3),
+				newMessage(0, 1),
+			},
+			Expected: offsetStash{
+				topic: {0: 4},
+			},
+		},
+		"uses latest offset, across multiple topics": {
+			Given: offsetStash{},
+			Messages: []Message{
+				newMessage(0, 2),
+				newMessage(0, 3),
+				newMessage(0, 1),
+				newMessage(1, 5),
+				newMessage(1, 6),
+			},
+			Expected: offsetStash{
+				topic: {
+					0: 4,
+					1: 7,
+				},
+			},
+		},
+	}
+
+	for label, test := range tests {
+		t.Run(label, func(t *testing.T) {
+			test.Given.merge(makeCommits(test.Messages...))
+			if !reflect.DeepEqual(test.Expected, test.Given) {
+				t.Errorf("expected %v; got %v", test.Expected, test.Given)
+			}
+		})
+	}
+}
+
+type mockOffsetCommitter struct {
+	invocations int
+	failCount   int
+	err         error
+}
+
+func (m *mockOffsetCommitter) offsetCommit(request offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+	m.invocations++
+
+	if m.failCount > 0 {
+		m.failCount--
+		return offsetCommitResponseV2{}, io.EOF
+	}
+
+	return offsetCommitResponseV2{}, nil
+}
+
+func TestValidateReader(t *testing.T) {
+	tests := []struct {
+		config       ReaderConfig
+		errorOccured bool
+	}{
+		{config: ReaderConfig{}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1"}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: -1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: 1, MinBytes: -1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: 1, MinBytes: 5, MaxBytes: -1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", Partition: 1, MinBytes: 5, MaxBytes: 6}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", PartitionMaxBytes: -1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", PartitionMaxBytes: 1e3, FetchByBroker: true}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", OffsetOutOfRangeReset: OffsetResetLatest}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", OffsetOutOfRangeReset: -1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", OffsetOutOfRangeReset: OffsetResetError + 1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", MaxLag: 100}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", MaxLag: -1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", MaxRecordBytes: -1}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", MaxRecordBytes: 1e6, FetchByBroker: true}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", ControlRecords: true}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", ControlRecords: true, FetchByBroker: true}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1"}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1", SessionTimeout: 6 * time.Second}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1", HeartbeatInterval: 10 * time.Second}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1", HeartbeatInterval: 15 * time.Second, SessionTimeout: 10 * time.Second}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1", SessionTimeout: 10 * time.Second, RebalanceTimeout: 5 * time.Second}, errorOccured: true},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1", HeartbeatInterval: 2 * time.Second, RebalanceTimeout: 2 * time.Second}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1", SessionTimeout: 10 * time.Second, RebalanceTimeout: time.Minute}, errorOccured: false},
+		{config: ReaderConfig{Brokers: []string{"broker1"}, Topic: "topic1", GroupID: "group1", SessionTimeout: 45 * time.Second}, errorOccured: false},
+	}
+	for _, test := range tests {
+		err := test.config.Validate()
+		if test.errorOccured && err == nil {
+			t.Fail()
+		}
+		if !test.errorOccured && err != nil {
+			t.Fail()
+		}
+	}
+}
+
+func TestReaderResetOffset(t *testing.T) {
+	const first, last = 10, 20
+
+	tests := []struct {
+		policy OffsetResetPolicy
+		offset int64
+		reset  int64
+		err    error
+	}{
+		{policy: OffsetResetDefault, offset: 5, reset: first},
+		{policy: OffsetResetDefault, offset: 25, reset: 25},
+		{policy: OffsetResetEarliest, offset: 5, reset: first},
+		{policy: OffsetResetEarliest, offset: 25, reset: first},
+		{policy: OffsetResetLatest, offset: 5, reset: last},
+		{policy: OffsetResetLatest, offset: 25, reset: last},
+		{policy: OffsetResetError, offset: 5, reset: 5, err: OffsetOutOfRange},
+		{policy: OffsetResetError, offset: 25, reset: 25, err: OffsetOutOfRange},
+	}
+
+	for _, test := range tests {
+		r := &reader{offsetReset: test.policy}
+		reset, err := r.resetOffset(test.offset, first, last)
+		if !errors.Is(err, test.err) {
+			t.Errorf("policy %d, offset %d: expected error %v but got %v", test.policy, test.offset, test.err, err)
+		}
+		if reset != test.reset {
+			t.Errorf("policy %d, offset %d: expected offset %d but got %d", test.policy, test.offset, test.reset, reset)
+		}
+	}
+}
+
+func TestReaderOffsetResetError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	topic := makeTopic()
+	createTopic(t, topic, 1)
+	defer deleteTopic(t, topic)
+
+	r := NewReader(ReaderConfig{
+		Brokers:               []string{"localhost:9092"},
+		Topic:                 topic,
+		MaxWait:               100 * time.Millisecond,
+		OffsetOutOfRangeReset: OffsetResetError,
+	})
+	defer r.Close()
+
+	if err := r.SetOffset(42); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.ReadMessage(ctx); !errors.Is(err, OffsetOutOfRange) {
+		t.Fatalf("expected %v but got %v", OffsetOutOfRange, err)
+	}
+}
+
+func TestCommitLoopImmediateFlushOnGenerationEnd(t *testing.T) {
+	t.Parallel()
+	var committedOffset int64
+	var commitCount int
+	gen := &Generation{
+		conn: mockCoordinator{
+			offsetCommitFunc: func(r offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+				commitCount++
+				committedOffset = r.Topics[0].Partitions[0].Offset
+				return offsetCommitResponseV2{}, nil
+			},
+		},
+		done:   make(chan struct{}),
+		joined: make(chan struct{}),
+	}
+
+	// initialize commits so that the commitLoopImmediate select statement blocks
+	r := &Reader{stctx: context.Background(), commits: make(chan commitRequest, 100)}
+
+	for i := 0; i < 100; i++ {
+		cr := commitRequest{
+			commits: []commit{{
+				topic:     "topic",
+				partition: 0,
+				offset:    int64(i) + 1,
+			}},
+			errch: make(chan<- error, 1),
+		}
+		r.commits <- cr
+	}
+
+	gen.Start(func(ctx context.Context) {
+		r.commitLoopImmediate(ctx, gen)
+	})
+
+	gen.close()
+
+	if committedOffset != 100 {
+		t.Fatalf("expected commited offset to be 100 but got %d", committedOffset)
+	}
+
+	if commitCount >= 100 {
+		t.Fatalf("expected a single final commit on generation end got %d", commitCount)
+	}
+}
+
+func TestCommitLoopRevoke(t *testing.T) {
+	tests := []struct {
+		scenario string
+		interval time.Duration
+		commit   func(offsetCommitRequestV2) (offsetCommitResponseV2, error)
+		timeout  time.Duration
+		err      error
+		attempts int
+	}{
+		{
+			scenario: "immediate",
+			commit: func(offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+				return offsetCommitResponseV2{}, nil
+			},
+		},
+		{
+			scenario: "interval",
+			interval: time.Hour,
+			commit: func(offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+				return offsetCommitResponseV2{}, nil
+			},
+		},
+		{
+			scenario: "failed commit",
+			interval: time.Hour,
+			commit: func(offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+				return offsetCommitResponseV2{}, io.EOF
+			},
+			err: io.EOF,
+		},
+		{
+			scenario: "timeout",
+			interval: time.Hour,
+			commit: func(offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+				time.Sleep(time.Second)
+				return offsetCommitResponseV2{}, nil
+			},
+			timeout: 10 * time.Millisecond,
+			err:     context.DeadlineExceeded,
+		},
+		{
+			scenario: "timeout stops retries",
+			interval: time.Hour,
+			commit: func(offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+				time.Sleep(50 * time.Millisecond)
+				return offsetCommitResponseV2{}, io.EOF
+			},
+			timeout:  10 * time.Millisecond,
+			err:      context.DeadlineExceeded,
+			attempts: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			var mutex sync.Mutex
+			var committed []int64
+			gen := &Generation{
+				conn: mockCoordinator{
+					offsetCommitFunc: func(req offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+						mutex.Lock()
+						committed = append(committed, req.Topics[0].Partitions[0].Offset)
+						mutex.Unlock()
+						return test.commit(req)
+					},
+				},
+				Assignments: map[string][]PartitionAssignment{"topic": {{ID: 0}, {ID: 1}}},
+				done:        make(chan struct{}),
+				joined:      make(chan struct{}),
+			}
+
+			var revoked map[string][]int
+			var revokeErr error
+			r := &Reader{
+				stctx:   context.Background(),
+				commits: make(chan commitRequest, 1),
+				config: ReaderConfig{
+					CommitInterval:      test.interval,
+					RevokeCommitTimeout: test.timeout,
+					OnRevoke: func(partitions map[string][]int, err error) {
+						revoked, revokeErr = partitions, err
+					},
+				},
+			}
+
+			// The commit is still in the channel when the generation ends,
+			// it must be flushed before the partitions are revoked.
+			r.commits <- commitRequest{
+				commits: []commit{{topic: "topic", partition: 0, offset: 42}},
+				errch:   make(chan error, 1),
+			}
+
+			gen.Start(func(ctx context.Context) {
+				r.commitLoop(ctx, gen)
+			})
+
+			start := time.Now()
+			gen.close()
+
+			if test.timeout != 0 && time.Since(start) > 500*time.Millisecond {
+				t.Errorf("the revocation took %s, longer than the commit timeout of %s", time.Since(start), test.timeout)
+			}
+
+			if test.attempts != 0 {
+				// Leave time for the commit to be retried after the backoff.
+				time.Sleep(300 * time.Millisecond)
+			}
+
+			mutex.Lock()
+			if len(committed) == 0 || committed[0] != 42 {
+				t.Errorf("expected offset 42 to be committed before the revocation but got %v", committed)
+			}
+			if test.attempts != 0 && len(committed) != test.attempts {
+				t.Errorf("expected %d commit attempts but got %d", test.attempts, len(committed))
+			}
+			mutex.Unlock()
+
+			if !reflect.DeepEqual(revoked, map[string][]int{"topic": {0, 1}}) {
+				t.Errorf("unexpected revoked partitions: %v", revoked)
+			}
+			if !errors.Is(revokeErr, test.err) || (test.err == nil) != (revokeErr == nil) {
+				t.Errorf("expected the revoke callback to receive %v but got %v", test.err, revokeErr)
+			}
+		})
+	}
+}
+
+func TestReaderCommitBeforeRevoke(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.WriteMessages(makeTestSequence(5)...); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := make(chan error, 10)
+
+	newReader := func() *Reader {
+		return NewReader(ReaderConfig{
+			Brokers:           []string{"localhost:9092"},
+			Topic:             "topic-A",
+			GroupID:           "group-A",
+			MaxWait:           100 * time.Millisecond,
+			HeartbeatInterval: 100 * time.Millisecond,
+			// Acknowledged offsets are only committed when the partitions are
+			// revoked.
+			CommitInterval: time.Hour,
+			AckMessages:    true,
+			Dialer:         dialer,
+			OnRevoke: func(partitions map[string][]int, err error) {
+				revoked <- err
+			},
+		})
+	}
+
+	r1 := newReader()
+	defer r1.Close()
+
+	msgs := make([]Message, 5)
+	for i := range msgs {
+		if msgs[i], err = r1.FetchMessage(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first three messages were processed, the others were not when the
+	// second reader joins the group.
+	if err := r1.Ack(ctx, msgs[:3]...); err != nil {
+		t.Fatal(err)
+	}
+
+	r2 := newReader()
+	defer r2.Close()
+
+	select {
+	case err := <-revoked:
+		if err != nil {
+			t.Fatalf("committing the offsets of the revoked partition: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the partition to be revoked")
+	}
+
+	// Closing the first reader hands its partitions to the second one, which
+	// resumes after the acknowledged messages.
+	r1.Close()
+
+	m, err := r2.FetchMessage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Offset != msgs[3].Offset {
+		t.Errorf("expected the second reader to resume at offset %d but got %d", msgs[3].Offset, m.Offset)
+	}
+}
+
+func TestCommitOffsetsWithRetry(t *testing.T) {
+	offsets := offsetStash{"topic": {0: 0}}
+
+	tests := map[string]struct {
+		Fails       int
+		Invocations int
+		HasError    bool
+	}{
+		"happy path": {
+			Invocations: 1,
+		},
+		"1 retry": {
+			Fails:       1,
+			Invocations: 2,
+		},
+		"out of retries": {
+			Fails:       defaultCommitRetries + 1,
+			Invocations: defaultCommitRetries,
+			HasError:    true,
+		},
+	}
+
+	for label, test := range tests {
+		t.Run(label, func(t *testing.T) {
+			count := 0
+			gen := &Generation{
+				conn: mockCoordinator{
+					offsetCommitFunc: func(offsetCommitRequestV2) (offsetCommitResponseV2, error) {
+						count++
+						if count <= test.Fails {
+							return offsetCommitResponseV2{}, io.EOF
+						}
+						return offsetCommitResponseV2{}, nil
+					},
+				},
+				done: make(chan struct{}),
+			}
+
+			r := &Reader{stctx: context.Background()}
+			err := r.commitOffsetsWithRetry(r.stctx, gen, offsets, defaultCommitRetries)
+			switch {
+			case test.HasError && err == nil:
+				t.Error("bad err: expected not nil; got nil")
+			case !test.HasError && err != nil:
+				t.Errorf("bad err: expected nil; got %v", err)
+			}
+		})
+	}
+}
+
+// Test that a reader won't continually rebalance when there are more consumers
+// than partitions in a group.
+// https://github.com/segmentio/kafka-go/issues/200
+func TestRebalanceTooManyConsumers(t *testing.T) {
+	ctx := context.Background()
+	conf := ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: makeGroupID(),
+		Topic:   makeTopic(),
 		MaxWait: time.Second,
 	}
 
@@ -1973,3 +4142,59 @@ func createTopicWithCompaction(t *testing.T, topic string, partitions int) {
 	defer cancel()
 	waitForTopic(ctx, t, topic)
 }
+
+func TestReaderLagByPartition(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dialer := &Dialer{DialFunc: broker.Dial}
+
+	conn, err := dialer.DialLeader(ctx, "tcp", "localhost:9092", "topic-A", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.WriteMessages(makeTestSequence(10)...)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "topic-A",
+		MaxWait: 100 * time.Millisecond,
+		Dialer:  dialer,
+	})
+	defer r.Close()
+
+	// No messages were fetched yet, the lag is computed from the offsets of
+	// the partition.
+	lags, err := r.LagByPartition(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int64{0: 10}; !reflect.DeepEqual(lags, want) {
+		t.Errorf("expected lags %v before reading but got %v", want, lags)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.ReadMessage(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lags, err = r.LagByPartition(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int]int64{0: 7}; !reflect.DeepEqual(lags, want) {
+		t.Errorf("expected lags %v after reading 3 messages but got %v", want, lags)
+	}
+}
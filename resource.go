@@ -13,6 +13,10 @@ const (
 	ResourceTypeCluster         ResourceType = 4
 	ResourceTypeTransactionalID ResourceType = 5
 	ResourceTypeDelegationToken ResourceType = 6
+	// ResourceTypeBrokerLogger is only valid in configuration requests, it
+	// designates the log4j loggers of the broker identified by the resource
+	// name.
+	ResourceTypeBrokerLogger ResourceType = 8
 )
 
 // https://github.com/apache/kafka/blob/trunk/clients/src/main/java/org/apache/kafka/common/resource/PatternType.java
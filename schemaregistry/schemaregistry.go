@@ -0,0 +1,148 @@
+// Package schemaregistry implements the framing of messages encoded with
+// schemas managed by a Confluent schema registry.
+//
+// Payloads in the Confluent wire format are prefixed with a magic byte and the
+// big-endian id of the schema that they were encoded with. The package does not
+// provide a client for the schema registry or the codecs encoding the payloads
+// (Avro, Protobuf, JSON schema...), programs plug in their own implementations.
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MagicByte is the first byte of payloads in the Confluent wire format.
+const MagicByte = 0
+
+// HeaderSize is the size of the header prefixed to payloads.
+const HeaderSize = 5
+
+// ErrInvalidFrame is returned when decoding payloads which are not in the
+// Confluent wire format.
+var ErrInvalidFrame = errors.New("payload is not in the confluent wire format")
+
+// AppendFrame appends the header for the schema id to b, followed by the
+// payload, and returns the extended buffer.
+func AppendFrame(b []byte, schemaID int, payload []byte) []byte {
+	var header [HeaderSize]byte
+	header[0] = MagicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(schemaID))
+	b = append(b, header[:]...)
+	return append(b, payload...)
+}
+
+// ParseFrame returns the schema id and the payload of b. The payload is a
+// sub-slice of b.
+func ParseFrame(b []byte) (schemaID int, payload []byte, err error) {
+	if len(b) < HeaderSize || b[0] != MagicByte {
+		return 0, nil, ErrInvalidFrame
+	}
+	return int(binary.BigEndian.Uint32(b[1:HeaderSize])), b[HeaderSize:], nil
+}
+
+// Registry is the interface of schema registry clients used by Serializer to
+// find the id of the schema that messages are encoded with.
+//
+// Implementations are expected to cache the ids, since the method is called for
+// each serialized message.
+type Registry interface {
+	SchemaID(subject string) (int, error)
+}
+
+// RegistryFunc is an implementation of the Registry interface that makes it
+// possible to use regular functions to look up schema ids.
+type RegistryFunc func(subject string) (int, error)
+
+// SchemaID calls f, satisfies the Registry interface.
+func (f RegistryFunc) SchemaID(subject string) (int, error) {
+	return f(subject)
+}
+
+// TopicNameStrategy returns a function returning the subject of the keys or
+// values of topics, named after the topic followed by "-key" or "-value". It is
+// the default subject name strategy of the schema registry.
+func TopicNameStrategy(isKey bool) func(topic string) string {
+	suffix := "-value"
+	if isKey {
+		suffix = "-key"
+	}
+	return func(topic string) string { return topic + suffix }
+}
+
+// Serializer is an implementation of the kafka.Serializer interface encoding
+// values in the Confluent wire format, it can be used as the KeySerializer or
+// ValueSerializer of a kafka.Writer.
+type Serializer struct {
+	// Registry used to look up the id of the schema of each subject.
+	Registry Registry
+
+	// Subject returns the subject of the schema that values written to the
+	// topic are encoded with.
+	//
+	// Default: TopicNameStrategy(false)
+	Subject func(topic string) string
+
+	// Encode encodes v with the schema, the serializer prefixes the returned
+	// payload with the header of the wire format.
+	Encode func(schemaID int, v interface{}) ([]byte, error)
+}
+
+var _ kafka.Serializer = (*Serializer)(nil)
+
+// Serialize satisfies the kafka.Serializer interface.
+func (s *Serializer) Serialize(topic string, v interface{}) ([]byte, error) {
+	subject := s.subject(topic)
+
+	schemaID, err := s.Registry.SchemaID(subject)
+	if err != nil {
+		return nil, fmt.Errorf("looking up the schema of subject %q: %w", subject, err)
+	}
+
+	payload, err := s.Encode(schemaID, v)
+	if err != nil {
+		return nil, fmt.Errorf("encoding value with schema %d: %w", schemaID, err)
+	}
+
+	return AppendFrame(make([]byte, 0, HeaderSize+len(payload)), schemaID, payload), nil
+}
+
+func (s *Serializer) subject(topic string) string {
+	if s.Subject != nil {
+		return s.Subject(topic)
+	}
+	return TopicNameStrategy(false)(topic)
+}
+
+// Deserializer decodes values in the Confluent wire format, for example the
+// keys or values of messages returned by a kafka.Reader.
+type Deserializer struct {
+	// Decode decodes the payload with the schema that it was encoded with.
+	// Implementations usually fetch the schema from the registry by id.
+	Decode func(schemaID int, payload []byte) (interface{}, error)
+}
+
+// Deserialize returns the value decoded from b. The topic is not used by the
+// method, it is accepted for symmetry with Serializer.
+//
+// The method returns ErrInvalidFrame if b is not in the Confluent wire format,
+// and nil if b is nil.
+func (d *Deserializer) Deserialize(topic string, b []byte) (interface{}, error) {
+	if b == nil {
+		return nil, nil
+	}
+
+	schemaID, payload, err := ParseFrame(b)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := d.Decode(schemaID, payload)
+	if err != nil {
+		return nil, fmt.Errorf("decoding value with schema %d: %w", schemaID, err)
+	}
+	return v, nil
+}
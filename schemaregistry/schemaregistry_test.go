@@ -0,0 +1,70 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestFrame(t *testing.T) {
+	b := AppendFrame(nil, 0x01020304, []byte("payload"))
+	if want := []byte("\x00\x01\x02\x03\x04payload"); !bytes.Equal(b, want) {
+		t.Fatalf("expected frame %q but got %q", want, b)
+	}
+
+	schemaID, payload, err := ParseFrame(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schemaID != 0x01020304 || string(payload) != "payload" {
+		t.Errorf("unexpected frame: schema=%d payload=%q", schemaID, payload)
+	}
+
+	for _, b := range [][]byte{nil, []byte("\x00\x01"), []byte("\x01\x00\x00\x00\x01payload")} {
+		if _, _, err := ParseFrame(b); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("expected ErrInvalidFrame parsing %q but got %v", b, err)
+		}
+	}
+}
+
+func TestSerializer(t *testing.T) {
+	var subjects []string
+
+	s := &Serializer{
+		Registry: RegistryFunc(func(subject string) (int, error) {
+			subjects = append(subjects, subject)
+			return 42, nil
+		}),
+		Encode: func(schemaID int, v interface{}) ([]byte, error) {
+			return json.Marshal(v)
+		},
+	}
+
+	b, err := s.Serialize("topic-A", map[string]int{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subjects) != 1 || subjects[0] != "topic-A-value" {
+		t.Errorf("unexpected subjects looked up: %q", subjects)
+	}
+
+	d := &Deserializer{
+		Decode: func(schemaID int, payload []byte) (interface{}, error) {
+			if schemaID != 42 {
+				t.Errorf("expected schema 42 but got %d", schemaID)
+			}
+			var v map[string]int
+			err := json.Unmarshal(payload, &v)
+			return v, err
+		},
+	}
+
+	v, err := d.Deserialize("topic-A", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := v.(map[string]int); m["id"] != 1 {
+		t.Errorf("unexpected decoded value: %v", m)
+	}
+}
@@ -0,0 +1,72 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The Serializer interface is used by the Writer to encode the keys and values
+// of typed messages, see Writer.WriteTyped.
+//
+// The topic that the message is written to is passed to Serialize, which lets
+// implementations select the schema of the message, for example when encoding
+// values in the Avro or Protobuf formats.
+//
+// Serializers must be safe to use concurrently from multiple goroutines.
+type Serializer interface {
+	Serialize(topic string, v interface{}) ([]byte, error)
+}
+
+// SerializerFunc is an implementation of the Serializer interface that makes it
+// possible to use regular functions to serialize messages.
+type SerializerFunc func(topic string, v interface{}) ([]byte, error)
+
+// Serialize calls f, satisfies the Serializer interface.
+func (f SerializerFunc) Serialize(topic string, v interface{}) ([]byte, error) {
+	return f(topic, v)
+}
+
+// JSONSerializer is a Serializer implementation encoding values in the JSON
+// format with the encoding/json package.
+type JSONSerializer struct{}
+
+// Serialize satisfies the Serializer interface.
+func (JSONSerializer) Serialize(topic string, v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// rawSerializer is the Serializer used when none is configured, it only
+// accepts values that are already encoded.
+type rawSerializer struct{}
+
+func (rawSerializer) Serialize(topic string, v interface{}) ([]byte, error) {
+	switch x := v.(type) {
+	case []byte:
+		return x, nil
+	case string:
+		return []byte(x), nil
+	default:
+		return nil, fmt.Errorf("cannot serialize values of type %T without a serializer", v)
+	}
+}
+
+// TypedMessage is a message carrying a key and value which are serialized by
+// the writer before being written, see Writer.WriteTyped.
+type TypedMessage struct {
+	// Topic that the message is written to, it must be empty when the Topic
+	// of the writer is set.
+	Topic string
+
+	// Key and value of the message. Nil keys and values are written as nil
+	// byte slices without being passed to the serializer, a nil value can be
+	// used to write tombstones.
+	Key   interface{}
+	Value interface{}
+
+	Headers []Header
+
+	// If not set at the creation, Time will be automatically set when
+	// writing the message.
+	Time time.Time
+}
@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -21,6 +22,39 @@ type DurationStats struct {
 	Max time.Duration `metric:"max" type:"gauge"`
 }
 
+// partitionCounter counts values by topic and partition, the counts are reset
+// on snapshot.
+type partitionCounter struct {
+	mutex  sync.Mutex
+	counts map[string]map[int]int64
+}
+
+func (c *partitionCounter) observe(topic string, partition int, v int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]map[int]int64)
+	}
+
+	partitions := c.counts[topic]
+	if partitions == nil {
+		partitions = make(map[int]int64)
+		c.counts[topic] = partitions
+	}
+
+	partitions[partition] += v
+}
+
+func (c *partitionCounter) snapshot() map[string]map[int]int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	counts := c.counts
+	c.counts = nil
+	return counts
+}
+
 // counter is an atomic incrementing counter which gets reset on snapshot.
 //
 // Since atomic is used to mutate the statistic the value must be 64-bit aligned.
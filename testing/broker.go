@@ -0,0 +1,903 @@
+package testing
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/consumergroupheartbeat"
+	"github.com/segmentio/kafka-go/protocol/createpartitions"
+	"github.com/segmentio/kafka-go/protocol/createtopics"
+	"github.com/segmentio/kafka-go/protocol/deletetopics"
+	"github.com/segmentio/kafka-go/protocol/fetch"
+	"github.com/segmentio/kafka-go/protocol/findcoordinator"
+	"github.com/segmentio/kafka-go/protocol/heartbeat"
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/listoffsets"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/offsetcommit"
+	"github.com/segmentio/kafka-go/protocol/offsetfetch"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+)
+
+const (
+	defaultBrokerAddr = "mockbroker:9092"
+	brokerNodeID      = 0
+)
+
+// Kafka error codes returned by the broker. They are redeclared here because
+// this package cannot depend on the kafka package.
+const (
+	errNone                      int16 = 0
+	errOffsetOutOfRange          int16 = 1
+	errCorruptMessage            int16 = 2
+	errUnknownTopicOrPartition   int16 = 3
+	errIllegalGeneration         int16 = 22
+	errInconsistentGroupProtocol int16 = 23
+	errInvalidGroupID            int16 = 24
+	errUnknownMemberID           int16 = 25
+	errRebalanceInProgress       int16 = 27
+	errUnsupportedVersion        int16 = 35
+	errTopicAlreadyExists        int16 = 36
+	errInvalidPartitions         int16 = 37
+	errGroupIDNotFound           int16 = 69
+	errFencedMemberEpoch         int16 = 110
+	errStaleMemberEpoch          int16 = 113
+)
+
+var errBrokerClosed = errors.New("kafka mock broker closed")
+
+// Authorized operations reported in metadata responses, as bit fields indexed
+// by ACL operation. The broker does not enforce ACLs, all the operations which
+// apply to the resources are authorized.
+const (
+	// Create, Alter, Describe, ClusterAction, DescribeConfigs, AlterConfigs,
+	// IdempotentWrite
+	clusterAuthorizedOperations int32 = 1<<5 | 1<<7 | 1<<8 | 1<<9 | 1<<10 | 1<<11 | 1<<12
+	// Read, Write, Create, Delete, Alter, Describe, DescribeConfigs,
+	// AlterConfigs
+	topicAuthorizedOperations int32 = 1<<3 | 1<<4 | 1<<5 | 1<<6 | 1<<7 | 1<<8 | 1<<10 | 1<<11
+	// Value of the fields when the authorized operations were not requested.
+	unknownAuthorizedOperations int32 = math.MinInt32
+)
+
+// Logger is the interface used by Broker to report errors. It is implemented
+// by kafka.Logger and *log.Logger.
+type Logger interface {
+	Printf(string, ...interface{})
+}
+
+// Broker is an in-memory implementation of a kafka broker, which programs can
+// use to test code built on kafka-go without running a kafka cluster.
+//
+// The broker presents itself as a single node cluster and implements just
+// enough of the kafka protocol to produce and consume messages and to form
+// consumer groups: ApiVersions, Metadata, Produce, Fetch, ListOffsets,
+// CreateTopics, CreatePartitions, DeleteTopics, FindCoordinator, JoinGroup,
+// SyncGroup, Heartbeat, LeaveGroup, OffsetCommit, OffsetFetch, and
+// ConsumerGroupHeartbeat.
+// Connections sending other requests are closed. Messages are retained for the
+// lifetime of the broker, and transactions, compaction, or replication are not
+// supported.
+//
+// Programs connect to the broker by installing its Dial method on the
+// kafka.Transport or kafka.Dialer they use, every address is routed to the
+// broker:
+//
+//	broker := &ktesting.Broker{}
+//	defer broker.Close()
+//
+//	broker.CreateTopic("topic-A", 3)
+//
+//	w := &kafka.Writer{
+//		Addr:      kafka.TCP("localhost:9092"),
+//		Topic:     "topic-A",
+//		Transport: &kafka.Transport{Dial: broker.Dial},
+//	}
+//
+//	r := kafka.NewReader(kafka.ReaderConfig{
+//		Brokers: []string{"localhost:9092"},
+//		Topic:   "topic-A",
+//		GroupID: "group-A",
+//		Dialer:  &kafka.Dialer{DialFunc: broker.Dial},
+//	})
+//
+// The zero-value is a valid broker, it must not be copied after first use.
+type Broker struct {
+	// The address that the broker advertises in metadata responses.
+	//
+	// Default: mockbroker:9092
+	Addr string
+
+	// When set to true, topics are created the first time they are referenced
+	// by a metadata request that allows it, or by a produce request.
+	AutoCreateTopics bool
+
+	// The number of partitions of topics created automatically, or by create
+	// topics requests which do not specify it.
+	//
+	// Default: 1
+	NumPartitions int
+
+	// The heartbeat interval returned to members of consumer groups using the
+	// consumer group protocol.
+	//
+	// Default: 5s
+	ConsumerGroupHeartbeatInterval time.Duration
+
+	// When set to true, the broker does not advertise support for the
+	// consumer group protocol, like brokers older than Kafka 4.0.
+	DisableConsumerGroupProtocol bool
+
+	// An optional logger used to report errors that caused the broker to
+	// close a connection, for example when it received a request that it
+	// does not support.
+	ErrorLogger Logger
+
+	mutex  sync.Mutex
+	wait   sync.WaitGroup
+	closed bool
+	done   chan struct{}
+	notify chan struct{}
+	conns  map[net.Conn]struct{}
+	topics map[string][]*partition
+	groups map[string]*group
+	nextID int
+}
+
+type partition struct {
+	records []record
+}
+
+func (p *partition) highWatermark() int64 { return int64(len(p.records)) }
+
+type record struct {
+	offset  int64
+	time    time.Time
+	key     []byte
+	value   []byte
+	headers []protocol.Header
+}
+
+func (r *record) size() int { return len(r.key) + len(r.value) }
+
+// init must be called with the mutex held.
+func (b *Broker) init() {
+	if b.done == nil {
+		b.done = make(chan struct{})
+		b.notify = make(chan struct{})
+		b.conns = make(map[net.Conn]struct{})
+		b.topics = make(map[string][]*partition)
+		b.groups = make(map[string]*group)
+	}
+}
+
+// Dial opens a connection to the broker. The network and address are ignored,
+// the method signature allows it to be used as kafka.Transport.Dial or
+// kafka.Dialer.DialFunc.
+func (b *Broker) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.init()
+
+	if b.closed {
+		return nil, errBrokerClosed
+	}
+
+	client, server := net.Pipe()
+	b.conns[server] = struct{}{}
+	b.wait.Add(1)
+	go b.serve(server)
+
+	return &brokerConn{Conn: client, addr: brokerAddr(address)}, nil
+}
+
+// CreateTopic creates a topic with the given number of partitions.
+func (b *Broker) CreateTopic(topic string, partitions int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.init()
+
+	if _, exists := b.topics[topic]; exists {
+		return fmt.Errorf("topic %q already exists", topic)
+	}
+	if partitions <= 0 {
+		return fmt.Errorf("invalid number of partitions for topic %q: %d", topic, partitions)
+	}
+
+	b.createTopic(topic, partitions)
+	return nil
+}
+
+// CreatePartitions increases the number of partitions of a topic to count.
+func (b *Broker) CreatePartitions(topic string, count int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.init()
+
+	partitions, exists := b.topics[topic]
+	if !exists {
+		return fmt.Errorf("topic %q does not exist", topic)
+	}
+	if count <= len(partitions) {
+		return fmt.Errorf("invalid number of partitions for topic %q: %d, it already has %d", topic, count, len(partitions))
+	}
+
+	b.addPartitions(topic, count)
+	return nil
+}
+
+// Close closes all connections to the broker and releases its resources.
+func (b *Broker) Close() error {
+	b.mutex.Lock()
+	b.init()
+
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+
+		for conn := range b.conns {
+			conn.Close()
+		}
+
+		for _, g := range b.groups {
+			g.stop()
+		}
+	}
+
+	b.mutex.Unlock()
+	b.wait.Wait()
+	return nil
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer b.wait.Done()
+	defer func() {
+		b.mutex.Lock()
+		delete(b.conns, conn)
+		b.mutex.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		version, correlationID, clientID, req, err := protocol.ReadRequest(r)
+		if err != nil {
+			if !isClosedConn(err) {
+				b.logf("reading request: %v", err)
+			}
+			return
+		}
+
+		res, err := b.handle(version, clientID, req)
+		if err != nil {
+			if err != errBrokerClosed {
+				b.logf("handling %s request: %v", req.ApiKey(), err)
+			}
+			return
+		}
+
+		if res == nil {
+			// Produce requests with acks=0 have no response.
+			continue
+		}
+
+		if err := protocol.WriteResponse(w, version, correlationID, res); err != nil {
+			b.logf("writing %s response: %v", res.ApiKey(), err)
+			return
+		}
+
+		if err := w.Flush(); err != nil {
+			if !isClosedConn(err) {
+				b.logf("writing %s response: %v", res.ApiKey(), err)
+			}
+			return
+		}
+	}
+}
+
+func (b *Broker) handle(version int16, clientID string, msg protocol.Message) (protocol.Message, error) {
+	switch req := msg.(type) {
+	case *apiversions.Request:
+		return b.apiVersions(), nil
+	case *metadata.Request:
+		return b.metadata(version, req), nil
+	case *produce.Request:
+		if res := b.produce(req); res != nil {
+			return res, nil
+		}
+		return nil, nil
+	case *fetch.Request:
+		return b.fetch(version, req)
+	case *listoffsets.Request:
+		return b.listOffsets(req), nil
+	case *createtopics.Request:
+		return b.createTopics(req), nil
+	case *createpartitions.Request:
+		return b.createPartitions(req), nil
+	case *deletetopics.Request:
+		return b.deleteTopics(req), nil
+	case *findcoordinator.Request:
+		return b.findCoordinator(req), nil
+	case *joingroup.Request:
+		return b.joinGroup(version, clientID, req)
+	case *syncgroup.Request:
+		return b.syncGroup(req)
+	case *heartbeat.Request:
+		return b.heartbeat(req), nil
+	case *leavegroup.Request:
+		return b.leaveGroup(version, req), nil
+	case *offsetcommit.Request:
+		return b.offsetCommit(version, req), nil
+	case *offsetfetch.Request:
+		return b.offsetFetch(version, req), nil
+	case *consumergroupheartbeat.Request:
+		return b.consumerGroupHeartbeat(req), nil
+	default:
+		return nil, fmt.Errorf("unsupported request")
+	}
+}
+
+var supportedAPIs = [...]protocol.ApiKey{
+	protocol.ApiVersions,
+	protocol.Metadata,
+	protocol.Produce,
+	protocol.Fetch,
+	protocol.ListOffsets,
+	protocol.CreateTopics,
+	protocol.CreatePartitions,
+	protocol.DeleteTopics,
+	protocol.FindCoordinator,
+	protocol.JoinGroup,
+	protocol.SyncGroup,
+	protocol.Heartbeat,
+	protocol.LeaveGroup,
+	protocol.OffsetCommit,
+	protocol.OffsetFetch,
+	protocol.ConsumerGroupHeartbeat,
+}
+
+func (b *Broker) apiVersions() *apiversions.Response {
+	res := &apiversions.Response{
+		ApiKeys: make([]apiversions.ApiKeyResponse, 0, len(supportedAPIs)),
+	}
+	for _, apiKey := range supportedAPIs {
+		if apiKey == protocol.ConsumerGroupHeartbeat && b.DisableConsumerGroupProtocol {
+			continue
+		}
+		res.ApiKeys = append(res.ApiKeys, apiversions.ApiKeyResponse{
+			ApiKey:     int16(apiKey),
+			MinVersion: apiKey.MinVersion(),
+			MaxVersion: apiKey.MaxVersion(),
+		})
+	}
+	return res
+}
+
+func (b *Broker) metadata(version int16, req *metadata.Request) *metadata.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	host, port := b.hostPort()
+	res := &metadata.Response{
+		Brokers: []metadata.ResponseBroker{{
+			NodeID: brokerNodeID,
+			Host:   host,
+			Port:   port,
+		}},
+		ClusterID:    "mockbroker",
+		ControllerID: brokerNodeID,
+
+		ClusterAuthorizedOperations: unknownAuthorizedOperations,
+	}
+	if req.IncludeClusterAuthorizedOperations {
+		res.ClusterAuthorizedOperations = clusterAuthorizedOperations
+	}
+
+	topicOperations := unknownAuthorizedOperations
+	if req.IncludeTopicAuthorizedOperations {
+		topicOperations = topicAuthorizedOperations
+	}
+
+	topics := req.Names()
+	if len(topics) == 0 {
+		topics = make([]string, 0, len(b.topics))
+		for topic := range b.topics {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+	}
+
+	// Versions prior to v4 do not have the AllowAutoTopicCreation field,
+	// brokers create topics automatically when they are configured to.
+	autoCreate := b.AutoCreateTopics && (version < 4 || req.AllowAutoTopicCreation)
+
+	for _, topic := range topics {
+		partitions, ok := b.topics[topic]
+		if !ok && autoCreate {
+			partitions, ok = b.createTopic(topic, b.numPartitions()), true
+		}
+		if !ok {
+			res.Topics = append(res.Topics, metadata.ResponseTopic{
+				ErrorCode: errUnknownTopicOrPartition,
+				Name:      topic,
+			})
+			continue
+		}
+
+		resTopic := metadata.ResponseTopic{
+			Name:       topic,
+			TopicID:    topicID(topic),
+			Partitions: make([]metadata.ResponsePartition, len(partitions)),
+
+			TopicAuthorizedOperations: topicOperations,
+		}
+		for i := range partitions {
+			resTopic.Partitions[i] = metadata.ResponsePartition{
+				PartitionIndex: int32(i),
+				LeaderID:       brokerNodeID,
+				ReplicaNodes:   []int32{brokerNodeID},
+				IsrNodes:       []int32{brokerNodeID},
+			}
+		}
+		res.Topics = append(res.Topics, resTopic)
+	}
+
+	return res
+}
+
+func (b *Broker) produce(req *produce.Request) *produce.Response {
+	res := &produce.Response{
+		Topics: make([]produce.ResponseTopic, len(req.Topics)),
+	}
+	now := time.Now()
+
+	for i, topic := range req.Topics {
+		resTopic := &res.Topics[i]
+		resTopic.Topic = topic.Topic
+		resTopic.Partitions = make([]produce.ResponsePartition, len(topic.Partitions))
+
+		for j, p := range topic.Partitions {
+			resPartition := &resTopic.Partitions[j]
+			resPartition.Partition = p.Partition
+			resPartition.LogAppendTime = -1
+
+			records, err := readRecords(p.RecordSet.Records, now)
+			if err != nil {
+				resPartition.ErrorCode = errCorruptMessage
+				continue
+			}
+
+			b.mutex.Lock()
+			if _, ok := b.topics[topic.Topic]; !ok && b.AutoCreateTopics {
+				b.createTopic(topic.Topic, b.numPartitions())
+			}
+			if part := b.partition(topic.Topic, p.Partition); part == nil {
+				resPartition.ErrorCode = errUnknownTopicOrPartition
+			} else {
+				resPartition.BaseOffset = part.highWatermark()
+				for _, r := range records {
+					r.offset = part.highWatermark()
+					part.records = append(part.records, r)
+				}
+			}
+			b.mutex.Unlock()
+		}
+	}
+
+	// Wake up fetch requests waiting for new records.
+	b.mutex.Lock()
+	b.init()
+	close(b.notify)
+	b.notify = make(chan struct{})
+	b.mutex.Unlock()
+
+	if req.Acks == 0 {
+		return nil
+	}
+	return res
+}
+
+func (b *Broker) fetch(version int16, req *fetch.Request) (*fetch.Response, error) {
+	deadline := time.Now().Add(time.Duration(req.MaxWaitTime) * time.Millisecond)
+
+	minBytes := int(req.MinBytes)
+	if minBytes <= 0 {
+		minBytes = 1
+	}
+
+	for {
+		b.mutex.Lock()
+		b.init()
+		res, size, failed := b.readPartitions(version, req)
+		notify, done := b.notify, b.done
+		b.mutex.Unlock()
+
+		timeout := time.Until(deadline)
+		if size >= minBytes || failed || timeout <= 0 {
+			return res, nil
+		}
+
+		timer := time.NewTimer(timeout)
+		select {
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+			return res, nil
+		case <-done:
+			timer.Stop()
+			return nil, errBrokerClosed
+		}
+	}
+}
+
+// readPartitions must be called with the mutex held.
+func (b *Broker) readPartitions(version int16, req *fetch.Request) (res *fetch.Response, size int, failed bool) {
+	res = &fetch.Response{
+		Topics: make([]fetch.ResponseTopic, len(req.Topics)),
+	}
+
+	// Record batches (v2) are only supported starting with v4 of the fetch
+	// API.
+	recordVersion := int8(2)
+	if version < 4 {
+		recordVersion = 1
+	}
+
+	for i, topic := range req.Topics {
+		resTopic := &res.Topics[i]
+		resTopic.Topic = topic.Topic
+		resTopic.Partitions = make([]fetch.ResponsePartition, len(topic.Partitions))
+
+		for j, p := range topic.Partitions {
+			resPartition := &resTopic.Partitions[j]
+			resPartition.Partition = p.Partition
+			resPartition.PreferredReadReplica = -1
+
+			part := b.partition(topic.Topic, p.Partition)
+			if part == nil {
+				resPartition.ErrorCode = errUnknownTopicOrPartition
+				failed = true
+				continue
+			}
+
+			highWatermark := part.highWatermark()
+			resPartition.HighWatermark = highWatermark
+			resPartition.LastStableOffset = highWatermark
+
+			if p.FetchOffset < 0 || p.FetchOffset > highWatermark {
+				resPartition.ErrorCode = errOffsetOutOfRange
+				failed = true
+				continue
+			}
+
+			var records []protocol.Record
+			var partitionSize int
+
+			for _, r := range part.records[p.FetchOffset:] {
+				// Always return at least one record so consumers can make
+				// progress, even when it exceeds the size limits.
+				if len(records) != 0 {
+					if p.PartitionMaxBytes > 0 && partitionSize+r.size() > int(p.PartitionMaxBytes) {
+						break
+					}
+					if req.MaxBytes > 0 && size+partitionSize+r.size() > int(req.MaxBytes) {
+						break
+					}
+				}
+				records = append(records, protocol.Record{
+					Offset:  r.offset,
+					Time:    r.time,
+					Key:     protocol.NewBytes(r.key),
+					Value:   protocol.NewBytes(r.value),
+					Headers: r.headers,
+				})
+				partitionSize += r.size()
+			}
+
+			if len(records) != 0 {
+				resPartition.RecordSet = protocol.RecordSet{
+					Version:    recordVersion,
+					Records:    protocol.NewRecordReader(records...),
+					BaseOffset: records[0].Offset,
+				}
+				// Count records without a key or value so that fetch
+				// requests waiting for them return.
+				size += partitionSize + len(records)
+			}
+		}
+	}
+
+	return res, size, failed
+}
+
+func (b *Broker) listOffsets(req *listoffsets.Request) *listoffsets.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	res := &listoffsets.Response{
+		Topics: make([]listoffsets.ResponseTopic, len(req.Topics)),
+	}
+
+	for i, topic := range req.Topics {
+		resTopic := &res.Topics[i]
+		resTopic.Topic = topic.Topic
+		resTopic.Partitions = make([]listoffsets.ResponsePartition, len(topic.Partitions))
+
+		for j, p := range topic.Partitions {
+			resPartition := &resTopic.Partitions[j]
+			resPartition.Partition = p.Partition
+			resPartition.Timestamp = -1
+			resPartition.Offset = -1
+
+			part := b.partition(topic.Topic, p.Partition)
+			if part == nil {
+				resPartition.ErrorCode = errUnknownTopicOrPartition
+				continue
+			}
+
+			switch p.Timestamp {
+			case -1: // last offset
+				resPartition.Offset = part.highWatermark()
+			case -2: // first offset
+				resPartition.Offset = 0
+			default:
+				for _, r := range part.records {
+					if ms := r.time.UnixNano() / int64(time.Millisecond); ms >= p.Timestamp {
+						resPartition.Timestamp = ms
+						resPartition.Offset = r.offset
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+func (b *Broker) createTopics(req *createtopics.Request) *createtopics.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.init()
+
+	res := &createtopics.Response{
+		Topics: make([]createtopics.ResponseTopic, len(req.Topics)),
+	}
+
+	for i, topic := range req.Topics {
+		resTopic := &res.Topics[i]
+		resTopic.Name = topic.Name
+		resTopic.ReplicationFactor = 1
+
+		numPartitions := int(topic.NumPartitions)
+		if numPartitions < 0 {
+			numPartitions = b.numPartitions()
+		}
+
+		switch _, exists := b.topics[topic.Name]; {
+		case exists:
+			resTopic.ErrorCode = errTopicAlreadyExists
+		case numPartitions == 0:
+			resTopic.ErrorCode = errInvalidPartitions
+		default:
+			resTopic.NumPartitions = int32(numPartitions)
+			if !req.ValidateOnly {
+				b.createTopic(topic.Name, numPartitions)
+			}
+		}
+	}
+
+	return res
+}
+
+func (b *Broker) createPartitions(req *createpartitions.Request) *createpartitions.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.init()
+
+	res := &createpartitions.Response{
+		Results: make([]createpartitions.ResponseResult, len(req.Topics)),
+	}
+
+	for i, topic := range req.Topics {
+		res.Results[i].Name = topic.Name
+
+		switch partitions, exists := b.topics[topic.Name]; {
+		case !exists:
+			res.Results[i].ErrorCode = errUnknownTopicOrPartition
+		case int(topic.Count) <= len(partitions):
+			res.Results[i].ErrorCode = errInvalidPartitions
+		case !req.ValidateOnly:
+			b.addPartitions(topic.Name, int(topic.Count))
+		}
+	}
+
+	return res
+}
+
+func (b *Broker) deleteTopics(req *deletetopics.Request) *deletetopics.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	res := &deletetopics.Response{
+		Responses: make([]deletetopics.ResponseTopic, len(req.TopicNames)),
+	}
+
+	for i, topic := range req.TopicNames {
+		res.Responses[i].Name = topic
+		if _, exists := b.topics[topic]; !exists {
+			res.Responses[i].ErrorCode = errUnknownTopicOrPartition
+		} else {
+			delete(b.topics, topic)
+		}
+	}
+
+	return res
+}
+
+func (b *Broker) findCoordinator(req *findcoordinator.Request) *findcoordinator.Response {
+	host, port := b.hostPort()
+	res := &findcoordinator.Response{
+		NodeID: brokerNodeID,
+		Host:   host,
+		Port:   port,
+	}
+	// The broker is the coordinator of every key, batched lookups (v4+)
+	// receive it for each of them.
+	for _, key := range req.CoordinatorKeys {
+		res.Coordinators = append(res.Coordinators, findcoordinator.ResponseCoordinator{
+			Key:    key,
+			NodeID: brokerNodeID,
+			Host:   host,
+			Port:   port,
+		})
+	}
+	return res
+}
+
+// createTopic must be called with the mutex held.
+func (b *Broker) createTopic(topic string, numPartitions int) []*partition {
+	partitions := make([]*partition, numPartitions)
+	for i := range partitions {
+		partitions[i] = new(partition)
+	}
+	b.topics[topic] = partitions
+	return partitions
+}
+
+// addPartitions must be called with the mutex held.
+func (b *Broker) addPartitions(topic string, count int) {
+	partitions := b.topics[topic]
+	for len(partitions) < count {
+		partitions = append(partitions, new(partition))
+	}
+	b.topics[topic] = partitions
+}
+
+// partition must be called with the mutex held.
+func (b *Broker) partition(topic string, partition int32) *partition {
+	partitions := b.topics[topic]
+	if partition < 0 || int(partition) >= len(partitions) {
+		return nil
+	}
+	return partitions[partition]
+}
+
+func (b *Broker) numPartitions() int {
+	if b.NumPartitions > 0 {
+		return b.NumPartitions
+	}
+	return 1
+}
+
+func (b *Broker) hostPort() (string, int32) {
+	host, port, _ := net.SplitHostPort(b.addr())
+	p, _ := strconv.Atoi(port)
+	return host, int32(p)
+}
+
+func (b *Broker) addr() string {
+	if b.Addr != "" {
+		return b.Addr
+	}
+	return defaultBrokerAddr
+}
+
+func (b *Broker) logf(msg string, args ...interface{}) {
+	if b.ErrorLogger != nil {
+		b.ErrorLogger.Printf("kafka mock broker: "+msg, args...)
+	}
+}
+
+func readRecords(rr protocol.RecordReader, now time.Time) ([]record, error) {
+	if rr == nil {
+		return nil, nil
+	}
+
+	var records []record
+	for {
+		r, err := rr.ReadRecord()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, err
+		}
+
+		key, err := readBytes(r.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readBytes(r.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		headers := make([]protocol.Header, len(r.Headers))
+		for i, h := range r.Headers {
+			headers[i] = protocol.Header{
+				Key:   h.Key,
+				Value: append([]byte(nil), h.Value...),
+			}
+		}
+
+		t := r.Time
+		if t.IsZero() {
+			t = now
+		}
+
+		records = append(records, record{
+			time:    t,
+			key:     key,
+			value:   value,
+			headers: headers,
+		})
+	}
+}
+
+func readBytes(b protocol.Bytes) ([]byte, error) {
+	if b == nil {
+		return nil, nil
+	}
+	defer b.Close()
+	return protocol.ReadAll(b)
+}
+
+func isClosedConn(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.ErrClosedPipe)
+}
+
+// brokerConn wraps the client side of connections to the broker so it
+// reports the address that the program dialed.
+type brokerConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *brokerConn) RemoteAddr() net.Addr { return c.addr }
+
+type brokerAddr string
+
+func (a brokerAddr) Network() string { return "tcp" }
+
+func (a brokerAddr) String() string { return string(a) }
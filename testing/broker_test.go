@@ -0,0 +1,240 @@
+package testing_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	ktesting "github.com/segmentio/kafka-go/testing"
+)
+
+func newTestBroker(t *testing.T) *ktesting.Broker {
+	return &ktesting.Broker{
+		ErrorLogger: log.New(os.Stderr, t.Name()+" ", 0),
+	}
+}
+
+func TestBrokerProduceAndFetch(t *testing.T) {
+	broker := newTestBroker(t)
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := &kafka.Writer{
+		Addr:      kafka.TCP("localhost:9092"),
+		Topic:     "topic-A",
+		Transport: &kafka.Transport{Dial: broker.Dial},
+	}
+	defer w.Close()
+
+	msgs := make([]kafka.Message, 10)
+	for i := range msgs {
+		msgs[i] = kafka.Message{
+			Key:     []byte(fmt.Sprintf("key-%d", i)),
+			Value:   []byte(fmt.Sprintf("value-%d", i)),
+			Headers: []kafka.Header{{Key: "index", Value: []byte{byte(i)}}},
+		}
+	}
+
+	if err := w.WriteMessages(ctx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "topic-A",
+		MaxWait: 100 * time.Millisecond,
+		Dialer:  &kafka.Dialer{DialFunc: broker.Dial},
+	})
+	defer r.Close()
+
+	for i, want := range msgs {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Offset != int64(i) {
+			t.Errorf("message #%d: expected offset %d but got %d", i, i, m.Offset)
+		}
+		if string(m.Key) != string(want.Key) || string(m.Value) != string(want.Value) {
+			t.Errorf("message #%d: expected %s=%s but got %s=%s", i, want.Key, want.Value, m.Key, m.Value)
+		}
+		if len(m.Headers) != 1 || m.Headers[0].Key != "index" || m.Headers[0].Value[0] != byte(i) {
+			t.Errorf("message #%d: unexpected headers: %+v", i, m.Headers)
+		}
+	}
+}
+
+func TestBrokerUnknownTopic(t *testing.T) {
+	broker := newTestBroker(t)
+	defer broker.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := &kafka.Client{
+		Addr:      kafka.TCP("localhost:9092"),
+		Transport: &kafka.Transport{Dial: broker.Dial},
+	}
+
+	res, err := client.Metadata(ctx, &kafka.MetadataRequest{
+		Topics: []string{"topic-A"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Topics) != 1 || res.Topics[0].Error != kafka.UnknownTopicOrPartition {
+		t.Errorf("expected the topic to be unknown: %+v", res.Topics)
+	}
+
+	broker.AutoCreateTopics = true
+	broker.NumPartitions = 3
+
+	w := &kafka.Writer{
+		Addr:                   kafka.TCP("localhost:9092"),
+		Topic:                  "topic-A",
+		AllowAutoTopicCreation: true,
+		Transport:              client.Transport,
+	}
+	defer w.Close()
+
+	if err := w.WriteMessages(ctx, kafka.Message{Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = client.Metadata(ctx, &kafka.MetadataRequest{
+		Topics: []string{"topic-A"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Topics) != 1 || len(res.Topics[0].Partitions) != 3 {
+		t.Errorf("expected the topic to be created with 3 partitions: %+v", res.Topics)
+	}
+}
+
+func TestBrokerConsumerGroup(t *testing.T) {
+	const (
+		topic      = "topic-A"
+		groupID    = "group-A"
+		partitions = 4
+		count      = 100
+	)
+
+	broker := newTestBroker(t)
+	defer broker.Close()
+
+	if err := broker.CreateTopic(topic, partitions); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	w := &kafka.Writer{
+		Addr:      kafka.TCP("localhost:9092"),
+		Topic:     topic,
+		Balancer:  &kafka.RoundRobin{},
+		Transport: &kafka.Transport{Dial: broker.Dial},
+	}
+	defer w.Close()
+
+	msgs := make([]kafka.Message, count)
+	for i := range msgs {
+		msgs[i].Value = []byte(fmt.Sprintf("value-%d", i))
+	}
+	if err := w.WriteMessages(ctx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	newReader := func() *kafka.Reader {
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers:           []string{"localhost:9092"},
+			Topic:             topic,
+			GroupID:           groupID,
+			MaxWait:           100 * time.Millisecond,
+			HeartbeatInterval: 100 * time.Millisecond,
+			Dialer:            &kafka.Dialer{DialFunc: broker.Dial},
+		})
+	}
+
+	// A first member of the group consumes and commits all the messages.
+	r := newReader()
+	for i := 0; i < count; i++ {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.CommitMessages(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// New members of the group resume from the committed offsets, so the only
+	// messages that they receive are the ones written after the first left.
+	last := make([]kafka.Message, partitions)
+	for i := range last {
+		last[i].Value = []byte(fmt.Sprintf("last-%d", i))
+	}
+	if err := w.WriteMessages(ctx, last...); err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	seen := make(map[string]bool)
+	done := make(chan struct{})
+
+	consume := func(r *kafka.Reader) error {
+		for {
+			m, err := r.ReadMessage(ctx)
+			if err != nil {
+				return err
+			}
+			if !strings.HasPrefix(string(m.Value), "last-") {
+				return fmt.Errorf("unexpected message %q at offset %d of partition %d", m.Value, m.Offset, m.Partition)
+			}
+			// Messages may be received twice if partitions are reassigned
+			// while the group rebalances.
+			mutex.Lock()
+			seen[string(m.Value)] = true
+			if len(seen) == partitions {
+				close(done)
+			}
+			mutex.Unlock()
+		}
+	}
+
+	readers := []*kafka.Reader{newReader(), newReader()}
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+
+	errs := make(chan error, len(readers))
+	for _, r := range readers {
+		go func(r *kafka.Reader) { errs <- consume(r) }(r)
+	}
+
+	select {
+	case <-done:
+	case err := <-errs:
+		t.Fatal(err)
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the last messages")
+	}
+}
@@ -0,0 +1,268 @@
+package testing
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/consumergroupheartbeat"
+)
+
+const (
+	defaultConsumerGroupHeartbeatInterval = 5 * time.Second
+
+	// consumerGroupSessionTimeout is the default value of the
+	// group.consumer.session.timeout.ms broker configuration.
+	consumerGroupSessionTimeout = 45 * time.Second
+)
+
+// consumerGroupHeartbeat implements a simplified version of the consumer group
+// protocol: the broker computes a range assignment of the partitions of the
+// subscribed topics each time the members or their subscriptions change, and
+// hands out partitions to their new owners once the previous owners released
+// them.
+func (b *Broker) consumerGroupHeartbeat(req *consumergroupheartbeat.Request) *consumergroupheartbeat.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if req.GroupID == "" {
+		return &consumergroupheartbeat.Response{ErrorCode: errInvalidGroupID}
+	}
+
+	g := b.group(req.GroupID)
+
+	if !g.consumerProtocol {
+		if len(g.members) != 0 {
+			return &consumergroupheartbeat.Response{
+				ErrorCode:    errGroupIDNotFound,
+				ErrorMessage: fmt.Sprintf("group %s is not a consumer group", g.id),
+			}
+		}
+		g.consumerProtocol = true
+	}
+
+	m := g.members[req.MemberID]
+
+	switch req.MemberEpoch {
+	case -1:
+		if m != nil {
+			b.removeConsumer(g, m)
+		}
+		return &consumergroupheartbeat.Response{MemberID: req.MemberID, MemberEpoch: -1}
+
+	case 0:
+		if m == nil {
+			b.nextID++
+			m = &member{id: req.MemberID}
+			if m.id == "" {
+				m.id = fmt.Sprintf("consumer-%d", b.nextID)
+			}
+			g.members[m.id] = m
+		}
+		m.epoch = 0
+		m.assigned = nil
+		m.owned = nil
+		g.generationID++
+
+	default:
+		switch {
+		case m == nil:
+			return &consumergroupheartbeat.Response{ErrorCode: errUnknownMemberID}
+		case req.MemberEpoch != m.epoch:
+			return &consumergroupheartbeat.Response{ErrorCode: errFencedMemberEpoch}
+		}
+	}
+
+	if req.SubscribedTopicNames != nil && !reflect.DeepEqual(req.SubscribedTopicNames, m.subscription) {
+		m.subscription = req.SubscribedTopicNames
+		g.generationID++
+	}
+
+	if req.TopicPartitions != nil {
+		m.owned = make(map[string][]int32, len(req.TopicPartitions))
+		for _, tp := range req.TopicPartitions {
+			if topic, ok := b.topicName(tp.TopicID); ok {
+				m.owned[topic] = tp.Partitions
+			}
+		}
+	}
+
+	m.sessionTimeout = consumerGroupSessionTimeout
+	b.resetConsumerSession(g, m)
+
+	res := &consumergroupheartbeat.Response{
+		MemberID:            m.id,
+		HeartbeatIntervalMs: int32(b.consumerGroupHeartbeatInterval() / time.Millisecond),
+	}
+
+	assigned := b.reconcile(g, m)
+	if m.epoch == 0 || !reflect.DeepEqual(assigned, m.assigned) {
+		m.assigned = assigned
+		res.Assignment = &consumergroupheartbeat.ResponseAssignment{
+			TopicPartitions: b.topicPartitions(assigned),
+		}
+	}
+
+	m.epoch = g.generationID
+	res.MemberEpoch = m.epoch
+	return res
+}
+
+// reconcile returns the partitions that can be assigned to m, which are the
+// partitions of its target assignment that no other members own.
+//
+// reconcile must be called with the mutex held.
+func (b *Broker) reconcile(g *group, m *member) map[string][]int32 {
+	target := b.targetAssignment(g)[m.id]
+	assigned := make(map[string][]int32, len(target))
+
+	for topic, partitions := range target {
+		for _, p := range partitions {
+			if !g.ownedByOther(m, topic, p) {
+				assigned[topic] = append(assigned[topic], p)
+			}
+		}
+	}
+
+	return assigned
+}
+
+// targetAssignment computes a range assignment of the partitions of the topics
+// that members of g subscribed to.
+//
+// targetAssignment must be called with the mutex held.
+func (b *Broker) targetAssignment(g *group) map[string]map[string][]int32 {
+	subscribers := make(map[string][]string)
+
+	for _, m := range g.members {
+		for _, topic := range m.subscription {
+			subscribers[topic] = append(subscribers[topic], m.id)
+		}
+	}
+
+	assignment := make(map[string]map[string][]int32, len(g.members))
+
+	for topic, memberIDs := range subscribers {
+		numPartitions := len(b.topics[topic])
+		if numPartitions == 0 {
+			continue
+		}
+
+		sort.Strings(memberIDs)
+		n, extra := numPartitions/len(memberIDs), numPartitions%len(memberIDs)
+		next := 0
+
+		for i, id := range memberIDs {
+			count := n
+			if i < extra {
+				count++
+			}
+			for p := next; p < next+count; p++ {
+				if assignment[id] == nil {
+					assignment[id] = make(map[string][]int32)
+				}
+				assignment[id][topic] = append(assignment[id][topic], int32(p))
+			}
+			next += count
+		}
+	}
+
+	return assignment
+}
+
+// topicName must be called with the mutex held.
+func (b *Broker) topicName(id protocol.UUID) (string, bool) {
+	for topic := range b.topics {
+		if topicID(topic) == id {
+			return topic, true
+		}
+	}
+	return "", false
+}
+
+func (b *Broker) topicPartitions(assignment map[string][]int32) []consumergroupheartbeat.ResponseTopicPartition {
+	topics := make([]string, 0, len(assignment))
+	for topic := range assignment {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	tps := make([]consumergroupheartbeat.ResponseTopicPartition, len(topics))
+	for i, topic := range topics {
+		tps[i] = consumergroupheartbeat.ResponseTopicPartition{
+			TopicID:    topicID(topic),
+			Partitions: assignment[topic],
+		}
+	}
+	return tps
+}
+
+func (b *Broker) consumerGroupHeartbeatInterval() time.Duration {
+	if b.ConsumerGroupHeartbeatInterval > 0 {
+		return b.ConsumerGroupHeartbeatInterval
+	}
+	return defaultConsumerGroupHeartbeatInterval
+}
+
+// removeConsumer must be called with the mutex held.
+func (b *Broker) removeConsumer(g *group, m *member) {
+	g.deleteMember(m)
+	g.generationID++
+
+	if len(g.members) == 0 {
+		g.consumerProtocol = false
+	}
+}
+
+// resetConsumerSession must be called with the mutex held.
+func (b *Broker) resetConsumerSession(g *group, m *member) {
+	m.stopTimer()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(m.sessionTimeout, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if b.closed || m.timer != timer || g.members[m.id] != m {
+			return
+		}
+
+		b.removeConsumer(g, m)
+	})
+	m.timer = timer
+}
+
+// ownedByOther returns true if a member of g other than m was assigned the
+// partition, or did not acknowledge that it released it yet.
+func (g *group) ownedByOther(m *member, topic string, partition int32) bool {
+	for _, other := range g.members {
+		if other == m {
+			continue
+		}
+		if containsPartition(other.assigned[topic], partition) || containsPartition(other.owned[topic], partition) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// topicID derives the ID of a topic from its name, which gives topics stable
+// IDs without having to keep track of them.
+func topicID(topic string) protocol.UUID {
+	var id protocol.UUID
+	sum := sha256.Sum256([]byte(topic))
+	copy(id[:], sum[:])
+	return id
+}
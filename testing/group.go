@@ -0,0 +1,625 @@
+package testing
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol/heartbeat"
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/offsetcommit"
+	"github.com/segmentio/kafka-go/protocol/offsetfetch"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+)
+
+type groupState int
+
+const (
+	groupEmpty groupState = iota
+	groupPreparingRebalance
+	groupCompletingRebalance
+	groupStable
+)
+
+// group is the state of a consumer group managed by the broker, which acts as
+// the coordinator of all groups. The group protocol is a simplified version of
+// the one implemented by kafka: members joining or leaving the group, and
+// members missing heartbeats for longer than their session timeout, trigger a
+// rebalance which completes once all members have rejoined, or once the
+// rebalance timeout expired.
+//
+// All fields are protected by the broker mutex.
+type group struct {
+	id           string
+	state        groupState
+	generationID int32
+	protocolType string
+	protocolName string
+	leaderID     string
+	members      map[string]*member
+	offsets      map[string]map[int32]committedOffset
+	timer        *time.Timer
+
+	// consumerProtocol is true when the members use the consumer group
+	// protocol instead of JoinGroup and SyncGroup, generationID is then the
+	// group epoch.
+	consumerProtocol bool
+}
+
+type member struct {
+	id               string
+	protocols        []joingroup.RequestProtocol
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	assignment       []byte
+	timer            *time.Timer
+
+	// Channels of pending join and sync requests, the responses are sent when
+	// the rebalance moves on to the next state.
+	join chan *joingroup.Response
+	sync chan *syncgroup.Response
+
+	// State of members using the consumer group protocol, partitions are
+	// indexed by topic name.
+	epoch        int32
+	subscription []string
+	assigned     map[string][]int32
+	owned        map[string][]int32
+}
+
+type committedOffset struct {
+	offset   int64
+	metadata string
+}
+
+// group must be called with the mutex held.
+func (b *Broker) group(groupID string) *group {
+	b.init()
+	g := b.groups[groupID]
+	if g == nil {
+		g = &group{
+			id:      groupID,
+			members: make(map[string]*member),
+			offsets: make(map[string]map[int32]committedOffset),
+		}
+		b.groups[groupID] = g
+	}
+	return g
+}
+
+func (b *Broker) joinGroup(version int16, clientID string, req *joingroup.Request) (*joingroup.Response, error) {
+	b.mutex.Lock()
+
+	if req.GroupID == "" {
+		b.mutex.Unlock()
+		return &joingroup.Response{ErrorCode: errInvalidGroupID}, nil
+	}
+
+	g := b.group(req.GroupID)
+
+	if g.consumerProtocol || !g.supports(req) {
+		b.mutex.Unlock()
+		return &joingroup.Response{ErrorCode: errInconsistentGroupProtocol}, nil
+	}
+
+	var m *member
+	if req.MemberID == "" {
+		if clientID == "" {
+			clientID = "member"
+		}
+		b.nextID++
+		m = &member{id: fmt.Sprintf("%s-%d", clientID, b.nextID)}
+		g.members[m.id] = m
+	} else if m = g.members[req.MemberID]; m == nil {
+		b.mutex.Unlock()
+		return &joingroup.Response{ErrorCode: errUnknownMemberID}, nil
+	}
+
+	m.protocols = req.Protocols
+	m.sessionTimeout = time.Duration(req.SessionTimeoutMs) * time.Millisecond
+	m.rebalanceTimeout = time.Duration(req.RebalanceTimeoutMs) * time.Millisecond
+	if version == 0 {
+		m.rebalanceTimeout = m.sessionTimeout
+	}
+	g.protocolType = req.ProtocolType
+
+	if m.join != nil {
+		m.join <- &joingroup.Response{ErrorCode: errRebalanceInProgress}
+	}
+	if m.sync != nil {
+		m.sync <- &syncgroup.Response{ErrorCode: errRebalanceInProgress}
+		m.sync = nil
+	}
+
+	// Members waiting for the rebalance to complete cannot be expired.
+	m.stopTimer()
+	m.join = make(chan *joingroup.Response, 1)
+	join, done := m.join, b.done
+
+	if g.state != groupPreparingRebalance {
+		b.prepareRebalance(g)
+	}
+	b.maybeCompleteJoin(g)
+	b.mutex.Unlock()
+
+	select {
+	case res := <-join:
+		return res, nil
+	case <-done:
+		return nil, errBrokerClosed
+	}
+}
+
+func (b *Broker) syncGroup(req *syncgroup.Request) (*syncgroup.Response, error) {
+	b.mutex.Lock()
+
+	g := b.group(req.GroupID)
+	m := g.members[req.MemberID]
+
+	switch {
+	case m == nil:
+		b.mutex.Unlock()
+		return &syncgroup.Response{ErrorCode: errUnknownMemberID}, nil
+	case req.GenerationID != g.generationID:
+		b.mutex.Unlock()
+		return &syncgroup.Response{ErrorCode: errIllegalGeneration}, nil
+	case g.state == groupPreparingRebalance:
+		b.mutex.Unlock()
+		return &syncgroup.Response{ErrorCode: errRebalanceInProgress}, nil
+	}
+
+	b.resetSession(g, m)
+
+	if g.state == groupCompletingRebalance {
+		if m.id == g.leaderID {
+			for _, a := range req.Assignments {
+				if assigned := g.members[a.MemberID]; assigned != nil {
+					assigned.assignment = a.Assignment
+				}
+			}
+			g.state = groupStable
+			for _, other := range g.members {
+				if other.sync != nil {
+					other.sync <- g.syncResponse(other)
+					other.sync = nil
+				}
+			}
+		} else {
+			m.sync = make(chan *syncgroup.Response, 1)
+			sync, done := m.sync, b.done
+			b.mutex.Unlock()
+
+			select {
+			case res := <-sync:
+				return res, nil
+			case <-done:
+				return nil, errBrokerClosed
+			}
+		}
+	}
+
+	res := g.syncResponse(m)
+	b.mutex.Unlock()
+	return res, nil
+}
+
+func (b *Broker) heartbeat(req *heartbeat.Request) *heartbeat.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	g := b.group(req.GroupID)
+	m := g.members[req.MemberID]
+
+	switch {
+	case m == nil:
+		return &heartbeat.Response{ErrorCode: errUnknownMemberID}
+	case req.GenerationID != g.generationID:
+		return &heartbeat.Response{ErrorCode: errIllegalGeneration}
+	case g.state == groupPreparingRebalance:
+		return &heartbeat.Response{ErrorCode: errRebalanceInProgress}
+	}
+
+	b.resetSession(g, m)
+	return &heartbeat.Response{}
+}
+
+func (b *Broker) leaveGroup(version int16, req *leavegroup.Request) *leavegroup.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	g := b.group(req.GroupID)
+
+	if version < 3 {
+		m := g.members[req.MemberID]
+		if m == nil {
+			return &leavegroup.Response{ErrorCode: errUnknownMemberID}
+		}
+		b.removeMember(g, m)
+		return &leavegroup.Response{}
+	}
+
+	res := &leavegroup.Response{
+		Members: make([]leavegroup.ResponseMember, len(req.Members)),
+	}
+	for i, lm := range req.Members {
+		res.Members[i] = leavegroup.ResponseMember{
+			MemberID:        lm.MemberID,
+			GroupInstanceID: lm.GroupInstanceID,
+		}
+		if m := g.members[lm.MemberID]; m == nil {
+			res.Members[i].ErrorCode = errUnknownMemberID
+		} else {
+			b.removeMember(g, m)
+		}
+	}
+	return res
+}
+
+func (b *Broker) offsetCommit(version int16, req *offsetcommit.Request) *offsetcommit.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	g := b.group(req.GroupID)
+	errorCode := errNone
+
+	// Version 0 of the API, or a generation of -1, are used to commit offsets
+	// outside of a consumer group generation. Like kafka, members are allowed
+	// to commit offsets while the group is preparing a rebalance, but not
+	// until they received their new assignments.
+	if g.consumerProtocol && req.GenerationID >= 0 {
+		// Members of groups using the consumer group protocol commit with
+		// their member epoch, which requires version 9 or above.
+		switch m := g.members[req.MemberID]; {
+		case version < 9:
+			errorCode = errUnsupportedVersion
+		case m == nil:
+			errorCode = errUnknownMemberID
+		case req.GenerationID > m.epoch:
+			errorCode = errFencedMemberEpoch
+		case req.GenerationID < m.epoch:
+			errorCode = errStaleMemberEpoch
+		}
+	} else if version > 0 && req.GenerationID >= 0 {
+		switch {
+		case g.state == groupCompletingRebalance:
+			errorCode = errRebalanceInProgress
+		case g.members[req.MemberID] == nil:
+			errorCode = errUnknownMemberID
+		case req.GenerationID != g.generationID:
+			errorCode = errIllegalGeneration
+		}
+	}
+
+	res := &offsetcommit.Response{
+		Topics: make([]offsetcommit.ResponseTopic, len(req.Topics)),
+	}
+
+	for i, topic := range req.Topics {
+		resTopic := &res.Topics[i]
+		resTopic.Name = topic.Name
+		resTopic.Partitions = make([]offsetcommit.ResponsePartition, len(topic.Partitions))
+
+		for j, p := range topic.Partitions {
+			resTopic.Partitions[j] = offsetcommit.ResponsePartition{
+				PartitionIndex: p.PartitionIndex,
+				ErrorCode:      errorCode,
+			}
+			if errorCode != errNone {
+				continue
+			}
+			offsets := g.offsets[topic.Name]
+			if offsets == nil {
+				offsets = make(map[int32]committedOffset)
+				g.offsets[topic.Name] = offsets
+			}
+			offsets[p.PartitionIndex] = committedOffset{
+				offset:   p.CommittedOffset,
+				metadata: p.CommittedMetadata,
+			}
+		}
+	}
+
+	return res
+}
+
+func (b *Broker) offsetFetch(version int16, req *offsetfetch.Request) *offsetfetch.Response {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if version < 8 {
+		return &offsetfetch.Response{
+			Topics: b.committedOffsets(req.GroupID, req.Topics),
+		}
+	}
+
+	res := &offsetfetch.Response{
+		Groups: make([]offsetfetch.ResponseGroup, len(req.Groups)),
+	}
+	for i, g := range req.Groups {
+		res.Groups[i] = offsetfetch.ResponseGroup{
+			GroupID: g.GroupID,
+			Topics:  b.committedOffsets(g.GroupID, g.Topics),
+		}
+	}
+	return res
+}
+
+// committedOffsets must be called with the mutex held.
+func (b *Broker) committedOffsets(groupID string, topics []offsetfetch.RequestTopic) []offsetfetch.ResponseTopic {
+	g := b.group(groupID)
+
+	if topics == nil {
+		// A null list of topics requests the offsets of all topics that the
+		// group has committed offsets for.
+		for topic, offsets := range g.offsets {
+			t := offsetfetch.RequestTopic{Name: topic}
+			for partition := range offsets {
+				t.PartitionIndexes = append(t.PartitionIndexes, partition)
+			}
+			sort.Slice(t.PartitionIndexes, func(i, j int) bool {
+				return t.PartitionIndexes[i] < t.PartitionIndexes[j]
+			})
+			topics = append(topics, t)
+		}
+		sort.Slice(topics, func(i, j int) bool {
+			return topics[i].Name < topics[j].Name
+		})
+	}
+
+	resTopics := make([]offsetfetch.ResponseTopic, len(topics))
+
+	for i, topic := range topics {
+		resTopic := &resTopics[i]
+		resTopic.Name = topic.Name
+		resTopic.Partitions = make([]offsetfetch.ResponsePartition, len(topic.PartitionIndexes))
+
+		for j, partition := range topic.PartitionIndexes {
+			resPartition := offsetfetch.ResponsePartition{
+				PartitionIndex:      partition,
+				CommittedOffset:     -1,
+				ComittedLeaderEpoch: -1,
+			}
+			if committed, ok := g.offsets[topic.Name][partition]; ok {
+				resPartition.CommittedOffset = committed.offset
+				resPartition.Metadata = committed.metadata
+			}
+			resTopic.Partitions[j] = resPartition
+		}
+	}
+
+	return resTopics
+}
+
+// prepareRebalance must be called with the mutex held.
+func (b *Broker) prepareRebalance(g *group) {
+	g.state = groupPreparingRebalance
+
+	var timeout time.Duration
+	for _, m := range g.members {
+		if m.sync != nil {
+			m.sync <- &syncgroup.Response{ErrorCode: errRebalanceInProgress}
+			m.sync = nil
+		}
+		if m.rebalanceTimeout > timeout {
+			timeout = m.rebalanceTimeout
+		}
+	}
+
+	g.stopTimer()
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if b.closed || g.timer != timer || g.state != groupPreparingRebalance {
+			return
+		}
+
+		// Members which did not rejoin the group within the rebalance timeout
+		// are removed from the group.
+		for _, m := range g.members {
+			if m.join == nil {
+				g.deleteMember(m)
+			}
+		}
+		b.maybeCompleteJoin(g)
+	})
+	g.timer = timer
+}
+
+// maybeCompleteJoin must be called with the mutex held.
+func (b *Broker) maybeCompleteJoin(g *group) {
+	if g.state != groupPreparingRebalance {
+		return
+	}
+
+	for _, m := range g.members {
+		if m.join == nil {
+			return
+		}
+	}
+
+	g.stopTimer()
+	g.generationID++
+
+	if len(g.members) == 0 {
+		g.state = groupEmpty
+		g.leaderID = ""
+		g.protocolName = ""
+		return
+	}
+
+	memberIDs := make([]string, 0, len(g.members))
+	for id := range g.members {
+		memberIDs = append(memberIDs, id)
+	}
+	sort.Strings(memberIDs)
+
+	if g.members[g.leaderID] == nil {
+		g.leaderID = memberIDs[0]
+	}
+
+	g.protocolName = g.selectProtocol()
+	g.state = groupCompletingRebalance
+
+	for _, id := range memberIDs {
+		m := g.members[id]
+		m.assignment = nil
+
+		res := &joingroup.Response{
+			GenerationID: g.generationID,
+			ProtocolType: g.protocolType,
+			ProtocolName: g.protocolName,
+			LeaderID:     g.leaderID,
+			MemberID:     m.id,
+		}
+
+		if m.id == g.leaderID {
+			res.Members = make([]joingroup.ResponseMember, 0, len(memberIDs))
+			for _, id := range memberIDs {
+				res.Members = append(res.Members, joingroup.ResponseMember{
+					MemberID: id,
+					Metadata: g.members[id].metadata(g.protocolName),
+				})
+			}
+		}
+
+		m.join <- res
+		m.join = nil
+		b.resetSession(g, m)
+	}
+}
+
+// removeMember must be called with the mutex held.
+func (b *Broker) removeMember(g *group, m *member) {
+	g.deleteMember(m)
+
+	switch {
+	case len(g.members) == 0:
+		g.stopTimer()
+		g.state = groupEmpty
+		g.leaderID = ""
+		g.protocolName = ""
+	case g.state == groupPreparingRebalance:
+		b.maybeCompleteJoin(g)
+	default:
+		b.prepareRebalance(g)
+	}
+}
+
+// resetSession must be called with the mutex held.
+func (b *Broker) resetSession(g *group, m *member) {
+	m.stopTimer()
+
+	var timer *time.Timer
+	timer = time.AfterFunc(m.sessionTimeout, func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		if b.closed || m.timer != timer || g.members[m.id] != m {
+			return
+		}
+
+		b.removeMember(g, m)
+	})
+	m.timer = timer
+}
+
+// supports returns true if the protocols of the joining member are compatible
+// with those of the current members of the group.
+func (g *group) supports(req *joingroup.Request) bool {
+	if len(req.Protocols) == 0 {
+		return false
+	}
+	if len(g.members) == 0 {
+		return true
+	}
+	if req.ProtocolType != g.protocolType {
+		return false
+	}
+	for _, p := range req.Protocols {
+		if g.supportedByAll(p.Name, req.MemberID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *group) supportedByAll(protocol, exceptMemberID string) bool {
+	for _, m := range g.members {
+		if m.id != exceptMemberID && m.metadata(protocol) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// selectProtocol returns the first protocol of the leader's preference list
+// which is supported by all members.
+func (g *group) selectProtocol() string {
+	for _, p := range g.members[g.leaderID].protocols {
+		if g.supportedByAll(p.Name, "") {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+func (g *group) syncResponse(m *member) *syncgroup.Response {
+	return &syncgroup.Response{
+		ProtocolType: g.protocolType,
+		ProtocolName: g.protocolName,
+		Assignment:   m.assignment,
+	}
+}
+
+func (g *group) deleteMember(m *member) {
+	m.stopTimer()
+	delete(g.members, m.id)
+
+	if m.join != nil {
+		m.join <- &joingroup.Response{ErrorCode: errUnknownMemberID}
+		m.join = nil
+	}
+	if m.sync != nil {
+		m.sync <- &syncgroup.Response{ErrorCode: errUnknownMemberID}
+		m.sync = nil
+	}
+	if g.leaderID == m.id {
+		g.leaderID = ""
+	}
+}
+
+func (g *group) stopTimer() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+}
+
+func (g *group) stop() {
+	g.stopTimer()
+	for _, m := range g.members {
+		m.stopTimer()
+	}
+}
+
+func (m *member) metadata(protocol string) []byte {
+	for _, p := range m.protocols {
+		if p.Name == protocol {
+			if p.Metadata == nil {
+				return []byte{}
+			}
+			return p.Metadata
+		}
+	}
+	return nil
+}
+
+func (m *member) stopTimer() {
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
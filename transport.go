@@ -88,10 +88,31 @@ type Transport struct {
 	// An optional configuration for TLS connections established by this
 	// transport.
 	//
-	// If the Server
+	// If the ServerName is not set, it is inferred from the address of the
+	// broker, see TLSServerName. The GetClientCertificate and VerifyConnection
+	// functions of the configuration are called on each handshake, see
+	// Dialer.TLS.
 	TLS *tls.Config
 
+	// An optional function returning the TLS configuration of each new
+	// connection, taking precedence over TLS. It allows programs to rotate
+	// certificates without recreating the transport, connections that already
+	// exist are kept until they are closed.
+	//
+	// The function must be safe for concurrent use, see
+	// Dialer.TLSConfigFunc for details.
+	TLSConfigFunc func() (*tls.Config, error)
+
+	// An optional function returning the server name used to verify the
+	// certificate of the broker at addr, when the TLS configuration has no
+	// ServerName. It is useful when brokers present certificates for names
+	// which differ from their advertised addresses, for example behind a load
+	// balancer. Returning an empty string falls back to the host of addr.
+	TLSServerName func(addr string) string
+
 	// SASL configures the Transfer to use SASL authentication.
+	//
+	// See Dialer.SASLMechanism for how the SASL flow is selected.
 	SASL sasl.Mechanism
 
 	// An optional resolver used to translate broker host names into network
@@ -107,6 +128,85 @@ type Transport struct {
 	// resolution, and is always called with a pre-resolved address.
 	Resolver BrokerResolver
 
+	// If not nil, receives the metrics of the connections established by the
+	// transport, labeled with the address of the broker:
+	//
+	//	kafka.transport.connect.count   connections established
+	//	kafka.transport.dial.errors     failures to open network connections
+	//	kafka.transport.tls.errors      failures of TLS handshakes
+	//	kafka.transport.sasl.errors     failures of SASL authentications
+	//	kafka.transport.request.errors  failures of requests, also labeled with
+	//	                                the name of the API
+	//	kafka.transport.circuit.open    circuit breakers opened, see
+	//	                                CircuitBreakerThreshold
+	//
+	// Request errors are the errors which prevented a response from being
+	// received, like network errors, not the error codes of responses.
+	MetricsHook MetricsHook
+
+	// If not nil, specifies a logger which receives both the connections and
+	// the failures to connect, with the address of the broker as attribute.
+	StructuredLogger StructuredLogger
+
+	// CircuitBreakerThreshold enables a circuit breaker for each broker, which
+	// opens after the given number of consecutive failures to connect to the
+	// broker or to receive responses from it. While the circuit is open,
+	// requests routed to the broker fail immediately with ErrCircuitOpen
+	// instead of waiting for the broker to time out.
+	//
+	// After CircuitBreakerCooldown, the circuit becomes half-open and the next
+	// request is sent to probe the broker; the circuit is closed if it
+	// succeeds, and opened again otherwise. The state of the circuits is
+	// returned by CircuitBreakerStates.
+	//
+	// Requests are not rerouted while the circuit of a broker is open, the
+	// partition leaders and coordinators they are sent to are the only brokers
+	// which can serve them. Programs may retry after the cool-down period, or
+	// once the metadata shows that leadership moved to another broker.
+	//
+	// Default: 0 (disabled)
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerCooldown is the time during which requests to a broker
+	// fail fast after its circuit breaker opened.
+	//
+	// Default: 10s
+	CircuitBreakerCooldown time.Duration
+
+	// ReconnectBackoffMin enables a backoff between the attempts to connect to
+	// a broker after failing to connect to it, which protects brokers that are
+	// recovering from a storm of reconnections. The delay starts at
+	// ReconnectBackoffMin and doubles after each consecutive failure, up to
+	// ReconnectBackoffMax; it is reset once a connection succeeds.
+	//
+	// The delays are randomized between half and all of their value, which
+	// spreads the reconnections of programs that lost their connections at the
+	// same time. The backoff is tracked separately for each broker.
+	//
+	// Default: 0 (disabled)
+	ReconnectBackoffMin time.Duration
+
+	// ReconnectBackoffMax is the maximum delay between the attempts to connect
+	// to a broker, see ReconnectBackoffMin.
+	//
+	// Default: 10s
+	ReconnectBackoffMax time.Duration
+
+	// BrokerRouting is the policy selecting the broker that requests which any
+	// broker can serve are sent to, like the Metadata requests refreshing the
+	// cached cluster layout. Routing them to a broker in the same rack or with
+	// the lowest latency reduces their latency and the cross-zone traffic.
+	//
+	// Unlike requests sent to the bootstrap address, requests routed to a
+	// broker share the connections used by other requests sent to the broker.
+	//
+	// Default: RouteToBootstrap
+	BrokerRouting BrokerRouting
+
+	// RackID is the rack that the program is running in, used by the
+	// RouteToRack policy.
+	RackID string
+
 	// The background context used to control goroutines started internally by
 	// the transport.
 	//
@@ -115,6 +215,7 @@ type Transport struct {
 
 	mutex sync.RWMutex
 	pools map[networkAddress]*connPool
+	stats transportStats
 }
 
 // DefaultTransport is the default transport used by kafka clients in this
@@ -177,6 +278,14 @@ func (t *Transport) RoundTrip(ctx context.Context, addr net.Addr, req Request) (
 	return p.roundTrip(ctx, req)
 }
 
+// refreshMetadata forces an update of the metadata cached for the cluster at
+// addr, it returns once the update completed or the context was canceled.
+func (t *Transport) refreshMetadata(ctx context.Context, addr net.Addr) {
+	p := t.grabPool(addr)
+	defer p.unref()
+	p.refreshMetadata(ctx, nil)
+}
+
 func (t *Transport) dial() func(context.Context, string, string) (net.Conn, error) {
 	if t.Dial != nil {
 		return t.Dial
@@ -205,6 +314,24 @@ func (t *Transport) metadataTTL() time.Duration {
 	return 6 * time.Second
 }
 
+func (t *Transport) circuitBreakerCooldown() time.Duration {
+	if t.CircuitBreakerCooldown > 0 {
+		return t.CircuitBreakerCooldown
+	}
+	return 10 * time.Second
+}
+
+func (t *Transport) reconnectBackoffMax() time.Duration {
+	max := t.ReconnectBackoffMax
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	if max < t.ReconnectBackoffMin {
+		max = t.ReconnectBackoffMin
+	}
+	return max
+}
+
 func (t *Transport) grabPool(addr net.Addr) *connPool {
 	k := networkAddress{
 		network: addr.Network(),
@@ -241,8 +368,22 @@ func (t *Transport) grabPool(addr net.Addr) *connPool {
 		metadataTTL: t.metadataTTL(),
 		clientID:    t.ClientID,
 		tls:         t.TLS,
+		tlsFunc:     t.TLSConfigFunc,
+		tlsName:     t.TLSServerName,
 		sasl:        t.SASL,
 		resolver:    t.Resolver,
+		hook:        t.MetricsHook,
+		stats:       &t.stats,
+		logger:      t.StructuredLogger,
+
+		breakerThreshold: t.CircuitBreakerThreshold,
+		breakerCooldown:  t.circuitBreakerCooldown(),
+
+		reconnectBackoffMin: t.ReconnectBackoffMin,
+		reconnectBackoffMax: t.reconnectBackoffMax(),
+
+		routing: t.BrokerRouting,
+		rackID:  t.RackID,
 
 		ready:  make(event),
 		wake:   make(chan event),
@@ -282,8 +423,22 @@ type connPool struct {
 	metadataTTL time.Duration
 	clientID    string
 	tls         *tls.Config
+	tlsFunc     func() (*tls.Config, error)
+	tlsName     func(string) string
 	sasl        sasl.Mechanism
 	resolver    BrokerResolver
+	hook        MetricsHook
+	stats       *transportStats
+	logger      StructuredLogger
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	reconnectBackoffMin time.Duration
+	reconnectBackoffMax time.Duration
+
+	routing BrokerRouting
+	rackID  string
 	// Signaling mechanisms to orchestrate communications between the pool and
 	// the rest of the program.
 	once   sync.Once  // ensure that `ready` is triggered only once
@@ -303,6 +458,12 @@ type connPoolState struct {
 	layout   protocol.Cluster // cluster layout built from metadata response
 }
 
+// count increments the counter identified by name on the metrics hook of the
+// pool, api is empty when the metric does not relate to a request.
+func (p *connPool) count(name, broker, api string) {
+	countMetric(p.hook, name, 1, MetricLabels{Partition: -1, Broker: broker, API: api})
+}
+
 func (p *connPool) grabState() connPoolState {
 	state, _ := p.state.Load().(connPoolState)
 	return state
@@ -356,9 +517,10 @@ func (p *connPool) roundTrip(ctx context.Context, req Request) (Response, error)
 		cachedMeta := filterMetadataResponse(m, state.metadata)
 		// requestNeeded indicates if we need to send this metadata request to the server.
 		// It's true when we want to auto-create topics and we don't have the topic in our
-		// cache.
-		var requestNeeded bool
-		if m.AllowAutoTopicCreation {
+		// cache, or when the authorized operations are requested since the cache does not
+		// hold them.
+		requestNeeded := m.IncludeClusterAuthorizedOperations || m.IncludeTopicAuthorizedOperations
+		if m.AllowAutoTopicCreation && !requestNeeded {
 			for _, topic := range cachedMeta.Topics {
 				if topic.ErrorCode == int16(UnknownTopicOrPartition) {
 					requestNeeded = true
@@ -395,6 +557,17 @@ func (p *connPool) roundTrip(ctx context.Context, req Request) (Response, error)
 		return r, err
 	}
 
+	for attempt := 1; attempt < maxControllerAttempts && isNotController(r); attempt++ {
+		// The controller may have moved since the metadata was cached, or the
+		// broker failed to forward the request to the KRaft controller; the
+		// request was not applied so it is retried after a metadata refresh.
+		p.refreshMetadata(ctx, nil)
+
+		if r, err = p.sendRequest(ctx, req, p.grabState()).await(ctx); err != nil {
+			return r, err
+		}
+	}
+
 	switch resp := r.(type) {
 	case *createtopics.Response:
 		// Force an update of the metadata when adding topics,
@@ -434,6 +607,15 @@ func (p *connPool) roundTrip(ctx context.Context, req Request) (Response, error)
 	return r, nil
 }
 
+// maxControllerAttempts is the number of times requests routed to the cluster
+// controller are sent before returning a NotController error to the program.
+const maxControllerAttempts = 3
+
+func isNotController(r Response) bool {
+	c, ok := r.(protocol.ControllerResponse)
+	return ok && c.NotController()
+}
+
 // refreshMetadata forces an update of the cached cluster metadata, and waits
 // for the given list of topics to appear. This waiting mechanism is necessary
 // to account for the fact that topic creation is asynchronous in kafka, and
@@ -653,7 +835,15 @@ func (p *connPool) grabBrokerConn(ctx context.Context, brokerID int32) (*conn, e
 //
 // In either cases, the requests are multiplexed so we can keep a minimal number
 // of connections open (N+1, where N is the number of brokers in the cluster).
+//
+// The routing policy of the pool may select a broker of the cluster instead,
+// the connection to the cluster is used if it fails to connect to the broker.
 func (p *connPool) grabClusterConn(ctx context.Context) (*conn, error) {
+	if g := p.routeGroup(); g != nil {
+		if c, err := g.grabConnOrConnect(ctx); err == nil {
+			return c, nil
+		}
+	}
 	return p.ctrl.grabConnOrConnect(ctx)
 }
 
@@ -838,17 +1028,22 @@ func (p *connPool) newConnGroup(a net.Addr) *connGroup {
 		broker: Broker{
 			ID: -1,
 		},
+		breaker:   p.newCircuitBreaker(a.String()),
+		reconnect: p.newReconnectBackoff(),
 	}
 }
 
 func (p *connPool) newBrokerConnGroup(broker Broker) *connGroup {
+	addr := &networkAddress{
+		network: "tcp",
+		address: net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port)),
+	}
 	return &connGroup{
-		addr: &networkAddress{
-			network: "tcp",
-			address: net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port)),
-		},
-		pool:   p,
-		broker: broker,
+		addr:      addr,
+		pool:      p,
+		broker:    broker,
+		breaker:   p.newCircuitBreaker(addr.String()),
+		reconnect: p.newReconnectBackoff(),
 	}
 }
 
@@ -947,13 +1142,16 @@ type connGroup struct {
 	addr   net.Addr
 	broker Broker
 	// Immutable state of the connection.
-	pool *connPool
+	pool      *connPool
+	breaker   *circuitBreaker   // nil when circuit breakers are disabled
+	reconnect *reconnectBackoff // nil when reconnect backoffs are disabled
 	// Shared state of the connection, this is synchronized on the mutex through
 	// calls to the synchronized method. Both goroutines of the connection share
 	// the state maintained in these fields.
-	mutex     sync.Mutex
-	closed    bool
-	idleConns []*conn // stack of idle connections
+	mutex      sync.Mutex
+	closed     bool
+	idleConns  []*conn       // stack of idle connections
+	avgLatency time.Duration // moving average of round trips, see observeLatency
 }
 
 func (g *connGroup) closeIdleConns() {
@@ -969,6 +1167,10 @@ func (g *connGroup) closeIdleConns() {
 }
 
 func (g *connGroup) grabConnOrConnect(ctx context.Context) (*conn, error) {
+	if !g.breaker.allow() {
+		return nil, fmt.Errorf("%s: %w", g.addr, ErrCircuitOpen)
+	}
+
 	rslv := g.pool.resolver
 	addr := g.addr
 	var c *conn
@@ -1003,18 +1205,33 @@ func (g *connGroup) grabConnOrConnect(ctx context.Context) (*conn, error) {
 		}
 	}
 
-	if c == nil {
+	if c != nil {
+		c.stats.reuse()
+	} else {
+		if err := g.reconnect.wait(ctx); err != nil {
+			return nil, err
+		}
+
 		connChan := make(chan *conn)
 		errChan := make(chan error)
 
 		go func() {
 			c, err := g.connect(ctx, addr)
 			if err != nil {
+				if g.pool.logger != nil {
+					g.pool.logger.ErrorContext(ctx, "failed to connect to kafka broker", "broker", addr.String(), "error", err)
+				}
+				g.breaker.failure(err)
+				g.reconnect.failure()
 				select {
 				case errChan <- err:
 				case <-ctx.Done():
 				}
 			} else {
+				if g.pool.logger != nil {
+					g.pool.logger.DebugContext(ctx, "connected to kafka broker", "broker", c.address)
+				}
+				g.reconnect.success()
 				select {
 				case connChan <- c:
 				case <-ctx.Done():
@@ -1157,6 +1374,7 @@ func (g *connGroup) connect(ctx context.Context, addr net.Addr) (*conn, error) {
 			}
 			break
 		}
+		g.pool.count("kafka.transport.dial.errors", address[i], "")
 	}
 
 	if err != nil {
@@ -1169,13 +1387,29 @@ func (g *connGroup) connect(ctx context.Context, addr net.Addr) (*conn, error) {
 		}
 	}()
 
-	if tlsConfig := g.pool.tls; tlsConfig != nil {
+	tlsConfig, err := loadTLSConfig(g.pool.tls, g.pool.tlsFunc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS configuration: %w", err)
+	}
+
+	if tlsConfig != nil {
 		if tlsConfig.ServerName == "" {
-			host, _ := splitHostPort(netAddr.String())
+			serverName := tlsServerName(g.pool.tlsName, netAddr.String())
+			if serverName == "" {
+				serverName, _ = splitHostPort(netAddr.String())
+			}
 			tlsConfig = tlsConfig.Clone()
-			tlsConfig.ServerName = host
+			tlsConfig.ServerName = serverName
+		}
+		// The handshake is done explicitly, rather than on the first write,
+		// to tell TLS errors apart from request errors.
+		tlsConn := tls.Client(netConn, tlsConfig)
+		tlsConn.SetDeadline(deadline)
+		netConn = tlsConn
+		if err := tlsConn.Handshake(); err != nil {
+			g.pool.count("kafka.transport.tls.errors", netAddr.String(), "")
+			return nil, err
 		}
-		netConn = tls.Client(netConn, tlsConfig)
 	}
 
 	pc := protocol.NewConn(netConn, g.pool.clientID)
@@ -1183,6 +1417,7 @@ func (g *connGroup) connect(ctx context.Context, addr net.Addr) (*conn, error) {
 
 	r, err := pc.RoundTrip(new(apiversions.Request))
 	if err != nil {
+		g.pool.count("kafka.transport.request.errors", netAddr.String(), protocol.ApiVersions.String())
 		return nil, err
 	}
 	res := r.(*apiversions.Response)
@@ -1210,17 +1445,22 @@ func (g *connGroup) connect(ctx context.Context, addr net.Addr) (*conn, error) {
 			Port: port,
 		}
 		if err := authenticateSASL(sasl.WithMetadata(ctx, metadata), pc, g.pool.sasl); err != nil {
+			g.pool.count("kafka.transport.sasl.errors", netAddr.String(), "")
 			return nil, err
 		}
 	}
 
+	g.pool.count("kafka.transport.connect.count", netAddr.String(), "")
+
 	reqs := make(chan connRequest)
 	c := &conn{
 		network: netAddr.Network(),
 		address: netAddr.String(),
 		reqs:    reqs,
 		group:   g,
+		stats:   g.pool.stats.broker(netAddr.String()),
 	}
+	c.stats.open()
 	go c.run(pc, reqs)
 
 	netConn = nil
@@ -1234,6 +1474,7 @@ type conn struct {
 	once    sync.Once
 	group   *connGroup
 	timer   *time.Timer
+	stats   *connStats // nil when the pool does not count connections
 }
 
 func (c *conn) close() {
@@ -1241,16 +1482,26 @@ func (c *conn) close() {
 }
 
 func (c *conn) run(pc *protocol.Conn, reqs <-chan connRequest) {
+	defer c.stats.close()
 	defer pc.Close()
 
 	for cr := range reqs {
+		start := time.Now()
 		r, err := c.roundTrip(cr.ctx, pc, cr.req)
 		if err != nil {
+			c.group.pool.count("kafka.transport.request.errors", c.address, cr.req.ApiKey().String())
 			cr.res.reject(err)
 			if !errors.Is(err, protocol.ErrNoRecord) {
+				c.group.breaker.failure(err)
 				break
 			}
 		} else {
+			c.group.breaker.success()
+			// Fetch requests wait for messages to be produced, their duration
+			// does not reflect the latency of the broker.
+			if cr.req.ApiKey() != protocol.Fetch {
+				c.group.observeLatency(time.Since(start))
+			}
 			cr.res.resolve(r)
 		}
 		if !c.group.releaseConn(c) {
@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// reconnectBackoff delays the connections to a broker after failures to
+// connect to it. A nil reconnect backoff is valid and never delays connections.
+type reconnectBackoff struct {
+	min time.Duration
+	max time.Duration
+
+	mutex    sync.Mutex
+	prng     *rand.Rand
+	failures int
+	next     time.Time // time before which connections are delayed
+}
+
+// wait blocks until connections to the broker are allowed, or the context is
+// canceled.
+func (b *reconnectBackoff) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	delay := time.Until(b.next)
+	b.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *reconnectBackoff) success() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures, b.next = 0, time.Time{}
+}
+
+// failure delays the next connections by a random duration between half and
+// all of the exponential backoff, so programs which lost their connections at
+// the same time do not reconnect all at once.
+func (b *reconnectBackoff) failure() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	delay := b.min
+	for i := 0; i < b.failures && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	b.failures++
+
+	if b.prng == nil {
+		b.prng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	delay = delay/2 + time.Duration(b.prng.Int63n(int64(delay/2)+1))
+	b.next = time.Now().Add(delay)
+}
+
+func (p *connPool) newReconnectBackoff() *reconnectBackoff {
+	if p.reconnectBackoffMin <= 0 {
+		return nil
+	}
+	return &reconnectBackoff{
+		min: p.reconnectBackoffMin,
+		max: p.reconnectBackoffMax,
+	}
+}
@@ -0,0 +1,168 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by the transport when a request is not sent
+// because the circuit breaker of the broker it was routed to is open.
+var ErrCircuitOpen = errors.New("kafka: the circuit breaker of the broker is open")
+
+// CircuitBreakerState represents the state of the circuit breaker of a broker,
+// see Transport.CircuitBreakerThreshold.
+type CircuitBreakerState int
+
+const (
+	// CircuitClosed is the state of healthy brokers, requests are sent
+	// normally.
+	CircuitClosed CircuitBreakerState = iota
+	// CircuitHalfOpen is the state of brokers after the cool-down period, a
+	// single request is sent to probe the broker while the others fail fast.
+	CircuitHalfOpen
+	// CircuitOpen is the state of brokers which failed too many times in a
+	// row, requests fail fast with ErrCircuitOpen until the cool-down period
+	// expires.
+	CircuitOpen
+)
+
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker tracks the consecutive failures of a connection group. A nil
+// circuit breaker is valid and never prevents requests from being sent.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	onOpen    func()
+
+	mutex    sync.Mutex
+	state    CircuitBreakerState
+	failures int
+	since    time.Time // when the circuit was opened, or the last probe sent
+}
+
+// allow returns whether a request may be sent, it transitions the breaker to
+// half-open and lets a probe through when the cool-down period has expired.
+// Probes which did not report a result after another cool-down period are
+// assumed lost, and a new probe is let through.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitClosed {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(b.since) < b.cooldown {
+		return false
+	}
+
+	b.state, b.since = CircuitHalfOpen, now
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.state, b.failures = CircuitClosed, 0
+}
+
+func (b *circuitBreaker) failure(err error) {
+	// Requests canceled by the program do not tell anything about the health
+	// of the broker.
+	if b == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	b.mutex.Lock()
+	b.failures++
+
+	opened := false
+	switch {
+	case b.state == CircuitHalfOpen, b.state == CircuitClosed && b.failures >= b.threshold:
+		b.state, b.since = CircuitOpen, time.Now()
+		opened = true
+	}
+	b.mutex.Unlock()
+
+	// The callback is invoked without holding the mutex, so it may inspect
+	// the state of the breaker.
+	if opened && b.onOpen != nil {
+		b.onOpen()
+	}
+}
+
+func (b *circuitBreaker) getState() CircuitBreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+func (p *connPool) newCircuitBreaker(broker string) *circuitBreaker {
+	if p.breakerThreshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold: p.breakerThreshold,
+		cooldown:  p.breakerCooldown,
+		onOpen:    func() { p.count("kafka.transport.circuit.open", broker, "") },
+	}
+}
+
+// CircuitBreakerStates returns the state of the circuit breakers of the
+// brokers that the transport is connected to, indexed by broker address. The
+// method returns nil when CircuitBreakerThreshold is not set.
+func (t *Transport) CircuitBreakerStates() map[string]CircuitBreakerState {
+	if t.CircuitBreakerThreshold <= 0 {
+		return nil
+	}
+
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	states := make(map[string]CircuitBreakerState)
+
+	for _, p := range t.pools {
+		p.mutex.RLock()
+		groups := make([]*connGroup, 0, len(p.conns)+1)
+		groups = append(groups, p.ctrl)
+		for _, g := range p.conns {
+			groups = append(groups, g)
+		}
+		p.mutex.RUnlock()
+
+		for _, g := range groups {
+			// The same broker may be reached by multiple pools, report the
+			// least healthy state.
+			addr, state := g.addr.String(), g.breaker.getState()
+			if state >= states[addr] {
+				states[addr] = state
+			}
+		}
+	}
+
+	return states
+}
@@ -0,0 +1,95 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+)
+
+// BrokerRouting is the policy used by a Transport to select the broker that
+// requests which any broker can serve are sent to, like the Metadata requests
+// refreshing the cached cluster layout or ApiVersions requests.
+type BrokerRouting int8
+
+const (
+	// RouteToBootstrap sends the requests to the address that the transport
+	// was given, which is the historical behavior of the transport.
+	RouteToBootstrap BrokerRouting = iota
+
+	// RouteToRack sends the requests to a broker in the rack configured on the
+	// transport, the one with the lowest latency if there are several. The
+	// bootstrap address is used when no brokers are known to be in the rack.
+	RouteToRack
+
+	// RouteToLowestLatency sends the requests to the broker with the lowest
+	// recent latency. Brokers that have not received requests yet are tried
+	// first, so the latency of each broker is measured.
+	RouteToLowestLatency
+)
+
+// String satisfies the fmt.Stringer interface.
+func (r BrokerRouting) String() string {
+	switch r {
+	case RouteToBootstrap:
+		return "bootstrap"
+	case RouteToRack:
+		return "rack"
+	case RouteToLowestLatency:
+		return "lowest-latency"
+	default:
+		return fmt.Sprintf("BrokerRouting(%d)", int8(r))
+	}
+}
+
+// routeGroup returns the connection group of the broker selected by the
+// routing policy of the pool, or nil if requests must be sent to the bootstrap
+// address.
+func (p *connPool) routeGroup() *connGroup {
+	switch p.routing {
+	case RouteToRack:
+		if p.rackID == "" {
+			return nil
+		}
+	case RouteToLowestLatency:
+	default:
+		return nil
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	var route *connGroup
+	var routeLatency time.Duration
+
+	for _, g := range p.conns {
+		if p.routing == RouteToRack && g.broker.Rack != p.rackID {
+			continue
+		}
+		latency := g.latency()
+		if route == nil || latency < routeLatency || (latency == routeLatency && g.broker.ID < route.broker.ID) {
+			route, routeLatency = g, latency
+		}
+	}
+
+	return route
+}
+
+// observeLatency records the duration of a round trip to the broker, the
+// latency of the group is a moving average of the observed durations.
+func (g *connGroup) observeLatency(d time.Duration) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.avgLatency == 0 {
+		g.avgLatency = d
+	} else {
+		g.avgLatency += (d - g.avgLatency) / 4
+	}
+}
+
+// latency returns the moving average of the round trips to the broker, or zero
+// if none were observed yet.
+func (g *connGroup) latency() time.Duration {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.avgLatency
+}
@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// TransportStats holds the counters of the connections of a transport to a
+// broker, see Transport.Stats.
+//
+// Reused counts the requests sent over connections which were idle in the pool
+// of the transport. A transport which reuses its connections has a number of
+// reused connections growing with the number of requests, while the numbers of
+// connections opened and closed remain low; churn shows as connections opened
+// for most requests.
+type TransportStats struct {
+	Opened int64 // connections established
+	Closed int64 // connections closed
+	Reused int64 // idle connections reused to send requests
+	Open   int64 // connections currently open
+}
+
+// Stats returns the counters of the connections of the transport, indexed by
+// broker address. The counters accumulate from the creation of the transport,
+// they are not reset by CloseIdleConnections.
+func (t *Transport) Stats() map[string]TransportStats {
+	return t.stats.snapshot()
+}
+
+// transportStats holds the connection counters of a transport, it is shared by
+// all its connection pools. A nil value is valid and discards the counters.
+type transportStats struct {
+	mutex   sync.Mutex
+	brokers map[string]*connStats
+}
+
+type connStats struct {
+	opened int64
+	closed int64
+	reused int64
+}
+
+// broker returns the counters of the connections to addr.
+func (s *transportStats) broker(addr string) *connStats {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.brokers == nil {
+		s.brokers = make(map[string]*connStats)
+	}
+	c := s.brokers[addr]
+	if c == nil {
+		c = new(connStats)
+		s.brokers[addr] = c
+	}
+	return c
+}
+
+func (s *transportStats) snapshot() map[string]TransportStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := make(map[string]TransportStats, len(s.brokers))
+
+	for addr, c := range s.brokers {
+		// Load the closed connections first so connections closing
+		// concurrently are never reported as a negative open count.
+		closed := atomic.LoadInt64(&c.closed)
+		opened := atomic.LoadInt64(&c.opened)
+		stats[addr] = TransportStats{
+			Opened: opened,
+			Closed: closed,
+			Reused: atomic.LoadInt64(&c.reused),
+			Open:   opened - closed,
+		}
+	}
+
+	return stats
+}
+
+func (c *connStats) open() {
+	if c != nil {
+		atomic.AddInt64(&c.opened, 1)
+	}
+}
+
+func (c *connStats) close() {
+	if c != nil {
+		atomic.AddInt64(&c.closed, 1)
+	}
+}
+
+func (c *connStats) reuse() {
+	if c != nil {
+		atomic.AddInt64(&c.reused, 1)
+	}
+}
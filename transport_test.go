@@ -4,13 +4,19 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
 	"github.com/segmentio/kafka-go/protocol/createtopics"
 	meta "github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/saslhandshake"
+	"github.com/segmentio/kafka-go/sasl/plain"
 )
 
 func TestIssue477(t *testing.T) {
@@ -304,3 +310,602 @@ func TestIssue806(t *testing.T) {
 		t.Fatalf("expected a meta.Response but got %T", r)
 	}
 }
+
+func TestTransportRetryNotController(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ready := make(chan struct{})
+	close(ready)
+
+	wake := make(chan event)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-wake:
+				e.trigger()
+			}
+		}
+	}()
+
+	tests := []struct {
+		scenario   string
+		controller int32
+	}{
+		{scenario: "the request is sent to the controller", controller: 1},
+		// KRaft brokers report no controller when none is known, the request
+		// can then be sent to any broker which forwards it to the controller.
+		{scenario: "the request is sent to any broker without a controller", controller: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			// The first request is rejected by a broker which is not the
+			// controller, the second one succeeds.
+			requests := make(chan connRequest)
+			go func() {
+				for _, errorCode := range []Error{NotController, 0} {
+					select {
+					case req := <-requests:
+						req.res.resolve(&createtopics.Response{
+							Topics: []createtopics.ResponseTopic{{Name: "topic-A", ErrorCode: int16(errorCode)}},
+						})
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			pool := &connPool{
+				ready: ready,
+				wake:  wake,
+				conns: map[int32]*connGroup{},
+			}
+			pool.setState(connPoolState{
+				layout: protocol.Cluster{
+					Controller: test.controller,
+					Brokers:    map[int32]protocol.Broker{1: {ID: 1}},
+					// The topic is already known so the metadata refresh
+					// following its creation returns immediately.
+					Topics: map[string]protocol.Topic{"topic-A": {Name: "topic-A"}},
+				},
+			})
+
+			// Connections are not returned to the group in this test, it needs
+			// one for each attempt.
+			group := &connGroup{pool: pool, idleConns: []*conn{{reqs: requests}, {reqs: requests}}}
+			if test.controller < 0 {
+				pool.ctrl = group
+			} else {
+				pool.conns[test.controller] = group
+			}
+
+			r, err := pool.roundTrip(ctx, &createtopics.Request{
+				Topics: []createtopics.RequestTopic{{Name: "topic-A", NumPartitions: 1, ReplicationFactor: 1}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code := r.(*createtopics.Response).Topics[0].ErrorCode; code != 0 {
+				t.Errorf("expected the request to succeed after a retry but got %v", Error(code))
+			}
+		})
+	}
+}
+
+func TestTransportSASLHandshakeVersions(t *testing.T) {
+	mechanism := plain.Mechanism{Username: "user", Password: "pass"}
+
+	for _, version := range []int16{0, 1} {
+		version := version
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			errs := make(chan error, 10)
+			transport := &Transport{
+				SASL: mechanism,
+				Dial: func(context.Context, string, string) (net.Conn, error) {
+					client, server := net.Pipe()
+					go func() {
+						defer server.Close()
+						if err := serveSASL(server, version, []byte("\x00user\x00pass")); err != nil {
+							errs <- err
+							return
+						}
+						for {
+							apiVersion, id, _, _, err := protocol.ReadRequest(server)
+							if err != nil {
+								return
+							}
+							protocol.WriteResponse(server, apiVersion, id, &meta.Response{
+								Brokers: []meta.ResponseBroker{{NodeID: 0, Host: "127.0.0.1", Port: 9092}},
+							})
+						}
+					}()
+					return client, nil
+				},
+			}
+			defer transport.CloseIdleConnections()
+
+			if _, err := transport.RoundTrip(ctx, TCP("127.0.0.1:9092"), &meta.Request{}); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case err := <-errs:
+				t.Fatal(err)
+			default:
+			}
+		})
+	}
+}
+
+func TestTransportMetricsHook(t *testing.T) {
+	const address = "127.0.0.1:9092"
+
+	tests := []struct {
+		scenario string
+		metric   string
+		api      string
+		config   func(*Transport)
+		serve    func(net.Conn)
+	}{
+		{
+			scenario: "dial errors",
+			metric:   "kafka.transport.dial.errors",
+			config: func(transport *Transport) {
+				transport.Dial = func(context.Context, string, string) (net.Conn, error) {
+					return nil, errors.New("connection refused")
+				}
+			},
+		},
+		{
+			scenario: "tls handshake errors",
+			metric:   "kafka.transport.tls.errors",
+			config: func(transport *Transport) {
+				transport.TLS = &tls.Config{InsecureSkipVerify: true}
+			},
+			serve: func(server net.Conn) {},
+		},
+		{
+			scenario: "sasl authentication errors",
+			metric:   "kafka.transport.sasl.errors",
+			config: func(transport *Transport) {
+				transport.SASL = plain.Mechanism{Username: "user", Password: "pass"}
+			},
+			serve: func(server net.Conn) {
+				serveApiVersions(server)
+				apiVersion, id, _, _, err := protocol.ReadRequest(server)
+				if err != nil {
+					return
+				}
+				protocol.WriteResponse(server, apiVersion, id, &saslhandshake.Response{
+					ErrorCode: int16(UnsupportedSASLMechanism),
+				})
+			},
+		},
+		{
+			scenario: "request errors",
+			metric:   "kafka.transport.request.errors",
+			api:      "Metadata",
+			serve: func(server net.Conn) {
+				// The connection is closed after the version negotiation,
+				// before responding to the metadata request.
+				serveApiVersions(server)
+				protocol.ReadRequest(server)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			hook := &metricsHookRecorder{
+				counts:   make(map[string]int64),
+				observed: make(map[string]int),
+				labels:   make(map[MetricLabels]bool),
+			}
+
+			transport := &Transport{
+				MetricsHook: hook,
+				Dial: func(context.Context, string, string) (net.Conn, error) {
+					client, server := net.Pipe()
+					go func() {
+						defer server.Close()
+						test.serve(server)
+					}()
+					return client, nil
+				},
+			}
+			if test.config != nil {
+				test.config(transport)
+			}
+			defer transport.CloseIdleConnections()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if _, err := transport.RoundTrip(ctx, TCP(address), &meta.Request{}); err == nil {
+				t.Fatal("expected the request to fail")
+			}
+
+			hook.mutex.Lock()
+			defer hook.mutex.Unlock()
+
+			if hook.counts[test.metric] == 0 {
+				t.Errorf("expected %s to be counted: %v", test.metric, hook.counts)
+			}
+			// Requests are only sent on connections that were established.
+			if test.api != "" && hook.counts["kafka.transport.connect.count"] == 0 {
+				t.Errorf("expected kafka.transport.connect.count to be counted: %v", hook.counts)
+			}
+			if labels := (MetricLabels{Partition: -1, Broker: address, API: test.api}); !hook.labels[labels] {
+				t.Errorf("expected metrics labeled %+v: %+v", labels, hook.labels)
+			}
+		})
+	}
+}
+
+// serveApiVersions answers the version negotiation of a connection, advertising
+// the metadata and SASL APIs.
+func serveApiVersions(server net.Conn) {
+	apiVersion, id, _, _, err := protocol.ReadRequest(server)
+	if err != nil {
+		return
+	}
+	protocol.WriteResponse(server, apiVersion, id, &apiversions.Response{
+		ApiKeys: []apiversions.ApiKeyResponse{
+			{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 1},
+			{ApiKey: int16(protocol.SaslHandshake), MinVersion: 0, MaxVersion: 1},
+			{ApiKey: int16(protocol.SaslAuthenticate), MinVersion: 0, MaxVersion: 0},
+		},
+	})
+}
+
+func TestTransportCircuitBreaker(t *testing.T) {
+	const cooldown = 100 * time.Millisecond
+
+	var healthy, dials int32
+	transport := &Transport{
+		CircuitBreakerThreshold: 2,
+		CircuitBreakerCooldown:  cooldown,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == "broker:9092" {
+				atomic.AddInt32(&dials, 1)
+				if atomic.LoadInt32(&healthy) == 0 {
+					return nil, errors.New("connection refused")
+				}
+			}
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				serveBrokerRequests(server)
+			}()
+			return client, nil
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// CreateTopics requests are routed to the controller, which is the broker
+	// that fails to accept connections.
+	createTopics := func() error {
+		_, err := transport.RoundTrip(ctx, TCP("bootstrap:9092"), &createtopics.Request{})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := createTopics(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the request to fail to connect, got %v", err)
+		}
+	}
+
+	if err := createTopics(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the request to fail fast, got %v", err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("expected 2 connection attempts while the circuit was closed, got %d", n)
+	}
+	if state := transport.CircuitBreakerStates()["broker:9092"]; state != CircuitOpen {
+		t.Errorf("expected the circuit to be open, got %s", state)
+	}
+	if state := transport.CircuitBreakerStates()["bootstrap:9092"]; state != CircuitClosed {
+		t.Errorf("expected the circuit of the bootstrap address to be closed, got %s", state)
+	}
+
+	// A failed probe opens the circuit again.
+	time.Sleep(cooldown)
+	if err := createTopics(); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the probe to fail to connect, got %v", err)
+	}
+	if err := createTopics(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the request to fail fast, got %v", err)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(cooldown)
+
+	if err := createTopics(); err != nil {
+		t.Fatal(err)
+	}
+	if state := transport.CircuitBreakerStates()["broker:9092"]; state != CircuitClosed {
+		t.Errorf("expected the circuit to be closed after a successful probe, got %s", state)
+	}
+}
+
+func TestCircuitBreakerOnOpen(t *testing.T) {
+	var state CircuitBreakerState
+	b := &circuitBreaker{threshold: 1, cooldown: time.Minute}
+	b.onOpen = func() { state = b.getState() }
+
+	// The callback inspects the state of the breaker, which deadlocks if it
+	// is invoked while holding the mutex.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.failure(errors.New("connection refused"))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the circuit breaker deadlocked when invoking its callback")
+	}
+
+	if state != CircuitOpen {
+		t.Errorf("expected the callback to see the open circuit, got %s", state)
+	}
+}
+
+func TestTransportStats(t *testing.T) {
+	transport := &Transport{
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				serveBrokerRequests(server)
+			}()
+			return client, nil
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// CreateTopics requests are routed to the controller, sent sequentially
+	// they all use the same connection.
+	for i := 0; i < 5; i++ {
+		if _, err := transport.RoundTrip(ctx, TCP("bootstrap:9092"), &createtopics.Request{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := transport.Stats()["broker:9092"]
+	if stats != (TransportStats{Opened: 1, Reused: 4, Open: 1}) {
+		t.Errorf("unexpected stats of the connections to the controller: %+v", stats)
+	}
+
+	transport.CloseIdleConnections()
+
+	// Connections are closed asynchronously once their pool was released.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		open := int64(0)
+		for _, s := range transport.Stats() {
+			open += s.Open
+		}
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for the connections to be closed: %+v", transport.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if stats := transport.Stats()["broker:9092"]; stats.Opened != 1 || stats.Closed != 1 {
+		t.Errorf("expected the connection to the controller to be closed: %+v", stats)
+	}
+}
+
+func TestTransportReconnectBackoff(t *testing.T) {
+	const backoffMin = 100 * time.Millisecond
+
+	var mutex sync.Mutex
+	var dials []time.Time
+	var healthy bool
+
+	transport := &Transport{
+		ReconnectBackoffMin: backoffMin,
+		ReconnectBackoffMax: 4 * backoffMin,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == "broker:9092" {
+				mutex.Lock()
+				dials = append(dials, time.Now())
+				ok := healthy
+				mutex.Unlock()
+				if !ok {
+					return nil, errors.New("connection refused")
+				}
+			}
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				serveBrokerRequests(server)
+			}()
+			return client, nil
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	createTopics := func(timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err := transport.RoundTrip(ctx, TCP("bootstrap:9092"), &createtopics.Request{})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := createTopics(5 * time.Second); err == nil {
+			t.Fatal("expected the request to fail to connect")
+		}
+	}
+
+	// Requests do not attempt to connect while the backoff has not expired.
+	if err := createTopics(10 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to wait for the backoff, got %v", err)
+	}
+
+	mutex.Lock()
+	if len(dials) != 3 {
+		t.Fatalf("expected 3 connection attempts, got %d", len(dials))
+	}
+	// The delays are randomized between half and all of the backoff, which
+	// doubles after each failure.
+	for i, min := range []time.Duration{backoffMin / 2, backoffMin} {
+		if delay := dials[i+1].Sub(dials[i]); delay < min {
+			t.Errorf("expected connection attempt %d to be delayed by at least %s, got %s", i+2, min, delay)
+		}
+	}
+	healthy = true
+	mutex.Unlock()
+
+	if err := createTopics(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportBrokerRouting(t *testing.T) {
+	newPool := func(routing BrokerRouting, rackID string) *connPool {
+		p := &connPool{routing: routing, rackID: rackID, conns: make(map[int32]*connGroup)}
+		for _, b := range []struct {
+			id      int
+			rack    string
+			latency time.Duration
+		}{
+			{id: 0, rack: "rack-A", latency: 30 * time.Millisecond},
+			{id: 1, rack: "rack-B", latency: 20 * time.Millisecond},
+			{id: 2, rack: "rack-B", latency: 10 * time.Millisecond},
+			{id: 3, rack: "rack-C", latency: 40 * time.Millisecond},
+		} {
+			g := p.newBrokerConnGroup(Broker{ID: b.id, Rack: b.rack, Host: "localhost", Port: 9092 + b.id})
+			g.observeLatency(b.latency)
+			p.conns[int32(b.id)] = g
+		}
+		return p
+	}
+
+	tests := []struct {
+		routing BrokerRouting
+		rackID  string
+		broker  int // -1 for the bootstrap address
+	}{
+		{routing: RouteToBootstrap, rackID: "rack-A", broker: -1},
+		{routing: RouteToRack, rackID: "rack-A", broker: 0},
+		{routing: RouteToRack, rackID: "rack-B", broker: 2},
+		{routing: RouteToRack, rackID: "rack-D", broker: -1},
+		{routing: RouteToRack, rackID: "", broker: -1},
+		{routing: RouteToLowestLatency, broker: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s/%s", test.routing, test.rackID), func(t *testing.T) {
+			broker := -1
+			if g := newPool(test.routing, test.rackID).routeGroup(); g != nil {
+				broker = g.broker.ID
+			}
+			if broker != test.broker {
+				t.Errorf("expected requests to be routed to broker %d, got %d", test.broker, broker)
+			}
+		})
+	}
+
+	t.Run("brokers without latency are tried first", func(t *testing.T) {
+		p := newPool(RouteToLowestLatency, "")
+		p.conns[4] = p.newBrokerConnGroup(Broker{ID: 4, Host: "localhost", Port: 9096})
+		if g := p.routeGroup(); g == nil || g.broker.ID != 4 {
+			t.Errorf("expected requests to be routed to broker 4, got %+v", g)
+		}
+	})
+}
+
+func TestTransportBrokerRoutingMetadata(t *testing.T) {
+	var dials int32
+	transport := &Transport{
+		BrokerRouting: RouteToLowestLatency,
+		MetadataTTL:   10 * time.Millisecond,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == "broker:9092" {
+				atomic.AddInt32(&dials, 1)
+			}
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				serveBrokerRequests(server)
+			}()
+			return client, nil
+		},
+	}
+	defer transport.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The first metadata request is sent to the bootstrap address, the
+	// following refreshes are routed to the broker that it returned.
+	if _, err := transport.RoundTrip(ctx, TCP("bootstrap:9092"), &meta.Request{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for atomic.LoadInt32(&dials) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("metadata requests were not routed to the broker")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// serveBrokerRequests serves the requests of a single broker cluster with the
+// broker at broker:9092, only the Metadata and CreateTopics APIs are supported.
+func serveBrokerRequests(server net.Conn) {
+	apiVersion, id, _, _, err := protocol.ReadRequest(server)
+	if err != nil {
+		return
+	}
+	protocol.WriteResponse(server, apiVersion, id, &apiversions.Response{
+		ApiKeys: []apiversions.ApiKeyResponse{
+			{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 1},
+			{ApiKey: int16(protocol.CreateTopics), MinVersion: 0, MaxVersion: 0},
+		},
+	})
+
+	for {
+		apiVersion, id, _, req, err := protocol.ReadRequest(server)
+		if err != nil {
+			return
+		}
+
+		var res protocol.Message
+		switch req.(type) {
+		case *meta.Request:
+			res = &meta.Response{
+				Brokers:      []meta.ResponseBroker{{NodeID: 0, Host: "broker", Port: 9092}},
+				ControllerID: 0,
+			}
+		case *createtopics.Request:
+			res = &createtopics.Response{}
+		default:
+			return
+		}
+
+		if err := protocol.WriteResponse(server, apiVersion, id, res); err != nil {
+			return
+		}
+	}
+}
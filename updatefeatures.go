@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/updatefeatures"
+)
+
+// UpdateFeaturesRequest represents a request sent to the controller of a kafka
+// cluster to change the finalized version levels of features, for example to
+// upgrade the metadata.version of a KRaft cluster.
+type UpdateFeaturesRequest struct {
+	// Address of the kafka broker to send the request to.
+	Addr net.Addr
+
+	// List of features to update.
+	Updates []FeatureUpdate
+
+	// When true, the controller only validates the updates without applying
+	// them. Requires version 1 of the UpdateFeatures API.
+	ValidateOnly bool
+}
+
+// FeatureUpdate represents the change of the finalized version level of a
+// feature.
+type FeatureUpdate struct {
+	// Name of the feature to update.
+	Feature string
+
+	// The target version level of the feature. Setting the level to zero
+	// disables the feature, which is a downgrade.
+	MaxVersionLevel int
+
+	// Set to true to allow lowering the version level of the feature. The
+	// controller rejects downgrades which may lose metadata.
+	AllowDowngrade bool
+}
+
+// UpdateFeaturesResponse represents a response from the controller of a kafka
+// cluster to a feature update request.
+type UpdateFeaturesResponse struct {
+	// The amount of time that the broker throttled the request.
+	Throttle time.Duration
+
+	// Set to a non-nil value if the whole request failed.
+	Error error
+
+	// Mapping of feature names to errors that occurred while attempting to
+	// update the features, nil for features that were updated.
+	//
+	// The errors contain the kafka error code and the reason given by the
+	// controller. Programs may use the standard errors.Is function to test
+	// the error against kafka error codes.
+	Errors map[string]error
+}
+
+// UpdateFeatures sends a feature update request to the controller of a kafka
+// cluster and returns the response.
+func (c *Client) UpdateFeatures(ctx context.Context, req *UpdateFeaturesRequest) (*UpdateFeaturesResponse, error) {
+	updates := make([]updatefeatures.RequestFeatureUpdate, len(req.Updates))
+
+	for i, u := range req.Updates {
+		upgradeType := updatefeatures.Upgrade
+		if u.AllowDowngrade {
+			upgradeType = updatefeatures.SafeDowngrade
+		}
+		updates[i] = updatefeatures.RequestFeatureUpdate{
+			Feature:         u.Feature,
+			MaxVersionLevel: int16(u.MaxVersionLevel),
+			AllowDowngrade:  u.AllowDowngrade,
+			UpgradeType:     upgradeType,
+		}
+	}
+
+	m, err := c.roundTrip(ctx, req.Addr, &updatefeatures.Request{
+		TimeoutMs:      c.timeoutMs(ctx, protocol.UpdateFeatures, defaultUpdateFeaturesTimeout),
+		FeatureUpdates: updates,
+		ValidateOnly:   req.ValidateOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).UpdateFeatures: %w", err)
+	}
+
+	res := m.(*updatefeatures.Response)
+	ret := &UpdateFeaturesResponse{
+		Throttle: makeDuration(res.ThrottleTimeMs),
+		Error:    makeError(res.ErrorCode, res.ErrorMessage),
+		Errors:   make(map[string]error, len(res.Results)),
+	}
+
+	for _, r := range res.Results {
+		ret.Errors[r.Feature] = makeError(r.ErrorCode, r.ErrorMessage)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go/protocol/updatefeatures"
+)
+
+func TestClientUpdateFeatures(t *testing.T) {
+	var updates []updatefeatures.RequestFeatureUpdate
+
+	client := &Client{
+		Addr: TCP("localhost:9092"),
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			updates = req.(*updatefeatures.Request).FeatureUpdates
+			return &updatefeatures.Response{
+				Results: []updatefeatures.ResponseUpdateResult{
+					{Feature: "metadata.version"},
+					{Feature: "kraft.version", ErrorCode: int16(InvalidRequest), ErrorMessage: "downgrade not allowed"},
+				},
+			}, nil
+		}),
+	}
+
+	res, err := client.UpdateFeatures(context.Background(), &UpdateFeaturesRequest{
+		Updates: []FeatureUpdate{
+			{Feature: "metadata.version", MaxVersionLevel: 14},
+			{Feature: "kraft.version", MaxVersionLevel: 0, AllowDowngrade: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []updatefeatures.RequestFeatureUpdate{
+		{Feature: "metadata.version", MaxVersionLevel: 14, UpgradeType: updatefeatures.Upgrade},
+		{Feature: "kraft.version", MaxVersionLevel: 0, AllowDowngrade: true, UpgradeType: updatefeatures.SafeDowngrade},
+	}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("unexpected feature updates:\nwant: %+v\ngot:  %+v", want, updates)
+	}
+
+	if res.Error != nil {
+		t.Errorf("unexpected error: %v", res.Error)
+	}
+	if err := res.Errors["metadata.version"]; err != nil {
+		t.Errorf("unexpected error updating metadata.version: %v", err)
+	}
+	if err := res.Errors["kraft.version"]; !errors.Is(err, InvalidRequest) {
+		t.Errorf("expected InvalidRequest updating kraft.version, got %v", err)
+	}
+}
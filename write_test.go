@@ -1,8 +1,10 @@
 package kafka
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"hash/crc32"
 	"testing"
@@ -46,6 +48,69 @@ func TestWriteVarInt(t *testing.T) {
 	}
 }
 
+func TestWriteRecordBatchLengths(t *testing.T) {
+	// Lengths around the sizes where varints grow by one byte, both for
+	// zig-zag encoded values (63/64, 8191/8192, ...) and unsigned values
+	// (127/128, 16383/16384, ...).
+	sizes := []int{0, 1, 63, 64, 127, 128, 8191, 8192, 16383, 16384, 1048575, 1048576, 2097151, 2097152}
+
+	for _, size := range sizes {
+		large := bytes.Repeat([]byte("x"), size)
+
+		tests := []struct {
+			scenario string
+			msg      Message
+		}{
+			{scenario: "key", msg: Message{Key: large, Value: []byte("v")}},
+			{scenario: "value", msg: Message{Key: []byte("k"), Value: large}},
+			{scenario: "null value", msg: Message{Key: large}},
+			{scenario: "header key", msg: Message{Value: []byte("v"), Headers: []Header{{Key: string(large), Value: []byte("h")}}}},
+			{scenario: "header value", msg: Message{Value: []byte("v"), Headers: []Header{{Key: "h", Value: large}}}},
+		}
+
+		for _, test := range tests {
+			test.msg.Time = time.Now()
+
+			batch, err := newRecordBatch(nil, test.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b := &bytes.Buffer{}
+			batch.writeTo(&writeBuffer{w: b})
+
+			// The batch is prefixed with its size, the single record follows
+			// the batch header and its length prefix must account for all the
+			// remaining bytes.
+			buf := b.Bytes()
+			if n := int(batch.size); n != len(buf)-4 {
+				t.Errorf("%s of %d bytes: batch size is %d but %d bytes were written", test.scenario, size, n, len(buf)-4)
+				continue
+			}
+
+			rec := buf[4+recordBatchHeaderSize:]
+			if length, n := binary.Varint(rec); n <= 0 || int(length) != len(rec)-n {
+				t.Errorf("%s of %d bytes: record length prefix is %d but the record has %d bytes", test.scenario, size, length, len(rec)-n)
+				continue
+			}
+
+			msgs, err := newMessageSetReader(bufio.NewReader(bytes.NewReader(buf[4:])), len(buf)-4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &readerHelper{t: t, messageSetReader: msgs}
+			got := r.readMessage()
+
+			if !bytes.Equal(got.Key, test.msg.Key) || !bytes.Equal(got.Value, test.msg.Value) || (test.msg.Value == nil && got.Value != nil) {
+				t.Errorf("%s of %d bytes: the key and value of the message do not match", test.scenario, size)
+			}
+			if len(got.Headers) != len(test.msg.Headers) || (len(got.Headers) != 0 && (got.Headers[0].Key != test.msg.Headers[0].Key || !bytes.Equal(got.Headers[0].Value, test.msg.Headers[0].Value))) {
+				t.Errorf("%s of %d bytes: the headers of the message do not match", test.scenario, size)
+			}
+		}
+	}
+}
+
 func TestWriteOptimizations(t *testing.T) {
 	t.Run("writeFetchRequestV2", testWriteFetchRequestV2)
 	t.Run("writeListOffsetRequestV1", testWriteListOffsetRequestV1)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"sync"
@@ -73,6 +74,16 @@ import (
 //		...
 //	}
 //
+// Messages written to the same partition are appended to it in the order in
+// which they were added to batches, which for a single goroutine is the order
+// of the calls to WriteMessages and of the messages passed to each call. The
+// writer sends at most one produce request at a time to each partition, and
+// retries a failed request before sending the next one, so retries do not
+// reorder messages. The order only holds between messages that were written
+// successfully: a batch which fails after MaxAttempts is reported and the next
+// batches are written, a program writing the failed messages again appends
+// them after those. There is no ordering across partitions.
+//
 // Methods of Writer are safe to use concurrently from multiple goroutines,
 // however the writer configuration should not be modified after first use.
 type Writer struct {
@@ -90,16 +101,51 @@ type Writer struct {
 	// not set Topic, every Message must have Topic specified.
 	Topic string
 
-	// The balancer used to distribute messages across partitions.
+	// The balancer used to distribute messages across partitions. Balancers
+	// which implement MetadataAwareBalancer receive the metadata of the
+	// partitions, like their leaders and errors. The errors of balancers which
+	// implement ErrorBalancer are returned by WriteMessages.
 	//
 	// The default is to use a round-robin distribution.
 	Balancer Balancer
 
+	// Partitions optionally restricts the partitions that the writer produces
+	// to, the Balancer distributes messages across this subset only. Every
+	// partition of the subset must exist in the topics that messages are
+	// written to, WriteMessages returns an error otherwise.
+	//
+	// The default is to use all partitions of the topics.
+	Partitions []int
+
 	// Limit on how many attempts will be made to deliver a message.
 	//
 	// The default is to try at most 10 times.
 	MaxAttempts int
 
+	// Limit on how many attempts will be made to deliver a message when the
+	// brokers report that the partition has fewer in-sync replicas than
+	// required by the min.insync.replicas configuration of the topic, which
+	// usually lasts until the replicas recover. Once the limit is reached, the
+	// write fails with a NotEnoughReplicasError, letting the program decide
+	// whether to retry later.
+	//
+	// The limit only lowers MaxAttempts, which still applies to all errors.
+	//
+	// The default is to use MaxAttempts.
+	MaxReplicaAttempts int
+
+	// RetryClassifier decides whether a produce request which failed with
+	// the error passed as argument is retried, overriding the classification
+	// of errors done by the writer. Errors are retried until MaxAttempts is
+	// reached when the function returns true, and reported to the program
+	// immediately when it returns false.
+	//
+	// The function may be called concurrently from the goroutines writing to
+	// different partitions.
+	//
+	// The default is to retry temporary errors and transient network errors.
+	RetryClassifier func(error) bool
+
 	// Limit on how many messages will be buffered before being sent to a
 	// partition.
 	//
@@ -118,6 +164,56 @@ type Writer struct {
 	// The default is to flush at least every second.
 	BatchTimeout time.Duration
 
+	// Setting a minimum batch timeout lower than BatchTimeout makes the writer
+	// adapt how long it waits for batches to fill to the throughput of each
+	// partition. The timeout is doubled, up to BatchTimeout, when batches fill
+	// before it expires, which happens when many messages are written.
+	// It is halved, down to MinBatchTimeout, when incomplete batches are
+	// flushed, reducing the latency when few messages are written.
+	//
+	// The default is to always use BatchTimeout.
+	MinBatchTimeout time.Duration
+
+	// Limit on the size in bytes of produce requests sent to kafka, which
+	// should match the socket.request.max.bytes setting of the brokers (the
+	// brokers close the connections of clients sending larger requests).
+	//
+	// BatchBytes limits the size of the messages grouped in a batch, but the
+	// produce requests also carry the request headers and the record batch
+	// framing. When the encoded request for a batch would exceed the limit,
+	// the batch is split into multiple produce requests. Compression is not
+	// taken into account, the size of the uncompressed records is used.
+	//
+	// The requests of a split batch are sent sequentially, preserving the
+	// order of messages in the partition. If one of the requests fails, the
+	// following ones are not sent and the whole batch fails, even though the
+	// messages of the previous requests were written to kafka. Messages which
+	// exceed the limit on their own are rejected with a MessageTooLargeError.
+	//
+	// The default is to not limit the size of produce requests.
+	MaxRequestBytes int64
+
+	// Limit on how many bytes of messages may be buffered by the writer while
+	// waiting to be delivered to kafka. When the limit is reached, calls to
+	// WriteMessages block until enough messages have been delivered (or have
+	// failed) to make room for the new messages, or until the context passed
+	// to WriteMessages is canceled.
+	//
+	// This option is mostly useful in asynchronous mode, where it prevents the
+	// memory used by the writer from growing unbounded when the kafka brokers
+	// are unavailable. A single call to WriteMessages carrying more bytes than
+	// the limit is accepted when the buffer is empty.
+	//
+	// The default is to not limit the number of buffered bytes.
+	MaxBufferedBytes int64
+
+	// Limit on how many messages may be buffered by the writer while waiting
+	// to be delivered to kafka. The limit is applied the same way as
+	// MaxBufferedBytes.
+	//
+	// The default is to not limit the number of buffered messages.
+	MaxBufferedMessages int
+
 	// Timeout for read operations performed by the Writer.
 	//
 	// Defaults to 10 seconds.
@@ -128,6 +224,26 @@ type Writer struct {
 	// Defaults to 10 seconds.
 	WriteTimeout time.Duration
 
+	// Time limit on each produce request sent to kafka, like the
+	// request.timeout.ms setting of the Java producer. A request which does
+	// not complete in time fails and is retried, which lets the writer fail
+	// fast on a broker that stopped responding.
+	//
+	// The default is to use WriteTimeout.
+	RequestTimeout time.Duration
+
+	// Time limit on delivering a message, including the time spent waiting
+	// for the batch to be sent, the produce requests and the retries, like
+	// the delivery.timeout.ms setting of the Java producer. Messages which
+	// could not be delivered in time fail with a DeliveryTimeoutError. The
+	// timeout is measured from the creation of the batch the message belongs
+	// to, and the produce requests are shortened to not outlive it.
+	//
+	// The limit only bounds MaxAttempts, which still applies.
+	//
+	// The default is to not limit the time spent delivering messages.
+	DeliveryTimeout time.Duration
+
 	// Number of acknowledges from partition replicas required before receiving
 	// a response to a produce request, the following values are supported:
 	//
@@ -135,9 +251,24 @@ type Writer struct {
 	//  RequireOne  (1)  wait for the leader to acknowledge the writes
 	//  RequireAll  (-1) wait for the full ISR to acknowledge the writes
 	//
+	// With RequireAll, a successful return of WriteMessages means that the
+	// messages were written to all the in-sync replicas of the partitions, and
+	// that there were at least as many of them as configured by the
+	// min.insync.replicas setting of the topic. The brokers reject the writes
+	// with NotEnoughReplicas otherwise, see MaxReplicaAttempts. Note that the
+	// replicas acknowledge the writes once the messages are in memory, not
+	// necessarily flushed to disk.
+	//
 	// Defaults to RequireNone.
 	RequiredAcks RequiredAcks
 
+	// TopicRequiredAcks overrides RequiredAcks for the topics in the map, so a
+	// writer producing to multiple topics can wait for the full ISR on some
+	// of them and only for the leader on others. Topics which are not in the
+	// map use RequiredAcks. The values must be RequireNone, RequireOne, or
+	// RequireAll, WriteMessages returns an error otherwise.
+	TopicRequiredAcks map[string]RequiredAcks
+
 	// Setting this flag to true causes the WriteMessages method to never block.
 	// It also means that errors are ignored since the caller will not receive
 	// the returned value. Use this only if you don't care about guarantees of
@@ -157,6 +288,13 @@ type Writer struct {
 	// referencing the original byte slices carried by messages in the calls to
 	// WriteMessages.
 	//
+	// Batches larger than MaxRequestBytes are written with multiple Produce
+	// requests, the offset of each message is taken from the response to the
+	// request which carried it. The offsets of a batch are not contiguous when
+	// other producers write to the partition in between. When writing fails,
+	// the offsets of the messages which were not acknowledged by kafka are left
+	// unchanged.
+	//
 	// The function is called from goroutines started by the writer. Calls to
 	// Close will block on the Completion function calls. When the Writer is
 	// not writing asynchronously, the WriteMessages call will also block on
@@ -172,28 +310,94 @@ type Writer struct {
 	// Compression set the compression codec to be used to compress messages.
 	Compression Compression
 
+	// CompressionThreshold is the size in bytes below which batches are sent
+	// uncompressed even when Compression is set, which avoids spending CPU on
+	// small payloads that compress poorly.
+	//
+	// Kafka compresses whole record batches, so the decision is made for each
+	// batch from the total size of its messages (measured like BatchBytes),
+	// not for individual messages:
+	// small messages are still compressed when they are batched with enough
+	// other messages.
+	//
+	// Default: 0 (batches are always compressed)
+	CompressionThreshold int
+
+	// The message format version used to encode the messages, either 1, 2, or
+	// MessageVersion0.
+	//
+	// By default, the version is selected from the version of the Produce API
+	// supported by the broker, which is 1 for brokers older than 0.11. The
+	// version can be forced to 1 (or 0) for clusters which were upgraded but
+	// still use the message format of kafka 0.10 (or 0.9), sparing the brokers
+	// the cost of converting the messages. Messages in versions 0 and 1 cannot
+	// carry headers, and are produced with version 2 (or 1) of the Produce
+	// API, which brokers of kafka 4.0 and above do not support.
+	MessageVersion int
+
+	// The type of timestamps set in the attributes of the record batches.
+	// Setting LogAppendTime when writing to topics configured with
+	// message.timestamp.type=LogAppendTime makes the attributes of the records
+	// consistent with the timestamps assigned by the brokers, which tools
+	// reading the records may rely on. The timestamps of the messages are
+	// still sent to the brokers.
+	//
+	// Default: CreateTime
+	TimestampType TimestampType
+
+	// If not nil, receives the metrics of the writer as they are observed.
+	MetricsHook MetricsHook
+
 	// If not nil, specifies a logger used to report internal changes within the
 	// writer.
+	//
+	// Loggers implementing ContextLogger receive the context of the
+	// WriteMessages calls, see ContextLoggerFunc.
 	Logger Logger
 
 	// ErrorLogger is the logger used to report errors. If nil, the writer falls
 	// back to using Logger instead.
 	ErrorLogger Logger
 
+	// If not nil, specifies a logger which receives both the internal changes
+	// and the errors of the writer, with their topic and partition as
+	// attributes. It can be combined with Logger and ErrorLogger.
+	StructuredLogger StructuredLogger
+
 	// A transport used to send messages to kafka clusters.
 	//
 	// If nil, DefaultTransport is used.
+	//
+	// Programs may provide their own implementation of RoundTripper to
+	// intercept the requests of the writer, or to script the responses of a
+	// kafka cluster in tests. The writer sends metadata requests to discover
+	// the partitions of topics and produce requests to write messages (see the
+	// protocol/metadata and protocol/produce packages). Errors returned by the
+	// transport are handled like errors reported by the brokers, for example
+	// NotLeaderForPartition is retried.
 	Transport RoundTripper
 
 	// AllowAutoTopicCreation notifies writer to create topic is missing.
 	AllowAutoTopicCreation bool
 
+	// KeySerializer and ValueSerializer encode the keys and values of the
+	// messages written with WriteTyped. The messages passed to WriteMessages
+	// are written as-is.
+	//
+	// Default: only byte slices and strings are accepted
+	KeySerializer   Serializer
+	ValueSerializer Serializer
+
 	// Manages the current set of partition-topic writers.
 	group   sync.WaitGroup
 	mutex   sync.Mutex
 	closed  bool
 	writers map[topicPartition]*partitionWriter
 
+	// Tracks the messages buffered by the writer, used to apply backpressure
+	// when MaxBufferedBytes or MaxBufferedMessages are set.
+	buffer writerBuffer
+
 	// writer stats are all made of atomic values, no need for synchronization.
 	// Use a pointer to ensure 64-bit alignment of the values. The once value is
 	// used to lazily create the value when first used, allowing programs to use
@@ -317,6 +521,13 @@ type WriterConfig struct {
 	// ErrorLogger is the logger used to report errors. If nil, the writer falls
 	// back to using Logger instead.
 	ErrorLogger Logger
+
+	// If not nil, specifies a logger which receives both the internal changes
+	// and the errors of the writer, with their topic and partition as
+	// attributes. It can be combined with Logger and ErrorLogger.
+	//
+	// The logger receives the context of the WriteMessages calls.
+	StructuredLogger StructuredLogger
 }
 
 type topicPartition struct {
@@ -347,6 +558,14 @@ type WriterStats struct {
 	BatchSize  SummaryStats  `metric:"kafka.writer.batch.size"`
 	BatchBytes SummaryStats  `metric:"kafka.writer.batch.bytes"`
 
+	// Sizes of the record batches sent to kafka, as encoded in produce
+	// requests. The ratio between UncompressedBytes and CompressedBytes gives
+	// the effectiveness of the compression codec configured on the writer, the
+	// two values are equal when no compression is used.
+	UncompressedBytes    int64        `metric:"kafka.writer.batch.uncompressed.bytes" type:"counter"`
+	CompressedBytes      int64        `metric:"kafka.writer.batch.compressed.bytes"   type:"counter"`
+	BatchCompressedBytes SummaryStats `metric:"kafka.writer.batch.compressed.size"`
+
 	MaxAttempts  int64         `metric:"kafka.writer.attempts.max"  type:"gauge"`
 	MaxBatchSize int64         `metric:"kafka.writer.batch.max"     type:"gauge"`
 	BatchTimeout time.Duration `metric:"kafka.writer.batch.timeout" type:"gauge"`
@@ -355,6 +574,11 @@ type WriterStats struct {
 	RequiredAcks int64         `metric:"kafka.writer.acks.required" type:"gauge"`
 	Async        bool          `metric:"kafka.writer.async"         type:"gauge"`
 
+	BufferedBytes       int64 `metric:"kafka.writer.buffer.bytes"        type:"gauge"`
+	BufferedMessages    int64 `metric:"kafka.writer.buffer.messages"     type:"gauge"`
+	MaxBufferedBytes    int64 `metric:"kafka.writer.buffer.bytes.max"    type:"gauge"`
+	MaxBufferedMessages int64 `metric:"kafka.writer.buffer.messages.max" type:"gauge"`
+
 	Topic string `tag:"topic"`
 
 	// DEPRECATED: these fields will only be reported for backward compatibility
@@ -393,6 +617,10 @@ type writerStats struct {
 	retries        summary
 	batchSize      summary
 	batchSizeBytes summary
+
+	uncompressedBytes    counter
+	compressedBytes      counter
+	batchCompressedBytes summary
 }
 
 // NewWriter creates and returns a new Writer configured with config.
@@ -419,37 +647,7 @@ func NewWriter(config WriterConfig) *Writer {
 		kafkaDialer = config.Dialer
 	}
 
-	dialer := (&net.Dialer{
-		Timeout:       kafkaDialer.Timeout,
-		Deadline:      kafkaDialer.Deadline,
-		LocalAddr:     kafkaDialer.LocalAddr,
-		DualStack:     kafkaDialer.DualStack,
-		FallbackDelay: kafkaDialer.FallbackDelay,
-		KeepAlive:     kafkaDialer.KeepAlive,
-	})
-
-	var resolver Resolver
-	if r, ok := kafkaDialer.Resolver.(*net.Resolver); ok {
-		dialer.Resolver = r
-	} else {
-		resolver = kafkaDialer.Resolver
-	}
-
 	stats := new(writerStats)
-	// For backward compatibility with the pre-0.4 APIs, support custom
-	// resolvers by wrapping the dial function.
-	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
-		start := time.Now()
-		defer func() {
-			stats.dials.observe(1)
-			stats.dialTime.observe(int64(time.Since(start)))
-		}()
-		address, err := lookupHost(ctx, addr, resolver)
-		if err != nil {
-			return nil, err
-		}
-		return dialer.DialContext(ctx, network, address)
-	}
 
 	idleTimeout := config.IdleConnTimeout
 	if idleTimeout == 0 {
@@ -465,32 +663,29 @@ func NewWriter(config WriterConfig) *Writer {
 		metadataTTL = 15 * time.Second
 	}
 
-	transport := &Transport{
-		Dial:        dial,
-		SASL:        kafkaDialer.SASLMechanism,
-		TLS:         kafkaDialer.TLS,
-		ClientID:    kafkaDialer.ClientID,
-		IdleTimeout: idleTimeout,
-		MetadataTTL: metadataTTL,
-	}
+	transport := kafkaDialer.transport(idleTimeout, metadataTTL, func(dialTime time.Duration) {
+		stats.dials.observe(1)
+		stats.dialTime.observe(int64(dialTime))
+	})
 
 	w := &Writer{
-		Addr:         TCP(config.Brokers...),
-		Topic:        config.Topic,
-		MaxAttempts:  config.MaxAttempts,
-		BatchSize:    config.BatchSize,
-		Balancer:     config.Balancer,
-		BatchBytes:   int64(config.BatchBytes),
-		BatchTimeout: config.BatchTimeout,
-		ReadTimeout:  config.ReadTimeout,
-		WriteTimeout: config.WriteTimeout,
-		RequiredAcks: RequiredAcks(config.RequiredAcks),
-		Async:        config.Async,
-		Logger:       config.Logger,
-		ErrorLogger:  config.ErrorLogger,
-		Transport:    transport,
-		transport:    transport,
-		writerStats:  stats,
+		Addr:             TCP(config.Brokers...),
+		Topic:            config.Topic,
+		MaxAttempts:      config.MaxAttempts,
+		BatchSize:        config.BatchSize,
+		Balancer:         config.Balancer,
+		BatchBytes:       int64(config.BatchBytes),
+		BatchTimeout:     config.BatchTimeout,
+		ReadTimeout:      config.ReadTimeout,
+		WriteTimeout:     config.WriteTimeout,
+		RequiredAcks:     RequiredAcks(config.RequiredAcks),
+		Async:            config.Async,
+		Logger:           config.Logger,
+		ErrorLogger:      config.ErrorLogger,
+		StructuredLogger: config.StructuredLogger,
+		Transport:        transport,
+		transport:        transport,
+		writerStats:      stats,
 	}
 
 	if config.RequiredAcks == 0 {
@@ -567,6 +762,51 @@ func (w *Writer) Close() error {
 	return nil
 }
 
+// WriteTyped serializes the keys and values of msgs with the KeySerializer and
+// ValueSerializer of the writer, then writes the messages like WriteMessages.
+//
+// The method returns an error without writing any of the messages if one of
+// them cannot be serialized.
+func (w *Writer) WriteTyped(ctx context.Context, msgs ...TypedMessage) error {
+	keySerializer := w.keySerializer()
+	valueSerializer := w.valueSerializer()
+	messages := make([]Message, len(msgs))
+
+	for i, msg := range msgs {
+		topic := msg.Topic
+		if topic == "" {
+			topic = w.Topic
+		}
+
+		key, err := serialize(keySerializer, topic, msg.Key)
+		if err != nil {
+			return fmt.Errorf("kafka.(*Writer).WriteTyped: serializing the key of message at index %d: %w", i, err)
+		}
+
+		value, err := serialize(valueSerializer, topic, msg.Value)
+		if err != nil {
+			return fmt.Errorf("kafka.(*Writer).WriteTyped: serializing the value of message at index %d: %w", i, err)
+		}
+
+		messages[i] = Message{
+			Topic:   msg.Topic,
+			Key:     key,
+			Value:   value,
+			Headers: msg.Headers,
+			Time:    msg.Time,
+		}
+	}
+
+	return w.WriteMessages(ctx, messages...)
+}
+
+func serialize(s Serializer, topic string, v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return s.Serialize(topic, v)
+}
+
 // WriteMessages writes a batch of messages to the kafka topic configured on this
 // writer.
 //
@@ -583,6 +823,11 @@ func (w *Writer) Close() error {
 // best way to achieve good batching behavior is to share one Writer amongst
 // multiple go routines.
 //
+// When the writer is configured with MaxBufferedBytes or MaxBufferedMessages,
+// the method blocks until the buffer has enough room to accept the messages,
+// including in asynchronous mode. If the context is canceled while waiting,
+// the messages are not written and the context error is returned.
+//
 // When the method returns an error, it may be of type kafka.WriteError to allow
 // the caller to determine the status of each message.
 //
@@ -592,17 +837,126 @@ func (w *Writer) Close() error {
 // whole batch failed and re-write the messages later (which could then cause
 // duplicates).
 func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error {
+	return w.writeMessages(ctx, "kafka.(*Writer).WriteMessages", msgs, nil)
+}
+
+// WriteMessagesResult writes messages like WriteMessages, and returns copies of
+// the messages with the Topic, Partition and Offset fields set to where they
+// were written, which lets programs read the messages they wrote. The Time
+// field is set to the append time of messages which had none, when the topic
+// uses log append times.
+//
+// The messages are returned in the order they were passed to the method. When
+// the method returns an error, the messages that could not be written are left
+// unchanged, the error is of type kafka.WriteErrors when it was returned by the
+// brokers.
+//
+// The offsets are only known once the brokers acknowledged the messages, the
+// method returns an error when the writer is configured to write messages
+// asynchronously, or with RequireNone.
+func (w *Writer) WriteMessagesResult(ctx context.Context, msgs ...Message) ([]Message, error) {
+	if w.Async {
+		return nil, errors.New("kafka.(*Writer).WriteMessagesResult: the offsets of messages are not available when writing asynchronously")
+	}
+	for _, msg := range msgs {
+		topic, err := w.chooseTopic(msg)
+		if err != nil {
+			break // reported by WriteMessages
+		}
+		if w.requiredAcks(topic) == RequireNone {
+			return nil, fmt.Errorf("kafka.(*Writer).WriteMessagesResult: the offsets of messages are not available when the writer does not require acknowledgements for topic %s", topic)
+		}
+	}
+	results := make([]Message, len(msgs))
+	copy(results, msgs)
+	err := w.writeMessages(ctx, "kafka.(*Writer).WriteMessagesResult", msgs, results)
+	return results, err
+}
+
+// WriteMessagesAsync writes messages like WriteMessages, but returns as soon as
+// the messages were added to the batches of the writer, without waiting for
+// them to be delivered, even when the writer is not configured to write
+// asynchronously. The returned future may be used to wait for the results of
+// the call, or be discarded by programs which do not need them.
+//
+// The method still blocks when the writer has to look up the partitions of the
+// topics, or when MaxBufferedMessages or MaxBufferedBytes are reached. Errors
+// detected before the messages were batched, like a message exceeding the
+// maximum size, are returned immediately. The Completion function is called
+// for the batches of the messages as usual.
+func (w *Writer) WriteMessagesAsync(ctx context.Context, msgs ...Message) (*WriteFuture, error) {
+	batches, err := w.batchWrite(ctx, "kafka.(*Writer).WriteMessagesAsync", msgs, true)
+	if err != nil {
+		return nil, err
+	}
+	f := &WriteFuture{
+		msgs:    make([]Message, len(msgs)),
+		batches: batches,
+	}
+	copy(f.msgs, msgs)
+	return f, nil
+}
+
+// WriteFuture represents the pending result of a call to
+// Writer.WriteMessagesAsync.
+type WriteFuture struct {
+	msgs    []Message
+	batches map[*writeBatch]batchIndexes
+}
+
+// Wait blocks until all the messages of the call were delivered or failed to be
+// delivered, or the context is canceled, in which case the messages may still
+// be delivered later and Wait may be called again.
+//
+// The messages are returned in the order they were passed to
+// WriteMessagesAsync, with the Topic, Partition and Offset fields set to where
+// they were written like in WriteMessagesResult, the offsets are left unset
+// when the writer does not require acknowledgements. When delivering messages
+// failed, the error is of type kafka.WriteErrors.
+func (f *WriteFuture) Wait(ctx context.Context) ([]Message, error) {
+	results := make([]Message, len(f.msgs))
+	copy(results, f.msgs)
+	err := awaitBatches(ctx, f.msgs, f.batches, results)
+	return results, err
+}
+
+// writeMessages writes msgs, the written messages are copied to results when it
+// is not nil.
+func (w *Writer) writeMessages(ctx context.Context, op string, msgs []Message, results []Message) error {
+	batches, err := w.batchWrite(ctx, op, msgs, !w.Async)
+	if err != nil || w.Async {
+		return err
+	}
+	return awaitBatches(ctx, msgs, batches, results)
+}
+
+// batchWrite adds msgs to the batches of the partition writers, the batches
+// that the messages were added to are returned when track is true. The errors
+// are prefixed with op, the name of the method called by the program.
+func (w *Writer) batchWrite(ctx context.Context, op string, msgs []Message, track bool) (map[*writeBatch]batchIndexes, error) {
 	if w.Addr == nil {
-		return errors.New("kafka.(*Writer).WriteMessages: cannot create a kafka writer with a nil address")
+		return nil, fmt.Errorf("%s: cannot create a kafka writer with a nil address", op)
+	}
+
+	switch w.MessageVersion {
+	case 0, 1, 2, MessageVersion0:
+	default:
+		return nil, fmt.Errorf("%s: unsupported message version %d, must be 1, 2, or MessageVersion0", op, w.MessageVersion)
+	}
+
+	for topic, acks := range w.TopicRequiredAcks {
+		if !validRequiredAcks(acks) {
+			return nil, fmt.Errorf("%s: invalid required acks %d for topic %s, must be -1, 0, or 1", op, acks, topic)
+		}
 	}
 
 	if !w.enter() {
-		return io.ErrClosedPipe
+		return nil, io.ErrClosedPipe
 	}
 	defer w.leave()
 
 	if len(msgs) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	balancer := w.balancer()
@@ -616,7 +970,10 @@ func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error {
 			// are that the program will check if WriteMessages returned a
 			// MessageTooLargeError, discard the message that was exceeding
 			// the maximum size, and try again.
-			return messageTooLarge(msgs, i)
+			return nil, messageTooLarge(msgs, i)
+		}
+		if (w.MessageVersion == 1 || w.MessageVersion == MessageVersion0) && len(msgs[i].Headers) != 0 {
+			return nil, fmt.Errorf("%s: message at index %d has headers, which cannot be encoded in message versions 0 and 1", op, i)
 		}
 	}
 
@@ -630,15 +987,17 @@ func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error {
 	for i, msg := range msgs {
 		topic, err := w.chooseTopic(msg)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		numPartitions, err := w.partitions(ctx, topic)
-		if err != nil {
-			return err
+		if w.MaxRequestBytes > 0 && w.produceRequestSize(topic, msgs[i:i+1]) > w.MaxRequestBytes {
+			return nil, messageTooLarge(msgs, i)
 		}
 
-		partition := balancer.Balance(msg, loadCachedPartitions(numPartitions)...)
+		partition, err := w.choosePartition(ctx, op, balancer, topic, msg)
+		if err != nil {
+			return nil, err
+		}
 
 		key := topicPartition{
 			topic:     topic,
@@ -648,11 +1007,16 @@ func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error {
 		assignments[key] = append(assignments[key], int32(i))
 	}
 
-	batches := w.batchMessages(msgs, assignments)
-	if w.Async {
-		return nil
+	if err := w.buffer.acquire(ctx, msgs, w.MaxBufferedMessages, w.MaxBufferedBytes); err != nil {
+		return nil, err
 	}
 
+	return w.batchMessages(ctx, msgs, assignments, track), nil
+}
+
+// awaitBatches waits for the batches that msgs were added to, the written
+// messages are copied to results when it is not nil.
+func awaitBatches(ctx context.Context, msgs []Message, batches map[*writeBatch]batchIndexes, results []Message) error {
 	done := ctx.Done()
 	hasErrors := false
 	for batch := range batches {
@@ -662,6 +1026,11 @@ func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error {
 		case <-batch.done:
 			if batch.err != nil {
 				hasErrors = true
+			} else if results != nil {
+				b := batches[batch]
+				for j, i := range b.indexes {
+					results[i] = batch.msgs[b.first+j]
+				}
 			}
 		}
 	}
@@ -672,18 +1041,79 @@ func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error {
 
 	werr := make(WriteErrors, len(msgs))
 
-	for batch, indexes := range batches {
-		for _, i := range indexes {
+	for batch, b := range batches {
+		for _, i := range b.indexes {
 			werr[i] = batch.err
 		}
 	}
 	return werr
 }
 
-func (w *Writer) batchMessages(messages []Message, assignments map[topicPartition][]int32) map[*writeBatch][]int32 {
-	var batches map[*writeBatch][]int32
-	if !w.Async {
-		batches = make(map[*writeBatch][]int32, len(assignments))
+// Partition returns the partition that the writer would assign msg to if it
+// was written to topic. If topic is empty, the topic is chosen like in
+// WriteMessages, from the Topic field of the writer or of the message.
+//
+// The partition is chosen by the writer's balancer from the current partitions
+// of the topic, as it would be during a call to WriteMessages, but the message
+// is not written. Note that the balancers which do not derive the partition
+// from the message alone, like RoundRobin or LeastBytes, update their state
+// when called, so the next message written may not be assigned to the same
+// partition.
+func (w *Writer) Partition(topic string, msg Message) (int, error) {
+	if w.Addr == nil {
+		return 0, errors.New("kafka.(*Writer).Partition: cannot create a kafka writer with a nil address")
+	}
+
+	if topic == "" {
+		t, err := w.chooseTopic(msg)
+		if err != nil {
+			return 0, err
+		}
+		topic = t
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.readTimeout())
+	defer cancel()
+
+	return w.choosePartition(ctx, "kafka.(*Writer).Partition", w.balancer(), topic, msg)
+}
+
+// choosePartition runs balancer on the partitions of topic that msg may be
+// written to, the errors are prefixed with op.
+func (w *Writer) choosePartition(ctx context.Context, op string, balancer Balancer, topic string, msg Message) (int, error) {
+	res, t, err := w.topicMetadata(ctx, topic)
+	if err != nil {
+		return 0, err
+	}
+
+	partitions, err := w.balancedPartitions(op, topic, len(t.Partitions))
+	if err != nil {
+		return 0, err
+	}
+
+	var partition int
+	switch b := balancer.(type) {
+	case MetadataAwareBalancer:
+		partition = b.BalancePartitions(msg, partitionsMetadata(res, t, partitions)...)
+	case ErrorBalancer:
+		if partition, err = b.BalanceErr(msg, partitions...); err != nil {
+			return 0, fmt.Errorf("%s: balancer failed to choose a partition of topic %s: %w", op, topic, err)
+		}
+	default:
+		partition = balancer.Balance(msg, partitions...)
+	}
+
+	if len(w.Partitions) != 0 && !containsPartition(w.Partitions, partition) {
+		return 0, fmt.Errorf("%s: balancer chose partition %d of topic %s which is not one of the writer's partitions %v", op, partition, topic, w.Partitions)
+	}
+
+	return partition, nil
+}
+
+func (w *Writer) batchMessages(ctx context.Context, messages []Message, assignments map[topicPartition][]int32, track bool) map[*writeBatch]batchIndexes {
+	var batches map[*writeBatch]batchIndexes
+	if track {
+		batches = make(map[*writeBatch]batchIndexes, len(assignments))
 	}
 
 	w.mutex.Lock()
@@ -699,7 +1129,7 @@ func (w *Writer) batchMessages(messages []Message, assignments map[topicPartitio
 			writer = newPartitionWriter(w, key)
 			w.writers[key] = writer
 		}
-		wbatches := writer.writeMessages(messages, indexes)
+		wbatches := writer.writeMessages(ctx, messages, indexes, track)
 
 		for batch, idxs := range wbatches {
 			batches[batch] = idxs
@@ -709,24 +1139,92 @@ func (w *Writer) batchMessages(messages []Message, assignments map[topicPartitio
 	return batches
 }
 
-func (w *Writer) produce(key topicPartition, batch *writeBatch) (*ProduceResponse, error) {
-	timeout := w.writeTimeout()
-
+func (w *Writer) produce(key topicPartition, records *writerRecords, timeout time.Duration) (*ProduceResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	return w.client(timeout).Produce(ctx, &ProduceRequest{
-		Partition:    int(key.partition),
-		Topic:        key.topic,
-		RequiredAcks: w.RequiredAcks,
-		Compression:  w.Compression,
-		Records: &writerRecords{
-			msgs: batch.msgs,
-		},
+		Partition:      int(key.partition),
+		Topic:          key.topic,
+		RequiredAcks:   w.requiredAcks(key.topic),
+		Compression:    w.compression(records.msgs),
+		MessageVersion: w.MessageVersion,
+		TimestampType:  w.TimestampType,
+		Records:        records,
 	})
 }
 
-func (w *Writer) partitions(ctx context.Context, topic string) (int, error) {
+// compression returns the compression codec of the record batch carrying msgs,
+// which is left uncompressed when it is smaller than CompressionThreshold.
+func (w *Writer) compression(msgs []Message) Compression {
+	if w.CompressionThreshold > 0 {
+		size := int64(0)
+		for i := range msgs {
+			size += int64(msgs[i].size())
+		}
+		if size < int64(w.CompressionThreshold) {
+			return 0
+		}
+	}
+	return w.Compression
+}
+
+// produceRequestOverhead is the size of a produce request carrying a single
+// record batch, excluding the client id, the topic name, and the records:
+//
+//	size, api key, api version, correlation id, client id length: 4+2+2+4+2
+//	transactional id, acks, timeout, topics length, topic length:  2+2+4+4+2
+//	partitions length, partition, record set size:                4+4+4
+//	record batch header:                                          61
+const produceRequestOverhead = 14 + 14 + 12 + 61
+
+// produceRequestSize returns an upper bound of the size of the produce request
+// writing msgs to topic.
+func (w *Writer) produceRequestSize(topic string, msgs []Message) int64 {
+	size := int64(produceRequestOverhead + len(w.clientID()) + len(topic))
+	for i := range msgs {
+		size += msgs[i].recordSize()
+	}
+	return size
+}
+
+// splitRequests splits msgs into sequences of messages which can each be
+// written to topic with a produce request no larger than MaxRequestBytes.
+func (w *Writer) splitRequests(topic string, msgs []Message) [][]Message {
+	if w.MaxRequestBytes <= 0 {
+		return [][]Message{msgs}
+	}
+
+	var requests [][]Message
+	overhead := w.produceRequestSize(topic, nil)
+	size, start := overhead, 0
+
+	for i := range msgs {
+		n := msgs[i].recordSize()
+		if i > start && size+n > w.MaxRequestBytes {
+			requests = append(requests, msgs[start:i:i])
+			size, start = overhead, i
+		}
+		size += n
+	}
+
+	return append(requests, msgs[start:])
+}
+
+func (w *Writer) clientID() string {
+	transport := w.Transport
+	if transport == nil {
+		transport = DefaultTransport
+	}
+	if t, ok := transport.(*Transport); ok {
+		return t.ClientID
+	}
+	return ""
+}
+
+// topicMetadata returns the metadata response of the cluster and the metadata
+// of topic within it.
+func (w *Writer) topicMetadata(ctx context.Context, topic string) (*metadataAPI.Response, *metadataAPI.ResponseTopic, error) {
 	client := w.client(w.readTimeout())
 	// Here we use the transport directly as an optimization to avoid the
 	// construction of temporary request and response objects made by the
@@ -739,18 +1237,68 @@ func (w *Writer) partitions(ctx context.Context, topic string) (int, error) {
 		AllowAutoTopicCreation: w.AllowAutoTopicCreation,
 	})
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
-	for _, t := range r.(*metadataAPI.Response).Topics {
-		if t.Name == topic {
+	res := r.(*metadataAPI.Response)
+	for i := range res.Topics {
+		if t := &res.Topics[i]; t.Name == topic {
 			// This should always hit, unless kafka has a bug.
 			if t.ErrorCode != 0 {
-				return 0, Error(t.ErrorCode)
+				return nil, nil, Error(t.ErrorCode)
 			}
-			return len(t.Partitions), nil
+			return res, t, nil
 		}
 	}
-	return 0, UnknownTopicOrPartition
+	return nil, nil, UnknownTopicOrPartition
+}
+
+// partitionsMetadata returns the metadata of the partitions of t, in the order
+// of the partition IDs.
+func partitionsMetadata(res *metadataAPI.Response, t *metadataAPI.ResponseTopic, partitions []int) []Partition {
+	brokers := make(map[int32]Broker, len(res.Brokers))
+	for _, b := range res.Brokers {
+		brokers[b.NodeID] = Broker{
+			Host: b.Host,
+			Port: int(b.Port),
+			ID:   int(b.NodeID),
+			Rack: b.Rack,
+		}
+	}
+
+	metadata := make([]Partition, len(partitions))
+	for i, id := range partitions {
+		metadata[i] = Partition{Topic: t.Name, ID: id, Leader: Broker{ID: -1}}
+		for _, p := range t.Partitions {
+			if int(p.PartitionIndex) == id {
+				metadata[i] = makeMetadataPartition(brokers, t.Name, p)
+				break
+			}
+		}
+	}
+	return metadata
+}
+
+// balancedPartitions returns the partitions of topic that messages may be
+// written to, which is the subset configured on the writer if any.
+func (w *Writer) balancedPartitions(op, topic string, numPartitions int) ([]int, error) {
+	if len(w.Partitions) == 0 {
+		return loadCachedPartitions(numPartitions), nil
+	}
+	for _, p := range w.Partitions {
+		if p < 0 || p >= numPartitions {
+			return nil, fmt.Errorf("%s: partition %d is out of range for topic %s which has %d partitions: %w", op, p, topic, numPartitions, UnknownTopicOrPartition)
+		}
+	}
+	return w.Partitions, nil
+}
+
+func containsPartition(partitions []int, partition int) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
 }
 
 func (w *Writer) client(timeout time.Duration) *Client {
@@ -768,6 +1316,29 @@ func (w *Writer) balancer() Balancer {
 	return &w.roundRobin
 }
 
+// requiredAcks returns the number of acknowledgements required by the produce
+// requests sent to topic.
+func (w *Writer) requiredAcks(topic string) RequiredAcks {
+	if acks, ok := w.TopicRequiredAcks[topic]; ok {
+		return acks
+	}
+	return w.RequiredAcks
+}
+
+func (w *Writer) keySerializer() Serializer {
+	if w.KeySerializer != nil {
+		return w.KeySerializer
+	}
+	return rawSerializer{}
+}
+
+func (w *Writer) valueSerializer() Serializer {
+	if w.ValueSerializer != nil {
+		return w.ValueSerializer
+	}
+	return rawSerializer{}
+}
+
 func (w *Writer) maxAttempts() int {
 	if w.MaxAttempts > 0 {
 		return w.MaxAttempts
@@ -779,6 +1350,22 @@ func (w *Writer) maxAttempts() int {
 	return 10
 }
 
+func (w *Writer) maxReplicaAttempts() int {
+	if w.MaxReplicaAttempts > 0 {
+		return w.MaxReplicaAttempts
+	}
+	return w.maxAttempts()
+}
+
+// retriable reports whether a produce request which failed with err should be
+// retried.
+func (w *Writer) retriable(err error) bool {
+	if w.RetryClassifier != nil {
+		return w.RetryClassifier(err)
+	}
+	return isTemporary(err) || isTransientNetworkError(err)
+}
+
 func (w *Writer) batchSize() int {
 	if w.BatchSize > 0 {
 		return w.BatchSize
@@ -814,18 +1401,43 @@ func (w *Writer) writeTimeout() time.Duration {
 	return 10 * time.Second
 }
 
-func (w *Writer) withLogger(do func(Logger)) {
-	if w.Logger != nil {
-		do(w.Logger)
+func (w *Writer) requestTimeout() time.Duration {
+	if w.RequestTimeout > 0 {
+		return w.RequestTimeout
 	}
+	return w.writeTimeout()
 }
 
-func (w *Writer) withErrorLogger(do func(Logger)) {
-	if w.ErrorLogger != nil {
-		do(w.ErrorLogger)
-	} else {
-		w.withLogger(do)
+// deliveryDeadline returns the time by which the messages of a batch created
+// at the given time must be delivered, or the zero time if there is no limit.
+func (w *Writer) deliveryDeadline(created time.Time) time.Time {
+	if w.DeliveryTimeout > 0 {
+		return created.Add(w.DeliveryTimeout)
 	}
+	return time.Time{}
+}
+
+func (w *Writer) log() logger {
+	return logger{
+		logger:      w.Logger,
+		errorLogger: w.ErrorLogger,
+		structured:  w.StructuredLogger,
+	}
+}
+
+func (w *Writer) count(name string, c *counter, v int64, labels MetricLabels) {
+	c.observe(v)
+	countMetric(w.MetricsHook, name, v, labels)
+}
+
+func (w *Writer) observe(name string, m *summary, v int64, labels MetricLabels) {
+	m.observe(v)
+	observeMetric(w.MetricsHook, name, v, labels)
+}
+
+func (w *Writer) observeDuration(name string, m *summary, v time.Duration, labels MetricLabels) {
+	m.observeDuration(v)
+	observeDurationMetric(w.MetricsHook, name, v, labels)
 }
 
 func (w *Writer) stats() *writerStats {
@@ -848,6 +1460,7 @@ func (w *Writer) stats() *writerStats {
 // system.
 func (w *Writer) Stats() WriterStats {
 	stats := w.stats()
+	bufferedMessages, bufferedBytes := w.buffer.usage()
 	return WriterStats{
 		Dials:        stats.dials.snapshot(),
 		Writes:       stats.writes.snapshot(),
@@ -869,6 +1482,15 @@ func (w *Writer) Stats() WriterStats {
 		RequiredAcks: int64(w.RequiredAcks),
 		Async:        w.Async,
 		Topic:        w.Topic,
+
+		BufferedBytes:       bufferedBytes,
+		BufferedMessages:    bufferedMessages,
+		MaxBufferedBytes:    w.MaxBufferedBytes,
+		MaxBufferedMessages: int64(w.MaxBufferedMessages),
+
+		UncompressedBytes:    stats.uncompressedBytes.snapshot(),
+		CompressedBytes:      stats.compressedBytes.snapshot(),
+		BatchCompressedBytes: stats.batchCompressedBytes.snapshot(),
 	}
 }
 
@@ -953,13 +1575,15 @@ func newBatchQueue(initialSize int) batchQueue {
 }
 
 // partitionWriter is a writer for a topic-partion pair. It maintains messaging order
-// across batches of messages.
+// across batches of messages: batches are written one at a time by a single
+// goroutine, and retries complete before the next batch is written.
 type partitionWriter struct {
 	meta  topicPartition
 	queue batchQueue
 
 	mutex     sync.Mutex
 	currBatch *writeBatch
+	linger    time.Duration // adaptive batch timeout, see Writer.MinBatchTimeout
 
 	// reference to the writer that owns this batch. Used for the produce logic
 	// as well as stat tracking
@@ -976,6 +1600,10 @@ func newPartitionWriter(w *Writer, key topicPartition) *partitionWriter {
 	return writer
 }
 
+func (ptw *partitionWriter) metricLabels() MetricLabels {
+	return MetricLabels{Topic: ptw.meta.topic, Partition: int(ptw.meta.partition)}
+}
+
 func (ptw *partitionWriter) writeBatches() {
 	for {
 		batch := ptw.queue.Get()
@@ -991,18 +1619,27 @@ func (ptw *partitionWriter) writeBatches() {
 	}
 }
 
-func (ptw *partitionWriter) writeMessages(msgs []Message, indexes []int32) map[*writeBatch][]int32 {
+// batchIndexes are the indexes of the messages of a WriteMessages call that were
+// added to a batch. Since the messages are added while holding the mutex of the
+// partition writer, they are contiguous in the batch, starting at first.
+type batchIndexes struct {
+	first   int
+	indexes []int32
+}
+
+func (ptw *partitionWriter) writeMessages(ctx context.Context, msgs []Message, indexes []int32, track bool) map[*writeBatch]batchIndexes {
 	ptw.mutex.Lock()
 	defer ptw.mutex.Unlock()
 
 	batchSize := ptw.w.batchSize()
 	batchBytes := ptw.w.batchBytes()
 
-	var batches map[*writeBatch][]int32
-	if !ptw.w.Async {
-		batches = make(map[*writeBatch][]int32, 1)
+	var batches map[*writeBatch]batchIndexes
+	if track {
+		batches = make(map[*writeBatch]batchIndexes, 1)
 	}
 
+	var last *writeBatch
 	for _, i := range indexes {
 	assignMessage:
 		batch := ptw.currBatch
@@ -1011,20 +1648,31 @@ func (ptw *partitionWriter) writeMessages(msgs []Message, indexes []int32) map[*
 			ptw.currBatch = batch
 		}
 		if !batch.add(msgs[i], batchSize, batchBytes) {
+			ptw.adaptBatchTimeout(true)
 			batch.trigger()
 			ptw.queue.Put(batch)
 			ptw.currBatch = nil
 			goto assignMessage
 		}
+		if batch != last {
+			batch.calls = append(batch.calls, batchCall{ctx: ctx, first: len(batch.msgs) - 1})
+			last = batch
+		}
 
 		if batch.full(batchSize, batchBytes) {
+			ptw.adaptBatchTimeout(true)
 			batch.trigger()
 			ptw.queue.Put(batch)
 			ptw.currBatch = nil
 		}
 
-		if !ptw.w.Async {
-			batches[batch] = append(batches[batch], i)
+		if track {
+			b, ok := batches[batch]
+			if !ok {
+				b.first = len(batch.msgs) - 1
+			}
+			b.indexes = append(b.indexes, i)
+			batches[batch] = b
 		}
 	}
 	return batches
@@ -1032,7 +1680,7 @@ func (ptw *partitionWriter) writeMessages(msgs []Message, indexes []int32) map[*
 
 // ptw.w can be accessed here because this is called with the lock ptw.mutex already held.
 func (ptw *partitionWriter) newWriteBatch() *writeBatch {
-	batch := newWriteBatch(time.Now(), ptw.w.batchTimeout())
+	batch := newWriteBatch(time.Now(), ptw.batchTimeout())
 	ptw.w.spawn(func() { ptw.awaitBatch(batch) })
 	return batch
 }
@@ -1052,6 +1700,7 @@ func (ptw *partitionWriter) awaitBatch(batch *writeBatch) {
 		// pw.currBatch != batch so we just move on.
 		// Otherwise, we detach the batch from the ptWriter and enqueue it for writing.
 		if ptw.currBatch == batch {
+			ptw.adaptBatchTimeout(false)
 			ptw.queue.Put(batch)
 			ptw.currBatch = nil
 		}
@@ -1064,18 +1713,103 @@ func (ptw *partitionWriter) awaitBatch(batch *writeBatch) {
 	}
 }
 
+// batchTimeout returns the timeout of new batches, it must be called with
+// ptw.mutex held.
+func (ptw *partitionWriter) batchTimeout() time.Duration {
+	min, max := ptw.w.MinBatchTimeout, ptw.w.batchTimeout()
+	if min <= 0 || min >= max {
+		return max
+	}
+	if ptw.linger == 0 {
+		ptw.linger = min
+	}
+	return ptw.linger
+}
+
+// adaptBatchTimeout adjusts the timeout of the next batches when the writer is
+// configured with a MinBatchTimeout, full is true when a batch filled before
+// its timeout expired. It must be called with ptw.mutex held.
+func (ptw *partitionWriter) adaptBatchTimeout(full bool) {
+	min, max := ptw.w.MinBatchTimeout, ptw.w.batchTimeout()
+	if min <= 0 || min >= max {
+		return
+	}
+
+	linger := ptw.batchTimeout()
+	if full {
+		linger *= 2
+	} else {
+		linger /= 2
+	}
+
+	switch {
+	case linger < min:
+		linger = min
+	case linger > max:
+		linger = max
+	}
+
+	ptw.linger = linger
+}
+
 func (ptw *partitionWriter) writeBatch(batch *writeBatch) {
 	stats := ptw.w.stats()
-	stats.batchTime.observe(int64(time.Since(batch.time)))
-	stats.batchSize.observe(int64(len(batch.msgs)))
-	stats.batchSizeBytes.observe(batch.bytes)
+	labels := ptw.metricLabels()
+	ptw.w.observeDuration("kafka.writer.batch.seconds", &stats.batchTime, time.Since(batch.time), labels)
+	ptw.w.observe("kafka.writer.batch.size", &stats.batchSize, int64(len(batch.msgs)), labels)
+	ptw.w.observe("kafka.writer.batch.bytes", &stats.batchSizeBytes, batch.bytes, labels)
+
+	var err error
+	var uncompressed, compressed int64
+	first := 0
+	for _, msgs := range ptw.w.splitRequests(ptw.meta.topic, batch.msgs) {
+		var records *writerRecords
+		ctxs := batch.contexts(first, first+len(msgs))
+		if records, err = ptw.produce(ctxs, msgs, ptw.w.deliveryDeadline(batch.time)); err != nil {
+			break
+		}
+		uncompressed += records.uncompressed
+		compressed += records.compressed
+		first += len(msgs)
+	}
+
+	// The sizes are only known once the records were encoded, they are
+	// reported for the batches that were written, regardless of the number of
+	// attempts.
+	if err == nil && compressed != 0 {
+		ptw.w.count("kafka.writer.batch.uncompressed.bytes", &stats.uncompressedBytes, uncompressed, labels)
+		ptw.w.count("kafka.writer.batch.compressed.bytes", &stats.compressedBytes, compressed, labels)
+		ptw.w.observe("kafka.writer.batch.compressed.size", &stats.batchCompressedBytes, compressed, labels)
+	}
+
+	if ptw.w.Completion != nil {
+		ptw.w.Completion(batch.msgs, err)
+	}
+
+	ptw.w.buffer.release(int64(len(batch.msgs)), batch.bytes)
+	batch.complete(err)
+}
+
+// produce writes msgs with a single produce request, retrying on temporary
+// errors until the deadline, which is ignored when zero. The contexts of the
+// WriteMessages calls which added msgs to the batch are only used to carry
+// values to the loggers. The records of the last attempt are returned.
+func (ptw *partitionWriter) produce(ctxs []context.Context, msgs []Message, deadline time.Time) (*writerRecords, error) {
+	stats := ptw.w.stats()
+	bytes := int64(0)
+	for i := range msgs {
+		bytes += int64(msgs[i].size())
+	}
 
 	var res *ProduceResponse
+	var records *writerRecords
 	var err error
 	key := ptw.meta
-	for attempt, maxAttempts := 0, ptw.w.maxAttempts(); attempt < maxAttempts; attempt++ {
+	labels := ptw.metricLabels()
+	attempt, replicaAttempts := 0, 0
+	for maxAttempts := ptw.w.maxAttempts(); attempt < maxAttempts; attempt++ {
 		if attempt != 0 {
-			stats.retries.observe(1)
+			ptw.w.observe("kafka.writer.retries.count", &stats.retries, 1, labels)
 			// TODO: should there be a way to asynchronously cancel this
 			// operation?
 			//
@@ -1087,54 +1821,102 @@ func (ptw *partitionWriter) writeBatch(batch *writeBatch) {
 			//   on close.
 			//
 			delay := backoff(attempt, 100*time.Millisecond, 1*time.Second)
-			ptw.w.withLogger(func(log Logger) {
-				log.Printf("backing off %s writing %d messages to %s (partition: %d)", delay, len(batch.msgs), key.topic, key.partition)
-			})
+			if !deadline.IsZero() && time.Until(deadline) <= delay {
+				err = ptw.deliveryTimeout(attempt, err)
+				break
+			}
+			ptw.w.log().debugContexts(ctxs, "backing off writing messages",
+				logAttrs{"topic", key.topic, "partition", key.partition, "messages", len(msgs), "delay", delay, "attempt", attempt},
+				"backing off %s writing %d messages to %s (partition: %d)", delay, len(msgs), key.topic, key.partition)
 			time.Sleep(delay)
 		}
 
-		ptw.w.withLogger(func(log Logger) {
-			log.Printf("writing %d messages to %s (partition: %d)", len(batch.msgs), key.topic, key.partition)
-		})
+		ptw.w.log().debugContexts(ctxs, "writing messages",
+			logAttrs{"topic", key.topic, "partition", key.partition, "messages", len(msgs)},
+			"writing %d messages to %s (partition: %d)", len(msgs), key.topic, key.partition)
+
+		timeout := ptw.w.requestTimeout()
+		if !deadline.IsZero() {
+			remain := time.Until(deadline)
+			if remain <= 0 {
+				err = ptw.deliveryTimeout(attempt, err)
+				break
+			}
+			if remain < timeout {
+				timeout = remain
+			}
+		}
 
 		start := time.Now()
-		res, err = ptw.w.produce(key, batch)
+		records = &writerRecords{msgs: msgs}
+		res, err = ptw.w.produce(key, records, timeout)
 
-		stats.writes.observe(1)
-		stats.messages.observe(int64(len(batch.msgs)))
-		stats.bytes.observe(batch.bytes)
+		ptw.w.count("kafka.writer.write.count", &stats.writes, 1, labels)
+		ptw.w.count("kafka.writer.message.count", &stats.messages, int64(len(msgs)), labels)
+		ptw.w.count("kafka.writer.message.bytes", &stats.bytes, bytes, labels)
 		// stats.writeTime used to report the duration of WriteMessages, but the
 		// implementation was broken and reporting values in the nanoseconds
 		// range. In kafka-go 0.4, we recylced this value to instead report the
 		// duration of produce requests, and changed the stats.waitTime value to
 		// report the time that kafka has throttled the requests for.
-		stats.writeTime.observe(int64(time.Since(start)))
+		ptw.w.observeDuration("kafka.writer.write.seconds", &stats.writeTime, time.Since(start), labels)
 
 		if res != nil {
 			err = res.Error
-			stats.waitTime.observe(int64(res.Throttle))
+			ptw.w.observeDuration("kafka.writer.wait.seconds", &stats.waitTime, res.Throttle, labels)
 		}
 
 		if err == nil {
 			break
 		}
 
-		stats.errors.observe(1)
+		ptw.w.count("kafka.writer.error.count", &stats.errors, 1, labels)
 
-		ptw.w.withErrorLogger(func(log Logger) {
-			log.Printf("error writing messages to %s (partition %d): %s", key.topic, key.partition, err)
-		})
+		ptw.w.log().errorContexts(ctxs, "error writing messages",
+			logAttrs{"topic", key.topic, "partition", key.partition, "messages", len(msgs), "error", err},
+			"error writing messages to %s (partition %d): %s", key.topic, key.partition, err)
 
-		if !isTemporary(err) && !isTransientNetworkError(err) {
+		if !ptw.w.retriable(err) {
 			break
 		}
+
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			attempt++
+			err = ptw.deliveryTimeout(attempt, err)
+			break
+		}
+
+		if isNotEnoughReplicas(err) {
+			if replicaAttempts++; replicaAttempts >= ptw.w.maxReplicaAttempts() {
+				attempt++
+				break
+			}
+		}
+	}
+
+	if err != nil && isNotEnoughReplicas(err) && !isDeliveryTimeout(err) {
+		var code Error
+		errors.As(err, &code)
+		err = NotEnoughReplicasError{
+			Err:       code,
+			Topic:     key.topic,
+			Partition: int(key.partition),
+			Attempts:  attempt,
+		}
 	}
 
 	if res != nil {
-		for i := range batch.msgs {
-			m := &batch.msgs[i]
+		for i := range msgs {
+			m := &msgs[i]
 			m.Topic = key.topic
 			m.Partition = int(key.partition)
+
+			// The offset and append time of error responses are -1, they
+			// must not be attributed to the messages.
+			if err != nil {
+				continue
+			}
+
 			m.Offset = res.BaseOffset + int64(i)
 
 			if m.Time.IsZero() {
@@ -1143,11 +1925,18 @@ func (ptw *partitionWriter) writeBatch(batch *writeBatch) {
 		}
 	}
 
-	if ptw.w.Completion != nil {
-		ptw.w.Completion(batch.msgs, err)
-	}
+	return records, err
+}
 
-	batch.complete(err)
+// deliveryTimeout returns the error reported when the messages could not be
+// delivered before the deadline, err is the error of the last attempt.
+func (ptw *partitionWriter) deliveryTimeout(attempts int, err error) error {
+	return DeliveryTimeoutError{
+		Err:       err,
+		Topic:     ptw.meta.topic,
+		Partition: int(ptw.meta.partition),
+		Attempts:  attempts,
+	}
 }
 
 func (ptw *partitionWriter) close() {
@@ -1165,6 +1954,7 @@ func (ptw *partitionWriter) close() {
 }
 
 type writeBatch struct {
+	calls []batchCall // WriteMessages calls which added messages to the batch
 	time  time.Time
 	msgs  []Message
 	size  int
@@ -1175,6 +1965,13 @@ type writeBatch struct {
 	err   error // result of the batch completion
 }
 
+// batchCall records the context of a WriteMessages call which added messages
+// to a batch, starting at the index first.
+type batchCall struct {
+	ctx   context.Context
+	first int
+}
+
 func newWriteBatch(now time.Time, timeout time.Duration) *writeBatch {
 	return &writeBatch{
 		time:  now,
@@ -1201,6 +1998,22 @@ func (b *writeBatch) add(msg Message, maxSize int, maxBytes int64) bool {
 	return true
 }
 
+// contexts returns the contexts of the WriteMessages calls which added the
+// messages of the batch from index i to j.
+func (b *writeBatch) contexts(i, j int) []context.Context {
+	var ctxs []context.Context
+	for k, c := range b.calls {
+		if c.first >= j {
+			break
+		}
+		if k+1 < len(b.calls) && b.calls[k+1].first <= i {
+			continue
+		}
+		ctxs = append(ctxs, c.ctx)
+	}
+	return ctxs
+}
+
 func (b *writeBatch) full(maxSize int, maxBytes int64) bool {
 	return b.size >= maxSize || b.bytes >= maxBytes
 }
@@ -1214,12 +2027,90 @@ func (b *writeBatch) complete(err error) {
 	close(b.done)
 }
 
+// writerBuffer keeps track of the messages that have been accepted by a writer
+// but not yet delivered to kafka.
+type writerBuffer struct {
+	mutex    sync.Mutex
+	messages int64
+	bytes    int64
+	// The wait channel is closed and replaced when space is released in the
+	// buffer, waking up the goroutines blocked in acquire.
+	wait chan struct{}
+}
+
+// acquire reserves space in the buffer for msgs, blocking until enough space
+// is available or the context is canceled. Limits lower or equal to zero are
+// not applied.
+func (b *writerBuffer) acquire(ctx context.Context, msgs []Message, maxMessages int, maxBytes int64) error {
+	messages, bytes := int64(len(msgs)), int64(0)
+	for i := range msgs {
+		bytes += int64(msgs[i].size())
+	}
+
+	for {
+		b.mutex.Lock()
+
+		// Admit the messages if the buffer is empty, even if they exceed the
+		// limits, otherwise the call would block forever.
+		empty := b.messages == 0
+		if empty ||
+			((maxMessages <= 0 || b.messages+messages <= int64(maxMessages)) &&
+				(maxBytes <= 0 || b.bytes+bytes <= maxBytes)) {
+			b.messages += messages
+			b.bytes += bytes
+			b.mutex.Unlock()
+			return nil
+		}
+
+		if b.wait == nil {
+			b.wait = make(chan struct{})
+		}
+		wait := b.wait
+		b.mutex.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees space in the buffer after messages were delivered or failed.
+func (b *writerBuffer) release(messages, bytes int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.messages -= messages
+	b.bytes -= bytes
+
+	if b.wait != nil {
+		close(b.wait)
+		b.wait = nil
+	}
+}
+
+// usage returns the number of messages and bytes currently buffered.
+func (b *writerBuffer) usage() (messages, bytes int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.messages, b.bytes
+}
+
 type writerRecords struct {
 	msgs   []Message
 	index  int
 	record Record
 	key    bytesReadCloser
 	value  bytesReadCloser
+
+	// sizes of the record set once encoded, zero until then.
+	uncompressed int64
+	compressed   int64
+}
+
+func (r *writerRecords) ObserveRecordSetSize(uncompressed, compressed int64) {
+	r.uncompressed, r.compressed = uncompressed, compressed
 }
 
 func (r *writerRecords) ReadRecord() (*Record, error) {
@@ -1,17 +1,27 @@
 package kafka
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math"
+	"net"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/segmentio/kafka-go/protocol"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	produceAPI "github.com/segmentio/kafka-go/protocol/produce"
 	"github.com/segmentio/kafka-go/sasl/plain"
+	ktesting "github.com/segmentio/kafka-go/testing"
 )
 
 func TestBatchQueue(t *testing.T) {
@@ -95,6 +105,148 @@ func testBatchQueueGetWorksAfterClose(t *testing.T) {
 	}
 }
 
+func TestWriterBuffer(t *testing.T) {
+	tests := []struct {
+		scenario string
+		function func(*testing.T)
+	}{
+		{
+			scenario: "writes block when the buffered messages limit is reached",
+			function: testWriterMaxBufferedMessages,
+		},
+		{
+			scenario: "writes block when the buffered bytes limit is reached",
+			function: testWriterMaxBufferedBytes,
+		},
+		{
+			scenario: "writes exceeding the limits are accepted when the buffer is empty",
+			function: testWriterBufferAdmitsLargeWriteWhenEmpty,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+			testFunc(t)
+		})
+	}
+}
+
+func testWriterMaxBufferedMessages(t *testing.T) {
+	release := make(chan struct{})
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			<-release
+			return nil, nil
+		},
+	}
+
+	w := &Writer{
+		Addr:                TCP("localhost:9092"),
+		Topic:               "topic-A",
+		Async:               true,
+		BatchSize:           1,
+		MaxBufferedMessages: 2,
+		Transport:           transport,
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+	if err := w.WriteMessages(ctx, Message{Value: []byte("1")}, Message{Value: []byte("2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := w.Stats(); stats.BufferedMessages != 2 || stats.MaxBufferedMessages != 2 {
+		t.Fatalf("unexpected buffer usage: %d/%d", stats.BufferedMessages, stats.MaxBufferedMessages)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if err := w.WriteMessages(timeoutCtx, Message{Value: []byte("3")}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the write to block until the context expired, got %v", err)
+	}
+
+	close(release)
+
+	if err := w.WriteMessages(ctx, Message{Value: []byte("3")}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWriterMaxBufferedBytes(t *testing.T) {
+	release := make(chan struct{})
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			<-release
+			return nil, nil
+		},
+	}
+
+	msg := Message{Value: make([]byte, 100)}
+	w := &Writer{
+		Addr:             TCP("localhost:9092"),
+		Topic:            "topic-A",
+		Async:            true,
+		BatchSize:        1,
+		MaxBufferedBytes: int64(msg.size()),
+		Transport:        transport,
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+	if err := w.WriteMessages(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := w.Stats(); stats.BufferedBytes != int64(msg.size()) {
+		t.Fatalf("unexpected buffered bytes: %d", stats.BufferedBytes)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	if err := w.WriteMessages(timeoutCtx, msg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the write to block until the context expired, got %v", err)
+	}
+
+	close(release)
+
+	if err := w.WriteMessages(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWriterBufferAdmitsLargeWriteWhenEmpty(t *testing.T) {
+	w := &Writer{
+		Addr:                TCP("localhost:9092"),
+		Topic:               "topic-A",
+		BatchSize:           1,
+		MaxBufferedMessages: 1,
+		Transport: &writerTestTransport{
+			topic:      "topic-A",
+			partitions: 1,
+		},
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := w.WriteMessages(ctx, Message{Value: []byte("1")}, Message{Value: []byte("2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := w.Stats(); stats.BufferedMessages != 0 || stats.BufferedBytes != 0 {
+		t.Fatalf("buffer was not released after the write: %d messages, %d bytes", stats.BufferedMessages, stats.BufferedBytes)
+	}
+}
+
 func TestWriter(t *testing.T) {
 	tests := []struct {
 		scenario string
@@ -115,194 +267,1687 @@ func TestWriter(t *testing.T) {
 			function: testWriterMaxAttemptsErr,
 		},
 
-		{
-			scenario: "writing a message larger then the max bytes should return an error",
-			function: testWriterMaxBytes,
-		},
+		{
+			scenario: "writing a message larger then the max bytes should return an error",
+			function: testWriterMaxBytes,
+		},
+
+		{
+			scenario: "writing a batch of message based on batch byte size",
+			function: testWriterBatchBytes,
+		},
+
+		{
+			scenario: "writing a batch of messages",
+			function: testWriterBatchSize,
+		},
+
+		{
+			scenario: "writing messsages with a small batch byte size",
+			function: testWriterSmallBatchBytes,
+		},
+		{
+			scenario: "setting a non default balancer on the writer",
+			function: testWriterSetsRightBalancer,
+		},
+		{
+			scenario: "setting RequiredAcks to None in Writer does not cause a panic",
+			function: testWriterRequiredAcksNone,
+		},
+		{
+			scenario: "writing messages to multiple topics",
+			function: testWriterMultipleTopics,
+		},
+		{
+			scenario: "writing messages without specifying a topic",
+			function: testWriterMissingTopic,
+		},
+		{
+			scenario: "specifying topic for message when already set for writer",
+			function: testWriterUnexpectedMessageTopic,
+		},
+		{
+			scenario: "writing a message to an invalid partition",
+			function: testWriterInvalidPartition,
+		},
+		{
+			scenario: "writing a message to a non-existant topic creates the topic",
+			function: testWriterAutoCreateTopic,
+		},
+		{
+			scenario: "terminates on an attempt to write a message to a nonexistent topic",
+			function: testWriterTerminateMissingTopic,
+		},
+		{
+			scenario: "writing a message with SASL Plain authentication",
+			function: testWriterSasl,
+		},
+	}
+
+	for _, test := range tests {
+		testFunc := test.function
+		t.Run(test.scenario, func(t *testing.T) {
+			t.Parallel()
+			testFunc(t)
+		})
+	}
+}
+
+func newTestWriter(config WriterConfig) *Writer {
+	if len(config.Brokers) == 0 {
+		config.Brokers = []string{"localhost:9092"}
+	}
+	return NewWriter(config)
+}
+
+func testWriterClose(t *testing.T) {
+	const topic = "test-writer-0"
+	createTopic(t, topic, 1)
+	defer deleteTopic(t, topic)
+
+	w := newTestWriter(WriterConfig{
+		Topic: topic,
+	})
+
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func testWriterRequiredAcksNone(t *testing.T) {
+	topic := makeTopic()
+	createTopic(t, topic, 1)
+	defer deleteTopic(t, topic)
+
+	transport := &Transport{}
+	defer transport.CloseIdleConnections()
+
+	writer := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        topic,
+		Balancer:     &RoundRobin{},
+		RequiredAcks: RequireNone,
+		Transport:    transport,
+	}
+	defer writer.Close()
+
+	msg := Message{
+		Key:   []byte("ThisIsAKey"),
+		Value: []byte("Test message for required acks test"),
+	}
+
+	err := writer.WriteMessages(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testWriterSetsRightBalancer(t *testing.T) {
+	const topic = "test-writer-1"
+	balancer := &CRC32Balancer{}
+	w := newTestWriter(WriterConfig{
+		Topic:    topic,
+		Balancer: balancer,
+	})
+	defer w.Close()
+
+	if w.Balancer != balancer {
+		t.Errorf("Balancer not set correctly")
+	}
+}
+
+func testWriterRoundRobin1(t *testing.T) {
+	const topic = "test-writer-1"
+	createTopic(t, topic, 1)
+	defer deleteTopic(t, topic)
+
+	offset, err := readOffset(topic, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := newTestWriter(WriterConfig{
+		Topic:    topic,
+		Balancer: &RoundRobin{},
+	})
+	defer w.Close()
+
+	if err := w.WriteMessages(context.Background(), Message{
+		Value: []byte("Hello World!"),
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+
+	msgs, err := readPartition(topic, 0, offset)
+	if err != nil {
+		t.Error("error reading partition", err)
+		return
+	}
+
+	if len(msgs) != 1 {
+		t.Error("bad messages in partition", msgs)
+		return
+	}
+
+	for _, m := range msgs {
+		if string(m.Value) != "Hello World!" {
+			t.Error("bad messages in partition", msgs)
+			break
+		}
+	}
+}
+
+func TestValidateWriter(t *testing.T) {
+	tests := []struct {
+		config       WriterConfig
+		errorOccured bool
+	}{
+		{config: WriterConfig{}, errorOccured: true},
+		{config: WriterConfig{Brokers: []string{"broker1", "broker2"}}, errorOccured: false},
+		{config: WriterConfig{Brokers: []string{"broker1"}, Topic: "topic1"}, errorOccured: false},
+	}
+	for _, test := range tests {
+		err := test.config.Validate()
+		if test.errorOccured && err == nil {
+			t.Fail()
+		}
+		if !test.errorOccured && err != nil {
+			t.Fail()
+		}
+	}
+}
+
+func TestWriterMaxRequestBytes(t *testing.T) {
+	const maxRequestBytes = 1000
+
+	var requests []int
+	var transport *writerTestTransport
+	transport = &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			// Encode the request to measure its size on the wire, then decode
+			// it since encoding consumed the records. The writer does not know
+			// the client id of custom transports, so none is used.
+			b := new(bytes.Buffer)
+			if err := protocol.WriteRequest(b, 8, 1, "", req); err != nil {
+				return nil, err
+			}
+			if b.Len() > maxRequestBytes {
+				t.Errorf("produce request of %d bytes exceeds the limit of %d bytes", b.Len(), maxRequestBytes)
+			}
+			requests = append(requests, b.Len())
+
+			_, _, _, msg, err := protocol.ReadRequest(b)
+			if err != nil {
+				return nil, err
+			}
+			return transport.acknowledge(msg.(*produceAPI.Request))
+		},
+	}
+
+	w := &Writer{
+		Addr:            TCP("localhost:9092"),
+		Topic:           "topic-A",
+		BatchTimeout:    time.Millisecond,
+		MaxRequestBytes: maxRequestBytes,
+		Transport:       transport,
+	}
+	defer w.Close()
+
+	msgs := make([]Message, 20)
+	for i := range msgs {
+		msgs[i] = Message{
+			Key:     []byte(strconv.Itoa(i)),
+			Value:   make([]byte, 100),
+			Headers: []Header{{Key: "index", Value: []byte(strconv.Itoa(i))}},
+		}
+	}
+
+	if err := w.WriteMessages(context.Background(), msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) < 2 {
+		t.Errorf("expected the batch to be split into multiple produce requests, got %d", len(requests))
+	}
+
+	tooLarge := Message{Value: make([]byte, maxRequestBytes)}
+	err := w.WriteMessages(context.Background(), tooLarge)
+	var mtl MessageTooLargeError
+	if !errors.As(err, &mtl) {
+		t.Errorf("expected a MessageTooLargeError, got %v", err)
+	}
+}
+
+func TestWriterCompressedBytesStats(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &Transport{Dial: broker.Dial}
+	defer transport.CloseIdleConnections()
+
+	// The first produce request reaches the broker, but the writer does not
+	// receive the response and retries it.
+	attempts := 0
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		Compression:  Gzip,
+		BatchTimeout: time.Millisecond,
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			res, err := transport.RoundTrip(ctx, addr, req)
+			if _, ok := req.(*produceAPI.Request); ok && err == nil {
+				if attempts++; attempts == 1 {
+					return nil, io.ErrUnexpectedEOF
+				}
+			}
+			return res, err
+		}),
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := w.WriteMessages(ctx, Message{Value: bytes.Repeat([]byte("hello"), 100)}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected the batch to be written in 2 attempts, got %d", attempts)
+	}
+
+	stats := w.Stats()
+	if stats.CompressedBytes == 0 || stats.CompressedBytes >= stats.UncompressedBytes {
+		t.Errorf("unexpected sizes of the compressed batches: %d compressed, %d uncompressed", stats.CompressedBytes, stats.UncompressedBytes)
+	}
+	if stats.CompressedBytes != stats.BatchCompressedBytes.Max {
+		t.Errorf("expected the size of the batch to be reported once, got %d bytes for a batch of %d bytes", stats.CompressedBytes, stats.BatchCompressedBytes.Max)
+	}
+}
+
+func TestWriterSplitRequestOffsets(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := &Client{
+		Addr:      TCP("localhost:9092"),
+		Transport: &Transport{Dial: broker.Dial},
+	}
+
+	var completed []Message
+	w := &Writer{
+		Addr:            TCP("localhost:9092"),
+		Topic:           "topic-A",
+		BatchSize:       20,
+		RequiredAcks:    RequireAll,
+		MaxRequestBytes: 1000,
+		// Another producer writes to the partition before each request of the
+		// writer, so the offsets of the batch are not contiguous.
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			if _, ok := req.(*produceAPI.Request); ok {
+				_, err := client.Produce(ctx, &ProduceRequest{
+					Topic:        "topic-A",
+					RequiredAcks: RequireAll,
+					Records:      NewRecordReader(Record{Value: NewBytes([]byte("other"))}),
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return client.Transport.RoundTrip(ctx, addr, req)
+		}),
+		Completion: func(messages []Message, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			completed = append(completed, messages...)
+		},
+	}
+	defer w.Close()
+
+	msgs := make([]Message, 20)
+	for i := range msgs {
+		msgs[i] = Message{Value: append([]byte(strconv.Itoa(i)), make([]byte, 100)...)}
+	}
+
+	if err := w.WriteMessages(ctx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Fetch(ctx, &FetchRequest{Topic: "topic-A", MaxBytes: 1e6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[int64]string)
+	for {
+		r, err := res.Records.ReadRecord()
+		if err != nil {
+			break
+		}
+		b, _ := ReadAll(r.Value)
+		values[r.Offset] = string(b)
+	}
+
+	if len(completed) != len(msgs) {
+		t.Fatalf("expected %d completed messages, got %d", len(msgs), len(completed))
+	}
+	if n := len(values) - len(msgs); n < 2 {
+		t.Errorf("expected the batch to be split into multiple produce requests, got %d", n)
+	}
+	for i, m := range completed {
+		if v := values[m.Offset]; v != string(msgs[i].Value) {
+			t.Errorf("message %d was attributed offset %d, which holds %.3q", i, m.Offset, v)
+		}
+	}
+}
+
+func TestWriterSplitRequestOffsetsOnError(t *testing.T) {
+	var requests int32
+	var transport *writerTestTransport
+	transport = &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		offsets:    map[int32]int64{0: 100},
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			if atomic.AddInt32(&requests, 1) == 1 {
+				return transport.acknowledge(req)
+			}
+			return &produceAPI.Response{
+				Topics: []produceAPI.ResponseTopic{{
+					Topic: "topic-A",
+					Partitions: []produceAPI.ResponsePartition{{
+						ErrorCode:     int16(InvalidRecord),
+						BaseOffset:    -1,
+						LogAppendTime: -1,
+					}},
+				}},
+			}, nil
+		},
+	}
+
+	var completed []Message
+	w := &Writer{
+		Addr:            TCP("localhost:9092"),
+		Topic:           "topic-A",
+		BatchSize:       20,
+		RequiredAcks:    RequireAll,
+		MaxRequestBytes: 1000,
+		Transport:       transport,
+		Completion: func(messages []Message, err error) {
+			completed = append(completed, messages...)
+		},
+	}
+	defer w.Close()
+
+	msgs := make([]Message, 20)
+	for i := range msgs {
+		msgs[i] = Message{Value: make([]byte, 100)}
+	}
+
+	if err := w.WriteMessages(context.Background(), msgs...); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+
+	if len(completed) != len(msgs) || atomic.LoadInt32(&requests) != 2 {
+		t.Fatalf("expected %d messages to be completed after 2 requests, got %d after %d", len(msgs), len(completed), requests)
+	}
+	for i, m := range completed {
+		if m.Offset != 0 && m.Offset != 100+int64(i) {
+			t.Errorf("message %d was attributed offset %d", i, m.Offset)
+		}
+	}
+	if completed[0].Offset != 100 || completed[len(completed)-1].Offset != 0 {
+		t.Errorf("expected only the messages of the first request to have offsets: first=%d last=%d",
+			completed[0].Offset, completed[len(completed)-1].Offset)
+	}
+}
+
+func TestWriterMaxReplicaAttempts(t *testing.T) {
+	var mutex sync.Mutex
+	var attempts, failures int
+
+	var transport *writerTestTransport
+	transport = &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if attempts++; attempts > failures {
+				return transport.acknowledge(req)
+			}
+
+			return &produceAPI.Response{
+				Topics: []produceAPI.ResponseTopic{{
+					Topic: "topic-A",
+					Partitions: []produceAPI.ResponsePartition{{
+						Partition: 0,
+						ErrorCode: int16(NotEnoughReplicas),
+					}},
+				}},
+			}, nil
+		},
+	}
+
+	w := &Writer{
+		Addr:               TCP("localhost:9092"),
+		Topic:              "topic-A",
+		BatchTimeout:       time.Millisecond,
+		RequiredAcks:       RequireAll,
+		MaxReplicaAttempts: 2,
+		Transport:          transport,
+	}
+	defer w.Close()
+
+	// A single failure is retried.
+	failures = 1
+	if err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures exceeding the limit are reported to the program.
+	mutex.Lock()
+	attempts, failures = 0, 10
+	mutex.Unlock()
+
+	err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")})
+
+	werr, ok := err.(WriteErrors)
+	if !ok || len(werr) != 1 {
+		t.Fatalf("expected WriteErrors with one error, got %v", err)
+	}
+
+	var nerr NotEnoughReplicasError
+	if !errors.As(werr[0], &nerr) {
+		t.Fatalf("expected a NotEnoughReplicasError, got %v", werr[0])
+	}
+	if !errors.Is(werr[0], NotEnoughReplicas) {
+		t.Errorf("expected the error to wrap NotEnoughReplicas: %v", werr[0])
+	}
+	if nerr.Topic != "topic-A" || nerr.Partition != 0 || nerr.Attempts != 2 {
+		t.Errorf("unexpected error: %+v", nerr)
+	}
+	if !isTemporary(werr[0]) {
+		t.Errorf("expected the error to be temporary: %v", werr[0])
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts but got %d", attempts)
+	}
+}
+
+func TestWriterRetryClassifier(t *testing.T) {
+	errProxy := errors.New("proxy: upstream connection reset")
+
+	var mutex sync.Mutex
+	var attempts, failures int
+	var failure error
+
+	var transport *writerTestTransport
+	transport = &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if attempts++; attempts > failures {
+				return transport.acknowledge(req)
+			}
+
+			if failure == errProxy {
+				return nil, errProxy
+			}
+
+			return &produceAPI.Response{
+				Topics: []produceAPI.ResponseTopic{{
+					Topic: "topic-A",
+					Partitions: []produceAPI.ResponsePartition{{
+						Partition: 0,
+						ErrorCode: int16(failure.(Error)),
+					}},
+				}},
+			}, nil
+		},
+	}
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchTimeout: time.Millisecond,
+		RequiredAcks: RequireAll,
+		MaxAttempts:  3,
+		Transport:    transport,
+		RetryClassifier: func(err error) bool {
+			return errors.Is(err, errProxy)
+		},
+	}
+	defer w.Close()
+
+	write := func(err error) (int, error) {
+		mutex.Lock()
+		attempts, failures, failure = 0, 1, err
+		mutex.Unlock()
+
+		werr := w.WriteMessages(context.Background(), Message{Value: []byte("hello")})
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return attempts, werr
+	}
+
+	// The error of the proxy would not be retried by default.
+	if n, err := write(errProxy); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Errorf("expected 2 attempts but got %d", n)
+	}
+
+	// Temporary errors are not retried when the classifier rejects them.
+	n, err := write(RequestTimedOut)
+	werr, ok := err.(WriteErrors)
+	if !ok || len(werr) != 1 {
+		t.Fatalf("expected WriteErrors with one error, got %v", err)
+	}
+	if !errors.Is(werr[0], RequestTimedOut) {
+		t.Errorf("expected RequestTimedOut, got %v", werr[0])
+	}
+	if n != 1 {
+		t.Errorf("expected 1 attempt but got %d", n)
+	}
+}
+
+func TestWriterDeliveryTimeout(t *testing.T) {
+	var mutex sync.Mutex
+	var attempts int
+	var timeouts []time.Duration
+
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			return &produceAPI.Response{
+				Topics: []produceAPI.ResponseTopic{{
+					Topic: "topic-A",
+					Partitions: []produceAPI.ResponsePartition{{
+						Partition: 0,
+						ErrorCode: int16(RequestTimedOut),
+					}},
+				}},
+			}, nil
+		},
+	}
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchTimeout: time.Millisecond,
+		RequiredAcks: RequireAll,
+		MaxAttempts:  100,
+		// The request timeout is shortened to the remaining delivery time.
+		RequestTimeout:  time.Second,
+		DeliveryTimeout: 300 * time.Millisecond,
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			if _, ok := req.(*produceAPI.Request); ok {
+				deadline, _ := ctx.Deadline()
+				mutex.Lock()
+				attempts++
+				timeouts = append(timeouts, time.Until(deadline))
+				mutex.Unlock()
+			}
+			return transport.RoundTrip(ctx, addr, req)
+		}),
+	}
+	defer w.Close()
+
+	start := time.Now()
+	err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")})
+	elapsed := time.Since(start)
+
+	werr, ok := err.(WriteErrors)
+	if !ok || len(werr) != 1 {
+		t.Fatalf("expected WriteErrors with one error, got %v", err)
+	}
+
+	var derr DeliveryTimeoutError
+	if !errors.As(werr[0], &derr) {
+		t.Fatalf("expected a DeliveryTimeoutError, got %v", werr[0])
+	}
+	if !errors.Is(werr[0], RequestTimedOut) {
+		t.Errorf("expected the error to wrap RequestTimedOut: %v", werr[0])
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if derr.Topic != "topic-A" || derr.Partition != 0 || derr.Attempts != attempts {
+		t.Errorf("unexpected error: %+v (%d attempts)", derr, attempts)
+	}
+	if attempts < 2 || attempts >= 100 {
+		t.Errorf("unexpected number of attempts: %d", attempts)
+	}
+	if elapsed > time.Second {
+		t.Errorf("delivery took too long: %s", elapsed)
+	}
+	for _, timeout := range timeouts {
+		if timeout > 300*time.Millisecond {
+			t.Errorf("request timeout exceeds the delivery timeout: %s", timeout)
+		}
+	}
+}
+
+func TestWriterRequestTimeout(t *testing.T) {
+	var timeout time.Duration
+
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+	}
+	transport.produce = transport.acknowledge
+
+	w := &Writer{
+		Addr:           TCP("localhost:9092"),
+		Topic:          "topic-A",
+		BatchTimeout:   time.Millisecond,
+		RequestTimeout: 50 * time.Millisecond,
+		Transport: roundTripperFunc(func(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+			if _, ok := req.(*produceAPI.Request); ok {
+				deadline, _ := ctx.Deadline()
+				timeout = time.Until(deadline)
+			}
+			return transport.RoundTrip(ctx, addr, req)
+		}),
+	}
+	defer w.Close()
+
+	if err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if timeout <= 0 || timeout > 50*time.Millisecond {
+		t.Errorf("unexpected produce request timeout: %s", timeout)
+	}
+}
+
+func TestWriterTimestampType(t *testing.T) {
+	for _, timestampType := range []TimestampType{CreateTime, LogAppendTime} {
+		t.Run(timestampType.String(), func(t *testing.T) {
+			var attributes protocol.Attributes
+
+			var transport *writerTestTransport
+			transport = &writerTestTransport{
+				topic:      "topic-A",
+				partitions: 1,
+				produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+					attributes = req.Topics[0].Partitions[0].RecordSet.Attributes
+					return transport.acknowledge(req)
+				},
+			}
+
+			w := &Writer{
+				Addr:          TCP("localhost:9092"),
+				Topic:         "topic-A",
+				BatchTimeout:  time.Millisecond,
+				RequiredAcks:  RequireOne,
+				Compression:   Snappy,
+				TimestampType: timestampType,
+				Transport:     transport,
+			}
+			defer w.Close()
+
+			if err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")}); err != nil {
+				t.Fatal(err)
+			}
+
+			if attributes.LogAppendTime() != (timestampType == LogAppendTime) {
+				t.Errorf("unexpected record batch attributes: %s", attributes)
+			}
+			if attributes.Compression() != Snappy {
+				t.Errorf("unexpected compression in the record batch attributes: %s", attributes)
+			}
+		})
+	}
+}
+
+func TestWriterContextLogger(t *testing.T) {
+	type contextKey struct{}
+
+	var mutex sync.Mutex
+	var values []interface{}
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchSize:    2,
+		BatchTimeout: 10 * time.Second,
+		Transport:    &writerTestTransport{topic: "topic-A", partitions: 1},
+		Logger: ContextLoggerFunc(func(ctx context.Context, msg string, args ...interface{}) {
+			mutex.Lock()
+			values = append(values, ctx.Value(contextKey{}))
+			mutex.Unlock()
+		}),
+	}
+	defer w.Close()
+
+	// The messages of both calls are written in the same batch, which is
+	// logged about with the context of each call.
+	var wg sync.WaitGroup
+	for _, request := range []string{"request-1", "request-2"} {
+		ctx := context.WithValue(context.Background(), contextKey{}, request)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.WriteMessages(ctx, Message{Value: []byte("hello")}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	count := map[interface{}]int{}
+	for _, v := range values {
+		count[v]++
+	}
+	if len(count) != 2 || count["request-1"] == 0 || count["request-1"] != count["request-2"] {
+		t.Errorf("expected the messages to be logged with the context of each call but got %v", values)
+	}
+}
+
+type metricsHookRecorder struct {
+	mutex    sync.Mutex
+	counts   map[string]int64
+	observed map[string]int
+	labels   map[MetricLabels]bool
+}
+
+func (h *metricsHookRecorder) Count(name string, value int64, labels MetricLabels) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.counts[name] += value
+	h.labels[labels] = true
+}
+
+func (h *metricsHookRecorder) Observe(name string, value float64, labels MetricLabels) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.observed[name]++
+	h.labels[labels] = true
+}
+
+func TestWriterMetricsHook(t *testing.T) {
+	hook := &metricsHookRecorder{
+		counts:   make(map[string]int64),
+		observed: make(map[string]int),
+		labels:   make(map[MetricLabels]bool),
+	}
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchTimeout: time.Millisecond,
+		Transport:    &writerTestTransport{topic: "topic-A", partitions: 1},
+		MetricsHook:  hook,
+	}
+	defer w.Close()
+
+	msgs := []Message{
+		{Value: []byte("hello")},
+		{Value: []byte("world")},
+	}
+	if err := w.WriteMessages(context.Background(), msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+
+	for name, value := range map[string]int64{
+		"kafka.writer.write.count":   1,
+		"kafka.writer.message.count": 2,
+		"kafka.writer.message.bytes": int64(msgs[0].size() + msgs[1].size()),
+	} {
+		if hook.counts[name] != value {
+			t.Errorf("%s: expected %d but got %d", name, value, hook.counts[name])
+		}
+	}
+
+	for _, name := range []string{
+		"kafka.writer.batch.seconds",
+		"kafka.writer.batch.size",
+		"kafka.writer.batch.bytes",
+		"kafka.writer.write.seconds",
+	} {
+		if hook.observed[name] != 1 {
+			t.Errorf("%s: expected 1 observation but got %d", name, hook.observed[name])
+		}
+	}
+
+	if len(hook.labels) != 1 || !hook.labels[MetricLabels{Topic: "topic-A", Partition: 0}] {
+		t.Errorf("unexpected labels: %v", hook.labels)
+	}
+
+	// The stats keep being collected when a hook is configured.
+	if stats := w.Stats(); stats.Messages != 2 {
+		t.Errorf("expected the stats to report 2 messages but got %d", stats.Messages)
+	}
+}
+
+func TestWriterMinBatchTimeout(t *testing.T) {
+	w := &Writer{
+		Addr:            TCP("localhost:9092"),
+		Topic:           "topic-A",
+		BatchSize:       2,
+		BatchTimeout:    time.Second,
+		MinBatchTimeout: 10 * time.Millisecond,
+		Transport:       &writerTestTransport{topic: "topic-A", partitions: 1},
+	}
+	defer w.Close()
+
+	// Incomplete batches are flushed after the minimum timeout while the
+	// throughput is low.
+	start := time.Now()
+	if err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= w.BatchTimeout {
+		t.Errorf("expected the batch to be flushed before the max timeout, took %s", elapsed)
+	}
+
+	ptw := &partitionWriter{w: w}
+	for i, test := range []struct {
+		full bool
+		want time.Duration
+	}{
+		{full: true, want: 20 * time.Millisecond},
+		{full: true, want: 40 * time.Millisecond},
+		{full: false, want: 20 * time.Millisecond},
+		{full: false, want: 10 * time.Millisecond},
+		{full: false, want: 10 * time.Millisecond},
+	} {
+		ptw.adaptBatchTimeout(test.full)
+		if timeout := ptw.batchTimeout(); timeout != test.want {
+			t.Errorf("step %d: expected a batch timeout of %s but got %s", i, test.want, timeout)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		ptw.adaptBatchTimeout(true)
+	}
+	if timeout := ptw.batchTimeout(); timeout != w.BatchTimeout {
+		t.Errorf("expected the batch timeout to be capped at %s but got %s", w.BatchTimeout, timeout)
+	}
+}
+
+func TestWriterPartitions(t *testing.T) {
+	var mutex sync.Mutex
+	counts := make(map[int32]int)
+
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 10,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, p := range req.Topics[0].Partitions {
+				counts[p.Partition]++
+			}
+			return nil, nil
+		},
+	}
+
+	w := &Writer{
+		Addr:       TCP("localhost:9092"),
+		Topic:      "topic-A",
+		BatchSize:  1,
+		Partitions: []int{4, 5, 6, 7},
+		Transport:  transport,
+	}
+	defer w.Close()
+
+	for i := 0; i < 8; i++ {
+		if err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The default round-robin balancer distributes messages evenly within
+	// the subset of partitions.
+	if want := map[int32]int{4: 2, 5: 2, 6: 2, 7: 2}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("unexpected distribution of messages across partitions: %v", counts)
+	}
+
+	transport.partitions = 6
+
+	err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")})
+	if !errors.Is(err, UnknownTopicOrPartition) {
+		t.Errorf("expected an error when the subset exceeds the partitions of the topic but got %v", err)
+	}
+}
+
+func TestWriterCompressionThreshold(t *testing.T) {
+	var mutex sync.Mutex
+	var codecs []Compression
+
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			codecs = append(codecs, req.Topics[0].Partitions[0].RecordSet.Attributes.Compression())
+			return nil, nil
+		},
+	}
+
+	w := &Writer{
+		Addr:                 TCP("localhost:9092"),
+		Topic:                "topic-A",
+		Compression:          Gzip,
+		CompressionThreshold: 1000,
+		BatchTimeout:         time.Millisecond,
+		Transport:            transport,
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+
+	// Each message is smaller than the threshold, but the second batch is
+	// compressed because of its total size.
+	small := Message{Value: make([]byte, 100)}
+	if err := w.WriteMessages(ctx, small); err != nil {
+		t.Fatal(err)
+	}
+	batch := make([]Message, 20)
+	for i := range batch {
+		batch[i] = small
+	}
+	if err := w.WriteMessages(ctx, batch...); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if want := []Compression{0, Gzip}; !reflect.DeepEqual(codecs, want) {
+		t.Errorf("expected the batches to be produced with codecs %v but got %v", want, codecs)
+	}
+}
+
+func TestWriterWriteTyped(t *testing.T) {
+	type event struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	var written []Message
+
+	w := &Writer{
+		Addr:            TCP("localhost:9092"),
+		Topic:           "topic-A",
+		BatchTimeout:    time.Millisecond,
+		Transport:       &writerTestTransport{topic: "topic-A", partitions: 1},
+		ValueSerializer: JSONSerializer{},
+		Completion: func(messages []Message, err error) {
+			written = append(written, messages...)
+		},
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+	err := w.WriteTyped(ctx,
+		TypedMessage{Key: "key-1", Value: event{ID: 1, Name: "created"}},
+		TypedMessage{Key: []byte("key-2")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(written) != 2 {
+		t.Fatalf("expected 2 messages to be written but got %d", len(written))
+	}
+	if key, value := string(written[0].Key), string(written[0].Value); key != "key-1" || value != `{"id":1,"name":"created"}` {
+		t.Errorf("unexpected first message: key=%q value=%q", key, value)
+	}
+	if key := string(written[1].Key); key != "key-2" || written[1].Value != nil {
+		t.Errorf("unexpected tombstone: key=%q value=%q", key, written[1].Value)
+	}
+
+	// Keys are not serialized by the default serializer.
+	if err := w.WriteTyped(ctx, TypedMessage{Key: 42, Value: event{}}); err == nil {
+		t.Error("expected an error writing a key which cannot be serialized")
+	}
+	if len(written) != 2 {
+		t.Errorf("expected no messages to be written after the serialization error but got %d", len(written)-2)
+	}
+}
+
+func TestWriterWriteMessagesResult(t *testing.T) {
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: RequireOne,
+		Transport:    &writerTestTransport{topic: "topic-A", partitions: 2},
+	}
+	defer w.Close()
+
+	ctx := context.Background()
+	msgs := []Message{
+		{Value: []byte("0")},
+		{Value: []byte("1")},
+		{Value: []byte("2")},
+		{Value: []byte("3")},
+	}
+
+	results, err := w.WriteMessagesResult(ctx, msgs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type position struct {
+		value     string
+		partition int
+		offset    int64
+	}
+	positions := make([]position, len(results))
+	for i, m := range results {
+		positions[i] = position{value: string(m.Value), partition: m.Partition, offset: m.Offset}
+	}
+	want := []position{{"0", 0, 0}, {"1", 1, 0}, {"2", 0, 1}, {"3", 1, 1}}
+	if !reflect.DeepEqual(positions, want) {
+		t.Errorf("expected the messages to be written at %v but got %v", want, positions)
+	}
+	if msgs[0].Offset != 0 || msgs[0].Topic != "" {
+		t.Error("the messages passed to WriteMessagesResult were modified")
+	}
+
+	// Messages of concurrent calls batched together are attributed to each
+	// call.
+	var wg sync.WaitGroup
+	offsets := make(chan position, 20)
+	for c := 0; c < 2; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			msgs := make([]Message, 5)
+			for i := range msgs {
+				msgs[i].Value = []byte(fmt.Sprintf("%d-%d", c, i))
+			}
+			results, err := w.WriteMessagesResult(ctx, msgs...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for i, m := range results {
+				if !bytes.Equal(m.Value, msgs[i].Value) {
+					t.Errorf("expected message %q at index %d but got %q", msgs[i].Value, i, m.Value)
+				}
+				offsets <- position{partition: m.Partition, offset: m.Offset}
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(offsets)
+
+	seen := make(map[position]bool)
+	for p := range offsets {
+		if seen[p] {
+			t.Errorf("offset %d of partition %d was returned twice", p.offset, p.partition)
+		}
+		seen[p] = true
+	}
+
+	w.RequiredAcks = RequireNone
+	if _, err := w.WriteMessagesResult(ctx, msgs...); err == nil {
+		t.Error("expected an error writing messages without acknowledgements")
+	}
+
+	w.RequiredAcks = RequireOne
+	w.Async = true
+	if _, err := w.WriteMessagesResult(ctx, msgs...); err == nil {
+		t.Error("expected an error writing messages asynchronously")
+	}
+}
+
+func TestWriterWriteMessagesAsync(t *testing.T) {
+	release := make(chan struct{})
+	completions := make(chan int, 10)
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchTimeout: 10 * time.Millisecond,
+		RequiredAcks: RequireOne,
+		Async:        true,
+		Completion: func(messages []Message, err error) {
+			completions <- len(messages)
+		},
+		Transport: &writerTestTransport{
+			topic:      "topic-A",
+			partitions: 2,
+			produce: func(*produceAPI.Request) (*produceAPI.Response, error) {
+				<-release
+				return nil, nil
+			},
+		},
+	}
+	defer w.Close()
+
+	msgs := []Message{
+		{Value: []byte("0")},
+		{Value: []byte("1")},
+		{Value: []byte("2")},
+	}
+
+	// The call must not block on the delivery of the messages, which are held
+	// by the transport until release is closed.
+	future, err := w.WriteMessagesAsync(context.Background(), msgs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := future.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to time out but got %v", err)
+	}
+
+	close(release)
+
+	results, err := future.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type position struct {
+		value     string
+		partition int
+		offset    int64
+	}
+	positions := make([]position, len(results))
+	for i, m := range results {
+		positions[i] = position{value: string(m.Value), partition: m.Partition, offset: m.Offset}
+	}
+	want := []position{{"0", 0, 0}, {"1", 1, 0}, {"2", 0, 1}}
+	if !reflect.DeepEqual(positions, want) {
+		t.Errorf("expected the messages to be written at %v but got %v", want, positions)
+	}
+
+	completed := 0
+	for completed < len(msgs) {
+		select {
+		case n := <-completions:
+			completed += n
+		case <-time.After(time.Second):
+			t.Fatal("the completion function was not called")
+		}
+	}
+
+	if _, err := w.WriteMessagesAsync(context.Background(), Message{Value: make([]byte, 2e6)}); !errors.As(err, new(MessageTooLargeError)) {
+		t.Errorf("expected the message too large error to be returned immediately but got %v", err)
+	}
+}
+
+func TestWriterTombstones(t *testing.T) {
+	broker := &ktesting.Broker{}
+	defer broker.Close()
+
+	if err := broker.CreateTopic("topic-A", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchTimeout: time.Millisecond,
+		Transport:    &Transport{Dial: broker.Dial},
+	}
+	defer w.Close()
+
+	msgs := []Message{
+		{Key: []byte("A"), Value: nil},
+		{Key: []byte("B"), Value: []byte{}},
+		{Key: []byte("C"), Value: []byte("1")},
+	}
+	if err := w.WriteMessages(ctx, msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(ReaderConfig{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "topic-A",
+		Dialer:  &Dialer{DialFunc: broker.Dial},
+		MaxWait: 100 * time.Millisecond,
+	})
+	defer r.Close()
+
+	for _, want := range msgs {
+		m, err := r.ReadMessage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(m.Key) != string(want.Key) {
+			t.Fatalf("expected to read the message with key %q but got %q", want.Key, m.Key)
+		}
+		if (m.Value == nil) != (want.Value == nil) || !bytes.Equal(m.Value, want.Value) {
+			t.Errorf("message %q: expected the value %#v but got %#v", m.Key, want.Value, m.Value)
+		}
+	}
+}
+
+func TestWriterMessageVersion(t *testing.T) {
+	tests := []struct {
+		messageVersion int
+		apiVersion     int16
+		recordVersion  int8
+	}{
+		{messageVersion: 0, apiVersion: protocol.Produce.MaxVersion(), recordVersion: 2},
+		{messageVersion: 2, apiVersion: protocol.Produce.MaxVersion(), recordVersion: 2},
+		{messageVersion: 1, apiVersion: 2, recordVersion: 1},
+		{messageVersion: MessageVersion0, apiVersion: 1, recordVersion: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("MessageVersion=%d", test.messageVersion), func(t *testing.T) {
+			broker := &ktesting.Broker{}
+			defer broker.Close()
+
+			if err := broker.CreateTopic("topic-A", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			proxy := &produceVersionProxy{broker: broker}
+			transport := &Transport{Dial: proxy.Dial}
+			defer transport.CloseIdleConnections()
+
+			w := &Writer{
+				Addr:           TCP("localhost:9092"),
+				Topic:          "topic-A",
+				Compression:    Gzip,
+				MessageVersion: test.messageVersion,
+				BatchTimeout:   time.Millisecond,
+				Transport:      transport,
+			}
+			defer w.Close()
+
+			ctx := context.Background()
+			if err := w.WriteMessages(ctx, Message{Value: []byte("hello")}, Message{Value: []byte("world")}); err != nil {
+				t.Fatal(err)
+			}
 
-		{
-			scenario: "writing a batch of message based on batch byte size",
-			function: testWriterBatchBytes,
-		},
+			proxy.mutex.Lock()
+			defer proxy.mutex.Unlock()
 
-		{
-			scenario: "writing a batch of messages",
-			function: testWriterBatchSize,
-		},
+			if len(proxy.apiVersions) != 1 {
+				t.Fatalf("expected one produce request but got %d", len(proxy.apiVersions))
+			}
+			if proxy.apiVersions[0] != test.apiVersion {
+				t.Errorf("expected the produce request to be sent in version %d but got %d", test.apiVersion, proxy.apiVersions[0])
+			}
+			if proxy.recordVersions[0] != test.recordVersion {
+				t.Errorf("expected the records to be produced in message version %d but got %d", test.recordVersion, proxy.recordVersions[0])
+			}
+		})
+	}
 
-		{
-			scenario: "writing messsages with a small batch byte size",
-			function: testWriterSmallBatchBytes,
-		},
-		{
-			scenario: "setting a non default balancer on the writer",
-			function: testWriterSetsRightBalancer,
-		},
-		{
-			scenario: "setting RequiredAcks to None in Writer does not cause a panic",
-			function: testWriterRequiredAcksNone,
-		},
-		{
-			scenario: "writing messages to multiple topics",
-			function: testWriterMultipleTopics,
-		},
-		{
-			scenario: "writing messages without specifying a topic",
-			function: testWriterMissingTopic,
-		},
-		{
-			scenario: "specifying topic for message when already set for writer",
-			function: testWriterUnexpectedMessageTopic,
-		},
-		{
-			scenario: "writing a message to an invalid partition",
-			function: testWriterInvalidPartition,
-		},
-		{
-			scenario: "writing a message to a non-existant topic creates the topic",
-			function: testWriterAutoCreateTopic,
-		},
-		{
-			scenario: "terminates on an attempt to write a message to a nonexistent topic",
-			function: testWriterTerminateMissingTopic,
-		},
-		{
-			scenario: "writing a message with SASL Plain authentication",
-			function: testWriterSasl,
-		},
+	w := &Writer{
+		Addr:           TCP("localhost:9092"),
+		Topic:          "topic-A",
+		MessageVersion: 1,
+		Transport:      &writerTestTransport{topic: "topic-A", partitions: 1},
 	}
+	defer w.Close()
 
-	for _, test := range tests {
-		testFunc := test.function
-		t.Run(test.scenario, func(t *testing.T) {
-			t.Parallel()
-			testFunc(t)
-		})
+	ctx := context.Background()
+	if err := w.WriteMessages(ctx, Message{Value: []byte("hello"), Headers: []Header{{Key: "k"}}}); err == nil {
+		t.Error("expected an error writing a message with headers in message version 1")
 	}
-}
 
-func newTestWriter(config WriterConfig) *Writer {
-	if len(config.Brokers) == 0 {
-		config.Brokers = []string{"localhost:9092"}
+	w.MessageVersion = 3
+	if err := w.WriteMessages(ctx, Message{Value: []byte("hello")}); err == nil {
+		t.Error("expected an error writing messages in an unsupported message version")
 	}
-	return NewWriter(config)
 }
 
-func testWriterClose(t *testing.T) {
-	const topic = "test-writer-0"
-	createTopic(t, topic, 1)
-	defer deleteTopic(t, topic)
-
-	w := newTestWriter(WriterConfig{
-		Topic: topic,
-	})
+// produceVersionProxy forwards the requests of connections to broker, and
+// records the versions of the Produce API and of the message format of the
+// produce requests.
+type produceVersionProxy struct {
+	broker         *ktesting.Broker
+	mutex          sync.Mutex
+	apiVersions    []int16
+	recordVersions []int8
+}
 
-	if err := w.Close(); err != nil {
-		t.Error(err)
+func (p *produceVersionProxy) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	upstream, err := p.broker.Dial(ctx, network, address)
+	if err != nil {
+		return nil, err
 	}
+
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		defer upstream.Close()
+
+		r := bufio.NewReader(server)
+		u := bufio.NewReader(upstream)
+
+		for {
+			version, id, clientID, req, err := protocol.ReadRequest(r)
+			if err != nil {
+				return
+			}
+			if produce, ok := req.(*produceAPI.Request); ok {
+				p.mutex.Lock()
+				p.apiVersions = append(p.apiVersions, version)
+				p.recordVersions = append(p.recordVersions, produce.Topics[0].Partitions[0].RecordSet.Version)
+				p.mutex.Unlock()
+			}
+			if protocol.WriteRequest(upstream, version, id, clientID, req) != nil {
+				return
+			}
+			_, res, err := protocol.ReadResponse(u, req.ApiKey(), version)
+			if err != nil {
+				return
+			}
+			if protocol.WriteResponse(server, version, id, res) != nil {
+				return
+			}
+		}
+	}()
+
+	return client, nil
 }
 
-func testWriterRequiredAcksNone(t *testing.T) {
-	topic := makeTopic()
-	createTopic(t, topic, 1)
-	defer deleteTopic(t, topic)
+func TestWriterPartition(t *testing.T) {
+	var produced int32 = -1
 
-	transport := &Transport{}
-	defer transport.CloseIdleConnections()
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 8,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			produced = req.Topics[0].Partitions[0].Partition
+			return nil, nil
+		},
+	}
 
-	writer := &Writer{
-		Addr:         TCP("localhost:9092"),
-		Topic:        topic,
-		Balancer:     &RoundRobin{},
-		RequiredAcks: RequireNone,
-		Transport:    transport,
+	w := &Writer{
+		Addr:      TCP("localhost:9092"),
+		Topic:     "topic-A",
+		Balancer:  &Hash{},
+		BatchSize: 1,
+		Transport: transport,
 	}
-	defer writer.Close()
+	defer w.Close()
 
-	msg := Message{
-		Key:   []byte("ThisIsAKey"),
-		Value: []byte("Test message for required acks test"),
+	for _, key := range []string{"A", "B", "C", "D"} {
+		msg := Message{Key: []byte(key), Value: []byte("hello")}
+
+		partition, err := w.Partition("", msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteMessages(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		if int32(partition) != produced {
+			t.Errorf("key %s: expected the message to be written to partition %d but got %d", key, partition, produced)
+		}
 	}
 
-	err := writer.WriteMessages(context.Background(), msg)
-	if err != nil {
-		t.Fatal(err)
+	if _, err := w.Partition("topic-B", Message{}); err == nil {
+		t.Error("expected an error choosing the partition of a message for an unknown topic")
 	}
 }
 
-func testWriterSetsRightBalancer(t *testing.T) {
-	const topic = "test-writer-1"
-	balancer := &CRC32Balancer{}
-	w := newTestWriter(WriterConfig{
-		Topic:    topic,
-		Balancer: balancer,
-	})
+func TestWriterMetadataAwareBalancer(t *testing.T) {
+	var produced int32 = -1
+
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 4,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			produced = req.Topics[0].Partitions[0].Partition
+			return nil, nil
+		},
+		metadata: func(res *metadataAPI.Response) {
+			res.Brokers = []metadataAPI.ResponseBroker{
+				{NodeID: 1, Host: "localhost", Port: 9092, Rack: "rack-a"},
+				{NodeID: 2, Host: "localhost", Port: 9093, Rack: "rack-b"},
+			}
+			partitions := res.Topics[0].Partitions
+			partitions[0].LeaderID = 1
+			partitions[1].LeaderID = 1
+			partitions[2].LeaderID = -1
+			partitions[2].ErrorCode = int16(LeaderNotAvailable)
+			partitions[3].LeaderID = 2
+		},
+	}
+
+	var seen []Partition
+
+	w := &Writer{
+		Addr:       TCP("localhost:9092"),
+		Topic:      "topic-A",
+		Partitions: []int{1, 2, 3},
+		Balancer: MetadataBalancerFunc(func(msg Message, partitions ...Partition) int {
+			seen = append(seen[:0], partitions...)
+			// Route to the first partition with a leader in rack-b.
+			for _, p := range partitions {
+				if p.Error == nil && p.Leader.Rack == "rack-b" {
+					return p.ID
+				}
+			}
+			return partitions[0].ID
+		}),
+		BatchSize: 1,
+		Transport: transport,
+	}
 	defer w.Close()
 
-	if w.Balancer != balancer {
-		t.Errorf("Balancer not set correctly")
+	if err := w.WriteMessages(context.Background(), Message{Value: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if produced != 3 {
+		t.Errorf("expected the message to be written to partition 3 but got %d", produced)
+	}
+
+	if len(seen) != 3 {
+		t.Fatalf("expected the balancer to receive the 3 partitions of the writer but got %d", len(seen))
+	}
+	for i, id := range []int{1, 2, 3} {
+		if seen[i].ID != id || seen[i].Topic != "topic-A" {
+			t.Errorf("partition #%d: expected partition %d of topic-A but got partition %d of %q", i, id, seen[i].ID, seen[i].Topic)
+		}
+	}
+	if leader := seen[0].Leader; leader.ID != 1 || leader.Rack != "rack-a" || leader.Port != 9092 {
+		t.Errorf("expected partition 1 to be led by broker 1 in rack-a but got %+v", leader)
+	}
+	if leader := seen[1].Leader; leader.ID != -1 || !errors.Is(seen[1].Error, LeaderNotAvailable) {
+		t.Errorf("expected partition 2 to have no leader but got %+v (error: %v)", leader, seen[1].Error)
 	}
 }
 
-func testWriterRoundRobin1(t *testing.T) {
-	const topic = "test-writer-1"
-	createTopic(t, topic, 1)
-	defer deleteTopic(t, topic)
+func TestWriterErrorBalancer(t *testing.T) {
+	var produced []int32
 
-	offset, err := readOffset(topic, 0)
-	if err != nil {
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 4,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			produced = append(produced, req.Topics[0].Partitions[0].Partition)
+			return nil, nil
+		},
+	}
+
+	// The partition is parsed from the key of messages.
+	w := &Writer{
+		Addr:  TCP("localhost:9092"),
+		Topic: "topic-A",
+		Balancer: ErrorBalancerFunc(func(msg Message, partitions ...int) (int, error) {
+			partition, err := strconv.Atoi(string(msg.Key))
+			if err != nil {
+				return 0, err
+			}
+			return partitions[partition%len(partitions)], nil
+		}),
+		BatchSize: 1,
+		Transport: transport,
+	}
+	defer w.Close()
+
+	if err := w.WriteMessages(context.Background(), Message{Key: []byte("2"), Value: []byte("hello")}); err != nil {
 		t.Fatal(err)
 	}
+	if len(produced) != 1 || produced[0] != 2 {
+		t.Errorf("expected the message to be written to partition 2 but got %v", produced)
+	}
 
-	w := newTestWriter(WriterConfig{
-		Topic:    topic,
-		Balancer: &RoundRobin{},
-	})
+	err := w.WriteMessages(context.Background(),
+		Message{Key: []byte("1"), Value: []byte("hello")},
+		Message{Key: []byte("not-a-number"), Value: []byte("hello")},
+	)
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) || !strings.HasPrefix(err.Error(), "kafka.(*Writer).WriteMessages: ") {
+		t.Errorf("expected the error of the balancer to be returned but got %v", err)
+	}
+	if len(produced) != 1 {
+		t.Errorf("expected no messages to be written when the balancer fails but got %v", produced)
+	}
+
+	_, err = w.Partition("", Message{Key: []byte("not-a-number")})
+	if !errors.As(err, &numErr) || !strings.HasPrefix(err.Error(), "kafka.(*Writer).Partition: ") {
+		t.Errorf("expected the error of the balancer to be returned by Partition but got %v", err)
+	}
+}
+
+func TestWriterTopicRequiredAcks(t *testing.T) {
+	var mutex sync.Mutex
+	acks := map[string]int16{}
+
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			mutex.Lock()
+			acks[req.Topics[0].Topic] = req.Acks
+			mutex.Unlock()
+			return nil, nil
+		},
+		metadata: func(res *metadataAPI.Response) {
+			for _, topic := range []string{"topic-B", "topic-C"} {
+				res.Topics = append(res.Topics, metadataAPI.ResponseTopic{
+					Name:       topic,
+					Partitions: []metadataAPI.ResponsePartition{{PartitionIndex: 0}},
+				})
+			}
+		},
+	}
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		RequiredAcks: RequireAll,
+		TopicRequiredAcks: map[string]RequiredAcks{
+			"topic-B": RequireOne,
+			"topic-C": RequireNone,
+		},
+		BatchSize: 1,
+		Transport: transport,
+	}
 	defer w.Close()
 
-	if err := w.WriteMessages(context.Background(), Message{
-		Value: []byte("Hello World!"),
-	}); err != nil {
-		t.Error(err)
-		return
+	if err := w.WriteMessages(context.Background(),
+		Message{Topic: "topic-A", Value: []byte("critical")},
+		Message{Topic: "topic-B", Value: []byte("metrics")},
+		Message{Topic: "topic-C", Value: []byte("logs")},
+	); err != nil {
+		t.Fatal(err)
 	}
 
-	msgs, err := readPartition(topic, 0, offset)
-	if err != nil {
-		t.Error("error reading partition", err)
-		return
+	mutex.Lock()
+	if want := map[string]int16{"topic-A": -1, "topic-B": 1, "topic-C": 0}; !reflect.DeepEqual(acks, want) {
+		t.Errorf("expected the produce requests to have acks %v but got %v", want, acks)
 	}
+	mutex.Unlock()
 
-	if len(msgs) != 1 {
-		t.Error("bad messages in partition", msgs)
-		return
+	if _, err := w.WriteMessagesResult(context.Background(), Message{Topic: "topic-C", Value: []byte("logs")}); err == nil {
+		t.Error("expected an error getting the offsets of messages written to a topic which does not require acknowledgements")
 	}
 
-	for _, m := range msgs {
-		if string(m.Value) != "Hello World!" {
-			t.Error("bad messages in partition", msgs)
-			break
-		}
+	w.TopicRequiredAcks["topic-B"] = 2
+	if err := w.WriteMessages(context.Background(), Message{Topic: "topic-A", Value: []byte("critical")}); err == nil {
+		t.Error("expected an error writing with invalid required acks")
 	}
 }
 
-func TestValidateWriter(t *testing.T) {
-	tests := []struct {
-		config       WriterConfig
-		errorOccured bool
-	}{
-		{config: WriterConfig{}, errorOccured: true},
-		{config: WriterConfig{Brokers: []string{"broker1", "broker2"}}, errorOccured: false},
-		{config: WriterConfig{Brokers: []string{"broker1"}, Topic: "topic1"}, errorOccured: false},
+func TestWriterOrderingWithRetries(t *testing.T) {
+	var attempts int32
+
+	transport := &writerTestTransport{
+		topic:      "topic-A",
+		partitions: 1,
+		produce: func(req *produceAPI.Request) (*produceAPI.Response, error) {
+			// Fail the first produce request with a temporary error, the
+			// second batch must not be written before it is retried.
+			if atomic.AddInt32(&attempts, 1) == 1 {
+				return nil, NotLeaderForPartition
+			}
+			return nil, nil
+		},
 	}
-	for _, test := range tests {
-		err := test.config.Validate()
-		if test.errorOccured && err == nil {
-			t.Fail()
-		}
-		if !test.errorOccured && err != nil {
-			t.Fail()
-		}
+
+	var mutex sync.Mutex
+	offsets := make(map[string]int64)
+
+	w := &Writer{
+		Addr:         TCP("localhost:9092"),
+		Topic:        "topic-A",
+		BatchSize:    1,
+		RequiredAcks: RequireAll,
+		Transport:    transport,
+		Completion: func(msgs []Message, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, m := range msgs {
+				offsets[string(m.Value)] = m.Offset
+			}
+		},
+	}
+	defer w.Close()
+
+	if err := w.WriteMessages(context.Background(),
+		Message{Value: []byte("1")},
+		Message{Value: []byte("2")},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("expected 3 produce requests but got %d", n)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if offsets["1"] != 0 || offsets["2"] != 1 {
+		t.Errorf("messages were reordered by the retry: %v", offsets)
 	}
 }
 
@@ -823,3 +2468,100 @@ type staticBalancer struct {
 func (b *staticBalancer) Balance(_ Message, partitions ...int) int {
 	return b.partition
 }
+
+// writerTestTransport is a RoundTripper which serves metadata requests for a
+// single topic and hands produce requests to a function, allowing tests to
+// exercise the writer logic without a kafka broker.
+//
+// When produce is nil, or returns a nil response and no error, the records
+// are acknowledged with monotonically increasing offsets.
+// roundTripperFunc adapts a function to the RoundTripper interface.
+type roundTripperFunc func(context.Context, net.Addr, Request) (Response, error)
+
+func (f roundTripperFunc) RoundTrip(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+	return f(ctx, addr, req)
+}
+
+type writerTestTransport struct {
+	topic      string
+	partitions int
+	produce    func(*produceAPI.Request) (*produceAPI.Response, error)
+	metadata   func(*metadataAPI.Response)
+
+	mutex   sync.Mutex
+	offsets map[int32]int64
+}
+
+func (t *writerTestTransport) RoundTrip(ctx context.Context, addr net.Addr, req Request) (Response, error) {
+	switch r := req.(type) {
+	case *metadataAPI.Request:
+		partitions := make([]metadataAPI.ResponsePartition, t.partitions)
+		for i := range partitions {
+			partitions[i].PartitionIndex = int32(i)
+		}
+		res := &metadataAPI.Response{
+			Topics: []metadataAPI.ResponseTopic{{
+				Name:       t.topic,
+				Partitions: partitions,
+			}},
+		}
+		if t.metadata != nil {
+			t.metadata(res)
+		}
+		return res, nil
+
+	case *produceAPI.Request:
+		if t.produce != nil {
+			res, err := t.produce(r)
+			if res != nil || err != nil {
+				return res, err
+			}
+		}
+		return t.acknowledge(r)
+
+	default:
+		return nil, fmt.Errorf("unsupported request: %T", req)
+	}
+}
+
+func (t *writerTestTransport) acknowledge(req *produceAPI.Request) (*produceAPI.Response, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.offsets == nil {
+		t.offsets = make(map[int32]int64)
+	}
+
+	res := &produceAPI.Response{}
+
+	for _, topic := range req.Topics {
+		resTopic := produceAPI.ResponseTopic{Topic: topic.Topic}
+
+		for _, p := range topic.Partitions {
+			numRecords := int64(0)
+			for {
+				r, err := p.RecordSet.Records.ReadRecord()
+				if err != nil {
+					break
+				}
+				if r.Key != nil {
+					r.Key.Close()
+				}
+				if r.Value != nil {
+					r.Value.Close()
+				}
+				numRecords++
+			}
+
+			resTopic.Partitions = append(resTopic.Partitions, produceAPI.ResponsePartition{
+				Partition:  p.Partition,
+				BaseOffset: t.offsets[p.Partition],
+			})
+			t.offsets[p.Partition] += numRecords
+		}
+
+		res.Topics = append(res.Topics, resTopic)
+	}
+
+	return res, nil
+}
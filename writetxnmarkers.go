@@ -0,0 +1,140 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/segmentio/kafka-go/protocol/writetxnmarkers"
+)
+
+// WriteTxnMarker represents the commit or abort markers of a transaction to
+// write to partitions.
+type WriteTxnMarker struct {
+	// The Producer ID (PID) of the producer which wrote the transaction.
+	ProducerID int
+
+	// The epoch associated with the producer session for the given PID.
+	ProducerEpoch int
+
+	// TransactionResult should be set to true to write commit markers, false
+	// to write abort markers.
+	TransactionResult bool
+
+	// Mappings of topic names to lists of partitions to write the markers to.
+	Topics map[string][]int
+
+	// The epoch of the transaction coordinator writing the markers.
+	CoordinatorEpoch int
+}
+
+// WriteTxnMarkersRequest is the request structure for the WriteTxnMarkers
+// function.
+type WriteTxnMarkersRequest struct {
+	// Address of the kafka broker to send the request to.
+	Addr net.Addr
+
+	// The transaction markers to write.
+	Markers []WriteTxnMarker
+}
+
+// WriteTxnMarkersResponse is the response structure for the WriteTxnMarkers
+// function.
+type WriteTxnMarkersResponse struct {
+	// Mappings of producer IDs to the results of writing their markers.
+	Markers map[int]WriteTxnMarkerResult
+}
+
+// WriteTxnMarkerResult represents the results of writing the markers of a
+// producer.
+type WriteTxnMarkerResult struct {
+	// The Producer ID (PID) that the markers were written for.
+	ProducerID int
+
+	// Mappings of topic names to the results of writing markers to each
+	// partition.
+	Topics map[string][]WriteTxnMarkerPartition
+}
+
+// WriteTxnMarkerPartition represents the result of writing a transaction marker
+// to a partition.
+type WriteTxnMarkerPartition struct {
+	// The ID of the partition.
+	Partition int
+
+	// An error that may have occurred when writing the marker.
+	//
+	// The errors contain the kafka error code. Programs may use the standard
+	// errors.Is function to test the error against kafka error codes.
+	Error error
+}
+
+// WriteTxnMarkers sends a write txn markers request to the leaders of the
+// partitions and returns the merged responses.
+//
+// This API is used by transaction coordinators to write the control records
+// committing or aborting transactions, brokers only accept it from clients
+// authorized to perform cluster actions. It is intended for programs that
+// implement transaction recovery tooling, regular producers should rely on
+// EndTxn instead.
+func (c *Client) WriteTxnMarkers(ctx context.Context, req *WriteTxnMarkersRequest) (*WriteTxnMarkersResponse, error) {
+	protoReq := &writetxnmarkers.Request{
+		Markers: make([]writetxnmarkers.RequestMarker, len(req.Markers)),
+	}
+
+	for i, marker := range req.Markers {
+		m := writetxnmarkers.RequestMarker{
+			ProducerID:        int64(marker.ProducerID),
+			ProducerEpoch:     int16(marker.ProducerEpoch),
+			TransactionResult: marker.TransactionResult,
+			Topics:            make([]writetxnmarkers.RequestTopic, 0, len(marker.Topics)),
+			CoordinatorEpoch:  int32(marker.CoordinatorEpoch),
+		}
+
+		for topic, partitions := range marker.Topics {
+			t := writetxnmarkers.RequestTopic{
+				Name:             topic,
+				PartitionIndexes: make([]int32, len(partitions)),
+			}
+			for j, partition := range partitions {
+				t.PartitionIndexes[j] = int32(partition)
+			}
+			m.Topics = append(m.Topics, t)
+		}
+
+		protoReq.Markers[i] = m
+	}
+
+	m, err := c.roundTrip(ctx, req.Addr, protoReq)
+	if err != nil {
+		return nil, fmt.Errorf("kafka.(*Client).WriteTxnMarkers: %w", err)
+	}
+
+	r := m.(*writetxnmarkers.Response)
+
+	res := &WriteTxnMarkersResponse{
+		Markers: make(map[int]WriteTxnMarkerResult, len(r.Markers)),
+	}
+
+	for _, marker := range r.Markers {
+		result := WriteTxnMarkerResult{
+			ProducerID: int(marker.ProducerID),
+			Topics:     make(map[string][]WriteTxnMarkerPartition, len(marker.Topics)),
+		}
+
+		for _, t := range marker.Topics {
+			partitions := make([]WriteTxnMarkerPartition, 0, len(t.Partitions))
+			for _, p := range t.Partitions {
+				partitions = append(partitions, WriteTxnMarkerPartition{
+					Partition: int(p.PartitionIndex),
+					Error:     makeError(p.ErrorCode, ""),
+				})
+			}
+			result.Topics[t.Name] = partitions
+		}
+
+		res.Markers[result.ProducerID] = result
+	}
+
+	return res, nil
+}